@@ -18,12 +18,15 @@ import (
 	"context"
 	"flag"
 	"os"
-	"runtime"
 	"time"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	// Custom backup storage backends are compiled in with a blank import of their package, see pkg/backup/storage.
+	"github.com/coreos/etcd-operator/pkg/backup/storage"
 	controller "github.com/coreos/etcd-operator/pkg/controller/backup-operator"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 	version "github.com/coreos/etcd-operator/version"
 
 	"github.com/sirupsen/logrus"
@@ -38,10 +41,37 @@ import (
 
 var (
 	createCRD bool
+
+	notificationWebhooks string
+	lifecycleWebhooks    string
+
+	listenAddr string
+
+	workers                 int
+	maxConcurrentS3Backups  int
+	maxConcurrentABSBackups int
+
+	restoreDrillInterval time.Duration
+
+	backupHelperImage string
+
+	defaultStorage controller.DefaultStorage
 )
 
 func init() {
 	flag.BoolVar(&createCRD, "create-crd", true, "The backup operator will not create the EtcdBackup CRD when this flag is set to false.")
+	flag.StringVar(&notificationWebhooks, "notification-webhooks", "", "Comma separated webhook URLs the operator posts significant events to, with a Slack compatible payload")
+	flag.StringVar(&lifecycleWebhooks, "lifecycle-webhooks", "", "Comma separated webhook URLs the operator posts the lifecycle events of the clusters to, as JSON")
+	flag.StringVar(&listenAddr, "listen-addr", "", "The address on which the backup download endpoint and the metrics are served. Both are disabled if empty.")
+	flag.IntVar(&workers, "workers", 1, "The number of backups taken at the same time.")
+	flag.IntVar(&maxConcurrentS3Backups, "max-concurrent-s3-backups", 0, "The number of backups saved to S3 at the same time. 0 means only --workers bounds it.")
+	flag.IntVar(&maxConcurrentABSBackups, "max-concurrent-abs-backups", 0, "The number of backups saved to ABS at the same time. 0 means only --workers bounds it.")
+	flag.DurationVar(&restoreDrillInterval, "restore-drill-interval", 0, "The time between two restore drills of the latest backup of every cluster. Restore drills are disabled if 0.")
+	flag.StringVar(&backupHelperImage, "backup-helper-image", k8sutil.DefaultBackupHelperImage, "The image, with its tag, that fetches the backups into the pods verifying them.")
+	flag.StringVar((*string)(&defaultStorage.StorageType), "default-storage-type", "", "The storage type, S3 or ABS, of the backups that set no storage. Such backups are not taken if empty.")
+	flag.StringVar(&defaultStorage.PathTemplate, "default-backup-path", "", "The path, as a template of {{.Namespace}}, {{.Cluster}} and {{.Name}}, of the backups that set no storage, e.g. etcd-backups/{{.Namespace}}/{{.Cluster}}/{{.Name}}.")
+	flag.StringVar(&defaultStorage.Secret, "default-backup-secret", "", "The secret with the credentials of the default storage, in the namespace of the backups.")
+	flag.StringVar(&defaultStorage.S3Endpoint, "default-s3-endpoint", "", "The endpoint of the S3 compatible default storage. AWS is used if empty.")
 	flag.Parse()
 }
 
@@ -59,10 +89,14 @@ func main() {
 		logrus.Fatalf("failed to get hostname: %v", err)
 	}
 
-	logrus.Infof("Go Version: %s", runtime.Version())
-	logrus.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
-	logrus.Infof("etcd-backup-operator Version: %v", version.Version)
-	logrus.Infof("Git SHA: %s", version.GitSHA)
+	version.LogInfo("etcd-backup-operator")
+	if types := storage.Types(); len(types) != 0 {
+		logrus.Infof("custom backup storage types: %v", types)
+	}
+
+	if err := defaultStorage.Validate(); err != nil {
+		logrus.Fatalf("invalid default storage: %v", err)
+	}
 
 	kubecli := k8sutil.MustNewKubeClient()
 	rl, err := resourcelock.New(
@@ -101,7 +135,16 @@ func createRecorder(kubecli kubernetes.Interface, name, namespace string) record
 }
 
 func run(stop <-chan struct{}) {
-	c := controller.New(createCRD)
+	c := controller.New(createCRD, notifyutil.New(notificationWebhooks), notifyutil.NewWebhookHooks(lifecycleWebhooks), controller.Concurrency{
+		Workers: workers,
+		PerStorageType: map[api.BackupStorageType]int{
+			api.BackupStorageTypeS3:  maxConcurrentS3Backups,
+			api.BackupStorageTypeABS: maxConcurrentABSBackups,
+		},
+	}, restoreDrillInterval, backupHelperImage, defaultStorage)
+	if len(listenAddr) != 0 {
+		go c.StartHTTP(listenAddr)
+	}
 	err := c.Start(context.TODO())
 	if err != nil {
 		logrus.Fatalf("operator stopped with error: %v", err)
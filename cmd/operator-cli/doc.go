@@ -0,0 +1,18 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// operator-cli is a command line tool to inspect the etcd clusters managed by the etcd operator.
+// It reads the status of the EtcdCluster resources the operator keeps up to date,
+// and exports and imports cluster definitions to move clusters between environments.
+package main
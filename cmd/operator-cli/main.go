@@ -0,0 +1,121 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/client"
+	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const usage = `Usage: etcd-operator-cli [flags] <command>
+
+Commands:
+  list           list the etcd clusters with their live status
+  export <name>  print the cluster definition with defaults applied as YAML
+  import <file>  validate and create or update the cluster defined in a YAML file
+
+Flags:
+`
+
+func main() {
+	kubeconfig := flag.String("kubeconfig", os.Getenv("KUBECONFIG"), "kube config file path")
+	ns := flag.String("namespace", "default", "namespace of the etcd clusters")
+	allNamespaces := flag.Bool("all-namespaces", false, "list the etcd clusters in all namespaces")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cmd, args := flag.Arg(0), flag.Args()
+	switch {
+	case cmd == "list" && len(args) == 1:
+	case (cmd == "export" || cmd == "import") && len(args) == 2:
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load kube config: %v\n", err)
+		os.Exit(1)
+	}
+	cli := client.MustNew(config)
+
+	switch cmd {
+	case "list":
+		if *allNamespaces {
+			*ns = metav1.NamespaceAll
+		}
+		err = list(cli, *ns)
+	case "export":
+		err = exportCluster(cli, *ns, args[1])
+	case "import":
+		err = importCluster(cli, *ns, args[1])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to %s etcd clusters: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+// list prints a table of the etcd clusters in the namespace from the status the operator keeps up to date.
+func list(cli versioned.Interface, ns string) error {
+	clusters, err := cli.EtcdV1beta2().EtcdClusters(ns).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tSIZE\tREADY\tVERSION\tLAST BACKUP\tCONDITIONS")
+	now := time.Now()
+	for i := range clusters.Items {
+		c := &clusters.Items[i]
+		lastBackup := "<none>"
+		if t, err := time.Parse(time.RFC3339, c.Status.LastBackupTime); err == nil {
+			lastBackup = now.Sub(t).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", c.Namespace, c.Name, c.Spec.Size,
+			c.Status.ReadyMembers, c.Status.CurrentVersion, lastBackup, conditions(c.Status))
+	}
+	return w.Flush()
+}
+
+// conditions returns the types of the conditions that are true, e.g. "Available,Upgrading".
+func conditions(s api.ClusterStatus) string {
+	var cs []string
+	for _, c := range s.Conditions {
+		if c.Status == v1.ConditionTrue {
+			cs = append(cs, string(c.Type))
+		}
+	}
+	if len(cs) == 0 {
+		return "<none>"
+	}
+	return strings.Join(cs, ",")
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// lastAppliedAnnotation is set by kubectl apply and would carry the source environment along.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// exportCluster prints the definition of the etcd cluster as YAML, with the defaults of the operator applied
+// and without status or server set metadata, so that it can be imported into another namespace or kubernetes cluster.
+func exportCluster(cli versioned.Interface, ns, name string) error {
+	cl, err := cli.EtcdV1beta2().EtcdClusters(ns).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	out, err := normalizeCluster(cl)
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
+
+// importCluster creates the etcd cluster defined in the YAML file, or updates the spec of an existing one.
+// The definition is validated like the operator does before anything is written.
+func importCluster(cli versioned.Interface, ns, file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	in := &api.EtcdCluster{}
+	if err := yaml.Unmarshal(b, in); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", file, err)
+	}
+	cl, err := normalizeCluster(in)
+	if err != nil {
+		return err
+	}
+	if len(in.Namespace) != 0 {
+		ns = in.Namespace
+	}
+
+	clusters := cli.EtcdV1beta2().EtcdClusters(ns)
+	cur, err := clusters.Get(cl.Name, metav1.GetOptions{})
+	switch {
+	case k8sutil.IsKubernetesResourceNotFoundError(err):
+		if _, err := clusters.Create(cl); err != nil {
+			return err
+		}
+		fmt.Printf("etcdcluster %s/%s created\n", ns, cl.Name)
+	case err != nil:
+		return err
+	default:
+		cur.Spec = cl.Spec
+		if _, err := clusters.Update(cur); err != nil {
+			return err
+		}
+		fmt.Printf("etcdcluster %s/%s updated\n", ns, cl.Name)
+	}
+	return nil
+}
+
+// normalizeCluster returns a copy of the cluster with only its name, labels, annotations and spec,
+// the defaults of the operator applied. It fails if the operator would reject the spec.
+func normalizeCluster(in *api.EtcdCluster) (*api.EtcdCluster, error) {
+	if len(in.Name) == 0 {
+		return nil, fmt.Errorf("etcd cluster has no name")
+	}
+	out := &api.EtcdCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.EtcdClusterResourceKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        in.Name,
+			Labels:      in.Labels,
+			Annotations: in.Annotations,
+		},
+		Spec: *in.Spec.DeepCopy(),
+	}
+	if _, ok := out.Annotations[lastAppliedAnnotation]; ok {
+		out.Annotations = make(map[string]string)
+		for k, v := range in.Annotations {
+			if k != lastAppliedAnnotation {
+				out.Annotations[k] = v
+			}
+		}
+	}
+	out.SetDefaults()
+	if err := k8sutil.ValidateClusterSpec(out.Name, out.Spec); err != nil {
+		return nil, fmt.Errorf("invalid spec of etcd cluster (%s): %v", out.Name, err)
+	}
+	return out, nil
+}
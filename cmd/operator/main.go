@@ -25,9 +25,12 @@ import (
 
 	"github.com/coreos/etcd-operator/pkg/chaos"
 	"github.com/coreos/etcd-operator/pkg/client"
+	"github.com/coreos/etcd-operator/pkg/cluster"
 	"github.com/coreos/etcd-operator/pkg/controller"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/metricsutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 	"github.com/coreos/etcd-operator/pkg/util/probe"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
 	"github.com/coreos/etcd-operator/version"
@@ -51,6 +54,7 @@ var (
 	name       string
 	listenAddr string
 	gcInterval time.Duration
+	gcDryRun   bool
 
 	chaosLevel int
 
@@ -59,6 +63,19 @@ var (
 	createCRD bool
 
 	clusterWide bool
+
+	notificationWebhooks string
+	lifecycleWebhooks    string
+
+	maxClustersPerNamespace int
+	maxMembersPerNamespace  int
+
+	metricsPushURL      string
+	metricsPushInterval time.Duration
+
+	fleetStatusInterval time.Duration
+
+	timeouts cluster.Timeouts
 )
 
 func init() {
@@ -67,8 +84,21 @@ func init() {
 	flag.IntVar(&chaosLevel, "chaos-level", -1, "DO NOT USE IN PRODUCTION - level of chaos injected into the etcd clusters created by the operator.")
 	flag.BoolVar(&printVersion, "version", false, "Show version and quit")
 	flag.BoolVar(&createCRD, "create-crd", true, "The operator will not create the EtcdCluster CRD when this flag is set to false.")
-	flag.DurationVar(&gcInterval, "gc-interval", 10*time.Minute, "GC interval")
+	flag.DurationVar(&gcInterval, "gc-interval", 10*time.Minute, "Interval of the sweep that deletes the pods, services, secrets and config maps of clusters whose resource no longer exists. 0 disables it.")
+	flag.BoolVar(&gcDryRun, "gc-dry-run", false, "Only report the objects the sweep would delete in the etcd_operator_controller_orphans metric")
 	flag.BoolVar(&clusterWide, "cluster-wide", false, "Enable operator to watch clusters in all namespaces")
+	flag.StringVar(&notificationWebhooks, "notification-webhooks", "", "Comma separated webhook URLs the operator posts significant events to, with a Slack compatible payload")
+	flag.StringVar(&lifecycleWebhooks, "lifecycle-webhooks", "", "Comma separated webhook URLs the operator posts the lifecycle events of the clusters to, as JSON")
+	flag.IntVar(&maxClustersPerNamespace, "max-clusters-per-namespace", 0, "The maximum number of clusters the operator manages in a namespace. 0 is unlimited.")
+	flag.IntVar(&maxMembersPerNamespace, "max-members-per-namespace", 0, "The maximum total size of the clusters the operator manages in a namespace. 0 is unlimited.")
+	flag.StringVar(&metricsPushURL, "metrics-push-url", "", "The URL of a Prometheus Pushgateway the operator pushes its metrics to, for setups without a Prometheus that scrapes /metrics")
+	flag.DurationVar(&metricsPushInterval, "metrics-push-interval", 30*time.Second, "The interval of pushing the metrics to --metrics-push-url")
+	flag.DurationVar(&fleetStatusInterval, "fleet-status-interval", time.Minute, "Interval of updating the etcd-operator-status ConfigMap with the status of all the clusters the operator manages. 0 disables it.")
+	flag.DurationVar(&timeouts.PodCreate, "pod-create-timeout", cluster.DefaultTimeouts.PodCreate, "The time the disk preflight pod has to be scheduled and complete")
+	flag.DurationVar(&timeouts.MemberAdd, "member-add-timeout", cluster.DefaultTimeouts.MemberAdd, "The timeout of adding a member to the etcd membership")
+	flag.DurationVar(&timeouts.Snapshot, "snapshot-timeout", cluster.DefaultTimeouts.Snapshot, "The time the final snapshot of a deleted cluster has to be saved before the cluster is torn down without it")
+	flag.DurationVar(&timeouts.Defrag, "defrag-timeout", cluster.DefaultTimeouts.Defrag, "The timeout of defragmenting a member")
+	flag.DurationVar(&timeouts.Delete, "delete-timeout", cluster.DefaultTimeouts.Delete, "The timeout of removing a member from the etcd membership")
 	flag.Parse()
 }
 
@@ -90,10 +120,7 @@ func main() {
 		os.Exit(0)
 	}
 
-	logrus.Infof("etcd-operator Version: %v", version.Version)
-	logrus.Infof("Git SHA: %s", version.GitSHA)
-	logrus.Infof("Go Version: %s", runtime.Version())
-	logrus.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
+	version.LogInfo("etcd-operator")
 
 	id, err := os.Hostname()
 	if err != nil {
@@ -101,10 +128,17 @@ func main() {
 	}
 
 	kubecli := k8sutil.MustNewKubeClient()
+	if err := k8sutil.DetectServerVersion(kubecli); err != nil {
+		logrus.Warningf("creating resources for the latest Kubernetes release: %v", err)
+	}
 
 	http.HandleFunc(probe.HTTPReadyzEndpoint, probe.ReadyzHandler)
 	http.Handle("/metrics", prometheus.Handler())
+	http.HandleFunc(version.HTTPPath, version.Handler)
 	go http.ListenAndServe(listenAddr, nil)
+	if len(metricsPushURL) != 0 {
+		go metricsutil.PushPeriodically(metricsPushURL, "etcd-operator", metricsPushInterval)
+	}
 
 	rl, err := resourcelock.New(resourcelock.EndpointsResourceLock,
 		namespace,
@@ -140,6 +174,10 @@ func run(stop <-chan struct{}) {
 	startChaos(context.Background(), cfg.KubeCli, cfg.Namespace, chaosLevel)
 
 	c := controller.New(cfg)
+	http.HandleFunc(controller.ClusterPathPrefix, c.ServeCluster)
+	http.HandleFunc(controller.DashboardPath, c.ServeDashboard)
+	http.HandleFunc(controller.BatchPath, c.ServeBatch)
+	http.HandleFunc(controller.BatchPath+"/", c.ServeBatch)
 	err := c.Start()
 	logrus.Fatalf("controller Start() failed: %v", err)
 }
@@ -160,6 +198,15 @@ func newControllerConfig() controller.Config {
 		KubeExtCli:     k8sutil.MustNewKubeExtClient(),
 		EtcdCRCli:      client.MustNewInCluster(),
 		CreateCRD:      createCRD,
+		Notifier:       notifyutil.New(notificationWebhooks),
+		Hooks:          notifyutil.NewWebhookHooks(lifecycleWebhooks),
+
+		MaxClustersPerNamespace: maxClustersPerNamespace,
+		MaxMembersPerNamespace:  maxMembersPerNamespace,
+		OrphanSweepInterval:     gcInterval,
+		OrphanSweepDryRun:       gcDryRun,
+		FleetStatusInterval:     fleetStatusInterval,
+		Timeouts:                timeouts,
 	}
 
 	return cfg
@@ -19,12 +19,14 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"runtime"
 	"time"
 
+	// Custom backup storage backends are compiled in with a blank import of their package, see pkg/backup/storage.
+	"github.com/coreos/etcd-operator/pkg/backup/storage"
 	controller "github.com/coreos/etcd-operator/pkg/controller/restore-operator"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 	version "github.com/coreos/etcd-operator/version"
 
 	"github.com/sirupsen/logrus"
@@ -40,6 +42,11 @@ import (
 var (
 	namespace string
 	createCRD bool
+
+	notificationWebhooks string
+	lifecycleWebhooks    string
+
+	backupHelperImage string
 )
 
 const (
@@ -49,6 +56,9 @@ const (
 
 func init() {
 	flag.BoolVar(&createCRD, "create-crd", true, "The restore operator will not create the EtcdRestore CRD when this flag is set to false.")
+	flag.StringVar(&notificationWebhooks, "notification-webhooks", "", "Comma separated webhook URLs the operator posts significant events to, with a Slack compatible payload")
+	flag.StringVar(&lifecycleWebhooks, "lifecycle-webhooks", "", "Comma separated webhook URLs the operator posts the lifecycle events of the clusters to, as JSON")
+	flag.StringVar(&backupHelperImage, "backup-helper-image", k8sutil.DefaultBackupHelperImage, "The image, with its tag, that fetches the backup a cluster is restored from. spec.pod.backupHelperImage of a cluster overrides it.")
 	flag.Parse()
 }
 
@@ -66,12 +76,15 @@ func main() {
 		logrus.Fatalf("failed to get hostname: %v", err)
 	}
 
-	logrus.Infof("Go Version: %s", runtime.Version())
-	logrus.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
-	logrus.Infof("etcd-restore-operator Version: %v", version.Version)
-	logrus.Infof("Git SHA: %s", version.GitSHA)
+	version.LogInfo("etcd-restore-operator")
+	if types := storage.Types(); len(types) != 0 {
+		logrus.Infof("custom backup storage types: %v", types)
+	}
 
 	kubecli := k8sutil.MustNewKubeClient()
+	if err := k8sutil.DetectServerVersion(kubecli); err != nil {
+		logrus.Warningf("creating resources for the latest Kubernetes release: %v", err)
+	}
 
 	err = createServiceForMyself(kubecli, name, namespace)
 	if err != nil {
@@ -114,7 +127,7 @@ func createRecorder(kubecli kubernetes.Interface, name, namespace string) record
 }
 
 func run(stop <-chan struct{}) {
-	c := controller.New(createCRD, namespace, fmt.Sprintf("%s:%d", serviceNameForMyself, servicePortForMyself))
+	c := controller.New(createCRD, namespace, fmt.Sprintf("%s:%d", serviceNameForMyself, servicePortForMyself), backupHelperImage, notifyutil.New(notificationWebhooks), notifyutil.NewWebhookHooks(lifecycleWebhooks))
 	err := c.Start(context.TODO())
 	if err != nil {
 		logrus.Fatalf("etcd restore operator stopped with error: %v", err)
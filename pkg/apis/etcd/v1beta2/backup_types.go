@@ -14,7 +14,12 @@
 
 package v1beta2
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
 const (
 	// AWS S3 related consts
@@ -50,6 +55,17 @@ type EtcdBackup struct {
 	Status            BackupStatus `json:"status,omitempty"`
 }
 
+func (eb *EtcdBackup) AsOwner() metav1.OwnerReference {
+	trueVar := true
+	return metav1.OwnerReference{
+		APIVersion: SchemeGroupVersion.String(),
+		Kind:       EtcdBackupResourceKind,
+		Name:       eb.Name,
+		UID:        eb.UID,
+		Controller: &trueVar,
+	}
+}
+
 // BackupSpec contains a backup specification for an etcd cluster.
 type BackupSpec struct {
 	// EtcdEndpoints specifies the endpoints of an etcd cluster.
@@ -72,6 +88,26 @@ type BackupSpec struct {
 	//    "etcd-client.key": <pem-encoded-key>
 	//    "etcd-client-ca.crt": <pem-encoded-ca-cert>
 	ClientTLSSecret string `json:"clientTLSSecret,omitempty"`
+	// Tag is a name for the backup chosen by the user, e.g. "pre-upgrade-2018-06".
+	// An EtcdRestore can select the backup by its tag in spec.backupTag instead of its storage path.
+	Tag string `json:"tag,omitempty"`
+	// Policies back the cluster up to several storages, each on its own schedule, e.g. hourly to S3
+	// and daily to ABS. The backup operator saves the snapshots of each policy in an EtcdBackup of its own,
+	// named "<backup-name>-<policy-name>", and reports their status in status.policies.
+	// The storage type, source and backup policy of the spec must not be set with them.
+	Policies []NamedBackupPolicy `json:"policies,omitempty"`
+}
+
+// NamedBackupPolicy is the storage and policy of one of the policies of a backup.
+type NamedBackupPolicy struct {
+	// Name identifies the policy among the policies of the backup. It must be a DNS label.
+	Name string `json:"name"`
+	// StorageType is the storage type of the snapshots of the policy.
+	StorageType BackupStorageType `json:"storageType"`
+	// BackupPolicy configures the snapshots of the policy, e.g. their interval and how many are kept.
+	BackupPolicy *BackupPolicy `json:"backupPolicy,omitempty"`
+	// BackupSource is the storage of the snapshots of the policy.
+	BackupSource `json:",inline"`
 }
 
 // BackupSource contains the supported backup sources.
@@ -80,24 +116,145 @@ type BackupSource struct {
 	S3 *S3BackupSource `json:"s3,omitempty"`
 	// ABS defines the ABS backup source spec.
 	ABS *ABSBackupSource `json:"abs,omitempty"`
+	// Custom defines the source of a storage type other than S3 and ABS,
+	// saved by a storage backend compiled into the operators.
+	Custom *CustomBackupSource `json:"custom,omitempty"`
 }
 
 // BackupPolicy defines backup policy.
 type BackupPolicy struct {
 	// TimeoutInSecond is the maximal allowed time in second of the entire backup process.
 	TimeoutInSecond int64 `json:"timeoutInSecond,omitempty"`
+	// VerifyRestore makes the backup operator check that the saved backup is restorable.
+	// It restores the backup in a throwaway pod and runs etcd on it briefly.
+	// The result is reported in status.verified once the pod finished, within 5 minutes.
+	VerifyRestore bool `json:"verifyRestore,omitempty"`
+	// BackupIntervalInSecond makes the backup periodic: a snapshot is saved every that many seconds,
+	// at the storage path followed by "_v<etcd-revision>_<time>".
+	// If not set, a single snapshot is saved at the storage path.
+	BackupIntervalInSecond int64 `json:"backupIntervalInSecond,omitempty"`
+	// MaxBackups is the number of snapshots of a periodic backup to keep in storage.
+	// Older snapshots are deleted after each snapshot is saved. If not set, every snapshot is kept.
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// IsPeriodic tells whether the policy makes the backup periodic.
+func (bp *BackupPolicy) IsPeriodic() bool {
+	return bp != nil && bp.BackupIntervalInSecond > 0
 }
 
 // BackupStatus represents the status of the EtcdBackup Custom Resource.
 type BackupStatus struct {
 	// Succeeded indicates if the backup has Succeeded.
+	// A periodic backup has succeeded once any of its snapshots was saved.
 	Succeeded bool `json:"succeeded"`
 	// Reason indicates the reason for any backup related failures.
+	// For a periodic backup, it is the reason the last snapshot failed, if it did.
 	Reason string `json:"Reason,omitempty"`
 	// EtcdVersion is the version of the backup etcd server.
 	EtcdVersion string `json:"etcdVersion,omitempty"`
 	// EtcdRevision is the revision of etcd's KV store where the backup is performed on.
 	EtcdRevision int64 `json:"etcdRevision,omitempty"`
+	// Verified indicates if the backup has been restored successfully
+	// when spec.backupPolicy.verifyRestore is set.
+	Verified bool `json:"verified,omitempty"`
+	// Verifying is true while the backup is being verified; Verified and VerificationReason are set once it is done.
+	Verifying bool `json:"verifying,omitempty"`
+	// VerificationReason indicates the reason the backup failed to be verified.
+	VerificationReason string `json:"verificationReason,omitempty"`
+	// LastSuccessDate is the time the last snapshot of a periodic backup was saved.
+	LastSuccessDate metav1.Time `json:"lastSuccessDate,omitempty"`
+	// LastBackupPath is the storage path of the last snapshot of a periodic backup.
+	LastBackupPath string `json:"lastBackupPath,omitempty"`
+	// Size is the size in bytes of the last snapshot saved.
+	Size int64 `json:"size,omitempty"`
+	// LastRestoreDrill is the result of the last restore drill run on the backup,
+	// if the backup operator runs restore drills and this is the latest backup of its cluster.
+	LastRestoreDrill *RestoreDrillResult `json:"lastRestoreDrill,omitempty"`
+	// Policies is the status of each of spec.policies, in the same order.
+	Policies []BackupPolicyStatus `json:"policies,omitempty"`
+	// Conditions are the conditions of the backup, e.g. BackupFailed while its last snapshot failed.
+	Conditions []BackupCondition `json:"conditions,omitempty"`
+}
+
+// BackupConditionFailed is true while the last snapshot of the backup failed.
+const BackupConditionFailed = "BackupFailed"
+
+// The reasons of the BackupFailed condition.
+const (
+	// BackupFailedReasonDiskFull is the reason of a snapshot that failed as a disk of the backup operator is full.
+	BackupFailedReasonDiskFull = "DiskFull"
+	BackupFailedReasonError    = "Error"
+)
+
+type BackupCondition struct {
+	// Type of backup condition.
+	Type string `json:"type"`
+	// Status of the condition, one of True, False, Unknown.
+	Status v1.ConditionStatus `json:"status"`
+	// Last time the condition transitioned from one status to another.
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+	// The reason for the condition's last transition.
+	Reason string `json:"reason,omitempty"`
+	// A human readable message indicating details about the transition.
+	Message string `json:"message,omitempty"`
+}
+
+// SetFailedCondition sets the BackupFailed condition. Its transition time is kept while it stays true.
+func (bs *BackupStatus) SetFailedCondition(reason, message string) {
+	c := BackupCondition{Type: BackupConditionFailed, Status: v1.ConditionTrue, Reason: reason, Message: message}
+	for i := range bs.Conditions {
+		if bs.Conditions[i].Type == BackupConditionFailed {
+			c.LastTransitionTime = bs.Conditions[i].LastTransitionTime
+			if bs.Conditions[i].Status != v1.ConditionTrue {
+				c.LastTransitionTime = time.Now().Format(time.RFC3339)
+			}
+			bs.Conditions[i] = c
+			return
+		}
+	}
+	c.LastTransitionTime = time.Now().Format(time.RFC3339)
+	bs.Conditions = append(bs.Conditions, c)
+}
+
+// ClearFailedCondition removes the BackupFailed condition.
+func (bs *BackupStatus) ClearFailedCondition() {
+	conditions := bs.Conditions[:0]
+	for _, c := range bs.Conditions {
+		if c.Type != BackupConditionFailed {
+			conditions = append(conditions, c)
+		}
+	}
+	bs.Conditions = conditions
+}
+
+// BackupPolicyStatus is the status of one of the policies of a backup, as reported by its EtcdBackup.
+type BackupPolicyStatus struct {
+	// Name is the name of the policy.
+	Name string `json:"name"`
+	// Backup is the name of the EtcdBackup that saves the snapshots of the policy.
+	Backup string `json:"backup"`
+	// Succeeded, Reason, LastSuccessDate, LastBackupPath and Size are the ones of the status of Backup.
+	Succeeded       bool        `json:"succeeded"`
+	Reason          string      `json:"reason,omitempty"`
+	LastSuccessDate metav1.Time `json:"lastSuccessDate,omitempty"`
+	LastBackupPath  string      `json:"lastBackupPath,omitempty"`
+	Size            int64       `json:"size,omitempty"`
+}
+
+// RestoreDrillResult is the result of restoring a backup into a throwaway etcd member.
+type RestoreDrillResult struct {
+	// Time is when the drill finished.
+	Time metav1.Time `json:"time"`
+	// Succeeded tells whether etcd started on the restored backup
+	// with at least the revision the backup was taken at.
+	Succeeded bool `json:"succeeded"`
+	// Reason indicates why the drill failed.
+	Reason string `json:"reason,omitempty"`
+	// Revision is the revision of the KV store of the restored member.
+	Revision int64 `json:"revision,omitempty"`
+	// KeyCount is the number of keys of the restored member.
+	KeyCount int64 `json:"keyCount,omitempty"`
 }
 
 // S3BackupSource provides the spec how to store backups on S3.
@@ -120,6 +277,17 @@ type S3BackupSource struct {
 	Endpoint string `json:"endpoint,omitempty"`
 }
 
+// CustomBackupSource provides the spec how to store backups on a storage backend registered with the backup
+// and restore operators under the storage type, see pkg/backup/storage.
+type CustomBackupSource struct {
+	// Path is where the backup is saved, in the format of the backend.
+	Path string `json:"path"`
+	// Secret is the name of the secret with the credentials of the backend, if it needs one.
+	Secret string `json:"secret,omitempty"`
+	// Config is the configuration of the backend, e.g. its endpoint.
+	Config map[string]string `json:"config,omitempty"`
+}
+
 // ABSBackupSource provides the spec how to store backups on ABS.
 type ABSBackupSource struct {
 	// Path is the full abs path where the backup is saved.
@@ -16,15 +16,42 @@ package v1beta2
 
 import (
 	"errors"
+	"fmt"
+	"path"
+	"reflect"
 	"strings"
 
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
 	defaultRepository  = "quay.io/coreos/etcd"
 	DefaultEtcdVersion = "3.2.13"
+
+	defaultClientPort = 2379
+	defaultPeerPort   = 2380
+
+	defaultCompactionIntervalInSecond = 300
+	defaultDefragIntervalInSecond     = 24 * 60 * 60
+
+	// etcd's own defaults for the snapshot and WAL settings of EtcdPolicy since etcd 3.2.
+	defaultMaxMemberReplacementsPerHour = 3
+	defaultMaxPodDeletionsPerReconcile  = 1
+
+	defaultSnapshotCount = 100000
+	defaultMaxWALs       = 5
+	defaultMaxSnapshots  = 5
+
+	// etcd's own defaults for the timing and quota settings of EtcdPolicy, which are only set through a profile.
+	defaultHeartbeatIntervalInMillisecond = 100
+	defaultElectionTimeoutInMillisecond   = 1000
+	defaultQuotaBackendBytes              = 2 * 1024 * 1024 * 1024
+
+	defaultMaxFsyncP99InMillisecond = 10
+
+	defaultRestoreAfterSeconds = 300
 )
 
 var (
@@ -65,11 +92,22 @@ func (c *EtcdCluster) AsOwner() metav1.OwnerReference {
 }
 
 type ClusterSpec struct {
+	// Preset is a set of defaults, "small" or "production-ha", for the fields of the spec
+	// that are not set. See ./doc/user/cluster_presets.md.
+	Preset string `json:"preset,omitempty"`
+
 	// Size is the expected size of the etcd cluster.
 	// The etcd-operator will eventually make the size of the running
 	// cluster equal to the expected size.
 	// The vaild range of the size is from 1 to 7.
+	// If not set, the size of the preset is used.
 	Size int `json:"size"`
+
+	// Tier is "dev" or "production". If not set, default is "production".
+	// A dev cluster has a single member: its pod is not spread across nodes and etcd is
+	// restarted in place when it exits, keeping the member. Setting the tier to production
+	// and the size to 3 promotes a dev cluster. See ./doc/user/cluster_presets.md#dev-tier.
+	Tier string `json:"tier,omitempty"`
 	// Repository is the name of the repository that hosts
 	// etcd container images. It should be direct clone of the repository in official
 	// release:
@@ -89,6 +127,14 @@ type ClusterSpec struct {
 	// If version is not set, default is "3.2.13".
 	Version string `json:"version,omitempty"`
 
+	// ConvergeVersions makes the operator roll members that run a version other
+	// than Version outside of an upgrade, one at a time, back to Version.
+	// Such members always set the Degraded condition.
+	ConvergeVersions bool `json:"convergeVersions,omitempty"`
+
+	// Upgrade defines the checks the operator makes before it starts to roll the members to a new Version.
+	Upgrade *UpgradePolicy `json:"upgrade,omitempty"`
+
 	// Paused is to pause the control of the operator for the etcd cluster.
 	Paused bool `json:"paused,omitempty"`
 
@@ -97,8 +143,356 @@ type ClusterSpec struct {
 	// Updating Pod does not take effect on any existing etcd pods.
 	Pod *PodPolicy `json:"pod,omitempty"`
 
+	// Sidecars enables well-known containers next to etcd in the member pods, e.g. a metrics exporter.
+	Sidecars *SidecarsPolicy `json:"sidecars,omitempty"`
+
 	// etcd cluster TLS configuration
 	TLS *TLSPolicy `json:"TLS,omitempty"`
+
+	// Auth defines the etcd users the operator authenticates as, once etcd auth is enabled on the cluster.
+	Auth *AuthPolicy `json:"auth,omitempty"`
+
+	// ClientPort is the port the members and the client service serve clients on,
+	// e.g. to run several clusters with host networking on the same nodes.
+	// If not set, default is 2379. This field cannot be updated.
+	ClientPort int `json:"clientPort,omitempty"`
+	// PeerPort is the port the members serve their peers on.
+	// If not set, default is 2380. This field cannot be updated.
+	PeerPort int `json:"peerPort,omitempty"`
+
+	// Etcd defines the configuration of the etcd server processes.
+	//
+	// Updating Etcd does not take effect on any existing etcd pods,
+	// except for Etcd.Metrics.
+	Etcd *EtcdPolicy `json:"etcd,omitempty"`
+
+	// Compaction defines the policy for the operator to periodically compact
+	// the keyspace history of the etcd cluster.
+	// It is meant for clusters that do not use etcd's --auto-compaction-retention.
+	Compaction *CompactionPolicy `json:"compaction,omitempty"`
+
+	// Defragmentation defines the policy for the operator to periodically
+	// defragment the backend database of the etcd members.
+	Defragmentation *DefragmentationPolicy `json:"defragmentation,omitempty"`
+
+	// RepairBudget limits how fast the operator replaces members and deletes pods on its own,
+	// e.g. because of a flapping node or a misbehaving health check.
+	// If not set, the operator repairs the cluster without limits.
+	RepairBudget *RepairBudgetPolicy `json:"repairBudget,omitempty"`
+
+	// PropagatedLabels are the keys of the labels of the EtcdCluster resource that are
+	// copied to the pods, services, persistent volume claims, config maps and secrets
+	// the operator creates for the cluster, e.g. for cost allocation.
+	// The labels are copied when the objects are created.
+	PropagatedLabels []string `json:"propagatedLabels,omitempty"`
+
+	// MaxReconcileFailures is the number of consecutive failed reconciliations
+	// after which the cluster is marked Failed and no longer reconciled.
+	// Failed reconciliations are retried with an exponential backoff in any case.
+	// If not set, the operator retries forever.
+	MaxReconcileFailures int `json:"maxReconcileFailures,omitempty"`
+
+	// SelfHealing defines what the operator does when the cluster cannot be repaired.
+	SelfHealing *SelfHealingPolicy `json:"selfHealing,omitempty"`
+
+	// Alerts defines the thresholds beyond which the operator sets the ThresholdExceeded condition.
+	Alerts *AlertPolicy `json:"alerts,omitempty"`
+
+	// DiskPreflight, if set, makes the operator benchmark the fsync latency of the storage of a node
+	// before adding a member on it, and refuse the nodes that are too slow for etcd.
+	DiskPreflight *DiskPreflightPolicy `json:"diskPreflight,omitempty"`
+
+	// Bootstrap bounds the time a new cluster has to get a quorum of ready members.
+	Bootstrap *BootstrapPolicy `json:"bootstrap,omitempty"`
+
+	// DeletionPolicy defines what happens to the persistent volume claims, secrets and backups
+	// of the cluster once the EtcdCluster is deleted, and whether it is backed up one last time.
+	// If not set, the objects the operator created for the cluster are deleted with it, and the others are kept.
+	DeletionPolicy *DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// StandbyOf is the name of an EtcdCluster of the same namespace this cluster is a warm standby of.
+	// The operator restores the standby from each newer successful EtcdBackup of that cluster, through the restore
+	// operator, and does not publish its connection info. Removing StandbyOf, or annotating the cluster with
+	// "etcd.database.coreos.com/promote=now", promotes the standby to a cluster of its own.
+	// StandbyOf cannot be set on a running cluster, as its data would be replaced.
+	StandbyOf string `json:"standbyOf,omitempty"`
+
+	// DependsOn are the names of the EtcdClusters of the same namespace that must be ready before this cluster
+	// is created, e.g. the cluster of the infrastructure an application cluster relies on.
+	// The cluster stays Pending, with the Blocked condition telling what it waits for, until they all are.
+	// DependsOn only orders the creation: a running cluster is not affected by its dependencies.
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// TTLInSecond is the lifetime of the cluster, e.g. of a cluster for a CI run or an experiment, from the creation
+	// of its EtcdCluster. The operator creates a warning event shortly before the cluster expires, and deletes
+	// the EtcdCluster once it has, which tears the cluster down with its deletion policy.
+	// If not set, the cluster lives until it is deleted.
+	TTLInSecond int64 `json:"ttlInSecond,omitempty"`
+
+	// Timeouts override, for this cluster, the timeouts of the operations of the operator on its members.
+	// A timeout that is not set takes the default of the operator, set by its flags.
+	Timeouts *TimeoutPolicy `json:"timeouts,omitempty"`
+}
+
+// TimeoutPolicy bounds the operations of the operator on the members of a cluster.
+type TimeoutPolicy struct {
+	// PodCreateTimeoutInSecond is the time the pod of the disk preflight has to be scheduled and complete.
+	PodCreateTimeoutInSecond int64 `json:"podCreateTimeoutInSecond,omitempty"`
+	// MemberAddTimeoutInSecond bounds adding a member, or a learner, to the etcd membership.
+	MemberAddTimeoutInSecond int64 `json:"memberAddTimeoutInSecond,omitempty"`
+	// SnapshotTimeoutInSecond is the time the final snapshot of a deleted cluster has to be saved before the cluster
+	// is torn down without it. spec.deletionPolicy.finalSnapshotTimeoutInSecond, if set, takes precedence.
+	SnapshotTimeoutInSecond int64 `json:"snapshotTimeoutInSecond,omitempty"`
+	// DefragTimeoutInSecond bounds the defragmentation of a member.
+	DefragTimeoutInSecond int64 `json:"defragTimeoutInSecond,omitempty"`
+	// DeleteTimeoutInSecond bounds removing a member from the etcd membership before its pod is deleted.
+	DeleteTimeoutInSecond int64 `json:"deleteTimeoutInSecond,omitempty"`
+}
+
+// BootstrapPolicy defines how long the operator waits for a new cluster to come up.
+// It only applies to clusters the operator creates, not to restored ones.
+type BootstrapPolicy struct {
+	// TimeoutInSecond is the time a new cluster has, from the creation of its seed member,
+	// to get a quorum of spec.size ready members that serves linearizable reads.
+	// Once it is exceeded, the pods of the cluster are deleted and the cluster is created anew,
+	// or marked Failed with the pods that were not ready and why if MaxRetries is used up.
+	// If not set, the operator waits forever.
+	TimeoutInSecond int64 `json:"timeoutInSecond,omitempty"`
+	// MaxRetries is the number of times the cluster is created anew after its bootstrap timed out.
+	// If not set, the cluster is marked Failed on the first timeout.
+	MaxRetries int `json:"maxRetries,omitempty"`
+}
+
+const (
+	// DeletionRetain keeps the resources of a deleted cluster.
+	DeletionRetain = "Retain"
+	// DeletionDelete deletes the resources of a deleted cluster.
+	DeletionDelete = "Delete"
+)
+
+// DeletionPolicy defines how the operator tears a cluster down once its EtcdCluster is deleted.
+// The operator holds the EtcdCluster with a finalizer until the policy is applied.
+type DeletionPolicy struct {
+	// PersistentVolumeClaims is "Delete", the default, to delete the persistent volume claims of the members
+	// with their pods, or "Retain" to keep them, and so their data, once the cluster is deleted.
+	PersistentVolumeClaims string `json:"persistentVolumeClaims,omitempty"`
+	// Secrets is "Retain", the default, to keep the secrets of the cluster, including the CA the operator
+	// generated for it, or "Delete" to delete them, including the secrets of spec.TLS.static.
+	Secrets string `json:"secrets,omitempty"`
+	// Backups is "Retain", the default, or "Delete" to delete the EtcdBackups of the cluster
+	// and the snapshots they saved. The backup operator deletes the snapshots.
+	// The final snapshot is always kept.
+	Backups string `json:"backups,omitempty"`
+	// FinalSnapshot backs the cluster up, to the storage of its latest successful backup,
+	// before it is torn down. The cluster is torn down without it if it has no backup.
+	FinalSnapshot bool `json:"finalSnapshot,omitempty"`
+	// FinalSnapshotTimeoutInSecond is the time the final snapshot has, from the deletion of the EtcdCluster,
+	// to be saved and verified. Once it is exceeded, the cluster is torn down anyway.
+	// If not set, the snapshot timeout of spec.timeouts or of the operator applies, 600 by default.
+	FinalSnapshotTimeoutInSecond int64 `json:"finalSnapshotTimeoutInSecond,omitempty"`
+}
+
+// DiskPreflightPolicy defines the disk benchmark run before a member is added.
+type DiskPreflightPolicy struct {
+	// Image is the image of the benchmark pod. It must have fio 3.5 or later on its PATH.
+	Image string `json:"image"`
+	// MaxFsyncP99InMillisecond is the 99th percentile of the fdatasync duration above which a node is refused.
+	// If not set, default is 10, the latency etcd recommends for its WAL.
+	MaxFsyncP99InMillisecond int64 `json:"maxFsyncP99InMillisecond,omitempty"`
+}
+
+// AlertPolicy defines the health thresholds of a cluster. Thresholds that are not set are not checked.
+type AlertPolicy struct {
+	// MaxDBSizePercent is the size of the largest member database, in percent of the etcd backend quota,
+	// spec.etcd.quotaBackendBytes or 2GiB.
+	MaxDBSizePercent int `json:"maxDBSizePercent,omitempty"`
+	// MaxWALFsyncP99InMillisecond is the 99th percentile of the WAL fsync duration of the slowest member,
+	// as measured between two checks of the operator.
+	MaxWALFsyncP99InMillisecond int64 `json:"maxWALFsyncP99InMillisecond,omitempty"`
+	// MaxLeaderChangesPerHour is the number of leader changes seen by the operator in the last hour.
+	MaxLeaderChangesPerHour int `json:"maxLeaderChangesPerHour,omitempty"`
+	// MaxKeysGrowthPerHour is the number of keys the cluster gains per hour, over the samples of the key space
+	// of the last hour, e.g. to catch a runaway writer.
+	MaxKeysGrowthPerHour int64 `json:"maxKeysGrowthPerHour,omitempty"`
+	// MaxDBGrowthBytesPerHour is the growth of the largest member database in bytes per hour, over the samples
+	// of the key space of the last hour, to warn well before the database reaches the backend quota.
+	MaxDBGrowthBytesPerHour int64 `json:"maxDBGrowthBytesPerHour,omitempty"`
+	// PrometheusRule makes the operator maintain a PrometheusRule "<cluster-name>-alerts"
+	// with an alert for each of the thresholds, for the Prometheus operator to load.
+	// The alerts are based on the metrics of the etcd operator, so they do not depend on how etcd is scraped.
+	PrometheusRule bool `json:"prometheusRule,omitempty"`
+}
+
+// UpgradePolicy defines the preflight checks of an upgrade beyond those the operator always makes,
+// i.e. that every member is ready and healthy, no alarm is raised and every database fits in the backend quota.
+type UpgradePolicy struct {
+	// MaxBackupAgeInSecond requires a successful EtcdBackup of the cluster, created within that many seconds,
+	// before an upgrade starts. If not set, no backup is required.
+	MaxBackupAgeInSecond int64 `json:"maxBackupAgeInSecond,omitempty"`
+}
+
+// SelfHealingPolicy defines how the operator handles the loss of a whole cluster.
+type SelfHealingPolicy struct {
+	// RecreateEmpty recreates the cluster, without any data, once all its members are dead
+	// and no EtcdBackup of the cluster exists. All the data of the cluster is lost.
+	// If not set, the cluster stays dead until it is restored or deleted.
+	RecreateEmpty bool `json:"recreateEmpty,omitempty"`
+	// RestoreFromBackup restores the cluster from its latest successful EtcdBackup once it lost quorum,
+	// by creating an EtcdRestore for the restore operator. The writes since the backup are lost.
+	// It takes precedence over RecreateEmpty.
+	RestoreFromBackup bool `json:"restoreFromBackup,omitempty"`
+	// RestoreAfterSeconds is the number of seconds the cluster must stay without quorum before it is restored
+	// from backup, so that members which only restart do not cost the writes since the backup.
+	// The cluster is restored right away once none of its member pods and PVCs are left.
+	// If not set, default is 300.
+	RestoreAfterSeconds int `json:"restoreAfterSeconds,omitempty"`
+}
+
+// RestoreAfterSecondsOrDefault returns the seconds a cluster must stay without quorum before it is restored
+// from backup, 300 if they are not set.
+func (p *SelfHealingPolicy) RestoreAfterSecondsOrDefault() int {
+	if p == nil || p.RestoreAfterSeconds == 0 {
+		return defaultRestoreAfterSeconds
+	}
+	return p.RestoreAfterSeconds
+}
+
+// RepairBudgetPolicy defines the budget of the automated repair of a cluster.
+// Scaling and upgrades requested through the spec are not limited.
+type RepairBudgetPolicy struct {
+	// MaxMemberReplacementsPerHour is the maximum number of members the operator replaces
+	// within an hour, e.g. dead members or stuck learners.
+	// Replacements pause, and the RepairPaused condition is set, once the budget is used up.
+	// If not set, default is 3.
+	MaxMemberReplacementsPerHour int `json:"maxMemberReplacementsPerHour,omitempty"`
+	// MaxPodDeletionsPerReconcile is the maximum number of unexpected pods the operator deletes
+	// in one reconciliation. The remaining pods are deleted in the next reconciliations.
+	// If not set, default is 1.
+	MaxPodDeletionsPerReconcile int `json:"maxPodDeletionsPerReconcile,omitempty"`
+}
+
+// EtcdPolicy defines the configuration of the etcd server processes.
+// Fields that are not set leave etcd's own defaults in place.
+type EtcdPolicy struct {
+	// InitialClusterToken is the token the members of a new cluster bootstrap with. Members bootstrapped
+	// with different tokens never form a cluster together, even if they reach each other's peer URLs.
+	// It sets etcd's --initial-cluster-token flag. If not set, default is the UID of the EtcdCluster,
+	// so that a cluster deleted and recreated under the same name never joins the members of the previous one
+	// that still run somewhere. Updating InitialClusterToken only takes effect when the cluster bootstraps anew,
+	// e.g. when it is restored from a backup.
+	InitialClusterToken string `json:"initialClusterToken,omitempty"`
+
+	// MaxRequestBytes is the maximum client request size in bytes the server accepts.
+	// It sets etcd's --max-request-bytes flag.
+	MaxRequestBytes int64 `json:"maxRequestBytes,omitempty"`
+
+	// GRPCKeepAliveMinTimeInSecond is the minimum time a client should wait before pinging the server.
+	// It sets etcd's --grpc-keepalive-min-time flag.
+	GRPCKeepAliveMinTimeInSecond int64 `json:"grpcKeepAliveMinTimeInSecond,omitempty"`
+	// GRPCKeepAliveIntervalInSecond is the time between server-to-client pings checking a connection is alive.
+	// It sets etcd's --grpc-keepalive-interval flag.
+	GRPCKeepAliveIntervalInSecond int64 `json:"grpcKeepAliveIntervalInSecond,omitempty"`
+	// GRPCKeepAliveTimeoutInSecond is the time to wait for a ping response before closing a connection.
+	// It sets etcd's --grpc-keepalive-timeout flag.
+	GRPCKeepAliveTimeoutInSecond int64 `json:"grpcKeepAliveTimeoutInSecond,omitempty"`
+
+	// Profile is a set of tuning defaults, "low-latency", "balanced" or "high-throughput", for the heartbeat interval,
+	// election timeout, snapshot count and backend quota. Only the fields the policy leaves unset are taken from it.
+	Profile string `json:"profile,omitempty"`
+
+	// HeartbeatIntervalInMillisecond is the time between two heartbeats of the leader to its followers.
+	// It sets etcd's --heartbeat-interval flag. etcd's default is 100.
+	HeartbeatIntervalInMillisecond int64 `json:"heartbeatIntervalInMillisecond,omitempty"`
+	// ElectionTimeoutInMillisecond is the time a follower waits for a heartbeat before it starts an election.
+	// It must be at least 5 times the heartbeat interval. It sets etcd's --election-timeout flag. etcd's default is 1000.
+	ElectionTimeoutInMillisecond int64 `json:"electionTimeoutInMillisecond,omitempty"`
+	// QuotaBackendBytes is the size the backend database may grow to before etcd raises a NOSPACE alarm
+	// and only accepts reads and deletes. It sets etcd's --quota-backend-bytes flag. etcd's default is 2GiB.
+	QuotaBackendBytes int64 `json:"quotaBackendBytes,omitempty"`
+
+	// SnapshotCount is the number of committed transactions that trigger a snapshot to disk.
+	// Lower values reduce memory usage and the time to catch up slow followers, at the cost of more disk I/O.
+	// It sets etcd's --snapshot-count flag. If spec.etcd is set and SnapshotCount is not, default is 100000.
+	SnapshotCount int64 `json:"snapshotCount,omitempty"`
+	// MaxWALs is the maximum number of WAL files etcd retains.
+	// It sets etcd's --max-wals flag. If spec.etcd is set and MaxWALs is not, default is 5.
+	MaxWALs int64 `json:"maxWALs,omitempty"`
+	// MaxSnapshots is the maximum number of snapshot files etcd retains.
+	// It sets etcd's --max-snapshots flag. If spec.etcd is set and MaxSnapshots is not, default is 5.
+	MaxSnapshots int64 `json:"maxSnapshots,omitempty"`
+
+	// BackendFreelistType is the freelist type of the bbolt backend, "map" or "array".
+	// "map" speeds up commits on large databases with many free pages. It requires etcd 3.4 or later.
+	BackendFreelistType string `json:"backendFreelistType,omitempty"`
+	// BackendBatchIntervalInMillisecond is the maximum time before etcd commits a backend transaction.
+	// It sets etcd's --backend-batch-interval flag and requires etcd 3.4 or later.
+	BackendBatchIntervalInMillisecond int64 `json:"backendBatchIntervalInMillisecond,omitempty"`
+	// BackendBatchLimit is the maximum number of operations before etcd commits a backend transaction.
+	// It sets etcd's --backend-batch-limit flag and requires etcd 3.4 or later.
+	BackendBatchLimit int64 `json:"backendBatchLimit,omitempty"`
+
+	// LogLevel is the log level of the etcd members, one of "debug", "info", "warn" or "error".
+	// A single member can temporarily run at another level by annotating its pod
+	// with "etcd.database.coreos.com/log-level".
+	LogLevel string `json:"logLevel,omitempty"`
+	// LogOutputs are the destinations etcd writes its logs to, e.g. "stderr" or a file path.
+	// It sets etcd's --log-outputs flag and requires etcd 3.4 or later.
+	LogOutputs []string `json:"logOutputs,omitempty"`
+
+	// Metrics is the verbosity of the metrics etcd exports, "basic" or "extensive".
+	// "extensive" adds histograms, e.g. of gRPC request latencies. It requires etcd 3.3 or later.
+	// If not set, default is "basic".
+	// Changing Metrics replaces the members one at a time with members running the new setting.
+	Metrics string `json:"metrics,omitempty"`
+
+	// Experimental sets etcd --experimental-* flags, keyed by flag name without the "experimental-" prefix,
+	// e.g. "corrupt-check-time": "5m".
+	// Only a vetted set of flags is accepted, and each only for the etcd versions that have it.
+	Experimental map[string]string `json:"experimental,omitempty"`
+}
+
+// Metrics verbosities of EtcdPolicy.Metrics.
+const (
+	EtcdMetricsBasic     = "basic"
+	EtcdMetricsExtensive = "extensive"
+)
+
+// Tiers of ClusterSpec.Tier.
+const (
+	ClusterTierDev        = "dev"
+	ClusterTierProduction = "production"
+)
+
+const (
+	AntiAffinityScopeCluster     = "Cluster"
+	AntiAffinityScopeAllClusters = "AllClusters"
+)
+
+// MetricsOrDefault returns the metrics verbosity of the policy, "basic" if it is not set.
+func (p *EtcdPolicy) MetricsOrDefault() string {
+	if p == nil || len(p.Metrics) == 0 {
+		return EtcdMetricsBasic
+	}
+	return p.Metrics
+}
+
+// QuotaBackendBytesOrDefault returns the backend quota of the members, etcd's default if it is not set.
+func (p *EtcdPolicy) QuotaBackendBytesOrDefault() int64 {
+	if p == nil || p.QuotaBackendBytes == 0 {
+		return defaultQuotaBackendBytes
+	}
+	return p.QuotaBackendBytes
+}
+
+// CompactionPolicy defines how the operator compacts the etcd keyspace history.
+type CompactionPolicy struct {
+	// RetentionRevisions is the number of most recent revisions to keep.
+	// Every compaction discards the history older than the current revision
+	// minus RetentionRevisions.
+	RetentionRevisions int64 `json:"retentionRevisions"`
+	// IntervalInSecond is the time between two compactions.
+	// If not set, default is 300 (5 minutes).
+	IntervalInSecond int64 `json:"intervalInSecond,omitempty"`
 }
 
 // PodPolicy defines the policy to create pod for the etcd container.
@@ -116,8 +510,15 @@ type PodPolicy struct {
 
 	// The scheduling constraints on etcd pods.
 	Affinity *v1.Affinity `json:"affinity,omitempty"`
-	// **DEPRECATED**. Use Affinity instead.
+	// AntiAffinity keeps the members on distinct nodes. Its pod anti-affinity term is merged
+	// into Affinity: it comes first among the required pod anti-affinity terms of Affinity,
+	// unless Affinity already has the same term, and the rest of Affinity is left as is.
 	AntiAffinity bool `json:"antiAffinity,omitempty"`
+	// AntiAffinityScope is the etcd pods AntiAffinity keeps a member away from:
+	// "Cluster", the default, for the members of the same cluster, or "AllClusters"
+	// for the members of any etcd cluster in the namespace.
+	// It is only used with AntiAffinity.
+	AntiAffinityScope string `json:"antiAffinityScope,omitempty"`
 
 	// Resources is the resource requirements for the etcd container.
 	// This field cannot be updated once the cluster is created.
@@ -126,6 +527,38 @@ type PodPolicy struct {
 	// Tolerations specifies the pod's tolerations.
 	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
 
+	// SchedulerName is the scheduler that places the etcd pods, e.g. a scheduler
+	// aware of local disk topology. If not set, the default scheduler is used.
+	// Updating SchedulerName does not take effect on any existing etcd pods.
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	// HostAliases are entries added to the /etc/hosts file of the etcd pods,
+	// for names in peer certificates or discovery that cluster DNS does not resolve.
+	// Updating HostAliases does not take effect on any existing etcd pods.
+	HostAliases []v1.HostAlias `json:"hostAliases,omitempty"`
+
+	// Subdomain is the subdomain of the etcd pods, i.e. the name of the headless peer service,
+	// which the names of the members start with. A member is addressed as "<member>.<subdomain>.<namespace>.svc",
+	// so that certificates for "*.<subdomain>.<namespace>.svc", e.g. issued by a corporate PKI,
+	// stay valid for the members that replace the failed ones.
+	// It must be a DNS-1035 label of at most 52 characters, other than the client service name of the cluster.
+	// If not set, it is the peer service name derived from the cluster name.
+	// This field cannot be updated once the cluster is created.
+	Subdomain string `json:"subdomain,omitempty"`
+
+	// TerminationGracePeriodSeconds is the time an etcd pod has to hand leadership over
+	// and shut etcd down cleanly once it is deleted, before it is killed.
+	// It is also the grace period the operator deletes member pods with.
+	// If not set, the Kubernetes default of 30 applies, and the operator deletes pods with 5.
+	// Updating TerminationGracePeriodSeconds does not take effect on any existing etcd pods.
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// ForceDeleteAfterSeconds is the time an etcd pod may stay terminating past its grace period,
+	// e.g. on a node that was lost, before the operator force deletes it. Its member is then removed
+	// from the cluster like that of any other deleted pod.
+	// If not set, the operator force deletes pods stuck for 300 seconds. 0 disables forced deletion.
+	ForceDeleteAfterSeconds *int64 `json:"forceDeleteAfterSeconds,omitempty"`
+
 	// List of environment variables to set in the etcd container.
 	// This is used to configure etcd process. etcd cluster cannot be created, when
 	// bad environement variables are provided. Do not overwrite any flags used to
@@ -139,6 +572,19 @@ type PodPolicy struct {
 	// not the stable storage. Future work need to make it used as stable storage.
 	PersistentVolumeClaimSpec *v1.PersistentVolumeClaimSpec `json:"persistentVolumeClaimSpec,omitempty"`
 
+	// WALVolumeClaimSpec is the spec of a second PVC per member holding the etcd write ahead log,
+	// e.g. to put the WAL on lower latency storage than the data.
+	// It requires PersistentVolumeClaimSpec. If not set, the WAL is kept in the data directory.
+	// The seed member of a restored cluster always keeps its WAL in the data directory.
+	// Updating WALVolumeClaimSpec does not take effect on any existing etcd pods.
+	WALVolumeClaimSpec *v1.PersistentVolumeClaimSpec `json:"walVolumeClaimSpec,omitempty"`
+
+	// DataVolumeMountPath is the absolute path the etcd data volume is mounted at in the etcd container.
+	// etcd keeps its data in the "data" directory under it.
+	// If not set, default is "/var/etcd".
+	// Updating DataVolumeMountPath does not take effect on any existing etcd pods.
+	DataVolumeMountPath string `json:"dataVolumeMountPath,omitempty"`
+
 	// Annotations specifies the annotations to attach to pods the operator creates for the
 	// etcd cluster.
 	// The "etcd.version" annotation is reserved for the internal use of the etcd operator.
@@ -149,25 +595,211 @@ type PodPolicy struct {
 	// More info: https://github.com/docker-library/busybox/issues/27
 	BusyboxImage string `json:"busyboxImage,omitempty"`
 
+	// BackupHelperImage is the image, with its tag, of the init container that fetches the backup
+	// the seed member of the cluster is restored from. It must ship bash and curl.
+	// It overrides the --backup-helper-image flag of the restore operator, whose default is tutum/curl.
+	BackupHelperImage string `json:"backupHelperImage,omitempty"`
+
 	// SecurityContext specifies the security context for the entire pod
 	// More info: https://kubernetes.io/docs/tasks/configure-pod-container/security-context
 	SecurityContext *v1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// OverridePatch is a strategic merge patch of the Pod, applied to every etcd pod
+	// as the last step before it is created. It adjusts fields the other settings do not cover,
+	// e.g. {"spec": {"priorityClassName": "etcd"}}.
+	// The reserved labels must not be changed.
+	// Updating OverridePatch does not take effect on any existing etcd pods.
+	OverridePatch *runtime.RawExtension `json:"overridePatch,omitempty"`
+}
+
+// IsDevTier tells whether the cluster is a single member development cluster.
+func (c *ClusterSpec) IsDevTier() bool {
+	return c.Tier == ClusterTierDev
+}
+
+// DefragmentationPolicy defines how the operator defragments the etcd members.
+// Members are defragmented one at a time, and the leader only after leadership
+// has been moved to another member.
+type DefragmentationPolicy struct {
+	// IntervalInSecond is the time between two defragmentations of the cluster.
+	// If not set, default is 86400 (24 hours).
+	IntervalInSecond int64 `json:"intervalInSecond,omitempty"`
 }
 
 // TODO: move this to initializer
 func (c *ClusterSpec) Validate() error {
+	if _, ok := presets[c.Preset]; len(c.Preset) != 0 && !ok {
+		return fmt.Errorf("spec: unknown preset (%s), must be %q or %q", c.Preset, PresetSmall, PresetProductionHA)
+	}
+
+	if t := c.Tier; len(t) != 0 && t != ClusterTierDev && t != ClusterTierProduction {
+		return fmt.Errorf("spec: unknown tier (%s), must be %q or %q", t, ClusterTierDev, ClusterTierProduction)
+	}
+	if c.IsDevTier() && c.Size != 1 {
+		return fmt.Errorf("spec: a %s tier cluster must have size 1, set the tier to %q to resize it", ClusterTierDev, ClusterTierProduction)
+	}
+
 	if c.TLS != nil {
 		if err := c.TLS.Validate(); err != nil {
 			return err
 		}
 	}
 
+	if c.Auth != nil {
+		if err := c.Auth.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Sidecars != nil {
+		if err := c.Sidecars.Validate(c.TLS); err != nil {
+			return err
+		}
+	}
+
+	if c.Etcd != nil {
+		if c.Etcd.MaxRequestBytes < 0 || c.Etcd.GRPCKeepAliveMinTimeInSecond < 0 ||
+			c.Etcd.GRPCKeepAliveIntervalInSecond < 0 || c.Etcd.GRPCKeepAliveTimeoutInSecond < 0 ||
+			c.Etcd.SnapshotCount < 0 || c.Etcd.MaxWALs < 0 || c.Etcd.MaxSnapshots < 0 ||
+			c.Etcd.BackendBatchIntervalInMillisecond < 0 || c.Etcd.BackendBatchLimit < 0 ||
+			c.Etcd.HeartbeatIntervalInMillisecond < 0 || c.Etcd.ElectionTimeoutInMillisecond < 0 || c.Etcd.QuotaBackendBytes < 0 {
+			return errors.New("spec: etcd settings must not be negative")
+		}
+		if err := c.Etcd.validateProfile(); err != nil {
+			return err
+		}
+		if m := c.Etcd.Metrics; len(m) != 0 && m != EtcdMetricsBasic && m != EtcdMetricsExtensive {
+			return fmt.Errorf("spec: unknown etcd metrics (%s), must be %q or %q", m, EtcdMetricsBasic, EtcdMetricsExtensive)
+		}
+		if t := c.Etcd.BackendFreelistType; len(t) != 0 && t != "map" && t != "array" {
+			return fmt.Errorf("spec: unknown etcd backendFreelistType (%s), must be \"map\" or \"array\"", t)
+		}
+	}
+
+	if c.ClientPort < 0 || c.ClientPort > 65535 || c.PeerPort < 0 || c.PeerPort > 65535 {
+		return errors.New("spec: clientPort and peerPort must be between 1 and 65535")
+	}
+	if c.ClientPort != 0 && c.ClientPort == c.PeerPort {
+		return errors.New("spec: clientPort and peerPort must differ")
+	}
+
+	if c.Compaction != nil {
+		if c.Compaction.RetentionRevisions <= 0 {
+			return errors.New("spec: compaction retentionRevisions must be positive")
+		}
+		if c.Compaction.IntervalInSecond < 0 {
+			return errors.New("spec: compaction intervalInSecond must not be negative")
+		}
+	}
+
+	if c.Defragmentation != nil && c.Defragmentation.IntervalInSecond < 0 {
+		return errors.New("spec: defragmentation intervalInSecond must not be negative")
+	}
+
+	if a := c.Alerts; a != nil && (a.MaxDBSizePercent < 0 || a.MaxDBSizePercent > 100 || a.MaxWALFsyncP99InMillisecond < 0 || a.MaxLeaderChangesPerHour < 0 ||
+		a.MaxKeysGrowthPerHour < 0 || a.MaxDBGrowthBytesPerHour < 0) {
+		return errors.New("spec: alerts thresholds must not be negative, and maxDBSizePercent must be at most 100")
+	}
+
+	if c.Upgrade != nil && c.Upgrade.MaxBackupAgeInSecond < 0 {
+		return errors.New("spec: upgrade maxBackupAgeInSecond must not be negative")
+	}
+
+	if p := c.DiskPreflight; p != nil {
+		if len(p.Image) == 0 {
+			return errors.New("spec: diskPreflight image must be set")
+		}
+		if p.MaxFsyncP99InMillisecond < 0 {
+			return errors.New("spec: diskPreflight maxFsyncP99InMillisecond must not be negative")
+		}
+	}
+
+	if c.SelfHealing != nil && c.SelfHealing.RestoreAfterSeconds < 0 {
+		return errors.New("spec: selfHealing restoreAfterSeconds must not be negative")
+	}
+
+	if c.Bootstrap != nil && (c.Bootstrap.TimeoutInSecond < 0 || c.Bootstrap.MaxRetries < 0) {
+		return errors.New("spec: bootstrap settings must not be negative")
+	}
+
+	if c.MaxReconcileFailures < 0 {
+		return errors.New("spec: maxReconcileFailures must not be negative")
+	}
+
+	if c.RepairBudget != nil && (c.RepairBudget.MaxMemberReplacementsPerHour < 0 || c.RepairBudget.MaxPodDeletionsPerReconcile < 0) {
+		return errors.New("spec: repairBudget settings must not be negative")
+	}
+
+	if p := c.DeletionPolicy; p != nil {
+		for _, a := range []struct{ field, action string }{
+			{"persistentVolumeClaims", p.PersistentVolumeClaims}, {"secrets", p.Secrets}, {"backups", p.Backups},
+		} {
+			if len(a.action) != 0 && a.action != DeletionRetain && a.action != DeletionDelete {
+				return fmt.Errorf("spec: unknown deletionPolicy %s (%s), must be %q or %q", a.field, a.action, DeletionRetain, DeletionDelete)
+			}
+		}
+		if p.FinalSnapshotTimeoutInSecond < 0 {
+			return errors.New("spec: deletionPolicy finalSnapshotTimeoutInSecond must not be negative")
+		}
+	}
+
+	if c.TTLInSecond < 0 {
+		return errors.New("spec: ttlInSecond must not be negative")
+	}
+
+	if t := c.Timeouts; t != nil {
+		for _, a := range []struct {
+			field   string
+			seconds int64
+		}{
+			{"podCreateTimeoutInSecond", t.PodCreateTimeoutInSecond}, {"memberAddTimeoutInSecond", t.MemberAddTimeoutInSecond},
+			{"snapshotTimeoutInSecond", t.SnapshotTimeoutInSecond}, {"defragTimeoutInSecond", t.DefragTimeoutInSecond},
+			{"deleteTimeoutInSecond", t.DeleteTimeoutInSecond},
+		} {
+			if a.seconds < 0 {
+				return fmt.Errorf("spec: timeouts %s must not be negative", a.field)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range c.DependsOn {
+		if len(name) == 0 {
+			return errors.New("spec: dependsOn names must not be empty")
+		}
+		if seen[name] {
+			return fmt.Errorf("spec: cluster (%s) listed twice in dependsOn", name)
+		}
+		seen[name] = true
+	}
+
 	if c.Pod != nil {
 		for k := range c.Pod.Labels {
 			if k == "app" || strings.HasPrefix(k, "etcd_") {
 				return errors.New("spec: pod labels contains reserved label")
 			}
 		}
+		if g := c.Pod.TerminationGracePeriodSeconds; g != nil && *g < 0 {
+			return errors.New("spec: pod terminationGracePeriodSeconds must not be negative")
+		}
+		if f := c.Pod.ForceDeleteAfterSeconds; f != nil && *f < 0 {
+			return errors.New("spec: pod forceDeleteAfterSeconds must not be negative")
+		}
+		if s := c.Pod.AntiAffinityScope; len(s) != 0 && s != AntiAffinityScopeCluster && s != AntiAffinityScopeAllClusters {
+			return fmt.Errorf("spec: unknown pod antiAffinityScope (%s), must be %q or %q", s, AntiAffinityScopeCluster, AntiAffinityScopeAllClusters)
+		}
+		if c.Pod.WALVolumeClaimSpec != nil && c.Pod.PersistentVolumeClaimSpec == nil {
+			return errors.New("spec: pod walVolumeClaimSpec requires persistentVolumeClaimSpec")
+		}
+		if p := c.Pod.DataVolumeMountPath; len(p) != 0 && (!path.IsAbs(p) || path.Clean(p) == "/") {
+			return fmt.Errorf("spec: pod dataVolumeMountPath (%s) must be an absolute path other than /", p)
+		}
+	}
+
+	for _, k := range c.PropagatedLabels {
+		if k == "app" || strings.HasPrefix(k, "etcd_") {
+			return fmt.Errorf("spec: propagatedLabels contains reserved label (%s)", k)
+		}
 	}
 	return nil
 }
@@ -176,6 +808,8 @@ func (c *ClusterSpec) Validate() error {
 // TODO: move this to initializer
 func (e *EtcdCluster) SetDefaults() {
 	c := &e.Spec
+	c.applyPreset()
+
 	if len(c.Repository) == 0 {
 		c.Repository = defaultRepository
 	}
@@ -186,21 +820,86 @@ func (e *EtcdCluster) SetDefaults() {
 
 	c.Version = strings.TrimLeft(c.Version, "v")
 
-	// convert PodPolicy.AntiAffinity to Pod.Affinity.PodAntiAffinity
-	// TODO: Remove this once PodPolicy.AntiAffinity is removed
-	if c.Pod != nil && c.Pod.AntiAffinity && c.Pod.Affinity == nil {
-		c.Pod.Affinity = &v1.Affinity{
-			PodAntiAffinity: &v1.PodAntiAffinity{
-				RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{
-					{
-						// set anti-affinity to the etcd pods that belongs to the same cluster
-						LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{
-							"etcd_cluster": e.Name,
-						}},
-						TopologyKey: "kubernetes.io/hostname",
-					},
+	if c.ClientPort == 0 {
+		c.ClientPort = defaultClientPort
+	}
+	if c.PeerPort == 0 {
+		c.PeerPort = defaultPeerPort
+	}
+
+	if c.Etcd != nil {
+		c.Etcd.applyProfile()
+		if c.Etcd.SnapshotCount == 0 {
+			c.Etcd.SnapshotCount = defaultSnapshotCount
+		}
+		if c.Etcd.MaxWALs == 0 {
+			c.Etcd.MaxWALs = defaultMaxWALs
+		}
+		if c.Etcd.MaxSnapshots == 0 {
+			c.Etcd.MaxSnapshots = defaultMaxSnapshots
+		}
+	}
+
+	if c.Compaction != nil && c.Compaction.IntervalInSecond == 0 {
+		c.Compaction.IntervalInSecond = defaultCompactionIntervalInSecond
+	}
+
+	if c.Defragmentation != nil && c.Defragmentation.IntervalInSecond == 0 {
+		c.Defragmentation.IntervalInSecond = defaultDefragIntervalInSecond
+	}
+
+	if c.DiskPreflight != nil && c.DiskPreflight.MaxFsyncP99InMillisecond == 0 {
+		c.DiskPreflight.MaxFsyncP99InMillisecond = defaultMaxFsyncP99InMillisecond
+	}
+
+	if c.RepairBudget != nil {
+		if c.RepairBudget.MaxMemberReplacementsPerHour == 0 {
+			c.RepairBudget.MaxMemberReplacementsPerHour = defaultMaxMemberReplacementsPerHour
+		}
+		if c.RepairBudget.MaxPodDeletionsPerReconcile == 0 {
+			c.RepairBudget.MaxPodDeletionsPerReconcile = defaultMaxPodDeletionsPerReconcile
+		}
+	}
+
+	// merge PodPolicy.AntiAffinity into Pod.Affinity.PodAntiAffinity
+	// The single member of a dev cluster has nothing to be spread from.
+	if c.Pod != nil && c.Pod.AntiAffinity && !c.IsDevTier() {
+		// set anti-affinity to the etcd pods that belongs to the same cluster
+		selector := &metav1.LabelSelector{MatchLabels: map[string]string{
+			"etcd_cluster": e.Name,
+		}}
+		if c.Pod.AntiAffinityScope == AntiAffinityScopeAllClusters {
+			// or to the etcd pods of any cluster
+			selector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "etcd"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "etcd_cluster", Operator: metav1.LabelSelectorOpExists},
 				},
-			},
+			}
+		}
+		c.Pod.Affinity = mergePodAntiAffinityTerm(c.Pod.Affinity, v1.PodAffinityTerm{
+			LabelSelector: selector,
+			TopologyKey:   "kubernetes.io/hostname",
+		})
+	}
+}
+
+// mergePodAntiAffinityTerm returns a copy of aff with the term first among its required pod anti-affinity terms.
+// A term of aff equal to it is dropped, so that merging again, e.g. on every update of the cluster, changes nothing.
+func mergePodAntiAffinityTerm(aff *v1.Affinity, term v1.PodAffinityTerm) *v1.Affinity {
+	merged := aff.DeepCopy()
+	if merged == nil {
+		merged = &v1.Affinity{}
+	}
+	if merged.PodAntiAffinity == nil {
+		merged.PodAntiAffinity = &v1.PodAntiAffinity{}
+	}
+	terms := []v1.PodAffinityTerm{term}
+	for _, t := range merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		if !reflect.DeepEqual(t, term) {
+			terms = append(terms, t)
 		}
 	}
+	merged.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = terms
+	return merged
 }
@@ -0,0 +1,43 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import "errors"
+
+// AuthPolicy defines the etcd users the operator authenticates as when etcd auth is enabled.
+// The operator neither enables auth nor creates the users. Each secret holds the "username" and "password"
+// of a user, like a secret of type kubernetes.io/basic-auth.
+//
+// The membership and the data path are reached with different users, so that the credentials of the
+// periodic probes cannot change the membership of the cluster.
+type AuthPolicy struct {
+	// MembershipSecret is the secret of the user the operator manages the members and maintains the cluster as:
+	// it adds, promotes and removes members, compacts, defragments, moves the leader and reads the alarms.
+	// The user needs the root role.
+	MembershipSecret string `json:"membershipSecret,omitempty"`
+	// ProbeSecret is the secret of the user the operator probes the health and the key space of the cluster as.
+	// The user needs read permission on the whole key space, and should not have the root role.
+	ProbeSecret string `json:"probeSecret,omitempty"`
+}
+
+func (ap *AuthPolicy) Validate() error {
+	if len(ap.MembershipSecret) == 0 || len(ap.ProbeSecret) == 0 {
+		return errors.New("spec: auth membershipSecret and probeSecret must both be set")
+	}
+	if ap.MembershipSecret == ap.ProbeSecret {
+		return errors.New("spec: auth membershipSecret and probeSecret must be different secrets")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetDefaultsMergesAntiAffinity(t *testing.T) {
+	zone := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "etcd"}},
+		TopologyKey:   "failure-domain.beta.kubernetes.io/zone",
+	}
+	nodeAffinity := &v1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+		NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{
+			{Key: "disktype", Operator: v1.NodeSelectorOpIn, Values: []string{"ssd"}},
+		}}},
+	}}
+	e := &EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: ClusterSpec{Pod: &PodPolicy{
+			AntiAffinity: true,
+			Affinity: &v1.Affinity{
+				NodeAffinity:    nodeAffinity,
+				PodAntiAffinity: &v1.PodAntiAffinity{RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{zone}},
+			},
+		}},
+	}
+	// Defaults are applied again on every update of the cluster.
+	e.SetDefaults()
+	e.SetDefaults()
+
+	aff := e.Spec.Pod.Affinity
+	expected := []v1.PodAffinityTerm{{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"etcd_cluster": "test"}},
+		TopologyKey:   "kubernetes.io/hostname",
+	}, zone}
+	if !reflect.DeepEqual(aff.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, expected) {
+		t.Errorf("expect pod anti-affinity terms %v, get %v", expected, aff.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+	}
+	if !reflect.DeepEqual(aff.NodeAffinity, nodeAffinity) {
+		t.Errorf("expect node affinity to be kept, get %v", aff.NodeAffinity)
+	}
+}
+
+func TestTLSPolicyValidate(t *testing.T) {
+	tests := []struct {
+		tls       *TLSPolicy
+		expectErr bool
+	}{
+		{tls: &TLSPolicy{}},
+		{tls: &TLSPolicy{Static: &StaticTLS{Member: &MemberSecret{PeerSecret: "peer"}}}},
+		{tls: &TLSPolicy{Static: &StaticTLS{Member: &MemberSecret{ServerSecret: "server"}, OperatorSecret: "operator"}}},
+		{tls: &TLSPolicy{Static: &StaticTLS{OperatorSecret: "operator"}}, expectErr: true},
+		{tls: &TLSPolicy{Static: &StaticTLS{Member: &MemberSecret{ServerSecret: "server"}}}, expectErr: true},
+	}
+	for i, tt := range tests {
+		if err := tt.tls.Validate(); (err != nil) != tt.expectErr {
+			t.Errorf("#%d: Validate()=%v, expect error %v", i, err, tt.expectErr)
+		}
+	}
+}
+
+func TestAuthPolicyValidate(t *testing.T) {
+	tests := []struct {
+		auth      *AuthPolicy
+		expectErr bool
+	}{
+		{auth: &AuthPolicy{MembershipSecret: "etcd-root", ProbeSecret: "etcd-probe"}},
+		{auth: &AuthPolicy{}, expectErr: true},
+		{auth: &AuthPolicy{MembershipSecret: "etcd-root"}, expectErr: true},
+		{auth: &AuthPolicy{MembershipSecret: "etcd-root", ProbeSecret: "etcd-root"}, expectErr: true},
+	}
+	for i, tt := range tests {
+		if err := tt.auth.Validate(); (err != nil) != tt.expectErr {
+			t.Errorf("#%d: Validate()=%v, expect error %v", i, err, tt.expectErr)
+		}
+	}
+}
+
+func TestValidateTier(t *testing.T) {
+	tests := []struct {
+		spec      ClusterSpec
+		expectErr bool
+	}{
+		{spec: ClusterSpec{Size: 3}},
+		{spec: ClusterSpec{Size: 1, Tier: ClusterTierDev}},
+		{spec: ClusterSpec{Size: 3, Tier: ClusterTierProduction}},
+		{spec: ClusterSpec{Size: 3, Tier: ClusterTierDev}, expectErr: true},
+		{spec: ClusterSpec{Size: 1, Tier: "staging"}, expectErr: true},
+	}
+	for i, tt := range tests {
+		if err := tt.spec.Validate(); (err != nil) != tt.expectErr {
+			t.Errorf("#%d: Validate()=%v, expect error %v", i, err, tt.expectErr)
+		}
+	}
+}
+
+func TestSetDefaultsSkipsAntiAffinityOfDevTier(t *testing.T) {
+	e := &EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec:       ClusterSpec{Tier: ClusterTierDev, Pod: &PodPolicy{AntiAffinity: true}},
+	}
+	e.SetDefaults()
+	if e.Spec.Pod.Affinity != nil {
+		t.Errorf("expect no affinity for a dev cluster, get %v", e.Spec.Pod.Affinity)
+	}
+}
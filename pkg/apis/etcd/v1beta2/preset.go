@@ -0,0 +1,78 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// PresetSmall is a single member cluster with small resource requests, e.g. for development.
+	PresetSmall = "small"
+	// PresetProductionHA is a three member cluster spread across nodes, with a repair budget.
+	PresetProductionHA = "production-ha"
+)
+
+// presets are the cluster specs of the presets. Only the fields a cluster spec leaves unset are taken from them.
+var presets = map[string]ClusterSpec{
+	PresetSmall: {
+		Size: 1,
+		Pod: &PodPolicy{
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("100m"),
+				v1.ResourceMemory: resource.MustParse("256Mi"),
+			}},
+		},
+	},
+	PresetProductionHA: {
+		Size: 3,
+		Pod: &PodPolicy{
+			AntiAffinity: true,
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("1"),
+				v1.ResourceMemory: resource.MustParse("2Gi"),
+			}},
+		},
+		RepairBudget: &RepairBudgetPolicy{},
+	},
+}
+
+// applyPreset fills the fields of the spec that are not set from its preset.
+// Unknown presets are left to Validate.
+func (c *ClusterSpec) applyPreset() {
+	p, ok := presets[c.Preset]
+	if !ok {
+		return
+	}
+	if c.Size == 0 {
+		c.Size = p.Size
+	}
+	if c.RepairBudget == nil && p.RepairBudget != nil {
+		c.RepairBudget = p.RepairBudget.DeepCopy()
+	}
+	if p.Pod == nil {
+		return
+	}
+	if c.Pod == nil {
+		c.Pod = &PodPolicy{}
+	}
+	if !c.Pod.AntiAffinity {
+		c.Pod.AntiAffinity = p.Pod.AntiAffinity
+	}
+	if len(c.Pod.Resources.Requests) == 0 && len(c.Pod.Resources.Limits) == 0 {
+		c.Pod.Resources = *p.Pod.Resources.DeepCopy()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSetDefaultsPreset(t *testing.T) {
+	e := &EtcdCluster{Spec: ClusterSpec{Preset: PresetProductionHA}}
+	e.SetDefaults()
+	if e.Spec.Size != 3 {
+		t.Errorf("expect size=3, get=%d", e.Spec.Size)
+	}
+	if e.Spec.Pod == nil || e.Spec.Pod.Affinity == nil || e.Spec.Pod.Affinity.PodAntiAffinity == nil {
+		t.Fatalf("expect pod anti-affinity, get=%#v", e.Spec.Pod)
+	}
+	if e.Spec.RepairBudget == nil || e.Spec.RepairBudget.MaxMemberReplacementsPerHour != defaultMaxMemberReplacementsPerHour {
+		t.Errorf("expect default repair budget, get=%#v", e.Spec.RepairBudget)
+	}
+
+	// Fields set in the spec win over the preset.
+	mem := resource.MustParse("8Gi")
+	e = &EtcdCluster{Spec: ClusterSpec{
+		Preset: PresetProductionHA,
+		Size:   5,
+		Pod:    &PodPolicy{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceMemory: mem}}},
+	}}
+	e.SetDefaults()
+	if e.Spec.Size != 5 {
+		t.Errorf("expect size=5, get=%d", e.Spec.Size)
+	}
+	if rl := e.Spec.Pod.Resources.Requests; len(rl) != 1 || rl.Memory().Cmp(mem) != 0 {
+		t.Errorf("expect requests of the spec, get=%v", rl)
+	}
+	if _, ok := presets[PresetProductionHA].Pod.Resources.Requests[v1.ResourceCPU]; !ok {
+		t.Error("expect the preset not to be changed")
+	}
+}
+
+func TestValidatePreset(t *testing.T) {
+	for _, p := range []string{"", PresetSmall, PresetProductionHA} {
+		c := &ClusterSpec{Preset: p}
+		if err := c.Validate(); err != nil {
+			t.Errorf("preset %q: unexpected error: %v", p, err)
+		}
+	}
+	c := &ClusterSpec{Preset: "huge"}
+	if err := c.Validate(); err == nil {
+		t.Error("expect error for unknown preset")
+	}
+}
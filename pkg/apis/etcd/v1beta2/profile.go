@@ -0,0 +1,93 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import "fmt"
+
+const (
+	// EtcdProfileLowLatency detects a lost leader quickly and keeps followers close to the leader,
+	// for clusters whose members are in the same zone.
+	EtcdProfileLowLatency = "low-latency"
+	// EtcdProfileBalanced is etcd's timing with a larger backend quota.
+	EtcdProfileBalanced = "balanced"
+	// EtcdProfileHighThroughput tolerates the slower heartbeats of members under heavy write load
+	// instead of electing a new leader, and gives large key spaces room to grow.
+	EtcdProfileHighThroughput = "high-throughput"
+)
+
+// etcdProfiles are the settings of the profiles. Only the fields a policy leaves unset are taken from them.
+var etcdProfiles = map[string]EtcdPolicy{
+	EtcdProfileLowLatency: {
+		HeartbeatIntervalInMillisecond: 50,
+		ElectionTimeoutInMillisecond:   500,
+		SnapshotCount:                  10000,
+		QuotaBackendBytes:              2 * 1024 * 1024 * 1024,
+	},
+	EtcdProfileBalanced: {
+		HeartbeatIntervalInMillisecond: 100,
+		ElectionTimeoutInMillisecond:   1000,
+		SnapshotCount:                  50000,
+		QuotaBackendBytes:              4 * 1024 * 1024 * 1024,
+	},
+	EtcdProfileHighThroughput: {
+		HeartbeatIntervalInMillisecond: 200,
+		ElectionTimeoutInMillisecond:   2000,
+		SnapshotCount:                  100000,
+		QuotaBackendBytes:              8 * 1024 * 1024 * 1024,
+	},
+}
+
+// applyProfile fills the fields of the policy that are not set from its profile.
+// Unknown profiles are left to Validate.
+func (p *EtcdPolicy) applyProfile() {
+	pp, ok := etcdProfiles[p.Profile]
+	if !ok {
+		return
+	}
+	if p.HeartbeatIntervalInMillisecond == 0 {
+		p.HeartbeatIntervalInMillisecond = pp.HeartbeatIntervalInMillisecond
+	}
+	if p.ElectionTimeoutInMillisecond == 0 {
+		p.ElectionTimeoutInMillisecond = pp.ElectionTimeoutInMillisecond
+	}
+	if p.SnapshotCount == 0 {
+		p.SnapshotCount = pp.SnapshotCount
+	}
+	if p.QuotaBackendBytes == 0 {
+		p.QuotaBackendBytes = pp.QuotaBackendBytes
+	}
+}
+
+// validateProfile checks the profile, and that the election timeout of the policy once expanded,
+// with etcd's defaults for what is still unset, is at least 5 heartbeats as etcd requires.
+func (p *EtcdPolicy) validateProfile() error {
+	if _, ok := etcdProfiles[p.Profile]; len(p.Profile) != 0 && !ok {
+		return fmt.Errorf("spec: unknown etcd profile (%s), must be %q, %q or %q",
+			p.Profile, EtcdProfileLowLatency, EtcdProfileBalanced, EtcdProfileHighThroughput)
+	}
+	e := *p
+	e.applyProfile()
+	heartbeat, election := e.HeartbeatIntervalInMillisecond, e.ElectionTimeoutInMillisecond
+	if heartbeat == 0 {
+		heartbeat = defaultHeartbeatIntervalInMillisecond
+	}
+	if election == 0 {
+		election = defaultElectionTimeoutInMillisecond
+	}
+	if election < 5*heartbeat {
+		return fmt.Errorf("spec: etcd electionTimeoutInMillisecond (%d) must be at least 5 times heartbeatIntervalInMillisecond (%d)", election, heartbeat)
+	}
+	return nil
+}
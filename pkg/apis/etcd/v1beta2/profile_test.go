@@ -0,0 +1,62 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import "testing"
+
+func TestSetDefaultsEtcdProfile(t *testing.T) {
+	e := &EtcdCluster{Spec: ClusterSpec{Etcd: &EtcdPolicy{Profile: EtcdProfileLowLatency, SnapshotCount: 20000}}}
+	e.SetDefaults()
+	p := e.Spec.Etcd
+	if p.HeartbeatIntervalInMillisecond != 50 || p.ElectionTimeoutInMillisecond != 500 {
+		t.Errorf("expect the timing of the profile, get heartbeat=%d election=%d", p.HeartbeatIntervalInMillisecond, p.ElectionTimeoutInMillisecond)
+	}
+	// Fields set in the policy win over the profile.
+	if p.SnapshotCount != 20000 {
+		t.Errorf("expect snapshotCount=20000, get=%d", p.SnapshotCount)
+	}
+	if p.QuotaBackendBytesOrDefault() != 2*1024*1024*1024 {
+		t.Errorf("expect the quota of the profile, get=%d", p.QuotaBackendBytes)
+	}
+
+	var none *EtcdPolicy
+	if q := none.QuotaBackendBytesOrDefault(); q != defaultQuotaBackendBytes {
+		t.Errorf("expect etcd's default quota, get=%d", q)
+	}
+}
+
+func TestValidateEtcdProfile(t *testing.T) {
+	tests := []struct {
+		policy EtcdPolicy
+		wErr   bool
+	}{
+		{policy: EtcdPolicy{}},
+		{policy: EtcdPolicy{Profile: EtcdProfileLowLatency}},
+		{policy: EtcdPolicy{Profile: EtcdProfileBalanced}},
+		{policy: EtcdPolicy{Profile: EtcdProfileHighThroughput}},
+		{policy: EtcdPolicy{Profile: "fast"}, wErr: true},
+		// etcd's default election timeout is too short for this heartbeat.
+		{policy: EtcdPolicy{HeartbeatIntervalInMillisecond: 300}, wErr: true},
+		// and so is the one of the profile.
+		{policy: EtcdPolicy{Profile: EtcdProfileLowLatency, HeartbeatIntervalInMillisecond: 200}, wErr: true},
+		{policy: EtcdPolicy{Profile: EtcdProfileLowLatency, HeartbeatIntervalInMillisecond: 200, ElectionTimeoutInMillisecond: 1000}},
+	}
+	for i, tt := range tests {
+		c := &ClusterSpec{Etcd: &tt.policy}
+		if err := c.Validate(); (err != nil) != tt.wErr {
+			t.Errorf("#%d: want error=%v, get err=%v", i, tt.wErr, err)
+		}
+	}
+}
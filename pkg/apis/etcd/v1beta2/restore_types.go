@@ -43,11 +43,19 @@ type RestoreSpec struct {
 	BackupStorageType BackupStorageType `json:"backupStorageType"`
 	// RestoreSource tells the where to get the backup and restore from.
 	RestoreSource `json:",inline"`
+	// BackupTag selects the backup to restore from by the spec.tag of a successful EtcdBackup
+	// in the namespace of the restore operator, instead of BackupStorageType and RestoreSource.
+	// The restore operator fills these in from the backup, the most recent one if several have the tag.
+	BackupTag string `json:"backupTag,omitempty"`
 	// EtcdCluster references an EtcdCluster resource whose metadata and spec
 	// will be used to create the new restored EtcdCluster CR.
 	// This reference EtcdCluster CR and all its resources will be deleted before the
 	// restored EtcdCluster CR is created.
 	EtcdCluster EtcdClusterRef `json:"etcdCluster"`
+	// SkipHashCheck skips the integrity hash check of the backup during restore.
+	// It is required to restore from a db file copied out of a member's data directory,
+	// since such a file carries no hash unlike a snapshot taken via the etcd API.
+	SkipHashCheck bool `json:"skipHashCheck,omitempty"`
 }
 
 // EtcdCluster references an EtcdCluster resource whose metadata and spec
@@ -66,6 +74,9 @@ type RestoreSource struct {
 
 	// ABS tells where on ABS the backup is saved and how to fetch the backup.
 	ABS *ABSRestoreSource `json:"abs,omitempty"`
+
+	// Custom tells where the backup is saved on a storage type other than S3 and ABS, and how to fetch it.
+	Custom *CustomBackupSource `json:"custom,omitempty"`
 }
 
 type S3RestoreSource struct {
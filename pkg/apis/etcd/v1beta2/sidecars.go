@@ -0,0 +1,52 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import (
+	"errors"
+
+	"k8s.io/api/core/v1"
+)
+
+// SidecarsPolicy enables the well-known containers the operator runs next to etcd in the member pods.
+// The operator sets their images, commands, ports and probes. Like spec.pod, changes only take effect
+// on the member pods created from then on.
+type SidecarsPolicy struct {
+	// Exporter serves the metrics of the member over plain HTTP on port 9379, e.g. for a Prometheus
+	// without a client certificate of a cluster with client TLS. It serves nothing but /metrics.
+	Exporter *SidecarSpec `json:"exporter,omitempty"`
+	// TLSReloader reloads the client certificate of the exporter once the operator secret of spec.TLS
+	// is updated, e.g. by a CA rotation. It needs the exporter and client TLS.
+	// The containers of the member pods then share their process namespace, which needs Kubernetes 1.12,
+	// or the PodShareProcessNamespace feature gate before.
+	TLSReloader *SidecarSpec `json:"tlsReloader,omitempty"`
+}
+
+// SidecarSpec defines a well-known container of the member pods.
+type SidecarSpec struct {
+	// Image is the image, with its tag, of the container.
+	// If not set, the operator uses the image it pins for the container.
+	Image string `json:"image,omitempty"`
+	// Resources are the resource requirements of the container.
+	// Unlike those of etcd, they are not taken from spec.pod.resources.
+	Resources v1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+func (sp *SidecarsPolicy) Validate(tls *TLSPolicy) error {
+	if sp.TLSReloader != nil && (sp.Exporter == nil || !tls.IsSecureClient()) {
+		return errors.New("spec: sidecars tlsReloader needs the exporter and client TLS")
+	}
+	return nil
+}
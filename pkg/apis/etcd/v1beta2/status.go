@@ -24,24 +24,105 @@ import (
 type ClusterPhase string
 type ClusterConditionType string
 
+// See ./doc/user/cluster_phases.md for the phases and their transitions.
 const (
-	ClusterPhaseNone     ClusterPhase = ""
-	ClusterPhaseCreating              = "Creating"
-	ClusterPhaseRunning               = "Running"
-	ClusterPhaseFailed                = "Failed"
+	ClusterPhaseNone       ClusterPhase = ""
+	ClusterPhasePending    ClusterPhase = "Pending"
+	ClusterPhaseCreating   ClusterPhase = "Creating"
+	ClusterPhaseRunning    ClusterPhase = "Running"
+	ClusterPhaseResizing   ClusterPhase = "Resizing"
+	ClusterPhaseUpgrading  ClusterPhase = "Upgrading"
+	ClusterPhaseRecovering ClusterPhase = "Recovering"
+	ClusterPhaseFailed     ClusterPhase = "Failed"
+	ClusterPhaseDeleting   ClusterPhase = "Deleting"
+	ClusterPhaseDeleted    ClusterPhase = "Deleted"
+)
+
+// clusterPhaseTransitions are the phases each phase may move to.
+// Clusters restored from a backup start out Running.
+var clusterPhaseTransitions = map[ClusterPhase][]ClusterPhase{
+	ClusterPhaseNone:       {ClusterPhasePending, ClusterPhaseRunning, ClusterPhaseFailed, ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhasePending:    {ClusterPhaseCreating, ClusterPhaseFailed, ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhaseCreating:   {ClusterPhaseRunning, ClusterPhaseFailed, ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhaseRunning:    {ClusterPhaseResizing, ClusterPhaseUpgrading, ClusterPhaseRecovering, ClusterPhaseFailed, ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhaseResizing:   {ClusterPhaseRunning, ClusterPhaseUpgrading, ClusterPhaseRecovering, ClusterPhaseFailed, ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhaseUpgrading:  {ClusterPhaseRunning, ClusterPhaseResizing, ClusterPhaseRecovering, ClusterPhaseFailed, ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhaseRecovering: {ClusterPhaseRunning, ClusterPhaseResizing, ClusterPhaseUpgrading, ClusterPhaseFailed, ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhaseFailed:     {ClusterPhaseDeleting, ClusterPhaseDeleted},
+	ClusterPhaseDeleting:   {ClusterPhaseDeleted},
+}
 
+// CanTransitionTo tells whether a cluster in phase p may move to phase to.
+// Staying in the same phase is always allowed.
+func (p ClusterPhase) CanTransitionTo(to ClusterPhase) bool {
+	if p == to {
+		return true
+	}
+	for _, next := range clusterPhaseTransitions[p] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+const (
 	// See ./doc/user/conditions_and_events.md
-	ClusterConditionAvailable  ClusterConditionType = "Available"
-	ClusterConditionRecovering                      = "Recovering"
-	ClusterConditionScaling                         = "Scaling"
-	ClusterConditionUpgrading                       = "Upgrading"
+	ClusterConditionAvailable            ClusterConditionType = "Available"
+	ClusterConditionRecovering                                = "Recovering"
+	ClusterConditionScaling                                   = "Scaling"
+	ClusterConditionUpgrading                                 = "Upgrading"
+	ClusterConditionDegraded                                  = "Degraded"
+	ClusterConditionRepairPaused                              = "RepairPaused"
+	ClusterConditionThresholdExceeded                         = "ThresholdExceeded"
+	ClusterConditionMemberFailed                              = "MemberFailed"
+	ClusterConditionPodCreationFailed                         = "PodCreationFailed"
+	ClusterConditionInterventionRequired                      = "InterventionRequired"
+	ClusterConditionBlocked                                   = "Blocked"
+	ClusterConditionStorageMigrating                          = "StorageMigrating"
+	ClusterConditionHandsOff                                  = "HandsOff"
+)
+
+// The reasons of the Degraded condition.
+const (
+	// DegradedReasonMixedVersions is the reason of a cluster whose members run other versions than spec.version
+	// outside of an upgrade.
+	DegradedReasonMixedVersions = "Mixed versions"
+)
+
+// The reasons of the InterventionRequired condition, for tools acting on it.
+const (
+	// InterventionReasonQuorumLost is the reason of a cluster that lost quorum and is neither restored
+	// from a backup nor recreated empty by its self healing policy.
+	InterventionReasonQuorumLost = "QuorumLost"
+	// InterventionReasonDataCorruption is the reason of a cluster whose members with corrupted data
+	// leave too few healthy members to replace them from.
+	InterventionReasonDataCorruption = "DataCorruption"
+	// InterventionReasonClusterIDMismatch is the reason of a cluster whose members answer with another etcd
+	// cluster ID than the one recorded in status.clusterID, e.g. pods pointed at the peers of another cluster.
+	InterventionReasonClusterIDMismatch = "ClusterIDMismatch"
 )
 
+// SchemaVersion is the version of the EtcdCluster resource the operator knows. It is incremented with each release
+// that adds fields to the resource: an operator of an older schema version refuses to manage the clusters an operator
+// of a newer one managed, as it would drop the fields it does not know when it updates them.
+const SchemaVersion = 1
+
 type ClusterStatus struct {
 	// Phase is the cluster running phase
 	Phase  ClusterPhase `json:"phase"`
 	Reason string       `json:"reason,omitempty"`
 
+	// ObservedGeneration is the metadata.generation of the EtcdCluster the operator last reconciled.
+	// The operator has not acted on the latest spec yet while it is lower than metadata.generation.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// OperatorVersion is the version of the etcd operator that manages the cluster,
+	// e.g. to tell which clusters an operator of a new version took over during its rollout.
+	OperatorVersion string `json:"operatorVersion,omitempty"`
+	// SchemaVersion is the SchemaVersion of the etcd operator that last managed the cluster.
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+
 	// ControlPuased indicates the operator pauses the control of the cluster.
 	ControlPaused bool `json:"controlPaused,omitempty"`
 
@@ -65,6 +146,180 @@ type ClusterStatus struct {
 	// TargetVersion is the version the cluster upgrading to.
 	// If the cluster is not upgrading, TargetVersion is empty.
 	TargetVersion string `json:"targetVersion"`
+
+	// ReadyMembers is the number of members ready to serve requests.
+	ReadyMembers int `json:"readyMembers"`
+
+	// Ready tells whether a quorum of the members is ready and the cluster
+	// serves linearizable reads, as of the last health check.
+	Ready bool `json:"ready"`
+
+	// Leader is the name of the member that was the raft leader at the last health check.
+	// It is kept while the cluster has no leader.
+	Leader string `json:"leader,omitempty"`
+	// LeaderChanges is the number of leader changes the operator has seen.
+	// Leader elections between two health checks may go unnoticed.
+	LeaderChanges int64 `json:"leaderChanges,omitempty"`
+
+	// LastBackupTime is the creation time, in RFC3339, of the most recent successful
+	// EtcdBackup of the cluster's client service.
+	LastBackupTime string `json:"lastBackupTime,omitempty"`
+
+	// CompactedRevision is the revision the operator last compacted the cluster to.
+	// It is only set if spec.compaction is set.
+	CompactedRevision int64 `json:"compactedRevision,omitempty"`
+
+	// Resources is the compute and storage the members request and use.
+	Resources *ResourceUsage `json:"resources,omitempty"`
+
+	// ReconcileFailures is the number of consecutive failed reconciliations.
+	// The operator waits longer between reconciliations the more of them fail.
+	ReconcileFailures int `json:"reconcileFailures,omitempty"`
+	// LastReconcileError is the error of the last reconciliation, if it failed.
+	LastReconcileError string `json:"lastReconcileError,omitempty"`
+
+	// Failure is the state of the cluster when the operator gave up on it. It is only set in the Failed phase.
+	Failure *FailureReport `json:"failure,omitempty"`
+
+	// CARotation is the progress of the last rotation of the CA of a TLS cluster, if any.
+	CARotation *CARotationStatus `json:"caRotation,omitempty"`
+
+	// MemberGeneration is the generation of the last member created for the cluster.
+	// Members are numbered from 1 in the order they are created; each pod is annotated with its generation.
+	MemberGeneration int64 `json:"memberGeneration,omitempty"`
+	// MemberCreations is the number of members created for the cluster, by the reason they were created for.
+	MemberCreations map[MemberCreationReason]int64 `json:"memberCreations,omitempty"`
+
+	// QuorumLostTime is the time, in RFC3339, the cluster was first found without quorum.
+	// It is cleared once the cluster has quorum again.
+	QuorumLostTime string `json:"quorumLostTime,omitempty"`
+
+	// BootstrapStartTime is the time, in RFC3339, the seed member of the cluster was created.
+	// It is only set until a quorum of spec.size members is first ready.
+	BootstrapStartTime string `json:"bootstrapStartTime,omitempty"`
+	// BootstrapRetries is the number of times the cluster was created anew after its bootstrap timed out.
+	BootstrapRetries int `json:"bootstrapRetries,omitempty"`
+	// ClusterID is the ID, in hex, of the etcd cluster, as first reported by its members after its bootstrap.
+	// It is reset when the etcd cluster is created anew.
+	ClusterID string `json:"clusterID,omitempty"`
+
+	// Standby is the backup a standby cluster was last restored from. It is only set if spec.standbyOf is set.
+	Standby *StandbyStatus `json:"standby,omitempty"`
+
+	// TearDown is the progress of the deletion policy of a deleted cluster, until it is applied.
+	TearDown *TearDownStatus `json:"tearDown,omitempty"`
+}
+
+// FailureReport is the state of a cluster when the operator gave up on it and marked it Failed.
+// status.reason is why.
+type FailureReport struct {
+	// Time is the time, in RFC3339, the cluster failed.
+	Time string `json:"time"`
+	// Phase is the phase the cluster was in when it failed.
+	Phase ClusterPhase `json:"phase,omitempty"`
+	// Actions are the last actions of the operator on the cluster, oldest first.
+	Actions []ClusterAction `json:"actions,omitempty"`
+	// Members are the members of the cluster as of the last reconciliation.
+	Members []MemberState `json:"members,omitempty"`
+}
+
+// ClusterAction is an action of the operator on a cluster.
+type ClusterAction struct {
+	// Time is the time, in RFC3339, the action was taken.
+	Time string `json:"time"`
+	// Action is what the operator did, e.g. "RemoveDeadMember example-0002: member has no running pod".
+	Action string `json:"action"`
+	// Error is why the action failed, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// The states of a member in a FailureReport.
+const (
+	MemberStateReady   = "Ready"
+	MemberStateUnready = "Unready"
+	MemberStateLeaving = "Leaving"
+	// MemberStateNoPod is the state of a member without a running pod.
+	MemberStateNoPod = "NoPod"
+)
+
+// MemberState is the state of a member of a cluster.
+type MemberState struct {
+	Name string `json:"name"`
+	// State is one of the MemberState constants.
+	State string `json:"state"`
+}
+
+// TearDownStatus is the progress of the deletion policy of a deleted cluster.
+// The objects it applies to are the persistent volume claims and secrets it retains, the TLS secrets
+// and the EtcdBackups it deletes.
+type TearDownStatus struct {
+	// Completed is the number of objects the deletion policy is applied to, out of Total.
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+	// LastError is why the policy could not be applied to some of the objects at the last attempt, if it could not.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// StandbyStatus is the backup of its primary cluster a standby cluster was last restored from.
+type StandbyStatus struct {
+	// RestoredBackup is the name of the EtcdBackup of the primary the standby was last restored from.
+	RestoredBackup string `json:"restoredBackup,omitempty"`
+	// RestoredBackupTime is the time, in RFC3339, the snapshot the standby was last restored from was saved.
+	// The writes to the primary since then are missing on the standby.
+	RestoredBackupTime string `json:"restoredBackupTime,omitempty"`
+	// RestoreFailure is the reason the last restore of the standby failed, if it did.
+	// The restore is retried 5 minutes after it was requested.
+	RestoreFailure string `json:"restoreFailure,omitempty"`
+}
+
+// MemberCreationReason is the reason a member was created for.
+type MemberCreationReason string
+
+const (
+	// MemberCreationInitial is the seed member of a new cluster, or of a cluster recreated empty.
+	MemberCreationInitial MemberCreationReason = "Initial"
+	// MemberCreationScaleUp is a member added to grow the cluster to its size, e.g. from its seed member.
+	MemberCreationScaleUp MemberCreationReason = "ScaleUp"
+	// MemberCreationReplacement is a member added in place of a dead, upgraded or otherwise replaced member.
+	MemberCreationReplacement MemberCreationReason = "Replacement"
+	// MemberCreationRestore is the seed member of a cluster restored from a backup.
+	MemberCreationRestore MemberCreationReason = "Restore"
+)
+
+type CARotationPhase string
+
+// See ./doc/user/cluster_tls.md#rotating-the-ca for the phases of a CA rotation.
+const (
+	CARotationTrustNewCA      CARotationPhase = "TrustNewCA"
+	CARotationRollMemberCerts CARotationPhase = "RollMemberCerts"
+	CARotationDropOldCA       CARotationPhase = "DropOldCA"
+	CARotationCompleted       CARotationPhase = "Completed"
+)
+
+// CARotationStatus is the progress of the rotation of the CA of a TLS cluster.
+type CARotationStatus struct {
+	// Phase is the step the rotation is at.
+	Phase CARotationPhase `json:"phase"`
+	// StartTime is the time, in RFC3339, the rotation started.
+	StartTime string `json:"startTime,omitempty"`
+	// PhaseStartTime is the time, in RFC3339, the rotation entered Phase.
+	// The members whose pods were created before it are rolled during the phase.
+	PhaseStartTime string `json:"phaseStartTime,omitempty"`
+	// DualTrustPeriodInSecond is the time, from the start of the rotation, both the old and the new CA are trusted
+	// before the members get certificates of the new CA, for clients to trust it and get certificates of it.
+	DualTrustPeriodInSecond int64 `json:"dualTrustPeriodInSecond,omitempty"`
+}
+
+// ResourceUsage sums the cpu, memory and storage resources of the members of a cluster.
+type ResourceUsage struct {
+	// Requested is the sum of the resource requests of the member pods
+	// and of the storage requested by their persistent volume claims.
+	Requested v1.ResourceList `json:"requested,omitempty"`
+	// Used is the sum of the cpu and memory used by the member pods, as reported by the
+	// resource metrics API if it is available, and of the sizes of the etcd databases as storage.
+	Used v1.ResourceList `json:"used,omitempty"`
+	// UpdateTime is the time, in RFC3339, the usage was last collected.
+	UpdateTime string `json:"updateTime,omitempty"`
 }
 
 // ClusterCondition represents one current condition of an etcd cluster.
@@ -93,6 +348,29 @@ type MembersStatus struct {
 	Ready []string `json:"ready,omitempty"`
 	// Unready are the etcd members not ready to serve requests
 	Unready []string `json:"unready,omitempty"`
+	// Leaving are the etcd members whose pods are being deleted. They are replaced without waiting for the pods to be gone.
+	Leaving []string `json:"leaving,omitempty"`
+	// Details is the status of each member, in name order, as last refreshed by the health probes of the operator.
+	Details []MemberDetail `json:"details,omitempty"`
+}
+
+// MemberDetail is the status of a member, as `etcdctl endpoint status` reports it.
+type MemberDetail struct {
+	Name string `json:"name"`
+	// ID is the etcd ID of the member, in hex.
+	ID string `json:"id,omitempty"`
+	// Version is the etcd version the member runs.
+	Version string `json:"version,omitempty"`
+	// DBSize is the size, in bytes, of the backend database of the member.
+	DBSize int64 `json:"dbSize,omitempty"`
+	// IsLeader tells whether the member is the leader.
+	IsLeader bool `json:"isLeader,omitempty"`
+	// Healthy tells whether the member answered its status request.
+	Healthy bool `json:"healthy"`
+	// Node is the node the pod of the member runs on.
+	Node string `json:"node,omitempty"`
+	// Error is why the member is unhealthy, if it is.
+	Error string `json:"error,omitempty"`
 }
 
 func (cs *ClusterStatus) IsFailed() bool {
@@ -106,6 +384,15 @@ func (cs *ClusterStatus) SetPhase(p ClusterPhase) {
 	cs.Phase = p
 }
 
+// TransitionTo moves the cluster to phase p if the transition is legal.
+func (cs *ClusterStatus) TransitionTo(p ClusterPhase) error {
+	if !cs.Phase.CanTransitionTo(p) {
+		return fmt.Errorf("illegal cluster phase transition from %q to %q", cs.Phase, p)
+	}
+	cs.Phase = p
+	return nil
+}
+
 func (cs *ClusterStatus) PauseControl() {
 	cs.ControlPaused = true
 }
@@ -152,6 +439,77 @@ func (cs *ClusterStatus) SetUpgradingCondition(to string) {
 	cs.setClusterCondition(*c)
 }
 
+func (cs *ClusterStatus) SetUpgradeRefusedCondition(to, message string) {
+	c := newClusterCondition(ClusterConditionUpgrading, v1.ConditionFalse,
+		"Upgrade preflight failed", "not upgrading to "+to+": "+message)
+	cs.setClusterCondition(*c)
+}
+
+// SetStorageMigratingCondition tells that migrated of the total members are on claims of the storage class,
+// and that the next one is being moved.
+func (cs *ClusterStatus) SetStorageMigratingCondition(class string, migrated, total int) {
+	c := newClusterCondition(ClusterConditionStorageMigrating, v1.ConditionTrue, "Migrating storage",
+		fmt.Sprintf("%d of %d members moved to storage class %q", migrated, total, class))
+	cs.setClusterCondition(*c)
+}
+
+// SetStorageMigrationWaitingCondition tells that the next member is not moved to the storage class yet, and why.
+func (cs *ClusterStatus) SetStorageMigrationWaitingCondition(class, message string) {
+	c := newClusterCondition(ClusterConditionStorageMigrating, v1.ConditionFalse, "Storage migration waiting",
+		fmt.Sprintf("not moving the next member to storage class %q yet: %s", class, message))
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetDegradedCondition(reason, message string) {
+	c := newClusterCondition(ClusterConditionDegraded, v1.ConditionTrue, reason, message)
+	cs.setClusterCondition(*c)
+}
+
+// ClearDegradedCondition clears the Degraded condition if it is set for the given reason.
+func (cs *ClusterStatus) ClearDegradedCondition(reason string) {
+	if _, c := getClusterCondition(cs, ClusterConditionDegraded); c != nil && c.Reason == reason {
+		cs.ClearCondition(ClusterConditionDegraded)
+	}
+}
+
+func (cs *ClusterStatus) SetHandsOffCondition(message string) {
+	c := newClusterCondition(ClusterConditionHandsOff, v1.ConditionTrue, "Members hands-off", message)
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetRepairPausedCondition(message string) {
+	c := newClusterCondition(ClusterConditionRepairPaused, v1.ConditionTrue, "Repair budget exceeded", message)
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetThresholdExceededCondition(message string) {
+	c := newClusterCondition(ClusterConditionThresholdExceeded, v1.ConditionTrue, "Alert thresholds exceeded", message)
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetMemberFailedCondition(message string) {
+	c := newClusterCondition(ClusterConditionMemberFailed, v1.ConditionTrue, "Member failed", message)
+	cs.setClusterCondition(*c)
+}
+
+func (cs *ClusterStatus) SetPodCreationFailedCondition(message string) {
+	c := newClusterCondition(ClusterConditionPodCreationFailed, v1.ConditionTrue, "Pod creation failed", message)
+	cs.setClusterCondition(*c)
+}
+
+// SetInterventionRequiredCondition tells that the operator stopped acting on the cluster until a human repairs it.
+// The reason is one of the InterventionReason constants.
+func (cs *ClusterStatus) SetInterventionRequiredCondition(reason, message string) {
+	c := newClusterCondition(ClusterConditionInterventionRequired, v1.ConditionTrue, reason, message)
+	cs.setClusterCondition(*c)
+}
+
+// SetBlockedCondition tells that the creation of the cluster waits for the clusters of its spec.dependsOn.
+func (cs *ClusterStatus) SetBlockedCondition(message string) {
+	c := newClusterCondition(ClusterConditionBlocked, v1.ConditionTrue, "Dependencies not ready", message)
+	cs.setClusterCondition(*c)
+}
+
 func (cs *ClusterStatus) SetReadyCondition() {
 	c := newClusterCondition(ClusterConditionAvailable, v1.ConditionTrue, "Cluster available", "")
 	cs.setClusterCondition(*c)
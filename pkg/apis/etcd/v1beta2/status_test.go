@@ -0,0 +1,73 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta2
+
+import "testing"
+
+func TestClusterPhaseCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to ClusterPhase
+		want     bool
+	}{
+		{from: ClusterPhaseNone, to: ClusterPhasePending, want: true},
+		{from: ClusterPhasePending, to: ClusterPhaseCreating, want: true},
+		{from: ClusterPhaseCreating, to: ClusterPhaseRunning, want: true},
+		{from: ClusterPhaseRunning, to: ClusterPhaseResizing, want: true},
+		{from: ClusterPhaseUpgrading, to: ClusterPhaseRecovering, want: true},
+		{from: ClusterPhaseRecovering, to: ClusterPhaseRunning, want: true},
+		{from: ClusterPhaseRunning, to: ClusterPhaseRunning, want: true},
+		{from: ClusterPhaseRunning, to: ClusterPhaseDeleting, want: true},
+		{from: ClusterPhaseDeleting, to: ClusterPhaseDeleted, want: true},
+		{from: ClusterPhaseFailed, to: ClusterPhaseRunning, want: false},
+		{from: ClusterPhaseRunning, to: ClusterPhaseCreating, want: false},
+		{from: ClusterPhaseDeleting, to: ClusterPhaseRunning, want: false},
+		{from: ClusterPhaseDeleted, to: ClusterPhaseRunning, want: false},
+		{from: ClusterPhaseNone, to: ClusterPhaseResizing, want: false},
+	}
+	for i, tt := range tests {
+		if get := tt.from.CanTransitionTo(tt.to); get != tt.want {
+			t.Errorf("#%d: %q.CanTransitionTo(%q)=%v, want=%v", i, tt.from, tt.to, get, tt.want)
+		}
+	}
+}
+
+func TestClusterStatusTransitionTo(t *testing.T) {
+	cs := &ClusterStatus{Phase: ClusterPhaseFailed}
+	if err := cs.TransitionTo(ClusterPhaseRunning); err == nil {
+		t.Fatal("expect error moving a failed cluster to running")
+	}
+	if cs.Phase != ClusterPhaseFailed {
+		t.Errorf("expect phase=%q, get=%q", ClusterPhaseFailed, cs.Phase)
+	}
+	if err := cs.TransitionTo(ClusterPhaseDeleting); err != nil {
+		t.Fatal(err)
+	}
+	if cs.Phase != ClusterPhaseDeleting {
+		t.Errorf("expect phase=%q, get=%q", ClusterPhaseDeleting, cs.Phase)
+	}
+}
+
+func TestBackupStatusFailedCondition(t *testing.T) {
+	bs := &BackupStatus{}
+	bs.SetFailedCondition(BackupFailedReasonError, "connection refused")
+	bs.SetFailedCondition(BackupFailedReasonDiskFull, "no space left on device")
+	if len(bs.Conditions) != 1 || bs.Conditions[0].Reason != BackupFailedReasonDiskFull || len(bs.Conditions[0].LastTransitionTime) == 0 {
+		t.Fatalf("expect one BackupFailed condition of reason %s, get %v", BackupFailedReasonDiskFull, bs.Conditions)
+	}
+	bs.ClearFailedCondition()
+	if len(bs.Conditions) != 0 {
+		t.Errorf("expect no condition, get %v", bs.Conditions)
+	}
+}
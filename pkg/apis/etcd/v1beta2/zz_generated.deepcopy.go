@@ -57,6 +57,54 @@ func (in *ABSRestoreSource) DeepCopy() *ABSRestoreSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlertPolicy) DeepCopyInto(out *AlertPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlertPolicy.
+func (in *AlertPolicy) DeepCopy() *AlertPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AlertPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthPolicy) DeepCopyInto(out *AuthPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthPolicy.
+func (in *AuthPolicy) DeepCopy() *AuthPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupCondition) DeepCopyInto(out *BackupCondition) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupCondition.
+func (in *BackupCondition) DeepCopy() *BackupCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupPolicy) DeepCopyInto(out *BackupPolicy) {
 	*out = *in
@@ -73,6 +121,23 @@ func (in *BackupPolicy) DeepCopy() *BackupPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupPolicyStatus) DeepCopyInto(out *BackupPolicyStatus) {
+	*out = *in
+	in.LastSuccessDate.DeepCopyInto(&out.LastSuccessDate)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupPolicyStatus.
+func (in *BackupPolicyStatus) DeepCopy() *BackupPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupSource) DeepCopyInto(out *BackupSource) {
 	*out = *in
@@ -94,6 +159,15 @@ func (in *BackupSource) DeepCopyInto(out *BackupSource) {
 			**out = **in
 		}
 	}
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(CustomBackupSource)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -125,6 +199,13 @@ func (in *BackupSpec) DeepCopyInto(out *BackupSpec) {
 		}
 	}
 	in.BackupSource.DeepCopyInto(&out.BackupSource)
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]NamedBackupPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -141,6 +222,28 @@ func (in *BackupSpec) DeepCopy() *BackupSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupStatus) DeepCopyInto(out *BackupStatus) {
 	*out = *in
+	in.LastSuccessDate.DeepCopyInto(&out.LastSuccessDate)
+	if in.LastRestoreDrill != nil {
+		in, out := &in.LastRestoreDrill, &out.LastRestoreDrill
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(RestoreDrillResult)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]BackupPolicyStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]BackupCondition, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -154,6 +257,54 @@ func (in *BackupStatus) DeepCopy() *BackupStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BootstrapPolicy) DeepCopyInto(out *BootstrapPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BootstrapPolicy.
+func (in *BootstrapPolicy) DeepCopy() *BootstrapPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BootstrapPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CARotationStatus) DeepCopyInto(out *CARotationStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CARotationStatus.
+func (in *CARotationStatus) DeepCopy() *CARotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CARotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAction) DeepCopyInto(out *ClusterAction) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAction.
+func (in *ClusterAction) DeepCopy() *ClusterAction {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAction)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterCondition) DeepCopyInto(out *ClusterCondition) {
 	*out = *in
@@ -173,6 +324,15 @@ func (in *ClusterCondition) DeepCopy() *ClusterCondition {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 	*out = *in
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(UpgradePolicy)
+			**out = **in
+		}
+	}
 	if in.Pod != nil {
 		in, out := &in.Pod, &out.Pod
 		if *in == nil {
@@ -182,6 +342,15 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.Sidecars != nil {
+		in, out := &in.Sidecars, &out.Sidecars
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SidecarsPolicy)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	if in.TLS != nil {
 		in, out := &in.TLS, &out.TLS
 		if *in == nil {
@@ -191,6 +360,115 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(AuthPolicy)
+			**out = **in
+		}
+	}
+	if in.Etcd != nil {
+		in, out := &in.Etcd, &out.Etcd
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(EtcdPolicy)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.Compaction != nil {
+		in, out := &in.Compaction, &out.Compaction
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(CompactionPolicy)
+			**out = **in
+		}
+	}
+	if in.Defragmentation != nil {
+		in, out := &in.Defragmentation, &out.Defragmentation
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(DefragmentationPolicy)
+			**out = **in
+		}
+	}
+	if in.RepairBudget != nil {
+		in, out := &in.RepairBudget, &out.RepairBudget
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(RepairBudgetPolicy)
+			**out = **in
+		}
+	}
+	if in.PropagatedLabels != nil {
+		in, out := &in.PropagatedLabels, &out.PropagatedLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SelfHealing != nil {
+		in, out := &in.SelfHealing, &out.SelfHealing
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SelfHealingPolicy)
+			**out = **in
+		}
+	}
+	if in.Alerts != nil {
+		in, out := &in.Alerts, &out.Alerts
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(AlertPolicy)
+			**out = **in
+		}
+	}
+	if in.DiskPreflight != nil {
+		in, out := &in.DiskPreflight, &out.DiskPreflight
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(DiskPreflightPolicy)
+			**out = **in
+		}
+	}
+	if in.Bootstrap != nil {
+		in, out := &in.Bootstrap, &out.Bootstrap
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(BootstrapPolicy)
+			**out = **in
+		}
+	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(DeletionPolicy)
+			**out = **in
+		}
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(TimeoutPolicy)
+			**out = **in
+		}
+	}
 	return
 }
 
@@ -213,6 +491,58 @@ func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 		copy(*out, *in)
 	}
 	in.Members.DeepCopyInto(&out.Members)
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ResourceUsage)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.CARotation != nil {
+		in, out := &in.CARotation, &out.CARotation
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(CARotationStatus)
+			**out = **in
+		}
+	}
+	if in.MemberCreations != nil {
+		in, out := &in.MemberCreations, &out.MemberCreations
+		*out = make(map[MemberCreationReason]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Standby != nil {
+		in, out := &in.Standby, &out.Standby
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(StandbyStatus)
+			**out = **in
+		}
+	}
+	if in.Failure != nil {
+		in, out := &in.Failure, &out.Failure
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(FailureReport)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.TearDown != nil {
+		in, out := &in.TearDown, &out.TearDown
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(TearDownStatus)
+			**out = **in
+		}
+	}
 	return
 }
 
@@ -226,13 +556,100 @@ func (in *ClusterStatus) DeepCopy() *ClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompactionPolicy) DeepCopyInto(out *CompactionPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompactionPolicy.
+func (in *CompactionPolicy) DeepCopy() *CompactionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CompactionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CustomBackupSource) DeepCopyInto(out *CustomBackupSource) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomBackupSource.
+func (in *CustomBackupSource) DeepCopy() *CustomBackupSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CustomBackupSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DefragmentationPolicy) DeepCopyInto(out *DefragmentationPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DefragmentationPolicy.
+func (in *DefragmentationPolicy) DeepCopy() *DefragmentationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DefragmentationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeletionPolicy) DeepCopyInto(out *DeletionPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeletionPolicy.
+func (in *DeletionPolicy) DeepCopy() *DeletionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DeletionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskPreflightPolicy) DeepCopyInto(out *DiskPreflightPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskPreflightPolicy.
+func (in *DiskPreflightPolicy) DeepCopy() *DiskPreflightPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskPreflightPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EtcdBackup) DeepCopyInto(out *EtcdBackup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -349,17 +766,45 @@ func (in *EtcdClusterList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *EtcdClusterRef) DeepCopyInto(out *EtcdClusterRef) {
+func (in *EtcdClusterRef) DeepCopyInto(out *EtcdClusterRef) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdClusterRef.
+func (in *EtcdClusterRef) DeepCopy() *EtcdClusterRef {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdClusterRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdPolicy) DeepCopyInto(out *EtcdPolicy) {
 	*out = *in
+	if in.LogOutputs != nil {
+		in, out := &in.LogOutputs, &out.LogOutputs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Experimental != nil {
+		in, out := &in.Experimental, &out.Experimental
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdClusterRef.
-func (in *EtcdClusterRef) DeepCopy() *EtcdClusterRef {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdPolicy.
+func (in *EtcdPolicy) DeepCopy() *EtcdPolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(EtcdClusterRef)
+	out := new(EtcdPolicy)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -425,6 +870,48 @@ func (in *EtcdRestoreList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureReport) DeepCopyInto(out *FailureReport) {
+	*out = *in
+	if in.Actions != nil {
+		in, out := &in.Actions, &out.Actions
+		*out = make([]ClusterAction, len(*in))
+		copy(*out, *in)
+	}
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]MemberState, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureReport.
+func (in *FailureReport) DeepCopy() *FailureReport {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemberDetail) DeepCopyInto(out *MemberDetail) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemberDetail.
+func (in *MemberDetail) DeepCopy() *MemberDetail {
+	if in == nil {
+		return nil
+	}
+	out := new(MemberDetail)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MemberSecret) DeepCopyInto(out *MemberSecret) {
 	*out = *in
@@ -441,6 +928,22 @@ func (in *MemberSecret) DeepCopy() *MemberSecret {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemberState) DeepCopyInto(out *MemberState) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemberState.
+func (in *MemberState) DeepCopy() *MemberState {
+	if in == nil {
+		return nil
+	}
+	out := new(MemberState)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MembersStatus) DeepCopyInto(out *MembersStatus) {
 	*out = *in
@@ -454,6 +957,16 @@ func (in *MembersStatus) DeepCopyInto(out *MembersStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Leaving != nil {
+		in, out := &in.Leaving, &out.Leaving
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Details != nil {
+		in, out := &in.Details, &out.Details
+		*out = make([]MemberDetail, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -467,6 +980,32 @@ func (in *MembersStatus) DeepCopy() *MembersStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamedBackupPolicy) DeepCopyInto(out *NamedBackupPolicy) {
+	*out = *in
+	if in.BackupPolicy != nil {
+		in, out := &in.BackupPolicy, &out.BackupPolicy
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(BackupPolicy)
+			**out = **in
+		}
+	}
+	in.BackupSource.DeepCopyInto(&out.BackupSource)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamedBackupPolicy.
+func (in *NamedBackupPolicy) DeepCopy() *NamedBackupPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NamedBackupPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 	*out = *in
@@ -501,6 +1040,31 @@ func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.HostAliases != nil {
+		in, out := &in.HostAliases, &out.HostAliases
+		*out = make([]v1.HostAlias, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
+	if in.ForceDeleteAfterSeconds != nil {
+		in, out := &in.ForceDeleteAfterSeconds, &out.ForceDeleteAfterSeconds
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(int64)
+			**out = **in
+		}
+	}
 	if in.EtcdEnv != nil {
 		in, out := &in.EtcdEnv, &out.EtcdEnv
 		*out = make([]v1.EnvVar, len(*in))
@@ -517,6 +1081,15 @@ func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.WALVolumeClaimSpec != nil {
+		in, out := &in.WALVolumeClaimSpec, &out.WALVolumeClaimSpec
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.PersistentVolumeClaimSpec)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	if in.Annotations != nil {
 		in, out := &in.Annotations, &out.Annotations
 		*out = make(map[string]string, len(*in))
@@ -533,6 +1106,15 @@ func (in *PodPolicy) DeepCopyInto(out *PodPolicy) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.OverridePatch != nil {
+		in, out := &in.OverridePatch, &out.OverridePatch
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(runtime.RawExtension)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -546,6 +1128,69 @@ func (in *PodPolicy) DeepCopy() *PodPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RepairBudgetPolicy) DeepCopyInto(out *RepairBudgetPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepairBudgetPolicy.
+func (in *RepairBudgetPolicy) DeepCopy() *RepairBudgetPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RepairBudgetPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceUsage) DeepCopyInto(out *ResourceUsage) {
+	*out = *in
+	if in.Requested != nil {
+		in, out := &in.Requested, &out.Requested
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Used != nil {
+		in, out := &in.Used, &out.Used
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceUsage.
+func (in *ResourceUsage) DeepCopy() *ResourceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RestoreDrillResult) DeepCopyInto(out *RestoreDrillResult) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RestoreDrillResult.
+func (in *RestoreDrillResult) DeepCopy() *RestoreDrillResult {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreDrillResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RestoreSource) DeepCopyInto(out *RestoreSource) {
 	*out = *in
@@ -567,6 +1212,15 @@ func (in *RestoreSource) DeepCopyInto(out *RestoreSource) {
 			**out = **in
 		}
 	}
+	if in.Custom != nil {
+		in, out := &in.Custom, &out.Custom
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(CustomBackupSource)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -646,6 +1300,89 @@ func (in *S3RestoreSource) DeepCopy() *S3RestoreSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SelfHealingPolicy) DeepCopyInto(out *SelfHealingPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelfHealingPolicy.
+func (in *SelfHealingPolicy) DeepCopy() *SelfHealingPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SelfHealingPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarSpec) DeepCopyInto(out *SidecarSpec) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarSpec.
+func (in *SidecarSpec) DeepCopy() *SidecarSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarsPolicy) DeepCopyInto(out *SidecarsPolicy) {
+	*out = *in
+	if in.Exporter != nil {
+		in, out := &in.Exporter, &out.Exporter
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SidecarSpec)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.TLSReloader != nil {
+		in, out := &in.TLSReloader, &out.TLSReloader
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SidecarSpec)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarsPolicy.
+func (in *SidecarsPolicy) DeepCopy() *SidecarsPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarsPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StandbyStatus) DeepCopyInto(out *StandbyStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StandbyStatus.
+func (in *StandbyStatus) DeepCopy() *StandbyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StandbyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StaticTLS) DeepCopyInto(out *StaticTLS) {
 	*out = *in
@@ -695,3 +1432,51 @@ func (in *TLSPolicy) DeepCopy() *TLSPolicy {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TearDownStatus) DeepCopyInto(out *TearDownStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TearDownStatus.
+func (in *TearDownStatus) DeepCopy() *TearDownStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TearDownStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeoutPolicy) DeepCopyInto(out *TimeoutPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeoutPolicy.
+func (in *TimeoutPolicy) DeepCopy() *TimeoutPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeoutPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpgradePolicy) DeepCopyInto(out *UpgradePolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpgradePolicy.
+func (in *UpgradePolicy) DeepCopy() *UpgradePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(UpgradePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
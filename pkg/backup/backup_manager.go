@@ -18,15 +18,25 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/backup/writer"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 
 	"github.com/coreos/etcd/clientv3"
 	"github.com/sirupsen/logrus"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	periodicBackupSep        = "_v"
+	periodicBackupTimeFormat = "2006-01-02-15:04:05"
+)
+
 // BackupManager backups an etcd cluster.
 type BackupManager struct {
 	kubecli kubernetes.Interface
@@ -49,43 +59,162 @@ func NewBackupManagerFromWriter(kubecli kubernetes.Interface, bw writer.Writer,
 	}
 }
 
-// SaveSnap uses backup writer to save etcd snapshot to a specified S3 path
-// and returns backup etcd server's kv store revision and its version.
-func (bm *BackupManager) SaveSnap(ctx context.Context, s3Path string) (int64, string, error) {
+// Snapshot describes a snapshot saved by SaveSnap.
+type Snapshot struct {
+	// Revision is the kv store revision of the backup etcd server.
+	Revision int64
+	// EtcdVersion is the version of the backup etcd server.
+	EtcdVersion string
+	// Path is the path the snapshot was saved at.
+	Path string
+	// Size is the size of the snapshot in bytes.
+	Size int64
+}
+
+// SaveSnap uses backup writer to save etcd snapshot to a specified S3 path.
+// A periodic snapshot is saved at the path followed by "_v<revision>_<time>".
+func (bm *BackupManager) SaveSnap(ctx context.Context, s3Path string, isPeriodic bool) (*Snapshot, error) {
+	now := time.Now().UTC()
 	etcdcli, rev, err := bm.etcdClientWithMaxRevision(ctx)
 	if err != nil {
-		return 0, "", fmt.Errorf("create etcd client failed: %v", err)
+		return nil, fmt.Errorf("create etcd client failed: %v", err)
 	}
 	defer etcdcli.Close()
 
 	resp, err := etcdcli.Status(ctx, etcdcli.Endpoints()[0])
 	if err != nil {
-		return 0, "", fmt.Errorf("failed to retrieve etcd version from the status call: %v", err)
+		return nil, fmt.Errorf("failed to retrieve etcd version from the status call: %v", err)
 	}
 
 	rc, err := etcdcli.Snapshot(ctx)
 	if err != nil {
-		return 0, "", fmt.Errorf("failed to receive snapshot (%v)", err)
+		return nil, fmt.Errorf("failed to receive snapshot (%v)", err)
 	}
 	defer rc.Close()
 
-	_, err = bm.bw.Write(ctx, s3Path, rc)
+	if isPeriodic {
+		s3Path = periodicBackupPath(s3Path, rev, now)
+	}
+	size, err := bm.bw.Write(ctx, s3Path, rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write snapshot (%v)", err)
+	}
+	return &Snapshot{Revision: rev, EtcdVersion: resp.Version, Path: s3Path, Size: size}, nil
+}
+
+// EnsureMaxBackups deletes the oldest snapshots of the periodic backup at basePath, keeping the newest maxCount.
+func (bm *BackupManager) EnsureMaxBackups(ctx context.Context, basePath string, maxCount int) error {
+	paths, err := bm.bw.List(ctx, basePath+periodicBackupSep)
 	if err != nil {
-		return 0, "", fmt.Errorf("failed to write snapshot (%v)", err)
+		return fmt.Errorf("failed to list snapshots: %v", err)
 	}
-	return rev, resp.Version, nil
+	for _, p := range backupsToPrune(basePath, paths, maxCount) {
+		if err := bm.bw.Delete(ctx, p); err != nil {
+			return fmt.Errorf("failed to delete snapshot (%s): %v", p, err)
+		}
+		logrus.Infof("deleted snapshot (%s): more than %d snapshots are kept", p, maxCount)
+	}
+	return nil
+}
+
+// DeleteSnapshots deletes the snapshots of the backup at basePath: the snapshot at basePath and, if the backup is periodic,
+// its snapshots after it. The snapshots of other backups next to it, e.g. "<basePath>.pre-upgrade-3.2.13", are kept.
+func (bm *BackupManager) DeleteSnapshots(ctx context.Context, basePath string) error {
+	paths, err := bm.bw.List(ctx, basePath)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %v", err)
+	}
+	for _, p := range snapshotsOf(basePath, paths) {
+		if err := bm.bw.Delete(ctx, p); err != nil {
+			return fmt.Errorf("failed to delete snapshot (%s): %v", p, err)
+		}
+		logrus.Infof("deleted snapshot (%s)", p)
+	}
+	return nil
+}
+
+// snapshotsOf returns the paths of the snapshots of the backup at basePath among paths.
+func snapshotsOf(basePath string, paths []string) []string {
+	var snaps []string
+	for _, p := range paths {
+		if p == basePath || strings.HasPrefix(p, basePath+periodicBackupSep) {
+			snaps = append(snaps, p)
+		}
+	}
+	return snaps
+}
+
+// periodicBackupPath returns the path the periodic snapshot at revision rev, taken at time t, is saved at.
+func periodicBackupPath(basePath string, rev int64, t time.Time) string {
+	return fmt.Sprintf("%s%s%d_%s", basePath, periodicBackupSep, rev, t.Format(periodicBackupTimeFormat))
+}
+
+// backupsToPrune returns the paths of the periodic snapshots at basePath beyond the newest maxCount, by the time they were taken.
+// Paths that are not of periodic snapshots are ignored.
+func backupsToPrune(basePath string, paths []string, maxCount int) []string {
+	type snapshot struct {
+		path string
+		time time.Time
+	}
+	var snaps []snapshot
+	for _, p := range paths {
+		rest := strings.TrimPrefix(p, basePath+periodicBackupSep)
+		i := strings.Index(rest, "_")
+		if rest == p || i < 0 {
+			continue
+		}
+		if _, err := strconv.ParseInt(rest[:i], 10, 64); err != nil {
+			continue
+		}
+		t, err := time.Parse(periodicBackupTimeFormat, rest[i+1:])
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, snapshot{path: p, time: t})
+	}
+	if len(snaps) <= maxCount {
+		return nil
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].time.After(snaps[j].time) })
+	var pruned []string
+	for _, s := range snaps[maxCount:] {
+		pruned = append(pruned, s.path)
+	}
+	return pruned
 }
 
 // etcdClientWithMaxRevision gets the etcd endpoint with the maximum kv store revision
 // and returns the etcd client of that member.
 func (bm *BackupManager) etcdClientWithMaxRevision(ctx context.Context) (*clientv3.Client, int64, error) {
-	etcdcli, rev, err := getClientWithMaxRev(ctx, bm.endpoints, bm.etcdTLSConfig)
+	etcdcli, rev, err := getClientWithMaxRev(ctx, bm.memberEndpoints(ctx), bm.etcdTLSConfig)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get etcd client with maximum kv store revision: %v", err)
 	}
 	return etcdcli, rev, nil
 }
 
+// memberEndpoints returns the client URLs of the current members, as listed through the configured endpoints,
+// so that a backup still reaches the cluster once the members it was configured with have been replaced.
+// It falls back to the configured endpoints if the members cannot be listed.
+func (bm *BackupManager) memberEndpoints(ctx context.Context) []string {
+	etcdcli, err := clientv3.New(etcdutil.NewClientConfig(bm.endpoints, bm.etcdTLSConfig, etcdutil.ClientOptions{}))
+	if err != nil {
+		logrus.Warningf("failed to list members through endpoints (%v), using them as is: %v", bm.endpoints, err)
+		return bm.endpoints
+	}
+	defer etcdcli.Close()
+
+	urls, err := etcdutil.MemberClientURLs(ctx, etcdcli)
+	if err != nil {
+		logrus.Warningf("failed to list members through endpoints (%v), using them as is: %v", bm.endpoints, err)
+		return bm.endpoints
+	}
+	if len(urls) == 0 {
+		return bm.endpoints
+	}
+	return urls
+}
+
 func getClientWithMaxRev(ctx context.Context, endpoints []string, tc *tls.Config) (*clientv3.Client, int64, error) {
 	mapEps := make(map[string]*clientv3.Client)
 	var maxClient *clientv3.Client
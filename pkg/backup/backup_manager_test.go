@@ -0,0 +1,49 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackupsToPrune(t *testing.T) {
+	base := "bucket/example.backup"
+	t0 := time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC)
+	paths := []string{
+		periodicBackupPath(base, 30, t0.Add(2*time.Hour)),
+		periodicBackupPath(base, 10, t0),
+		"bucket/example.backup",
+		"bucket/example.backup_vfoo_bar",
+		periodicBackupPath(base, 20, t0.Add(time.Hour)),
+	}
+	if get := backupsToPrune(base, paths, 3); get != nil {
+		t.Errorf("expect no snapshot to prune, get %v", get)
+	}
+	want := []string{periodicBackupPath(base, 20, t0.Add(time.Hour)), periodicBackupPath(base, 10, t0)}
+	if get := backupsToPrune(base, paths, 1); !reflect.DeepEqual(get, want) {
+		t.Errorf("backupsToPrune()=%v, want=%v", get, want)
+	}
+}
+
+func TestSnapshotsOf(t *testing.T) {
+	base := "bucket/example.backup"
+	periodic := periodicBackupPath(base, 10, time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC))
+	paths := []string{base, periodic, base + ".pre-upgrade-3.2.13", base + ".final-1525168800", "bucket/example.backup2"}
+	if get, want := snapshotsOf(base, paths), []string{base, periodic}; !reflect.DeepEqual(get, want) {
+		t.Errorf("snapshotsOf()=%v, want=%v", get, want)
+	}
+}
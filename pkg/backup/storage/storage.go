@@ -0,0 +1,117 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage lets backup storage backends other than S3 and ABS, e.g. a proprietary blob store,
+// be compiled into the backup and restore operators without changing them.
+//
+// A backend registers itself under its storage type from the init function of its package:
+//
+//	func init() {
+//		storage.Register("MyBlob", newBackend)
+//	}
+//
+// and is compiled in with a blank import of the package in cmd/backup-operator and cmd/restore-operator.
+// An EtcdBackup of that storage type sets its path, secret and configuration in spec.custom.
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Backend saves, lists, reads and deletes backup files on a storage.
+// Paths are those of spec.custom.path, and those the backup operator derives from it for periodic backups.
+type Backend interface {
+	writer.Writer
+	reader.Reader
+	io.Closer
+}
+
+// URLSigner is implemented by the backends that can hand out a temporary URL to read a backup file.
+// The backup operator needs it to verify the backups of spec.backupPolicy.verifyRestore.
+type URLSigner interface {
+	// SignedURL returns a URL the backup file at path can be downloaded from until expiry.
+	SignedURL(path string, expiry time.Duration) (*url.URL, error)
+}
+
+// Factory opens the backend of a custom backup source, whose secret is read in namespace.
+type Factory func(kubecli kubernetes.Interface, namespace string, source *api.CustomBackupSource) (Backend, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[api.BackupStorageType]Factory{}
+)
+
+// Register registers the factory of the backends of the storage type.
+// It panics if the storage type is S3, ABS or already registered.
+func Register(st api.BackupStorageType, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case len(st) == 0 || st == api.BackupStorageTypeS3 || st == api.BackupStorageTypeABS:
+		panic(fmt.Sprintf("storage: cannot register storage type %q", st))
+	case factories[st] != nil:
+		panic(fmt.Sprintf("storage: storage type %q registered twice", st))
+	case f == nil:
+		panic(fmt.Sprintf("storage: nil factory for storage type %q", st))
+	}
+	factories[st] = f
+}
+
+// IsRegistered tells whether a backend is registered for the storage type.
+func IsRegistered(st api.BackupStorageType) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return factories[st] != nil
+}
+
+// Types returns the registered storage types, in order.
+func Types() []api.BackupStorageType {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]api.BackupStorageType, 0, len(factories))
+	for st := range factories {
+		types = append(types, st)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Open opens the backend of the storage type for the source. The caller closes the backend.
+func Open(kubecli kubernetes.Interface, namespace string, st api.BackupStorageType, source *api.CustomBackupSource) (Backend, error) {
+	mu.RLock()
+	f := factories[st]
+	mu.RUnlock()
+	if f == nil {
+		return nil, fmt.Errorf("unknown backup storage type (%s)", st)
+	}
+	if source == nil {
+		return nil, fmt.Errorf("spec.custom must be set for backup storage type (%s)", st)
+	}
+	b, err := f(kubecli, namespace, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backend of storage type (%s): %v", st, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+type memBackend struct {
+	files map[string][]byte
+}
+
+func (b *memBackend) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	b.files[path] = data
+	return int64(len(data)), err
+}
+
+func (b *memBackend) List(ctx context.Context, prefix string) ([]string, error) { return nil, nil }
+
+func (b *memBackend) Delete(ctx context.Context, path string) error {
+	delete(b.files, path)
+	return nil
+}
+
+func (b *memBackend) Open(path string) (io.ReadCloser, error) {
+	data, ok := b.files[path]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *memBackend) Close() error { return nil }
+
+func TestRegister(t *testing.T) {
+	mem := &memBackend{files: map[string][]byte{}}
+	Register("Mem", func(kubecli kubernetes.Interface, namespace string, source *api.CustomBackupSource) (Backend, error) {
+		return mem, nil
+	})
+	defer func() {
+		mu.Lock()
+		delete(factories, "Mem")
+		mu.Unlock()
+	}()
+
+	if !IsRegistered("Mem") || IsRegistered(api.BackupStorageTypeS3) {
+		t.Errorf("expect only Mem to be registered, got %v", Types())
+	}
+	if got := Types(); !reflect.DeepEqual(got, []api.BackupStorageType{"Mem"}) {
+		t.Errorf("expect storage types [Mem], got %v", got)
+	}
+	b, err := Open(nil, "default", "Mem", &api.CustomBackupSource{Path: "backups/example"})
+	if err != nil || b != mem {
+		t.Fatalf("expect the registered backend, got %v, %v", b, err)
+	}
+	if _, err := Open(nil, "default", "Mem", nil); err == nil {
+		t.Errorf("expect an error without spec.custom")
+	}
+	if _, err := Open(nil, "default", "Unknown", &api.CustomBackupSource{}); err == nil {
+		t.Errorf("expect an error for an unknown storage type")
+	}
+
+	for _, st := range []api.BackupStorageType{"Mem", api.BackupStorageTypeS3, api.BackupStorageTypeABS, ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expect registering storage type %q to panic", st)
+				}
+			}()
+			Register(st, func(kubernetes.Interface, string, *api.CustomBackupSource) (Backend, error) { return nil, nil })
+		}()
+	}
+}
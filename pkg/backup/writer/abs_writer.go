@@ -15,7 +15,6 @@
 package writer
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -38,10 +37,9 @@ func NewABSWriter(abs *storage.BlobStorageClient) Writer {
 	return &absWriter{abs}
 }
 
-const (
-	// AzureBlobBlockChunkLimitInBytes 100MiB is the limit
-	AzureBlobBlockChunkLimitInBytes = 100 * 1024 * 1024
-)
+// absBlockSizeInBytes is the size of the blocks the snapshot is uploaded in.
+// Only one block is buffered at a time; at most 50000 blocks make up a blob, i.e. 200GiB.
+const absBlockSizeInBytes = 4 * 1024 * 1024
 
 // Write writes the backup file to the given abs path, "<abs-container-name>/<key>".
 func (absw *absWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
@@ -67,24 +65,26 @@ func (absw *absWriter) Write(ctx context.Context, path string, r io.Reader) (int
 		return 0, err
 	}
 
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(r)
-	len := len(buf.Bytes())
-	chunckCount := len/AzureBlobBlockChunkLimitInBytes + 1
-	blocks := make([]storage.Block, 0, chunckCount)
-	for i := 0; i < chunckCount; i++ {
-		blockID := base64.StdEncoding.EncodeToString([]byte(uuid.New()))
-		blocks = append(blocks, storage.Block{ID: blockID, Status: storage.BlockStatusLatest})
-		start := i * AzureBlobBlockChunkLimitInBytes
-		end := (i + 1) * AzureBlobBlockChunkLimitInBytes
-		if len < end {
-			end = len
+	// The snapshot is streamed block by block instead of being read into memory first.
+	buf := make([]byte, absBlockSizeInBytes)
+	var blocks []storage.Block
+	var size int64
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return 0, rerr
 		}
-
-		chunk := buf.Bytes()[start:end]
-		err = blob.PutBlock(blockID, chunk, &storage.PutBlockOptions{})
-		if err != nil {
-			return 0, err
+		if n > 0 {
+			blockID := base64.StdEncoding.EncodeToString([]byte(uuid.New()))
+			blocks = append(blocks, storage.Block{ID: blockID, Status: storage.BlockStatusLatest})
+			err = blob.PutBlock(blockID, buf[:n], &storage.PutBlockOptions{})
+			if err != nil {
+				return 0, err
+			}
+			size += int64(n)
+		}
+		if rerr != nil {
+			break
 		}
 	}
 
@@ -92,11 +92,48 @@ func (absw *absWriter) Write(ctx context.Context, path string, r io.Reader) (int
 	if err != nil {
 		return 0, err
 	}
+	return size, nil
+}
 
-	_, err = blob.Get(&storage.GetBlobOptions{})
+// List returns the paths of the blobs, "<abs-container-name>/<key>", with keys starting with the key of prefix.
+func (absw *absWriter) List(ctx context.Context, prefix string) ([]string, error) {
+	container, key, err := util.ParseBucketAndKey(prefix)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	containerRef := absw.abs.GetContainerReference(container)
+	var paths []string
+	params := storage.ListBlobsParameters{Prefix: key}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp, err := containerRef.ListBlobs(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Blobs {
+			paths = append(paths, container+"/"+blob.Name)
+		}
+		if len(resp.NextMarker) == 0 {
+			return paths, nil
+		}
+		params.Marker = resp.NextMarker
+	}
+}
+
+// Delete deletes the blob at the given path, "<abs-container-name>/<key>".
+func (absw *absWriter) Delete(ctx context.Context, path string) error {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	return blob.Properties.ContentLength, nil
+	blob := absw.abs.GetContainerReference(container).GetBlobReference(key)
+	_, err = blob.DeleteIfExists(&storage.DeleteBlobOptions{})
+	return err
 }
@@ -52,7 +52,7 @@ func (s3w *s3Writer) Write(ctx context.Context, path string, r io.Reader) (int64
 		return 0, err
 	}
 
-	resp, err := s3w.s3.GetObject(&s3.GetObjectInput{
+	resp, err := s3w.s3.HeadObject(&s3.HeadObjectInput{
 		Bucket: aws.String(bk),
 		Key:    aws.String(key),
 	})
@@ -64,3 +64,43 @@ func (s3w *s3Writer) Write(ctx context.Context, path string, r io.Reader) (int64
 	}
 	return *resp.ContentLength, nil
 }
+
+// List returns the paths of the s3 objects, "<s3-bucket-name>/<key>", with keys starting with the key of prefix.
+func (s3w *s3Writer) List(ctx context.Context, prefix string) ([]string, error) {
+	bk, key, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = s3w.s3.ListObjectsPagesWithContext(ctx,
+		&s3.ListObjectsInput{
+			Bucket: aws.String(bk),
+			Prefix: aws.String(key),
+		},
+		func(page *s3.ListObjectsOutput, _ bool) bool {
+			for _, obj := range page.Contents {
+				paths = append(paths, bk+"/"+*obj.Key)
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// Delete deletes the s3 object at the given path, "<s3-bucket-name>/<key>".
+func (s3w *s3Writer) Delete(ctx context.Context, path string) error {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3w.s3.DeleteObjectWithContext(ctx,
+		&s3.DeleteObjectInput{
+			Bucket: aws.String(bk),
+			Key:    aws.String(key),
+		})
+	return err
+}
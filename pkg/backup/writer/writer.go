@@ -23,4 +23,10 @@ import (
 type Writer interface {
 	// Write writes a backup file to the given path and returns size of written file.
 	Write(ctx context.Context, path string, r io.Reader) (int64, error)
+
+	// List returns the paths of the backup files whose path starts with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete deletes the backup file at the given path.
+	Delete(ctx context.Context, path string) error
 }
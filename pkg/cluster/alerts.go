@@ -0,0 +1,221 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+const (
+	alertCheckInterval = time.Minute
+	// leaderChangeWindow is the period spec.alerts.maxLeaderChangesPerHour counts leader changes over.
+	leaderChangeWindow = time.Hour
+)
+
+// checkAlertsIfDue compares the members against the thresholds of spec.alerts once per scrape of the metrics worker,
+// i.e. at most once per alertCheckInterval, and sets or clears the ThresholdExceeded condition accordingly.
+func (c *Cluster) checkAlertsIfDue() error {
+	a := c.cluster.Spec.Alerts
+	if a == nil {
+		c.status.ClearCondition(api.ClusterConditionThresholdExceeded)
+		c.deleteAlertMetrics()
+		return c.syncPrometheusRule()
+	}
+	s := c.lastScrape()
+	if !s.at.After(c.lastAlertCheck) {
+		return nil
+	}
+	c.lastAlertCheck = s.at
+
+	var exceeded []string
+	if a.MaxDBSizePercent > 0 && s.dbSizes != nil {
+		if s.err != nil {
+			return s.err
+		}
+		name, pct := largestDBSizePercent(s.dbSizes, c.cluster.Spec.Etcd.QuotaBackendBytesOrDefault())
+		dbSizePercent.WithLabelValues(c.cluster.Namespace, c.cluster.Name).Set(pct)
+		if pct > float64(a.MaxDBSizePercent) {
+			exceeded = append(exceeded, fmt.Sprintf("database of member %s uses %.0f%% of the backend quota (max %d%%)", name, pct, a.MaxDBSizePercent))
+		}
+	}
+	if a.MaxWALFsyncP99InMillisecond > 0 && s.walFsync != nil {
+		name, p99, ok := c.slowestWALFsyncP99(s.walFsync)
+		if ok {
+			walFsyncP99.WithLabelValues(c.cluster.Namespace, c.cluster.Name).Set(p99)
+			if ms := p99 * 1000; ms > float64(a.MaxWALFsyncP99InMillisecond) {
+				exceeded = append(exceeded, fmt.Sprintf("WAL fsync p99 of member %s is %.0fms (max %dms)", name, ms, a.MaxWALFsyncP99InMillisecond))
+			}
+		}
+	}
+	if a.MaxLeaderChangesPerHour > 0 {
+		if n := c.recentLeaderChanges(); n > a.MaxLeaderChangesPerHour {
+			exceeded = append(exceeded, fmt.Sprintf("%d leader changes within the last hour (max %d)", n, a.MaxLeaderChangesPerHour))
+		}
+	}
+	if g := c.keySpace; g != nil && g.rated {
+		if a.MaxKeysGrowthPerHour > 0 && g.keysPerHour > float64(a.MaxKeysGrowthPerHour) {
+			exceeded = append(exceeded, fmt.Sprintf("the cluster gains %.0f keys per hour (max %d)", g.keysPerHour, a.MaxKeysGrowthPerHour))
+		}
+		if a.MaxDBGrowthBytesPerHour > 0 && g.dbBytesPerHour > float64(a.MaxDBGrowthBytesPerHour) {
+			exceeded = append(exceeded, fmt.Sprintf("the largest database grows by %.0f bytes per hour (max %d)", g.dbBytesPerHour, a.MaxDBGrowthBytesPerHour))
+		}
+	}
+
+	if len(exceeded) == 0 {
+		c.status.ClearCondition(api.ClusterConditionThresholdExceeded)
+	} else {
+		c.status.SetThresholdExceededCondition(strings.Join(exceeded, "; "))
+	}
+	return c.syncPrometheusRule()
+}
+
+// largestDBSizePercent returns the member with the largest backend database and its size in percent of the quota.
+func largestDBSizePercent(dbSizes map[string]int64, quota int64) (string, float64) {
+	var name string
+	var largest int64
+	found := false
+	for n, size := range dbSizes {
+		if !found || size > largest || (size == largest && n < name) {
+			name, largest, found = n, size, true
+		}
+	}
+	return name, float64(largest) * 100 / float64(quota)
+}
+
+// slowestWALFsyncP99 returns the member with the highest 99th percentile of the WAL fsync duration, in seconds,
+// over the fsyncs since the previous check, or since the member started on the first check.
+// Members whose metrics could not be read are skipped. It returns false if no member reported an fsync.
+func (c *Cluster) slowestWALFsyncP99(hists map[string]*etcdutil.Histogram) (string, float64, bool) {
+	var name string
+	var slowest float64
+	found := false
+	for n, h := range hists {
+		p99, ok := h.Sub(c.walFsyncHistograms[n]).Quantile(0.99)
+		if ok && (!found || p99 > slowest || (p99 == slowest && n < name)) {
+			name, slowest, found = n, p99, true
+		}
+	}
+	c.walFsyncHistograms = hists
+	return name, slowest, found
+}
+
+// recentLeaderChanges returns the number of leader changes within leaderChangeWindow and forgets the older ones.
+func (c *Cluster) recentLeaderChanges() int {
+	now := time.Now()
+	var recent []time.Time
+	for _, t := range c.leaderChangeTimes {
+		if now.Sub(t) < leaderChangeWindow {
+			recent = append(recent, t)
+		}
+	}
+	c.leaderChangeTimes = recent
+	return len(recent)
+}
+
+// syncPrometheusRule applies the PrometheusRule of the cluster if spec.alerts.prometheusRule is set and the rules changed,
+// and deletes the rule it applied before otherwise.
+func (c *Cluster) syncPrometheusRule() error {
+	a := c.cluster.Spec.Alerts
+	if a == nil || !a.PrometheusRule {
+		// Only a rule applied by this run of the operator is deleted, so that clusters without alerts make no requests.
+		if len(c.appliedAlertRules) == 0 {
+			return nil
+		}
+		if err := k8sutil.DeletePrometheusRule(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace); err != nil {
+			return err
+		}
+		c.appliedAlertRules = ""
+		return nil
+	}
+
+	rules := alertRules(c.cluster.Namespace, c.cluster.Name, a)
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	if string(b) == c.appliedAlertRules {
+		return nil
+	}
+	err = k8sutil.ApplyPrometheusRule(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, rules, c.cluster.AsOwner(), k8sutil.PropagatedLabels(c.cluster))
+	if err != nil {
+		return fmt.Errorf("failed to apply PrometheusRule: %v", err)
+	}
+	c.appliedAlertRules = string(b)
+	return nil
+}
+
+// alertRules returns an alerting rule for each threshold of the policy, on the metrics of the operator for the cluster.
+func alertRules(ns, clusterName string, a *api.AlertPolicy) []k8sutil.AlertRule {
+	sel := fmt.Sprintf("{Namespace=%q,ClusterName=%q}", ns, clusterName)
+	labels := map[string]string{"severity": "warning"}
+	var rules []k8sutil.AlertRule
+	if a.MaxDBSizePercent > 0 {
+		rules = append(rules, k8sutil.AlertRule{
+			Alert:       "EtcdDatabaseSizeHigh",
+			Expr:        fmt.Sprintf("etcd_operator_cluster_db_size_percent%s > %d", sel, a.MaxDBSizePercent),
+			For:         "10m",
+			Labels:      labels,
+			Annotations: map[string]string{"message": fmt.Sprintf("The largest database of etcd cluster %s/%s uses more than %d%% of its quota.", ns, clusterName, a.MaxDBSizePercent)},
+		})
+	}
+	if a.MaxWALFsyncP99InMillisecond > 0 {
+		rules = append(rules, k8sutil.AlertRule{
+			Alert:       "EtcdWALFsyncSlow",
+			Expr:        fmt.Sprintf("etcd_operator_cluster_wal_fsync_p99_seconds%s > %g", sel, float64(a.MaxWALFsyncP99InMillisecond)/1000),
+			For:         "10m",
+			Labels:      labels,
+			Annotations: map[string]string{"message": fmt.Sprintf("The WAL fsync p99 of a member of etcd cluster %s/%s is above %dms.", ns, clusterName, a.MaxWALFsyncP99InMillisecond)},
+		})
+	}
+	if a.MaxLeaderChangesPerHour > 0 {
+		rules = append(rules, k8sutil.AlertRule{
+			Alert:       "EtcdFrequentLeaderChanges",
+			Expr:        fmt.Sprintf("increase(etcd_operator_cluster_leader_changes_total%s[1h]) > %d", sel, a.MaxLeaderChangesPerHour),
+			Labels:      labels,
+			Annotations: map[string]string{"message": fmt.Sprintf("etcd cluster %s/%s changed leader more than %d times within the last hour.", ns, clusterName, a.MaxLeaderChangesPerHour)},
+		})
+	}
+	if a.MaxKeysGrowthPerHour > 0 {
+		rules = append(rules, k8sutil.AlertRule{
+			Alert:       "EtcdKeySpaceGrowingFast",
+			Expr:        fmt.Sprintf("etcd_operator_cluster_keys_growth_per_hour%s > %d", sel, a.MaxKeysGrowthPerHour),
+			For:         "10m",
+			Labels:      labels,
+			Annotations: map[string]string{"message": fmt.Sprintf("etcd cluster %s/%s gains more than %d keys per hour.", ns, clusterName, a.MaxKeysGrowthPerHour)},
+		})
+	}
+	if a.MaxDBGrowthBytesPerHour > 0 {
+		rules = append(rules, k8sutil.AlertRule{
+			Alert:       "EtcdDatabaseGrowingFast",
+			Expr:        fmt.Sprintf("etcd_operator_cluster_db_growth_bytes_per_hour%s > %d", sel, a.MaxDBGrowthBytesPerHour),
+			For:         "10m",
+			Labels:      labels,
+			Annotations: map[string]string{"message": fmt.Sprintf("The largest database of etcd cluster %s/%s grows by more than %d bytes per hour.", ns, clusterName, a.MaxDBGrowthBytesPerHour)},
+		})
+	}
+	return rules
+}
+
+func (c *Cluster) deleteAlertMetrics() {
+	dbSizePercent.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	walFsyncP99.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+)
+
+func TestRecentLeaderChanges(t *testing.T) {
+	c := &Cluster{
+		leaderChangeTimes: []time.Time{
+			time.Now().Add(-2 * leaderChangeWindow),
+			time.Now().Add(-leaderChangeWindow / 2),
+			time.Now(),
+		},
+	}
+	if n := c.recentLeaderChanges(); n != 2 {
+		t.Errorf("expect 2 leader changes within the window, got %d", n)
+	}
+	if len(c.leaderChangeTimes) != 2 {
+		t.Errorf("expect the leader change outside the window to be forgotten, got %v", c.leaderChangeTimes)
+	}
+}
+
+func TestLargestDBSizePercent(t *testing.T) {
+	quota := int64(2 * 1024 * 1024 * 1024)
+	name, pct := largestDBSizePercent(map[string]int64{
+		"test-0000": quota / 4,
+		"test-0001": quota / 2,
+		"test-0002": quota / 2,
+	}, quota)
+	if name != "test-0001" || pct != 50 {
+		t.Errorf("expect test-0001 at 50%%, got %s at %v%%", name, pct)
+	}
+}
+
+func TestHealthProbeWithoutQuorum(t *testing.T) {
+	w := &healthWorker{c: &Cluster{}}
+	v := &opView{
+		members: etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000"}, &etcdutil.Member{Name: "test-0001"}, &etcdutil.Member{Name: "test-0002"}),
+		ready:   []string{"http://test-0000.test.default.svc:2379"},
+	}
+	// No request is made to the members without a quorum of ready pods.
+	if p := w.probe(v); p.ready || p.at.IsZero() {
+		t.Errorf("expect an unready probe, got %+v", p)
+	}
+}
+
+func TestAlertRules(t *testing.T) {
+	tests := []struct {
+		policy *api.AlertPolicy
+		exprs  []string
+	}{{
+		policy: &api.AlertPolicy{},
+	}, {
+		policy: &api.AlertPolicy{MaxDBSizePercent: 80, MaxWALFsyncP99InMillisecond: 250, MaxLeaderChangesPerHour: 3},
+		exprs: []string{
+			`etcd_operator_cluster_db_size_percent{Namespace="default",ClusterName="test"} > 80`,
+			`etcd_operator_cluster_wal_fsync_p99_seconds{Namespace="default",ClusterName="test"} > 0.25`,
+			`increase(etcd_operator_cluster_leader_changes_total{Namespace="default",ClusterName="test"}[1h]) > 3`,
+		},
+	}, {
+		policy: &api.AlertPolicy{MaxLeaderChangesPerHour: 1},
+		exprs: []string{
+			`increase(etcd_operator_cluster_leader_changes_total{Namespace="default",ClusterName="test"}[1h]) > 1`,
+		},
+	}, {
+		policy: &api.AlertPolicy{MaxKeysGrowthPerHour: 10000, MaxDBGrowthBytesPerHour: 1 << 20},
+		exprs: []string{
+			`etcd_operator_cluster_keys_growth_per_hour{Namespace="default",ClusterName="test"} > 10000`,
+			`etcd_operator_cluster_db_growth_bytes_per_hour{Namespace="default",ClusterName="test"} > 1048576`,
+		},
+	}}
+	for i, tt := range tests {
+		rules := alertRules("default", "test", tt.policy)
+		if len(rules) != len(tt.exprs) {
+			t.Errorf("#%d: expect %d rules, got %d", i, len(tt.exprs), len(rules))
+			continue
+		}
+		for j, r := range rules {
+			if r.Expr != tt.exprs[j] {
+				t.Errorf("#%d: expect rule %d expr %q, got %q", i, j, tt.exprs[j], r.Expr)
+			}
+		}
+	}
+}
+
+func TestGrowthOf(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		samples  []keySpaceSample
+		rated    bool
+		keys, db float64
+	}{{
+		samples: []keySpaceSample{{at: now, keys: 10, dbSize: 100}},
+	}, {
+		samples: []keySpaceSample{
+			{at: now.Add(-30 * time.Minute), keys: 100, dbSize: 1000},
+			{at: now.Add(-15 * time.Minute), keys: 150, dbSize: 1200},
+			{at: now, keys: 200, dbSize: 900},
+		},
+		rated: true, keys: 200, db: -200,
+	}, {
+		samples: []keySpaceSample{{at: now, keys: 10}, {at: now, keys: 20}},
+	}}
+	for i, tt := range tests {
+		g := growthOf(tt.samples)
+		if g.last != tt.samples[len(tt.samples)-1] {
+			t.Errorf("#%d: expect the last sample %v, got %v", i, tt.samples[len(tt.samples)-1], g.last)
+		}
+		if g.rated != tt.rated || g.keysPerHour != tt.keys || g.dbBytesPerHour != tt.db {
+			t.Errorf("#%d: expect rated %v, %v keys and %v bytes per hour, got %v, %v and %v", i, tt.rated, tt.keys, tt.db, g.rated, g.keysPerHour, g.dbBytesPerHour)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"time"
+)
+
+// Results of the reconciles_total metric.
+const (
+	reconcileSuccess = "success"
+	reconcileFailure = "failure"
+)
+
+// maxReconcileBackoff caps the time between two reconciliations of a failing cluster.
+var maxReconcileBackoff = 5 * time.Minute
+
+// degradedAPIReconcileInterval is the least time between two reconciliations while the Kubernetes API server is degraded,
+// so that the operator does not pile on its requests during a control plane incident.
+var degradedAPIReconcileInterval = time.Minute
+
+// nextReconcileDelay returns the time to wait before the next reconciliation,
+// at least degradedAPIReconcileInterval while the Kubernetes API server is degraded.
+func nextReconcileDelay(failures int, apiDegraded bool) time.Duration {
+	d := reconcileDelay(failures)
+	if apiDegraded && d < degradedAPIReconcileInterval {
+		return degradedAPIReconcileInterval
+	}
+	return d
+}
+
+// reconcileDelay returns the time to wait before the next reconciliation.
+// It doubles with each consecutive failure, up to maxReconcileBackoff.
+func reconcileDelay(failures int) time.Duration {
+	d := reconcileInterval
+	for i := 0; i < failures && d < maxReconcileBackoff; i++ {
+		d *= 2
+	}
+	if d > maxReconcileBackoff {
+		d = maxReconcileBackoff
+	}
+	return d
+}
+
+// trackReconcileResult counts the consecutive failed reconciliations in the status, along with the last error.
+// It returns a fatal error once spec.maxReconcileFailures is reached.
+func (c *Cluster) trackReconcileResult(rerr error) error {
+	if rerr == nil {
+		reconciles.WithLabelValues(c.cluster.Namespace, c.cluster.Name, reconcileSuccess).Inc()
+		if c.status.ReconcileFailures > 0 {
+			c.logger.Infof("reconciled after %d failed attempts", c.status.ReconcileFailures)
+		}
+		c.status.ReconcileFailures = 0
+		c.status.LastReconcileError = ""
+		return nil
+	}
+
+	reconciles.WithLabelValues(c.cluster.Namespace, c.cluster.Name, reconcileFailure).Inc()
+	c.recordAction("reconcile", rerr)
+	c.status.ReconcileFailures++
+	c.status.LastReconcileError = rerr.Error()
+	max := c.cluster.Spec.MaxReconcileFailures
+	if max > 0 && c.status.ReconcileFailures >= max {
+		return newFatalError(fmt.Sprintf("reconcile failed %d times in a row: %v", c.status.ReconcileFailures, rerr))
+	}
+	c.logger.Warningf("reconcile failed %d times in a row, retrying in %v", c.status.ReconcileFailures, reconcileDelay(c.status.ReconcileFailures))
+	if err := c.updateCRStatus(); err != nil {
+		c.logger.Warningf("failed to update reconcile failures in CR status: %v", err)
+	}
+	return nil
+}
+
+// reconcileTimer fires the reconciliations of the run loop of a cluster. Unlike a timer created anew on each
+// iteration of the loop, it is not pushed back by the events the loop handles in between, e.g. the updates of
+// the EtcdCluster that the status updates of the operator itself cause.
+type reconcileTimer struct {
+	t *time.Timer
+	// fired is true once the timer fired, until it is rearmed.
+	fired bool
+}
+
+func newReconcileTimer(d time.Duration) *reconcileTimer {
+	return &reconcileTimer{t: time.NewTimer(d)}
+}
+
+// C returns the channel the timer fires on. The receiver must call fire on each receive.
+func (r *reconcileTimer) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r *reconcileTimer) fire() {
+	r.fired = true
+}
+
+// rearm schedules the next reconciliation in d once the timer fired; a pending reconciliation is left as is.
+func (r *reconcileTimer) rearm(d time.Duration) {
+	if !r.fired {
+		return
+	}
+	r.t.Reset(d)
+	r.fired = false
+}
+
+// now schedules a reconciliation right away, e.g. to apply a change of the spec without waiting for the interval.
+func (r *reconcileTimer) now() {
+	if !r.fired && !r.t.Stop() {
+		<-r.t.C
+	}
+	r.t.Reset(0)
+	r.fired = false
+}
+
+func (r *reconcileTimer) stop() {
+	r.t.Stop()
+}
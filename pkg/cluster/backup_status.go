@@ -0,0 +1,35 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// updateLastBackupTime records in the status when the cluster was last backed up by the backup operator.
+func (c *Cluster) updateLastBackupTime() error {
+	backups, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdBackups(c.cluster.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	if t, ok := k8sutil.LastBackupTime(c.cluster.Name, c.cluster.Namespace, backups.Items); ok {
+		c.status.LastBackupTime = t.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// checkBootstrap ends the bootstrap of a new cluster once a quorum of spec.size members is ready,
+// and deletes its pods once spec.bootstrap.timeoutInSecond is exceeded. The cluster is then created anew
+// from a new seed member, and recreated tells so, until spec.bootstrap.maxRetries is used up.
+// The timeout is then returned as a fatal error.
+func (c *Cluster) checkBootstrap(running, pending []*v1.Pod) (recreated bool, err error) {
+	if len(c.status.BootstrapStartTime) == 0 {
+		return false, nil
+	}
+	members := c.members
+	if members == nil {
+		members = podsToMemberSet(running, c.cluster.Spec)
+	}
+	if c.status.Ready && hasQuorum(c.cluster.Spec.Size, readyMemberPods(members, running)) {
+		c.logger.Infof("cluster bootstrapped with %d members", members.Size())
+		c.status.BootstrapStartTime = ""
+		ev := notifyutil.NewEvent(notifyutil.EventClusterCreated, c.cluster.Namespace, c.cluster.Name)
+		ev.Message = fmt.Sprintf("bootstrapped with %d members", members.Size())
+		c.config.Hooks.Fire(ev)
+		return false, nil
+	}
+	bp := c.cluster.Spec.Bootstrap
+	if bp == nil || bp.TimeoutInSecond == 0 {
+		return false, nil
+	}
+	timeout := time.Duration(bp.TimeoutInSecond) * time.Second
+	start, err := time.Parse(time.RFC3339, c.status.BootstrapStartTime)
+	if err != nil || time.Since(start) < timeout {
+		return false, nil
+	}
+
+	diagnostics := bootstrapDiagnostics(members, running, pending)
+	retry := c.status.BootstrapRetries < bp.MaxRetries
+	c.logger.Warningf("cluster did not come up within %v: %s", timeout, diagnostics)
+	if _, err := c.eventsCli.Create(k8sutil.BootstrapTimedOutEvent(timeout, diagnostics, retry, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create bootstrap timed out event: %v", err)
+	}
+	if err := c.deleteBootstrapPods(); err != nil {
+		return false, err
+	}
+	if !retry {
+		c.status.BootstrapStartTime = ""
+		return false, newFatalError(fmt.Sprintf("cluster did not come up within %v: %s", timeout, diagnostics))
+	}
+
+	c.status.BootstrapRetries++
+	c.status.BootstrapStartTime = time.Now().Format(time.RFC3339)
+	c.members = nil
+	c.pendingReplacements = 0
+	if err := c.prepareSeedMember(); err != nil {
+		return true, err
+	}
+	return true, c.updateCRStatus()
+}
+
+// deleteBootstrapPods deletes the pods of the cluster and their PVCs.
+func (c *Cluster) deleteBootstrapPods() error {
+	pods, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if err := c.removePod(pod.Name); err != nil {
+			return fmt.Errorf("failed to delete pod (%s): %v", pod.Name, err)
+		}
+		if c.isPodPVEnabled() {
+			if err := c.removePVC(k8sutil.PVCNameFromMember(pod.Name)); err != nil {
+				return err
+			}
+			if err := c.removePVC(k8sutil.WALPVCNameFromMember(pod.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readyMemberPods counts the running pods of the members that are ready.
+func readyMemberPods(members etcdutil.MemberSet, running []*v1.Pod) int {
+	n := 0
+	for _, pod := range running {
+		if _, ok := members[pod.Name]; ok && k8sutil.IsPodReady(pod) {
+			n++
+		}
+	}
+	return n
+}
+
+// bootstrapDiagnostics tells why the members of a cluster are not ready: the pods that are not scheduled,
+// the containers that wait, e.g. on pulling their image, and the running pods that are not ready.
+func bootstrapDiagnostics(members etcdutil.MemberSet, running, pending []*v1.Pod) string {
+	problems := []string{fmt.Sprintf("%d of %d members are ready", readyMemberPods(members, running), members.Size())}
+	for _, pod := range pending {
+		switch cond := podCondition(pod, v1.PodScheduled); {
+		case cond != nil && cond.Status == v1.ConditionFalse:
+			problems = append(problems, fmt.Sprintf("pod %s is not scheduled: %s", pod.Name, cond.Message))
+		case len(podWaitingReason(pod)) != 0:
+			problems = append(problems, fmt.Sprintf("pod %s is pending: %s", pod.Name, podWaitingReason(pod)))
+		default:
+			problems = append(problems, fmt.Sprintf("pod %s is pending", pod.Name))
+		}
+	}
+	for _, pod := range running {
+		if k8sutil.IsPodReady(pod) {
+			continue
+		}
+		if reason := podWaitingReason(pod); len(reason) != 0 {
+			problems = append(problems, fmt.Sprintf("pod %s is not ready: %s", pod.Name, reason))
+		} else {
+			problems = append(problems, fmt.Sprintf("pod %s is not ready", pod.Name))
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+func podCondition(pod *v1.Pod, t v1.PodConditionType) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == t {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// podWaitingReason returns why the first waiting container of the pod, init containers first, waits,
+// e.g. "container etcd is waiting: ImagePullBackOff: ...". It is empty if no container waits on an error.
+func podWaitingReason(pod *v1.Pod) string {
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		w := cs.State.Waiting
+		if w == nil || len(w.Reason) == 0 || w.Reason == "PodInitializing" || w.Reason == "ContainerCreating" {
+			continue
+		}
+		if len(w.Message) == 0 {
+			return fmt.Sprintf("container %s is waiting: %s", cs.Name, w.Reason)
+		}
+		return fmt.Sprintf("container %s is waiting: %s: %s", cs.Name, w.Reason, w.Message)
+	}
+	return ""
+}
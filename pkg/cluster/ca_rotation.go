@@ -0,0 +1,269 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+	// minCARotationSize is the smallest cluster that keeps quorum while its members are rolled.
+	minCARotationSize = 3
+)
+
+// reconcileCARotation starts the CA rotation requested by annotating the cluster, and moves a rotation in progress forward:
+//   - TrustNewCA: the CA bundles of the TLS secrets trust both the old and the new CA, and the members are rolled to load them.
+//     Clients have the dual trust period to trust the new CA and get client certificates of it.
+//   - RollMemberCerts: the members get certificates of the new CA and are rolled, then the operator gets a client certificate of it.
+//   - DropOldCA: the CA bundles only trust the new CA, and the members are rolled to load them.
+//
+// Members are rolled, one at a time, by replacing them. It returns whether it replaced a member.
+func (c *Cluster) reconcileCARotation(pods []*v1.Pod) (bool, error) {
+	if _, ok := c.cluster.Annotations[k8sutil.AnnotationRotateCA]; ok {
+		if err := c.startCARotation(); err != nil {
+			return false, err
+		}
+	}
+	r := c.status.CARotation
+	if r == nil || r.Phase == api.CARotationCompleted {
+		return false, nil
+	}
+	phaseStart, err := time.Parse(time.RFC3339, r.PhaseStartTime)
+	if err != nil {
+		return false, fmt.Errorf("invalid phase start time of the CA rotation: %v", err)
+	}
+	if pod := pickOnePodCreatedBefore(pods, phaseStart); pod != nil {
+		return true, c.rollMemberForCARotation(pods, pod.Name)
+	}
+
+	switch r.Phase {
+	case api.CARotationTrustNewCA:
+		start, err := time.Parse(time.RFC3339, r.StartTime)
+		if err != nil {
+			return false, fmt.Errorf("invalid start time of the CA rotation: %v", err)
+		}
+		if time.Since(start) < time.Duration(r.DualTrustPeriodInSecond)*time.Second {
+			return false, nil
+		}
+		if err := c.issueMemberCerts(); err != nil {
+			return false, err
+		}
+		c.setCARotationPhase(api.CARotationRollMemberCerts, "The members trust the old and the new CA and are being rolled to certificates of the new CA")
+	case api.CARotationRollMemberCerts:
+		if err := c.issueOperatorCert(); err != nil {
+			return false, err
+		}
+		ca, _, err := c.rotatedCA()
+		if err != nil {
+			return false, err
+		}
+		err = c.updateCABundles(func([]byte) []byte { return ca })
+		if err != nil {
+			return false, err
+		}
+		c.setCARotationPhase(api.CARotationDropOldCA, "The members and the operator use certificates of the new CA. The old CA is no longer trusted once the members are rolled")
+	case api.CARotationDropOldCA:
+		c.setCARotationPhase(api.CARotationCompleted, "The CA rotation is completed")
+	}
+	return false, nil
+}
+
+// startCARotation generates a new CA and adds it to the CA bundles of the TLS secrets of the cluster.
+// A request that cannot be run is removed with a warning event.
+func (c *Cluster) startCARotation() error {
+	v := c.cluster.Annotations[k8sutil.AnnotationRotateCA]
+	period, err := time.ParseDuration(v)
+	behind, skew := c.memberClockBehind(etcdutil.CertBackdate)
+	switch {
+	case err != nil || period < 0:
+		c.refuseMaintenance(k8sutil.AnnotationRotateCA, fmt.Sprintf("invalid dual trust period %q of annotation %s, must be a duration such as \"24h\"", v, k8sutil.AnnotationRotateCA))
+		return nil
+	case !c.isSecurePeer() || !c.isSecureClient():
+		c.refuseMaintenance(k8sutil.AnnotationRotateCA, "cannot rotate the CA of a cluster without static peer and client TLS")
+		return nil
+	case c.cluster.Spec.Size < minCARotationSize:
+		c.refuseMaintenance(k8sutil.AnnotationRotateCA, fmt.Sprintf("cannot rotate the CA of a cluster of less than %d members without losing quorum", minCARotationSize))
+		return nil
+	case c.status.CARotation != nil && c.status.CARotation.Phase != api.CARotationCompleted:
+		c.refuseMaintenance(k8sutil.AnnotationRotateCA, "a CA rotation is already in progress")
+		return nil
+	case len(behind) != 0:
+		c.refuseMaintenance(k8sutil.AnnotationRotateCA, fmt.Sprintf("the clock of member %s is %v behind the clock of the operator: the new certificates would not be valid yet on it", behind, -skew))
+		return nil
+	}
+
+	cert, key, err := etcdutil.NewCA(fmt.Sprintf("%s.%s etcd CA", c.cluster.Name, c.cluster.Namespace), caValidity)
+	if err != nil {
+		return err
+	}
+	s := k8sutil.NewCASecret(c.cluster.Name, c.cluster.Namespace, cert, key, c.cluster.AsOwner())
+	k8sutil.AddLabels(s.GetObjectMeta(), k8sutil.PropagatedLabels(c.cluster))
+	if err := k8sutil.ApplySecret(c.config.KubeCli, s); err != nil {
+		return fmt.Errorf("failed to save the new CA: %v", err)
+	}
+	err = c.updateCABundles(func(bundle []byte) []byte {
+		return etcdutil.AppendCA(bundle, cert)
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	c.status.CARotation = &api.CARotationStatus{
+		StartTime:               now,
+		DualTrustPeriodInSecond: int64(period / time.Second),
+	}
+	c.setCARotationPhase(api.CARotationTrustNewCA, fmt.Sprintf("Started the rotation of the CA: the old and the new CA are trusted for %v", period))
+	if err := c.removeClusterAnnotation(k8sutil.AnnotationRotateCA); err != nil {
+		c.logger.Errorf("failed to remove annotation %s: %v", k8sutil.AnnotationRotateCA, err)
+	}
+	return nil
+}
+
+func (c *Cluster) setCARotationPhase(p api.CARotationPhase, message string) {
+	c.status.CARotation.Phase = p
+	c.status.CARotation.PhaseStartTime = time.Now().Format(time.RFC3339)
+	c.logger.Info(message)
+	if _, err := c.eventsCli.Create(k8sutil.CARotationEvent(message, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create CA rotation event: %v", err)
+	}
+}
+
+// updateCABundles replaces the CA bundles of the peer, server and operator secrets with the result of update,
+// and reloads the TLS config of the operator.
+func (c *Cluster) updateCABundles(update func(bundle []byte) []byte) error {
+	static := c.cluster.Spec.TLS.Static
+	secrets := []struct{ name, key string }{
+		{static.Member.PeerSecret, k8sutil.PeerCAFile},
+		{static.Member.ServerSecret, k8sutil.ServerCAFile},
+		{static.OperatorSecret, etcdutil.CliCAFile},
+	}
+	for _, s := range secrets {
+		cur, err := c.config.KubeCli.CoreV1().Secrets(c.cluster.Namespace).Get(s.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		err = k8sutil.UpdateSecretData(c.config.KubeCli, c.cluster.Namespace, s.name, map[string][]byte{s.key: update(cur.Data[s.key])})
+		if err != nil {
+			return fmt.Errorf("failed to update the CA bundle of secret (%s): %v", s.name, err)
+		}
+	}
+	return c.loadTLSConfig()
+}
+
+// issueMemberCerts replaces the peer and server certificates of the members with certificates of the new CA.
+func (c *Cluster) issueMemberCerts() error {
+	ca, caKey, err := c.rotatedCA()
+	if err != nil {
+		return err
+	}
+	name, ns := c.cluster.Name, c.cluster.Namespace
+	subdomain := k8sutil.MemberSubdomain(name, c.cluster.Spec.Pod)
+	cert, key, err := etcdutil.NewSignedCert(ca, caKey, name+" peer", k8sutil.PeerCertHosts(subdomain, ns), certValidity)
+	if err != nil {
+		return err
+	}
+	err = k8sutil.UpdateSecretData(c.config.KubeCli, ns, c.cluster.Spec.TLS.Static.Member.PeerSecret,
+		map[string][]byte{k8sutil.PeerCertFile: cert, k8sutil.PeerKeyFile: key})
+	if err != nil {
+		return fmt.Errorf("failed to update the peer certificate: %v", err)
+	}
+	cert, key, err = etcdutil.NewSignedCert(ca, caKey, name+" server", k8sutil.ServerCertHosts(name, subdomain, ns), certValidity)
+	if err != nil {
+		return err
+	}
+	err = k8sutil.UpdateSecretData(c.config.KubeCli, ns, c.cluster.Spec.TLS.Static.Member.ServerSecret,
+		map[string][]byte{k8sutil.ServerCertFile: cert, k8sutil.ServerKeyFile: key})
+	if err != nil {
+		return fmt.Errorf("failed to update the server certificate: %v", err)
+	}
+	return nil
+}
+
+// issueOperatorCert replaces the client certificate of the operator with a certificate of the new CA.
+func (c *Cluster) issueOperatorCert() error {
+	ca, caKey, err := c.rotatedCA()
+	if err != nil {
+		return err
+	}
+	cert, key, err := etcdutil.NewSignedCert(ca, caKey, "etcd-operator", nil, certValidity)
+	if err != nil {
+		return err
+	}
+	err = k8sutil.UpdateSecretData(c.config.KubeCli, c.cluster.Namespace, c.cluster.Spec.TLS.Static.OperatorSecret,
+		map[string][]byte{etcdutil.CliCertFile: cert, etcdutil.CliKeyFile: key})
+	if err != nil {
+		return fmt.Errorf("failed to update the operator certificate: %v", err)
+	}
+	return c.loadTLSConfig()
+}
+
+// rotatedCA returns the certificate and key of the CA generated by the last CA rotation.
+func (c *Cluster) rotatedCA() (cert, key []byte, err error) {
+	s, err := c.config.KubeCli.CoreV1().Secrets(c.cluster.Namespace).Get(k8sutil.CASecretName(c.cluster.Name), metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the new CA: %v", err)
+	}
+	return s.Data[k8sutil.CACertFile], s.Data[k8sutil.CAKeyFile], nil
+}
+
+// rollMemberForCARotation replaces the member, so that its new pod mounts the current TLS secrets.
+// etcd only reads its trusted CAs on start.
+func (c *Cluster) rollMemberForCARotation(pods []*v1.Pod, name string) error {
+	m, ok := c.members[name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found in cluster membership", name)
+	}
+	if err := checkReplacementQuorum(pods, name, c.members.Size()); err != nil {
+		c.logger.Warningf("not rolling member for the CA rotation: %v", err)
+		return nil
+	}
+	c.logger.Infof("replacing member (%s) for the CA rotation (%s)", name, c.status.CARotation.Phase)
+	return c.removeMember(m)
+}
+
+func pickOnePodCreatedBefore(pods []*v1.Pod, t time.Time) *v1.Pod {
+	for _, pod := range pods {
+		if pod.CreationTimestamp.Time.Before(t) {
+			return pod
+		}
+	}
+	return nil
+}
+
+// loadTLSConfig loads the TLS config of the operator's etcd client from the operator secret.
+// The client is closed, so that it is recreated with the new config.
+func (c *Cluster) loadTLSConfig() error {
+	d, err := k8sutil.GetTLSDataFromSecret(c.config.KubeCli, c.cluster.Namespace, c.cluster.Spec.TLS.Static.OperatorSecret)
+	if err != nil {
+		return err
+	}
+	c.tlsConfig, err = etcdutil.NewTLSConfig(d.CertData, d.KeyData, d.CAData)
+	if err != nil {
+		return err
+	}
+	c.closeEtcdClient()
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/clientv3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// etcdClient returns the client the operator makes cluster-wide requests through,
+// connected to the voting members.
+func (c *Cluster) etcdClient() (*clientv3.Client, error) {
+	return c.etcdClientFor(votingClientURLs(c.members))
+}
+
+// etcdClientFor returns the client of the cluster, connected to the given client URLs.
+// The client is kept open across reconciliations: its endpoints are updated if they differ,
+// and it is only replaced once the client options in the spec change.
+func (c *Cluster) etcdClientFor(clientURLs []string) (*clientv3.Client, error) {
+	if len(clientURLs) == 0 {
+		return nil, errors.New("no member to connect to")
+	}
+	opts := c.clientOptions()
+	if c.etcdcli != nil && c.etcdcliOpts != opts {
+		c.closeEtcdClient()
+	}
+
+	if c.etcdcli == nil {
+		cfg := etcdutil.NewClientConfig(clientURLs, c.tlsConfig, opts)
+		// Closing the client is left to the run loop, but dialing stops once the cluster is deleted.
+		cfg.Context = c.ctx
+		etcdcli, err := clientv3.New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("creating etcd client failed: %v", err)
+		}
+		c.etcdcli, c.etcdcliOpts = etcdcli, opts
+		return etcdcli, nil
+	}
+
+	if !sameEndpoints(c.etcdcli.Endpoints(), clientURLs) {
+		c.etcdcli.SetEndpoints(clientURLs...)
+	}
+	return c.etcdcli, nil
+}
+
+// loadCredentials loads the etcd users of spec.auth from their secrets. The clients of the run loop and the workers
+// are recreated with them, as their client options change.
+func (c *Cluster) loadCredentials() error {
+	a := c.cluster.Spec.Auth
+	if a == nil {
+		c.membershipUser, c.probeUser = etcdutil.Credentials{}, etcdutil.Credentials{}
+		c.authSecretVersions = nil
+		return nil
+	}
+	membership, membershipVersion, err := k8sutil.GetCredentialsFromSecret(c.config.KubeCli, c.cluster.Namespace, a.MembershipSecret)
+	if err != nil {
+		return fmt.Errorf("failed to load membership user: %v", err)
+	}
+	probe, probeVersion, err := k8sutil.GetCredentialsFromSecret(c.config.KubeCli, c.cluster.Namespace, a.ProbeSecret)
+	if err != nil {
+		return fmt.Errorf("failed to load probe user: %v", err)
+	}
+	c.membershipUser, c.probeUser = membership, probe
+	c.authSecretVersions = map[string]string{
+		a.MembershipSecret: membershipVersion,
+		a.ProbeSecret:      probeVersion,
+	}
+	return nil
+}
+
+// reloadCredentialsIfRotated reloads the etcd users of spec.auth once the resourceVersion of either of their secrets
+// changed since they were loaded, so that a rotated password is picked up without changing the spec.
+func (c *Cluster) reloadCredentialsIfRotated() error {
+	a := c.cluster.Spec.Auth
+	if a == nil {
+		return nil
+	}
+	for _, name := range []string{a.MembershipSecret, a.ProbeSecret} {
+		secret, err := c.config.KubeCli.CoreV1().Secrets(c.cluster.Namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get secret (%s): %v", name, err)
+		}
+		if secret.ResourceVersion != c.authSecretVersions[name] {
+			c.logger.Infof("secret (%s) of spec.auth changed, reloading the etcd users", name)
+			return c.loadCredentials()
+		}
+	}
+	return nil
+}
+
+// probeClientOptions returns the client options of the workers. Unlike the run loop, which manages the members,
+// they authenticate as the probe user of spec.auth.
+func (c *Cluster) probeClientOptions() etcdutil.ClientOptions {
+	opts := c.clientOptions()
+	opts.Credentials = c.probeUser
+	return opts
+}
+
+// closeEtcdClient closes the client of the cluster, if any.
+func (c *Cluster) closeEtcdClient() {
+	if c.etcdcli == nil {
+		return
+	}
+	c.etcdcli.Close()
+	c.etcdcli = nil
+}
+
+func sameEndpoints(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
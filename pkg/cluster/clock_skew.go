@@ -0,0 +1,90 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+const (
+	// clockSkewCheckInterval is the time between two clock skew checks of the health worker.
+	clockSkewCheckInterval = time.Minute
+	// maxClockSkew is the clock skew between the operator and a member past which the operator warns.
+	// The estimate of the skew is only good to about a second.
+	maxClockSkew = 5 * time.Second
+)
+
+// checkClockSkew records the clock skews of the members checked by the health worker, and warns with an event
+// once the clock of a member is off from the clock of the operator by more than maxClockSkew.
+// Skew breaks what compares times across machines, e.g. the validity of the certificates the operator issues.
+func (c *Cluster) checkClockSkew(skews map[string]time.Duration) {
+	if skews == nil {
+		return
+	}
+	c.clockSkews = skews
+	name, skew := worstClockSkew(skews)
+	maxClockSkewSeconds.WithLabelValues(c.cluster.Namespace, c.cluster.Name).Set(skew.Seconds())
+
+	skewed := abs(skew) > maxClockSkew
+	switch {
+	case skewed && !c.clockSkewed:
+		c.logger.Warningf("clock of member (%s) is off from the clock of the operator by %v", name, skew)
+		if _, err := c.eventsCli.Create(k8sutil.ClockSkewEvent(name, skew, c.cluster)); err != nil {
+			c.logger.Errorf("failed to create clock skew event: %v", err)
+		}
+	case !skewed && c.clockSkewed:
+		c.logger.Infof("clocks of the members are within %v of the clock of the operator again", maxClockSkew)
+	}
+	c.clockSkewed = skewed
+}
+
+// memberClockBehind returns a member whose clock is behind the clock of the operator by more than d, if any.
+func (c *Cluster) memberClockBehind(d time.Duration) (string, time.Duration) {
+	names := make([]string, 0, len(c.clockSkews))
+	for name := range c.clockSkews {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if skew := c.clockSkews[name]; skew < -d {
+			return name, skew
+		}
+	}
+	return "", 0
+}
+
+// worstClockSkew returns the member whose clock is the furthest off, and its skew.
+func worstClockSkew(skews map[string]time.Duration) (string, time.Duration) {
+	var (
+		worst string
+		max   time.Duration
+	)
+	for name, skew := range skews {
+		if abs(skew) > abs(max) || (abs(skew) == abs(max) && (len(worst) == 0 || name < worst)) {
+			worst, max = name, skew
+		}
+	}
+	return worst, max
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
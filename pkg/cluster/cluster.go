@@ -15,21 +15,26 @@
 package cluster
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"math"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+	"github.com/coreos/etcd-operator/version"
 
-	"github.com/pborman/uuid"
+	"github.com/coreos/etcd/clientv3"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -47,11 +52,21 @@ type clusterEventType string
 
 const (
 	eventModifyCluster clusterEventType = "Modify"
+	eventPlan          clusterEventType = "Plan"
+	eventState         clusterEventType = "State"
+	eventRenderPod     clusterEventType = "RenderPod"
 )
 
 type clusterEvent struct {
 	typ     clusterEventType
 	cluster *api.EtcdCluster
+	// planCh receives the plan of an eventPlan.
+	planCh chan<- planReply
+	// stateCh receives the state of an eventState.
+	stateCh chan<- stateReply
+	// member is the member whose pod an eventRenderPod renders, and podCh receives the pod.
+	member string
+	podCh  chan<- podReply
 }
 
 type Config struct {
@@ -59,6 +74,20 @@ type Config struct {
 
 	KubeCli   kubernetes.Interface
 	EtcdCRCli versioned.Interface
+	// Notifier is told about the cluster failing to be created, losing quorum or failing.
+	Notifier *notifyutil.Notifier
+	// Hooks are told about the cluster being created and its members being replaced.
+	Hooks notifyutil.Hooks
+	// Pods lists the pods of the cluster. If nil, the pods are listed from the API server.
+	Pods PodLister
+	// Timeouts are the timeouts of the operations on the members the clusters do not override.
+	Timeouts Timeouts
+}
+
+// PodLister lists the pods of a cluster, e.g. from a cache shared by all the clusters.
+// The pods returned may be modified.
+type PodLister interface {
+	ClusterPods(ns, clusterName string) ([]*v1.Pod, error)
 }
 
 type Cluster struct {
@@ -73,7 +102,10 @@ type Cluster struct {
 	status api.ClusterStatus
 
 	eventCh chan *clusterEvent
-	stopCh  chan struct{}
+	// ctx is the root context of the cluster, cancelled once the cluster is deleted.
+	// The requests to the members are derived from it, so that none outlives the cluster.
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	// members repsersents the members in the etcd cluster.
 	// the name of the member is the the name of the pod the member
@@ -81,6 +113,80 @@ type Cluster struct {
 	members etcdutil.MemberSet
 
 	tlsConfig *tls.Config
+	// membershipUser and probeUser are the etcd users of spec.auth the run loop and the workers authenticate as.
+	// They are empty unless spec.auth is set.
+	membershipUser etcdutil.Credentials
+	probeUser      etcdutil.Credentials
+	// authSecretVersions are the resourceVersions of the secrets of spec.auth the users were loaded from, by name.
+	authSecretVersions map[string]string
+
+	// etcdVersion is the lowest etcd minor version run by the members.
+	// It gates the use of version specific etcd features.
+	etcdVersion etcdutil.MinorVersion
+	// podVersions is the etcd version annotations of the pods etcdVersion was detected from.
+	podVersions string
+
+	// lastCompaction is the time the operator last tried to compact the cluster history.
+	lastCompaction time.Time
+	// lastDefrag is the time the operator last tried to defragment the members.
+	lastDefrag time.Time
+	// lastResourceUsage is the time the operator last collected the resource usage of the members.
+	lastResourceUsage time.Time
+	// learnerSince is the time each learner member, by name, was first seen unpromoted.
+	learnerSince map[string]time.Time
+	// memberLogLevels is the log level, by member name, set at runtime from the pod's log level annotation.
+	memberLogLevels map[string]string
+	// replacements are the times members were replaced within the repair budget window.
+	replacements []time.Time
+	// lastAlertCheck is the time of the scrape of the metrics worker the thresholds of spec.alerts were last checked against.
+	lastAlertCheck time.Time
+	// leaderChangeTimes are the times of the leader changes seen within the last hour.
+	leaderChangeTimes []time.Time
+	// walFsyncHistograms is the WAL fsync histogram, by member name, read at the last alert check.
+	walFsyncHistograms map[string]*etcdutil.Histogram
+	// appliedAlertRules is the JSON of the PrometheusRule rules last applied, empty if none was.
+	appliedAlertRules string
+	// refusedNodes are the nodes the disk preflight found too slow for members.
+	refusedNodes map[string]bool
+	// memberFailures is the cause of failure, by member name, found in the log of the failed members.
+	memberFailures map[string]memberFailure
+	// restarting are the members, by name, whose pods were deleted to be recreated in place on request.
+	restarting map[string]restartingMember
+	// handsOff are the members, by name, whose pods are annotated hands-off as of the last poll of the pods.
+	handsOff map[string]bool
+	// actions are the last actions on the cluster, oldest first, for its failure report.
+	actions []api.ClusterAction
+	// podCreationFailure is the message of the PodCreationFailed condition last reported, empty if none is.
+	podCreationFailure string
+	// pendingReplacements is the number of members removed to be replaced, whose replacements are not added yet.
+	pendingReplacements int
+	// clockSkews is how far the clock of the members, by name, is ahead of the clock of the operator,
+	// and clockSkewed whether one is off by more than maxClockSkew.
+	clockSkews  map[string]time.Duration
+	clockSkewed bool
+	// keySpace is the last sample of the key space of the health worker and its growth, nil until the first sample.
+	keySpace *keySpaceGrowth
+	// lostQuorum tells whether the last reconcile found the cluster without quorum,
+	// so that losing quorum is only notified once.
+	lostQuorum bool
+	// expiryWarned tells whether the warning event of the expiry of a cluster with spec.ttlInSecond was created.
+	expiryWarned bool
+	// ready is 1 if the cluster was ready at the last probe of the health worker. It is read outside of the run loop.
+	ready int32
+	// opLock is the operation lock, which guards the state the run loop shares with the workers
+	// of the non-disruptive operations: the opView it publishes, and the last probe and scrape of the workers.
+	opLock sync.Mutex
+	opView *opView
+	probe  healthProbe
+	scrape metricsScrape
+	// statusBumpsGeneration tells whether the API server increments metadata.generation on status updates,
+	// as it does since Kubernetes 1.11 for custom resources without the status subresource.
+	statusBumpsGeneration bool
+
+	// etcdcli is the client of the cluster, created with the client options etcdcliOpts.
+	// It is only used in the run loop.
+	etcdcli     *clientv3.Client
+	etcdcliOpts etcdutil.ClientOptions
 
 	eventsCli corev1.EventInterface
 }
@@ -88,28 +194,43 @@ type Cluster struct {
 func New(config Config, cl *api.EtcdCluster) *Cluster {
 	lg := logrus.WithField("pkg", "cluster").WithField("cluster-name", cl.Name)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &Cluster{
 		logger:    lg,
 		config:    config,
 		cluster:   cl,
 		eventCh:   make(chan *clusterEvent, 100),
-		stopCh:    make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
 		status:    *(cl.Status.DeepCopy()),
 		eventsCli: config.KubeCli.Core().Events(cl.Namespace),
+
+		learnerSince:    make(map[string]time.Time),
+		memberLogLevels: make(map[string]string),
+		refusedNodes:    make(map[string]bool),
+		memberFailures:  make(map[string]memberFailure),
+		restarting:      make(map[string]restartingMember),
 	}
+	c.status.OperatorVersion = version.Version
+	c.status.SchemaVersion = api.SchemaVersion
 
 	go func() {
 		if err := c.setup(); err != nil {
 			c.logger.Errorf("cluster failed to setup: %v", err)
-			if c.status.Phase != api.ClusterPhaseFailed {
+			if c.status.Phase != api.ClusterPhaseFailed && c.ctx.Err() == nil {
+				c.config.Notifier.Notify("etcd cluster %s/%s failed to be created: %v", cl.Namespace, cl.Name, err)
 				c.status.SetReason(err.Error())
-				c.status.SetPhase(api.ClusterPhaseFailed)
+				c.transition(api.ClusterPhaseFailed)
 				if err := c.updateCRStatus(); err != nil {
 					c.logger.Errorf("failed to update cluster phase (%v): %v", api.ClusterPhaseFailed, err)
 				}
 			}
 			return
 		}
+		if c.ctx.Err() != nil {
+			c.logger.Info("cluster is deleted before it runs")
+			return
+		}
 		c.run()
 	}()
 
@@ -120,35 +241,50 @@ func (c *Cluster) setup() error {
 	var shouldCreateCluster bool
 	switch c.status.Phase {
 	case api.ClusterPhaseNone:
+		c.transition(api.ClusterPhasePending)
+		if err := c.updateCRStatus(); err != nil {
+			return fmt.Errorf("cluster setup: failed to update cluster phase (%v): %v", api.ClusterPhasePending, err)
+		}
+		shouldCreateCluster = true
+	case api.ClusterPhasePending:
+		// Nothing is created before the cluster leaves Pending.
 		shouldCreateCluster = true
 	case api.ClusterPhaseCreating:
 		return errCreatedCluster
-	case api.ClusterPhaseRunning:
+	case api.ClusterPhaseRunning, api.ClusterPhaseResizing, api.ClusterPhaseUpgrading, api.ClusterPhaseRecovering, api.ClusterPhaseDeleting:
 		shouldCreateCluster = false
 
 	default:
 		return fmt.Errorf("unexpected cluster phase: %s", c.status.Phase)
 	}
 
-	if c.isSecureClient() {
-		d, err := k8sutil.GetTLSDataFromSecret(c.config.KubeCli, c.cluster.Namespace, c.cluster.Spec.TLS.Static.OperatorSecret)
-		if err != nil {
+	if shouldCreateCluster {
+		if err := c.waitForDependencies(); err != nil {
 			return err
 		}
-		c.tlsConfig, err = etcdutil.NewTLSConfig(d.CertData, d.KeyData, d.CAData)
-		if err != nil {
+	}
+
+	if c.isSecureClient() {
+		if err := c.loadTLSConfig(); err != nil {
 			return err
 		}
 	}
+	if err := c.loadCredentials(); err != nil {
+		return err
+	}
 
 	if shouldCreateCluster {
+		if err := k8sutil.CheckTLSSecrets(c.config.KubeCli, c.cluster.Namespace, c.cluster.Spec.TLS); err != nil {
+			return err
+		}
 		return c.create()
 	}
 	return nil
 }
 
 func (c *Cluster) create() error {
-	c.status.SetPhase(api.ClusterPhaseCreating)
+	c.transition(api.ClusterPhaseCreating)
+	c.status.BootstrapStartTime = time.Now().Format(time.RFC3339)
 
 	if err := c.updateCRStatus(); err != nil {
 		return fmt.Errorf("cluster create: failed to update cluster phase (%v): %v", api.ClusterPhaseCreating, err)
@@ -160,8 +296,16 @@ func (c *Cluster) create() error {
 
 func (c *Cluster) prepareSeedMember() error {
 	c.status.SetScalingUpCondition(0, c.cluster.Spec.Size)
+	// The seed member bootstraps a new etcd cluster, with a new ID.
+	c.status.ClusterID = ""
+
+	pods, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	c.fenceStalePods(pods)
 
-	err := c.bootstrap()
+	err = c.bootstrap()
 	if err != nil {
 		return err
 	}
@@ -172,7 +316,7 @@ func (c *Cluster) prepareSeedMember() error {
 
 func (c *Cluster) Delete() {
 	c.logger.Info("cluster is deleted by user")
-	close(c.stopCh)
+	c.cancel()
 }
 
 func (c *Cluster) send(ev *clusterEvent) {
@@ -182,45 +326,92 @@ func (c *Cluster) send(ev *clusterEvent) {
 		if l > int(float64(ecap)*0.8) {
 			c.logger.Warningf("eventCh buffer is almost full [%d/%d]", l, ecap)
 		}
-	case <-c.stopCh:
+	case <-c.ctx.Done():
 	}
 }
 
 func (c *Cluster) run() {
-	if err := c.setupServices(); err != nil {
+	if _, err := c.reconcileServices(); err != nil {
 		c.logger.Errorf("fail to setup etcd services: %v", err)
 	}
 	c.status.ServiceName = k8sutil.ClientServiceName(c.cluster.Name)
-	c.status.ClientPort = k8sutil.EtcdClientPort
+	c.status.ClientPort = c.cluster.Spec.ClientPort
 
-	c.status.SetPhase(api.ClusterPhaseRunning)
+	if isDeleting(c.cluster) {
+		// The cluster was deleted while the operator was not running, e.g. held by its deletion policy.
+		c.transition(api.ClusterPhaseDeleting)
+	} else if c.status.Phase != api.ClusterPhaseDeleting {
+		c.transition(api.ClusterPhaseRunning)
+	}
 	if err := c.updateCRStatus(); err != nil {
 		c.logger.Warningf("update initial CR status failed: %v", err)
 	}
 	c.logger.Infof("start running...")
+	defer c.closeEtcdClient()
+	c.startWorkers()
 
+	timer := newReconcileTimer(nextReconcileDelay(c.status.ReconcileFailures, k8sutil.APIHealth.Degraded()))
+	defer timer.stop()
 	var rerr error
 	for {
+		timer.rearm(nextReconcileDelay(c.status.ReconcileFailures, k8sutil.APIHealth.Degraded()))
+		// reconciled tells whether this iteration reached the reconciliation of the members.
+		reconciled := false
 		select {
-		case <-c.stopCh:
+		case <-c.ctx.Done():
+			c.transition(api.ClusterPhaseDeleted)
+			c.deleteResourceUsageMetrics()
+			c.opLock.Lock()
+			c.deleteHealthMetrics()
+			c.opLock.Unlock()
+			c.deleteAlertMetrics()
+			c.deleteKeySpaceMetrics()
+			c.deleteMemberMetrics()
 			return
 		case event := <-c.eventCh:
 			switch event.typ {
 			case eventModifyCluster:
-				err := c.handleUpdateEvent(event)
+				changed, err := c.handleUpdateEvent(event)
 				if err != nil {
 					c.logger.Errorf("handle update event failed: %v", err)
 					c.status.SetReason(err.Error())
 					c.reportFailedStatus()
 					return
 				}
+				if changed {
+					timer.now()
+				}
+			case eventPlan:
+				p, err := c.plan()
+				event.planCh <- planReply{plan: p, err: err}
+			case eventState:
+				st, err := c.state()
+				event.stateCh <- stateReply{state: st, err: err}
+			case eventRenderPod:
+				pod, err := c.renderPod(event.member)
+				event.podCh <- podReply{pod: pod, err: err}
 			default:
 				panic("unknown event type" + event.typ)
 			}
 
-		case <-time.After(reconcileInterval):
+		case <-timer.C():
+			timer.fire()
 			start := time.Now()
 
+			if c.status.Phase == api.ClusterPhaseDeleting {
+				c.logger.Infof("cluster is being deleted, skipping reconciliation")
+				if err := c.tearDown(); err != nil {
+					c.logger.Errorf("failed to tear down the cluster: %v", err)
+				}
+				continue
+			}
+			if err := c.syncDeletionFinalizer(); err != nil {
+				c.logger.Warningf("failed to update the finalizers of the cluster: %v", err)
+			}
+			if c.expireIfDue() {
+				continue
+			}
+
 			if c.cluster.Spec.Paused {
 				c.status.PauseControl()
 				c.logger.Infof("control is paused, skipping reconciliation")
@@ -228,40 +419,158 @@ func (c *Cluster) run() {
 			} else {
 				c.status.Control()
 			}
+			if err := c.reloadCredentialsIfRotated(); err != nil {
+				c.logger.Warningf("failed to reload the etcd users of spec.auth: %v", err)
+			}
+			if waiting, err := c.syncStandby(); err != nil {
+				c.logger.Warningf("failed to sync standby: %v", err)
+			} else if waiting {
+				c.logger.Infof("skip reconciliation: standby is being restored or promoted")
+				continue
+			}
 
-			running, pending, err := c.pollPods()
+			running, pending, leaving, err := c.pollPods()
 			if err != nil {
 				c.logger.Errorf("fail to poll pods: %v", err)
 				reconcileFailed.WithLabelValues("failed to poll pods").Inc()
 				continue
 			}
+			c.syncHandsOff(running, pending, leaving)
+			c.updateMemberCountMetrics(len(running))
+			c.updateReadiness(running)
+			if c.awaitingIntervention(running) {
+				reconcileFailed.WithLabelValues("intervention required").Inc()
+				continue
+			}
+			if c.requireInterventionForClusterID(running) {
+				reconcileFailed.WithLabelValues("intervention required").Inc()
+				continue
+			}
+			c.forceDeleteStuckPods(leaving)
+			recreated, err := c.checkBootstrap(running, pending)
+			if isFatalError(err) {
+				c.status.SetReason(err.Error())
+				c.logger.Errorf("cluster failed: %v", err)
+				c.reportFailedStatus()
+				return
+			}
+			if err != nil {
+				c.logger.Errorf("failed to recreate cluster after bootstrap timeout: %v", err)
+				continue
+			}
+			if recreated {
+				continue
+			}
+			if err := c.moveLeaderOffDrainingNode(); err != nil {
+				c.logger.Warningf("failed to move leadership off draining node: %v", err)
+			}
 
 			if len(pending) > 0 {
+				if failures := imagePullFailures(pending); len(failures) != 0 {
+					c.reportPodCreationFailure(strings.Join(failures, "; "))
+				}
+				c.replaceMembersOnLostVolumes(pending)
 				// Pod startup might take long, e.g. pulling image. It would deterministically become running or succeeded/failed later.
 				c.logger.Infof("skip reconciliation: running (%v), pending (%v)", k8sutil.GetPodNames(running), k8sutil.GetPodNames(pending))
 				reconcileFailed.WithLabelValues("not all pods are running").Inc()
 				continue
 			}
+			if len(running) == 0 && len(leaving) > 0 {
+				// The members may still run until their pods are gone: the cluster is not known to be lost yet.
+				c.logger.Infof("skip reconciliation: all etcd pods are being deleted: %v", k8sutil.GetPodNames(leaving))
+				reconcileFailed.WithLabelValues("all pods are leaving").Inc()
+				continue
+			}
 			if len(running) == 0 {
 				// TODO: how to handle this case?
 				c.logger.Warningf("all etcd pods are dead.")
+				if !c.lostQuorum {
+					c.config.Notifier.Notify("etcd cluster %s/%s lost quorum: all members are dead", c.cluster.Namespace, c.cluster.Name)
+				}
+				c.setLostQuorum(true)
+				if restoring, err := c.restoreFromBackupIfAllowed(c.hasMemberVolumes()); err != nil {
+					c.logger.Errorf("failed to restore cluster from backup: %v", err)
+				} else if !restoring {
+					if recreated, err := c.recreateEmptyIfAllowed(); err != nil {
+						c.logger.Errorf("failed to recreate empty cluster: %v", err)
+					} else if !recreated {
+						c.requireInterventionForLostQuorum(0)
+					}
+				}
+				break
+			}
+
+			if c.requireInterventionForCorruption(running) {
 				break
 			}
 
+			reconciled = true
 			// On controller restore, we could have "members == nil"
 			if rerr != nil || c.members == nil {
-				rerr = c.updateMembers(podsToMemberSet(running, c.isSecureClient()))
+				rerr = c.updateMembers(podsToMemberSet(running, c.cluster.Spec))
 				if rerr != nil {
 					c.logger.Errorf("failed to update members: %v", rerr)
 					break
 				}
 			}
-			rerr = c.reconcile(running)
+			rerr = c.reconcile(running, leaving)
+			if rerr == ErrLostQuorum && !c.lostQuorum {
+				c.config.Notifier.Notify("etcd cluster %s/%s lost quorum: %d of %d members are running",
+					c.cluster.Namespace, c.cluster.Name, len(running), c.members.Size())
+			}
+			c.setLostQuorum(rerr == ErrLostQuorum)
+			if c.lostQuorum {
+				if restoring, err := c.restoreFromBackupIfAllowed(true); err != nil {
+					c.logger.Errorf("failed to restore cluster from backup: %v", err)
+				} else if !restoring {
+					c.requireInterventionForLostQuorum(len(running))
+				}
+			}
 			if rerr != nil {
 				c.logger.Errorf("failed to reconcile: %v", rerr)
+				if isPermanentCreateError(rerr) {
+					c.reportPodCreationFailure(rerr.Error())
+				}
 				break
 			}
-			c.updateMemberStatus(running)
+			c.clearPodCreationFailure()
+			if err := c.detectEtcdVersion(running); err != nil {
+				c.logger.Warningf("failed to detect etcd version: %v", err)
+			}
+			c.applyMemberLogLevels(running)
+			if err := c.checkVersionConvergence(running); err != nil {
+				c.logger.Warningf("failed to check version convergence: %v", err)
+			}
+			if err := c.reconcileLearners(); err != nil {
+				c.logger.Warningf("failed to reconcile learners: %v", err)
+			}
+			if err := c.compactIfDue(); err != nil {
+				c.logger.Warningf("failed to compact history: %v", err)
+			}
+			if err := c.defragIfDue(); err != nil {
+				c.logger.Warningf("failed to defragment members: %v", err)
+			}
+			if err := c.runRequestedMaintenance(); err != nil {
+				c.logger.Warningf("failed to run requested maintenance: %v", err)
+			}
+			if err := c.repairServices(); err != nil {
+				c.logger.Warningf("failed to repair services: %v", err)
+			}
+			if err := c.publishConnectionInfo(running); err != nil {
+				c.logger.Warningf("failed to publish connection info: %v", err)
+			}
+			c.updateMemberStatus(running, leaving)
+			c.diagnoseCrashLoopingMembers(running)
+			if err := c.updateResourceUsageIfDue(running); err != nil {
+				c.logger.Warningf("failed to update resource usage: %v", err)
+			}
+			if err := c.updateLastBackupTime(); err != nil {
+				c.logger.Warningf("failed to update last backup time: %v", err)
+			}
+			if err := c.checkAlertsIfDue(); err != nil {
+				c.logger.Warningf("failed to check alert thresholds: %v", err)
+			}
+			c.status.ObservedGeneration = c.cluster.Generation
 			if err := c.updateCRStatus(); err != nil {
 				c.logger.Warningf("periodic update CR status failed: %v", err)
 			}
@@ -272,6 +581,11 @@ func (c *Cluster) run() {
 		if rerr != nil {
 			reconcileFailed.WithLabelValues(rerr.Error()).Inc()
 		}
+		if reconciled {
+			if err := c.trackReconcileResult(rerr); err != nil {
+				rerr = err
+			}
+		}
 
 		if isFatalError(rerr) {
 			c.status.SetReason(rerr.Error())
@@ -282,21 +596,75 @@ func (c *Cluster) run() {
 	}
 }
 
-func (c *Cluster) handleUpdateEvent(event *clusterEvent) error {
+// handleUpdateEvent adopts the updated cluster and applies the change of its spec, see applySpecChanges.
+// It returns true if the cluster is to be reconciled right away: a field the members follow changed, or it is being deleted.
+func (c *Cluster) handleUpdateEvent(event *clusterEvent) (bool, error) {
 	oldSpec := c.cluster.Spec.DeepCopy()
 	c.cluster = event.cluster
+	if isDeleting(event.cluster) && c.status.Phase != api.ClusterPhaseDeleting {
+		// Reconciling would recreate the members the garbage collector deletes.
+		c.transition(api.ClusterPhaseDeleting)
+		if err := c.updateCRStatus(); err != nil {
+			c.logger.Warningf("failed to update cluster phase (%v): %v", api.ClusterPhaseDeleting, err)
+		}
+		return true, nil
+	}
+	if !reflect.DeepEqual(event.cluster.Spec.TLS, oldSpec.TLS) {
+		// The member URLs and the operator's etcd client follow the TLS policy the cluster was created with.
+		// Switching schemes is not supported on a running cluster.
+		c.logger.Warningf("ignoring change of spec.TLS: the TLS policy of a running cluster cannot be changed")
+		c.cluster.Spec.TLS = oldSpec.TLS
+	}
+	if event.cluster.Spec.ClientPort != oldSpec.ClientPort || event.cluster.Spec.PeerPort != oldSpec.PeerPort {
+		c.logger.Warningf("ignoring change of spec.clientPort or spec.peerPort: the ports of a running cluster cannot be changed")
+		c.cluster.Spec.ClientPort, c.cluster.Spec.PeerPort = oldSpec.ClientPort, oldSpec.PeerPort
+	}
+	if event.cluster.Spec.StandbyOf != oldSpec.StandbyOf {
+		if len(event.cluster.Spec.StandbyOf) != 0 {
+			// The data of the cluster would be replaced with the one of the primary.
+			c.logger.Warningf("ignoring change of spec.standbyOf: a running cluster cannot become a standby")
+			c.cluster.Spec.StandbyOf = oldSpec.StandbyOf
+		} else {
+			c.promoteStandby(oldSpec.StandbyOf)
+		}
+	}
+	if !reflect.DeepEqual(event.cluster.Spec.Auth, oldSpec.Auth) {
+		if err := c.loadCredentials(); err != nil {
+			c.logger.Errorf("failed to load the etcd users of spec.auth: %v", err)
+		}
+	}
+	if k8sutil.MemberSubdomain(c.cluster.Name, event.cluster.Spec.Pod) != k8sutil.MemberSubdomain(c.cluster.Name, oldSpec.Pod) {
+		// The names of the members, and so their URLs, start with the subdomain they were added with.
+		c.logger.Warningf("ignoring change of spec.pod.subdomain: the subdomain of a running cluster cannot be changed")
+		if c.cluster.Spec.Pod == nil {
+			c.cluster.Spec.Pod = &api.PodPolicy{}
+		}
+		c.cluster.Spec.Pod.Subdomain = k8sutil.MemberSubdomain(c.cluster.Name, oldSpec.Pod)
+	}
 
+	reconcile := false
+	if fields := changedSpecFields(*oldSpec, c.cluster.Spec); len(fields) != 0 && c.status.Phase != api.ClusterPhaseDeleting {
+		reconcile = c.applySpecChanges(fields)
+	}
+	if steps := shrinkSteps(c.members.Size(), c.cluster.Spec.Size); c.cluster.Spec.Size < oldSpec.Size && len(steps) > 2 {
+		// Shrinking in one step, e.g. from 5 to 1 member, would go through sizes that tolerate no failure with
+		// unready members. The new size is reached step by step instead.
+		c.logger.Infof("shrinking through the sizes %v", steps)
+		if _, err := c.eventsCli.Create(k8sutil.ShrinkingStepwiseEvent(steps, c.cluster)); err != nil {
+			c.logger.Errorf("failed to create shrinking stepwise event: %v", err)
+		}
+	}
 	if isSpecEqual(event.cluster.Spec, *oldSpec) {
 		// We have some fields that once created could not be mutated.
 		if !reflect.DeepEqual(event.cluster.Spec, *oldSpec) {
 			c.logger.Infof("ignoring update event: %#v", event.cluster.Spec)
 		}
-		return nil
+		return reconcile, nil
 	}
 	// TODO: we can't handle another upgrade while an upgrade is in progress
 
 	c.logSpecUpdate(*oldSpec, event.cluster.Spec)
-	return nil
+	return reconcile, nil
 }
 
 func isSpecEqual(s1, s2 api.ClusterSpec) bool {
@@ -307,14 +675,12 @@ func isSpecEqual(s1, s2 api.ClusterSpec) bool {
 }
 
 func (c *Cluster) startSeedMember() error {
-	m := &etcdutil.Member{
-		Name:         k8sutil.UniqueMemberName(c.cluster.Name),
-		Namespace:    c.cluster.Namespace,
-		SecurePeer:   c.isSecurePeer(),
-		SecureClient: c.isSecureClient(),
-	}
+	m := c.newMember()
 	ms := etcdutil.NewMemberSet(m)
-	if err := c.createPod(ms, m, "new"); err != nil {
+	if err := c.createPod(ms, m, "new", "", api.MemberCreationInitial); err != nil {
+		if isPermanentCreateError(err) {
+			c.reportPodCreationFailure(err.Error())
+		}
 		return fmt.Errorf("failed to create seed member (%s): %v", m.Name, err)
 	}
 	c.members = ms
@@ -335,6 +701,24 @@ func (c *Cluster) isSecureClient() bool {
 	return c.cluster.Spec.TLS.IsSecureClient()
 }
 
+// clientOptions matches the operator's etcd client connections to the member settings in spec.etcd.
+func (c *Cluster) clientOptions() etcdutil.ClientOptions {
+	opts := etcdutil.ClientOptions{Credentials: c.membershipUser}
+	p := c.cluster.Spec.Etcd
+	if p == nil {
+		return opts
+	}
+	opts.MaxCallSendMsgSize = int(p.MaxRequestBytes)
+	opts.DialKeepAliveTime = time.Duration(p.GRPCKeepAliveIntervalInSecond) * time.Second
+	opts.DialKeepAliveTimeout = time.Duration(p.GRPCKeepAliveTimeoutInSecond) * time.Second
+	// Members close connections that ping more often than the keepalive min time.
+	minTime := time.Duration(p.GRPCKeepAliveMinTimeInSecond) * time.Second
+	if opts.DialKeepAliveTime > 0 && opts.DialKeepAliveTime < minTime {
+		opts.DialKeepAliveTime = minTime
+	}
+	return opts
+}
+
 // bootstrap creates the seed etcd member for a new cluster.
 func (c *Cluster) bootstrap() error {
 	return c.startSeedMember()
@@ -347,13 +731,38 @@ func (c *Cluster) Update(cl *api.EtcdCluster) {
 	})
 }
 
-func (c *Cluster) setupServices() error {
-	err := k8sutil.CreateClientService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
+// reconcileServices creates the client and peer services of the cluster, and recreates or repairs them
+// if they were deleted or changed since. It returns the names of the services it created or repaired.
+func (c *Cluster) reconcileServices() ([]string, error) {
+	var applied []string
+	labels := k8sutil.PropagatedLabels(c.cluster)
+	changed, err := k8sutil.ApplyClientService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.Spec.ClientPort, c.cluster.AsOwner(), labels)
 	if err != nil {
-		return err
+		return applied, err
+	}
+	if changed {
+		applied = append(applied, k8sutil.ClientServiceName(c.cluster.Name))
 	}
 
-	return k8sutil.CreatePeerService(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
+	subdomain := k8sutil.MemberSubdomain(c.cluster.Name, c.cluster.Spec.Pod)
+	changed, err = k8sutil.ApplyPeerService(c.config.KubeCli, c.cluster.Name, subdomain, c.cluster.Namespace, c.cluster.Spec.ClientPort, c.cluster.Spec.PeerPort, c.cluster.AsOwner(), labels)
+	if changed {
+		applied = append(applied, subdomain)
+	}
+	return applied, err
+}
+
+// repairServices reconciles the services of a running cluster and records the repairs.
+func (c *Cluster) repairServices() error {
+	repaired, err := c.reconcileServices()
+	for _, name := range repaired {
+		c.logger.Warningf("repaired service (%s), which was deleted or changed", name)
+		_, err := c.eventsCli.Create(k8sutil.ServiceRepairedEvent(name, c.cluster))
+		if err != nil {
+			c.logger.Errorf("failed to create service repaired event: %v", err)
+		}
+	}
+	return err
 }
 
 func (c *Cluster) isPodPVEnabled() bool {
@@ -363,25 +772,95 @@ func (c *Cluster) isPodPVEnabled() bool {
 	return false
 }
 
-func (c *Cluster) createPod(members etcdutil.MemberSet, m *etcdutil.Member, state string) error {
-	pod := k8sutil.NewEtcdPod(m, members.PeerURLPairs(), c.cluster.Name, state, uuid.New(), c.cluster.Spec, c.cluster.AsOwner())
+// createPod creates the pod of the member, created for the given reason, and its PVCs. If node is not empty,
+// the pod must run on that node; it is kept off the nodes refused by the disk preflight in any case.
+// The member gets the next member generation of the cluster.
+func (c *Cluster) createPod(members etcdutil.MemberSet, m *etcdutil.Member, state, node string, reason api.MemberCreationReason) error {
+	generation := c.status.MemberGeneration + 1
+	if err := c.createMemberPod(members, m, state, node, generation, reason, false); err != nil {
+		return err
+	}
+	c.status.MemberGeneration = generation
+	if c.status.MemberCreations == nil {
+		c.status.MemberCreations = map[api.MemberCreationReason]int64{}
+	}
+	c.status.MemberCreations[reason]++
+	membersCreated.WithLabelValues(c.cluster.Namespace, c.cluster.Name, string(reason)).Inc()
+	return nil
+}
+
+// createMemberPod creates the pod of the member with the given member generation and creation reason.
+// The pod of a restarted member claims the PVCs of its previous pod, which are not created again.
+func (c *Cluster) createMemberPod(members etcdutil.MemberSet, m *etcdutil.Member, state, node string, generation int64, reason api.MemberCreationReason, restarted bool) error {
+	pod, pvcs, err := c.newMemberPod(members, m, state, node, generation, reason)
+	if err != nil {
+		return err
+	}
+	if !restarted {
+		for _, pvc := range pvcs {
+			err := c.createObject("PVC "+pvc.Name, func() error {
+				_, err := c.config.KubeCli.CoreV1().PersistentVolumeClaims(c.cluster.Namespace).Create(pvc)
+				return err
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to create PVC (%s) for member (%s)", pvc.Name, m.Name)
+			}
+		}
+	}
+	return c.createObject("pod "+pod.Name, func() error {
+		_, err := k8sutil.CreatePod(c.config.KubeCli, c.cluster.Namespace, pod)
+		return err
+	})
+}
+
+// newMemberPod renders the pod of the member and the PVCs it claims, as the spec of the cluster makes them,
+// without creating anything.
+func (c *Cluster) newMemberPod(members etcdutil.MemberSet, m *etcdutil.Member, state, node string, generation int64, reason api.MemberCreationReason) (*v1.Pod, []*v1.PersistentVolumeClaim, error) {
+	labels := k8sutil.PropagatedLabels(c.cluster)
+	token := k8sutil.InitialClusterToken(c.cluster.Spec.Etcd, c.cluster.UID)
+	pod := k8sutil.NewEtcdPod(m, members.PeerURLPairs(), c.cluster.Name, state, token, c.cluster.Spec, c.cluster.AsOwner())
+	k8sutil.AddLabels(pod.GetObjectMeta(), labels)
+	k8sutil.SetMemberCreation(pod, generation, reason)
+	if len(node) != 0 {
+		k8sutil.PinPodToNode(pod, node)
+	}
+	k8sutil.KeepPodOffNodes(pod, c.refusedNodeList())
+	var pvcs []*v1.PersistentVolumeClaim
 	if c.isPodPVEnabled() {
 		pvc := k8sutil.NewEtcdPodPVC(m, *c.cluster.Spec.Pod.PersistentVolumeClaimSpec, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
-		_, err := c.config.KubeCli.CoreV1().PersistentVolumeClaims(c.cluster.Namespace).Create(pvc)
-		if err != nil {
-			return fmt.Errorf("failed to create PVC for member (%s): %v", m.Name, err)
-		}
+		k8sutil.AddLabels(pvc.GetObjectMeta(), labels)
 		k8sutil.AddEtcdVolumeToPod(pod, pvc)
+		pvcs = append(pvcs, pvc)
+		if walSpec := c.cluster.Spec.Pod.WALVolumeClaimSpec; walSpec != nil {
+			walPVC := k8sutil.NewEtcdPodWALPVC(m, *walSpec, c.cluster.Name, c.cluster.Namespace, c.cluster.AsOwner())
+			k8sutil.AddLabels(walPVC.GetObjectMeta(), labels)
+			k8sutil.AddEtcdWALVolumeToPod(pod, walPVC)
+			pvcs = append(pvcs, walPVC)
+		}
 	} else {
 		k8sutil.AddEtcdVolumeToPod(pod, nil)
 	}
-	_, err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).Create(pod)
-	return err
+	if c.cluster.Annotations[k8sutil.AnnotationDebugToolbox] == "true" {
+		k8sutil.AddToolboxContainer(pod, c.cluster.Spec)
+	}
+	pod, err := k8sutil.ApplyPodOverridePatch(pod, c.cluster.Spec.Pod)
+	if err != nil {
+		// The patch of the spec fails the same way until it is fixed.
+		return nil, nil, &permanentCreateError{err}
+	}
+	return pod, pvcs, nil
 }
 
 func (c *Cluster) removePod(name string) error {
+	if c.isHandsOff(name, "deleting the pod of") {
+		return nil
+	}
 	ns := c.cluster.Namespace
-	opts := metav1.NewDeleteOptions(podTerminationGracePeriod)
+	grace := podTerminationGracePeriod
+	if p := c.cluster.Spec.Pod; p != nil && p.TerminationGracePeriodSeconds != nil {
+		grace = *p.TerminationGracePeriodSeconds
+	}
+	opts := metav1.NewDeleteOptions(grace)
 	err := c.config.KubeCli.Core().Pods(ns).Delete(name, opts)
 	if err != nil {
 		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
@@ -391,26 +870,47 @@ func (c *Cluster) removePod(name string) error {
 	return nil
 }
 
-func (c *Cluster) pollPods() (running, pending []*v1.Pod, err error) {
+// listPods lists the pods of the cluster, including the ones being deleted.
+func (c *Cluster) listPods() ([]*v1.Pod, error) {
+	if c.config.Pods != nil {
+		return c.config.Pods.ClusterPods(c.cluster.Namespace, c.cluster.Name)
+	}
 	podList, err := c.config.KubeCli.Core().Pods(c.cluster.Namespace).List(k8sutil.ClusterListOpt(c.cluster.Name))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list running pods: %v", err)
+		return nil, err
 	}
-
+	pods := make([]*v1.Pod, 0, len(podList.Items))
 	for i := range podList.Items {
-		pod := &podList.Items[i]
-		// Avoid polling deleted pods. k8s issue where deleted pods would sometimes show the status Pending
-		// See https://github.com/coreos/etcd-operator/issues/1693
-		if pod.DeletionTimestamp != nil {
-			continue
-		}
+		pods = append(pods, &podList.Items[i])
+	}
+	return pods, nil
+}
+
+// pollPods returns the running and pending pods of the cluster, and the pods being deleted as leaving.
+// The member of a leaving pod is replaced right away, without waiting for the pod to be gone.
+func (c *Cluster) pollPods() (running, pending, leaving []*v1.Pod, err error) {
+	pods, err := c.listPods()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list running pods: %v", err)
+	}
+
+	c.fenceStalePods(pods)
+	for _, pod := range pods {
 		if len(pod.OwnerReferences) < 1 {
 			c.logger.Warningf("pollPods: ignore pod %v: no owner", pod.Name)
 			continue
 		}
 		if pod.OwnerReferences[0].UID != c.cluster.UID {
-			c.logger.Warningf("pollPods: ignore pod %v: owner (%v) is not %v",
-				pod.Name, pod.OwnerReferences[0].UID, c.cluster.UID)
+			if pod.DeletionTimestamp == nil {
+				c.logger.Warningf("pollPods: ignore pod %v: owner (%v) is not %v",
+					pod.Name, pod.OwnerReferences[0].UID, c.cluster.UID)
+			}
+			continue
+		}
+		// A deleted pod is leaving whatever its phase: k8s would sometimes show the status Pending for it.
+		// See https://github.com/coreos/etcd-operator/issues/1693
+		if pod.DeletionTimestamp != nil {
+			leaving = append(leaving, pod)
 			continue
 		}
 		switch pod.Status.Phase {
@@ -421,10 +921,41 @@ func (c *Cluster) pollPods() (running, pending []*v1.Pod, err error) {
 		}
 	}
 
-	return running, pending, nil
+	return running, pending, leaving, nil
+}
+
+// isStalePod tells whether the pod belongs to an earlier EtcdCluster of the same name,
+// i.e. one that was deleted and recreated before the garbage collector deleted its pods.
+func isStalePod(pod *v1.Pod, cl *api.EtcdCluster) bool {
+	if len(pod.OwnerReferences) < 1 {
+		return false
+	}
+	o := pod.OwnerReferences[0]
+	return o.Kind == api.EtcdClusterResourceKind && o.Name == cl.Name && o.UID != cl.UID
+}
+
+// fenceStalePods deletes the pods of an earlier generation of the cluster, so that their members
+// never join the membership of this one and the services of the cluster stop routing to them.
+// They are not adopted: they are members of another etcd cluster, whose data the recreated resource does not own.
+func (c *Cluster) fenceStalePods(pods []*v1.Pod) {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !isStalePod(pod, c.cluster) {
+			continue
+		}
+		c.logger.Warningf("deleting pod (%s) of an earlier cluster of the same name (uid %v)", pod.Name, pod.OwnerReferences[0].UID)
+		err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).Delete(pod.Name, metav1.NewDeleteOptions(0))
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			c.logger.Errorf("failed to delete stale pod (%s): %v", pod.Name, err)
+			continue
+		}
+		_, err = c.eventsCli.Create(k8sutil.StalePodDeletedEvent(pod.Name, pod.OwnerReferences[0].UID, c.cluster))
+		if err != nil {
+			c.logger.Errorf("failed to create stale pod deleted event: %v", err)
+		}
+	}
 }
 
-func (c *Cluster) updateMemberStatus(running []*v1.Pod) {
+func (c *Cluster) updateMemberStatus(running, leaving []*v1.Pod) {
 	var unready []string
 	var ready []string
 	for _, pod := range running {
@@ -437,6 +968,24 @@ func (c *Cluster) updateMemberStatus(running []*v1.Pod) {
 
 	c.status.Members.Ready = ready
 	c.status.Members.Unready = unready
+	c.status.Members.Leaving = k8sutil.GetPodNames(leaving)
+	c.status.ReadyMembers = len(ready)
+}
+
+func (c *Cluster) updateMemberCountMetrics(running int) {
+	membersDesired.WithLabelValues(c.cluster.Namespace, c.cluster.Name).Set(float64(c.cluster.Spec.Size))
+	membersRunning.WithLabelValues(c.cluster.Namespace, c.cluster.Name).Set(float64(running))
+}
+
+func (c *Cluster) deleteMemberMetrics() {
+	membersDesired.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	membersRunning.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	for _, r := range []string{reconcileSuccess, reconcileFailure} {
+		reconciles.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name, r)
+	}
+	for _, r := range []api.MemberCreationReason{api.MemberCreationInitial, api.MemberCreationScaleUp, api.MemberCreationReplacement, api.MemberCreationRestore} {
+		membersCreated.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name, string(r))
+	}
 }
 
 func (c *Cluster) updateCRStatus() error {
@@ -444,13 +993,23 @@ func (c *Cluster) updateCRStatus() error {
 		return nil
 	}
 
+	gen := c.cluster.Generation
+	if c.statusBumpsGeneration && c.status.ObservedGeneration == gen {
+		// The update increments the generation, but not because of a spec change.
+		c.status.ObservedGeneration = gen + 1
+	}
+
 	newCluster := c.cluster
 	newCluster.Status = c.status
 	newCluster, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace).Update(c.cluster)
 	if err != nil {
+		if c.status.ObservedGeneration == gen+1 {
+			c.status.ObservedGeneration = gen
+		}
 		return fmt.Errorf("failed to update CR status: %v", err)
 	}
 
+	c.statusBumpsGeneration = newCluster.Generation > gen
 	c.cluster = newCluster
 
 	return nil
@@ -458,10 +1017,15 @@ func (c *Cluster) updateCRStatus() error {
 
 func (c *Cluster) reportFailedStatus() {
 	c.logger.Info("cluster failed. Reporting failed reason...")
+	c.config.Notifier.Notify("etcd cluster %s/%s failed: %s", c.cluster.Namespace, c.cluster.Name, c.status.Reason)
+	c.status.Failure = c.failureReport()
+	if _, err := c.eventsCli.Create(k8sutil.ClusterFailedEvent(c.status.Reason, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create cluster failed event: %v", err)
+	}
 
 	retryInterval := 5 * time.Second
 	f := func() (bool, error) {
-		c.status.SetPhase(api.ClusterPhaseFailed)
+		c.transition(api.ClusterPhaseFailed)
 		err := c.updateCRStatus()
 		if err == nil || k8sutil.IsKubernetesResourceNotFoundError(err) {
 			return true, nil
@@ -488,7 +1052,8 @@ func (c *Cluster) reportFailedStatus() {
 		return false, nil
 	}
 
-	retryutil.Retry(retryInterval, math.MaxInt64, f)
+	// Reporting stops once the cluster is deleted.
+	retryutil.RetryContext(c.ctx, retryInterval, math.MaxInt64, f)
 }
 
 func (c *Cluster) name() string {
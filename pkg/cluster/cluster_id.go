@@ -0,0 +1,113 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// formatClusterID returns the etcd cluster ID as recorded in status.clusterID.
+func formatClusterID(id uint64) string {
+	return fmt.Sprintf("%x", id)
+}
+
+// memberClusterIDs returns the etcd cluster ID each ready running member answers with, by member name.
+// The members that do not answer are left out.
+func (c *Cluster) memberClusterIDs(running []*v1.Pod) map[string]string {
+	ids := map[string]string{}
+	for _, pod := range running {
+		if !k8sutil.IsPodReady(pod) {
+			continue
+		}
+		m, ok := c.members[pod.Name]
+		if !ok {
+			m = newClusterMember(pod.Name, pod.Namespace, c.cluster.Spec)
+		}
+		st, err := etcdutil.MemberStatus(c.ctx, m.ClientURL(), c.tlsConfig, c.clientOptions())
+		if err != nil {
+			c.logger.Debugf("cluster ID of member (%s) not checked: %v", m.Name, err)
+			continue
+		}
+		ids[m.Name] = formatClusterID(st.Header.ClusterId)
+	}
+	return ids
+}
+
+// clusterIDMismatch checks the etcd cluster ID of the running members against status.clusterID, recording it
+// if it is not yet. It tells whether a member answers with another ID, and which.
+func (c *Cluster) clusterIDMismatch(running []*v1.Pod) (message string, ok bool) {
+	record, message := checkClusterIDs(c.status.ClusterID, c.memberClusterIDs(running))
+	if len(record) != 0 {
+		c.logger.Infof("recording etcd cluster ID %s", record)
+		c.status.ClusterID = record
+	}
+	return message, len(message) != 0
+}
+
+// checkClusterIDs checks the etcd cluster ID of each member against the recorded one. Without a recorded ID,
+// the ID the members agree on is the one to record. message tells which members answer with another ID, if any.
+func checkClusterIDs(recorded string, ids map[string]string) (record, message string) {
+	if len(ids) == 0 {
+		return "", ""
+	}
+	byID := map[string][]string{}
+	for name, id := range ids {
+		byID[id] = append(byID[id], name)
+	}
+	if len(recorded) == 0 {
+		if len(byID) == 1 {
+			for id := range byID {
+				return id, ""
+			}
+		}
+		return "", "members answer with different etcd cluster IDs: " + describeClusterIDs(byID)
+	}
+	delete(byID, recorded)
+	if len(byID) == 0 {
+		return "", ""
+	}
+	return "", fmt.Sprintf("members answer with another etcd cluster ID than %s, they may be pointed at the peers of another cluster: %s",
+		recorded, describeClusterIDs(byID))
+}
+
+// describeClusterIDs lists the members of each cluster ID, in ID order.
+func describeClusterIDs(byID map[string][]string) string {
+	var parts []string
+	for id, names := range byID {
+		sort.Strings(names)
+		parts = append(parts, fmt.Sprintf("%s (%s)", strings.Join(names, ", "), id))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+// requireInterventionForClusterID requires intervention if a running member answers with another etcd cluster ID
+// than the recorded one, and tells whether it did. Acting on such a member would change the membership of,
+// or replace members from, a cluster that is not this one.
+func (c *Cluster) requireInterventionForClusterID(running []*v1.Pod) bool {
+	message, ok := c.clusterIDMismatch(running)
+	if ok {
+		c.requireIntervention(api.InterventionReasonClusterIDMismatch, message)
+	}
+	return ok
+}
@@ -15,11 +15,28 @@
 package cluster
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	fakeetcd "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 // When EtcdCluster update event happens, local object ref should be updated.
@@ -48,7 +65,7 @@ func TestUpdateEventUpdateLocalClusterObj(t *testing.T) {
 		cluster: newObj,
 	}
 
-	err := c.handleUpdateEvent(e)
+	_, err := c.handleUpdateEvent(e)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -56,3 +73,1023 @@ func TestUpdateEventUpdateLocalClusterObj(t *testing.T) {
 		t.Errorf("expect version=%s, get=%s", newVersion, c.cluster.ResourceVersion)
 	}
 }
+
+func TestHasQuorum(t *testing.T) {
+	tests := []struct {
+		size, ready int
+		want        bool
+	}{
+		{size: 0, ready: 0, want: false},
+		{size: 1, ready: 1, want: true},
+		{size: 3, ready: 1, want: false},
+		{size: 3, ready: 2, want: true},
+		{size: 4, ready: 2, want: false},
+		{size: 5, ready: 3, want: true},
+	}
+	for i, tt := range tests {
+		if get := hasQuorum(tt.size, tt.ready); get != tt.want {
+			t.Errorf("#%d: hasQuorum(%d, %d)=%v, want=%v", i, tt.size, tt.ready, get, tt.want)
+		}
+	}
+}
+
+func TestReconcileDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: reconcileInterval},
+		{failures: 1, want: 2 * reconcileInterval},
+		{failures: 3, want: 8 * reconcileInterval},
+		{failures: 10, want: maxReconcileBackoff},
+		{failures: 1000, want: maxReconcileBackoff},
+	}
+	for i, tt := range tests {
+		if get := reconcileDelay(tt.failures); get != tt.want {
+			t.Errorf("#%d: reconcileDelay(%d)=%v, want=%v", i, tt.failures, get, tt.want)
+		}
+	}
+}
+
+func TestNextReconcileDelayWithDegradedAPI(t *testing.T) {
+	if get := nextReconcileDelay(0, true); get != degradedAPIReconcileInterval {
+		t.Errorf("nextReconcileDelay(0, true)=%v, want=%v", get, degradedAPIReconcileInterval)
+	}
+	if get := nextReconcileDelay(10, true); get != maxReconcileBackoff {
+		t.Errorf("nextReconcileDelay(10, true)=%v, want=%v", get, maxReconcileBackoff)
+	}
+	if get := nextReconcileDelay(0, false); get != reconcileInterval {
+		t.Errorf("nextReconcileDelay(0, false)=%v, want=%v", get, reconcileInterval)
+	}
+}
+
+func TestReconcileTimer(t *testing.T) {
+	timer := newReconcileTimer(time.Hour)
+	defer timer.stop()
+	// Rearming a pending timer does not push it back.
+	timer.rearm(2 * time.Hour)
+	timer.now()
+	select {
+	case <-timer.C():
+		timer.fire()
+	case <-time.After(time.Second):
+		t.Fatal("expect the timer to fire right away")
+	}
+	timer.rearm(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("expect the rearmed timer not to fire")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestUpdateEventChangedSpec(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		Spec:       api.ClusterSpec{Size: 3},
+	}
+	c := &Cluster{cluster: cl, logger: logrus.WithField("pkg", "test")}
+
+	updated := cl.DeepCopy()
+	updated.ResourceVersion = "2"
+	if changed, err := c.handleUpdateEvent(&clusterEvent{typ: eventModifyCluster, cluster: updated}); err != nil || changed {
+		t.Errorf("expect no change of the spec, got %v (%v)", changed, err)
+	}
+	updated = updated.DeepCopy()
+	updated.Spec.Pod = &api.PodPolicy{NodeSelector: map[string]string{"disk": "ssd"}}
+	if changed, err := c.handleUpdateEvent(&clusterEvent{typ: eventModifyCluster, cluster: updated}); err != nil || changed {
+		t.Errorf("expect no reconciliation for a change of spec.pod, got %v (%v)", changed, err)
+	}
+	updated = updated.DeepCopy()
+	updated.Spec.Size = 5
+	if changed, err := c.handleUpdateEvent(&clusterEvent{typ: eventModifyCluster, cluster: updated}); err != nil || !changed {
+		t.Errorf("expect a reconciliation for a change of spec.size, got %v (%v)", changed, err)
+	}
+}
+
+func TestChangedSpecFields(t *testing.T) {
+	oldSpec := api.ClusterSpec{Size: 3, Version: "3.2.13"}
+	newSpec := oldSpec
+	newSpec.Version = "3.3.0"
+	newSpec.PropagatedLabels = []string{"team"}
+	if got, want := changedSpecFields(oldSpec, newSpec), []string{"version", "propagatedLabels"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expect changed fields %v, got %v", want, got)
+	}
+	if got := changedSpecFields(oldSpec, oldSpec); len(got) != 0 {
+		t.Errorf("expect no changed field, got %v", got)
+	}
+}
+
+func TestRecordAction(t *testing.T) {
+	c := &Cluster{}
+	for i := 0; i < maxRecordedActions+2; i++ {
+		c.recordAction(fmt.Sprintf("action %d", i), nil)
+	}
+	c.recordPlanAction(PlanAction{Type: PlanAddMember, Reason: "scale up to 3 members"}, errors.New("timeout"))
+	if len(c.actions) != maxRecordedActions {
+		t.Fatalf("expect %d actions, got %d", maxRecordedActions, len(c.actions))
+	}
+	if c.actions[0].Action != "action 3" {
+		t.Errorf("expect the oldest actions to be dropped, got %q first", c.actions[0].Action)
+	}
+	last := c.actions[len(c.actions)-1]
+	if last.Action != "AddMember: scale up to 3 members" || last.Error != "timeout" {
+		t.Errorf("unexpected last action %+v", last)
+	}
+}
+
+func TestMemberStates(t *testing.T) {
+	ms := api.MembersStatus{Ready: []string{"test-0000"}, Unready: []string{"test-0002"}, Leaving: []string{"test-0003"}}
+	got := memberStates([]string{"test-0000", "test-0001", "test-0002", "test-0003"}, ms)
+	want := []api.MemberState{
+		{Name: "test-0000", State: api.MemberStateReady},
+		{Name: "test-0001", State: api.MemberStateNoPod},
+		{Name: "test-0002", State: api.MemberStateUnready},
+		{Name: "test-0003", State: api.MemberStateLeaving},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expect member states %v, got %v", want, got)
+	}
+}
+
+func TestSameEndpoints(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{a: []string{"http://a:2379", "http://b:2379"}, b: []string{"http://b:2379", "http://a:2379"}, want: true},
+		{a: []string{"http://a:2379"}, b: []string{"http://a:2379", "http://b:2379"}, want: false},
+		{a: []string{"http://a:2379", "http://b:2379"}, b: []string{"http://a:2379", "http://c:2379"}, want: false},
+	}
+	for i, tt := range tests {
+		if get := sameEndpoints(tt.a, tt.b); get != tt.want {
+			t.Errorf("#%d: sameEndpoints(%v, %v)=%v, want=%v", i, tt.a, tt.b, get, tt.want)
+		}
+	}
+}
+
+func TestCanRecreateEmpty(t *testing.T) {
+	backup := func(ns, endpoint string) api.EtcdBackup {
+		return api.EtcdBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: ns},
+			Spec:       api.BackupSpec{EtcdEndpoints: []string{endpoint}},
+		}
+	}
+	tests := []struct {
+		selfHealing *api.SelfHealingPolicy
+		backups     []api.EtcdBackup
+		want        bool
+	}{
+		{selfHealing: nil, want: false},
+		{selfHealing: &api.SelfHealingPolicy{}, want: false},
+		{selfHealing: &api.SelfHealingPolicy{RecreateEmpty: true}, want: true},
+		{
+			selfHealing: &api.SelfHealingPolicy{RecreateEmpty: true},
+			backups:     []api.EtcdBackup{backup("other", "http://example-client:2379"), backup("default", "http://other-client:2379")},
+			want:        true,
+		},
+		{
+			selfHealing: &api.SelfHealingPolicy{RecreateEmpty: true},
+			backups:     []api.EtcdBackup{backup("default", "http://example-client.default.svc:2379")},
+			want:        false,
+		},
+	}
+	for i, tt := range tests {
+		cl := &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+			Spec:       api.ClusterSpec{SelfHealing: tt.selfHealing},
+		}
+		if get, _ := canRecreateEmpty(cl, tt.backups); get != tt.want {
+			t.Errorf("#%d: canRecreateEmpty()=%v, want=%v", i, get, tt.want)
+		}
+	}
+}
+
+func TestRestoreDue(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 10, 0, 0, time.UTC)
+	tests := []struct {
+		selfHealing *api.SelfHealingPolicy
+		lostTime    string
+		membersLeft bool
+		wantDue     bool
+		wantWait    time.Duration
+	}{
+		// Quorum was lost 2 minutes ago, the default grace period is 5 minutes.
+		{selfHealing: &api.SelfHealingPolicy{RestoreFromBackup: true}, lostTime: "2018-01-01T00:08:00Z", membersLeft: true, wantWait: 3 * time.Minute},
+		{selfHealing: &api.SelfHealingPolicy{RestoreFromBackup: true}, lostTime: "2018-01-01T00:05:00Z", membersLeft: true, wantDue: true},
+		{selfHealing: &api.SelfHealingPolicy{RestoreFromBackup: true, RestoreAfterSeconds: 60}, lostTime: "2018-01-01T00:08:00Z", membersLeft: true, wantDue: true},
+		{selfHealing: &api.SelfHealingPolicy{RestoreFromBackup: true, RestoreAfterSeconds: 600}, lostTime: "2018-01-01T00:08:00Z", membersLeft: true, wantWait: 8 * time.Minute},
+		// The time quorum was lost is not recorded yet.
+		{selfHealing: &api.SelfHealingPolicy{RestoreFromBackup: true}, lostTime: "", membersLeft: true, wantWait: 5 * time.Minute},
+		// Nothing is left of the members: there is no quorum to wait for.
+		{selfHealing: &api.SelfHealingPolicy{RestoreFromBackup: true}, lostTime: "2018-01-01T00:10:00Z", membersLeft: false, wantDue: true},
+		{selfHealing: &api.SelfHealingPolicy{RestoreFromBackup: true}, lostTime: "", membersLeft: false, wantDue: true},
+	}
+	for i, tt := range tests {
+		due, wait := restoreDue(tt.selfHealing, tt.lostTime, now, tt.membersLeft)
+		if due != tt.wantDue || wait != tt.wantWait {
+			t.Errorf("#%d: restoreDue()=(%v, %v), want=(%v, %v)", i, due, wait, tt.wantDue, tt.wantWait)
+		}
+	}
+}
+
+func TestSetLostQuorum(t *testing.T) {
+	c := &Cluster{}
+	c.setLostQuorum(true)
+	lostTime := c.status.QuorumLostTime
+	if len(lostTime) == 0 {
+		t.Fatal("expect the time quorum was lost to be recorded")
+	}
+	c.status.QuorumLostTime = "2018-01-01T00:00:00Z"
+	c.setLostQuorum(true)
+	if c.status.QuorumLostTime != "2018-01-01T00:00:00Z" {
+		t.Errorf("expect the time quorum was first lost to be kept, got %s", c.status.QuorumLostTime)
+	}
+	c.setLostQuorum(false)
+	if c.lostQuorum || len(c.status.QuorumLostTime) != 0 {
+		t.Errorf("expect the lost quorum to be cleared, got %v since %q", c.lostQuorum, c.status.QuorumLostTime)
+	}
+}
+
+func TestUpdateCRStatusObservedGeneration(t *testing.T) {
+	cl := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault, Generation: 1}}
+	crcli := fakeetcd.NewSimpleClientset(cl.DeepCopy())
+	// Like the API server without the status subresource, every update increments the generation.
+	crcli.PrependReactor("update", "etcdclusters", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stesting.UpdateAction).GetObject().(*api.EtcdCluster).DeepCopy()
+		obj.Generation++
+		return true, obj, nil
+	})
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		config:  Config{EtcdCRCli: crcli},
+		cluster: cl,
+	}
+
+	for i, ready := range []bool{true, false} {
+		c.status.Ready = ready
+		c.status.ObservedGeneration = c.cluster.Generation
+		if err := c.updateCRStatus(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// The first update finds out the generation changes.
+			continue
+		}
+		if c.cluster.Generation != c.status.ObservedGeneration {
+			t.Errorf("expect observedGeneration=%d, get=%d", c.cluster.Generation, c.status.ObservedGeneration)
+		}
+	}
+}
+
+func TestRefusedMaintenanceRemovesAnnotation(t *testing.T) {
+	cl := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{
+		Name:        "test",
+		Namespace:   metav1.NamespaceDefault,
+		Annotations: map[string]string{k8sutil.AnnotationCompact: "latest", "keep": "me"},
+	}}
+	crcli := fakeetcd.NewSimpleClientset()
+	// The fake clientset does not apply patches: remove the annotations the merge patch sets to null.
+	crcli.PrependReactor("patch", "etcdclusters", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var p struct {
+			Metadata struct {
+				Annotations map[string]*string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &p); err != nil {
+			return true, nil, err
+		}
+		obj := cl.DeepCopy()
+		for k, v := range p.Metadata.Annotations {
+			if v == nil {
+				delete(obj.Annotations, k)
+			}
+		}
+		return true, obj, nil
+	})
+	c := &Cluster{
+		logger:    logrus.WithField("pkg", "cluster"),
+		config:    Config{EtcdCRCli: crcli},
+		cluster:   cl,
+		eventsCli: fake.NewSimpleClientset().CoreV1().Events(cl.Namespace),
+	}
+	if err := c.runRequestedMaintenance(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.cluster.Annotations[k8sutil.AnnotationCompact]; ok {
+		t.Error("expect the compact annotation with an invalid revision to be removed")
+	}
+	if c.cluster.Annotations["keep"] != "me" {
+		t.Errorf("expect other annotations to be kept, got %v", c.cluster.Annotations)
+	}
+}
+
+func TestIsStalePod(t *testing.T) {
+	cl := &api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "new"}}
+	owned := func(kind, name string, uid types.UID) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{{Kind: kind, Name: name, UID: uid}},
+		}}
+	}
+	tests := []struct {
+		pod  *v1.Pod
+		want bool
+	}{
+		{owned(api.EtcdClusterResourceKind, "test", "old"), true},
+		{owned(api.EtcdClusterResourceKind, "test", "new"), false},
+		{owned(api.EtcdClusterResourceKind, "other", "old"), false},
+		{owned("ReplicaSet", "test", "old"), false},
+		{&v1.Pod{}, false},
+	}
+	for i, tt := range tests {
+		if got := isStalePod(tt.pod, cl); got != tt.want {
+			t.Errorf("#%d: isStalePod()=%v, want=%v", i, got, tt.want)
+		}
+	}
+}
+
+func TestIsStuckTerminating(t *testing.T) {
+	now := time.Now()
+	deleted := func(d time.Duration) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &metav1.Time{Time: now.Add(-d)}}}
+	}
+	tests := []struct {
+		pod   *v1.Pod
+		after time.Duration
+		want  bool
+	}{
+		{deleted(10 * time.Minute), 5 * time.Minute, true},
+		{deleted(time.Minute), 5 * time.Minute, false},
+		// Still in its grace period.
+		{deleted(-time.Minute), 5 * time.Minute, false},
+		{deleted(10 * time.Minute), 0, false},
+		{&v1.Pod{}, 5 * time.Minute, false},
+	}
+	for i, tt := range tests {
+		if got := isStuckTerminating(tt.pod, tt.after, now); got != tt.want {
+			t.Errorf("#%d: isStuckTerminating()=%v, want=%v", i, got, tt.want)
+		}
+	}
+
+	zero := int64(0)
+	if got := forceDeleteAfter(nil); got != defaultForceDeleteAfter {
+		t.Errorf("expect default %v without pod policy, got %v", defaultForceDeleteAfter, got)
+	}
+	if got := forceDeleteAfter(&api.PodPolicy{ForceDeleteAfterSeconds: &zero}); got != 0 {
+		t.Errorf("expect forced deletion to be disabled, got %v", got)
+	}
+}
+
+func TestPickOnePodCreatedBefore(t *testing.T) {
+	phaseStart := time.Now()
+	created := func(name string, t time.Time) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Time{Time: t}}}
+	}
+	pods := []*v1.Pod{
+		created("rolled", phaseStart.Add(time.Minute)),
+		created("old", phaseStart.Add(-time.Minute)),
+	}
+	if pod := pickOnePodCreatedBefore(pods, phaseStart); pod == nil || pod.Name != "old" {
+		t.Errorf("expect pod old to be rolled, got %v", pod)
+	}
+	if pod := pickOnePodCreatedBefore(pods[:1], phaseStart); pod != nil {
+		t.Errorf("expect no pod to be rolled, got %s", pod.Name)
+	}
+}
+
+func TestPickMemberToRemove(t *testing.T) {
+	pod := func(name string, ready bool) *v1.Pod {
+		p := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if ready {
+			p.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+		}
+		return p
+	}
+	ms := etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000"}, &etcdutil.Member{Name: "test-0001"}, &etcdutil.Member{Name: "test-0002"})
+
+	pods := []*v1.Pod{pod("test-0000", true), pod("test-0001", true), pod("test-0002", true)}
+	if m := pickMemberToRemove(pods, ms, "test-0000"); m.Name != "test-0001" {
+		t.Errorf("expect a member other than the leader to be removed, got %s", m.Name)
+	}
+	if err := checkRemovalQuorum(pods, "test-0001", 3); err != nil {
+		t.Errorf("expect removal to be allowed with the other members ready, got %v", err)
+	}
+
+	pods[2] = pod("test-0002", false)
+	if m := pickMemberToRemove(pods, ms, "test-0000"); m.Name != "test-0002" {
+		t.Errorf("expect the unready member to be removed, got %s", m.Name)
+	}
+	if err := checkRemovalQuorum(pods, "test-0002", 3); err != nil {
+		t.Errorf("expect removal of the unready member to be allowed, got %v", err)
+	}
+	// The two members left would have a single ready member.
+	if err := checkRemovalQuorum(pods, "test-0001", 3); err == nil {
+		t.Error("expect removal of a ready member to be refused")
+	}
+
+	pods[2].Annotations = map[string]string{k8sutil.AnnotationHandsOff: "true"}
+	if m := pickMemberToRemove(pods, ms, "test-0000"); m.Name != "test-0001" {
+		t.Errorf("expect the unready member annotated hands-off to be kept, got %s", m.Name)
+	}
+	for _, p := range pods {
+		p.Annotations = map[string]string{k8sutil.AnnotationHandsOff: "true"}
+	}
+	if m := pickMemberToRemove(pods, ms, "test-0000"); m != nil {
+		t.Errorf("expect no member to be removed when all are hands-off, got %s", m.Name)
+	}
+}
+
+func TestSyncHandsOff(t *testing.T) {
+	c := &Cluster{}
+	running := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-0000"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-0001", Annotations: map[string]string{k8sutil.AnnotationHandsOff: "true"}}},
+	}
+	c.syncHandsOff(running, nil, nil)
+	if !c.handsOff["test-0001"] || c.handsOff["test-0000"] {
+		t.Errorf("expect only test-0001 to be hands-off, got %v", c.handsOff)
+	}
+	if len(c.status.Conditions) != 1 || c.status.Conditions[0].Type != api.ClusterConditionHandsOff {
+		t.Errorf("expect the HandsOff condition for hands-off members, got %v", c.status.Conditions)
+	}
+
+	c.syncHandsOff(running[:1], nil, nil)
+	if len(c.handsOff) != 0 || len(c.status.Conditions) != 0 {
+		t.Errorf("expect no hands-off member nor condition, got %v and %v", c.handsOff, c.status.Conditions)
+	}
+}
+
+func TestUpgradePreflightSkipsStartedUpgrade(t *testing.T) {
+	c := &Cluster{cluster: &api.EtcdCluster{Spec: api.ClusterSpec{Version: "3.3.13"}}}
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-0000", Annotations: map[string]string{}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-0001", Annotations: map[string]string{}}},
+	}
+	k8sutil.SetEtcdVersion(pods[0], "3.3.13")
+	k8sutil.SetEtcdVersion(pods[1], "3.2.13")
+	// Neither pod is ready, but a member already runs the new version.
+	if err := c.upgradePreflight(pods); err != nil {
+		t.Errorf("expect an upgrade that already started not to be checked, got %v", err)
+	}
+}
+
+func TestNewPreUpgradeBackup(t *testing.T) {
+	from := &api.EtcdBackup{Spec: api.BackupSpec{
+		EtcdEndpoints: []string{"https://test-client:2379"},
+		StorageType:   api.BackupStorageTypeS3,
+		BackupPolicy:  &api.BackupPolicy{TimeoutInSecond: 60, BackupIntervalInSecond: 3600, MaxBackups: 5},
+		BackupSource:  api.BackupSource{S3: &api.S3BackupSource{Path: "bucket/test.db", AWSSecret: "aws"}},
+		Tag:           "nightly",
+	}}
+	eb := newPreUpgradeBackup("test-pre-upgrade-3.2.13", "3.2.13", from)
+
+	if eb.Spec.Tag != "pre-upgrade-3.2.13" {
+		t.Errorf("expect tag pre-upgrade-3.2.13, got %s", eb.Spec.Tag)
+	}
+	if p := eb.Spec.S3.Path; p != "bucket/test.db.pre-upgrade-3.2.13" {
+		t.Errorf("expect the backup next to the path of the latest backup, got %s", p)
+	}
+	expected := &api.BackupPolicy{TimeoutInSecond: 60, VerifyRestore: true}
+	if !reflect.DeepEqual(eb.Spec.BackupPolicy, expected) {
+		t.Errorf("expect a one-off verified backup %+v, got %+v", expected, eb.Spec.BackupPolicy)
+	}
+	if from.Spec.S3.Path != "bucket/test.db" || from.Spec.Tag != "nightly" {
+		t.Error("expect the latest backup to be left unchanged")
+	}
+}
+
+func TestFioFsyncP99(t *testing.T) {
+	tests := []struct {
+		out     string
+		p99     time.Duration
+		wantErr bool
+	}{{
+		out: `note: both iodepth >= 1 and synchronous I/O engine are selected, queue depth will be capped at 1
+{"fio version": "fio-3.16", "jobs": [{"jobname": "etcd-disk-preflight", "sync": {"total_ios": 10029,
+"lat_ns": {"min": 275000, "max": 21000000, "percentile": {"90.000000": 1400000, "99.000000": 2212000}}}}]}`,
+		p99: 2212 * time.Microsecond,
+	}, {
+		// fio before 3.5 reports no sync latency percentiles.
+		out:     `{"fio version": "fio-2.2.10", "jobs": [{"jobname": "etcd-disk-preflight", "sync": {}}]}`,
+		wantErr: true,
+	}, {
+		out:     "fio: unrecognized option",
+		wantErr: true,
+	}}
+	for i, tt := range tests {
+		p99, err := fioFsyncP99([]byte(tt.out))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if p99 != tt.p99 {
+			t.Errorf("#%d: expect p99 %v, got %v", i, tt.p99, p99)
+		}
+	}
+}
+
+func TestClassifyMemberFailure(t *testing.T) {
+	tests := []struct {
+		log     string
+		cause   string
+		replace bool
+	}{{
+		log: `2018-06-01 10:00:00.000000 I | etcdmain: etcd Version: 3.2.13
+2018-06-01 10:00:00.100000 C | etcdmain: open /etc/etcdtls/member/server-tls/server.crt: x509: certificate has expired or is not yet valid`,
+		cause: "TLS configuration error",
+	}, {
+		log: `2018-06-01 10:00:00.000000 I | etcdserver: recovered store from snapshot at index 100
+2018-06-01 10:00:00.100000 C | etcdserver: read wal error (walpb: crc mismatch) and cannot be repaired`,
+		cause:   "data corruption",
+		replace: true,
+	}, {
+		log:     "2018-06-01 10:00:00.000000 I | etcdmain: stopping",
+		cause:   "unknown",
+		replace: true,
+	}}
+	for i, tt := range tests {
+		f := classifyMemberFailure(tt.log)
+		if f.cause != tt.cause || f.replace != tt.replace {
+			t.Errorf("#%d: expect cause %q and replace %v, got %q and %v", i, tt.cause, tt.replace, f.cause, f.replace)
+		}
+		if lines := strings.Split(tt.log, "\n"); f.logLine != lines[len(lines)-1] {
+			t.Errorf("#%d: expect log line %q, got %q", i, lines[len(lines)-1], f.logLine)
+		}
+	}
+}
+
+func TestPickOneCorruptedMember(t *testing.T) {
+	c := &Cluster{
+		members: etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000"}, &etcdutil.Member{Name: "test-0001"}),
+		memberFailures: map[string]memberFailure{
+			"test-0000": {cause: "TLS configuration error"},
+			"test-0001": {cause: memberFailureDataCorruption, replace: true},
+		},
+	}
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-0000"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "test-0001"}},
+	}
+	if m := c.pickOneCorruptedMember(pods); m == nil || m.Name != "test-0001" {
+		t.Errorf("expect member test-0001 to be picked, got %v", m)
+	}
+	if m := c.pickOneCorruptedMember(pods[:1]); m != nil {
+		t.Errorf("expect no member to be picked, got %s", m.Name)
+	}
+}
+
+func TestCorruptionAcrossMembers(t *testing.T) {
+	c := &Cluster{
+		members: newDecideMembers("test-0000", "test-0001", "test-0002"),
+		memberFailures: map[string]memberFailure{
+			"test-0001": {cause: memberFailureDataCorruption, replace: true},
+			"test-0002": {cause: memberFailureDataCorruption, replace: true},
+		},
+	}
+	pods := []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", false), newDecidePod("test-0002", false)}
+	if msg, ok := c.corruptionAcrossMembers(pods); !ok || msg != "2 of 3 members failed on corrupted data: test-0001, test-0002" {
+		t.Errorf("expect corruption across members, got %v: %q", ok, msg)
+	}
+	// One corrupted member is replaced from the other two.
+	if _, ok := c.corruptionAcrossMembers(pods[:2]); ok {
+		t.Errorf("expect no corruption across members with one corrupted member")
+	}
+	c.members.Add(&etcdutil.Member{Name: "test-0003"})
+	c.members.Add(&etcdutil.Member{Name: "test-0004"})
+	if _, ok := c.corruptionAcrossMembers(pods); ok {
+		t.Errorf("expect no corruption across members with 3 of 5 healthy members")
+	}
+}
+
+func TestBootstrapDiagnostics(t *testing.T) {
+	members := newDecideMembers("test-0000", "test-0001", "test-0002")
+	unscheduled := newDecidePod("test-0001", false)
+	unscheduled.Status.Conditions = []v1.PodCondition{{
+		Type:    v1.PodScheduled,
+		Status:  v1.ConditionFalse,
+		Message: "0/3 nodes are available: 3 Insufficient cpu.",
+	}}
+	pulling := newDecidePod("test-0002", false)
+	pulling.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name:  "etcd",
+		State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+	}}
+
+	got := bootstrapDiagnostics(members, []*v1.Pod{newDecidePod("test-0000", true)}, []*v1.Pod{unscheduled, pulling})
+	expected := "1 of 3 members are ready; " +
+		"pod test-0001 is not scheduled: 0/3 nodes are available: 3 Insufficient cpu.; " +
+		"pod test-0002 is pending: container etcd is waiting: ImagePullBackOff: Back-off pulling image"
+	if got != expected {
+		t.Errorf("expect diagnostics %q, got %q", expected, got)
+	}
+
+	got = bootstrapDiagnostics(newDecideMembers("test-0000"), []*v1.Pod{newDecidePod("test-0000", false)}, nil)
+	if expected = "0 of 1 members are ready; pod test-0000 is not ready"; got != expected {
+		t.Errorf("expect diagnostics %q, got %q", expected, got)
+	}
+}
+
+func TestTearDown(t *testing.T) {
+	now := metav1.Now()
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test", Namespace: "default", UID: "uid",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{"other", k8sutil.FinalizerDeletionPolicy},
+		},
+		Spec: api.ClusterSpec{
+			TLS: &api.TLSPolicy{Static: &api.StaticTLS{
+				Member:         &api.MemberSecret{PeerSecret: "peer", ServerSecret: "server"},
+				OperatorSecret: "operator",
+			}},
+			DeletionPolicy: &api.DeletionPolicy{PersistentVolumeClaims: api.DeletionRetain, Secrets: api.DeletionDelete},
+		},
+	}
+	pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-0000", Namespace: "default", Labels: k8sutil.LabelsForCluster("test"),
+		OwnerReferences: []metav1.OwnerReference{cl.AsOwner()},
+	}}
+	kubecli := fake.NewSimpleClientset(pvc,
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "peer", Namespace: "default"}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "default"}})
+	crcli := fakeetcd.NewSimpleClientset(cl)
+
+	st, err := TearDown(kubecli, crcli, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The PVC and the three TLS secrets, two of which are gone already.
+	if st.Completed != 4 || st.Total != 4 {
+		t.Errorf("expect the deletion policy applied to 4 of 4 objects, got %d of %d", st.Completed, st.Total)
+	}
+	pvc, err = kubecli.CoreV1().PersistentVolumeClaims("default").Get("test-0000", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvc.OwnerReferences) != 0 || pvc.Annotations[k8sutil.AnnotationRetained] != "true" {
+		t.Errorf("expect the PVC released and annotated as retained, got owners %v and annotations %v", pvc.OwnerReferences, pvc.Annotations)
+	}
+	if _, err := kubecli.CoreV1().Secrets("default").Get("peer", metav1.GetOptions{}); !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		t.Errorf("expect the TLS secret deleted, got %v", err)
+	}
+	if _, err := kubecli.CoreV1().Secrets("default").Get("unrelated", metav1.GetOptions{}); err != nil {
+		t.Errorf("expect other secrets kept: %v", err)
+	}
+	got, err := crcli.EtcdV1beta2().EtcdClusters("default").Get("test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Finalizers, []string{"other"}) {
+		t.Errorf("expect only the deletion policy finalizer removed, got %v", got.Finalizers)
+	}
+}
+
+func TestApplyTearDownSteps(t *testing.T) {
+	var applied int32
+	ok := func() error { atomic.AddInt32(&applied, 1); return nil }
+	steps := []tearDownStep{{done: true}, {apply: ok}, {apply: ok}, {apply: func() error { return errors.New("conflict") }}}
+
+	st := applyTearDownSteps(steps, 0)
+	if st.Completed != 1 || st.Total != 4 || len(st.LastError) != 0 || applied != 0 {
+		t.Errorf("expect no step started past the deadline, got %d of %d completed, %d applied, error %q", st.Completed, st.Total, applied, st.LastError)
+	}
+	st = applyTearDownSteps(steps, time.Minute)
+	if st.Completed != 3 || st.Total != 4 || st.LastError != "conflict" || applied != 2 {
+		t.Errorf("expect 3 of 4 completed and the conflict reported, got %d of %d, %d applied, error %q", st.Completed, st.Total, applied, st.LastError)
+	}
+}
+
+func TestRecreateRestartedMembers(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		Spec: api.ClusterSpec{
+			Size:    3,
+			Version: "3.2.13",
+			Pod:     &api.PodPolicy{PersistentVolumeClaimSpec: &v1.PersistentVolumeClaimSpec{}},
+		},
+	}
+	kubecli := fake.NewSimpleClientset()
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		config:  Config{KubeCli: kubecli},
+		cluster: cl,
+		ctx:     context.Background(),
+		members: etcdutil.NewMemberSet(
+			&etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault},
+			&etcdutil.Member{Name: "test-0001", Namespace: metav1.NamespaceDefault},
+			&etcdutil.Member{Name: "test-0002", Namespace: metav1.NamespaceDefault},
+		),
+		restarting: map[string]restartingMember{"test-0001": {generation: 2, reason: api.MemberCreationScaleUp}},
+	}
+
+	restarting, err := c.recreateRestartedMembers(nil, []*v1.Pod{newPlanPod("test-0001", "3.2.13")})
+	if err != nil || !restarting {
+		t.Fatalf("expect the member restarting, got %v, %v", restarting, err)
+	}
+	if _, err := kubecli.CoreV1().Pods(metav1.NamespaceDefault).Get("test-0001", metav1.GetOptions{}); !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		t.Errorf("expect no pod created while the deleted pod is not gone, got %v", err)
+	}
+
+	restarting, err = c.recreateRestartedMembers(nil, nil)
+	if err != nil || !restarting {
+		t.Fatalf("expect the member restarting, got %v, %v", restarting, err)
+	}
+	pod, err := kubecli.CoreV1().Pods(metav1.NamespaceDefault).Get("test-0001", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, r := pod.Annotations[k8sutil.AnnotationMemberGeneration], pod.Annotations[k8sutil.AnnotationMemberCreationReason]; g != "2" || r != string(api.MemberCreationScaleUp) {
+		t.Errorf("expect the pod to keep member generation 2 created on ScaleUp, got %s created on %s", g, r)
+	}
+	pvcs, err := kubecli.CoreV1().PersistentVolumeClaims(metav1.NamespaceDefault).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvcs.Items) != 0 {
+		t.Errorf("expect the PVCs of the member reused, got %d created", len(pvcs.Items))
+	}
+	if c.status.MemberGeneration != 0 || len(c.status.MemberCreations) != 0 {
+		t.Errorf("expect no member creation counted, got generation %d and creations %v", c.status.MemberGeneration, c.status.MemberCreations)
+	}
+
+	if restarting, err := c.recreateRestartedMembers(nil, nil); err != nil || restarting {
+		t.Errorf("expect no member restarting any more, got %v, %v", restarting, err)
+	}
+}
+
+func TestDependencyBlockers(t *testing.T) {
+	newCluster := func(name string, ready bool, dependsOn ...string) *api.EtcdCluster {
+		return &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{DependsOn: dependsOn},
+			Status:     api.ClusterStatus{Ready: ready},
+		}
+	}
+	crcli := fakeetcd.NewSimpleClientset(
+		newCluster("infra", true),
+		newCluster("dns", false, "infra"),
+		newCluster("a", false, "b"),
+		newCluster("b", false, "app-cycle"),
+		// ready clusters are not followed, whatever they depend on.
+		newCluster("legacy", true, "app-ready"),
+	)
+	get := func(name string) (*api.EtcdCluster, error) {
+		return crcli.EtcdV1beta2().EtcdClusters(metav1.NamespaceDefault).Get(name, metav1.GetOptions{})
+	}
+
+	tests := []struct {
+		cl     *api.EtcdCluster
+		expect string
+	}{
+		{newCluster("app-ready", false, "infra", "legacy"), ""},
+		{newCluster("app", false, "infra", "dns", "missing"), "clusters [missing] not found; waiting for clusters [dns] to be ready"},
+		{newCluster("app-cycle", false, "infra", "a"), "dependency cycle app-cycle -> a -> b -> app-cycle"},
+	}
+	for i, tt := range tests {
+		blocked, err := dependencyBlockers(tt.cl, get)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if blocked != tt.expect {
+			t.Errorf("#%d: expect %q, got %q", i, tt.expect, blocked)
+		}
+	}
+}
+
+func TestExpiryOf(t *testing.T) {
+	created := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ttl     int64
+		expiry  time.Time
+		warning time.Time
+	}{
+		{3600, created.Add(time.Hour), created.Add(55 * time.Minute)},
+		// The warning of a short lived cluster comes at half its TTL.
+		{120, created.Add(2 * time.Minute), created.Add(time.Minute)},
+	}
+	for i, tt := range tests {
+		cl := &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+			Spec:       api.ClusterSpec{TTLInSecond: tt.ttl},
+		}
+		expiry, warning, ok := expiryOf(cl)
+		if !ok || !expiry.Equal(tt.expiry) || !warning.Equal(tt.warning) {
+			t.Errorf("#%d: expect expiry at %v warned at %v, got %v at %v (%v)", i, tt.expiry, tt.warning, expiry, warning, ok)
+		}
+	}
+	if _, _, ok := expiryOf(&api.EtcdCluster{}); ok {
+		t.Error("expect no expiry without spec.ttlInSecond")
+	}
+}
+
+func TestRenderPod(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		Spec:       api.ClusterSpec{Size: 1, Version: "3.2.13"},
+	}
+	existing := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-0000", Namespace: metav1.NamespaceDefault, Labels: k8sutil.LabelsForCluster("test"),
+		Annotations: map[string]string{k8sutil.AnnotationMemberGeneration: "3", k8sutil.AnnotationMemberCreationReason: string(api.MemberCreationScaleUp)},
+	}}
+	kubecli := fake.NewSimpleClientset(existing)
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		config:  Config{KubeCli: kubecli},
+		cluster: cl,
+		members: etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault}),
+		status:  api.ClusterStatus{MemberGeneration: 3},
+	}
+
+	pod, err := c.renderPod("test-0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name != "test-0000" || pod.Annotations[k8sutil.AnnotationMemberGeneration] != "3" {
+		t.Errorf("expect the pod of test-0000 of generation 3, got %s of generation %s", pod.Name, pod.Annotations[k8sutil.AnnotationMemberGeneration])
+	}
+	pod, err = c.renderPod("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name == "test-0000" || pod.Annotations[k8sutil.AnnotationMemberGeneration] != "4" {
+		t.Errorf("expect the pod of a new member of generation 4, got %s of generation %s", pod.Name, pod.Annotations[k8sutil.AnnotationMemberGeneration])
+	}
+	if _, err := c.renderPod("test-0005"); err != ErrMemberNotFound {
+		t.Errorf("expect ErrMemberNotFound, got %v", err)
+	}
+
+	pods, err := kubecli.CoreV1().Pods(metav1.NamespaceDefault).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 {
+		t.Errorf("expect no pod created, got %d pods", len(pods.Items))
+	}
+}
+
+func TestResolveTimeouts(t *testing.T) {
+	if got := resolveTimeouts(Timeouts{}, nil); got != DefaultTimeouts {
+		t.Errorf("expect the default timeouts, got %+v", got)
+	}
+
+	operator := Timeouts{MemberAdd: 30 * time.Second, Defrag: 20 * time.Minute}
+	got := resolveTimeouts(operator, &api.TimeoutPolicy{DefragTimeoutInSecond: 60, DeleteTimeoutInSecond: 10})
+	want := DefaultTimeouts
+	want.MemberAdd = 30 * time.Second
+	want.Defrag = time.Minute
+	want.Delete = 10 * time.Second
+	if got != want {
+		t.Errorf("expect %+v, got %+v", want, got)
+	}
+}
+
+func TestCheckClusterIDs(t *testing.T) {
+	tests := []struct {
+		recorded    string
+		ids         map[string]string
+		wantRecord  string
+		wantMessage string
+	}{
+		{"", nil, "", ""},
+		{"", map[string]string{"test-0000": "a1", "test-0001": "a1"}, "a1", ""},
+		{"", map[string]string{"test-0000": "a1", "test-0001": "b2"},
+			"", "members answer with different etcd cluster IDs: test-0000 (a1); test-0001 (b2)"},
+		{"a1", map[string]string{"test-0000": "a1", "test-0001": "a1"}, "", ""},
+		{"a1", map[string]string{"test-0000": "a1", "test-0001": "b2", "test-0002": "b2"},
+			"", "members answer with another etcd cluster ID than a1, they may be pointed at the peers of another cluster: test-0001, test-0002 (b2)"},
+	}
+	for i, tt := range tests {
+		record, message := checkClusterIDs(tt.recorded, tt.ids)
+		if record != tt.wantRecord || message != tt.wantMessage {
+			t.Errorf("#%d: expect (%q, %q), got (%q, %q)", i, tt.wantRecord, tt.wantMessage, record, message)
+		}
+	}
+}
+
+func TestCheckMemberDetailsWithoutPods(t *testing.T) {
+	w := &healthWorker{c: &Cluster{}}
+	members := etcdutil.MemberSet{}
+	members.Add(&etcdutil.Member{Name: "test-0001", ID: 0xb2})
+	members.Add(&etcdutil.Member{Name: "test-0000", ID: 0xa1})
+	got := w.checkMemberDetails(&opView{members: members, nodes: map[string]string{}})
+	want := []api.MemberDetail{
+		{Name: "test-0000", ID: "a1", Error: "no running pod"},
+		{Name: "test-0001", ID: "b2", Error: "no running pod"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expect %+v, got %+v", want, got)
+	}
+}
+
+func TestMembersOnOldStorage(t *testing.T) {
+	class := func(name string) *string { return &name }
+	pvc := func(name string, storageClass *string) *v1.PersistentVolumeClaim {
+		return &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1.PersistentVolumeClaimSpec{StorageClassName: storageClass},
+		}
+	}
+	pods := []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true), newDecidePod("test-0002", true)}
+	pvcs := map[string]*v1.PersistentVolumeClaim{}
+	for _, p := range []*v1.PersistentVolumeClaim{
+		pvc(k8sutil.PVCNameFromMember("test-0000"), class("ssd")),
+		pvc(k8sutil.PVCNameFromMember("test-0001"), class("hdd")),
+		pvc(k8sutil.PVCNameFromMember("test-0002"), nil),
+		pvc(k8sutil.WALPVCNameFromMember("test-0000"), class("hdd")),
+	} {
+		pvcs[p.Name] = p
+	}
+
+	// Without a storage class, the claims of the members are of the default class.
+	if names := membersOnOldStorage(pods, pvcs, &api.PodPolicy{PersistentVolumeClaimSpec: &v1.PersistentVolumeClaimSpec{}}); len(names) != 0 {
+		t.Errorf("expect no member to move, got %v", names)
+	}
+	pp := &api.PodPolicy{PersistentVolumeClaimSpec: &v1.PersistentVolumeClaimSpec{StorageClassName: class("ssd")}}
+	if names, want := membersOnOldStorage(pods, pvcs, pp), []string{"test-0001", "test-0002"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expect members %v to move, got %v", want, names)
+	}
+	pp.WALVolumeClaimSpec = &v1.PersistentVolumeClaimSpec{StorageClassName: class("ssd")}
+	if names, want := membersOnOldStorage(pods, pvcs, pp), []string{"test-0000", "test-0001", "test-0002"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expect members %v to move, got %v", want, names)
+	}
+	pods[1].Annotations[k8sutil.AnnotationHandsOff] = "true"
+	if names, want := membersOnOldStorage(pods, pvcs, pp), []string{"test-0000", "test-0002"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expect members %v to move, got %v", want, names)
+	}
+}
+
+func TestRaftLag(t *testing.T) {
+	name, lag := raftLag(map[string]uint64{"test-0000": 120, "test-0001": 20, "test-0002": 118})
+	if name != "test-0001" || lag != 100 {
+		t.Errorf("expect test-0001 100 entries behind, got %s %d entries behind", name, lag)
+	}
+	if name, lag := raftLag(map[string]uint64{"test-0000": 7, "test-0001": 7}); name != "test-0000" || lag != 0 {
+		t.Errorf("expect no lag, got %s %d entries behind", name, lag)
+	}
+}
+
+func TestReplaceMemberForMetricsWaitsForQuorum(t *testing.T) {
+	c := &Cluster{
+		logger:  logrus.WithField("pkg", "cluster"),
+		cluster: &api.EtcdCluster{Spec: api.ClusterSpec{Size: 3, RepairBudget: &api.RepairBudgetPolicy{MaxMemberReplacementsPerHour: 1}}},
+		members: newDecideMembers("test-0000", "test-0001", "test-0002"),
+	}
+	pods := []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", false), newDecidePod("test-0002", true)}
+	// Replacing a ready member while another is unready would leave 1 of 3 members.
+	if err := c.replaceMemberForMetrics(pods, "test-0000"); err != nil {
+		t.Fatal(err)
+	}
+	if c.members.Size() != 3 {
+		t.Errorf("expect no member removed, got members %v", c.members.Names())
+	}
+	if len(c.replacements) != 0 {
+		t.Errorf("expect no replacement budget used, got %d replacements", len(c.replacements))
+	}
+}
+
+func TestReloadCredentialsIfRotated(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		Spec: api.ClusterSpec{
+			Auth: &api.AuthPolicy{MembershipSecret: "etcd-root", ProbeSecret: "etcd-probe"},
+		},
+	}
+	newSecret := func(name, password, version string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cl.Namespace, ResourceVersion: version},
+			Data: map[string][]byte{
+				v1.BasicAuthUsernameKey: []byte(name),
+				v1.BasicAuthPasswordKey: []byte(password),
+			},
+		}
+	}
+	kubecli := fake.NewSimpleClientset(newSecret("etcd-root", "old", "1"), newSecret("etcd-probe", "probe", "1"))
+	c := &Cluster{
+		cluster: cl,
+		config:  Config{KubeCli: kubecli},
+		logger:  logrus.WithField("pkg", "test"),
+	}
+	if err := c.loadCredentials(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.reloadCredentialsIfRotated(); err != nil {
+		t.Fatal(err)
+	}
+	if c.membershipUser.Password != "old" {
+		t.Errorf("membership password = %q before rotation, want %q", c.membershipUser.Password, "old")
+	}
+
+	if _, err := kubecli.CoreV1().Secrets(cl.Namespace).Update(newSecret("etcd-root", "new", "2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reloadCredentialsIfRotated(); err != nil {
+		t.Fatal(err)
+	}
+	if c.membershipUser.Password != "new" {
+		t.Errorf("membership password = %q after rotation, want %q", c.membershipUser.Password, "new")
+	}
+	if c.authSecretVersions["etcd-root"] != "2" {
+		t.Errorf("recorded resourceVersion = %q, want %q", c.authSecretVersions["etcd-root"], "2")
+	}
+}
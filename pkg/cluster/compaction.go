@@ -0,0 +1,48 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+)
+
+// compactIfDue compacts the cluster history according to spec.compaction
+// once the compaction interval has passed since the last attempt.
+func (c *Cluster) compactIfDue() error {
+	cp := c.cluster.Spec.Compaction
+	if cp == nil {
+		return nil
+	}
+	if time.Since(c.lastCompaction) < time.Duration(cp.IntervalInSecond)*time.Second {
+		return nil
+	}
+	c.lastCompaction = time.Now()
+
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	rev, err := etcdutil.CompactHistory(c.ctx, etcdcli, cp.RetentionRevisions)
+	if err != nil {
+		return err
+	}
+	if rev > c.status.CompactedRevision {
+		c.logger.Infof("compacted history to revision %d", rev)
+		c.status.CompactedRevision = rev
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// publishConnectionInfo keeps the connection info ConfigMap, and for TLS clusters the Secret,
+// up to date with the members and the client certificates in the operator secret.
+// The hints of the members are updated as their pods become ready or not, and as the leader changes.
+// It also keeps the etcdctl environment Secret up to date.
+// Nothing is published for a standby cluster until it is promoted, so that applications do not write to it.
+func (c *Cluster) publishConnectionInfo(running []*v1.Pod) error {
+	if c.isStandby() {
+		return nil
+	}
+	var (
+		ns  = c.cluster.Namespace
+		d   *k8sutil.TLSData
+		ca  []byte
+		err error
+	)
+	if c.isSecureClient() {
+		d, err = k8sutil.GetTLSDataFromSecret(c.config.KubeCli, ns, c.cluster.Spec.TLS.Static.OperatorSecret)
+		if err != nil {
+			return err
+		}
+		ca = d.CAData
+	}
+
+	labels := k8sutil.PropagatedLabels(c.cluster)
+	cm := k8sutil.NewConnectionInfoConfigMap(c.cluster.Name, ns, c.cluster.Spec.ClientPort, c.isSecureClient(), c.memberEndpoints(running), ca, c.cluster.AsOwner())
+	k8sutil.AddLabels(cm.GetObjectMeta(), labels)
+	if err := k8sutil.ApplyConfigMap(c.config.KubeCli, cm); err != nil {
+		return err
+	}
+	s := k8sutil.NewEtcdctlSecret(c.cluster.Name, ns, c.cluster.Spec.ClientPort, d, c.cluster.AsOwner())
+	k8sutil.AddLabels(s.GetObjectMeta(), labels)
+	if err := k8sutil.ApplySecret(c.config.KubeCli, s); err != nil {
+		return err
+	}
+	if d == nil {
+		return nil
+	}
+	s = k8sutil.NewConnectionInfoSecret(c.cluster.Name, ns, d, c.cluster.AsOwner())
+	k8sutil.AddLabels(s.GetObjectMeta(), labels)
+	return k8sutil.ApplySecret(c.config.KubeCli, s)
+}
+
+// memberEndpoints returns the client endpoints of the members, with the readiness of their running pod.
+func (c *Cluster) memberEndpoints(running []*v1.Pod) []k8sutil.MemberEndpoint {
+	ready := map[string]bool{}
+	for _, pod := range running {
+		ready[pod.Name] = k8sutil.IsPodReady(pod)
+	}
+	var endpoints []k8sutil.MemberEndpoint
+	for _, m := range c.members {
+		endpoints = append(endpoints, k8sutil.MemberEndpoint{
+			Name:   m.Name,
+			URL:    m.ClientURL(),
+			Ready:  ready[m.Name],
+			Leader: m.Name == c.status.Leader,
+		})
+	}
+	return endpoints
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// createRetries is the number of times the creation of an object of a member is retried after a transient failure.
+	createRetries       = 2
+	createRetryInterval = time.Second
+)
+
+// imagePullWaitingReasons are the reasons a container waits for an image that it fails to pull.
+var imagePullWaitingReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// createObject creates the object desc, e.g. "pod example-0000", with create. It retries right away after
+// a transient failure, and returns a permanentCreateError if the API server rejects the object.
+// An object that already exists on a retry was created by the attempt that timed out.
+func (c *Cluster) createObject(desc string, create func() error) error {
+	var err error
+	attempt := 0
+	retryErr := retryutil.RetryContext(c.ctx, createRetryInterval, createRetries, func() (bool, error) {
+		attempt++
+		err = create()
+		if err == nil || attempt > 1 && k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+			return true, nil
+		}
+		permanent, transient := classifyCreateError(err)
+		switch {
+		case permanent:
+			return false, &permanentCreateError{err}
+		case transient:
+			c.logger.Warningf("failed to create %s, retrying: %v", desc, err)
+			return false, nil
+		}
+		return false, err
+	})
+	if retryutil.IsRetryFailure(retryErr) {
+		return err
+	}
+	return retryErr
+}
+
+// undoAddMember removes the member added to the cluster whose pod could not be created, and its PVCs.
+// It would count towards quorum without ever running, and its pod would never be created if the failure is permanent.
+func (c *Cluster) undoAddMember(etcdcli *clientv3.Client, m *etcdutil.Member) {
+	if err := etcdutil.RemoveMember(c.ctx, etcdcli, m.ID, c.timeouts().Delete); err != nil {
+		c.logger.Errorf("failed to remove member (%s) whose pod was not created: %v", m.Name, err)
+		return
+	}
+	c.members.Remove(m.Name)
+	delete(c.learnerSince, m.Name)
+	if c.isPodPVEnabled() {
+		for _, name := range []string{k8sutil.PVCNameFromMember(m.Name), k8sutil.WALPVCNameFromMember(m.Name)} {
+			if err := c.removePVC(name); err != nil {
+				c.logger.Warningf("failed to remove PVC of member (%s) whose pod was not created: %v", m.Name, err)
+			}
+		}
+	}
+}
+
+// imagePullFailures returns why the pending pods cannot pull their images, e.g. after a typo in spec.repository,
+// one line per pod.
+func imagePullFailures(pending []*v1.Pod) []string {
+	var failures []string
+	for _, pod := range pending {
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if w := cs.State.Waiting; w != nil && imagePullWaitingReasons[w.Reason] {
+				failures = append(failures, fmt.Sprintf("pod %s cannot pull image %s: %s", pod.Name, cs.Image, w.Reason))
+				break
+			}
+		}
+	}
+	return failures
+}
+
+// reportPodCreationFailure sets the PodCreationFailed condition with the message, and creates an event
+// whenever the message changes.
+func (c *Cluster) reportPodCreationFailure(message string) {
+	c.status.SetPodCreationFailedCondition(message)
+	if message == c.podCreationFailure {
+		return
+	}
+	c.podCreationFailure = message
+	c.logger.Warningf("failed to create the pods of the cluster: %s", message)
+	if _, err := c.eventsCli.Create(k8sutil.PodCreationFailedEvent(message, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create pod creation failed event: %v", err)
+	}
+}
+
+// clearPodCreationFailure clears the PodCreationFailed condition once a reconciliation succeeds.
+func (c *Cluster) clearPodCreationFailure() {
+	c.podCreationFailure = ""
+	c.status.ClearCondition(api.ClusterConditionPodCreationFailed)
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// membershipDecision is what reconcileMembers does next to bring the members to the spec.
+type membershipDecision struct {
+	// actions are taken in order. Only the pods of unknown members are removed before a membership change,
+	// which ends the reconciliation.
+	actions []PlanAction
+	// lostQuorum tells whether too few members have a running pod to change the membership.
+	lostQuorum bool
+	// blocked is why the cluster cannot be scaled down yet, if it cannot.
+	blocked string
+}
+
+// decideMembers decides how to reconcile the members with the running pods and the spec, without side effects:
+//  1. The pods that are not of a member are removed.
+//  2. If a member has no running pod, and the members with a running pod keep quorum, one such member is removed,
+//     so that it is replaced by a member added at the next reconciliation. A member whose pod is leaving,
+//     i.e. being deleted, has no running pod.
+//  3. Otherwise, one member is added or removed to get to spec.size. An unready member is removed first,
+//     and a ready member only if the other members keep quorum. A cluster of an odd size only shrinks
+//     once the other members are all ready, see shrinkSteps.
+//
+// The members and pods are taken in name order, so that the decision only depends on its inputs.
+func decideMembers(sp api.ClusterSpec, members etcdutil.MemberSet, pods, leaving []*v1.Pod, leader string) membershipDecision {
+	var d membershipDecision
+	// Added are the pods that are not of a member, and removed the members without a running pod.
+	diff := members.Compare(podsToMemberSet(pods, sp))
+	for _, name := range diff.Added {
+		d.actions = append(d.actions, PlanAction{Type: PlanRemovePod, Member: name, Reason: "pod is not a member of the cluster"})
+	}
+
+	if len(diff.Removed) != 0 {
+		if len(diff.Unchanged) < members.Size()/2+1 {
+			d.lostQuorum = true
+			return d
+		}
+		d.actions = append(d.actions, removeMemberWithoutPod(diff.Removed[0], leaving))
+		return d
+	}
+
+	switch {
+	case members.Size() < sp.Size:
+		d.actions = append(d.actions, PlanAction{Type: PlanAddMember, Reason: fmt.Sprintf("scale up to %d members", sp.Size)})
+	case members.Size() > sp.Size:
+		m := pickMemberToRemove(pods, members, leader)
+		if m == nil {
+			d.blocked = "the members left are all hands-off"
+			return d
+		}
+		if err := checkRemovalQuorum(pods, m.Name, members.Size()); err != nil {
+			d.blocked = err.Error()
+			return d
+		}
+		if members.Size()%2 == 1 {
+			if err := checkShrinkStep(pods, members, m.Name, sp.Size); err != nil {
+				d.blocked = err.Error()
+				return d
+			}
+		}
+		d.actions = append(d.actions, PlanAction{Type: PlanRemoveMember, Member: m.Name, Reason: fmt.Sprintf("scale down to %d members", sp.Size)})
+	}
+	return d
+}
+
+// removeMemberWithoutPod returns the action that removes the member without a running pod:
+// RemoveLeavingMember if its pod is being deleted, RemoveDeadMember otherwise.
+func removeMemberWithoutPod(name string, leaving []*v1.Pod) PlanAction {
+	for _, pod := range leaving {
+		if pod.Name == name {
+			return PlanAction{Type: PlanRemoveLeavingMember, Member: name, Reason: "pod is being deleted"}
+		}
+	}
+	return PlanAction{Type: PlanRemoveDeadMember, Member: name, Reason: "member has no running pod"}
+}
+
+// shrinkSteps returns the sizes a cluster of the given size shrinks through to the target size: the odd sizes
+// below its size, then the target size, e.g. 5, 3 then 1 member. An odd size tolerates as many failed members
+// as the even size above it, so the cluster only goes through the even sizes between two steps, and starts the next
+// step once all its members are ready again.
+func shrinkSteps(size, target int) []int {
+	steps := []int{size}
+	for s := size - 1; s > target; s-- {
+		if s%2 == 1 {
+			steps = append(steps, s)
+		}
+	}
+	if target < size {
+		steps = append(steps, target)
+	}
+	return steps
+}
+
+// checkShrinkStep returns an error unless the members other than name are all ready, before the first member
+// of a shrink step is removed.
+func checkShrinkStep(pods []*v1.Pod, members etcdutil.MemberSet, name string, target int) error {
+	var unready []string
+	for _, pod := range pods {
+		if _, ok := members[pod.Name]; ok && pod.Name != name && !k8sutil.IsPodReady(pod) {
+			unready = append(unready, pod.Name)
+		}
+	}
+	if len(unready) != 0 {
+		steps := shrinkSteps(members.Size(), target)
+		return fmt.Errorf("waiting for members %v to be ready before shrinking from %d to %d members", unready, steps[0], steps[1])
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+)
+
+func newDecidePod(name string, ready bool) *v1.Pod {
+	pod := newPlanPod(name, "3.2.13")
+	if ready {
+		pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	}
+	return pod
+}
+
+func newDecideMembers(names ...string) etcdutil.MemberSet {
+	ms := etcdutil.MemberSet{}
+	for _, name := range names {
+		ms.Add(&etcdutil.Member{Name: name})
+	}
+	return ms
+}
+
+func TestDecideMembers(t *testing.T) {
+	tests := []struct {
+		desc       string
+		size       int
+		members    etcdutil.MemberSet
+		pods       []*v1.Pod
+		leaving    []*v1.Pod
+		leader     string
+		actions    []PlanAction
+		lostQuorum bool
+	}{{
+		desc:    "at size",
+		size:    3,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002"),
+		pods:    []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true), newDecidePod("test-0002", true)},
+	}, {
+		desc:    "unknown pods are removed before a dead member",
+		size:    3,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002"),
+		pods:    []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true), newDecidePod("test-0005", true), newDecidePod("test-0004", true)},
+		actions: []PlanAction{
+			{Type: PlanRemovePod, Member: "test-0004"},
+			{Type: PlanRemovePod, Member: "test-0005"},
+			{Type: PlanRemoveDeadMember, Member: "test-0002"},
+		},
+	}, {
+		desc:    "the first dead member by name is removed",
+		size:    5,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002", "test-0003", "test-0004"),
+		pods:    []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0002", true), newDecidePod("test-0004", true)},
+		actions: []PlanAction{{Type: PlanRemoveDeadMember, Member: "test-0001"}},
+	}, {
+		desc:    "a member whose pod is being deleted is removed as leaving",
+		size:    3,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002"),
+		pods:    []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true)},
+		leaving: []*v1.Pod{newDecidePod("test-0002", true)},
+		actions: []PlanAction{{Type: PlanRemoveLeavingMember, Member: "test-0002"}},
+	}, {
+		desc:       "no dead member is removed without quorum",
+		size:       3,
+		members:    newDecideMembers("test-0000", "test-0001", "test-0002"),
+		pods:       []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0003", true)},
+		actions:    []PlanAction{{Type: PlanRemovePod, Member: "test-0003"}},
+		lostQuorum: true,
+	}, {
+		desc:    "scale up",
+		size:    3,
+		members: newDecideMembers("test-0000"),
+		pods:    []*v1.Pod{newDecidePod("test-0000", false)},
+		actions: []PlanAction{{Type: PlanAddMember}},
+	}, {
+		desc:    "scale down keeps the leader",
+		size:    2,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002"),
+		pods:    []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true), newDecidePod("test-0002", true)},
+		leader:  "test-0000",
+		actions: []PlanAction{{Type: PlanRemoveMember, Member: "test-0001"}},
+	}, {
+		desc:    "scale down removes an unready member first",
+		size:    2,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002"),
+		pods:    []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true), newDecidePod("test-0002", false)},
+		actions: []PlanAction{{Type: PlanRemoveMember, Member: "test-0002"}},
+	}, {
+		desc:    "a shrink step removes an unready member once the others are ready",
+		size:    1,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002", "test-0003", "test-0004"),
+		pods: []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true), newDecidePod("test-0002", true),
+			newDecidePod("test-0003", true), newDecidePod("test-0004", false)},
+		actions: []PlanAction{{Type: PlanRemoveMember, Member: "test-0004"}},
+	}, {
+		desc:    "a shrink step waits for the other members to be ready",
+		size:    1,
+		members: newDecideMembers("test-0000", "test-0001", "test-0002", "test-0003", "test-0004"),
+		pods: []*v1.Pod{newDecidePod("test-0000", true), newDecidePod("test-0001", true), newDecidePod("test-0002", true),
+			newDecidePod("test-0003", false), newDecidePod("test-0004", false)},
+	}}
+	for _, tt := range tests {
+		d := decideMembers(api.ClusterSpec{Size: tt.size}, tt.members, tt.pods, tt.leaving, tt.leader)
+		var actions []PlanAction
+		for _, a := range d.actions {
+			actions = append(actions, PlanAction{Type: a.Type, Member: a.Member})
+		}
+		if !reflect.DeepEqual(actions, tt.actions) {
+			t.Errorf("%s: expect actions %v, got %v", tt.desc, tt.actions, actions)
+		}
+		if d.lostQuorum != tt.lostQuorum {
+			t.Errorf("%s: expect lost quorum %v, got %v", tt.desc, tt.lostQuorum, d.lostQuorum)
+		}
+	}
+}
+
+func TestShrinkSteps(t *testing.T) {
+	tests := []struct {
+		size, target int
+		want         []int
+	}{
+		{size: 5, target: 1, want: []int{5, 3, 1}},
+		{size: 4, target: 1, want: []int{4, 3, 1}},
+		{size: 7, target: 2, want: []int{7, 5, 3, 2}},
+		{size: 3, target: 2, want: []int{3, 2}},
+		{size: 3, target: 3, want: []int{3}},
+	}
+	for _, tt := range tests {
+		if got := shrinkSteps(tt.size, tt.target); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("shrinkSteps(%d, %d)=%v, want=%v", tt.size, tt.target, got, tt.want)
+		}
+	}
+}
+
+// simCluster is a model of a cluster that takes the membership decisions of decideMembers.
+// Added members get a ready pod, and the pods that are not ready never become ready.
+type simCluster struct {
+	size    int
+	members etcdutil.MemberSet
+	// ready is the readiness of the running pods, by name.
+	ready  map[string]bool
+	leader string
+	next   int
+}
+
+func (s *simCluster) pods() []*v1.Pod {
+	var pods []*v1.Pod
+	for name, ready := range s.ready {
+		pods = append(pods, newDecidePod(name, ready))
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods
+}
+
+// readyMembers counts the members, other than exclude, with a ready pod.
+func (s *simCluster) readyMembers(exclude string) int {
+	n := 0
+	for name := range s.members {
+		if name != exclude && s.ready[name] {
+			n++
+		}
+	}
+	return n
+}
+
+// step takes the decision of decideMembers and checks that it is deterministic and never loses quorum.
+// It returns false if no action is taken.
+func (s *simCluster) step(t *testing.T) bool {
+	pods := s.pods()
+	d := decideMembers(api.ClusterSpec{Size: s.size}, s.members, pods, nil, s.leader)
+	if again := decideMembers(api.ClusterSpec{Size: s.size}, s.members, pods, nil, s.leader); !reflect.DeepEqual(d, again) {
+		t.Fatalf("%s: decisions differ for the same inputs: %+v and %+v", s, d, again)
+	}
+	if d.lostQuorum && len(d.blocked) != 0 {
+		t.Fatalf("%s: both lost quorum and blocked", s)
+	}
+
+	for i, a := range d.actions {
+		if a.Type != PlanRemovePod && i != len(d.actions)-1 {
+			t.Fatalf("%s: membership change %v is not the last action of %v", s, a, d.actions)
+		}
+		switch a.Type {
+		case PlanRemovePod:
+			if _, ok := s.members[a.Member]; ok {
+				t.Fatalf("%s: removing the pod of member %s", s, a.Member)
+			}
+			delete(s.ready, a.Member)
+		case PlanRemoveDeadMember:
+			if _, ok := s.ready[a.Member]; ok {
+				t.Fatalf("%s: removing member %s as dead while its pod runs", s, a.Member)
+			}
+			running := 0
+			for name := range s.members {
+				if _, ok := s.ready[name]; ok {
+					running++
+				}
+			}
+			if running < s.members.Size()/2+1 {
+				t.Fatalf("%s: removing dead member %s without quorum", s, a.Member)
+			}
+			s.members.Remove(a.Member)
+		case PlanAddMember:
+			if s.members.Size() >= s.size {
+				t.Fatalf("%s: adding a member at size", s)
+			}
+			name := fmt.Sprintf("test-%04d", s.next)
+			s.next++
+			s.members.Add(&etcdutil.Member{Name: name})
+			s.ready[name] = true
+		case PlanRemoveMember:
+			if s.members.Size() <= s.size {
+				t.Fatalf("%s: removing a member at size", s)
+			}
+			if s.ready[a.Member] && !hasQuorum(s.members.Size()-1, s.readyMembers(a.Member)) {
+				t.Fatalf("%s: removing ready member %s loses quorum", s, a.Member)
+			}
+			s.members.Remove(a.Member)
+			delete(s.ready, a.Member)
+		}
+	}
+	return len(d.actions) != 0
+}
+
+func (s *simCluster) String() string {
+	return fmt.Sprintf("size %d, members %v, ready %v, leader %q", s.size, s.members.Names(), s.ready, s.leader)
+}
+
+// newRandomSimCluster returns a cluster of up to 7 members, some with an unready or no pod,
+// and up to 2 pods that are not of a member.
+func newRandomSimCluster(r *rand.Rand) *simCluster {
+	s := &simCluster{
+		size:    1 + r.Intn(7),
+		members: etcdutil.MemberSet{},
+		ready:   map[string]bool{},
+	}
+	n, unknown := 1+r.Intn(7), r.Intn(3)
+	for ; s.next < n+unknown; s.next++ {
+		name := fmt.Sprintf("test-%04d", s.next)
+		if s.next < n {
+			s.members.Add(&etcdutil.Member{Name: name})
+		}
+		switch r.Intn(4) {
+		case 0:
+			// No running pod.
+		case 1:
+			s.ready[name] = false
+		default:
+			s.ready[name] = true
+		}
+	}
+	if r.Intn(2) == 0 {
+		s.leader = fmt.Sprintf("test-%04d", r.Intn(n))
+	}
+	return s
+}
+
+// TestDecideMembersRandom runs decideMembers on random clusters until it takes no more action.
+// A cluster whose pods are all ready and that keeps quorum must get to its size.
+func TestDecideMembersRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		s := newRandomSimCluster(r)
+		converges := s.readyMembers("") >= s.members.Size()/2+1
+		for _, ready := range s.ready {
+			converges = converges && ready
+		}
+		initial := s.String()
+
+		steps := 0
+		for ; s.step(t); steps++ {
+			if steps > 20 {
+				t.Fatalf("%s: no end to the decisions", initial)
+			}
+		}
+		if converges && s.members.Size() != s.size {
+			t.Fatalf("%s: stopped at %d members", initial, s.members.Size())
+		}
+	}
+}
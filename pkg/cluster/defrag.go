@@ -0,0 +1,143 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+)
+
+var (
+	defragServingCheckInterval = 2 * time.Second
+	defragServingCheckRetries  = 15
+)
+
+// defragIfDue defragments the members according to spec.defragmentation
+// once the defragmentation interval has passed since the last attempt.
+func (c *Cluster) defragIfDue() error {
+	dp := c.cluster.Spec.Defragmentation
+	if dp == nil {
+		return nil
+	}
+	if time.Since(c.lastDefrag) < time.Duration(dp.IntervalInSecond)*time.Second {
+		return nil
+	}
+	c.lastDefrag = time.Now()
+	return c.defragment()
+}
+
+// defragment defragments one member at a time, waiting for each to serve again before moving on.
+// A defragmenting member blocks all its requests, so the leader is never defragmented directly:
+// the followers go first, then leadership is moved to one of them and the former leader goes last.
+// Without MoveLeader support (etcd < 3.3) the leader is left alone.
+func (c *Cluster) defragment() error {
+	ids := map[string]uint64{}
+	var leaderID uint64
+	for _, m := range c.members {
+		st, err := etcdutil.MemberStatus(c.ctx, m.ClientURL(), c.tlsConfig, c.clientOptions())
+		if err != nil {
+			return fmt.Errorf("failed to get status of member (%s): %v", m.Name, err)
+		}
+		ids[m.Name] = st.Header.MemberId
+		if st.Leader == st.Header.MemberId {
+			leaderID = st.Leader
+		}
+	}
+
+	followers, leader := defragOrder(c.members, ids, leaderID)
+	for _, m := range followers {
+		if err := c.defragmentMember(m); err != nil {
+			return err
+		}
+	}
+	if leader == nil {
+		return nil
+	}
+	// A single member has nobody to hand leadership to and is unavailable during the defragmentation either way.
+	if len(followers) == 0 {
+		return c.defragmentMember(leader)
+	}
+
+	// Defragmenting the followers can take minutes, during which leadership may have moved to one of them.
+	st, err := etcdutil.MemberStatus(c.ctx, leader.ClientURL(), c.tlsConfig, c.clientOptions())
+	if err != nil {
+		return fmt.Errorf("failed to get status of member (%s): %v", leader.Name, err)
+	}
+	if st.Leader != st.Header.MemberId {
+		c.logger.Infof("member (%s) is no longer the leader", leader.Name)
+		return c.defragmentMember(leader)
+	}
+	if !c.supports(etcdutil.FeatureMoveLeader) {
+		c.logger.Infof("skip defragmenting leader (%s): moving leadership requires etcd 3.3 or later, running %s",
+			leader.Name, c.etcdVersion)
+		return nil
+	}
+	transfereeID, ok := pickTransferee(followers, ids)
+	if !ok {
+		c.logger.Infof("skip defragmenting leader (%s): no voting member to move leadership to", leader.Name)
+		return nil
+	}
+	c.logger.Infof("moving leadership away from member (%s) before defragmenting it", leader.Name)
+	if err := etcdutil.MoveLeader(c.ctx, leader.ClientURL(), c.tlsConfig, c.clientOptions(), transfereeID); err != nil {
+		return fmt.Errorf("failed to move leadership away from member (%s): %v", leader.Name, err)
+	}
+	return c.defragmentMember(leader)
+}
+
+// defragOrder splits the members into the followers, sorted by name, and the leader, whose ID is leaderID.
+// The leader is nil if none of the members is known to lead.
+func defragOrder(members etcdutil.MemberSet, ids map[string]uint64, leaderID uint64) (followers []*etcdutil.Member, leader *etcdutil.Member) {
+	for _, m := range members {
+		if leaderID != 0 && ids[m.Name] == leaderID {
+			leader = m
+			continue
+		}
+		followers = append(followers, m)
+	}
+	sort.Slice(followers, func(i, j int) bool { return followers[i].Name < followers[j].Name })
+	return followers, leader
+}
+
+// pickTransferee returns the ID of the first of the defragmented members leadership can be moved to.
+// Learners cannot lead.
+func pickTransferee(defragmented []*etcdutil.Member, ids map[string]uint64) (uint64, bool) {
+	for _, m := range defragmented {
+		if !m.IsLearner && ids[m.Name] != 0 {
+			return ids[m.Name], true
+		}
+	}
+	return 0, false
+}
+
+func (c *Cluster) defragmentMember(m *etcdutil.Member) error {
+	c.logger.Infof("defragmenting member (%s)", m.Name)
+	if err := etcdutil.Defragment(c.ctx, m.ClientURL(), c.tlsConfig, c.clientOptions(), c.timeouts().Defrag); err != nil {
+		return fmt.Errorf("failed to defragment member (%s): %v", m.Name, err)
+	}
+
+	err := retryutil.RetryContext(c.ctx, defragServingCheckInterval, defragServingCheckRetries, func() (bool, error) {
+		_, err := etcdutil.MemberStatus(c.ctx, m.ClientURL(), c.tlsConfig, c.clientOptions())
+		return err == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("member (%s) is not serving after defragmentation: %v", m.Name, err)
+	}
+	c.logger.Infof("defragmented member (%s)", m.Name)
+	return nil
+}
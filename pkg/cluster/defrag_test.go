@@ -0,0 +1,81 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+)
+
+func TestDefragOrder(t *testing.T) {
+	members := etcdutil.MemberSet{
+		"test-0002": &etcdutil.Member{Name: "test-0002"},
+		"test-0000": &etcdutil.Member{Name: "test-0000"},
+		"test-0001": &etcdutil.Member{Name: "test-0001"},
+	}
+	ids := map[string]uint64{"test-0000": 10, "test-0001": 11, "test-0002": 12}
+	tests := []struct {
+		leaderID      uint64
+		wantFollowers []string
+		wantLeader    string
+	}{
+		{leaderID: 11, wantFollowers: []string{"test-0000", "test-0002"}, wantLeader: "test-0001"},
+		{leaderID: 10, wantFollowers: []string{"test-0001", "test-0002"}, wantLeader: "test-0000"},
+		// Without a known leader, all members are defragmented as followers.
+		{leaderID: 0, wantFollowers: []string{"test-0000", "test-0001", "test-0002"}},
+		{leaderID: 99, wantFollowers: []string{"test-0000", "test-0001", "test-0002"}},
+	}
+	for i, tt := range tests {
+		followers, leader := defragOrder(members, ids, tt.leaderID)
+		var names []string
+		for _, m := range followers {
+			names = append(names, m.Name)
+		}
+		if !reflect.DeepEqual(names, tt.wantFollowers) {
+			t.Errorf("#%d: expect followers %v, got %v", i, tt.wantFollowers, names)
+		}
+		var leaderName string
+		if leader != nil {
+			leaderName = leader.Name
+		}
+		if leaderName != tt.wantLeader {
+			t.Errorf("#%d: expect leader %q, got %q", i, tt.wantLeader, leaderName)
+		}
+	}
+}
+
+func TestPickTransferee(t *testing.T) {
+	ids := map[string]uint64{"test-0000": 10, "test-0001": 11}
+	tests := []struct {
+		defragmented []*etcdutil.Member
+		wantID       uint64
+		wantOK       bool
+	}{
+		{defragmented: nil},
+		{defragmented: []*etcdutil.Member{{Name: "test-0000"}, {Name: "test-0001"}}, wantID: 10, wantOK: true},
+		{defragmented: []*etcdutil.Member{{Name: "test-0000", IsLearner: true}, {Name: "test-0001"}}, wantID: 11, wantOK: true},
+		{defragmented: []*etcdutil.Member{{Name: "test-0000", IsLearner: true}}},
+		// A member whose ID is unknown cannot be moved to.
+		{defragmented: []*etcdutil.Member{{Name: "test-0002"}}},
+	}
+	for i, tt := range tests {
+		id, ok := pickTransferee(tt.defragmented, ids)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("#%d: pickTransferee()=(%d, %v), want=(%d, %v)", i, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// tearDownConcurrency is the number of objects the deletion policy is applied to at once.
+	tearDownConcurrency = 5
+	// tearDownPassTimeout bounds an attempt to apply the deletion policy, so that a slow API server
+	// does not hold up the run loop: the objects not started on by then are left to the next attempt.
+	tearDownPassTimeout = time.Minute
+)
+
+// A cluster with spec.deletionPolicy is held by the FinalizerDeletionPolicy finalizer once it is deleted,
+// until the run loop applied the policy. The garbage collector deletes the pods of a cluster deleted in the background,
+// the default of kubectl, only once the finalizer is removed, so that the final snapshot is saved from its running members.
+
+func hasDeletionFinalizer(cl *api.EtcdCluster) bool {
+	for _, f := range cl.Finalizers {
+		if f == k8sutil.FinalizerDeletionPolicy {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutDeletionFinalizer(finalizers []string) []string {
+	var fs []string
+	for _, f := range finalizers {
+		if f != k8sutil.FinalizerDeletionPolicy {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// syncDeletionFinalizer adds the finalizer to a cluster with a deletion policy, and removes it from a cluster without one.
+func (c *Cluster) syncDeletionFinalizer() error {
+	want := c.cluster.Spec.DeletionPolicy != nil
+	if want == hasDeletionFinalizer(c.cluster) {
+		return nil
+	}
+	finalizers := withoutDeletionFinalizer(c.cluster.Finalizers)
+	if want {
+		finalizers = append(finalizers, k8sutil.FinalizerDeletionPolicy)
+	}
+	cl, err := patchFinalizers(c.config.EtcdCRCli, c.cluster, finalizers)
+	if err != nil {
+		return err
+	}
+	// Only the metadata of the local copy is updated, as its spec has the defaults applied.
+	c.cluster.Finalizers = cl.Finalizers
+	c.cluster.ResourceVersion = cl.ResourceVersion
+	return nil
+}
+
+// patchFinalizers sets the finalizers of the cluster with a merge patch, which fails if the cluster changed since cl was read.
+func patchFinalizers(crcli versioned.Interface, cl *api.EtcdCluster, finalizers []string) (*api.EtcdCluster, error) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": cl.ResourceVersion,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crcli.EtcdV1beta2().EtcdClusters(cl.Namespace).Patch(cl.Name, types.MergePatchType, patch)
+}
+
+// tearDown applies the deletion policy of the deleted cluster once its final snapshot, if any, is saved.
+// It is called at every reconciliation of the deleted cluster until the finalizer is removed.
+func (c *Cluster) tearDown() error {
+	if !hasDeletionFinalizer(c.cluster) {
+		return nil
+	}
+	if p := c.cluster.Spec.DeletionPolicy; p != nil && p.FinalSnapshot {
+		waiting, err := c.finalSnapshot()
+		if err != nil {
+			waiting = err.Error()
+		}
+		if len(waiting) != 0 {
+			timeout := c.timeouts().Snapshot
+			if p.FinalSnapshotTimeoutInSecond > 0 {
+				timeout = time.Duration(p.FinalSnapshotTimeoutInSecond) * time.Second
+			}
+			if time.Since(c.cluster.DeletionTimestamp.Time) < timeout {
+				c.logger.Infof("the cluster is torn down once its final snapshot is saved: %s", waiting)
+				return nil
+			}
+			c.logger.Warningf("tearing the cluster down without a final snapshot after %v: %s", timeout, waiting)
+			c.config.Notifier.Notify("etcd cluster %s/%s is torn down without a final snapshot: %s", c.cluster.Namespace, c.cluster.Name, waiting)
+		}
+	}
+	c.logger.Info("tearing the cluster down")
+	st, err := TearDown(c.config.KubeCli, c.config.EtcdCRCli, c.cluster)
+	if err == nil && (st == nil || st.Completed == st.Total) {
+		c.cluster.Finalizers = withoutDeletionFinalizer(c.cluster.Finalizers)
+		return nil
+	}
+	if st != nil {
+		c.logger.Infof("the deletion policy is applied to %d of %d objects", st.Completed, st.Total)
+		c.status.TearDown = st
+		if err := c.updateCRStatus(); err != nil {
+			c.logger.Warningf("failed to update the tear down progress: %v", err)
+		}
+	}
+	return err
+}
+
+// finalSnapshot backs the cluster up to the storage of its latest successful backup, tagged "final-<deletion time>".
+// It returns why the cluster must wait for the snapshot, if it must. A cluster without backups is not backed up.
+func (c *Cluster) finalSnapshot() (string, error) {
+	backupCli := c.config.EtcdCRCli.EtcdV1beta2().EtcdBackups(c.cluster.Namespace)
+	name := finalBackupName(c.cluster)
+	eb, err := backupCli.Get(name, metav1.GetOptions{})
+	if err == nil {
+		return oneOffBackupWait("final snapshot", eb), nil
+	}
+	if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return "", err
+	}
+	backups, err := backupCli.List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	latest := k8sutil.LatestBackup(c.cluster.Name, c.cluster.Namespace, backups.Items)
+	if latest == nil {
+		c.logger.Warningf("no final snapshot: the cluster has no successful backup to take the storage of")
+		return "", nil
+	}
+	eb = newOneOffBackup(name, fmt.Sprintf("final-%d", c.cluster.DeletionTimestamp.Unix()), latest)
+	eb.Labels = k8sutil.PropagatedLabels(c.cluster)
+	if _, err := backupCli.Create(eb); err != nil {
+		return "", fmt.Errorf("failed to create final snapshot (%s): %v", name, err)
+	}
+	c.logger.Infof("backing up the cluster before it is torn down: created backup %s", name)
+	if _, err := c.eventsCli.Create(k8sutil.FinalSnapshotEvent(name, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create final snapshot event: %v", err)
+	}
+	return fmt.Sprintf("waiting for final snapshot %s", name), nil
+}
+
+// finalBackupName returns the name of the EtcdBackup of the final snapshot of the deleted cluster,
+// which is unique to this deletion.
+func finalBackupName(cl *api.EtcdCluster) string {
+	return fmt.Sprintf("%s-final-%d", cl.Name, cl.DeletionTimestamp.Unix())
+}
+
+// TearDown applies the deletion policy of the deleted cluster cl, and removes the finalizer that holds it once it is applied:
+//   - the persistent volume claims, and the secrets unless they are deleted, are released from the cluster,
+//     so that the garbage collector keeps them, and annotated as retained,
+//   - the secrets of spec.TLS.static are deleted if the secrets are,
+//   - the EtcdBackups of the cluster, other than its final snapshot, are handed to the backup operator
+//     to delete with their snapshots if the backups are.
+//
+// The objects are handled tearDownConcurrency at once, and an attempt stops starting on new ones after tearDownPassTimeout.
+// Every step can be repeated, so that the next attempt resumes with the objects left. It returns the progress,
+// nil if the cluster has no finalizer.
+//
+// The run loop calls it once the final snapshot is saved, and the controller for a failed cluster, which is not run.
+func TearDown(kubecli kubernetes.Interface, crcli versioned.Interface, cl *api.EtcdCluster) (*api.TearDownStatus, error) {
+	if !hasDeletionFinalizer(cl) {
+		return nil, nil
+	}
+	steps, err := tearDownSteps(kubecli, crcli, cl)
+	if err != nil {
+		return nil, err
+	}
+	st := applyTearDownSteps(steps, tearDownPassTimeout)
+	if len(st.LastError) != 0 {
+		return st, errors.New(st.LastError)
+	}
+	if st.Completed < st.Total {
+		return st, nil
+	}
+	_, err = patchFinalizers(crcli, cl, withoutDeletionFinalizer(cl.Finalizers))
+	return st, err
+}
+
+// tearDownStep applies the deletion policy to an object. done tells whether it already is applied to it.
+type tearDownStep struct {
+	done  bool
+	apply func() error
+}
+
+// tearDownSteps lists the objects the deletion policy of the cluster applies to.
+func tearDownSteps(kubecli kubernetes.Interface, crcli versioned.Interface, cl *api.EtcdCluster) ([]tearDownStep, error) {
+	p := cl.Spec.DeletionPolicy
+	if p == nil {
+		return nil, nil
+	}
+	var steps []tearDownStep
+	if p.PersistentVolumeClaims == api.DeletionRetain {
+		s, err := retainPVCs(kubecli, cl)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, s...)
+	}
+	if p.Secrets == api.DeletionDelete {
+		steps = append(steps, deleteTLSSecrets(kubecli, cl)...)
+	} else {
+		s, err := retainSecrets(kubecli, cl)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, s...)
+	}
+	if p.Backups == api.DeletionDelete {
+		s, err := deleteBackups(crcli, cl)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, s...)
+	}
+	return steps, nil
+}
+
+// applyTearDownSteps applies the steps not done yet, tearDownConcurrency at once, and returns the progress.
+// The steps not started within timeout are left for the next attempt.
+func applyTearDownSteps(steps []tearDownStep, timeout time.Duration) *api.TearDownStatus {
+	st := &api.TearDownStatus{Total: len(steps)}
+	var pending []tearDownStep
+	for _, s := range steps {
+		if s.done {
+			st.Completed++
+		} else {
+			pending = append(pending, s)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	ch := make(chan tearDownStep)
+	var (
+		mu   sync.Mutex
+		errs []string
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < tearDownConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range ch {
+				err := s.apply()
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err.Error())
+				} else {
+					st.Completed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, s := range pending {
+		if time.Now().After(deadline) {
+			break
+		}
+		ch <- s
+	}
+	close(ch)
+	wg.Wait()
+
+	switch len(errs) {
+	case 0:
+	case 1:
+		st.LastError = errs[0]
+	default:
+		st.LastError = fmt.Sprintf("%s, and %d more errors", errs[0], len(errs)-1)
+	}
+	return st
+}
+
+// release removes the owner reference of the cluster from the object and annotates it as retained.
+// It returns whether the object changed.
+func release(om *metav1.ObjectMeta, cl *api.EtcdCluster) bool {
+	var refs []metav1.OwnerReference
+	for _, ref := range om.OwnerReferences {
+		if ref.UID != cl.UID {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == len(om.OwnerReferences) && om.Annotations[k8sutil.AnnotationRetained] == "true" {
+		return false
+	}
+	om.OwnerReferences = refs
+	if om.Annotations == nil {
+		om.Annotations = map[string]string{}
+	}
+	om.Annotations[k8sutil.AnnotationRetained] = "true"
+	return true
+}
+
+func retainPVCs(kubecli kubernetes.Interface, cl *api.EtcdCluster) ([]tearDownStep, error) {
+	pvcCli := kubecli.CoreV1().PersistentVolumeClaims(cl.Namespace)
+	pvcs, err := pvcCli.List(k8sutil.ClusterListOpt(cl.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims: %v", err)
+	}
+	var steps []tearDownStep
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		steps = append(steps, tearDownStep{
+			done: !release(&pvc.ObjectMeta, cl),
+			apply: func() error {
+				_, err := pvcCli.Update(pvc)
+				if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+					return fmt.Errorf("failed to retain persistent volume claim (%s): %v", pvc.Name, err)
+				}
+				return nil
+			},
+		})
+	}
+	return steps, nil
+}
+
+// retainSecrets retains the secrets labeled for the cluster, e.g. the CA the operator generated for it.
+// The secrets of spec.TLS.static are not owned by the cluster and are kept anyway.
+func retainSecrets(kubecli kubernetes.Interface, cl *api.EtcdCluster) ([]tearDownStep, error) {
+	secretCli := kubecli.CoreV1().Secrets(cl.Namespace)
+	secrets, err := secretCli.List(k8sutil.ClusterListOpt(cl.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %v", err)
+	}
+	var steps []tearDownStep
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		steps = append(steps, tearDownStep{
+			done: !release(&s.ObjectMeta, cl),
+			apply: func() error {
+				_, err := secretCli.Update(s)
+				if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+					return fmt.Errorf("failed to retain secret (%s): %v", s.Name, err)
+				}
+				return nil
+			},
+		})
+	}
+	return steps, nil
+}
+
+// deleteTLSSecrets deletes the secrets of spec.TLS.static. The secrets labeled for the cluster
+// are deleted by the garbage collector.
+func deleteTLSSecrets(kubecli kubernetes.Interface, cl *api.EtcdCluster) []tearDownStep {
+	tp := cl.Spec.TLS
+	if tp == nil || tp.Static == nil {
+		return nil
+	}
+	names := []string{tp.Static.OperatorSecret}
+	if m := tp.Static.Member; m != nil {
+		names = append(names, m.PeerSecret, m.ServerSecret)
+	}
+	var steps []tearDownStep
+	for _, name := range names {
+		if len(name) == 0 {
+			continue
+		}
+		name := name
+		steps = append(steps, tearDownStep{apply: func() error {
+			err := kubecli.CoreV1().Secrets(cl.Namespace).Delete(name, nil)
+			if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+				return fmt.Errorf("failed to delete secret (%s): %v", name, err)
+			}
+			return nil
+		}})
+	}
+	return steps
+}
+
+// deleteBackups annotates the EtcdBackups of the cluster, other than its final snapshot,
+// for the backup operator to delete them with their snapshots.
+func deleteBackups(crcli versioned.Interface, cl *api.EtcdCluster) ([]tearDownStep, error) {
+	backupCli := crcli.EtcdV1beta2().EtcdBackups(cl.Namespace)
+	backups, err := backupCli.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %v", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{k8sutil.AnnotationDeleteSnapshots: "true"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var steps []tearDownStep
+	for i := range backups.Items {
+		eb := &backups.Items[i]
+		if !k8sutil.IsBackupOfCluster(cl.Name, cl.Namespace, eb) {
+			continue
+		}
+		if cl.DeletionTimestamp != nil && eb.Name == finalBackupName(cl) {
+			continue
+		}
+		steps = append(steps, tearDownStep{
+			done: eb.Annotations[k8sutil.AnnotationDeleteSnapshots] == "true",
+			apply: func() error {
+				if _, err := backupCli.Patch(eb.Name, types.MergePatchType, patch); err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+					return fmt.Errorf("failed to request the deletion of backup (%s): %v", eb.Name, err)
+				}
+				return nil
+			},
+		})
+	}
+	return steps, nil
+}
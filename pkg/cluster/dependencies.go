@@ -0,0 +1,154 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dependencyPollInterval is the time between two checks of the dependencies of a cluster waiting to be created.
+const dependencyPollInterval = 10 * time.Second
+
+// waitForDependencies blocks the creation of the cluster until the clusters of its spec.dependsOn are ready.
+// While it waits, the cluster stays Pending with the Blocked condition telling why.
+// The cluster is read again at each check, so that a change of spec.dependsOn, or of the rest of the spec,
+// is taken into account before the cluster is created.
+func (c *Cluster) waitForDependencies() error {
+	if len(c.cluster.Spec.DependsOn) == 0 {
+		return nil
+	}
+	crcli := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace)
+	get := func(name string) (*api.EtcdCluster, error) {
+		return crcli.Get(name, metav1.GetOptions{})
+	}
+	for {
+		blocked, err := dependencyBlockers(c.cluster, get)
+		switch {
+		case err != nil:
+			c.logger.Warningf("failed to check the dependencies of the cluster: %v", err)
+		case len(blocked) == 0:
+			c.logger.Infof("dependencies %v are ready", c.cluster.Spec.DependsOn)
+			c.status.ClearCondition(api.ClusterConditionBlocked)
+			return nil
+		default:
+			c.logger.Infof("not creating the cluster: %s", blocked)
+			c.status.SetBlockedCondition(blocked)
+			if err := c.updateCRStatus(); err != nil {
+				c.logger.Warningf("failed to report the blocked cluster: %v", err)
+			}
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		case <-time.After(dependencyPollInterval):
+		}
+		c.refreshWaitingCluster(get)
+	}
+}
+
+// refreshWaitingCluster replaces the local copy of the cluster waiting to be created with the latest one,
+// unless its spec is invalid, which the controller rejects as well.
+func (c *Cluster) refreshWaitingCluster(get func(name string) (*api.EtcdCluster, error)) {
+	cl, err := get(c.cluster.Name)
+	if err != nil {
+		c.logger.Warningf("failed to get the cluster: %v", err)
+		return
+	}
+	cl.SetDefaults()
+	if err := k8sutil.ValidateClusterSpec(cl.Name, cl.Spec); err != nil {
+		c.logger.Warningf("ignoring invalid spec: %v", err)
+		return
+	}
+	c.cluster = cl
+}
+
+// dependencyBlockers returns why the cluster cannot be created yet: the clusters of its spec.dependsOn that are
+// missing or not ready, or a cycle of dependencies that never gets ready. It returns "" if the cluster can be created.
+// Ready clusters are not followed: they exist already, whatever they depend on.
+func dependencyBlockers(cl *api.EtcdCluster, get func(name string) (*api.EtcdCluster, error)) (string, error) {
+	var missing, unready []string
+	for _, name := range cl.Spec.DependsOn {
+		dep, err := get(name)
+		switch {
+		case k8sutil.IsKubernetesResourceNotFoundError(err):
+			missing = append(missing, name)
+		case err != nil:
+			return "", fmt.Errorf("failed to get cluster (%s): %v", name, err)
+		case !dep.Status.Ready:
+			unready = append(unready, name)
+		}
+	}
+	if len(missing) == 0 && len(unready) == 0 {
+		return "", nil
+	}
+
+	cycle, err := dependencyCycle(cl, get)
+	if err != nil {
+		return "", err
+	}
+	if len(cycle) != 0 {
+		return fmt.Sprintf("dependency cycle %s", strings.Join(cycle, " -> ")), nil
+	}
+	var reasons []string
+	if len(missing) != 0 {
+		reasons = append(reasons, fmt.Sprintf("clusters %v not found", missing))
+	}
+	if len(unready) != 0 {
+		reasons = append(reasons, fmt.Sprintf("waiting for clusters %v to be ready", unready))
+	}
+	return strings.Join(reasons, "; "), nil
+}
+
+// dependencyCycle returns the path of unready clusters, from the cluster back to itself, that depend on each other,
+// nil if there is none.
+func dependencyCycle(cl *api.EtcdCluster, get func(name string) (*api.EtcdCluster, error)) ([]string, error) {
+	visited := map[string]bool{}
+	var visit func(from *api.EtcdCluster, path []string) ([]string, error)
+	visit = func(from *api.EtcdCluster, path []string) ([]string, error) {
+		for _, name := range from.Spec.DependsOn {
+			next := append(path[:len(path):len(path)], name)
+			if name == cl.Name {
+				return next, nil
+			}
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+			dep, err := get(name)
+			if k8sutil.IsKubernetesResourceNotFoundError(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cluster (%s): %v", name, err)
+			}
+			if dep.Status.Ready {
+				continue
+			}
+			if cycle, err := visit(dep, next); len(cycle) != 0 || err != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+	return visit(cl, []string{cl.Name})
+}
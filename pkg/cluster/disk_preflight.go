@@ -0,0 +1,166 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// diskPreflight benchmarks the storage of the node the next member would be scheduled on, one reconcile at a time:
+// it starts the disk preflight pod, waits for it to complete and then judges the node.
+// It returns the node the member may be added on, or "" while the benchmark runs or once the node was refused,
+// in which case the next reconcile benchmarks another node.
+func (c *Cluster) diskPreflight() (string, error) {
+	name := k8sutil.DiskPreflightName(c.cluster.Name)
+	pod, err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return "", err
+		}
+		return "", c.startDiskPreflight()
+	}
+
+	switch pod.Status.Phase {
+	case v1.PodSucceeded:
+	case v1.PodFailed:
+		c.cleanupDiskPreflight()
+		return "", fmt.Errorf("disk preflight on node (%s) failed: %s", pod.Spec.NodeName, pod.Status.Message)
+	default:
+		// The pod creation timeout bounds scheduling the disk preflight pod and running the benchmark.
+		if timeout := c.timeouts().PodCreate; time.Since(pod.CreationTimestamp.Time) > timeout {
+			c.cleanupDiskPreflight()
+			return "", fmt.Errorf("disk preflight pod (%s) did not complete within %v", name, timeout)
+		}
+		c.logger.Infof("waiting for disk preflight pod (%s) before adding a member", name)
+		return "", nil
+	}
+
+	out, err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).
+		GetLogs(name, &v1.PodLogOptions{Container: k8sutil.DiskPreflightContainerName}).DoRaw()
+	c.cleanupDiskPreflight()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the output of disk preflight pod (%s): %v", name, err)
+	}
+	p99, err := fioFsyncP99(out)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the output of disk preflight pod (%s): %v", name, err)
+	}
+
+	node := pod.Spec.NodeName
+	max := time.Duration(c.cluster.Spec.DiskPreflight.MaxFsyncP99InMillisecond) * time.Millisecond
+	if p99 > max {
+		c.logger.Warningf("refusing node (%s) for members: fsync p99 of %v is above %v", node, p99, max)
+		c.refusedNodes[node] = true
+		_, err = c.eventsCli.Create(k8sutil.DiskPreflightFailedEvent(node, p99, max, c.cluster))
+		if err != nil {
+			c.logger.Errorf("failed to create disk preflight failed event: %v", err)
+		}
+		return "", nil
+	}
+	c.logger.Infof("node (%s) passed the disk preflight with a fsync p99 of %v", node, p99)
+	_, err = c.eventsCli.Create(k8sutil.DiskPreflightPassedEvent(node, p99, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create disk preflight passed event: %v", err)
+	}
+	return node, nil
+}
+
+func (c *Cluster) startDiskPreflight() error {
+	labels := k8sutil.PropagatedLabels(c.cluster)
+	var pvc *v1.PersistentVolumeClaim
+	if c.isPodPVEnabled() {
+		pvc = k8sutil.NewDiskPreflightPVC(c.cluster.Name, c.cluster.Namespace, c.cluster.Spec, c.cluster.AsOwner())
+		k8sutil.AddLabels(pvc.GetObjectMeta(), labels)
+		_, err := c.config.KubeCli.CoreV1().PersistentVolumeClaims(c.cluster.Namespace).Create(pvc)
+		if err != nil && !k8sutil.IsKubernetesResourceAlreadyExistError(err) {
+			return fmt.Errorf("failed to create disk preflight PVC: %v", err)
+		}
+	}
+	pod := k8sutil.NewDiskPreflightPod(c.cluster.Name, c.cluster.Namespace, c.cluster.Spec, pvc, c.cluster.AsOwner())
+	k8sutil.AddLabels(pod.GetObjectMeta(), labels)
+	k8sutil.KeepPodOffNodes(pod, c.refusedNodeList())
+	if _, err := k8sutil.CreatePod(c.config.KubeCli, c.cluster.Namespace, pod); err != nil {
+		return fmt.Errorf("failed to create disk preflight pod: %v", err)
+	}
+	c.logger.Infof("started disk preflight pod (%s)", pod.Name)
+	return nil
+}
+
+// cleanupDiskPreflight deletes the disk preflight pod and PVC.
+func (c *Cluster) cleanupDiskPreflight() {
+	name := k8sutil.DiskPreflightName(c.cluster.Name)
+	err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).Delete(name, metav1.NewDeleteOptions(0))
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		c.logger.Warningf("failed to delete disk preflight pod (%s): %v", name, err)
+	}
+	if !c.isPodPVEnabled() {
+		return
+	}
+	if err := c.removePVC(name); err != nil {
+		c.logger.Warningf("failed to delete disk preflight PVC (%s): %v", name, err)
+	}
+}
+
+// refusedNodeList returns the nodes refused by the disk preflight, sorted.
+func (c *Cluster) refusedNodeList() []string {
+	var nodes []string
+	for n := range c.refusedNodes {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// fioOutput is the part of the JSON output of fio 3.5 or later holding the fdatasync latencies.
+type fioOutput struct {
+	Jobs []struct {
+		Sync struct {
+			LatNs struct {
+				Percentile map[string]float64 `json:"percentile"`
+			} `json:"lat_ns"`
+		} `json:"sync"`
+	} `json:"jobs"`
+}
+
+// fioFsyncP99 returns the 99th percentile of the fdatasync latency from the JSON output of fio.
+// Anything fio logs before the JSON, e.g. warnings, is skipped.
+func fioFsyncP99(out []byte) (time.Duration, error) {
+	i := bytes.IndexByte(out, '{')
+	if i < 0 {
+		return 0, errors.New("no JSON in fio output")
+	}
+	fo := &fioOutput{}
+	if err := json.Unmarshal(out[i:], fo); err != nil {
+		return 0, err
+	}
+	if len(fo.Jobs) == 0 {
+		return 0, errors.New("no job in fio output")
+	}
+	p99, ok := fo.Jobs[0].Sync.LatNs.Percentile["99.000000"]
+	if !ok {
+		return 0, errors.New("no fsync latency percentiles in fio output, fio 3.5 or later is needed")
+	}
+	return time.Duration(p99), nil
+}
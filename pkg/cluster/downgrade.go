@@ -0,0 +1,76 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// prepareDowngrade enables the etcd downgrade API before the first member of a
+// minor version downgrade is rolled to the older etcd. Without it, a member of an
+// older minor version refuses to join the cluster.
+// Patch version changes and upgrades need no preparation.
+//
+// The versions are taken from the pods rather than from the detected server version,
+// so that a downgrade resumed by a restarted operator is not mistaken for a new one:
+// once a member runs the target version, the downgrade has been enabled.
+// After the last member is rolled, checkVersionConvergence verifies that every member serves the target version.
+func (c *Cluster) prepareDowngrade(pods []*v1.Pod, targetVersion string) error {
+	current, target, err := downgradeVersions(pods, targetVersion)
+	if err != nil || current.IsUnknown() {
+		return err
+	}
+
+	c.logger.Infof("enabling downgrade of the cluster from etcd %s to %s", current, target)
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	return etcdutil.EnableDowngrade(c.ctx, etcdcli, target)
+}
+
+// downgradeVersions returns the current and target minor version if rolling the pods to
+// targetVersion is a minor version downgrade, and zero versions otherwise.
+// It fails if etcd cannot downgrade from the current version to the target one.
+func downgradeVersions(pods []*v1.Pod, targetVersion string) (current, target etcdutil.MinorVersion, err error) {
+	target, err = etcdutil.ParseMinorVersion(targetVersion)
+	if err != nil {
+		return etcdutil.MinorVersion{}, etcdutil.MinorVersion{}, err
+	}
+	vs := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		vs = append(vs, k8sutil.GetEtcdVersion(pod))
+	}
+	current, err = etcdutil.LowestMinorVersion(vs)
+	if err != nil {
+		return etcdutil.MinorVersion{}, etcdutil.MinorVersion{}, err
+	}
+	if !target.LessThan(current) {
+		return etcdutil.MinorVersion{}, etcdutil.MinorVersion{}, nil
+	}
+
+	if !current.Supports(etcdutil.FeatureDowngrade) {
+		return etcdutil.MinorVersion{}, etcdutil.MinorVersion{}, fmt.Errorf("downgrade from etcd %s to %s is not supported: it requires etcd 3.5 or later", current, target)
+	}
+	if target.Major != current.Major || target.Minor != current.Minor-1 {
+		return etcdutil.MinorVersion{}, etcdutil.MinorVersion{}, fmt.Errorf("downgrade from etcd %s to %s is not supported: etcd only downgrades one minor version at a time", current, target)
+	}
+	return current, target, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// moveLeaderOffDrainingNode moves leadership to another member if the pod of the leader
+// is being deleted, e.g. evicted by a node drain, or runs on a cordoned node.
+// Handing leadership over while the leader still runs avoids the election timeout,
+// during which the cluster accepts no writes, after the leader is gone.
+func (c *Cluster) moveLeaderOffDrainingNode() error {
+	if len(c.status.Leader) == 0 || c.members.Size() < 2 || !c.supports(etcdutil.FeatureMoveLeader) {
+		return nil
+	}
+	leader, ok := c.members[c.status.Leader]
+	if !ok {
+		return nil
+	}
+
+	podList, err := c.listPods()
+	if err != nil {
+		return err
+	}
+	pods := make(map[string]*v1.Pod, len(podList))
+	for _, pod := range podList {
+		pods[pod.Name] = pod
+	}
+	nodes := make(map[string]bool)
+	draining := func(pod *v1.Pod) bool {
+		if pod.DeletionTimestamp != nil {
+			return true
+		}
+		cordoned, ok := nodes[pod.Spec.NodeName]
+		if !ok {
+			cordoned = c.isNodeCordoned(pod.Spec.NodeName)
+			nodes[pod.Spec.NodeName] = cordoned
+		}
+		return cordoned
+	}
+
+	lp, ok := pods[leader.Name]
+	if !ok || !draining(lp) {
+		return nil
+	}
+	for _, name := range c.members.Names() {
+		m := c.members[name]
+		pod, ok := pods[name]
+		if m == leader || m.IsLearner || m.ID == 0 || !ok || !k8sutil.IsPodReady(pod) || draining(pod) {
+			continue
+		}
+		c.logger.Infof("moving leadership from member (%s) on draining node (%s) to member (%s)", leader.Name, lp.Spec.NodeName, m.Name)
+		if err := etcdutil.MoveLeader(c.ctx, leader.ClientURL(), c.tlsConfig, c.clientOptions(), m.ID); err != nil {
+			return fmt.Errorf("failed to move leadership to member (%s): %v", m.Name, err)
+		}
+		c.status.Leader = m.Name
+		return nil
+	}
+	c.logger.Warningf("leader (%s) is on draining node (%s), but no other member is ready to take over", leader.Name, lp.Spec.NodeName)
+	return nil
+}
+
+// isNodeCordoned tells whether the node is marked unschedulable.
+// The node is taken as schedulable if it cannot be read, e.g. when the operator may not get nodes.
+func (c *Cluster) isNodeCordoned(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	node, err := c.config.KubeCli.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		c.logger.Debugf("failed to get node (%s): %v", name, err)
+		return false
+	}
+	return node.Spec.Unschedulable
+}
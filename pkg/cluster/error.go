@@ -16,6 +16,7 @@ package cluster
 
 import (
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 var (
@@ -42,3 +43,36 @@ func isFatalError(err error) bool {
 		return false
 	}
 }
+
+// permanentCreateError is the failure to create the pod or a PVC of a member that creating it again does not fix
+// until the spec, the namespace or its admission policies change.
+type permanentCreateError struct {
+	err error
+}
+
+func (pe *permanentCreateError) Error() string {
+	return pe.err.Error()
+}
+
+func isPermanentCreateError(err error) bool {
+	switch errors.Cause(err).(type) {
+	case *permanentCreateError:
+		return true
+	default:
+		return false
+	}
+}
+
+// classifyCreateError tells whether the API server rejected an object for good, as forbidden, e.g. over
+// a ResourceQuota or by an admission webhook, or as invalid, and whether it failed transiently,
+// on a timeout, throttling or an internal error, so that creating the object again right away may succeed.
+// Other errors, e.g. an unreachable API server, are neither and are retried by the next reconciliation.
+func classifyCreateError(err error) (permanent, transient bool) {
+	switch {
+	case apierrors.IsForbidden(err), apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return true, false
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err), apierrors.IsInternalError(err):
+		return false, true
+	}
+	return false, false
+}
@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestWrapFatalError(t *testing.T) {
@@ -46,3 +48,35 @@ func TestWrapFatalError(t *testing.T) {
 		}
 	}
 }
+
+func TestClassifyCreateError(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		err       error
+		permanent bool
+		transient bool
+	}{
+		{apierrors.NewForbidden(pods, "test-0000", errors.New("exceeded quota: compute-resources")), true, false},
+		{apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, "test-0000", nil), true, false},
+		{apierrors.NewBadRequest("bad"), true, false},
+		{apierrors.NewServerTimeout(pods, "create", 1), false, true},
+		{apierrors.NewTimeoutError("timeout", 1), false, true},
+		{apierrors.NewTooManyRequests("throttled", 1), false, true},
+		{apierrors.NewInternalError(errors.New("etcd leader changed")), false, true},
+		{errors.New("connection refused"), false, false},
+	}
+	for i, tt := range tests {
+		permanent, transient := classifyCreateError(tt.err)
+		if permanent != tt.permanent || transient != tt.transient {
+			t.Errorf("#%d: classifyCreateError(%v)=(%v, %v), want=(%v, %v)", i, tt.err, permanent, transient, tt.permanent, tt.transient)
+		}
+	}
+
+	err := errors.Wrap(&permanentCreateError{errors.New("forbidden")}, "fail to create member's pod (test-0000)")
+	if !isPermanentCreateError(err) {
+		t.Errorf("expect %v to be a permanent create error", err)
+	}
+	if isPermanentCreateError(errors.New("timeout")) {
+		t.Error("expect a plain error not to be a permanent create error")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+)
+
+// maxRecordedActions is the number of the last actions on a cluster kept for its failure report.
+const maxRecordedActions = 10
+
+// recordAction keeps the action, and its error if it failed, for the failure report of the cluster.
+func (c *Cluster) recordAction(action string, err error) {
+	a := api.ClusterAction{Time: time.Now().Format(time.RFC3339), Action: action}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	c.actions = append(c.actions, a)
+	if len(c.actions) > maxRecordedActions {
+		c.actions = c.actions[len(c.actions)-maxRecordedActions:]
+	}
+}
+
+// recordPlanAction records a membership action of reconcileMembers.
+func (c *Cluster) recordPlanAction(a PlanAction, err error) {
+	action := string(a.Type)
+	if len(a.Member) != 0 {
+		action += " " + a.Member
+	}
+	c.recordAction(fmt.Sprintf("%s: %s", action, a.Reason), err)
+}
+
+// failureReport returns the report of the cluster failing now: its phase, the last recorded actions
+// and the state of its members.
+func (c *Cluster) failureReport() *api.FailureReport {
+	return &api.FailureReport{
+		Time:    time.Now().Format(time.RFC3339),
+		Phase:   c.status.Phase,
+		Actions: append([]api.ClusterAction(nil), c.actions...),
+		Members: memberStates(c.members.Names(), c.status.Members),
+	}
+}
+
+// memberStates returns the state of each member in name order, as of the member status of the last reconciliation.
+// A member of the cluster missing from the member status has no running pod.
+func memberStates(names []string, ms api.MembersStatus) []api.MemberState {
+	state := map[string]string{}
+	for _, name := range names {
+		state[name] = api.MemberStateNoPod
+	}
+	for _, name := range ms.Ready {
+		state[name] = api.MemberStateReady
+	}
+	for _, name := range ms.Unready {
+		state[name] = api.MemberStateUnready
+	}
+	for _, name := range ms.Leaving {
+		state[name] = api.MemberStateLeaving
+	}
+	states := make([]api.MemberState, 0, len(state))
+	for name, s := range state {
+		states = append(states, api.MemberState{Name: name, State: s})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// syncHandsOff records the members whose pods are annotated hands-off, and sets the HandsOff condition while any is.
+// The pods of the members are the running, pending and leaving pods.
+func (c *Cluster) syncHandsOff(podLists ...[]*v1.Pod) {
+	handsOff := map[string]bool{}
+	var names []string
+	for _, pods := range podLists {
+		for _, pod := range pods {
+			if k8sutil.IsHandsOffPod(pod) && !handsOff[pod.Name] {
+				handsOff[pod.Name] = true
+				names = append(names, pod.Name)
+			}
+		}
+	}
+	c.handsOff = handsOff
+	if len(names) == 0 {
+		c.status.ClearCondition(api.ClusterConditionHandsOff)
+		return
+	}
+	sort.Strings(names)
+	c.status.SetHandsOffCondition(fmt.Sprintf("members %v are excluded from automation by the %s annotation: they are neither deleted, replaced nor upgraded", names, k8sutil.AnnotationHandsOff))
+}
+
+// isHandsOff tells whether the member is excluded from automation, and logs that the given action is skipped if it is.
+func (c *Cluster) isHandsOff(name, action string) bool {
+	if !c.handsOff[name] {
+		return false
+	}
+	c.logger.Warningf("not %s member (%s): its pod is annotated %s", action, name, k8sutil.AnnotationHandsOff)
+	return true
+}
+
+// handsOffPods returns the names of the pods annotated hands-off.
+func handsOffPods(pods []*v1.Pod) map[string]bool {
+	names := map[string]bool{}
+	for _, pod := range pods {
+		if k8sutil.IsHandsOffPod(pod) {
+			names[pod.Name] = true
+		}
+	}
+	return names
+}
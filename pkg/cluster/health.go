@@ -0,0 +1,109 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// updateReadiness publishes the members for the workers, and records the last probe of the health worker
+// in the status: the cluster is Ready if a quorum of the members is ready and a linearizable read through
+// the ready members succeeds. A ready cluster has a leader, which is recorded too.
+// The status is written right away when the cluster turns unready,
+// as reconciliation of an unhealthy cluster may not get to update it.
+// Until the first probe, e.g. after the operator restarted, the status is kept as it is.
+func (c *Cluster) updateReadiness(running []*v1.Pod) {
+	c.publishView(running)
+	p := c.lastProbe()
+	if p.at.IsZero() {
+		return
+	}
+	if p.ready && p.leader != 0 {
+		c.recordLeader(p.leader)
+	}
+	c.recordMemberDetails(p.members)
+	c.checkClockSkew(p.clockSkews)
+	c.recordKeySpace(p.keySpace)
+
+	wasReady := c.status.Ready
+	c.status.Ready = p.ready
+	if wasReady && !p.ready {
+		if err := c.updateCRStatus(); err != nil {
+			c.logger.Warningf("failed to update CR status: %v", err)
+		}
+	}
+}
+
+// recordLeader records the leader of the given ID, and counts a leader change if it differs from the last recorded leader.
+func (c *Cluster) recordLeader(id uint64) {
+	leader := fmt.Sprintf("%x", id)
+	for _, m := range c.members {
+		if m.ID == id {
+			leader = m.Name
+			break
+		}
+	}
+	if leader == c.status.Leader {
+		return
+	}
+	if len(c.status.Leader) != 0 {
+		c.logger.Infof("leader changed from %s to %s", c.status.Leader, leader)
+		c.status.LeaderChanges++
+		c.leaderChangeTimes = append(c.leaderChangeTimes, time.Now())
+		leaderChanges.WithLabelValues(c.cluster.Namespace, c.cluster.Name).Inc()
+	}
+	c.status.Leader = leader
+}
+
+// setReady publishes the readiness of the cluster ns/name for Ready and the readiness metric.
+func (c *Cluster) setReady(ns, name string, ready bool) {
+	v := int32(0)
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&c.ready, v)
+	clusterReady.WithLabelValues(ns, name).Set(float64(v))
+}
+
+// Ready tells whether the cluster was ready at the last probe of the health worker.
+// Unlike Plan, it does not wait for the run loop, so it is cheap enough for load balancer health checks.
+func (c *Cluster) Ready() bool {
+	return atomic.LoadInt32(&c.ready) == 1
+}
+
+func (c *Cluster) deleteHealthMetrics() {
+	clusterReady.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	leaderChanges.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	maxClockSkewSeconds.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+}
+
+// hasQuorum tells whether ready members out of size form a quorum.
+func hasQuorum(size, ready int) bool {
+	return size > 0 && ready >= size/2+1
+}
+
+func (c *Cluster) checkLinearizableRead(clientURLs []string) error {
+	etcdcli, err := c.etcdClientFor(clientURLs)
+	if err != nil {
+		return err
+	}
+	return etcdutil.CheckLinearizableRead(c.ctx, etcdcli)
+}
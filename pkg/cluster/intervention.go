@@ -0,0 +1,148 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// requireIntervention sets the InterventionRequired condition, so that the run loop stops acting on the cluster
+// until the cause is gone. The event and the notification are only sent when the reason changes.
+func (c *Cluster) requireIntervention(reason, message string) {
+	if cond := c.interventionCondition(); cond == nil || cond.Reason != reason {
+		c.logger.Errorf("intervention required (%s): %s", reason, message)
+		if _, err := c.eventsCli.Create(k8sutil.InterventionRequiredEvent(reason, message, c.cluster)); err != nil {
+			c.logger.Errorf("failed to create intervention required event: %v", err)
+		}
+		c.config.Notifier.Notify("etcd cluster %s/%s requires intervention (%s): %s", c.cluster.Namespace, c.cluster.Name, reason, message)
+	}
+	c.status.SetInterventionRequiredCondition(reason, message)
+	if err := c.updateCRStatus(); err != nil {
+		c.logger.Warningf("failed to update cluster status: %v", err)
+	}
+}
+
+func (c *Cluster) interventionCondition() *api.ClusterCondition {
+	for i := range c.status.Conditions {
+		if c.status.Conditions[i].Type == api.ClusterConditionInterventionRequired {
+			return &c.status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// awaitingIntervention tells whether the cluster still requires intervention, in which case the run loop
+// neither reconciles nor repairs it: no pod is deleted, no member removed and the cluster is neither restored
+// nor recreated. The condition is cleared once its cause is gone.
+func (c *Cluster) awaitingIntervention(running []*v1.Pod) bool {
+	cond := c.interventionCondition()
+	if cond == nil {
+		return false
+	}
+	resolved := false
+	switch cond.Reason {
+	case api.InterventionReasonQuorumLost:
+		resolved = c.runningMembersHaveQuorum(running)
+	case api.InterventionReasonDataCorruption:
+		c.diagnoseCrashLoopingMembers(running)
+		_, corrupted := c.corruptionAcrossMembers(running)
+		resolved = !corrupted
+	case api.InterventionReasonClusterIDMismatch:
+		_, mismatch := c.clusterIDMismatch(running)
+		resolved = !mismatch
+	default:
+		resolved = true
+	}
+	if !resolved {
+		c.logger.Warningf("skip reconciliation: intervention required (%s): %s", cond.Reason, cond.Message)
+		return true
+	}
+	c.logger.Infof("intervention (%s) no longer required", cond.Reason)
+	c.status.ClearCondition(api.ClusterConditionInterventionRequired)
+	return false
+}
+
+// runningMembersHaveQuorum tells whether the members with a running pod are a majority of the members.
+// Without known members, e.g. after the operator restarted, any running pod counts.
+func (c *Cluster) runningMembersHaveQuorum(running []*v1.Pod) bool {
+	if c.members == nil {
+		return len(running) != 0
+	}
+	n := 0
+	for _, pod := range running {
+		if _, ok := c.members[pod.Name]; ok {
+			n++
+		}
+	}
+	return hasQuorum(c.members.Size(), n)
+}
+
+// corruptionAcrossMembers tells whether the running members whose etcd failed on corrupted data leave
+// too few other members for quorum. Replacing them would sync the data of a minority, if of any member,
+// so a human has to decide which data to keep.
+func (c *Cluster) corruptionAcrossMembers(pods []*v1.Pod) (message string, ok bool) {
+	var corrupted []string
+	for _, pod := range pods {
+		if f, ok := c.memberFailures[pod.Name]; ok && f.cause == memberFailureDataCorruption {
+			if _, ok := c.members[pod.Name]; ok {
+				corrupted = append(corrupted, pod.Name)
+			}
+		}
+	}
+	size := c.members.Size()
+	if len(corrupted) == 0 || hasQuorum(size, size-len(corrupted)) {
+		return "", false
+	}
+	sort.Strings(corrupted)
+	return fmt.Sprintf("%d of %d members failed on corrupted data: %s", len(corrupted), size, strings.Join(corrupted, ", ")), true
+}
+
+// requireInterventionForCorruption requires intervention if the members with corrupted data leave too few
+// healthy members to replace them from, and tells whether it did.
+func (c *Cluster) requireInterventionForCorruption(running []*v1.Pod) bool {
+	message, ok := c.corruptionAcrossMembers(running)
+	if ok {
+		c.requireIntervention(api.InterventionReasonDataCorruption, message)
+	}
+	return ok
+}
+
+// requireInterventionForLostQuorum requires intervention for a cluster that lost quorum and that its
+// self healing policy neither restores nor recreates, naming its latest backup if it has one.
+func (c *Cluster) requireInterventionForLostQuorum(running int) {
+	size := c.members.Size()
+	if size == 0 {
+		size = c.cluster.Spec.Size
+	}
+	how := "restore it from a backup, or delete and recreate it"
+	backups, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdBackups(c.cluster.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		c.logger.Warningf("failed to list the backups of the cluster: %v", err)
+	} else if eb := k8sutil.LatestBackup(c.cluster.Name, c.cluster.Namespace, backups.Items); eb != nil {
+		how = fmt.Sprintf("restore it from backup %s", eb.Name)
+	} else {
+		how = "no backup of the cluster was found, delete and recreate it"
+	}
+	c.requireIntervention(api.InterventionReasonQuorumLost,
+		fmt.Sprintf("%d of %d members are running, too few for quorum: %s", running, size, how))
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+)
+
+const (
+	// keySpaceSampleInterval is the time between two samples of the key space of the health worker.
+	// Counting the keys walks the whole index of the member that serves it, so it is not done on every probe.
+	keySpaceSampleInterval = 5 * time.Minute
+	// keySpaceGrowthWindow is the period the growth of the key space is measured over.
+	keySpaceGrowthWindow = time.Hour
+)
+
+// keySpaceSample is the size of the key space at a time.
+type keySpaceSample struct {
+	at   time.Time
+	keys int64
+	// dbSize is the size of the largest member database.
+	dbSize int64
+}
+
+// keySpaceGrowth is the last sample of the key space and how fast it grows.
+type keySpaceGrowth struct {
+	last keySpaceSample
+	// keysPerHour and dbBytesPerHour are the growth rates over the samples of the last keySpaceGrowthWindow.
+	// They are only set, and rated true, once there are two samples.
+	keysPerHour    float64
+	dbBytesPerHour float64
+	rated          bool
+}
+
+// sampleKeySpace counts the keys and reads the size of the member databases, and updates the growth of the key space
+// with the sample. A failed sample is skipped.
+func (w *healthWorker) sampleKeySpace(v *opView) {
+	s := keySpaceSample{at: time.Now()}
+	etcdcli, err := w.client(v)
+	if err == nil {
+		s.keys, err = etcdutil.CountKeys(w.c.ctx, etcdcli)
+	}
+	if err != nil {
+		w.c.logger.Warningf("failed to count keys: %v", err)
+		return
+	}
+	for _, m := range v.members {
+		st, err := etcdutil.MemberStatus(w.c.ctx, m.ClientURL(), v.tlsConfig, v.clientOptions)
+		if err != nil {
+			w.c.logger.Warningf("failed to sample key space: failed to get status of member (%s): %v", m.Name, err)
+			return
+		}
+		if st.DbSize > s.dbSize {
+			s.dbSize = st.DbSize
+		}
+	}
+
+	w.keySpaceSamples = append(w.keySpaceSamples, s)
+	for len(w.keySpaceSamples) > 2 && s.at.Sub(w.keySpaceSamples[0].at) > keySpaceGrowthWindow {
+		w.keySpaceSamples = w.keySpaceSamples[1:]
+	}
+	g := growthOf(w.keySpaceSamples)
+	w.keySpace = &g
+}
+
+// growthOf returns the growth of the key space from the oldest to the newest of the samples, per hour.
+// The size of the databases shrinks with defragmentation, so its growth may be negative.
+func growthOf(samples []keySpaceSample) keySpaceGrowth {
+	g := keySpaceGrowth{last: samples[len(samples)-1]}
+	first := samples[0]
+	d := g.last.at.Sub(first.at)
+	if len(samples) < 2 || d <= 0 {
+		return g
+	}
+	g.keysPerHour = float64(g.last.keys-first.keys) * float64(time.Hour) / float64(d)
+	g.dbBytesPerHour = float64(g.last.dbSize-first.dbSize) * float64(time.Hour) / float64(d)
+	g.rated = true
+	return g
+}
+
+// recordKeySpace records the last sample of the key space of the health worker in the metrics,
+// and keeps it for the growth thresholds of spec.alerts.
+func (c *Cluster) recordKeySpace(g *keySpaceGrowth) {
+	if g == nil {
+		return
+	}
+	c.keySpace = g
+	ns, name := c.cluster.Namespace, c.cluster.Name
+	keyCount.WithLabelValues(ns, name).Set(float64(g.last.keys))
+	dbSizeBytes.WithLabelValues(ns, name).Set(float64(g.last.dbSize))
+	if g.rated {
+		keysGrowth.WithLabelValues(ns, name).Set(g.keysPerHour)
+		dbGrowthBytes.WithLabelValues(ns, name).Set(g.dbBytesPerHour)
+	}
+}
+
+func (c *Cluster) deleteKeySpaceMetrics() {
+	keyCount.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	dbSizeBytes.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	keysGrowth.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+	dbGrowthBytes.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name)
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+// learnerCatchUpTimeout is how long a learner may take to catch up with the leader,
+// e.g. to receive the leader's snapshot, before it is considered stuck.
+var learnerCatchUpTimeout = 5 * time.Minute
+
+// reconcileLearners tries to promote every learner member.
+// etcd only accepts the promotion once the learner's raft log has caught up with the leader's.
+// A learner still not promoted after learnerCatchUpTimeout is removed,
+// so that the next reconciliation adds a fresh one in its place.
+func (c *Cluster) reconcileLearners() error {
+	if !c.supports(etcdutil.FeatureLearner) {
+		return nil
+	}
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	learners, err := etcdutil.ListLearners(c.ctx, etcdcli)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range c.members {
+		m.IsLearner = learners[m.ID]
+		if !m.IsLearner {
+			delete(c.learnerSince, m.Name)
+			continue
+		}
+
+		err := etcdutil.PromoteLearner(c.ctx, etcdcli, m.ID)
+		if err == nil {
+			m.IsLearner = false
+			delete(c.learnerSince, m.Name)
+			c.logger.Infof("promoted learner (%s) to voting member", m.Name)
+			_, err = c.eventsCli.Create(k8sutil.LearnerPromotedEvent(m.Name, c.cluster))
+			if err != nil {
+				c.logger.Errorf("failed to create learner promoted event: %v", err)
+			}
+			continue
+		}
+		if !c.replaceStuckLearner(m.Name, time.Now(), err) {
+			continue
+		}
+		delete(c.learnerSince, m.Name)
+		if err := c.removeMember(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceStuckLearner tells whether the learner, which could not be promoted because of perr, must be replaced:
+// it is still catching up less than learnerCatchUpTimeout after it was first seen, and is only replaced within
+// the repair budget.
+func (c *Cluster) replaceStuckLearner(name string, now time.Time, perr error) bool {
+	since, ok := c.learnerSince[name]
+	if !ok {
+		// e.g. the operator restarted while the learner was catching up.
+		since = now
+		c.learnerSince[name] = since
+	}
+	if now.Sub(since) < learnerCatchUpTimeout {
+		c.logger.Infof("learner (%s) is not promoted yet: %v", name, perr)
+		return false
+	}
+
+	if !c.useReplacementBudget(name) {
+		return false
+	}
+	c.logger.Warningf("learner (%s) did not catch up within %v, replacing it: %v", name, learnerCatchUpTimeout, perr)
+	if _, err := c.eventsCli.Create(k8sutil.StuckLearnerEvent(name, learnerCatchUpTimeout, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create stuck learner event: %v", err)
+	}
+	return true
+}
+
+// votingClientURLs returns the client URLs of the voting members.
+// Learners reject most requests, so they are left out of the endpoints of cluster-wide requests.
+func votingClientURLs(ms etcdutil.MemberSet) []string {
+	var urls []string
+	for _, m := range ms {
+		if !m.IsLearner {
+			urls = append(urls, m.ClientURL())
+		}
+	}
+	return urls
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReplaceStuckLearner(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		desc         string
+		since        *time.Time
+		budget       *api.RepairBudgetPolicy
+		replacements []time.Time
+
+		want        bool
+		wantTracked bool
+		wantPaused  bool
+	}{{
+		desc:        "learner first seen",
+		wantTracked: true,
+	}, {
+		desc:        "learner catching up",
+		since:       timePtr(now.Add(-time.Minute)),
+		wantTracked: true,
+	}, {
+		desc:        "learner stuck",
+		since:       timePtr(now.Add(-learnerCatchUpTimeout - time.Second)),
+		want:        true,
+		wantTracked: true,
+	}, {
+		desc:        "learner stuck within the repair budget",
+		since:       timePtr(now.Add(-learnerCatchUpTimeout - time.Second)),
+		budget:      &api.RepairBudgetPolicy{MaxMemberReplacementsPerHour: 1},
+		want:        true,
+		wantTracked: true,
+	}, {
+		desc:         "learner stuck beyond the repair budget",
+		since:        timePtr(now.Add(-learnerCatchUpTimeout - time.Second)),
+		budget:       &api.RepairBudgetPolicy{MaxMemberReplacementsPerHour: 1},
+		replacements: []time.Time{now.Add(-time.Minute)},
+		wantTracked:  true,
+		wantPaused:   true,
+	}}
+	for _, tt := range tests {
+		cl := &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+			Spec:       api.ClusterSpec{RepairBudget: tt.budget},
+		}
+		eventsCli := fake.NewSimpleClientset().CoreV1().Events(cl.Namespace)
+		c := &Cluster{
+			logger:       logrus.WithField("pkg", "cluster"),
+			cluster:      cl,
+			eventsCli:    eventsCli,
+			learnerSince: map[string]time.Time{},
+			replacements: tt.replacements,
+		}
+		if tt.since != nil {
+			c.learnerSince["test-0003"] = *tt.since
+		}
+
+		if got := c.replaceStuckLearner("test-0003", now, errors.New("can only promote a learner member which is in sync with leader")); got != tt.want {
+			t.Errorf("%s: expect replace=%v, got %v", tt.desc, tt.want, got)
+		}
+		if _, ok := c.learnerSince["test-0003"]; ok != tt.wantTracked {
+			t.Errorf("%s: expect tracked=%v, got %v", tt.desc, tt.wantTracked, ok)
+		}
+		if c.repairPaused() != tt.wantPaused {
+			t.Errorf("%s: expect repair paused=%v, got %v", tt.desc, tt.wantPaused, c.repairPaused())
+		}
+		events, err := eventsCli.List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A replaced learner gets a stuck learner event, a refused one a repair paused event.
+		if wantEvent := tt.want || tt.wantPaused; (len(events.Items) != 0) != wantEvent {
+			t.Errorf("%s: expect event=%v, got %v", tt.desc, wantEvent, events.Items)
+		}
+	}
+}
+
+func TestVotingClientURLs(t *testing.T) {
+	ms := etcdutil.NewMemberSet(
+		&etcdutil.Member{Name: "test-0000", Namespace: metav1.NamespaceDefault},
+		&etcdutil.Member{Name: "test-0001", Namespace: metav1.NamespaceDefault, IsLearner: true},
+		&etcdutil.Member{Name: "test-0002", Namespace: metav1.NamespaceDefault},
+	)
+	got := votingClientURLs(ms)
+	sort.Strings(got)
+	want := []string{ms["test-0000"].ClientURL(), ms["test-0002"].ClientURL()}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expect the client URLs of the voting members %v, got %v", want, got)
+	}
+
+	if got := votingClientURLs(etcdutil.NewMemberSet(&etcdutil.Member{Name: "test-0000", IsLearner: true})); len(got) != 0 {
+		t.Errorf("expect no client URL without voting members, got %v", got)
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// applyMemberLogLevels sets the log level of each running member whose pod carries the
+// log level annotation, without restarting it. Once the annotation is removed the member
+// is set back to the cluster's log level.
+func (c *Cluster) applyMemberLogLevels(pods []*v1.Pod) {
+	clusterLevel := "info"
+	if c.cluster.Spec.Etcd != nil && len(c.cluster.Spec.Etcd.LogLevel) != 0 {
+		clusterLevel = c.cluster.Spec.Etcd.LogLevel
+	}
+
+	running := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		running[pod.Name] = true
+		applied, wasSet := c.memberLogLevels[pod.Name]
+		level, annotated := pod.Annotations[k8sutil.AnnotationLogLevel]
+		switch {
+		case annotated && level == applied:
+			continue
+		case !annotated && !wasSet:
+			continue
+		case !annotated:
+			level = clusterLevel
+		}
+
+		capnslogLevel, ok := k8sutil.CapnslogLevel(level)
+		if !ok {
+			c.logger.Warningf("ignoring unknown log level (%s) of member (%s)", level, pod.Name)
+			continue
+		}
+		m := newClusterMember(pod.Name, pod.Namespace, c.cluster.Spec)
+		if err := etcdutil.SetLogLevel(c.ctx, m.ClientURL(), c.tlsConfig, capnslogLevel); err != nil {
+			c.logger.Warningf("failed to set log level of member (%s) to %s: %v", pod.Name, level, err)
+			continue
+		}
+		c.logger.Infof("set log level of member (%s) to %s", pod.Name, level)
+		if annotated {
+			c.memberLogLevels[pod.Name] = level
+		} else {
+			delete(c.memberLogLevels, pod.Name)
+		}
+	}
+
+	for name := range c.memberLogLevels {
+		if !running[name] {
+			delete(c.memberLogLevels, name)
+		}
+	}
+}
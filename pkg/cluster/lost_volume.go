@@ -0,0 +1,92 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// replaceMembersOnLostVolumes replaces the members whose pods cannot be scheduled because they claim a local volume
+// of a node that is gone, e.g. replaced by a new node. Such a pod stays pending for good.
+// The member is removed with its PVCs, which releases the volumes, and the reconciliation adds a new member
+// that gets fresh volumes on another node and syncs its data from the other members.
+func (c *Cluster) replaceMembersOnLostVolumes(pending []*v1.Pod) {
+	if !c.isPodPVEnabled() || c.members == nil {
+		return
+	}
+	for _, pod := range pending {
+		m, ok := c.members[pod.Name]
+		if !ok {
+			continue
+		}
+		if cond := podCondition(pod, v1.PodScheduled); cond == nil || cond.Status != v1.ConditionFalse {
+			continue
+		}
+		node, lost := c.lostVolumeNode(pod)
+		if !lost || !c.useReplacementBudget(m.Name) {
+			continue
+		}
+		c.logger.Warningf("replacing member (%s): it claims a local volume of node (%s), which is gone", m.Name, node)
+		if _, err := c.eventsCli.Create(k8sutil.MemberVolumeLostEvent(m.Name, node, c.cluster)); err != nil {
+			c.logger.Errorf("failed to create member volume lost event: %v", err)
+		}
+		if err := c.removeMember(m); err != nil {
+			c.logger.Errorf("failed to remove member on lost volume: %v", err)
+		}
+	}
+}
+
+// lostVolumeNode returns the node of a volume bound to a PVC of the pod, and true, if the volume is local to nodes
+// that are all gone. Volumes and nodes that cannot be read, e.g. when the operator may not get them, are taken as there.
+func (c *Cluster) lostVolumeNode(pod *v1.Pod) (string, bool) {
+	core := c.config.KubeCli.CoreV1()
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := core.PersistentVolumeClaims(c.cluster.Namespace).Get(vol.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+		if err != nil {
+			c.logger.Debugf("failed to get pvc (%s): %v", vol.PersistentVolumeClaim.ClaimName, err)
+			continue
+		}
+		if len(pvc.Spec.VolumeName) == 0 {
+			continue
+		}
+		pv, err := core.PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			c.logger.Debugf("failed to get persistent volume (%s): %v", pvc.Spec.VolumeName, err)
+			continue
+		}
+		nodes := k8sutil.VolumeNodes(pv)
+		if len(nodes) != 0 && c.nodesGone(nodes) {
+			return nodes[0], true
+		}
+	}
+	return "", false
+}
+
+// nodesGone tells whether none of the nodes exists.
+func (c *Cluster) nodesGone(names []string) bool {
+	for _, name := range names {
+		_, err := c.config.KubeCli.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// runRequestedMaintenance runs the defragmentation and compaction requested by annotating the cluster,
+// and removes the annotation of each once it is done.
+// A request that cannot be fulfilled, e.g. an unparsable revision, is removed with a warning event,
+// while one that failed otherwise is kept and retried at the next reconcile.
+func (c *Cluster) runRequestedMaintenance() error {
+	if v, ok := c.cluster.Annotations[k8sutil.AnnotationDefrag]; ok {
+		if v != "now" {
+			c.refuseMaintenance(k8sutil.AnnotationDefrag, fmt.Sprintf("unknown value %q of annotation %s, must be \"now\"", v, k8sutil.AnnotationDefrag))
+		} else {
+			if err := c.defragment(); err != nil {
+				return err
+			}
+			c.lastDefrag = time.Now()
+			c.completeMaintenance(k8sutil.AnnotationDefrag, "Defragmented the members as requested")
+		}
+	}
+
+	if v, ok := c.cluster.Annotations[k8sutil.AnnotationCompact]; ok {
+		rev, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || rev <= 0 {
+			c.refuseMaintenance(k8sutil.AnnotationCompact, fmt.Sprintf("invalid revision %q of annotation %s", v, k8sutil.AnnotationCompact))
+			return nil
+		}
+		etcdcli, err := c.etcdClient()
+		if err != nil {
+			return err
+		}
+		err = etcdutil.Compact(c.ctx, etcdcli, rev)
+		if err == rpctypes.ErrFutureRev {
+			c.refuseMaintenance(k8sutil.AnnotationCompact, fmt.Sprintf("cannot compact to revision %d, which is past the current revision", rev))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rev > c.status.CompactedRevision {
+			c.status.CompactedRevision = rev
+		}
+		c.completeMaintenance(k8sutil.AnnotationCompact, fmt.Sprintf("Compacted the history to revision %d as requested", rev))
+	}
+	return nil
+}
+
+func (c *Cluster) completeMaintenance(annotation, message string) {
+	c.logger.Info(message)
+	c.recordMaintenance(annotation, k8sutil.RequestedMaintenanceEvent(message, c.cluster))
+}
+
+func (c *Cluster) refuseMaintenance(annotation, message string) {
+	c.logger.Warningf("not running requested maintenance: %s", message)
+	c.recordMaintenance(annotation, k8sutil.RefusedMaintenanceEvent(message, c.cluster))
+}
+
+// recordMaintenance removes the maintenance annotation from the cluster and creates the event.
+func (c *Cluster) recordMaintenance(annotation string, event *v1.Event) {
+	if err := c.removeClusterAnnotation(annotation); err != nil {
+		c.logger.Errorf("failed to remove annotation %s: %v", annotation, err)
+	}
+	if _, err := c.eventsCli.Create(event); err != nil {
+		c.logger.Errorf("failed to create maintenance event: %v", err)
+	}
+}
+
+// removeClusterAnnotation removes the annotation from the cluster resource with a merge patch,
+// so that it does not conflict with concurrent changes of the resource.
+// Only the metadata of the local copy is updated, as its spec has the defaults applied.
+func (c *Cluster) removeClusterAnnotation(annotation string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotation: nil},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	cl, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace).Patch(c.cluster.Name, types.MergePatchType, patch)
+	if err != nil {
+		return err
+	}
+	c.cluster.Annotations = cl.Annotations
+	c.cluster.ResourceVersion = cl.ResourceVersion
+	return nil
+}
@@ -17,6 +17,7 @@ package cluster
 import (
 	"fmt"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	"github.com/coreos/etcd/etcdserver/etcdserverpb"
@@ -26,10 +27,18 @@ import (
 )
 
 func (c *Cluster) updateMembers(known etcdutil.MemberSet) error {
-	resp, err := etcdutil.ListMembers(known.ClientURLs(), c.tlsConfig)
+	etcdcli, err := c.etcdClientFor(known.ClientURLs())
 	if err != nil {
 		return err
 	}
+	resp, err := etcdutil.ListMembers(c.ctx, etcdcli)
+	if err != nil {
+		return err
+	}
+	if id := formatClusterID(resp.Header.ClusterId); len(c.status.ClusterID) != 0 && id != c.status.ClusterID {
+		// Refreshing the membership from another cluster would adopt its members.
+		return fmt.Errorf("membership not refreshed: etcd cluster ID %s differs from the recorded %s", id, c.status.ClusterID)
+	}
 	members := etcdutil.MemberSet{}
 	for _, m := range resp.Members {
 		name, err := getMemberName(m, c.cluster.GetName())
@@ -37,12 +46,16 @@ func (c *Cluster) updateMembers(known etcdutil.MemberSet) error {
 			return errors.Wrap(err, "get member name failed")
 		}
 
-		members[name] = &etcdutil.Member{
-			Name:         name,
-			Namespace:    c.cluster.Namespace,
-			ID:           m.ID,
-			SecurePeer:   c.isSecurePeer(),
-			SecureClient: c.isSecureClient(),
+		members[name] = newClusterMember(name, c.cluster.Namespace, c.cluster.Spec)
+		members[name].ID = m.ID
+	}
+	if c.members != nil {
+		if d := c.members.Compare(members); !d.IsEmpty() {
+			// E.g. a member was added but the operator failed before it recorded it, or a user changed the membership.
+			c.logger.Warningf("membership read from etcd differs from the one known: %s", d.Explain())
+			if _, err := c.eventsCli.Create(k8sutil.MembershipRefreshedEvent(d.Explain(), c.cluster)); err != nil {
+				c.logger.Errorf("failed to create membership refreshed event: %v", err)
+			}
 		}
 	}
 	c.members = members
@@ -50,20 +63,25 @@ func (c *Cluster) updateMembers(known etcdutil.MemberSet) error {
 }
 
 func (c *Cluster) newMember() *etcdutil.Member {
-	name := k8sutil.UniqueMemberName(c.cluster.Name)
+	return newClusterMember(k8sutil.UniqueMemberName(k8sutil.MemberSubdomain(c.cluster.Name, c.cluster.Spec.Pod)), c.cluster.Namespace, c.cluster.Spec)
+}
+
+// newClusterMember returns the member with the given name, addressed as the spec of its cluster says.
+func newClusterMember(name, ns string, sp api.ClusterSpec) *etcdutil.Member {
 	return &etcdutil.Member{
 		Name:         name,
-		Namespace:    c.cluster.Namespace,
-		SecurePeer:   c.isSecurePeer(),
-		SecureClient: c.isSecureClient(),
+		Namespace:    ns,
+		SecurePeer:   sp.TLS.IsSecurePeer(),
+		SecureClient: sp.TLS.IsSecureClient(),
+		ClientPort:   sp.ClientPort,
+		PeerPort:     sp.PeerPort,
 	}
 }
 
-func podsToMemberSet(pods []*v1.Pod, sc bool) etcdutil.MemberSet {
+func podsToMemberSet(pods []*v1.Pod, sp api.ClusterSpec) etcdutil.MemberSet {
 	members := etcdutil.MemberSet{}
 	for _, pod := range pods {
-		m := &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace, SecureClient: sc}
-		members.Add(m)
+		members.Add(newClusterMember(pod.Name, pod.Namespace, sp))
 	}
 	return members
 }
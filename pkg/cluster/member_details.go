@@ -0,0 +1,68 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+)
+
+// memberDetailsInterval is the time between two refreshes of the member details by the health worker.
+const memberDetailsInterval = 30 * time.Second
+
+// recordMemberDetails records the member details refreshed by the health worker in status.members.details.
+func (c *Cluster) recordMemberDetails(details []api.MemberDetail) {
+	if details == nil {
+		return
+	}
+	c.status.Members.Details = details
+}
+
+// checkMemberDetails gets the status of each member with a running pod, in name order: the equivalent of
+// `etcdctl endpoint status`. A member without a running pod, or that does not answer, is unhealthy.
+func (w *healthWorker) checkMemberDetails(v *opView) []api.MemberDetail {
+	details := make([]api.MemberDetail, 0, len(v.members))
+	for name, m := range v.members {
+		d := api.MemberDetail{Name: name}
+		if m.ID != 0 {
+			d.ID = fmt.Sprintf("%x", m.ID)
+		}
+		node, ok := v.nodes[name]
+		if !ok {
+			d.Error = "no running pod"
+			details = append(details, d)
+			continue
+		}
+		d.Node = node
+		st, err := etcdutil.MemberStatus(w.c.ctx, m.ClientURL(), v.tlsConfig, v.clientOptions)
+		if err != nil {
+			d.Error = err.Error()
+			details = append(details, d)
+			continue
+		}
+		d.ID = fmt.Sprintf("%x", st.Header.MemberId)
+		d.Version = st.Version
+		d.DBSize = st.DbSize
+		d.IsLeader = st.Leader == st.Header.MemberId
+		d.Healthy = true
+		details = append(details, d)
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].Name < details[j].Name })
+	return details
+}
@@ -0,0 +1,213 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// memberLogTailLines is the number of lines of the etcd log read to find why a member failed.
+	memberLogTailLines = 50
+	// memberFailureDataCorruption is the cause of failure of a member whose WAL or backend database is corrupted.
+	memberFailureDataCorruption = "data corruption"
+)
+
+// memberFailure is why the etcd container of a member failed, as found in its log.
+type memberFailure struct {
+	// cause is a short summary, e.g. "data corruption".
+	cause string
+	// replace tells whether replacing the member repairs it. A new member starts on empty data and syncs
+	// from its peers, but one that failed on its configuration, e.g. its certificates, would fail the same way.
+	replace bool
+	// logLine is the log line the cause was found in, or the last log line.
+	logLine string
+}
+
+// memberFailurePatterns are the etcd log messages of the known causes of failure, in the order they are looked for.
+var memberFailurePatterns = []struct {
+	substrings []string
+	cause      string
+	replace    bool
+}{
+	{[]string{"has been permanently removed from the cluster"}, "member removed from the cluster", true},
+	{[]string{"member count is unequal", "couldn't find local name", "cluster ID mismatch", "member ID mismatch"}, "member ID mismatch", true},
+	{[]string{"crc mismatch", "max entry size limit exceeded", "invalid database", "invalid page type", "failed to find database snapshot file", "failed to get all reachable pages"}, memberFailureDataCorruption, true},
+	{[]string{"no space left on device"}, "disk full", true},
+	{[]string{"database space exceeded"}, "database space exceeded", false},
+	{[]string{"x509:", "tls:"}, "TLS configuration error", false},
+	{[]string{"flag provided but not defined", "for flag -"}, "invalid etcd flag", false},
+}
+
+// classifyMemberFailure returns the cause of failure found in the etcd log.
+// The lines are searched from the last one, where etcd logs the error it exits on.
+func classifyMemberFailure(log string) memberFailure {
+	lines := strings.Split(strings.TrimSpace(log), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		for _, p := range memberFailurePatterns {
+			for _, s := range p.substrings {
+				if strings.Contains(lines[i], s) {
+					return memberFailure{cause: p.cause, replace: p.replace, logLine: lines[i]}
+				}
+			}
+		}
+	}
+	return memberFailure{cause: "unknown", replace: true, logLine: lines[len(lines)-1]}
+}
+
+// diagnoseMemberFailure reads the log of the failed etcd container of the member, reports the cause of failure
+// in an event and the MemberFailed condition, and returns it. It returns false if the member has no failed container,
+// e.g. if its pod was deleted. The log of a pod is only read, and the event only created, once.
+func (c *Cluster) diagnoseMemberFailure(name string) (memberFailure, bool) {
+	pod, err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			c.logger.Warningf("failed to get pod of member (%s) to diagnose it: %v", name, err)
+		}
+		delete(c.memberFailures, name)
+		return memberFailure{}, false
+	}
+	previous, ok := failedEtcdContainer(pod)
+	if !ok {
+		delete(c.memberFailures, name)
+		return memberFailure{}, false
+	}
+	message := func(f memberFailure) string {
+		return fmt.Sprintf("member %s failed: %s", name, f.cause)
+	}
+	if f, ok := c.memberFailures[name]; ok {
+		c.status.SetMemberFailedCondition(message(f))
+		return f, true
+	}
+
+	tail := int64(memberLogTailLines)
+	out, err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).
+		GetLogs(name, &v1.PodLogOptions{Container: "etcd", TailLines: &tail, Previous: previous}).DoRaw()
+	if err != nil {
+		c.logger.Warningf("failed to get log of member (%s): %v", name, err)
+		return memberFailure{}, false
+	}
+	f := classifyMemberFailure(string(out))
+	c.memberFailures[name] = f
+	c.logger.Warningf("member (%s) failed: %s: %s", name, f.cause, f.logLine)
+	c.status.SetMemberFailedCondition(message(f))
+	if _, err := c.eventsCli.Create(k8sutil.MemberFailedEvent(name, f.cause, memberFailureAction(pod, f), f.logLine, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create member failed event: %v", err)
+	}
+	return f, true
+}
+
+// memberFailureAction tells what the operator does about the failed member.
+func memberFailureAction(pod *v1.Pod, f memberFailure) string {
+	switch {
+	case k8sutil.IsDevTierPod(pod) && f.cause == memberFailureDataCorruption:
+		return "It is replaced by a new member once the other members keep a healthy quorum"
+	case k8sutil.IsDevTierPod(pod):
+		return "Its etcd is restarted in place"
+	case f.replace:
+		return "It is replaced by a new member"
+	}
+	return "It is not replaced, as a new member would fail the same way. Delete its pod to replace it once the cause is fixed"
+}
+
+// failedEtcdContainer tells whether the etcd container of the pod failed, and if so whether its log is the one
+// of its previous run: the etcd container of a dev cluster is restarted in place.
+func failedEtcdContainer(pod *v1.Pod) (previous, ok bool) {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != "etcd" {
+			continue
+		}
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			return false, true
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 && cs.State.Waiting != nil {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// diagnoseCrashLoopingMembers diagnoses the running members whose etcd container is waiting to be restarted,
+// i.e. the member of a dev cluster. They are restarted in place and never replaced.
+// A member that runs again is diagnosed anew the next time it fails.
+func (c *Cluster) diagnoseCrashLoopingMembers(running []*v1.Pod) {
+	for _, pod := range running {
+		if _, ok := failedEtcdContainer(pod); ok {
+			c.diagnoseMemberFailure(pod.Name)
+		} else {
+			delete(c.memberFailures, pod.Name)
+		}
+	}
+}
+
+// pickOneCorruptedMember returns a running member whose etcd keeps failing on corrupted data, or nil.
+// Such a member is restarted in place on the same data, so it never recovers by itself.
+func (c *Cluster) pickOneCorruptedMember(pods []*v1.Pod) *etcdutil.Member {
+	for _, pod := range pods {
+		if f, ok := c.memberFailures[pod.Name]; ok && f.cause == memberFailureDataCorruption {
+			if m, ok := c.members[pod.Name]; ok {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// replaceCorruptedMember removes the member, deleting its pod and volumes with its corrupted data,
+// so that the next reconcile adds a new member in its place that syncs its data from the other members.
+// It is only done while the other members keep a healthy quorum.
+func (c *Cluster) replaceCorruptedMember(pods []*v1.Pod, name string) error {
+	m, ok := c.members[name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found in cluster membership", name)
+	}
+	if err := c.checkHealthyQuorumWithout(pods, name); err != nil {
+		c.logger.Warningf("not wiping the corrupted data of member (%s): %v", name, err)
+		return nil
+	}
+	if !c.useReplacementBudget(name) {
+		return nil
+	}
+	c.logger.Infof("replacing member (%s) to wipe its corrupted data", name)
+	if _, err := c.eventsCli.Create(k8sutil.ReplacingCorruptedMemberEvent(name, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create replacing corrupted member event: %v", err)
+	}
+	return c.removeMember(m)
+}
+
+// checkHealthyQuorumWithout returns an error unless the members other than name keep quorum with their ready pods,
+// and a linearizable read through them succeeds.
+func (c *Cluster) checkHealthyQuorumWithout(pods []*v1.Pod, name string) error {
+	if err := checkReplacementQuorum(pods, name, c.members.Size()); err != nil {
+		return err
+	}
+	var ready []string
+	for _, pod := range pods {
+		if m, ok := c.members[pod.Name]; ok && pod.Name != name && k8sutil.IsPodReady(pod) {
+			ready = append(ready, m.ClientURL())
+		}
+	}
+	if err := c.checkLinearizableRead(ready); err != nil {
+		return fmt.Errorf("linearizable read through the other members failed: %v", err)
+	}
+	return nil
+}
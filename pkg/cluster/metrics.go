@@ -37,7 +37,157 @@ var reconcileFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
 	[]string{"Reason"},
 )
 
+var resourcesRequested = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "resources_requested",
+	Help:      "Sum of the cpu (cores), memory and storage (bytes) requested by the members of a cluster",
+},
+	[]string{"Namespace", "ClusterName", "Resource"},
+)
+
+var resourcesUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "resources_used",
+	Help:      "Sum of the cpu (cores), memory and storage (bytes) used by the members of a cluster",
+},
+	[]string{"Namespace", "ClusterName", "Resource"},
+)
+
+var clusterReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "ready",
+	Help:      "1 if a quorum of the members of a cluster is ready and serves linearizable reads, 0 otherwise",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var leaderChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "leader_changes_total",
+	Help:      "Total number of leader changes of a cluster seen by the operator",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var dbSizePercent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "db_size_percent",
+	Help:      "Size of the largest member database of a cluster in percent of the etcd backend quota, if spec.alerts.maxDBSizePercent is set",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var walFsyncP99 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "wal_fsync_p99_seconds",
+	Help:      "Highest 99th percentile of the WAL fsync duration of the members of a cluster since the previous check, if spec.alerts.maxWALFsyncP99InMillisecond is set",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var maxClockSkewSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "max_clock_skew_seconds",
+	Help:      "Largest clock skew between the operator and the members of a cluster, positive if the clock of the member is ahead",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var keyCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "keys",
+	Help:      "Number of keys of a cluster, sampled every 5 minutes",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var dbSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "db_size_bytes",
+	Help:      "Size of the largest member database of a cluster, sampled every 5 minutes",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var keysGrowth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "keys_growth_per_hour",
+	Help:      "Growth of the number of keys of a cluster per hour, over the samples of the last hour",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var dbGrowthBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "db_growth_bytes_per_hour",
+	Help:      "Growth of the size of the largest member database of a cluster per hour, over the samples of the last hour",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var membersDesired = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "members_desired",
+	Help:      "Number of members a cluster should have, its spec.size",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var membersRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "members_running",
+	Help:      "Number of running member pods of a cluster",
+},
+	[]string{"Namespace", "ClusterName"},
+)
+
+var reconciles = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "reconciles_total",
+	Help:      "Total number of reconciliations of the members of a cluster, by result: success or failure",
+},
+	[]string{"Namespace", "ClusterName", "Result"},
+)
+
+var membersCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "members_created_total",
+	Help:      "Total number of member pods created for a cluster, by the reason they were created for",
+},
+	[]string{"Namespace", "ClusterName", "Reason"},
+)
+
 func init() {
 	prometheus.MustRegister(reconcileHistogram)
 	prometheus.MustRegister(reconcileFailed)
+	prometheus.MustRegister(resourcesRequested)
+	prometheus.MustRegister(resourcesUsed)
+	prometheus.MustRegister(clusterReady)
+	prometheus.MustRegister(leaderChanges)
+	prometheus.MustRegister(dbSizePercent)
+	prometheus.MustRegister(walFsyncP99)
+	prometheus.MustRegister(maxClockSkewSeconds)
+	prometheus.MustRegister(keyCount)
+	prometheus.MustRegister(dbSizeBytes)
+	prometheus.MustRegister(keysGrowth)
+	prometheus.MustRegister(dbGrowthBytes)
+	prometheus.MustRegister(membersDesired)
+	prometheus.MustRegister(membersRunning)
+	prometheus.MustRegister(reconciles)
+	prometheus.MustRegister(membersCreated)
 }
@@ -0,0 +1,41 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+)
+
+// transition moves the in memory status to phase p.
+// An illegal transition is a bug of the operator; it is logged and the phase is kept.
+func (c *Cluster) transition(p api.ClusterPhase) {
+	from := c.status.Phase
+	if err := c.status.TransitionTo(p); err != nil {
+		c.logger.Errorf("%v", err)
+		return
+	}
+	if from != p {
+		c.logger.Infof("cluster phase changed from %q to %q", from, p)
+		c.recordAction(fmt.Sprintf("phase changed from %q to %q", from, p), nil)
+	}
+}
+
+// isDeleting tells whether the cluster resource is being deleted, e.g. with foreground deletion,
+// while the garbage collector deletes the pods and services of the cluster.
+func isDeleting(cl *api.EtcdCluster) bool {
+	return cl.DeletionTimestamp != nil
+}
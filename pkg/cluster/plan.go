@@ -0,0 +1,202 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+const planTimeout = 30 * time.Second
+
+type PlanActionType string
+
+const (
+	PlanRemovePod           PlanActionType = "RemovePod"
+	PlanRemoveDeadMember    PlanActionType = "RemoveDeadMember"
+	PlanRemoveLeavingMember PlanActionType = "RemoveLeavingMember"
+	PlanAddMember           PlanActionType = "AddMember"
+	PlanRemoveMember        PlanActionType = "RemoveMember"
+	PlanEnableDowngrade     PlanActionType = "EnableDowngrade"
+	PlanUpgradeMember       PlanActionType = "UpgradeMember"
+	PlanReplaceMember       PlanActionType = "ReplaceMember"
+)
+
+// PlanAction is one step the operator would take to bring the cluster to its spec.
+type PlanAction struct {
+	Type PlanActionType `json:"type"`
+	// Member is empty if the member is only picked when the action is taken,
+	// e.g. which member is removed on scale down.
+	Member string `json:"member,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Plan is the ordered list of actions reconciliation would take, given the current state of the cluster.
+type Plan struct {
+	Cluster string `json:"cluster"`
+	Paused  bool   `json:"paused"`
+	// Blocked tells why reconciliation cannot make progress right now, e.g. lost quorum.
+	// Actions are then only the steps taken before it is blocked.
+	Blocked string       `json:"blocked,omitempty"`
+	Actions []PlanAction `json:"actions"`
+	// Membership is how the running pods differ from the membership: added are the pods that are not of a member,
+	// removed are the members without a running pod. It is only set once the pods are all running or being deleted.
+	Membership *etcdutil.MemberSetDiff `json:"membership,omitempty"`
+}
+
+type planReply struct {
+	plan *Plan
+	err  error
+}
+
+// Plan computes the plan in the run loop of the cluster, so that it does not race with reconciliation.
+// It does not change the cluster.
+func (c *Cluster) Plan() (*Plan, error) {
+	replyCh := make(chan planReply, 1)
+	c.send(&clusterEvent{
+		typ:    eventPlan,
+		planCh: replyCh,
+	})
+
+	select {
+	case r := <-replyCh:
+		return r.plan, r.err
+	case <-c.ctx.Done():
+		return nil, errors.New("cluster is deleted")
+	case <-time.After(planTimeout):
+		return nil, errors.New("timed out waiting for the cluster to compute its plan")
+	}
+}
+
+func (c *Cluster) plan() (*Plan, error) {
+	running, pending, leaving, err := c.pollPods()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		Cluster: c.cluster.Name,
+		Paused:  c.cluster.Spec.Paused,
+		Actions: []PlanAction{},
+	}
+	switch {
+	case len(pending) > 0:
+		p.Blocked = fmt.Sprintf("pods %v are pending", k8sutil.GetPodNames(pending))
+	case len(running) == 0 && len(leaving) > 0:
+		p.Blocked = fmt.Sprintf("pods %v are being deleted", k8sutil.GetPodNames(leaving))
+	case len(running) == 0:
+		p.Blocked = "all etcd pods are dead"
+	default:
+		members := c.members
+		if members == nil {
+			// The run loop reads the membership from etcd first; the running pods are the best guess.
+			members = podsToMemberSet(running, c.cluster.Spec)
+		}
+		diff := members.Compare(podsToMemberSet(running, c.cluster.Spec))
+		p.Membership = &diff
+		p.Actions, p.Blocked = planReconcile(c.cluster.Spec, members, running, leaving, requestedReplacement(running, c.cluster))
+	}
+	return p, nil
+}
+
+// planReconcile mirrors the decisions of reconcile, assuming each action succeeds.
+// requested is the member a user asked to replace, if any.
+// It returns the actions and, if reconciliation gets stuck, the reason.
+func planReconcile(sp api.ClusterSpec, members etcdutil.MemberSet, pods, leaving []*v1.Pod, requested string) ([]PlanAction, string) {
+	actions := []PlanAction{}
+	// Added are the pods that are not of a member, and removed the members without a running pod.
+	diff := members.Compare(podsToMemberSet(pods, sp))
+	for _, name := range diff.Added {
+		actions = append(actions, PlanAction{Type: PlanRemovePod, Member: name, Reason: "pod is not a member of the cluster"})
+	}
+
+	if len(diff.Removed) != 0 {
+		if len(diff.Unchanged) < members.Size()/2+1 {
+			return actions, fmt.Sprintf("lost quorum: %d of %d members are running", len(diff.Unchanged), members.Size())
+		}
+		for _, name := range diff.Removed {
+			actions = append(actions, removeMemberWithoutPod(name, leaving))
+		}
+	}
+
+	for size := len(diff.Unchanged); size < sp.Size; size++ {
+		actions = append(actions, PlanAction{Type: PlanAddMember, Reason: fmt.Sprintf("scale up to %d members", sp.Size)})
+	}
+	for size := len(diff.Unchanged); size > sp.Size; size-- {
+		actions = append(actions, PlanAction{Type: PlanRemoveMember, Reason: fmt.Sprintf("scale down to %d members", sp.Size)})
+	}
+
+	// New members start with the spec, only the pods of the members that stay need to be rolled.
+	var remaining []*v1.Pod
+	for _, pod := range pods {
+		if _, ok := members[pod.Name]; ok {
+			remaining = append(remaining, pod)
+		}
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].Name < remaining[j].Name })
+
+	var old []*v1.Pod
+	for _, pod := range remaining {
+		if k8sutil.GetEtcdVersion(pod) != sp.Version {
+			old = append(old, pod)
+		}
+	}
+	if len(old) > 0 {
+		current, target, err := downgradeVersions(remaining, sp.Version)
+		if err != nil {
+			return actions, err.Error()
+		}
+		if !current.IsUnknown() {
+			actions = append(actions, PlanAction{Type: PlanEnableDowngrade, Reason: fmt.Sprintf("downgrade from etcd %s to %s", current, target)})
+		}
+	}
+	for _, pod := range old {
+		actions = append(actions, PlanAction{
+			Type:   PlanUpgradeMember,
+			Member: pod.Name,
+			Reason: fmt.Sprintf("runs etcd %s instead of %s", k8sutil.GetEtcdVersion(pod), sp.Version),
+		})
+	}
+
+	if _, ok := members[requested]; ok {
+		if err := checkReplacementQuorum(remaining, requested, sp.Size); err != nil {
+			return actions, err.Error()
+		}
+		actions = append(actions, PlanAction{Type: PlanReplaceMember, Member: requested, Reason: "replacement requested by annotation"})
+	}
+
+	for _, pod := range remaining {
+		if m := k8sutil.GetEtcdMetrics(pod); m != sp.Etcd.MetricsOrDefault() {
+			actions = append(actions, PlanAction{
+				Type:   PlanReplaceMember,
+				Member: pod.Name,
+				Reason: fmt.Sprintf("runs with %s metrics instead of %s", m, sp.Etcd.MetricsOrDefault()),
+			})
+		}
+	}
+
+	if m := pickOneDevTierMember(remaining, sp); m != nil {
+		actions = append(actions, PlanAction{Type: PlanReplaceMember, Member: m.Name, Reason: fmt.Sprintf("created while the cluster was a %s cluster", api.ClusterTierDev)})
+	}
+	return actions, ""
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPlanPod(name, version string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        name,
+		Annotations: map[string]string{"etcd.version": version},
+	}}
+}
+
+func newDevPlanPod(name, version string) *v1.Pod {
+	pod := newPlanPod(name, version)
+	pod.Spec.RestartPolicy = v1.RestartPolicyAlways
+	return pod
+}
+
+func TestPlanReconcile(t *testing.T) {
+	members := etcdutil.NewMemberSet(
+		&etcdutil.Member{Name: "test-0000"},
+		&etcdutil.Member{Name: "test-0001"},
+		&etcdutil.Member{Name: "test-0002"},
+	)
+	tests := []struct {
+		spec    api.ClusterSpec
+		pods    []*v1.Pod
+		types   []PlanActionType
+		blocked bool
+	}{{
+		spec: api.ClusterSpec{Size: 3, Version: "3.2.13"},
+		pods: []*v1.Pod{newPlanPod("test-0000", "3.2.13"), newPlanPod("test-0001", "3.2.13"), newPlanPod("test-0002", "3.2.13")},
+	}, {
+		spec:  api.ClusterSpec{Size: 3, Version: "3.2.13"},
+		pods:  []*v1.Pod{newPlanPod("test-0000", "3.2.13"), newPlanPod("test-0001", "3.2.13"), newPlanPod("test-0003", "3.2.13")},
+		types: []PlanActionType{PlanRemovePod, PlanRemoveDeadMember, PlanAddMember},
+	}, {
+		spec:    api.ClusterSpec{Size: 3, Version: "3.2.13"},
+		pods:    []*v1.Pod{newPlanPod("test-0000", "3.2.13")},
+		blocked: true,
+	}, {
+		spec:  api.ClusterSpec{Size: 2, Version: "3.3.0"},
+		pods:  []*v1.Pod{newPlanPod("test-0000", "3.2.13"), newPlanPod("test-0001", "3.3.0"), newPlanPod("test-0002", "3.2.13")},
+		types: []PlanActionType{PlanRemoveMember, PlanUpgradeMember, PlanUpgradeMember},
+	}, {
+		spec:  api.ClusterSpec{Size: 3, Version: "3.4.0"},
+		pods:  []*v1.Pod{newPlanPod("test-0000", "3.5.0"), newPlanPod("test-0001", "3.5.0"), newPlanPod("test-0002", "3.5.0")},
+		types: []PlanActionType{PlanEnableDowngrade, PlanUpgradeMember, PlanUpgradeMember, PlanUpgradeMember},
+	}, {
+		spec:    api.ClusterSpec{Size: 3, Version: "3.3.0"},
+		pods:    []*v1.Pod{newPlanPod("test-0000", "3.4.0"), newPlanPod("test-0001", "3.4.0"), newPlanPod("test-0002", "3.4.0")},
+		blocked: true,
+	}, {
+		spec:  api.ClusterSpec{Size: 3, Version: "3.3.0", Etcd: &api.EtcdPolicy{Metrics: api.EtcdMetricsExtensive}},
+		pods:  []*v1.Pod{newPlanPod("test-0000", "3.3.0"), newPlanPod("test-0001", "3.3.0"), newPlanPod("test-0002", "3.3.0")},
+		types: []PlanActionType{PlanReplaceMember, PlanReplaceMember, PlanReplaceMember},
+	}, {
+		// A promoted dev cluster grows first, then replaces its dev member.
+		spec:  api.ClusterSpec{Size: 3, Version: "3.2.13", Tier: api.ClusterTierProduction},
+		pods:  []*v1.Pod{newDevPlanPod("test-0000", "3.2.13"), newPlanPod("test-0001", "3.2.13")},
+		types: []PlanActionType{PlanRemoveDeadMember, PlanAddMember, PlanReplaceMember},
+	}}
+
+	for i, tt := range tests {
+		actions, blocked := planReconcile(tt.spec, members, tt.pods, nil, "")
+		var types []PlanActionType
+		for _, a := range actions {
+			types = append(types, a.Type)
+		}
+		if !reflect.DeepEqual(types, tt.types) {
+			t.Errorf("#%d: expect actions %v, get %v", i, tt.types, types)
+		}
+		if (len(blocked) != 0) != tt.blocked {
+			t.Errorf("#%d: expect blocked=%v, get %q", i, tt.blocked, blocked)
+		}
+	}
+}
+
+func TestRequestedReplacement(t *testing.T) {
+	ready := func(name string) *v1.Pod {
+		pod := newPlanPod(name, "3.2.13")
+		pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+		return pod
+	}
+	annotated := ready("test-0001")
+	annotated.Annotations[k8sutil.AnnotationReplace] = "true"
+	pods := []*v1.Pod{ready("test-0000"), annotated, newPlanPod("test-0002", "3.2.13")}
+
+	cl := &api.EtcdCluster{}
+	if get := requestedReplacement(pods, cl); get != "test-0001" {
+		t.Errorf("expect test-0001 requested by pod annotation, get %q", get)
+	}
+	cl.Annotations = map[string]string{k8sutil.AnnotationReplace: "test-0000"}
+	if get := requestedReplacement(pods, cl); get != "test-0000" {
+		t.Errorf("expect test-0000 requested by cluster annotation, get %q", get)
+	}
+	cl.Annotations[k8sutil.AnnotationReplace] = "test-0005"
+	if get := requestedReplacement(pods[:1], cl); get != "" {
+		t.Errorf("expect no member requested, get %q", get)
+	}
+
+	// test-0002 is not ready: replacing test-0001 leaves a single ready member out of three.
+	if err := checkReplacementQuorum(pods, "test-0001", 3); err == nil {
+		t.Error("expect replacement to be refused without quorum")
+	}
+	if err := checkReplacementQuorum(pods, "test-0002", 3); err != nil {
+		t.Errorf("expect replacement of the unready member to be allowed, get %v", err)
+	}
+	if err := checkReplacementQuorum(pods[:1], "test-0000", 1); err == nil {
+		t.Error("expect replacement of the only member to be refused")
+	}
+}
@@ -15,17 +15,16 @@
 package cluster
 
 import (
-	"context"
-	"errors"
 	"fmt"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
-	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 
-	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/pkg/errors"
 	"k8s.io/api/core/v1"
 )
 
@@ -35,7 +34,9 @@ var ErrLostQuorum = errors.New("lost quorum")
 // reconcile reconciles cluster current state to desired state specified by spec.
 // - it tries to reconcile the cluster to desired size.
 // - if the cluster needs for upgrade, it tries to upgrade old member one by one.
-func (c *Cluster) reconcile(pods []*v1.Pod) error {
+// - a downgrade to the previous minor version first enables the etcd downgrade API.
+// leaving are the pods being deleted, whose members are replaced as if they were dead.
+func (c *Cluster) reconcile(pods, leaving []*v1.Pod) error {
 	c.logger.Infoln("Start reconciling")
 	defer c.logger.Infoln("Finish reconciling")
 
@@ -43,20 +44,73 @@ func (c *Cluster) reconcile(pods []*v1.Pod) error {
 		c.status.Size = c.members.Size()
 	}()
 
+	if restarting, err := c.recreateRestartedMembers(pods, leaving); restarting || err != nil {
+		return err
+	}
+
 	sp := c.cluster.Spec
-	running := podsToMemberSet(pods, c.isSecureClient())
+	running := podsToMemberSet(pods, c.cluster.Spec)
 	if !running.IsEqual(c.members) || c.members.Size() != sp.Size {
-		return c.reconcileMembers(running)
+		return c.reconcileMembers(pods, leaving, running)
 	}
 	c.status.ClearCondition(api.ClusterConditionScaling)
+	c.status.ClearCondition(api.ClusterConditionRepairPaused)
+	if len(c.memberFailures) == 0 {
+		c.status.ClearCondition(api.ClusterConditionMemberFailed)
+	}
 
 	if needUpgrade(pods, sp) {
+		if err := c.upgradePreflight(pods); err != nil {
+			// Not an error of the reconcile: it must neither back off nor count towards spec.maxReconcileFailures.
+			c.logger.Warningf("not starting upgrade to %s: %v", sp.Version, err)
+			c.status.SetUpgradeRefusedCondition(sp.Version, err.Error())
+			return nil
+		}
+		c.transition(api.ClusterPhaseUpgrading)
 		c.status.UpgradeVersionTo(sp.Version)
 
+		if err := c.prepareDowngrade(pods, sp.Version); err != nil {
+			return err
+		}
 		m := pickOneOldMember(pods, sp.Version)
-		return c.upgradeOneMember(m.Name)
+		err := c.upgradeOneMember(m.Name)
+		c.recordPlanAction(PlanAction{Type: PlanUpgradeMember, Member: m.Name, Reason: fmt.Sprintf("upgrade to %s", sp.Version)}, err)
+		return err
 	}
 	c.status.ClearCondition(api.ClusterConditionUpgrading)
+	c.transition(api.ClusterPhaseRunning)
+
+	if len(pods) == sp.Size {
+		if rolled, err := c.reconcileCARotation(pods); rolled || err != nil {
+			return err
+		}
+	}
+
+	if m := c.pickOneCorruptedMember(pods); m != nil && len(pods) == sp.Size {
+		return c.replaceCorruptedMember(pods, m.Name)
+	}
+
+	if name := requestedReplacement(pods, c.cluster); len(name) != 0 && len(pods) == sp.Size {
+		return c.replaceRequestedMember(pods, name)
+	}
+
+	if name := requestedRestart(pods, c.cluster); len(name) != 0 && len(pods) == sp.Size {
+		return c.restartRequestedMember(pods, name)
+	}
+
+	if m := pickOneMemberWithOldMetrics(pods, sp); m != nil && len(pods) == sp.Size {
+		return c.replaceMemberForMetrics(pods, m.Name)
+	}
+
+	if m := pickOneDevTierMember(pods, sp); m != nil && len(pods) == sp.Size {
+		return c.replaceDevTierMember(pods, m.Name)
+	}
+
+	if len(pods) == sp.Size {
+		if migrating, err := c.migrateStorage(pods); migrating || err != nil {
+			return err
+		}
+	}
 
 	c.status.SetVersion(sp.Version)
 	c.status.SetReadyCondition()
@@ -67,78 +121,121 @@ func (c *Cluster) reconcile(pods []*v1.Pod) error {
 // reconcileMembers reconciles
 // - running pods on k8s and cluster membership
 // - cluster membership and expected size of etcd cluster
-// Steps:
-// 1. Remove all pods from running set that does not belong to member set.
-// 2. L consist of remaining pods of runnings
-// 3. If L = members, the current state matches the membership state. END.
-// 4. If len(L) < len(members)/2 + 1, return quorum lost error.
-// 5. Add one missing member. END.
-func (c *Cluster) reconcileMembers(running etcdutil.MemberSet) error {
-	c.logger.Infof("running members: %s", running)
-	c.logger.Infof("cluster membership: %s", c.members)
-
-	unknownMembers := running.Diff(c.members)
-	if unknownMembers.Size() > 0 {
-		c.logger.Infof("removing unexpected pods: %v", unknownMembers)
-		for _, m := range unknownMembers {
-			if err := c.removePod(m.Name); err != nil {
+// It takes the actions decided by decideMembers.
+func (c *Cluster) reconcileMembers(pods, leaving []*v1.Pod, running etcdutil.MemberSet) error {
+	c.logger.Infof("running pods compared to the cluster membership: %s", c.members.Compare(running).Explain())
+
+	d := decideMembers(c.cluster.Spec, c.members, pods, leaving, c.status.Leader)
+	budget := 0
+	for _, a := range d.actions {
+		if a.Type == PlanRemovePod {
+			budget++
+		}
+	}
+	budget = c.podDeletionBudget(budget)
+	for _, a := range d.actions {
+		switch a.Type {
+		case PlanRemovePod:
+			c.transition(api.ClusterPhaseRecovering)
+			if budget == 0 {
+				c.logger.Infof("pod deletion budget used up, removing the other unexpected pods in the next reconciliation")
+				return nil
+			}
+			c.logger.Infof("removing unexpected pod (%s)", a.Member)
+			if err := c.removePod(a.Member); err != nil {
 				return err
 			}
+			budget--
+		case PlanRemoveDeadMember:
+			c.transition(api.ClusterPhaseRecovering)
+			c.logger.Infof("removing one dead member")
+			err := c.removeDeadMember(pods, c.members[a.Member])
+			c.recordPlanAction(a, err)
+			return err
+		case PlanRemoveLeavingMember:
+			c.transition(api.ClusterPhaseRecovering)
+			err := c.removeLeavingMember(c.members[a.Member])
+			c.recordPlanAction(a, err)
+			return err
+		case PlanAddMember:
+			c.transition(api.ClusterPhaseResizing)
+			err := c.addOneMember()
+			c.recordPlanAction(a, err)
+			return err
+		case PlanRemoveMember:
+			c.transition(api.ClusterPhaseResizing)
+			c.status.SetScalingDownCondition(c.members.Size(), c.cluster.Spec.Size)
+			c.logger.Infof("removing member (%s) to scale down to %d members", a.Member, c.cluster.Spec.Size)
+			err := c.removeMember(c.members[a.Member])
+			c.recordPlanAction(a, err)
+			return err
 		}
 	}
-	L := running.Diff(unknownMembers)
-
-	if L.Size() == c.members.Size() {
-		return c.resize()
-	}
 
-	if L.Size() < c.members.Size()/2+1 {
+	switch {
+	case d.lostQuorum:
+		c.transition(api.ClusterPhaseRecovering)
 		return ErrLostQuorum
+	case len(d.blocked) != 0:
+		c.transition(api.ClusterPhaseResizing)
+		c.status.SetScalingDownCondition(c.members.Size(), c.cluster.Spec.Size)
+		c.logger.Warningf("not scaling down yet: %s", d.blocked)
 	}
-
-	c.logger.Infof("removing one dead member")
-	// remove dead members that doesn't have any running pods before doing resizing.
-	return c.removeDeadMember(c.members.Diff(L).PickOne())
+	return nil
 }
 
-func (c *Cluster) resize() error {
-	if c.members.Size() == c.cluster.Spec.Size {
+func (c *Cluster) addOneMember() error {
+	c.status.SetScalingUpCondition(c.members.Size(), c.cluster.Spec.Size)
+
+	if l := c.members.Learner(); l != nil {
+		c.logger.Infof("waiting for learner (%s) to be promoted before adding another member", l.Name)
 		return nil
 	}
 
-	if c.members.Size() < c.cluster.Spec.Size {
-		return c.addOneMember()
+	var node string
+	if c.cluster.Spec.DiskPreflight != nil {
+		var err error
+		if node, err = c.diskPreflight(); err != nil || len(node) == 0 {
+			return err
+		}
 	}
 
-	return c.removeOneMember()
-}
-
-func (c *Cluster) addOneMember() error {
-	c.status.SetScalingUpCondition(c.members.Size(), c.cluster.Spec.Size)
-
-	cfg := clientv3.Config{
-		Endpoints:   c.members.ClientURLs(),
-		DialTimeout: constants.DefaultDialTimeout,
-		TLS:         c.tlsConfig,
-	}
-	etcdcli, err := clientv3.New(cfg)
+	etcdcli, err := c.etcdClient()
 	if err != nil {
-		return fmt.Errorf("add one member failed: creating etcd client failed %v", err)
+		return fmt.Errorf("add one member failed: %v", err)
 	}
-	defer etcdcli.Close()
-
 	newMember := c.newMember()
-	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
-	resp, err := etcdcli.MemberAdd(ctx, []string{newMember.PeerURL()})
-	cancel()
-	if err != nil {
-		return fmt.Errorf("fail to add new member (%s): %v", newMember.Name, err)
+	if c.supports(etcdutil.FeatureLearner) {
+		// A learner does not count towards quorum until it has caught up and is promoted by reconcileLearners.
+		id, err := etcdutil.AddLearner(c.ctx, etcdcli, newMember.PeerURL(), c.timeouts().MemberAdd)
+		if err != nil {
+			return fmt.Errorf("fail to add new learner (%s): %v", newMember.Name, err)
+		}
+		newMember.ID = id
+		newMember.IsLearner = true
+		c.learnerSince[newMember.Name] = time.Now()
+	} else {
+		id, err := etcdutil.AddMember(c.ctx, etcdcli, newMember.PeerURL(), c.timeouts().MemberAdd)
+		if err != nil {
+			return fmt.Errorf("fail to add new member (%s): %v", newMember.Name, err)
+		}
+		newMember.ID = id
 	}
-	newMember.ID = resp.Member.ID
 	c.members.Add(newMember)
 
-	if err := c.createPod(c.members, newMember, "existing"); err != nil {
-		return fmt.Errorf("fail to create member's pod (%s): %v", newMember.Name, err)
+	reason := api.MemberCreationScaleUp
+	if c.pendingReplacements > 0 {
+		reason = api.MemberCreationReplacement
+	}
+	if err := c.createPod(c.members, newMember, "existing", node, reason); err != nil {
+		c.undoAddMember(etcdcli, newMember)
+		return errors.Wrapf(err, "fail to create member's pod (%s)", newMember.Name)
+	}
+	if reason == api.MemberCreationReplacement {
+		c.pendingReplacements--
+		ev := notifyutil.NewEvent(notifyutil.EventMemberReplaced, c.cluster.Namespace, c.cluster.Name)
+		ev.Member = newMember.Name
+		c.config.Hooks.Fire(ev)
 	}
 	c.logger.Infof("added member (%s)", newMember.Name)
 	_, err = c.eventsCli.Create(k8sutil.NewMemberAddEvent(newMember.Name, c.cluster))
@@ -148,13 +245,64 @@ func (c *Cluster) addOneMember() error {
 	return nil
 }
 
-func (c *Cluster) removeOneMember() error {
-	c.status.SetScalingDownCondition(c.members.Size(), c.cluster.Spec.Size)
+// pickMemberToRemove returns the member to remove when scaling down: an unready member if there is one,
+// otherwise a member other than the leader. Removing the leader forces an election.
+// Members annotated hands-off are never picked: it returns nil if all are.
+func pickMemberToRemove(pods []*v1.Pod, ms etcdutil.MemberSet, leader string) *etcdutil.Member {
+	ready := map[string]bool{}
+	for _, pod := range pods {
+		ready[pod.Name] = k8sutil.IsPodReady(pod)
+	}
+	handsOff := handsOffPods(pods)
+	var picked *etcdutil.Member
+	for _, name := range ms.Names() {
+		m := ms[name]
+		switch {
+		case handsOff[name]:
+			continue
+		case !ready[name]:
+			return m
+		case picked == nil || picked.Name == leader:
+			picked = m
+		}
+	}
+	return picked
+}
 
-	return c.removeMember(c.members.PickOne())
+// checkRemovalQuorum returns an error if removing the ready member would leave the cluster of size-1 members without quorum.
+// Removing an unready member never does.
+func checkRemovalQuorum(pods []*v1.Pod, name string, size int) error {
+	ready := 0
+	for _, pod := range pods {
+		if pod.Name == name && !k8sutil.IsPodReady(pod) {
+			return nil
+		}
+		if pod.Name != name && k8sutil.IsPodReady(pod) {
+			ready++
+		}
+	}
+	if !hasQuorum(size-1, ready) {
+		return fmt.Errorf("only %d of the other %d members are ready, removing member (%s) would lose quorum", ready, size-1, name)
+	}
+	return nil
 }
 
-func (c *Cluster) removeDeadMember(toRemove *etcdutil.Member) error {
+func (c *Cluster) removeDeadMember(pods []*v1.Pod, toRemove *etcdutil.Member) error {
+	f, ok := c.diagnoseMemberFailure(toRemove.Name)
+	if ok && !f.replace {
+		c.logger.Warningf("not replacing dead member (%s): a new member would fail the same way (%s)", toRemove.Name, f.cause)
+		return nil
+	}
+	if ok && f.cause == memberFailureDataCorruption {
+		// The replacement starts on empty data, which must be synced from a healthy quorum.
+		if err := c.checkHealthyQuorumWithout(pods, toRemove.Name); err != nil {
+			c.logger.Warningf("not wiping the corrupted data of dead member (%s): %v", toRemove.Name, err)
+			return nil
+		}
+	}
+	if !c.useReplacementBudget(toRemove.Name) {
+		return nil
+	}
 	c.logger.Infof("removing dead member %q", toRemove.Name)
 	_, err := c.eventsCli.Create(k8sutil.ReplacingDeadMemberEvent(toRemove.Name, c.cluster))
 	if err != nil {
@@ -164,14 +312,35 @@ func (c *Cluster) removeDeadMember(toRemove *etcdutil.Member) error {
 	return c.removeMember(toRemove)
 }
 
+// removeLeavingMember removes the member whose pod is being deleted, e.g. evicted by a node drain,
+// so that its replacement is added without waiting for the pod to be gone.
+func (c *Cluster) removeLeavingMember(toRemove *etcdutil.Member) error {
+	if !c.useReplacementBudget(toRemove.Name) {
+		return nil
+	}
+	c.logger.Infof("removing leaving member %q", toRemove.Name)
+	_, err := c.eventsCli.Create(k8sutil.ReplacingLeavingMemberEvent(toRemove.Name, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create replacing leaving member event: %v", err)
+	}
+	return c.removeMember(toRemove)
+}
+
 func (c *Cluster) removeMember(toRemove *etcdutil.Member) (err error) {
+	if c.isHandsOff(toRemove.Name, "removing") {
+		return nil
+	}
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("remove member (%s) failed: %v", toRemove.Name, err)
 		}
 	}()
 
-	err = etcdutil.RemoveMember(c.members.ClientURLs(), c.tlsConfig, toRemove.ID)
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	err = etcdutil.RemoveMember(c.ctx, etcdcli, toRemove.ID, c.timeouts().Delete)
 	if err != nil {
 		switch err {
 		case rpctypes.ErrMemberNotFound:
@@ -181,6 +350,10 @@ func (c *Cluster) removeMember(toRemove *etcdutil.Member) (err error) {
 		}
 	}
 	c.members.Remove(toRemove.Name)
+	delete(c.memberFailures, toRemove.Name)
+	if c.members.Size() < c.cluster.Spec.Size {
+		c.pendingReplacements++
+	}
 	_, err = c.eventsCli.Create(k8sutil.MemberRemoveEvent(toRemove.Name, c.cluster))
 	if err != nil {
 		c.logger.Errorf("failed to create remove member event: %v", err)
@@ -193,6 +366,11 @@ func (c *Cluster) removeMember(toRemove *etcdutil.Member) (err error) {
 		if err != nil {
 			return err
 		}
+		// The WAL PVC is removed even if walVolumeClaimSpec has been unset since the member was created.
+		err = c.removePVC(k8sutil.WALPVCNameFromMember(toRemove.Name))
+		if err != nil {
+			return err
+		}
 	}
 	c.logger.Infof("removed member (%v) with ID (%d)", toRemove.Name, toRemove.ID)
 	return nil
@@ -210,12 +388,81 @@ func needUpgrade(pods []*v1.Pod, cs api.ClusterSpec) bool {
 	return len(pods) == cs.Size && pickOneOldMember(pods, cs.Version) != nil
 }
 
-func pickOneOldMember(pods []*v1.Pod, newVersion string) *etcdutil.Member {
+func pickOneMemberWithOldMetrics(pods []*v1.Pod, cs api.ClusterSpec) *etcdutil.Member {
 	for _, pod := range pods {
-		if k8sutil.GetEtcdVersion(pod) == newVersion {
+		if k8sutil.GetEtcdMetrics(pod) == cs.Etcd.MetricsOrDefault() || k8sutil.IsHandsOffPod(pod) {
 			continue
 		}
 		return &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace}
 	}
 	return nil
 }
+
+// replaceMemberForMetrics removes the member, so that the next reconcile adds a new member
+// started with spec.etcd.metrics. etcd reads --metrics only on start and the command of a pod cannot be updated.
+// It waits for the other members to be ready.
+func (c *Cluster) replaceMemberForMetrics(pods []*v1.Pod, name string) error {
+	m, ok := c.members[name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found in cluster membership", name)
+	}
+	if err := checkReplacementQuorum(pods, name, c.members.Size()); err != nil {
+		c.logger.Infof("not replacing the member to change its metrics yet: %v", err)
+		return nil
+	}
+	if !c.useReplacementBudget(name) {
+		return nil
+	}
+	c.logger.Infof("replacing member (%s) to change its metrics to %s", name, c.cluster.Spec.Etcd.MetricsOrDefault())
+	return c.removeMember(m)
+}
+
+// pickOneDevTierMember returns a member created while the cluster was a dev cluster, once it no longer is.
+func pickOneDevTierMember(pods []*v1.Pod, cs api.ClusterSpec) *etcdutil.Member {
+	if cs.IsDevTier() {
+		return nil
+	}
+	for _, pod := range pods {
+		if k8sutil.IsDevTierPod(pod) && !k8sutil.IsHandsOffPod(pod) {
+			return &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace}
+		}
+	}
+	return nil
+}
+
+// replaceDevTierMember removes the member of a promoted dev cluster, so that the next reconcile adds a new member
+// with the pod policy of a production cluster, e.g. its anti-affinity. It waits for the other members to be ready.
+func (c *Cluster) replaceDevTierMember(pods []*v1.Pod, name string) error {
+	m, ok := c.members[name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found in cluster membership", name)
+	}
+	if err := checkReplacementQuorum(pods, name, c.members.Size()); err != nil {
+		c.logger.Infof("not replacing the member of the dev cluster yet: %v", err)
+		return nil
+	}
+	if !c.useReplacementBudget(name) {
+		return nil
+	}
+	c.logger.Infof("replacing member (%s) created while the cluster was a %s cluster", name, api.ClusterTierDev)
+	return c.removeMember(m)
+}
+
+// pickOneOldMember returns a member not at the new version. The members annotated hands-off are picked last:
+// the upgrade then waits for them.
+func pickOneOldMember(pods []*v1.Pod, newVersion string) *etcdutil.Member {
+	var handsOff *etcdutil.Member
+	for _, pod := range pods {
+		if k8sutil.GetEtcdVersion(pod) == newVersion {
+			continue
+		}
+		m := &etcdutil.Member{Name: pod.Name, Namespace: pod.Namespace}
+		if !k8sutil.IsHandsOffPod(pod) {
+			return m
+		}
+		if handsOff == nil {
+			handsOff = m
+		}
+	}
+	return handsOff
+}
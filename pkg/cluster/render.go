@@ -0,0 +1,82 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// ErrMemberNotFound is returned when rendering the pod of a member that is not a member of the cluster.
+var ErrMemberNotFound = errors.New("member not found")
+
+type podReply struct {
+	pod *v1.Pod
+	err error
+}
+
+// RenderPod renders, in the run loop of the cluster, the pod the operator would create for the member
+// with the current spec: the pod a restart of the member creates, or, if member is empty, the pod of the next
+// member added to the cluster. It does not change the cluster.
+func (c *Cluster) RenderPod(member string) (*v1.Pod, error) {
+	replyCh := make(chan podReply, 1)
+	c.send(&clusterEvent{
+		typ:    eventRenderPod,
+		member: member,
+		podCh:  replyCh,
+	})
+
+	select {
+	case r := <-replyCh:
+		return r.pod, r.err
+	case <-c.ctx.Done():
+		return nil, errors.New("cluster is deleted")
+	case <-time.After(planTimeout):
+		return nil, errors.New("timed out waiting for the cluster to render the pod")
+	}
+}
+
+func (c *Cluster) renderPod(name string) (*v1.Pod, error) {
+	if c.members == nil {
+		return nil, errors.New("the membership of the cluster is not known yet")
+	}
+	if len(name) == 0 {
+		m := c.newMember()
+		members := etcdutil.MemberSet{}
+		for _, known := range c.members {
+			members.Add(known)
+		}
+		members.Add(m)
+		pod, _, err := c.newMemberPod(members, m, "existing", "", c.status.MemberGeneration+1, api.MemberCreationScaleUp)
+		return pod, err
+	}
+
+	m, ok := c.members[name]
+	if !ok {
+		return nil, ErrMemberNotFound
+	}
+	pods, err := c.listPods()
+	if err != nil {
+		return nil, err
+	}
+	r := restartingMemberOf(pods, name)
+	pod, _, err := c.newMemberPod(c.members, m, "existing", "", r.generation, r.reason)
+	return pod, err
+}
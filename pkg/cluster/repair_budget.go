@@ -0,0 +1,80 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+// replacementWindow is the period spec.repairBudget.maxMemberReplacementsPerHour counts replacements over.
+const replacementWindow = time.Hour
+
+// useReplacementBudget tells whether the member may be replaced now and, if so, counts the replacement.
+// Once the budget is used up, it sets the RepairPaused condition and the member is left as it is
+// until the oldest counted replacement falls out of the window.
+func (c *Cluster) useReplacementBudget(memberName string) bool {
+	b := c.cluster.Spec.RepairBudget
+	if b == nil {
+		return true
+	}
+
+	now := time.Now()
+	var recent []time.Time
+	for _, t := range c.replacements {
+		if now.Sub(t) < replacementWindow {
+			recent = append(recent, t)
+		}
+	}
+	c.replacements = recent
+
+	if len(recent) < b.MaxMemberReplacementsPerHour {
+		c.replacements = append(c.replacements, now)
+		c.status.ClearCondition(api.ClusterConditionRepairPaused)
+		return true
+	}
+
+	c.logger.Warningf("not replacing member (%s): %d members were replaced within the last %v", memberName, len(recent), replacementWindow)
+	if !c.repairPaused() {
+		c.config.Notifier.Notify("etcd cluster %s/%s paused repair: %d members were replaced within the last hour",
+			c.cluster.Namespace, c.cluster.Name, len(recent))
+		_, err := c.eventsCli.Create(k8sutil.RepairPausedEvent(memberName, len(recent), c.cluster))
+		if err != nil {
+			c.logger.Errorf("failed to create repair paused event: %v", err)
+		}
+	}
+	c.status.SetRepairPausedCondition(fmt.Sprintf("%d members were replaced within the last hour", len(recent)))
+	return false
+}
+
+func (c *Cluster) repairPaused() bool {
+	for _, cond := range c.status.Conditions {
+		if cond.Type == api.ClusterConditionRepairPaused {
+			return true
+		}
+	}
+	return false
+}
+
+// podDeletionBudget returns the number of unexpected pods that may be deleted in one reconciliation.
+func (c *Cluster) podDeletionBudget(unexpected int) int {
+	if b := c.cluster.Spec.RepairBudget; b != nil && unexpected > b.MaxPodDeletionsPerReconcile {
+		return b.MaxPodDeletionsPerReconcile
+	}
+	return unexpected
+}
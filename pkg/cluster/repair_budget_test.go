@@ -0,0 +1,71 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUseReplacementBudget(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: metav1.NamespaceDefault},
+		Spec:       api.ClusterSpec{RepairBudget: &api.RepairBudgetPolicy{MaxMemberReplacementsPerHour: 2}},
+	}
+	c := &Cluster{
+		logger:    logrus.WithField("pkg", "cluster"),
+		cluster:   cl,
+		eventsCli: fake.NewSimpleClientset().CoreV1().Events(cl.Namespace),
+		// a replacement that already fell out of the window.
+		replacements: []time.Time{time.Now().Add(-2 * replacementWindow)},
+	}
+
+	for i := 0; i < 2; i++ {
+		if !c.useReplacementBudget("test-0000") {
+			t.Fatalf("#%d: expect replacement within budget to be allowed", i)
+		}
+	}
+	if c.useReplacementBudget("test-0000") {
+		t.Fatal("expect replacement over budget to be refused")
+	}
+	if !c.repairPaused() {
+		t.Error("expect RepairPaused condition once the budget is used up")
+	}
+
+	c.replacements[0] = time.Now().Add(-2 * replacementWindow)
+	if !c.useReplacementBudget("test-0000") {
+		t.Fatal("expect replacement to be allowed once the oldest one left the window")
+	}
+	if c.repairPaused() {
+		t.Error("expect RepairPaused condition to be cleared")
+	}
+}
+
+func TestPodDeletionBudget(t *testing.T) {
+	c := &Cluster{cluster: &api.EtcdCluster{}}
+	if get := c.podDeletionBudget(3); get != 3 {
+		t.Errorf("expect no limit without repair budget, get %d", get)
+	}
+	c.cluster.Spec.RepairBudget = &api.RepairBudgetPolicy{MaxPodDeletionsPerReconcile: 1}
+	if get := c.podDeletionBudget(3); get != 1 {
+		t.Errorf("expect budget=1, get %d", get)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// requestedReplacement returns the member a user asked to replace, either by annotating
+// its pod with the replace annotation set to "true" or the cluster with the member name.
+// It returns "" if no running member is requested.
+func requestedReplacement(pods []*v1.Pod, cl *api.EtcdCluster) string {
+	return requestedMember(pods, cl, k8sutil.AnnotationReplace)
+}
+
+// requestedMember returns the first running member, by name, requested with the annotation
+// set to "true" on its pod or to the member name on the cluster, "" if none is.
+func requestedMember(pods []*v1.Pod, cl *api.EtcdCluster, annotation string) string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Annotations[annotation] == "true" {
+			names = append(names, pod.Name)
+		}
+		if cl.Annotations[annotation] == pod.Name {
+			names = append(names, pod.Name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// checkReplacementQuorum returns an error unless the members other than name have
+// enough ready pods to keep quorum once the replacement is added back.
+func checkReplacementQuorum(pods []*v1.Pod, name string, size int) error {
+	ready := 0
+	for _, pod := range pods {
+		if pod.Name != name && k8sutil.IsPodReady(pod) {
+			ready++
+		}
+	}
+	if !hasQuorum(size, ready) {
+		return fmt.Errorf("only %d of the other %d members are ready, replacing member (%s) would lose quorum", ready, size-1, name)
+	}
+	return nil
+}
+
+// replaceRequestedMember removes the member, so that the next reconcile adds a new member in its place.
+// The replacement is refused if it would make the cluster lose quorum, e.g. while another member is unready.
+func (c *Cluster) replaceRequestedMember(pods []*v1.Pod, name string) error {
+	m, ok := c.members[name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found in cluster membership", name)
+	}
+	if err := checkReplacementQuorum(pods, name, c.members.Size()); err != nil {
+		c.logger.Warningf("not replacing member on request: %v", err)
+		return nil
+	}
+	c.logger.Infof("replacing member (%s) on request", name)
+	_, err := c.eventsCli.Create(k8sutil.ReplacingRequestedMemberEvent(name, k8sutil.AnnotationReplace, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create replacing requested member event: %v", err)
+	}
+	return c.removeMember(m)
+}
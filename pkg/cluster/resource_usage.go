@@ -0,0 +1,92 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const resourceUsageInterval = time.Minute
+
+var reportedResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceStorage}
+
+// updateResourceUsageIfDue sums the resources requested and used by the members into
+// status.resources and the resource metrics, at most once per resourceUsageInterval.
+// CPU and memory usage are left out if the resource metrics API is not available.
+func (c *Cluster) updateResourceUsageIfDue(running []*v1.Pod) error {
+	if time.Since(c.lastResourceUsage) < resourceUsageInterval {
+		return nil
+	}
+	c.lastResourceUsage = time.Now()
+
+	requested := k8sutil.PodResourceRequests(running)
+	if c.isPodPVEnabled() {
+		pvcs, err := c.config.KubeCli.CoreV1().PersistentVolumeClaims(c.cluster.Namespace).List(k8sutil.ClusterListOpt(c.cluster.Name))
+		if err != nil {
+			return err
+		}
+		requested[v1.ResourceStorage] = k8sutil.PVCStorageRequests(pvcs.Items)
+	}
+
+	used, err := k8sutil.PodResourceUsage(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace)
+	if err != nil {
+		c.logger.Debugf("cpu and memory usage not collected: %v", err)
+		used = v1.ResourceList{}
+	}
+	var dbSize int64
+	for _, m := range c.members {
+		st, err := etcdutil.MemberStatus(c.ctx, m.ClientURL(), c.tlsConfig, c.clientOptions())
+		if err != nil {
+			return err
+		}
+		dbSize += st.DbSize
+	}
+	used[v1.ResourceStorage] = *resource.NewQuantity(dbSize, resource.BinarySI)
+
+	c.status.Resources = &api.ResourceUsage{
+		Requested:  requested,
+		Used:       used,
+		UpdateTime: c.lastResourceUsage.UTC().Format(time.RFC3339),
+	}
+	for _, name := range reportedResources {
+		c.setResourceMetric(resourcesRequested, name, requested)
+		c.setResourceMetric(resourcesUsed, name, used)
+	}
+	return nil
+}
+
+func (c *Cluster) setResourceMetric(g *prometheus.GaugeVec, name v1.ResourceName, rl v1.ResourceList) {
+	q, ok := rl[name]
+	if !ok {
+		g.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name, string(name))
+		return
+	}
+	g.WithLabelValues(c.cluster.Namespace, c.cluster.Name, string(name)).Set(float64(q.MilliValue()) / 1000)
+}
+
+func (c *Cluster) deleteResourceUsageMetrics() {
+	for _, name := range reportedResources {
+		resourcesRequested.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name, string(name))
+		resourcesUsed.DeleteLabelValues(c.cluster.Namespace, c.cluster.Name, string(name))
+	}
+}
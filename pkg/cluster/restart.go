@@ -0,0 +1,151 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// restartingMember is the member generation and creation reason of the deleted pod of a member restarted in place,
+// which its new pod keeps.
+type restartingMember struct {
+	generation int64
+	reason     api.MemberCreationReason
+}
+
+// restartingMemberOf returns the member generation and creation reason of the pod of the member,
+// those of a replacement of unknown generation if the pod is not found or not annotated.
+func restartingMemberOf(pods []*v1.Pod, name string) restartingMember {
+	r := restartingMember{reason: api.MemberCreationReplacement}
+	for _, pod := range pods {
+		if pod.Name != name {
+			continue
+		}
+		r.generation, _ = strconv.ParseInt(pod.Annotations[k8sutil.AnnotationMemberGeneration], 10, 64)
+		if reason, ok := pod.Annotations[k8sutil.AnnotationMemberCreationReason]; ok {
+			r.reason = api.MemberCreationReason(reason)
+		}
+		break
+	}
+	return r
+}
+
+// requestedRestart returns the member a user asked to restart, either by annotating
+// its pod with the restart annotation set to "true" or the cluster with the member name.
+// It returns "" if no running member is requested.
+func requestedRestart(pods []*v1.Pod, cl *api.EtcdCluster) string {
+	return requestedMember(pods, cl, k8sutil.AnnotationRestart)
+}
+
+// checkRestartQuorum returns an error unless the members other than name keep quorum
+// of the cluster of the given size with their ready pods while the member is down.
+func checkRestartQuorum(pods []*v1.Pod, name string, size int) error {
+	ready := 0
+	for _, pod := range pods {
+		if pod.Name != name && k8sutil.IsPodReady(pod) {
+			ready++
+		}
+	}
+	if !hasQuorum(size, ready) {
+		return fmt.Errorf("only %d of the other %d members are ready, restarting member (%s) would lose quorum", ready, size-1, name)
+	}
+	return nil
+}
+
+// restartRequestedMember deletes the pod of the member without removing the member from the cluster.
+// recreateRestartedMembers creates its pod again once the deleted pod is gone, with the same name and PVCs,
+// so that the member restarts on its data and only syncs the changes it missed.
+// Without persistent volumes the data of the member goes with its pod, which etcd requires to be replaced:
+// the member is replaced instead. The restart is refused if it would make the cluster lose quorum.
+func (c *Cluster) restartRequestedMember(pods []*v1.Pod, name string) error {
+	m, ok := c.members[name]
+	if !ok {
+		return fmt.Errorf("member (%s) not found in cluster membership", name)
+	}
+	if c.isHandsOff(name, "restarting") {
+		return nil
+	}
+	if err := checkRestartQuorum(pods, name, c.members.Size()); err != nil {
+		c.logger.Warningf("not restarting member on request: %v", err)
+		return nil
+	}
+	if c.cluster.Annotations[k8sutil.AnnotationRestart] == name {
+		// The member keeps its name: the request would restart it over and over.
+		if err := c.removeClusterAnnotation(k8sutil.AnnotationRestart); err != nil {
+			return fmt.Errorf("failed to remove annotation %s: %v", k8sutil.AnnotationRestart, err)
+		}
+	}
+	if !c.isPodPVEnabled() {
+		c.logger.Infof("replacing member (%s) on restart request: its data is not on a persistent volume", name)
+		_, err := c.eventsCli.Create(k8sutil.ReplacingRequestedMemberEvent(name, k8sutil.AnnotationRestart, c.cluster))
+		if err != nil {
+			c.logger.Errorf("failed to create replacing requested member event: %v", err)
+		}
+		return c.removeMember(m)
+	}
+
+	r := restartingMemberOf(pods, name)
+	c.logger.Infof("restarting member (%s) on request", name)
+	if err := c.removePod(name); err != nil {
+		return fmt.Errorf("failed to delete pod of member (%s): %v", name, err)
+	}
+	c.restarting[name] = r
+	_, err := c.eventsCli.Create(k8sutil.RestartingRequestedMemberEvent(name, c.cluster))
+	if err != nil {
+		c.logger.Errorf("failed to create restarting requested member event: %v", err)
+	}
+	return nil
+}
+
+// recreateRestartedMembers creates the pods of the members being restarted whose deleted pods are gone.
+// It returns true while a member is being restarted, during which the reconciliation must not take
+// the member for dead and replace it.
+// The members being restarted are only known to the operator until it restarts; the reconciliation
+// after a restart of the operator replaces a member whose pod is gone as a dead member.
+func (c *Cluster) recreateRestartedMembers(pods, leaving []*v1.Pod) (bool, error) {
+	if len(c.restarting) == 0 {
+		return false, nil
+	}
+	present := map[string]bool{}
+	for _, pod := range pods {
+		present[pod.Name] = true
+	}
+	for _, pod := range leaving {
+		present[pod.Name] = true
+	}
+	for name, r := range c.restarting {
+		m, ok := c.members[name]
+		if !ok {
+			delete(c.restarting, name)
+			continue
+		}
+		if present[name] {
+			c.logger.Infof("waiting for the pod of restarted member (%s) to be gone", name)
+			continue
+		}
+		if err := c.createMemberPod(c.members, m, "existing", "", r.generation, r.reason, true); err != nil {
+			return true, fmt.Errorf("failed to recreate pod of restarted member (%s): %v", name, err)
+		}
+		c.logger.Infof("recreated pod of restarted member (%s)", name)
+		delete(c.restarting, name)
+	}
+	return true, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// restoreFromBackupIfAllowed requests the restore operator to restore the cluster from its latest successful backup
+// once it lost quorum, if spec.selfHealing.restoreFromBackup is set. membersLeft tells whether any member pod or PVC
+// of the cluster is left: if so, the restore waits for spec.selfHealing.restoreAfterSeconds of lost quorum.
+// It returns whether the cluster is being, or is about to be, restored.
+// The restore is only requested once for the cluster; the restore operator deletes and recreates it.
+func (c *Cluster) restoreFromBackupIfAllowed(membersLeft bool) (bool, error) {
+	if c.isStandby() {
+		// A standby is restored from the backups of its primary instead.
+		return c.syncStandby()
+	}
+	if sh := c.cluster.Spec.SelfHealing; sh == nil || !sh.RestoreFromBackup {
+		return false, nil
+	}
+	restoreCli := c.config.EtcdCRCli.EtcdV1beta2().EtcdRestores(c.cluster.Namespace)
+	// The restore operator requires the restore to be named after the cluster.
+	er, err := restoreCli.Get(c.cluster.Name, metav1.GetOptions{})
+	switch {
+	case err == nil && !er.CreationTimestamp.Before(&c.cluster.CreationTimestamp):
+		if len(er.Status.Reason) != 0 {
+			c.logger.Warningf("restore of the cluster failed: %s", er.Status.Reason)
+		}
+		return true, nil
+	case err == nil:
+		// A restore of an earlier cluster of the same name, or of this one before it was restored.
+		if err := restoreCli.Delete(er.Name, &metav1.DeleteOptions{}); err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return false, fmt.Errorf("failed to delete previous restore (%s): %v", er.Name, err)
+		}
+	case !k8sutil.IsKubernetesResourceNotFoundError(err):
+		return false, err
+	}
+
+	backups, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdBackups(c.cluster.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	eb := k8sutil.LatestBackup(c.cluster.Name, c.cluster.Namespace, backups.Items)
+	if eb == nil {
+		c.logger.Warningf("not restoring the cluster: no successful backup of it found")
+		return false, nil
+	}
+	if due, wait := restoreDue(c.cluster.Spec.SelfHealing, c.status.QuorumLostTime, time.Now(), membersLeft); !due {
+		c.logger.Warningf("cluster lost quorum: restoring it from backup %s in %v unless quorum is back", eb.Name, wait)
+		return true, nil
+	}
+	src, err := k8sutil.RestoreSourceOf(eb)
+	if err != nil {
+		return false, err
+	}
+	er = &api.EtcdRestore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   c.cluster.Name,
+			Labels: k8sutil.PropagatedLabels(c.cluster),
+		},
+		Spec: api.RestoreSpec{
+			BackupStorageType: eb.Spec.StorageType,
+			RestoreSource:     src,
+			EtcdCluster:       api.EtcdClusterRef{Name: c.cluster.Name},
+		},
+	}
+	if _, err := restoreCli.Create(er); err != nil {
+		return false, fmt.Errorf("failed to create restore: %v", err)
+	}
+
+	c.logger.Warningf("cluster lost quorum: restoring it from backup %s (%s)", eb.Name, k8sutil.BackupFilePath(eb))
+	if _, err := c.eventsCli.Create(k8sutil.RestoringFromBackupEvent(eb.Name, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create restoring from backup event: %v", err)
+	}
+	c.config.Notifier.Notify("etcd cluster %s/%s lost quorum and is restored from backup %s", c.cluster.Namespace, c.cluster.Name, eb.Name)
+	return true, nil
+}
+
+// restoreDue tells whether a cluster that lost quorum at lostTime, in RFC3339, is due to be restored from backup at now.
+// If it is not, wait is the time left until it is. A cluster of which no member pod nor PVC is left cannot get
+// quorum back, and is due right away.
+func restoreDue(sh *api.SelfHealingPolicy, lostTime string, now time.Time, membersLeft bool) (due bool, wait time.Duration) {
+	if !membersLeft {
+		return true, 0
+	}
+	after := time.Duration(sh.RestoreAfterSecondsOrDefault()) * time.Second
+	lost, err := time.Parse(time.RFC3339, lostTime)
+	if err != nil {
+		return false, after
+	}
+	if elapsed := now.Sub(lost); elapsed < after {
+		return false, after - elapsed
+	}
+	return true, 0
+}
+
+// setLostQuorum records whether the last reconcile found the cluster without quorum.
+// The time quorum was first lost is kept in the status, so that it survives a restart of the operator.
+func (c *Cluster) setLostQuorum(lost bool) {
+	c.lostQuorum = lost
+	switch {
+	case !lost:
+		c.status.QuorumLostTime = ""
+	case len(c.status.QuorumLostTime) == 0:
+		c.status.QuorumLostTime = time.Now().Format(time.RFC3339)
+	}
+}
+
+// hasMemberVolumes tells whether any PVC of the members of the cluster is left.
+// It errs on the side of keeping the data: if the PVCs cannot be listed, they are assumed to be left.
+func (c *Cluster) hasMemberVolumes() bool {
+	pvcs, err := c.config.KubeCli.CoreV1().PersistentVolumeClaims(c.cluster.Namespace).List(k8sutil.ClusterListOpt(c.cluster.Name))
+	if err != nil {
+		c.logger.Warningf("failed to list the PVCs of the cluster: %v", err)
+		return true
+	}
+	return len(pvcs.Items) != 0
+}
+
+// recreateEmptyIfAllowed starts the cluster over from a new seed member once all members are dead,
+// if spec.selfHealing.recreateEmpty is set. It returns whether the cluster is recreated.
+// A cluster with backups is left alone, so that it can be restored with its data.
+func (c *Cluster) recreateEmptyIfAllowed() (bool, error) {
+	backups, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdBackups(c.cluster.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	if ok, reason := canRecreateEmpty(c.cluster, backups.Items); !ok {
+		if len(reason) != 0 {
+			c.logger.Warningf("not recreating the cluster: %s", reason)
+		}
+		return false, nil
+	}
+
+	c.logger.Warningf("all members are dead: recreating the cluster without its data")
+	if _, err := c.eventsCli.Create(k8sutil.RecreatingEmptyClusterEvent(c.cluster)); err != nil {
+		c.logger.Errorf("failed to create recreating empty cluster event: %v", err)
+	}
+	c.config.Notifier.Notify("etcd cluster %s/%s lost all its members and is recreated without its data", c.cluster.Namespace, c.cluster.Name)
+
+	c.transition(api.ClusterPhaseRecovering)
+	c.members = nil
+	c.pendingReplacements = 0
+	if err := c.prepareSeedMember(); err != nil {
+		return false, err
+	}
+	c.setLostQuorum(false)
+	return true, c.updateCRStatus()
+}
+
+// canRecreateEmpty tells whether a cluster whose members are all dead may be recreated empty.
+// If the self healing policy allows it but the cluster has backups, reason tells why it may not.
+func canRecreateEmpty(cl *api.EtcdCluster, backups []api.EtcdBackup) (ok bool, reason string) {
+	if sh := cl.Spec.SelfHealing; sh == nil || !sh.RecreateEmpty {
+		return false, ""
+	}
+	for i := range backups {
+		if k8sutil.IsBackupOfCluster(cl.Name, cl.Namespace, &backups[i]) {
+			return false, "the cluster has backups, restore it from backup " + backups[i].Name
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+)
+
+// memberSpecFields are the fields of the spec the members are reconciled against: a change of one of them
+// resizes, upgrades, pauses or replaces members, so the members are reconciled right away.
+var memberSpecFields = map[string]bool{
+	"size":             true,
+	"tier":             true,
+	"version":          true,
+	"convergeVersions": true,
+	"upgrade":          true,
+	"paused":           true,
+	"etcd":             true,
+	"repairBudget":     true,
+	"selfHealing":      true,
+}
+
+// changedSpecFields returns the JSON names of the top-level fields of the spec that differ, in the order of the spec.
+func changedSpecFields(oldSpec, newSpec api.ClusterSpec) []string {
+	ov, nv := reflect.ValueOf(oldSpec), reflect.ValueOf(newSpec)
+	t := ov.Type()
+	var changed []string
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = t.Field(i).Name
+		}
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+// applySpecChanges runs the operations that apply the change of the given fields of the spec, and returns whether
+// the members are to be reconciled right away. The fields of the member pods, e.g. spec.pod, only apply to the
+// pods created from then on: their change reconciles nothing, so that it does not churn the running pods.
+// The periodic reconciliation applies whatever is not applied here.
+func (c *Cluster) applySpecChanges(fields []string) bool {
+	c.logger.Infof("spec fields changed: %v", fields)
+	reconcile := false
+	for _, f := range fields {
+		switch {
+		case memberSpecFields[f]:
+			reconcile = true
+		case f == "propagatedLabels":
+			if _, err := c.reconcileServices(); err != nil {
+				c.logger.Warningf("failed to propagate labels to the services: %v", err)
+			}
+		case f == "alerts":
+			// Check the new thresholds against the last scrape.
+			c.lastAlertCheck = time.Time{}
+			if err := c.checkAlertsIfDue(); err != nil {
+				c.logger.Warningf("failed to check alert thresholds: %v", err)
+			}
+		case f == "ttlInSecond":
+			c.expireIfDue()
+		}
+	}
+	return reconcile
+}
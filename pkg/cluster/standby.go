@@ -0,0 +1,174 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func (c *Cluster) isStandby() bool {
+	return len(c.cluster.Spec.StandbyOf) != 0
+}
+
+// standbyRestoreRetryInterval is how long a failed restore of a standby is kept before it is retried.
+const standbyRestoreRetryInterval = 5 * time.Minute
+
+// syncStandby keeps a standby cluster restored from the latest successful backup of its primary, spec.standbyOf.
+// It requests the restore operator to restore the standby once the primary has a newer backup than the one
+// the standby was restored from, or once the standby lost quorum. It returns whether the standby is being restored
+// or promoted, which the reconciliation waits for.
+// The restore operator deletes and recreates the standby; the EtcdRestore named after it records the backup it restored.
+// A failed restore is recorded in status.standby.restoreFailure, and retried after standbyRestoreRetryInterval.
+func (c *Cluster) syncStandby() (bool, error) {
+	if !c.isStandby() {
+		c.status.Standby = nil
+		return false, nil
+	}
+	primary := c.cluster.Spec.StandbyOf
+	if primary == c.cluster.Name {
+		return false, fmt.Errorf("cluster cannot be a standby of itself")
+	}
+
+	restoreCli := c.config.EtcdCRCli.EtcdV1beta2().EtcdRestores(c.cluster.Namespace)
+	// The restore operator requires the restore to be named after the cluster.
+	last, err := restoreCli.Get(c.cluster.Name, metav1.GetOptions{})
+	var retryIn time.Duration
+	switch {
+	case k8sutil.IsKubernetesResourceNotFoundError(err):
+		last = nil
+	case err != nil:
+		return false, err
+	case last.Status.Succeeded:
+		c.status.Standby = &api.StandbyStatus{
+			RestoredBackup:     last.Annotations[k8sutil.AnnotationStandbyBackup],
+			RestoredBackupTime: last.Annotations[k8sutil.AnnotationStandbyBackupTime],
+		}
+	case len(last.Status.Reason) != 0:
+		c.logger.Warningf("restore of the standby from backup %s failed: %s", last.Annotations[k8sutil.AnnotationStandbyBackup], last.Status.Reason)
+		if c.status.Standby == nil {
+			c.status.Standby = &api.StandbyStatus{}
+		}
+		c.status.Standby.RestoreFailure = last.Status.Reason
+		retryIn = standbyRestoreRetryInterval - time.Since(last.CreationTimestamp.Time)
+	default:
+		// The restore operator has not restored the standby yet.
+		return true, nil
+	}
+	if waiting, err := c.promoteIfRequested(); waiting || err != nil {
+		return waiting, err
+	}
+	if retryIn > 0 {
+		c.logger.Infof("retrying the restore of the standby in %v", retryIn)
+		return false, nil
+	}
+
+	backups, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdBackups(c.cluster.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	eb := k8sutil.LatestBackup(primary, c.cluster.Namespace, backups.Items)
+	if eb == nil {
+		c.logger.Infof("not restoring the standby: no successful backup of cluster %s found", primary)
+		return false, nil
+	}
+	src, err := k8sutil.RestoreSourceOf(eb)
+	if err != nil {
+		return false, err
+	}
+	if last != nil && last.Status.Succeeded && !c.lostQuorum && last.Spec.BackupStorageType == eb.Spec.StorageType && reflect.DeepEqual(last.Spec.RestoreSource, src) {
+		return false, nil
+	}
+
+	if last != nil {
+		if err := restoreCli.Delete(last.Name, &metav1.DeleteOptions{}); err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return false, fmt.Errorf("failed to delete previous restore (%s): %v", last.Name, err)
+		}
+	}
+	er := &api.EtcdRestore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   c.cluster.Name,
+			Labels: k8sutil.PropagatedLabels(c.cluster),
+			Annotations: map[string]string{
+				k8sutil.AnnotationStandbyBackup:     eb.Name,
+				k8sutil.AnnotationStandbyBackupTime: k8sutil.BackupTime(eb).Format(time.RFC3339),
+			},
+		},
+		Spec: api.RestoreSpec{
+			BackupStorageType: eb.Spec.StorageType,
+			RestoreSource:     src,
+			EtcdCluster:       api.EtcdClusterRef{Name: c.cluster.Name},
+		},
+	}
+	if _, err := restoreCli.Create(er); err != nil {
+		return false, fmt.Errorf("failed to create restore: %v", err)
+	}
+
+	c.logger.Infof("restoring the standby from backup %s (%s) of cluster %s", eb.Name, k8sutil.BackupFilePath(eb), primary)
+	if _, err := c.eventsCli.Create(k8sutil.StandbyRestoringEvent(eb.Name, primary, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create standby restoring event: %v", err)
+	}
+	return true, nil
+}
+
+// promoteIfRequested promotes the standby if it is annotated with AnnotationPromote, by removing spec.standbyOf
+// and the annotation. The promotion itself is handled with the update of the spec, see handleUpdateEvent.
+// It is called while no restore is in progress, so that the restore operator does not recreate the cluster
+// as a standby after its promotion.
+func (c *Cluster) promoteIfRequested() (bool, error) {
+	v, ok := c.cluster.Annotations[k8sutil.AnnotationPromote]
+	if !ok {
+		return false, nil
+	}
+	if v != "now" {
+		c.refuseMaintenance(k8sutil.AnnotationPromote, fmt.Sprintf("unknown value %q of annotation %s, must be \"now\"", v, k8sutil.AnnotationPromote))
+		return false, nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{k8sutil.AnnotationPromote: nil},
+		},
+		"spec": map[string]interface{}{"standbyOf": nil},
+	})
+	if err != nil {
+		return false, err
+	}
+	cl, err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace).Patch(c.cluster.Name, types.MergePatchType, patch)
+	if err != nil {
+		return false, fmt.Errorf("failed to promote the standby: %v", err)
+	}
+	// Only the metadata of the local copy is updated: the spec follows with the update event.
+	c.cluster.Annotations = cl.Annotations
+	c.cluster.ResourceVersion = cl.ResourceVersion
+	return true, nil
+}
+
+// promoteStandby finishes the promotion of a standby whose spec.standbyOf was removed.
+func (c *Cluster) promoteStandby(primary string) {
+	c.logger.Warningf("standby of cluster %s is promoted", primary)
+	c.status.Standby = nil
+	if _, err := c.eventsCli.Create(k8sutil.StandbyPromotedEvent(primary, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create standby promoted event: %v", err)
+	}
+	c.config.Notifier.Notify("etcd cluster %s/%s, the standby of cluster %s, is promoted", c.cluster.Namespace, c.cluster.Name, primary)
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	fakeetcd "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newStandbyBackup(name string, created time.Time) *api.EtcdBackup {
+	return &api.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault, CreationTimestamp: metav1.NewTime(created)},
+		Spec: api.BackupSpec{
+			EtcdEndpoints: []string{"http://primary-client:2379"},
+			StorageType:   api.BackupStorageTypeS3,
+			BackupSource:  api.BackupSource{S3: &api.S3BackupSource{Path: "bucket/" + name, AWSSecret: "aws"}},
+		},
+		Status: api.BackupStatus{Succeeded: true},
+	}
+}
+
+func newStandbyRestore(t *testing.T, eb *api.EtcdBackup, created time.Time, status api.RestoreStatus) *api.EtcdRestore {
+	src, err := k8sutil.RestoreSourceOf(eb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &api.EtcdRestore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "standby",
+			Namespace:         metav1.NamespaceDefault,
+			CreationTimestamp: metav1.NewTime(created),
+			Annotations:       map[string]string{k8sutil.AnnotationStandbyBackup: eb.Name},
+		},
+		Spec: api.RestoreSpec{
+			BackupStorageType: eb.Spec.StorageType,
+			RestoreSource:     src,
+			EtcdCluster:       api.EtcdClusterRef{Name: "standby"},
+		},
+		Status: status,
+	}
+}
+
+func TestSyncStandby(t *testing.T) {
+	now := time.Now()
+	older := newStandbyBackup("older", now.Add(-2*time.Hour))
+	newer := newStandbyBackup("newer", now.Add(-time.Hour))
+
+	tests := []struct {
+		desc    string
+		backups []*api.EtcdBackup
+		restore *api.EtcdRestore
+
+		wantWaiting bool
+		// wantBackup is the backup the restore of the standby is of afterwards, empty if there is no restore.
+		wantBackup string
+		// wantRequested tells whether a new restore was requested, i.e. the restore has no status.
+		wantRequested bool
+		wantFailure   string
+	}{{
+		desc:    "no backup of the primary",
+		backups: nil,
+	}, {
+		desc:          "first restore",
+		backups:       []*api.EtcdBackup{older, newer},
+		wantWaiting:   true,
+		wantBackup:    "newer",
+		wantRequested: true,
+	}, {
+		desc:          "restore in progress",
+		backups:       []*api.EtcdBackup{older, newer},
+		restore:       newStandbyRestore(t, older, now, api.RestoreStatus{}),
+		wantWaiting:   true,
+		wantBackup:    "older",
+		wantRequested: true,
+	}, {
+		desc:       "restored from the latest backup",
+		backups:    []*api.EtcdBackup{older, newer},
+		restore:    newStandbyRestore(t, newer, now.Add(-time.Minute), api.RestoreStatus{Succeeded: true}),
+		wantBackup: "newer",
+	}, {
+		desc:          "primary has a newer backup",
+		backups:       []*api.EtcdBackup{older, newer},
+		restore:       newStandbyRestore(t, older, now.Add(-time.Minute), api.RestoreStatus{Succeeded: true}),
+		wantWaiting:   true,
+		wantBackup:    "newer",
+		wantRequested: true,
+	}, {
+		desc:        "failed restore within the retry interval",
+		backups:     []*api.EtcdBackup{older, newer},
+		restore:     newStandbyRestore(t, newer, now.Add(-time.Minute), api.RestoreStatus{Reason: "snapshot not found"}),
+		wantBackup:  "newer",
+		wantFailure: "snapshot not found",
+	}, {
+		desc:          "failed restore past the retry interval",
+		backups:       []*api.EtcdBackup{older, newer},
+		restore:       newStandbyRestore(t, newer, now.Add(-standbyRestoreRetryInterval-time.Minute), api.RestoreStatus{Reason: "snapshot not found"}),
+		wantWaiting:   true,
+		wantBackup:    "newer",
+		wantRequested: true,
+		wantFailure:   "snapshot not found",
+	}}
+	for _, tt := range tests {
+		var objs []runtime.Object
+		for _, eb := range tt.backups {
+			objs = append(objs, eb.DeepCopy())
+		}
+		if tt.restore != nil {
+			objs = append(objs, tt.restore.DeepCopy())
+		}
+		crcli := fakeetcd.NewSimpleClientset(objs...)
+		cl := &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "standby", Namespace: metav1.NamespaceDefault, CreationTimestamp: metav1.NewTime(now)},
+			Spec:       api.ClusterSpec{Size: 3, StandbyOf: "primary"},
+		}
+		c := &Cluster{
+			logger:    logrus.WithField("pkg", "cluster"),
+			config:    Config{EtcdCRCli: crcli},
+			cluster:   cl,
+			eventsCli: fake.NewSimpleClientset().CoreV1().Events(cl.Namespace),
+		}
+
+		waiting, err := c.syncStandby()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.desc, err)
+		}
+		if waiting != tt.wantWaiting {
+			t.Errorf("%s: expect waiting=%v, get %v", tt.desc, tt.wantWaiting, waiting)
+		}
+		er, err := crcli.EtcdV1beta2().EtcdRestores(cl.Namespace).Get(cl.Name, metav1.GetOptions{})
+		switch {
+		case len(tt.wantBackup) == 0:
+			if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+				t.Errorf("%s: expect no restore, get %v (err %v)", tt.desc, er, err)
+			}
+		case err != nil:
+			t.Errorf("%s: failed to get restore: %v", tt.desc, err)
+		default:
+			if b := er.Annotations[k8sutil.AnnotationStandbyBackup]; b != tt.wantBackup {
+				t.Errorf("%s: expect restore of backup %s, get %s", tt.desc, tt.wantBackup, b)
+			}
+			requested := !er.Status.Succeeded && len(er.Status.Reason) == 0
+			if requested != tt.wantRequested {
+				t.Errorf("%s: expect restore requested=%v, get status %+v", tt.desc, tt.wantRequested, er.Status)
+			}
+		}
+		var failure string
+		if c.status.Standby != nil {
+			failure = c.status.Standby.RestoreFailure
+		}
+		if failure != tt.wantFailure {
+			t.Errorf("%s: expect restore failure %q, get %q", tt.desc, tt.wantFailure, failure)
+		}
+	}
+}
+
+func TestPromoteIfRequested(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+
+		wantWaiting bool
+		wantPatched bool
+		// wantStandbyOfRemoved tells whether the patch removes spec.standbyOf.
+		wantStandbyOfRemoved bool
+	}{
+		{annotations: nil},
+		{annotations: map[string]string{k8sutil.AnnotationPromote: "now"}, wantWaiting: true, wantPatched: true, wantStandbyOfRemoved: true},
+		// An unknown value is refused: only the annotation is removed.
+		{annotations: map[string]string{k8sutil.AnnotationPromote: "later"}, wantPatched: true},
+	}
+	for i, tt := range tests {
+		cl := &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "standby", Namespace: metav1.NamespaceDefault, Annotations: tt.annotations},
+			Spec:       api.ClusterSpec{Size: 3, StandbyOf: "primary"},
+		}
+		var patches []map[string]map[string]interface{}
+		crcli := fakeetcd.NewSimpleClientset()
+		// The fake clientset does not apply patches: record them and drop the annotations of the cluster.
+		crcli.PrependReactor("patch", "etcdclusters", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			var p map[string]map[string]interface{}
+			if err := json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &p); err != nil {
+				return true, nil, err
+			}
+			patches = append(patches, p)
+			obj := cl.DeepCopy()
+			obj.Annotations = nil
+			return true, obj, nil
+		})
+		c := &Cluster{
+			logger:    logrus.WithField("pkg", "cluster"),
+			config:    Config{EtcdCRCli: crcli},
+			cluster:   cl.DeepCopy(),
+			eventsCli: fake.NewSimpleClientset().CoreV1().Events(cl.Namespace),
+		}
+
+		waiting, err := c.promoteIfRequested()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if waiting != tt.wantWaiting {
+			t.Errorf("#%d: expect waiting=%v, get %v", i, tt.wantWaiting, waiting)
+		}
+		if (len(patches) != 0) != tt.wantPatched {
+			t.Fatalf("#%d: expect patched=%v, get patches %v", i, tt.wantPatched, patches)
+		}
+		if !tt.wantPatched {
+			continue
+		}
+		spec, ok := patches[0]["spec"]
+		if _, removed := spec["standbyOf"]; (ok && removed) != tt.wantStandbyOfRemoved {
+			t.Errorf("#%d: expect standbyOf removed=%v, get patch %v", i, tt.wantStandbyOfRemoved, patches[0])
+		}
+		if _, ok := c.cluster.Annotations[k8sutil.AnnotationPromote]; ok {
+			t.Errorf("#%d: expect the promote annotation to be removed", i)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// State is what the operator wants a cluster to be and what it observes of it, to debug why it acts or does not.
+type State struct {
+	Cluster string           `json:"cluster"`
+	Phase   api.ClusterPhase `json:"phase"`
+	Paused  bool             `json:"paused"`
+	// Size and Version are the size and etcd version of the spec.
+	Size    int    `json:"size"`
+	Version string `json:"version"`
+	// Members is the membership the operator knows, which it reconciles the pods to.
+	// It is empty until the operator reads it from etcd, e.g. after it restarted.
+	Members []StateMember `json:"members"`
+	Pods    []StatePod    `json:"pods"`
+	// EtcdMembers is the membership listed by etcd. EtcdError tells why it could not be listed instead.
+	EtcdMembers []StateEtcdMember `json:"etcdMembers,omitempty"`
+	EtcdError   string            `json:"etcdError,omitempty"`
+	Diff        StateDiff         `json:"diff"`
+}
+
+// StateMember is a member the operator knows.
+type StateMember struct {
+	Name string `json:"name"`
+	// ID is the ID of the member in hex, empty if it is not known yet.
+	ID        string `json:"id,omitempty"`
+	IsLearner bool   `json:"isLearner,omitempty"`
+	ClientURL string `json:"clientURL"`
+	PeerURL   string `json:"peerURL"`
+}
+
+// StatePod is a pod of the cluster.
+type StatePod struct {
+	Name  string      `json:"name"`
+	Phase v1.PodPhase `json:"phase"`
+	Node  string      `json:"node,omitempty"`
+	Ready bool        `json:"ready"`
+	// Leaving tells that the pod is being deleted.
+	Leaving bool   `json:"leaving,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// StateEtcdMember is a member as listed by etcd. Its name is empty until it started.
+type StateEtcdMember struct {
+	Name       string   `json:"name"`
+	ID         string   `json:"id"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs,omitempty"`
+}
+
+// StateDiff is how the observed cluster differs from the members the operator knows.
+type StateDiff struct {
+	// Pods compares the running pods with the members: added are the pods that are not of a member,
+	// removed the members without a running pod.
+	Pods etcdutil.MemberSetDiff `json:"pods"`
+	// Etcd compares the membership listed by etcd, by the member names of the peer URLs, with the members.
+	// It is not set if the membership could not be listed.
+	Etcd *etcdutil.MemberSetDiff `json:"etcd,omitempty"`
+}
+
+type stateReply struct {
+	state *State
+	err   error
+}
+
+// State takes the snapshot in the run loop of the cluster, so that it does not race with reconciliation.
+// It does not change the cluster.
+func (c *Cluster) State() (*State, error) {
+	replyCh := make(chan stateReply, 1)
+	c.send(&clusterEvent{
+		typ:     eventState,
+		stateCh: replyCh,
+	})
+
+	select {
+	case r := <-replyCh:
+		return r.state, r.err
+	case <-c.ctx.Done():
+		return nil, errors.New("cluster is deleted")
+	case <-time.After(planTimeout):
+		return nil, errors.New("timed out waiting for the cluster to take its state")
+	}
+}
+
+func (c *Cluster) state() (*State, error) {
+	running, pending, leaving, err := c.pollPods()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{
+		Cluster: c.cluster.Name,
+		Phase:   c.status.Phase,
+		Paused:  c.cluster.Spec.Paused,
+		Size:    c.cluster.Spec.Size,
+		Version: c.cluster.Spec.Version,
+		Members: []StateMember{},
+		Pods:    []StatePod{},
+	}
+	for _, name := range c.members.Names() {
+		m := c.members[name]
+		sm := StateMember{Name: m.Name, IsLearner: m.IsLearner, ClientURL: m.ClientURL(), PeerURL: m.PeerURL()}
+		if m.ID != 0 {
+			sm.ID = fmt.Sprintf("%x", m.ID)
+		}
+		s.Members = append(s.Members, sm)
+	}
+	for _, pods := range [][]*v1.Pod{running, pending, leaving} {
+		for _, pod := range pods {
+			s.Pods = append(s.Pods, StatePod{
+				Name:    pod.Name,
+				Phase:   pod.Status.Phase,
+				Node:    pod.Spec.NodeName,
+				Ready:   k8sutil.IsPodReady(pod),
+				Leaving: pod.DeletionTimestamp != nil,
+				Version: k8sutil.GetEtcdVersion(pod),
+			})
+		}
+	}
+	members := c.members
+	if members == nil {
+		members = etcdutil.MemberSet{}
+	}
+	s.Diff.Pods = members.Compare(podsToMemberSet(running, c.cluster.Spec))
+
+	listed, err := c.listEtcdMembers(running)
+	if err != nil {
+		s.EtcdError = err.Error()
+		return s, nil
+	}
+	named := etcdutil.MemberSet{}
+	for _, m := range listed {
+		if len(m.PeerURLs) == 0 {
+			continue
+		}
+		if name, err := etcdutil.MemberNameFromPeerURL(m.PeerURLs[0]); err == nil {
+			named.Add(&etcdutil.Member{Name: name})
+		}
+	}
+	s.EtcdMembers = listed
+	d := members.Compare(named)
+	s.Diff.Etcd = &d
+	return s, nil
+}
+
+// listEtcdMembers lists the membership from etcd, through the members the operator knows or, if it knows none yet,
+// the running pods.
+func (c *Cluster) listEtcdMembers(running []*v1.Pod) ([]StateEtcdMember, error) {
+	known := c.members
+	if known == nil {
+		known = podsToMemberSet(running, c.cluster.Spec)
+	}
+	etcdcli, err := c.etcdClientFor(known.ClientURLs())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := etcdutil.ListMembers(c.ctx, etcdcli)
+	if err != nil {
+		return nil, err
+	}
+	listed := []StateEtcdMember{}
+	for _, m := range resp.Members {
+		listed = append(listed, StateEtcdMember{
+			Name:       m.Name,
+			ID:         fmt.Sprintf("%x", m.ID),
+			PeerURLs:   m.PeerURLs,
+			ClientURLs: m.ClientURLs,
+		})
+	}
+	return listed, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// storageMigrationMaxRaftLag is how many raft entries a member may be behind the most advanced member
+// for the members to be taken as in sync. The raft indexes are read one member after the other,
+// so members in sync under load still differ by the entries committed in between.
+const storageMigrationMaxRaftLag = 1000
+
+// storageClassOf returns the storage class the claim spec asks for, if it asks for one.
+func storageClassOf(spec *v1.PersistentVolumeClaimSpec) (string, bool) {
+	if spec == nil || spec.StorageClassName == nil {
+		return "", false
+	}
+	return *spec.StorageClassName, true
+}
+
+// pvcStorageClass returns the storage class of the claim, "" if it has none.
+func pvcStorageClass(pvc *v1.PersistentVolumeClaim) string {
+	if pvc.Spec.StorageClassName == nil {
+		return ""
+	}
+	return *pvc.Spec.StorageClassName
+}
+
+// membersOnOldStorage returns, in the order of the pods, the members whose data or WAL claim is not of the storage
+// class of spec.pod, among the claims found. A claim spec of spec.pod without a storage class asks for the default
+// class, which the claims of the members are taken to be of. The members annotated hands-off are left out.
+func membersOnOldStorage(pods []*v1.Pod, pvcs map[string]*v1.PersistentVolumeClaim, pp *api.PodPolicy) []string {
+	if pp == nil {
+		return nil
+	}
+	dataClass, migrateData := storageClassOf(pp.PersistentVolumeClaimSpec)
+	walClass, migrateWAL := storageClassOf(pp.WALVolumeClaimSpec)
+	var names []string
+	for _, pod := range pods {
+		if k8sutil.IsHandsOffPod(pod) {
+			continue
+		}
+		if pvc, ok := pvcs[k8sutil.PVCNameFromMember(pod.Name)]; ok && migrateData && pvcStorageClass(pvc) != dataClass {
+			names = append(names, pod.Name)
+			continue
+		}
+		if pvc, ok := pvcs[k8sutil.WALPVCNameFromMember(pod.Name)]; ok && migrateWAL && pvcStorageClass(pvc) != walClass {
+			names = append(names, pod.Name)
+		}
+	}
+	return names
+}
+
+// raftLag returns the member furthest behind the most advanced member, by its raft index, and by how many entries.
+func raftLag(indexes map[string]uint64) (name string, lag uint64) {
+	var max uint64
+	for _, i := range indexes {
+		if i > max {
+			max = i
+		}
+	}
+	for n, i := range indexes {
+		if max-i > lag || (max-i == lag && (len(name) == 0 || n < name)) {
+			name, lag = n, max-i
+		}
+	}
+	return name, lag
+}
+
+// checkMembersInSync returns an error unless every member answers and has applied about as many raft entries
+// as the most advanced member, e.g. once the member that last moved to new storage synced its data.
+func (c *Cluster) checkMembersInSync() error {
+	if l := c.members.Learner(); l != nil {
+		return fmt.Errorf("member (%s) is a learner that is still catching up", l.Name)
+	}
+	indexes := map[string]uint64{}
+	for _, m := range c.members {
+		st, err := etcdutil.MemberStatus(c.ctx, m.ClientURL(), c.tlsConfig, c.clientOptions())
+		if err != nil {
+			return fmt.Errorf("failed to get status of member (%s): %v", m.Name, err)
+		}
+		indexes[m.Name] = st.RaftIndex
+	}
+	if name, lag := raftLag(indexes); lag > storageMigrationMaxRaftLag {
+		return fmt.Errorf("member (%s) is %d raft entries behind", name, lag)
+	}
+	return nil
+}
+
+// migrateStorage moves the members whose claims are not of the storage class of spec.pod to new claims of that class,
+// one member at a time: it replaces one of them, and the next reconcile adds its replacement on new claims.
+// The next member is only replaced once all the members are ready and in sync again, so that the cluster keeps
+// quorum throughout. It returns whether a member is to be moved.
+func (c *Cluster) migrateStorage(pods []*v1.Pod) (bool, error) {
+	if !c.isPodPVEnabled() {
+		return false, nil
+	}
+	list, err := c.config.KubeCli.CoreV1().PersistentVolumeClaims(c.cluster.Namespace).List(k8sutil.ClusterListOpt(c.cluster.Name))
+	if err != nil {
+		return false, fmt.Errorf("failed to list the persistent volume claims of the cluster: %v", err)
+	}
+	pvcs := map[string]*v1.PersistentVolumeClaim{}
+	for i := range list.Items {
+		pvcs[list.Items[i].Name] = &list.Items[i]
+	}
+	names := membersOnOldStorage(pods, pvcs, c.cluster.Spec.Pod)
+	class, _ := storageClassOf(c.cluster.Spec.Pod.PersistentVolumeClaimSpec)
+	if len(names) == 0 {
+		c.status.ClearCondition(api.ClusterConditionStorageMigrating)
+		return false, nil
+	}
+
+	name := names[0]
+	if err := checkReplacementQuorum(pods, name, c.members.Size()); err == nil {
+		err = c.checkMembersInSync()
+	}
+	if err != nil {
+		c.logger.Infof("not moving member (%s) to new storage yet: %v", name, err)
+		c.status.SetStorageMigrationWaitingCondition(class, err.Error())
+		return true, nil
+	}
+	m, ok := c.members[name]
+	if !ok {
+		return true, fmt.Errorf("member (%s) not found in cluster membership", name)
+	}
+	if !c.useReplacementBudget(name) {
+		return true, nil
+	}
+	c.status.SetStorageMigratingCondition(class, len(pods)-len(names), len(pods))
+	c.logger.Infof("moving member (%s) to new persistent volume claims: %d members left", name, len(names))
+	if _, err := c.eventsCli.Create(k8sutil.MigratingMemberStorageEvent(name, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create migrating member storage event: %v", err)
+	}
+	return true, c.removeMember(m)
+}
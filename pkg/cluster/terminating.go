@@ -0,0 +1,70 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultForceDeleteAfter is the time a pod may stay terminating past its grace period
+// if spec.pod.forceDeleteAfterSeconds is not set.
+const defaultForceDeleteAfter = 300 * time.Second
+
+// forceDeleteAfter returns the time a pod may stay terminating past its grace period before it is force deleted,
+// or 0 if it never is.
+func forceDeleteAfter(p *api.PodPolicy) time.Duration {
+	if p == nil || p.ForceDeleteAfterSeconds == nil {
+		return defaultForceDeleteAfter
+	}
+	return time.Duration(*p.ForceDeleteAfterSeconds) * time.Second
+}
+
+// isStuckTerminating tells whether the pod is still terminating longer than after past its grace period.
+// The deletion timestamp of a pod is the end of its grace period.
+func isStuckTerminating(pod *v1.Pod, after time.Duration, now time.Time) bool {
+	if pod.DeletionTimestamp == nil || after == 0 {
+		return false
+	}
+	return now.Sub(pod.DeletionTimestamp.Time) > after
+}
+
+// forceDeleteStuckPods force deletes the leaving pods that are stuck terminating, e.g. on a node that was lost,
+// whose kubelet never confirms that the pod is gone. The members of the pods are removed by the reconciliation,
+// as leaving members while the pods are listed, and as dead members once they are gone.
+func (c *Cluster) forceDeleteStuckPods(leaving []*v1.Pod) {
+	after := forceDeleteAfter(c.cluster.Spec.Pod)
+	now := time.Now()
+	for _, pod := range leaving {
+		if !isStuckTerminating(pod, after, now) || c.isHandsOff(pod.Name, "force deleting the pod of") {
+			continue
+		}
+		stuck := now.Sub(pod.DeletionTimestamp.Time).Round(time.Second)
+		c.logger.Warningf("force deleting pod (%s) still terminating on node (%s) %v after its grace period", pod.Name, pod.Spec.NodeName, stuck)
+		err := c.config.KubeCli.CoreV1().Pods(c.cluster.Namespace).Delete(pod.Name, metav1.NewDeleteOptions(0))
+		if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			c.logger.Errorf("failed to force delete pod (%s): %v", pod.Name, err)
+			continue
+		}
+		if _, err := c.eventsCli.Create(k8sutil.PodForceDeletedEvent(pod.Name, pod.Spec.NodeName, stuck, c.cluster)); err != nil {
+			c.logger.Errorf("failed to create pod force deleted event: %v", err)
+		}
+	}
+}
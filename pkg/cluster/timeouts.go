@@ -0,0 +1,70 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+)
+
+// Timeouts bound the operations of the operator on the members of a cluster. See api.TimeoutPolicy.
+// A timeout that is not set takes its default.
+type Timeouts struct {
+	PodCreate time.Duration
+	MemberAdd time.Duration
+	Snapshot  time.Duration
+	Defrag    time.Duration
+	Delete    time.Duration
+}
+
+// DefaultTimeouts are the timeouts neither the operator nor the cluster set.
+var DefaultTimeouts = Timeouts{
+	PodCreate: 10 * time.Minute,
+	MemberAdd: constants.DefaultRequestTimeout,
+	Snapshot:  10 * time.Minute,
+	Defrag:    5 * time.Minute,
+	Delete:    constants.DefaultRequestTimeout,
+}
+
+// timeouts returns the timeouts of the operations on the members of the cluster.
+func (c *Cluster) timeouts() Timeouts {
+	return resolveTimeouts(c.config.Timeouts, c.cluster.Spec.Timeouts)
+}
+
+// resolveTimeouts returns, for each operation, the timeout of the policy of the cluster if set,
+// else the timeout of the operator if set, else the default.
+func resolveTimeouts(operator Timeouts, p *api.TimeoutPolicy) Timeouts {
+	if p == nil {
+		p = &api.TimeoutPolicy{}
+	}
+	resolve := func(seconds int64, operator, def time.Duration) time.Duration {
+		switch {
+		case seconds > 0:
+			return time.Duration(seconds) * time.Second
+		case operator > 0:
+			return operator
+		}
+		return def
+	}
+	return Timeouts{
+		PodCreate: resolve(p.PodCreateTimeoutInSecond, operator.PodCreate, DefaultTimeouts.PodCreate),
+		MemberAdd: resolve(p.MemberAddTimeoutInSecond, operator.MemberAdd, DefaultTimeouts.MemberAdd),
+		Snapshot:  resolve(p.SnapshotTimeoutInSecond, operator.Snapshot, DefaultTimeouts.Snapshot),
+		Defrag:    resolve(p.DefragTimeoutInSecond, operator.Defrag, DefaultTimeouts.Defrag),
+		Delete:    resolve(p.DeleteTimeoutInSecond, operator.Delete, DefaultTimeouts.Delete),
+	}
+}
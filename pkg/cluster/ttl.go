@@ -0,0 +1,78 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxExpiryWarningLead is how long before the expiry of a cluster with spec.ttlInSecond its warning event is created,
+// at most: the warning of a shorter lived cluster comes at half its TTL.
+const maxExpiryWarningLead = 5 * time.Minute
+
+// expiryOf returns when the cluster expires as of spec.ttlInSecond, and when its expiry is warned about.
+// It returns false if the cluster has no TTL.
+func expiryOf(cl *api.EtcdCluster) (expiry, warning time.Time, ok bool) {
+	if cl.Spec.TTLInSecond <= 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	ttl := time.Duration(cl.Spec.TTLInSecond) * time.Second
+	lead := maxExpiryWarningLead
+	if ttl/2 < lead {
+		lead = ttl / 2
+	}
+	expiry = cl.CreationTimestamp.Add(ttl)
+	return expiry, expiry.Add(-lead), true
+}
+
+// expireIfDue creates the warning event of the expiry of the cluster once it is due,
+// and deletes the EtcdCluster once the cluster expired. It returns whether the cluster was deleted.
+func (c *Cluster) expireIfDue() bool {
+	expiry, warning, ok := expiryOf(c.cluster)
+	now := time.Now()
+	if !ok || now.Before(warning) {
+		// spec.ttlInSecond may be raised after the warning.
+		c.expiryWarned = false
+		return false
+	}
+	if now.Before(expiry) {
+		if !c.expiryWarned {
+			c.logger.Warningf("cluster expires at %s", expiry.Format(time.RFC3339))
+			if _, err := c.eventsCli.Create(k8sutil.ClusterExpiringEvent(expiry, c.cluster)); err != nil {
+				c.logger.Errorf("failed to create cluster expiring event: %v", err)
+			}
+			c.expiryWarned = true
+		}
+		return false
+	}
+
+	ttl := time.Duration(c.cluster.Spec.TTLInSecond) * time.Second
+	c.logger.Warningf("deleting the cluster: it expired after its TTL of %v", ttl)
+	err := c.config.EtcdCRCli.EtcdV1beta2().EtcdClusters(c.cluster.Namespace).Delete(c.cluster.Name, &metav1.DeleteOptions{})
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		c.logger.Errorf("failed to delete the expired cluster: %v", err)
+		return false
+	}
+	if _, err := c.eventsCli.Create(k8sutil.ClusterExpiredEvent(ttl, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create cluster expired event: %v", err)
+	}
+	c.config.Notifier.Notify("etcd cluster %s/%s is deleted: it expired after its TTL of %v", c.cluster.Namespace, c.cluster.Name, ttl)
+	return true
+}
@@ -15,8 +15,13 @@
 package cluster
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
 	"k8s.io/api/core/v1"
@@ -24,7 +29,165 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 )
 
+// preUpgradeBackupMaxAge is the age after which a pre-upgrade backup is taken again.
+const preUpgradeBackupMaxAge = time.Hour
+
+// upgradePreflight checks the cluster can be upgraded before the first member is rolled to spec.version:
+// every member is ready and healthy, no alarm is raised, every database fits in the backend quota
+// and, if spec.upgrade.maxBackupAgeInSecond is set, the cluster was backed up recently enough.
+// A cluster that passes the checks and has backups is then backed up, see preUpgradeBackup.
+// It returns the problems found, if any. An upgrade that already started, i.e. with a member running spec.version,
+// is not checked again, so that it is not stopped halfway.
+func (c *Cluster) upgradePreflight(pods []*v1.Pod) error {
+	for _, pod := range pods {
+		if k8sutil.GetEtcdVersion(pod) == c.cluster.Spec.Version {
+			return nil
+		}
+	}
+
+	var problems []string
+	for _, pod := range pods {
+		if !k8sutil.IsPodReady(pod) {
+			problems = append(problems, fmt.Sprintf("member %s is not ready", pod.Name))
+		}
+	}
+	quota := c.cluster.Spec.Etcd.QuotaBackendBytesOrDefault()
+	for _, m := range c.members {
+		st, err := etcdutil.MemberStatus(c.ctx, m.ClientURL(), c.tlsConfig, c.clientOptions())
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("member %s is not healthy: %v", m.Name, err))
+			continue
+		}
+		if st.DbSize > quota {
+			problems = append(problems, fmt.Sprintf("database of member %s is %d bytes, above the backend quota of %d bytes", m.Name, st.DbSize, quota))
+		}
+	}
+
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	alarms, err := etcdutil.ListAlarms(c.ctx, etcdcli)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("failed to list alarms: %v", err))
+	}
+	for _, a := range alarms {
+		problems = append(problems, fmt.Sprintf("alarm %v is raised on member %x", a.Alarm, a.MemberID))
+	}
+
+	if p := c.cluster.Spec.Upgrade; p != nil && p.MaxBackupAgeInSecond > 0 {
+		maxAge := time.Duration(p.MaxBackupAgeInSecond) * time.Second
+		t, err := time.Parse(time.RFC3339, c.status.LastBackupTime)
+		if err != nil || time.Since(t) > maxAge {
+			problems = append(problems, fmt.Sprintf("no successful backup within the last %v", maxAge))
+		}
+	}
+
+	if len(problems) == 0 {
+		waiting, err := c.preUpgradeBackup(k8sutil.GetEtcdVersion(pods[0]))
+		if err != nil {
+			return err
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		problems = append(problems, waiting)
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// preUpgradeBackup backs up a cluster that has a successful EtcdBackup before it is upgraded from version:
+// it creates an EtcdBackup to the same storage, tagged "pre-upgrade-<version>", that the backup operator verifies.
+// It returns why the upgrade must wait for the backup, if it must.
+// A pre-upgrade backup older than preUpgradeBackupMaxAge, e.g. of an earlier upgrade or one that failed, is taken again.
+func (c *Cluster) preUpgradeBackup(version string) (string, error) {
+	backupCli := c.config.EtcdCRCli.EtcdV1beta2().EtcdBackups(c.cluster.Namespace)
+	name := preUpgradeBackupName(c.cluster.Name, version)
+	eb, err := backupCli.Get(name, metav1.GetOptions{})
+	if err == nil && time.Since(eb.CreationTimestamp.Time) > preUpgradeBackupMaxAge {
+		if err := backupCli.Delete(name, &metav1.DeleteOptions{}); err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return "", fmt.Errorf("failed to delete previous pre-upgrade backup (%s): %v", name, err)
+		}
+		return fmt.Sprintf("waiting for the previous pre-upgrade backup %s to be deleted", name), nil
+	}
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return "", err
+		}
+		backups, err := backupCli.List(metav1.ListOptions{})
+		if err != nil {
+			return "", err
+		}
+		latest := k8sutil.LatestBackup(c.cluster.Name, c.cluster.Namespace, backups.Items)
+		if latest == nil {
+			// The cluster is not backed up: there is no storage to back it up to.
+			return "", nil
+		}
+		eb = newPreUpgradeBackup(name, version, latest)
+		eb.Labels = k8sutil.PropagatedLabels(c.cluster)
+		if _, err := backupCli.Create(eb); err != nil {
+			return "", fmt.Errorf("failed to create pre-upgrade backup (%s): %v", name, err)
+		}
+		c.logger.Infof("backing up the cluster before the upgrade from %s: created backup %s", version, name)
+		if _, err := c.eventsCli.Create(k8sutil.PreUpgradeBackupEvent(name, version, c.cluster)); err != nil {
+			c.logger.Errorf("failed to create pre-upgrade backup event: %v", err)
+		}
+		return fmt.Sprintf("waiting for pre-upgrade backup %s", name), nil
+	}
+
+	return oneOffBackupWait("pre-upgrade backup", eb), nil
+}
+
+// oneOffBackupWait returns why the one-off backup eb, described as what, is not saved and verified yet,
+// or an empty string if it is.
+func oneOffBackupWait(what string, eb *api.EtcdBackup) string {
+	switch {
+	case len(eb.Status.Reason) != 0:
+		return fmt.Sprintf("%s %s failed: %s", what, eb.Name, eb.Status.Reason)
+	case len(eb.Status.VerificationReason) != 0:
+		return fmt.Sprintf("%s %s could not be restored: %s", what, eb.Name, eb.Status.VerificationReason)
+	case !eb.Status.Succeeded || !eb.Status.Verified:
+		return fmt.Sprintf("waiting for %s %s", what, eb.Name)
+	}
+	return ""
+}
+
+func preUpgradeBackupName(clusterName, version string) string {
+	return fmt.Sprintf("%s-pre-upgrade-%s", clusterName, version)
+}
+
+func newPreUpgradeBackup(name, version string, from *api.EtcdBackup) *api.EtcdBackup {
+	return newOneOffBackup(name, "pre-upgrade-"+version, from)
+}
+
+// newOneOffBackup returns a one-off, verified backup to the storage of the backup from,
+// tagged tag and next to the path of from.
+func newOneOffBackup(name, tag string, from *api.EtcdBackup) *api.EtcdBackup {
+	spec := from.Spec.DeepCopy()
+	spec.Tag = tag
+	policy := &api.BackupPolicy{VerifyRestore: true}
+	if from.Spec.BackupPolicy != nil {
+		policy.TimeoutInSecond = from.Spec.BackupPolicy.TimeoutInSecond
+	}
+	spec.BackupPolicy = policy
+	switch {
+	case spec.S3 != nil:
+		spec.S3.Path += "." + spec.Tag
+	case spec.ABS != nil:
+		spec.ABS.Path += "." + spec.Tag
+	case spec.Custom != nil:
+		spec.Custom.Path += "." + spec.Tag
+	}
+	return &api.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       *spec,
+	}
+}
+
 func (c *Cluster) upgradeOneMember(memberName string) error {
+	if c.isHandsOff(memberName, "upgrading") {
+		return nil
+	}
 	c.status.SetUpgradingCondition(c.cluster.Spec.Version)
 
 	ns := c.cluster.Namespace
@@ -0,0 +1,136 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// detectEtcdVersion records the lowest etcd minor version served by the running members.
+// Members are only asked for their version again once the etcd version annotations
+// of the running pods change, for example during an upgrade.
+func (c *Cluster) detectEtcdVersion(pods []*v1.Pod) error {
+	key := podVersionsKey(pods)
+	if key == c.podVersions && !c.etcdVersion.IsUnknown() {
+		return nil
+	}
+
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	versions, err := etcdutil.MemberVersions(c.ctx, etcdcli, podsToMemberSet(pods, c.cluster.Spec).ClientURLs())
+	if err != nil {
+		return err
+	}
+	vs := make([]string, 0, len(versions))
+	for _, v := range versions {
+		vs = append(vs, v)
+	}
+	lowest, err := etcdutil.LowestMinorVersion(vs)
+	if err != nil {
+		return err
+	}
+	if lowest != c.etcdVersion {
+		c.logger.Infof("detected etcd server version %s (members: %v)", lowest, versions)
+	}
+	c.etcdVersion = lowest
+	c.podVersions = key
+	return nil
+}
+
+// supports tells whether every running member is recent enough to provide the given feature.
+// It is false as long as the version has not been detected.
+func (c *Cluster) supports(f etcdutil.Feature) bool {
+	return c.etcdVersion.Supports(f)
+}
+
+// checkVersionConvergence flags the cluster Degraded if, outside of an upgrade, the version
+// some members actually run differs from spec.version, e.g. after a pod image was edited by hand.
+// If spec.convergeVersions is set, the first of these members not annotated hands-off is rolled to spec.version.
+func (c *Cluster) checkVersionConvergence(pods []*v1.Pod) error {
+	if len(c.status.TargetVersion) != 0 {
+		return nil
+	}
+
+	etcdcli, err := c.etcdClient()
+	if err != nil {
+		return err
+	}
+	versions, err := etcdutil.MemberVersions(c.ctx, etcdcli, podsToMemberSet(pods, c.cluster.Spec).ClientURLs())
+	if err != nil {
+		return err
+	}
+	outliers := versionOutliers(pods, c.cluster.Spec, versions)
+	c.recordVersionOutliers(outliers)
+	if !c.cluster.Spec.ConvergeVersions {
+		return nil
+	}
+	if name, ok := convergeCandidate(outliers, c.handsOff); ok {
+		return c.upgradeOneMember(name)
+	}
+	return nil
+}
+
+// convergeCandidate returns the first of the outliers not annotated hands-off, if any.
+func convergeCandidate(outliers []string, handsOff map[string]bool) (string, bool) {
+	for _, name := range outliers {
+		if !handsOff[name] {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// versionOutliers returns, sorted, the members of the pods whose version, by client URL, is not spec.version.
+// A member whose version is unknown is an outlier.
+func versionOutliers(pods []*v1.Pod, sp api.ClusterSpec, versions map[string]string) []string {
+	var outliers []string
+	for _, m := range podsToMemberSet(pods, sp) {
+		if versions[m.ClientURL()] != sp.Version {
+			outliers = append(outliers, m.Name)
+		}
+	}
+	sort.Strings(outliers)
+	return outliers
+}
+
+// recordVersionOutliers flags the cluster Degraded while some members do not run spec.version,
+// and clears the flag once they all do.
+func (c *Cluster) recordVersionOutliers(outliers []string) {
+	if len(outliers) == 0 {
+		c.status.ClearDegradedCondition(api.DegradedReasonMixedVersions)
+		return
+	}
+	c.status.SetDegradedCondition(api.DegradedReasonMixedVersions,
+		fmt.Sprintf("members %v do not run version %s", outliers, c.cluster.Spec.Version))
+}
+
+func podVersionsKey(pods []*v1.Pod) string {
+	pvs := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		pvs = append(pvs, pod.Name+"="+k8sutil.GetEtcdVersion(pod))
+	}
+	sort.Strings(pvs)
+	return strings.Join(pvs, ",")
+}
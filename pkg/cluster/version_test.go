@@ -0,0 +1,79 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestVersionOutliers(t *testing.T) {
+	sp := api.ClusterSpec{Version: "3.2.13"}
+	pods := []*v1.Pod{newDecidePod("test-0002", true), newDecidePod("test-0000", true), newDecidePod("test-0001", true)}
+	url := func(name string) string { return newClusterMember(name, "", sp).ClientURL() }
+
+	c := &Cluster{cluster: &api.EtcdCluster{Spec: sp}}
+	tests := []struct {
+		versions     map[string]string
+		wantOutliers []string
+		wantDegraded bool
+	}{
+		// a member whose version is unknown is an outlier.
+		{map[string]string{url("test-0000"): "3.2.13", url("test-0002"): "3.2.11"}, []string{"test-0001", "test-0002"}, true},
+		{map[string]string{url("test-0000"): "3.2.13", url("test-0001"): "3.2.13", url("test-0002"): "3.2.11"}, []string{"test-0002"}, true},
+		// the Degraded condition is cleared once the versions converge.
+		{map[string]string{url("test-0000"): "3.2.13", url("test-0001"): "3.2.13", url("test-0002"): "3.2.13"}, nil, false},
+	}
+	for i, tt := range tests {
+		outliers := versionOutliers(pods, sp, tt.versions)
+		if !reflect.DeepEqual(outliers, tt.wantOutliers) {
+			t.Errorf("#%d: expect outliers %v, got %v", i, tt.wantOutliers, outliers)
+		}
+		c.recordVersionOutliers(outliers)
+		degraded := false
+		for _, cond := range c.status.Conditions {
+			if cond.Type == api.ClusterConditionDegraded && cond.Reason == api.DegradedReasonMixedVersions {
+				degraded = true
+			}
+		}
+		if degraded != tt.wantDegraded {
+			t.Errorf("#%d: expect degraded %v, got %v", i, tt.wantDegraded, degraded)
+		}
+	}
+}
+
+func TestConvergeCandidate(t *testing.T) {
+	tests := []struct {
+		outliers []string
+		handsOff map[string]bool
+		want     string
+		wantOK   bool
+	}{
+		{outliers: nil, wantOK: false},
+		{outliers: []string{"test-0000", "test-0001"}, want: "test-0000", wantOK: true},
+		{outliers: []string{"test-0000", "test-0001"}, handsOff: map[string]bool{"test-0000": true}, want: "test-0001", wantOK: true},
+		{outliers: []string{"test-0000"}, handsOff: map[string]bool{"test-0000": true}, wantOK: false},
+	}
+	for i, tt := range tests {
+		got, ok := convergeCandidate(tt.outliers, tt.handsOff)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("#%d: convergeCandidate()=(%q, %v), want=(%q, %v)", i, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
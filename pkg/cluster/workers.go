@@ -0,0 +1,328 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"k8s.io/api/core/v1"
+)
+
+// healthProbeInterval is the time between two probes of the health worker.
+const healthProbeInterval = 5 * time.Second
+
+// The run loop takes the operations that change the cluster one at a time, and some take long,
+// e.g. adding a member that receives a large snapshot from the leader.
+// The non-disruptive operations, which only read the members, run in workers next to it instead,
+// so that a long operation never delays the detection of a failure:
+//   - the health worker probes the readiness and the leader every healthProbeInterval, the status of each member
+//     every memberDetailsInterval, the clock skew of the members every clockSkewCheckInterval and the key space
+//     every keySpaceSampleInterval,
+//   - the metrics worker scrapes the members for the thresholds of spec.alerts every alertCheckInterval.
+//
+// The workers never touch the state of the run loop. They coordinate with it through the operation lock, opLock:
+// the run loop publishes an opView of the cluster after each poll of the pods, and the workers publish their results,
+// which the run loop records in the status at its next iteration.
+
+// opView is the state of the cluster the run loop publishes for the workers. It is not changed once published.
+type opView struct {
+	// members is a copy of the members, and ready the client URLs of those with a ready pod.
+	members   etcdutil.MemberSet
+	ready     []string
+	tlsConfig *tls.Config
+	// clientOptions authenticate as the probe user of spec.auth, if set.
+	clientOptions etcdutil.ClientOptions
+	// alerts is a copy of spec.alerts, nil if the members are not scraped.
+	alerts *api.AlertPolicy
+	// nodes are the nodes of the members with a running pod, by name.
+	nodes map[string]string
+}
+
+// healthProbe is the result of a probe of the health worker.
+type healthProbe struct {
+	at time.Time
+	// ready tells whether a quorum of the members is ready and a linearizable read through them succeeded.
+	ready bool
+	// leader is the ID of the leader as seen by a ready member, 0 if unknown.
+	leader uint64
+	// members is the status of each member as of the last refresh of the member details. It is nil until the first refresh.
+	members []api.MemberDetail
+	// clockSkews is how far the clock of the members, by name, is ahead of the clock of the operator, as of the last
+	// clock skew check. It is nil until the first check.
+	clockSkews map[string]time.Duration
+	// keySpace is the last sample of the key space and its growth. It is nil until the first sample.
+	keySpace *keySpaceGrowth
+}
+
+// metricsScrape is the result of a scrape of the metrics worker.
+type metricsScrape struct {
+	at time.Time
+	// dbSizes is the size of the backend database of the members, by name, if spec.alerts.maxDBSizePercent is set.
+	// err is why the size of a member could not be read.
+	dbSizes map[string]int64
+	err     error
+	// walFsync is the WAL fsync histogram of the members whose metrics could be read, by name,
+	// if spec.alerts.maxWALFsyncP99InMillisecond is set.
+	walFsync map[string]*etcdutil.Histogram
+}
+
+// startWorkers starts the workers of the cluster. They stop once the cluster is deleted.
+func (c *Cluster) startWorkers() {
+	w := &healthWorker{c: c, namespace: c.cluster.Namespace, name: c.cluster.Name}
+	go w.run()
+	go c.runMetricsWorker()
+}
+
+// publishView publishes the members, with the client URLs of those with a ready pod, for the workers.
+func (c *Cluster) publishView(running []*v1.Pod) {
+	members := c.members
+	if members == nil {
+		members = podsToMemberSet(running, c.cluster.Spec)
+	}
+	v := &opView{
+		members:       etcdutil.MemberSet{},
+		nodes:         map[string]string{},
+		tlsConfig:     c.tlsConfig,
+		clientOptions: c.probeClientOptions(),
+		alerts:        c.cluster.Spec.Alerts.DeepCopy(),
+	}
+	for name, m := range members {
+		cp := *m
+		v.members[name] = &cp
+	}
+	for _, pod := range running {
+		m, ok := members[pod.Name]
+		if !ok {
+			continue
+		}
+		v.nodes[pod.Name] = pod.Spec.NodeName
+		if k8sutil.IsPodReady(pod) {
+			v.ready = append(v.ready, m.ClientURL())
+		}
+	}
+	c.opLock.Lock()
+	c.opView = v
+	c.opLock.Unlock()
+}
+
+func (c *Cluster) currentView() *opView {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+	return c.opView
+}
+
+func (c *Cluster) lastProbe() healthProbe {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+	return c.probe
+}
+
+func (c *Cluster) lastScrape() metricsScrape {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+	return c.scrape
+}
+
+// healthWorker probes the health of the cluster. It keeps its own client, as the client of the run loop
+// is only used by the run loop.
+type healthWorker struct {
+	c *Cluster
+	// namespace and name are those of the cluster, for the readiness metric.
+	namespace, name string
+
+	etcdcli   *clientv3.Client
+	tlsConfig *tls.Config
+	opts      etcdutil.ClientOptions
+
+	// lastMemberDetailsCheck is the time of the last refresh of the member details, and memberDetails its result.
+	lastMemberDetailsCheck time.Time
+	memberDetails          []api.MemberDetail
+	// lastClockSkewCheck is the time of the last clock skew check, and clockSkews its result.
+	lastClockSkewCheck time.Time
+	clockSkews         map[string]time.Duration
+	// lastKeySpaceSample is the time of the last sample of the key space, keySpaceSamples the samples
+	// of the last keySpaceGrowthWindow, and keySpace their growth.
+	lastKeySpaceSample time.Time
+	keySpaceSamples    []keySpaceSample
+	keySpace           *keySpaceGrowth
+}
+
+// run probes the cluster every healthProbeInterval once the run loop published a view of it.
+// The readiness is published right away, for Ready and the readiness metric.
+func (w *healthWorker) run() {
+	defer w.closeClient()
+	for {
+		select {
+		case <-w.c.ctx.Done():
+			return
+		case <-time.After(healthProbeInterval):
+		}
+		v := w.c.currentView()
+		if v == nil {
+			continue
+		}
+		p := w.probe(v)
+		if time.Since(w.lastMemberDetailsCheck) >= memberDetailsInterval {
+			w.lastMemberDetailsCheck = time.Now()
+			w.memberDetails = w.checkMemberDetails(v)
+		}
+		p.members = w.memberDetails
+		if time.Since(w.lastClockSkewCheck) >= clockSkewCheckInterval {
+			w.lastClockSkewCheck = time.Now()
+			w.clockSkews = w.checkClockSkews(v)
+		}
+		p.clockSkews = w.clockSkews
+		if p.ready && time.Since(w.lastKeySpaceSample) >= keySpaceSampleInterval {
+			w.lastKeySpaceSample = time.Now()
+			w.sampleKeySpace(v)
+		}
+		p.keySpace = w.keySpace
+
+		c := w.c
+		c.opLock.Lock()
+		// The metrics of a deleted cluster are deleted by the run loop, under the lock.
+		if c.ctx.Err() == nil {
+			if c.probe.ready && !p.ready {
+				c.logger.Warningf("cluster turned unready")
+			}
+			c.probe = p
+			c.setReady(w.namespace, w.name, p.ready)
+		}
+		c.opLock.Unlock()
+	}
+}
+
+func (w *healthWorker) probe(v *opView) healthProbe {
+	p := healthProbe{at: time.Now()}
+	if !hasQuorum(v.members.Size(), len(v.ready)) {
+		return p
+	}
+	etcdcli, err := w.client(v)
+	if err == nil {
+		err = etcdutil.CheckLinearizableRead(w.c.ctx, etcdcli)
+	}
+	if err != nil {
+		w.c.logger.Warningf("cluster is not ready: linearizable read failed: %v", err)
+		return p
+	}
+	p.ready = true
+	st, err := etcdutil.MemberStatus(w.c.ctx, v.ready[0], v.tlsConfig, v.clientOptions)
+	if err != nil {
+		w.c.logger.Warningf("failed to get leader: %v", err)
+		return p
+	}
+	p.leader = st.Leader
+	return p
+}
+
+// checkClockSkews estimates the clock skew of the members. Members that cannot be reached are left out.
+func (w *healthWorker) checkClockSkews(v *opView) map[string]time.Duration {
+	skews := map[string]time.Duration{}
+	for name, m := range v.members {
+		skew, err := etcdutil.ClockSkew(w.c.ctx, m.ClientURL(), v.tlsConfig)
+		if err != nil {
+			w.c.logger.Debugf("failed to check clock skew of member (%s): %v", name, err)
+			continue
+		}
+		skews[name] = skew
+	}
+	return skews
+}
+
+// client returns the client of the worker, connected to the ready members. Like the client of the run loop,
+// it is kept open across probes and only replaced once the TLS config or the client options change.
+func (w *healthWorker) client(v *opView) (*clientv3.Client, error) {
+	if w.etcdcli != nil && (w.opts != v.clientOptions || w.tlsConfig != v.tlsConfig) {
+		w.closeClient()
+	}
+	if w.etcdcli == nil {
+		cfg := etcdutil.NewClientConfig(v.ready, v.tlsConfig, v.clientOptions)
+		cfg.Context = w.c.ctx
+		etcdcli, err := clientv3.New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("creating etcd client failed: %v", err)
+		}
+		w.etcdcli, w.tlsConfig, w.opts = etcdcli, v.tlsConfig, v.clientOptions
+		return etcdcli, nil
+	}
+	if !sameEndpoints(w.etcdcli.Endpoints(), v.ready) {
+		w.etcdcli.SetEndpoints(v.ready...)
+	}
+	return w.etcdcli, nil
+}
+
+func (w *healthWorker) closeClient() {
+	if w.etcdcli == nil {
+		return
+	}
+	w.etcdcli.Close()
+	w.etcdcli = nil
+}
+
+// runMetricsWorker scrapes the members for the thresholds of spec.alerts every alertCheckInterval,
+// once the run loop published a view of the cluster with alerts.
+func (c *Cluster) runMetricsWorker() {
+	var last time.Time
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(healthProbeInterval):
+		}
+		v := c.currentView()
+		if v == nil || v.alerts == nil || time.Since(last) < alertCheckInterval {
+			continue
+		}
+		last = time.Now()
+		s := c.scrapeMetrics(v)
+		c.opLock.Lock()
+		c.scrape = s
+		c.opLock.Unlock()
+	}
+}
+
+func (c *Cluster) scrapeMetrics(v *opView) metricsScrape {
+	s := metricsScrape{at: time.Now()}
+	if v.alerts.MaxDBSizePercent > 0 {
+		s.dbSizes = map[string]int64{}
+		for _, m := range v.members {
+			st, err := etcdutil.MemberStatus(c.ctx, m.ClientURL(), v.tlsConfig, v.clientOptions)
+			if err != nil {
+				s.err = fmt.Errorf("failed to get status of member (%s): %v", m.Name, err)
+				break
+			}
+			s.dbSizes[m.Name] = st.DbSize
+		}
+	}
+	if v.alerts.MaxWALFsyncP99InMillisecond > 0 {
+		s.walFsync = map[string]*etcdutil.Histogram{}
+		for _, m := range v.members {
+			h, err := etcdutil.WALFsyncHistogram(c.ctx, m.ClientURL(), v.tlsConfig)
+			if err != nil {
+				c.logger.Warningf("failed to get WAL fsync durations of member (%s): %v", m.Name, err)
+				continue
+			}
+			s.walFsync[m.Name] = h
+		}
+	}
+	return s
+}
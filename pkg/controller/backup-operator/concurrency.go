@@ -0,0 +1,60 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+)
+
+// Concurrency bounds the backups the operator takes at the same time.
+type Concurrency struct {
+	// Workers is the number of backups taken at the same time, whatever their storage type.
+	// Values below 1 mean 1.
+	Workers int
+	// PerStorageType limits the backups taken at the same time to a storage type,
+	// e.g. to stay below the request rate of a bucket. Storage types without a positive limit
+	// are only bounded by Workers.
+	PerStorageType map[api.BackupStorageType]int
+}
+
+func (c Concurrency) workers() int {
+	if c.Workers < 1 {
+		return 1
+	}
+	return c.Workers
+}
+
+// storageSlots hands out the slots of the storage types with a concurrency limit.
+type storageSlots map[api.BackupStorageType]chan struct{}
+
+func newStorageSlots(limits map[api.BackupStorageType]int) storageSlots {
+	s := storageSlots{}
+	for st, n := range limits {
+		if n > 0 {
+			s[st] = make(chan struct{}, n)
+		}
+	}
+	return s
+}
+
+// acquire waits for a free slot of the storage type and returns the function releasing it.
+func (s storageSlots) acquire(st api.BackupStorageType) (release func()) {
+	slots, ok := s[st]
+	if !ok {
+		return func() {}
+	}
+	slots <- struct{}{}
+	return func() { <-slots }
+}
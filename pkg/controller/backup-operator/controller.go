@@ -16,10 +16,12 @@ package controller
 
 import (
 	"context"
+	"reflect"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
@@ -50,8 +52,8 @@ func (b *Backup) run(ctx context.Context) {
 		return
 	}
 
-	const numWorkers = 1
-	for i := 0; i < numWorkers; i++ {
+	// The queue never hands the same backup to two workers.
+	for i := 0; i < b.workers; i++ {
 		go wait.Until(b.runWorker, time.Second, ctx.Done())
 	}
 
@@ -68,6 +70,12 @@ func (b *Backup) onAdd(obj interface{}) {
 }
 
 func (b *Backup) onUpdate(oldObj, newObj interface{}) {
+	// The next snapshot of a periodic backup is already scheduled, its own status updates are not processed.
+	oldEB, newEB := oldObj.(*api.EtcdBackup), newObj.(*api.EtcdBackup)
+	b.enqueueOwner(newEB)
+	if newEB.Spec.BackupPolicy.IsPeriodic() && reflect.DeepEqual(oldEB.Spec, newEB.Spec) {
+		return
+	}
 	key, err := cache.MetaNamespaceKeyFunc(newObj)
 	if err != nil {
 		panic(err)
@@ -81,4 +89,15 @@ func (b *Backup) onDelete(obj interface{}) {
 		panic(err)
 	}
 	b.queue.Add(key)
+	if eb, ok := obj.(*api.EtcdBackup); ok {
+		b.enqueueOwner(eb)
+	}
+}
+
+// enqueueOwner adds the backup that owns the backup of one of its policies to the queue,
+// so that it reports the new status of the policy, or recreates the deleted backup of the policy.
+func (b *Backup) enqueueOwner(eb *api.EtcdBackup) {
+	if ref := metav1.GetControllerOf(eb); ref != nil && ref.Kind == api.EtcdBackupResourceKind {
+		b.queue.Add(eb.Namespace + "/" + ref.Name)
+	}
 }
@@ -0,0 +1,44 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/storage"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// handleCustom saves etcd cluster's backup to the path of a storage backend registered for the storage type.
+func handleCustom(ctx context.Context, kubecli kubernetes.Interface, st api.BackupStorageType, s *api.CustomBackupSource, policy *api.BackupPolicy, endpoints []string, clientTLSSecret, namespace string) (*api.BackupStatus, error) {
+	be, err := storage.Open(kubecli, namespace, st, s)
+	if err != nil {
+		return nil, err
+	}
+	defer be.Close()
+
+	var tlsConfig *tls.Config
+	if tlsConfig, err = generateTLSConfig(kubecli, clientTLSSecret, namespace); err != nil {
+		return nil, err
+	}
+
+	bm := backup.NewBackupManagerFromWriter(kubecli, be, tlsConfig, endpoints, namespace)
+
+	return saveSnap(ctx, bm, s.Path, policy)
+}
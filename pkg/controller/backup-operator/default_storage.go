@@ -0,0 +1,147 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+)
+
+// DefaultStorage is the storage of the backups that do not set one, so that the teams running clusters
+// only have to set the endpoints of their backups.
+type DefaultStorage struct {
+	// StorageType is S3 or ABS. The backups without a storage are not defaulted if it is empty.
+	StorageType api.BackupStorageType
+	// PathTemplate is the text/template of the storage path of a backup, "<bucket>/<key>" for S3 and
+	// "<container>/<blob>" for ABS, e.g. "etcd-backups/{{.Namespace}}/{{.Cluster}}/{{.Name}}".
+	// It is executed on backupPathData.
+	PathTemplate string
+	// Secret is the secret with the AWS credentials for S3, or the ABS credentials for ABS.
+	Secret string
+	// S3Endpoint is the endpoint of an S3 compatible object store. AWS is used if it is empty.
+	S3Endpoint string
+}
+
+// backupPathData are the fields of DefaultStorage.PathTemplate.
+type backupPathData struct {
+	// Namespace and Name are those of the EtcdBackup.
+	Namespace string
+	Name      string
+	// Cluster is the name of the client service addressed by the first endpoint of the backup,
+	// without its "-client" suffix, i.e. the name of an EtcdCluster.
+	Cluster string
+}
+
+// Enabled tells whether the backups without a storage are defaulted.
+func (d DefaultStorage) Enabled() bool {
+	return len(d.StorageType) != 0
+}
+
+// Validate checks that the default storage, if enabled, has a known storage type, a path template and a secret.
+func (d DefaultStorage) Validate() error {
+	if !d.Enabled() {
+		return nil
+	}
+	if d.StorageType != api.BackupStorageTypeS3 && d.StorageType != api.BackupStorageTypeABS {
+		return fmt.Errorf("unknown default storage type (%s), must be %s or %s", d.StorageType, api.BackupStorageTypeS3, api.BackupStorageTypeABS)
+	}
+	if len(d.Secret) == 0 {
+		return fmt.Errorf("the default storage needs a secret")
+	}
+	_, err := d.path(backupPathData{Namespace: "default", Name: "example", Cluster: "example"})
+	return err
+}
+
+func (d DefaultStorage) path(data backupPathData) (string, error) {
+	t, err := template.New("path").Option("missingkey=error").Parse(d.PathTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid default storage path template (%s): %v", d.PathTemplate, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid default storage path template (%s): %v", d.PathTemplate, err)
+	}
+	p := buf.String()
+	if i := strings.Index(p, "/"); i <= 0 || i == len(p)-1 {
+		return "", fmt.Errorf("default storage path (%s) must be <bucket>/<key>", p)
+	}
+	return p, nil
+}
+
+// needsDefaultStorage tells whether the backup sets neither a storage nor policies.
+func needsDefaultStorage(spec *api.BackupSpec) bool {
+	return len(spec.StorageType) == 0 && spec.S3 == nil && spec.ABS == nil && spec.Custom == nil && len(spec.Policies) == 0
+}
+
+// apply sets the default storage in the spec of the backup eb.
+func (d DefaultStorage) apply(eb *api.EtcdBackup) error {
+	p, err := d.path(backupPathData{Namespace: eb.Namespace, Name: eb.Name, Cluster: endpointCluster(eb.Spec.EtcdEndpoints)})
+	if err != nil {
+		return err
+	}
+	eb.Spec.StorageType = d.StorageType
+	switch d.StorageType {
+	case api.BackupStorageTypeS3:
+		eb.Spec.S3 = &api.S3BackupSource{Path: p, AWSSecret: d.Secret, Endpoint: d.S3Endpoint}
+	case api.BackupStorageTypeABS:
+		eb.Spec.ABS = &api.ABSBackupSource{Path: p, ABSSecret: d.Secret}
+	}
+	return nil
+}
+
+// setDefaultStorage saves the default storage in the spec of the backup, so that the restores and the backups
+// before upgrades find it there too. The backup is taken once the update is processed.
+func (b *Backup) setDefaultStorage(eb *api.EtcdBackup) error {
+	eb = eb.DeepCopy()
+	if err := b.defaultStorage.apply(eb); err != nil {
+		if eb.Status.Reason != err.Error() {
+			eb.Status.Reason = err.Error()
+			b.updateBackupStatus(eb)
+		}
+		return nil
+	}
+	if _, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb); err != nil {
+		return fmt.Errorf("failed to set the default storage of backup (%s): %v", eb.Name, err)
+	}
+	b.logger.Infof("backing up (%s) to the default storage: %s", eb.Name, defaultStoragePath(&eb.Spec))
+	return nil
+}
+
+func defaultStoragePath(spec *api.BackupSpec) string {
+	if spec.S3 != nil {
+		return spec.S3.Path
+	}
+	return spec.ABS.Path
+}
+
+// endpointCluster returns the name of the client service addressed by the first endpoint, without its
+// "-client" suffix, e.g. "example" for "https://example-client.default.svc:2379". It is empty without endpoints.
+func endpointCluster(endpoints []string) string {
+	if len(endpoints) == 0 {
+		return ""
+	}
+	host := endpoints[0]
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexAny(host, ".:/"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.TrimSuffix(host, "-client")
+}
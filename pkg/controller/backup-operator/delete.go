@@ -0,0 +1,101 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/storage"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
+	"github.com/coreos/etcd-operator/pkg/util/azureutil/absfactory"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+// deleteBackup deletes the snapshots of a backup annotated with AnnotationDeleteSnapshots, e.g. by the deletion policy
+// of its cluster, then the backup. A backup with policies is deleted once the backups of its policies are,
+// which are annotated in turn.
+func (b *Backup) deleteBackup(eb *api.EtcdBackup) error {
+	cli := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace)
+	if len(eb.Spec.Policies) != 0 {
+		owned := b.policyBackups(eb)
+		for _, child := range owned {
+			if child.Annotations[k8sutil.AnnotationDeleteSnapshots] == "true" {
+				continue
+			}
+			child = child.DeepCopy()
+			if child.Annotations == nil {
+				child.Annotations = map[string]string{}
+			}
+			child.Annotations[k8sutil.AnnotationDeleteSnapshots] = "true"
+			if _, err := cli.Update(child); err != nil {
+				return fmt.Errorf("failed to request the deletion of backup (%s) of a policy: %v", child.Name, err)
+			}
+		}
+		if len(owned) != 0 {
+			// The backup is processed again as the backups of its policies are deleted.
+			return nil
+		}
+	} else if err := b.deleteSnapshots(&eb.Spec); err != nil {
+		return err
+	}
+	if err := cli.Delete(eb.Name, nil); err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return fmt.Errorf("failed to delete backup (%s): %v", eb.Name, err)
+	}
+	b.logger.Infof("deleted backup (%s) and its snapshots", eb.Name)
+	return nil
+}
+
+// deleteSnapshots deletes the snapshots saved at the path of the spec.
+func (b *Backup) deleteSnapshots(spec *api.BackupSpec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(constants.DefaultBackupTimeout))
+	defer cancel()
+	var (
+		w    writer.Writer
+		path string
+	)
+	switch {
+	case spec.StorageType == api.BackupStorageTypeS3 && spec.S3 != nil:
+		cli, err := s3factory.NewClientFromSecret(b.kubecli, b.namespace, spec.S3.Endpoint, spec.S3.AWSSecret)
+		if err != nil {
+			return err
+		}
+		defer cli.Close()
+		w, path = writer.NewS3Writer(cli.S3), spec.S3.Path
+	case spec.StorageType == api.BackupStorageTypeABS && spec.ABS != nil:
+		cli, err := absfactory.NewClientFromSecret(b.kubecli, b.namespace, spec.ABS.ABSSecret)
+		if err != nil {
+			return err
+		}
+		w, path = writer.NewABSWriter(cli.ABS), spec.ABS.Path
+	case storage.IsRegistered(spec.StorageType) && spec.Custom != nil:
+		be, err := storage.Open(b.kubecli, b.namespace, spec.StorageType, spec.Custom)
+		if err != nil {
+			return err
+		}
+		defer be.Close()
+		w, path = be, spec.Custom.Path
+	default:
+		// Nothing was saved without a storage.
+		return nil
+	}
+	bm := backup.NewBackupManagerFromWriter(b.kubecli, w, nil, nil, b.namespace)
+	return bm.DeleteSnapshots(ctx, path)
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runRestoreDrillsPeriodically runs the restore drills every interval until ctx is done.
+func (b *Backup) runRestoreDrillsPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.runRestoreDrills(); err != nil {
+				b.logger.Warningf("failed to run restore drills: %v", err)
+			}
+		}
+	}
+}
+
+// runRestoreDrills restores the latest successful backup of every cluster in the namespace
+// into a throwaway member, one cluster after the other, and records the result in the status of the backup.
+func (b *Backup) runRestoreDrills() error {
+	clusters, err := b.backupCRCli.EtcdV1beta2().EtcdClusters(b.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	backups, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, cl := range clusters.Items {
+		eb := k8sutil.LatestBackup(cl.Name, cl.Namespace, backups.Items)
+		if eb == nil {
+			continue
+		}
+		b.restoreDrill(cl.Name, eb.DeepCopy())
+	}
+	return nil
+}
+
+func (b *Backup) restoreDrill(clusterName string, eb *api.EtcdBackup) {
+	// The storage type slot is held like a backup holds it, as the drill downloads the backup.
+	release := b.storageSlots.acquire(eb.Spec.StorageType)
+	rm, err := b.restoreBackup(eb, eb.Name+"-drill", eb.Status.EtcdVersion, eb.Status.EtcdRevision)
+	release()
+
+	result := &api.RestoreDrillResult{Time: metav1.Now()}
+	if err != nil {
+		result.Reason = err.Error()
+		b.logger.Warningf("restore drill of backup (%s) failed: %v", eb.Name, err)
+		b.notifier.Notify("restore drill of the latest backup %s/%s of etcd cluster %s failed: %v", eb.Namespace, eb.Name, clusterName, err)
+	} else {
+		result.Succeeded = true
+		result.Revision = rm.Header.Revision
+		result.KeyCount = rm.Count
+		b.logger.Infof("restore drill of backup (%s) succeeded: revision %d, %d keys", eb.Name, rm.Header.Revision, rm.Count)
+	}
+	eb.Status.LastRestoreDrill = result
+	if _, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb); err != nil {
+		b.logger.Warningf("failed to update status of backup CR %v : (%v)", eb.Name, err)
+	}
+}
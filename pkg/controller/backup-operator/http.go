@@ -0,0 +1,200 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	"github.com/coreos/etcd-operator/pkg/backup/storage"
+	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
+	"github.com/coreos/etcd-operator/pkg/util/azureutil/absfactory"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	clustersPath = "/clusters/"
+	// downloadSubresource is the subresource of etcdbackups a user must be allowed to get to download a backup.
+	// Unlike reading the EtcdBackup resource, it grants access to all the data of the cluster.
+	downloadSubresource = "download"
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// StartHTTP serves the backup download endpoint, GET /clusters/{cluster-name}/backups/{backup-name},
+// the metrics of the backup operator, GET /metrics, and its build, GET /version, on listenAddr.
+func (b *Backup) StartHTTP(listenAddr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(clustersPath, b.handleDownload)
+	mux.Handle("/metrics", prometheus.Handler())
+	mux.HandleFunc(version.HTTPPath, version.Handler)
+	b.logger.Infof("listening on %v", listenAddr)
+	b.logger.Fatal(http.ListenAndServe(listenAddr, mux))
+}
+
+func (b *Backup) handleDownload(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	clusterName, backupName, ok := parseDownloadPath(req.URL.Path)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if err := b.authorizeDownload(req, backupName); err != nil {
+		b.logger.Warningf("refused download of backup (%s) from %s: %v", backupName, req.RemoteAddr, err)
+		if err == errUnauthorized {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+		return
+	}
+
+	eb, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Get(backupName, metav1.GetOptions{})
+	if k8sutil.IsKubernetesResourceNotFoundError(err) {
+		http.Error(w, "backup not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !k8sutil.IsBackupOfCluster(clusterName, b.namespace, eb) {
+		http.Error(w, "backup not found for cluster", http.StatusNotFound)
+		return
+	}
+	if !eb.Status.Succeeded {
+		http.Error(w, "backup has not succeeded", http.StatusConflict)
+		return
+	}
+
+	if err := b.serveBackup(w, eb); err != nil {
+		b.logger.Errorf("failed to serve backup (%s): %v", eb.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parseDownloadPath splits /clusters/{cluster-name}/backups/{backup-name}.
+func parseDownloadPath(p string) (clusterName, backupName string, ok bool) {
+	toks := strings.Split(strings.TrimPrefix(p, clustersPath), "/")
+	if len(toks) != 3 || toks[1] != "backups" || len(toks[0]) == 0 || len(toks[2]) == 0 {
+		return "", "", false
+	}
+	return toks[0], toks[2], true
+}
+
+// authorizeDownload authenticates the bearer token of the request with a TokenReview and checks with a
+// SubjectAccessReview that its user may get the download subresource of the backup.
+func (b *Backup) authorizeDownload(req *http.Request, backupName string) error {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if len(token) == 0 || token == req.Header.Get("Authorization") {
+		return errUnauthorized
+	}
+	tr, err := b.kubecli.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to review token: %v", err)
+	}
+	if !tr.Status.Authenticated {
+		return errUnauthorized
+	}
+
+	u := tr.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range u.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := b.kubecli.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   u.Username,
+			Groups: u.Groups,
+			Extra:  extra,
+			UID:    u.UID,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   b.namespace,
+				Verb:        "get",
+				Group:       api.SchemeGroupVersion.Group,
+				Resource:    api.EtcdBackupResourcePlural,
+				Subresource: downloadSubresource,
+				Name:        backupName,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to review access: %v", err)
+	}
+	if !sar.Status.Allowed {
+		return fmt.Errorf("user (%s) may not download backup (%s)", u.Username, backupName)
+	}
+	return nil
+}
+
+// serveBackup streams the backup file from its storage.
+func (b *Backup) serveBackup(w http.ResponseWriter, eb *api.EtcdBackup) error {
+	var (
+		r    reader.Reader
+		path string
+	)
+	switch eb.Spec.StorageType {
+	case api.BackupStorageTypeS3:
+		cli, err := s3factory.NewClientFromSecret(b.kubecli, b.namespace, eb.Spec.S3.Endpoint, eb.Spec.S3.AWSSecret)
+		if err != nil {
+			return fmt.Errorf("failed to create S3 client: %v", err)
+		}
+		defer cli.Close()
+		r, path = reader.NewS3Reader(cli.S3), k8sutil.BackupFilePath(eb)
+	case api.BackupStorageTypeABS:
+		cli, err := absfactory.NewClientFromSecret(b.kubecli, b.namespace, eb.Spec.ABS.ABSSecret)
+		if err != nil {
+			return fmt.Errorf("failed to create ABS client: %v", err)
+		}
+		r, path = reader.NewABSReader(cli.ABS), k8sutil.BackupFilePath(eb)
+	default:
+		be, err := storage.Open(b.kubecli, b.namespace, eb.Spec.StorageType, eb.Spec.Custom)
+		if err != nil {
+			return err
+		}
+		defer be.Close()
+		r, path = be, k8sutil.BackupFilePath(eb)
+	}
+
+	rc, err := r.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read backup file (%s): %v", path, err)
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", eb.Name+".db"))
+	// The status is sent with the first write, errors after that cannot be reported to the client anymore.
+	if _, err := io.Copy(w, rc); err != nil {
+		b.logger.Warningf("failed to stream backup (%s): %v", eb.Name, err)
+	}
+	return nil
+}
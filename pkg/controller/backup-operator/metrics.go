@@ -0,0 +1,60 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	backupLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd_operator",
+		Subsystem: "backup",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time the last snapshot of a backup was saved, in seconds since the epoch",
+	}, []string{"Namespace", "BackupName"})
+
+	backupSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd_operator",
+		Subsystem: "backup",
+		Name:      "snapshot_size_bytes",
+		Help:      "Size of the last snapshot of a backup",
+	}, []string{"Namespace", "BackupName"})
+
+	backupFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd_operator",
+		Subsystem: "backup",
+		Name:      "failures_total",
+		Help:      "Total number of failed snapshots of a backup",
+	}, []string{"Namespace", "BackupName"})
+)
+
+func init() {
+	prometheus.MustRegister(backupLastSuccess)
+	prometheus.MustRegister(backupSize)
+	prometheus.MustRegister(backupFailures)
+}
+
+// deleteBackupMetrics deletes the metrics of the deleted backup with the key.
+func deleteBackupMetrics(key string) {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return
+	}
+	backupLastSuccess.DeleteLabelValues(ns, name)
+	backupSize.DeleteLabelValues(ns, name)
+	backupFailures.DeleteLabelValues(ns, name)
+}
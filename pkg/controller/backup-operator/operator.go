@@ -18,12 +18,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/client"
 	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 
 	"github.com/sirupsen/logrus"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
@@ -46,10 +48,25 @@ type Backup struct {
 	kubeExtCli  apiextensionsclient.Interface
 
 	createCRD bool
+	// notifier is told about failed backups.
+	notifier *notifyutil.Notifier
+	// hooks are told about completed backups.
+	hooks notifyutil.Hooks
+
+	workers      int
+	storageSlots storageSlots
+
+	// restoreDrillInterval is the time between two restore drills of the latest backups. 0 disables them.
+	restoreDrillInterval time.Duration
+	// backupHelperImage is the image fetching the backup into the verify pods.
+	backupHelperImage string
+
+	// defaultStorage is the storage of the backups that set none.
+	defaultStorage DefaultStorage
 }
 
 // New creates a backup operator.
-func New(createCRD bool) *Backup {
+func New(createCRD bool, notifier *notifyutil.Notifier, hooks notifyutil.Hooks, concurrency Concurrency, restoreDrillInterval time.Duration, backupHelperImage string, defaultStorage DefaultStorage) *Backup {
 	return &Backup{
 		logger:      logrus.WithField("pkg", "controller"),
 		namespace:   os.Getenv(constants.EnvOperatorPodNamespace),
@@ -57,6 +74,16 @@ func New(createCRD bool) *Backup {
 		backupCRCli: client.MustNewInCluster(),
 		kubeExtCli:  k8sutil.MustNewKubeExtClient(),
 		createCRD:   createCRD,
+		notifier:    notifier,
+		hooks:       hooks,
+
+		workers:      concurrency.workers(),
+		storageSlots: newStorageSlots(concurrency.PerStorageType),
+
+		restoreDrillInterval: restoreDrillInterval,
+		backupHelperImage:    backupHelperImage,
+
+		defaultStorage: defaultStorage,
 	}
 }
 
@@ -68,7 +95,13 @@ func (b *Backup) Start(ctx context.Context) error {
 		}
 	}
 
+	// No backup runs yet: the temp dirs left are of the backups of an earlier run.
+	b.cleanupTempDirs(0)
+	go b.runTempCleanupPeriodically(ctx)
 	go b.run(ctx)
+	if b.restoreDrillInterval > 0 {
+		go b.runRestoreDrillsPeriodically(ctx, b.restoreDrillInterval)
+	}
 	<-ctx.Done()
 	return ctx.Err()
 }
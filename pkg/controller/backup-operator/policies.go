@@ -0,0 +1,169 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/storage"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// processBackupPolicies keeps an EtcdBackup for each of the policies of the backup, which saves the snapshots
+// of the policy like any other backup, and reports their status in the status of the backup.
+// The EtcdBackups of the policies that were removed from the spec are deleted.
+func (b *Backup) processBackupPolicies(eb *api.EtcdBackup) error {
+	eb = eb.DeepCopy()
+	if err := validatePolicies(&eb.Spec); err != nil {
+		// An invalid spec is not retried; it is processed again once it is updated.
+		if eb.Status.Reason != err.Error() {
+			eb.Status.Reason = err.Error()
+			b.updateBackupStatus(eb)
+		}
+		return nil
+	}
+
+	cli := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace)
+	owned := b.policyBackups(eb)
+	statuses := []api.BackupPolicyStatus{}
+	for _, p := range eb.Spec.Policies {
+		want := newPolicyBackup(eb, p)
+		cur, ok := owned[want.Name]
+		delete(owned, want.Name)
+		switch {
+		case !ok:
+			if _, err := cli.Create(want); err != nil {
+				return fmt.Errorf("failed to create backup (%s) of policy (%s): %v", want.Name, p.Name, err)
+			}
+			b.logger.Infof("created backup (%s) of policy (%s) of backup (%s)", want.Name, p.Name, eb.Name)
+			cur = want
+		case !reflect.DeepEqual(cur.Spec, want.Spec):
+			cur = cur.DeepCopy()
+			cur.Spec = want.Spec
+			if _, err := cli.Update(cur); err != nil {
+				return fmt.Errorf("failed to update backup (%s) of policy (%s): %v", cur.Name, p.Name, err)
+			}
+		}
+		statuses = append(statuses, newPolicyStatus(p.Name, cur))
+	}
+	for name := range owned {
+		if err := cli.Delete(name, nil); err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("failed to delete backup (%s) of a removed policy: %v", name, err)
+		}
+		b.logger.Infof("deleted backup (%s) of a policy removed from backup (%s)", name, eb.Name)
+	}
+
+	if !reflect.DeepEqual(eb.Status.Policies, statuses) || len(eb.Status.Reason) != 0 {
+		eb.Status.Policies = statuses
+		eb.Status.Reason = ""
+		b.updateBackupStatus(eb)
+	}
+	return nil
+}
+
+// policyBackups returns the EtcdBackups owned by the backup, by name.
+func (b *Backup) policyBackups(eb *api.EtcdBackup) map[string]*api.EtcdBackup {
+	owned := map[string]*api.EtcdBackup{}
+	for _, obj := range b.indexer.List() {
+		child := obj.(*api.EtcdBackup)
+		if ref := metav1.GetControllerOf(child); ref != nil && ref.UID == eb.UID {
+			owned[child.Name] = child
+		}
+	}
+	return owned
+}
+
+func (b *Backup) updateBackupStatus(eb *api.EtcdBackup) {
+	if _, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb); err != nil {
+		b.logger.Warningf("failed to update status of backup CR %v : (%v)", eb.Name, err)
+	}
+}
+
+// newPolicyBackup returns the EtcdBackup of the policy p of the backup eb, named "<backup-name>-<policy-name>".
+// It backs up the same endpoints as eb, with the same TLS secret and tag, to the storage of the policy.
+func newPolicyBackup(eb *api.EtcdBackup, p api.NamedBackupPolicy) *api.EtcdBackup {
+	labels := map[string]string{}
+	for k, v := range eb.Labels {
+		labels[k] = v
+	}
+	return &api.EtcdBackup{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.EtcdBackupResourceKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-%s", eb.Name, p.Name),
+			Namespace:       eb.Namespace,
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{eb.AsOwner()},
+		},
+		Spec: api.BackupSpec{
+			EtcdEndpoints:   eb.Spec.EtcdEndpoints,
+			StorageType:     p.StorageType,
+			BackupPolicy:    p.BackupPolicy,
+			BackupSource:    p.BackupSource,
+			ClientTLSSecret: eb.Spec.ClientTLSSecret,
+			Tag:             eb.Spec.Tag,
+		},
+	}
+}
+
+func newPolicyStatus(name string, pb *api.EtcdBackup) api.BackupPolicyStatus {
+	return api.BackupPolicyStatus{
+		Name:            name,
+		Backup:          pb.Name,
+		Succeeded:       pb.Status.Succeeded,
+		Reason:          pb.Status.Reason,
+		LastSuccessDate: pb.Status.LastSuccessDate,
+		LastBackupPath:  pb.Status.LastBackupPath,
+		Size:            pb.Status.Size,
+	}
+}
+
+// validatePolicies checks that the policies have unique DNS label names and a source of their storage type,
+// and that the spec does not set the storage of a backup without policies too.
+func validatePolicies(spec *api.BackupSpec) error {
+	if err := validate(spec); err != nil {
+		return err
+	}
+	if len(spec.StorageType) != 0 || spec.S3 != nil || spec.ABS != nil || spec.Custom != nil || spec.BackupPolicy != nil {
+		return errors.New("spec.storageType, spec.s3, spec.abs, spec.custom and spec.backupPolicy must not be set with spec.policies")
+	}
+	names := map[string]bool{}
+	for i, p := range spec.Policies {
+		if errs := validation.IsDNS1123Label(p.Name); len(errs) != 0 {
+			return fmt.Errorf("spec.policies[%d]: invalid name %q: %s", i, p.Name, strings.Join(errs, ", "))
+		}
+		if names[p.Name] {
+			return fmt.Errorf("spec.policies[%d]: duplicate name %q", i, p.Name)
+		}
+		names[p.Name] = true
+		switch {
+		case p.StorageType == api.BackupStorageTypeS3 && p.S3 != nil:
+		case p.StorageType == api.BackupStorageTypeABS && p.ABS != nil:
+		case storage.IsRegistered(p.StorageType) && p.Custom != nil:
+		default:
+			return fmt.Errorf("spec.policies[%d]: storage type %q must be %s, %s or a registered storage type, with its source set", i, p.StorageType, api.BackupStorageTypeS3, api.BackupStorageTypeABS)
+		}
+	}
+	return nil
+}
@@ -17,12 +17,19 @@ package controller
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
+	"github.com/coreos/etcd-operator/pkg/util/tmputil"
 
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -62,29 +69,99 @@ func (b *Backup) processItem(key string) error {
 		return err
 	}
 	if !exists {
+		deleteBackupMetrics(key)
 		return nil
 	}
 
 	eb := obj.(*api.EtcdBackup)
+	if eb.Annotations[k8sutil.AnnotationDeleteSnapshots] == "true" {
+		return b.deleteBackup(eb)
+	}
+	if eb.Status.Verifying && b.syncVerification(key, eb) {
+		return nil
+	}
+	if b.defaultStorage.Enabled() && needsDefaultStorage(&eb.Spec) {
+		return b.setDefaultStorage(eb)
+	}
+	if len(eb.Spec.Policies) != 0 {
+		return b.processBackupPolicies(eb)
+	}
+	if eb.Spec.BackupPolicy.IsPeriodic() {
+		return b.processPeriodicBackup(key, eb)
+	}
 	// don't process the CR if it has a status since
 	// having a status means that the backup is either made or failed.
 	if eb.Status.Succeeded || len(eb.Status.Reason) != 0 {
 		return nil
 	}
 	bs, err := b.handleBackup(&eb.Spec)
+	if err == nil && eb.Spec.BackupPolicy != nil && eb.Spec.BackupPolicy.VerifyRestore {
+		b.startVerification(eb, bs)
+	}
 	// Report backup status
 	b.reportBackupStatus(bs, err, eb)
 	return err
 }
 
+// processPeriodicBackup saves a snapshot of the periodic backup once its interval passed since the last one,
+// and schedules the next snapshot. A failed snapshot is retried at the next interval.
+func (b *Backup) processPeriodicBackup(key string, eb *api.EtcdBackup) error {
+	interval := time.Duration(eb.Spec.BackupPolicy.BackupIntervalInSecond) * time.Second
+	if wait := nextBackupWait(eb.Status.LastSuccessDate.Time, interval, time.Now()); wait > 0 {
+		b.queue.AddAfter(key, wait)
+		return nil
+	}
+	bs, err := b.handleBackup(&eb.Spec)
+	if err == nil && eb.Spec.BackupPolicy.VerifyRestore {
+		b.startVerification(eb, bs)
+	}
+	b.reportBackupStatus(bs, err, eb)
+	b.queue.AddAfter(key, interval)
+	return nil
+}
+
+// nextBackupWait returns how long to wait for the next snapshot of a periodic backup,
+// whose last snapshot was saved at last, or zero if it is due.
+func nextBackupWait(last time.Time, interval time.Duration, now time.Time) time.Duration {
+	if last.IsZero() {
+		return 0
+	}
+	if wait := last.Add(interval).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
 func (b *Backup) reportBackupStatus(bs *api.BackupStatus, berr error, eb *api.EtcdBackup) {
 	if berr != nil {
-		eb.Status.Succeeded = false
+		// A periodic backup can still be restored from its earlier snapshots.
+		eb.Status.Succeeded = eb.Spec.BackupPolicy.IsPeriodic() && !eb.Status.LastSuccessDate.IsZero()
 		eb.Status.Reason = berr.Error()
+		if tmputil.IsNoSpace(berr) {
+			eb.Status.SetFailedCondition(api.BackupFailedReasonDiskFull,
+				fmt.Sprintf("the disk of the backup operator is full, free space in %s or give it a larger volume: %v", os.TempDir(), berr))
+		} else {
+			eb.Status.SetFailedCondition(api.BackupFailedReasonError, berr.Error())
+		}
+		b.notifier.Notify("etcd backup %s/%s failed: %v", eb.Namespace, eb.Name, berr)
+		backupFailures.WithLabelValues(eb.Namespace, eb.Name).Inc()
 	} else {
 		eb.Status.Succeeded = true
+		eb.Status.Reason = ""
+		eb.Status.ClearFailedCondition()
 		eb.Status.EtcdRevision = bs.EtcdRevision
 		eb.Status.EtcdVersion = bs.EtcdVersion
+		eb.Status.Verified = bs.Verified
+		eb.Status.Verifying = bs.Verifying
+		eb.Status.VerificationReason = bs.VerificationReason
+		eb.Status.LastSuccessDate = bs.LastSuccessDate
+		eb.Status.LastBackupPath = bs.LastBackupPath
+		eb.Status.Size = bs.Size
+		backupLastSuccess.WithLabelValues(eb.Namespace, eb.Name).SetToCurrentTime()
+		backupSize.WithLabelValues(eb.Namespace, eb.Name).Set(float64(bs.Size))
+		ev := notifyutil.NewEvent(notifyutil.EventBackupCompleted, eb.Namespace, eb.Name)
+		ev.Message = fmt.Sprintf("saved to %s", bs.LastBackupPath)
+		b.hooks.Fire(ev)
 	}
 	_, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb)
 	if err != nil {
@@ -128,25 +205,50 @@ func (b *Backup) handleBackup(spec *api.BackupSpec) (*api.BackupStatus, error) {
 		backupTimeout = time.Duration(spec.BackupPolicy.TimeoutInSecond) * time.Second
 	}
 
+	// The timeout only starts once a slot of the storage type is free.
+	release := b.storageSlots.acquire(spec.StorageType)
+	defer release()
+
 	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
 	defer cancel()
 	switch spec.StorageType {
 	case api.BackupStorageTypeS3:
-		bs, err := handleS3(ctx, b.kubecli, spec.S3, spec.EtcdEndpoints, spec.ClientTLSSecret, b.namespace)
+		bs, err := handleS3(ctx, b.kubecli, spec.S3, spec.BackupPolicy, spec.EtcdEndpoints, spec.ClientTLSSecret, b.namespace)
 		if err != nil {
 			return nil, err
 		}
 		return bs, nil
 	case api.BackupStorageTypeABS:
-		bs, err := handleABS(ctx, b.kubecli, spec.ABS, spec.EtcdEndpoints, spec.ClientTLSSecret, b.namespace)
+		bs, err := handleABS(ctx, b.kubecli, spec.ABS, spec.BackupPolicy, spec.EtcdEndpoints, spec.ClientTLSSecret, b.namespace)
 		if err != nil {
 			return nil, err
 		}
 		return bs, nil
 	default:
-		logrus.Fatalf("unknown StorageType: %v", spec.StorageType)
+		return handleCustom(ctx, b.kubecli, spec.StorageType, spec.Custom, spec.BackupPolicy, spec.EtcdEndpoints, spec.ClientTLSSecret, b.namespace)
+	}
+}
+
+// saveSnap saves a snapshot of the cluster with bm at path. The snapshots of a periodic backup are saved at
+// their own path after it, and the oldest ones beyond policy.MaxBackups are deleted.
+func saveSnap(ctx context.Context, bm *backup.BackupManager, path string, policy *api.BackupPolicy) (*api.BackupStatus, error) {
+	snap, err := bm.SaveSnap(ctx, path, policy.IsPeriodic())
+	if err != nil {
+		return nil, fmt.Errorf("failed to save snapshot (%v)", err)
+	}
+	bs := &api.BackupStatus{EtcdVersion: snap.EtcdVersion, EtcdRevision: snap.Revision, Size: snap.Size}
+	if !policy.IsPeriodic() {
+		return bs, nil
+	}
+	bs.LastSuccessDate = metav1.Now()
+	bs.LastBackupPath = snap.Path
+	if policy.MaxBackups > 0 {
+		// The snapshot is saved, failing to delete older ones does not fail it.
+		if err := bm.EnsureMaxBackups(ctx, path, policy.MaxBackups); err != nil {
+			logrus.Warningf("failed to delete old snapshots of (%s): %v", path, err)
+		}
 	}
-	return nil, nil
+	return bs, nil
 }
 
 // TODO: move this to initializer
@@ -15,9 +15,13 @@
 package controller
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestValidate(t *testing.T) {
@@ -44,3 +48,167 @@ func TestValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDownloadPath(t *testing.T) {
+	tests := []struct {
+		path, cluster, backup string
+		ok                    bool
+	}{
+		{path: "/clusters/example/backups/nightly", cluster: "example", backup: "nightly", ok: true},
+		{path: "/clusters/example/backups/", ok: false},
+		{path: "/clusters/example/nightly", ok: false},
+		{path: "/clusters/example/backups/nightly/extra", ok: false},
+	}
+	for i, tt := range tests {
+		cluster, backup, ok := parseDownloadPath(tt.path)
+		if cluster != tt.cluster || backup != tt.backup || ok != tt.ok {
+			t.Errorf("#%d: expect (%q, %q, %v), get (%q, %q, %v)", i, tt.cluster, tt.backup, tt.ok, cluster, backup, ok)
+		}
+	}
+}
+
+func TestStorageSlots(t *testing.T) {
+	s := newStorageSlots(map[api.BackupStorageType]int{api.BackupStorageTypeS3: 1, api.BackupStorageTypeABS: 0})
+	if _, ok := s[api.BackupStorageTypeABS]; ok {
+		t.Error("expect no limit on ABS backups")
+	}
+
+	release := s.acquire(api.BackupStorageTypeS3)
+	acquired := make(chan struct{})
+	go func() {
+		s.acquire(api.BackupStorageTypeS3)()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expect the second S3 backup to wait for the first one")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expect the second S3 backup to start once the first one is done")
+	}
+}
+
+func TestRestoredMember(t *testing.T) {
+	out := `{"header":{"cluster_id":14841639068965178418,"member_id":10276657743932975437,"revision":42,"raft_term":2},"count":7}`
+	rm := &restoredMember{}
+	if err := json.Unmarshal([]byte(out), rm); err != nil {
+		t.Fatal(err)
+	}
+	if rm.Header.Revision != 42 || rm.Count != 7 {
+		t.Errorf("expect revision 42 and 7 keys, get revision %d and %d keys", rm.Header.Revision, rm.Count)
+	}
+}
+
+func TestNextBackupWait(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		last time.Time
+		want time.Duration
+	}{
+		{last: time.Time{}, want: 0},
+		{last: now.Add(-time.Hour), want: 0},
+		{last: now.Add(-20 * time.Minute), want: 10 * time.Minute},
+	}
+	for i, tt := range tests {
+		if get := nextBackupWait(tt.last, 30*time.Minute, now); get != tt.want {
+			t.Errorf("#%d: nextBackupWait()=%v, want=%v", i, get, tt.want)
+		}
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	s3 := api.NamedBackupPolicy{Name: "hourly", StorageType: api.BackupStorageTypeS3, BackupSource: api.BackupSource{S3: &api.S3BackupSource{Path: "b/p"}}}
+	tests := []struct {
+		spec      api.BackupSpec
+		expectErr bool
+	}{{
+		spec: api.BackupSpec{Policies: []api.NamedBackupPolicy{s3}},
+	}, { // storage set with policies
+		spec:      api.BackupSpec{StorageType: api.BackupStorageTypeS3, Policies: []api.NamedBackupPolicy{s3}},
+		expectErr: true,
+	}, { // duplicate name
+		spec:      api.BackupSpec{Policies: []api.NamedBackupPolicy{s3, s3}},
+		expectErr: true,
+	}, { // invalid name
+		spec:      api.BackupSpec{Policies: []api.NamedBackupPolicy{{Name: "Hourly", StorageType: s3.StorageType, BackupSource: s3.BackupSource}}},
+		expectErr: true,
+	}, { // no source of the storage type
+		spec:      api.BackupSpec{Policies: []api.NamedBackupPolicy{{Name: "daily", StorageType: api.BackupStorageTypeABS, BackupSource: s3.BackupSource}}},
+		expectErr: true,
+	}, { // storage type without a registered backend
+		spec:      api.BackupSpec{Policies: []api.NamedBackupPolicy{{Name: "daily", StorageType: "Unknown", BackupSource: api.BackupSource{Custom: &api.CustomBackupSource{Path: "b/p"}}}}},
+		expectErr: true,
+	}}
+	for i, tt := range tests {
+		tt.spec.EtcdEndpoints = []string{"http://localhost:2379"}
+		err := validatePolicies(&tt.spec)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.expectErr, err)
+		}
+	}
+}
+
+func TestNewPolicyBackup(t *testing.T) {
+	eb := &api.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default", UID: "uid"},
+		Spec:       api.BackupSpec{EtcdEndpoints: []string{"http://example-client:2379"}, Tag: "nightly"},
+	}
+	p := api.NamedBackupPolicy{
+		Name:         "daily",
+		StorageType:  api.BackupStorageTypeABS,
+		BackupPolicy: &api.BackupPolicy{BackupIntervalInSecond: 86400},
+		BackupSource: api.BackupSource{ABS: &api.ABSBackupSource{Path: "c/p"}},
+	}
+	pb := newPolicyBackup(eb, p)
+	if pb.Name != "example-daily" {
+		t.Errorf("expect name example-daily, get %s", pb.Name)
+	}
+	if ref := metav1.GetControllerOf(pb); ref == nil || ref.UID != eb.UID {
+		t.Errorf("expect the backup to be owned by %s, get %v", eb.Name, pb.OwnerReferences)
+	}
+	if pb.Spec.Tag != "nightly" || pb.Spec.ABS != p.ABS || !pb.Spec.BackupPolicy.IsPeriodic() || len(pb.Spec.Policies) != 0 {
+		t.Errorf("unexpected spec %+v", pb.Spec)
+	}
+}
+
+func TestDefaultStorage(t *testing.T) {
+	d := DefaultStorage{
+		StorageType:  api.BackupStorageTypeS3,
+		PathTemplate: "etcd-backups/{{.Namespace}}/{{.Cluster}}/{{.Name}}",
+		Secret:       "aws",
+	}
+	if err := d.Validate(); err != nil {
+		t.Fatalf("expect valid default storage, get %v", err)
+	}
+	eb := &api.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "orders"},
+		Spec:       api.BackupSpec{EtcdEndpoints: []string{"https://example-client.orders.svc:2379"}},
+	}
+	if !needsDefaultStorage(&eb.Spec) {
+		t.Fatalf("expect a backup without storage to need the default storage")
+	}
+	if err := d.apply(eb); err != nil {
+		t.Fatal(err)
+	}
+	if eb.Spec.StorageType != api.BackupStorageTypeS3 || eb.Spec.S3 == nil || eb.Spec.S3.Path != "etcd-backups/orders/example/nightly" || eb.Spec.S3.AWSSecret != "aws" {
+		t.Errorf("unexpected spec %+v", eb.Spec)
+	}
+	if needsDefaultStorage(&eb.Spec) {
+		t.Errorf("expect a backup with a storage not to need the default storage")
+	}
+
+	for _, invalid := range []DefaultStorage{
+		{StorageType: "GCS", PathTemplate: "b/{{.Name}}", Secret: "s"},
+		{StorageType: api.BackupStorageTypeABS, PathTemplate: "b/{{.Name}}"},
+		{StorageType: api.BackupStorageTypeABS, PathTemplate: "{{.Name}}", Secret: "s"},
+		{StorageType: api.BackupStorageTypeABS, PathTemplate: "b/{{.Unknown}}", Secret: "s"},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expect %+v to be invalid", invalid)
+		}
+	}
+}
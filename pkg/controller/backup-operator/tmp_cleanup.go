@@ -0,0 +1,53 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/tmputil"
+)
+
+const (
+	tempCleanupInterval = 10 * time.Minute
+	// tempDirMaxAge is the age beyond which a temp dir is no longer used by a backup, e.g. the client certificates
+	// of a finished backup, which its TLS config kept.
+	tempDirMaxAge = 6 * time.Hour
+)
+
+// runTempCleanupPeriodically removes the temp dirs of the backups older than tempDirMaxAge every tempCleanupInterval.
+func (b *Backup) runTempCleanupPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(tempCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.cleanupTempDirs(tempDirMaxAge)
+		}
+	}
+}
+
+func (b *Backup) cleanupTempDirs(maxAge time.Duration) {
+	n, err := tmputil.Cleanup(maxAge)
+	if err != nil {
+		b.logger.Warningf("failed to clean up temp dirs: %v", err)
+	}
+	if n > 0 {
+		b.logger.Infof("removed %d temp dirs of past backups", n)
+	}
+}
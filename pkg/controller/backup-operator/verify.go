@@ -0,0 +1,248 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	backupstorage "github.com/coreos/etcd-operator/pkg/backup/storage"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
+	"github.com/coreos/etcd-operator/pkg/util/azureutil/absfactory"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	verifyImageRepository = "quay.io/coreos/etcd"
+	// verifyTimeout bounds fetching, restoring and starting etcd on the backup.
+	verifyTimeout = 5 * time.Minute
+	// verifyPollInterval is the interval a backup being verified is synced at, until its verify pod finished.
+	verifyPollInterval = 10 * time.Second
+)
+
+// restoredMember is what the verify pod reports about the member it restored,
+// i.e. the output of etcdctl get --count-only -w json.
+type restoredMember struct {
+	Header struct {
+		Revision int64 `json:"revision"`
+	} `json:"header"`
+	Count int64 `json:"count"`
+}
+
+func verifyPodName(eb *api.EtcdBackup) string {
+	return eb.Name + "-verify"
+}
+
+// startVerification starts the verify pod of the backup saved for eb and marks bs as being verified.
+// The worker does not wait for the pod: syncVerification records the result on a later sync of the backup.
+func (b *Backup) startVerification(eb *api.EtcdBackup, bs *api.BackupStatus) {
+	// The path of a periodic snapshot is only recorded in the status of the backup with the result of the snapshot.
+	saved := eb.DeepCopy()
+	saved.Status.LastBackupPath = bs.LastBackupPath
+	podName := verifyPodName(eb)
+	// The verification of an earlier snapshot that is still running is abandoned.
+	b.deleteVerifyPod(podName)
+	if _, err := b.createVerifyPod(saved, podName, bs.EtcdVersion); err != nil {
+		b.logger.Warningf("failed to verify backup (%s): %v", eb.Name, err)
+		bs.VerificationReason = err.Error()
+		return
+	}
+	bs.Verifying = true
+}
+
+// syncVerification records in the status of eb the result of its verify pod, once the pod finished or timed out,
+// and requeues the backup until then. It returns whether the status of the backup was updated.
+func (b *Backup) syncVerification(key string, eb *api.EtcdBackup) bool {
+	podName := verifyPodName(eb)
+	pod, err := b.kubecli.CoreV1().Pods(b.namespace).Get(podName, metav1.GetOptions{})
+	var verr error
+	switch {
+	case k8sutil.IsKubernetesResourceNotFoundError(err):
+		verr = fmt.Errorf("verify pod (%s) is gone", podName)
+	case err != nil:
+		b.logger.Warningf("failed to get verify pod (%s): %v", podName, err)
+		b.queue.AddAfter(key, verifyPollInterval)
+		return false
+	case pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed:
+		if time.Since(pod.CreationTimestamp.Time) < verifyTimeout {
+			b.queue.AddAfter(key, verifyPollInterval)
+			return false
+		}
+		verr = fmt.Errorf("verify pod (%s) did not finish within %v", podName, verifyTimeout)
+	default:
+		_, verr = restoredMemberOf(pod, eb.Status.EtcdRevision)
+	}
+
+	eb = eb.DeepCopy()
+	eb.Status.Verifying = false
+	eb.Status.Verified = verr == nil
+	eb.Status.VerificationReason = ""
+	if verr != nil {
+		b.logger.Warningf("failed to verify backup (%s): %v", eb.Name, verr)
+		eb.Status.VerificationReason = verr.Error()
+	}
+	if _, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb); err != nil {
+		b.logger.Warningf("failed to update status of backup CR %v : (%v)", eb.Name, err)
+		b.queue.AddAfter(key, verifyPollInterval)
+		return true
+	}
+	b.deleteVerifyPod(podName)
+	return true
+}
+
+// restoreBackup restores the backup saved for eb in the throwaway pod podName, runs etcd of the given version on it
+// and checks that the restored member is at least at the revision the backup was taken at.
+// Unlike startVerification, it waits for the pod.
+func (b *Backup) restoreBackup(eb *api.EtcdBackup, podName, etcdVersion string, etcdRevision int64) (*restoredMember, error) {
+	pod, err := b.createVerifyPod(eb, podName, etcdVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer b.deleteVerifyPod(pod.Name)
+
+	podCli := b.kubecli.CoreV1().Pods(b.namespace)
+	interval := 5 * time.Second
+	err = retryutil.Retry(interval, int(verifyTimeout/interval), func() (bool, error) {
+		pod, err = podCli.Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for verify pod (%s): %v", pod.Name, err)
+	}
+	return restoredMemberOf(pod, etcdRevision)
+}
+
+// restoredMemberOf returns the member restored by the finished verify pod, which must be at least at etcdRevision.
+func restoredMemberOf(pod *v1.Pod, etcdRevision int64) (*restoredMember, error) {
+	if pod.Status.Phase == v1.PodFailed {
+		return nil, fmt.Errorf("backup is not restorable: %s", terminationMessage(pod))
+	}
+	rm := &restoredMember{}
+	if err := json.Unmarshal([]byte(containerMessage(pod, "verify")), rm); err != nil {
+		return nil, fmt.Errorf("failed to read the restored member: %v", err)
+	}
+	if rm.Header.Revision < etcdRevision {
+		return nil, fmt.Errorf("restored member is at revision %d, before the backup revision %d", rm.Header.Revision, etcdRevision)
+	}
+	return rm, nil
+}
+
+// createVerifyPod creates the verify pod podName for the backup saved for eb.
+func (b *Backup) createVerifyPod(eb *api.EtcdBackup, podName, etcdVersion string) (*v1.Pod, error) {
+	backupURL, err := b.backupDownloadURL(&eb.Spec, k8sutil.BackupFilePath(eb))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download url of backup: %v", err)
+	}
+	pod := k8sutil.NewBackupVerifyPod(podName, b.namespace, backupURL, b.backupHelperImage, verifyImageRepository, etcdVersion, eb.AsOwner())
+	if _, err = b.kubecli.CoreV1().Pods(b.namespace).Create(pod); err != nil {
+		return nil, fmt.Errorf("failed to create verify pod: %v", err)
+	}
+	return pod, nil
+}
+
+func (b *Backup) deleteVerifyPod(podName string) {
+	err := b.kubecli.CoreV1().Pods(b.namespace).Delete(podName, metav1.NewDeleteOptions(0))
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		b.logger.Warningf("failed to delete verify pod (%s): %v", podName, err)
+	}
+}
+
+// backupDownloadURL returns a temporary URL the verify pod can download the backup file at path from.
+func (b *Backup) backupDownloadURL(spec *api.BackupSpec, path string) (*url.URL, error) {
+	var rawURL string
+	switch spec.StorageType {
+	case api.BackupStorageTypeS3:
+		cli, err := s3factory.NewClientFromSecret(b.kubecli, b.namespace, spec.S3.Endpoint, spec.S3.AWSSecret)
+		if err != nil {
+			return nil, err
+		}
+		defer cli.Close()
+		bk, key, err := util.ParseBucketAndKey(path)
+		if err != nil {
+			return nil, err
+		}
+		req, _ := cli.S3.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bk), Key: aws.String(key)})
+		rawURL, err = req.Presign(verifyTimeout)
+		if err != nil {
+			return nil, err
+		}
+	case api.BackupStorageTypeABS:
+		cli, err := absfactory.NewClientFromSecret(b.kubecli, b.namespace, spec.ABS.ABSSecret)
+		if err != nil {
+			return nil, err
+		}
+		container, key, err := util.ParseBucketAndKey(path)
+		if err != nil {
+			return nil, err
+		}
+		blob := cli.ABS.GetContainerReference(container).GetBlobReference(key)
+		rawURL, err = blob.GetSASURI(storage.BlobSASOptions{
+			BlobServiceSASPermissions: storage.BlobServiceSASPermissions{Read: true},
+			SASOptions:                storage.SASOptions{Expiry: time.Now().Add(verifyTimeout), UseHTTPS: true},
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		be, err := backupstorage.Open(b.kubecli, b.namespace, spec.StorageType, spec.Custom)
+		if err != nil {
+			return nil, err
+		}
+		defer be.Close()
+		signer, ok := be.(backupstorage.URLSigner)
+		if !ok {
+			return nil, fmt.Errorf("backup storage type (%s) cannot hand out a URL to download the backup from", spec.StorageType)
+		}
+		return signer.SignedURL(path, verifyTimeout)
+	}
+	return url.Parse(rawURL)
+}
+
+func terminationMessage(pod *v1.Pod) string {
+	statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			if len(t.Message) != 0 {
+				return fmt.Sprintf("container %s: %s", cs.Name, t.Message)
+			}
+			return fmt.Sprintf("container %s exited with code %d", cs.Name, t.ExitCode)
+		}
+	}
+	return "pod failed"
+}
+
+// containerMessage returns the termination message of the named container of the pod.
+func containerMessage(pod *v1.Pod, name string) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; cs.Name == name && t != nil {
+			return t.Message
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	fakeetcd "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestTerminationMessage(t *testing.T) {
+	terminated := func(name string, code int32, message string) v1.ContainerStatus {
+		return v1.ContainerStatus{
+			Name:  name,
+			State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: code, Message: message}},
+		}
+	}
+	tests := []struct {
+		pod  *v1.Pod
+		want string
+	}{{
+		pod:  &v1.Pod{},
+		want: "pod failed",
+	}, {
+		pod: &v1.Pod{Status: v1.PodStatus{
+			InitContainerStatuses: []v1.ContainerStatus{terminated("fetch-backup", 1, "http status code: 403")},
+			ContainerStatuses:     []v1.ContainerStatus{{Name: "verify"}},
+		}},
+		want: "container fetch-backup: http status code: 403",
+	}, {
+		pod: &v1.Pod{Status: v1.PodStatus{
+			InitContainerStatuses: []v1.ContainerStatus{terminated("fetch-backup", 0, "")},
+			ContainerStatuses:     []v1.ContainerStatus{terminated("verify", 2, "")},
+		}},
+		want: "container verify exited with code 2",
+	}}
+	for i, tt := range tests {
+		if got := terminationMessage(tt.pod); got != tt.want {
+			t.Errorf("#%d: expect %q, got %q", i, tt.want, got)
+		}
+	}
+}
+
+func TestSyncVerification(t *testing.T) {
+	verifyPod := func(phase v1.PodPhase, created time.Time, message string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-verify", Namespace: metav1.NamespaceDefault, CreationTimestamp: metav1.NewTime(created)},
+			Status: v1.PodStatus{
+				Phase: phase,
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name:  "verify",
+					State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0, Message: message}},
+				}},
+			},
+		}
+	}
+	now := time.Now()
+	tests := []struct {
+		desc string
+		pod  *v1.Pod
+
+		wantDone     bool
+		wantVerified bool
+		wantReason   string
+	}{{
+		desc:       "verify pod deleted",
+		wantDone:   true,
+		wantReason: "verify pod (backup-verify) is gone",
+	}, {
+		desc: "verify pod running",
+		pod:  verifyPod(v1.PodRunning, now, ""),
+	}, {
+		desc:       "verify pod timed out",
+		pod:        verifyPod(v1.PodRunning, now.Add(-verifyTimeout-time.Minute), ""),
+		wantDone:   true,
+		wantReason: "verify pod (backup-verify) did not finish within 5m0s",
+	}, {
+		desc:         "restored member at the backup revision",
+		pod:          verifyPod(v1.PodSucceeded, now, `{"header":{"revision":10},"count":3}`),
+		wantDone:     true,
+		wantVerified: true,
+	}, {
+		desc:       "restored member before the backup revision",
+		pod:        verifyPod(v1.PodSucceeded, now, `{"header":{"revision":5},"count":3}`),
+		wantDone:   true,
+		wantReason: "restored member is at revision 5, before the backup revision 10",
+	}, {
+		desc:       "verify pod failed",
+		pod:        verifyPod(v1.PodFailed, now, ""),
+		wantDone:   true,
+		wantReason: "backup is not restorable: pod failed",
+	}}
+	for _, tt := range tests {
+		eb := &api.EtcdBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: metav1.NamespaceDefault},
+			Status:     api.BackupStatus{Succeeded: true, EtcdRevision: 10, Verifying: true},
+		}
+		kubecli := fake.NewSimpleClientset()
+		if tt.pod != nil {
+			kubecli = fake.NewSimpleClientset(tt.pod)
+		}
+		crcli := fakeetcd.NewSimpleClientset(eb.DeepCopy())
+		b := &Backup{
+			logger:      logrus.WithField("pkg", "test"),
+			namespace:   metav1.NamespaceDefault,
+			queue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test"),
+			kubecli:     kubecli,
+			backupCRCli: crcli,
+		}
+
+		if done := b.syncVerification("default/backup", eb); done != tt.wantDone {
+			t.Errorf("%s: expect done=%v, got %v", tt.desc, tt.wantDone, done)
+		}
+		got, err := crcli.EtcdV1beta2().EtcdBackups(eb.Namespace).Get(eb.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status.Verifying == tt.wantDone || got.Status.Verified != tt.wantVerified || got.Status.VerificationReason != tt.wantReason {
+			t.Errorf("%s: expect verifying=%v, verified=%v and reason %q, got %+v",
+				tt.desc, !tt.wantDone, tt.wantVerified, tt.wantReason, got.Status)
+		}
+		_, err = kubecli.CoreV1().Pods(eb.Namespace).Get("backup-verify", metav1.GetOptions{})
+		if podLeft := err == nil; podLeft != (tt.pod != nil && !tt.wantDone) {
+			t.Errorf("%s: expect the verify pod to be kept only while it runs, got kept=%v", tt.desc, podLeft)
+		}
+		b.queue.ShutDown()
+	}
+}
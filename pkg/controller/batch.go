@@ -0,0 +1,414 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BatchPath is the path of the batch creation endpoints: POST /batches creates the clusters of a BatchRequest
+// and GET /batches/{id} returns the BatchStatus of the batch.
+const BatchPath = "/batches"
+
+const (
+	defaultBatchConcurrency = 5
+	maxBatchConcurrency     = 20
+	// maxKeptBatches is the number of batches kept for their status; the oldest finished ones are dropped beyond it.
+	maxKeptBatches = 50
+	// maxUnfinishedBatches is the number of batches created at once; further batches are refused until one is done.
+	maxUnfinishedBatches = 5
+)
+
+var (
+	errUnauthorized   = errors.New("unauthorized")
+	errTooManyBatches = fmt.Errorf("too many unfinished batches, at most %d are created at once", maxUnfinishedBatches)
+)
+
+var (
+	// batchClusterTimeout is how long a cluster of a batch has to be running once its resource is created.
+	batchClusterTimeout = 10 * time.Minute
+	batchPollInterval   = 5 * time.Second
+)
+
+// BatchRequest is the list of clusters to create. At most Concurrency clusters are created at once:
+// a cluster counts until it is running, has failed or timed out. It defaults to 5 and is at most 20.
+type BatchRequest struct {
+	Clusters    []api.EtcdCluster `json:"clusters"`
+	Concurrency int               `json:"concurrency,omitempty"`
+}
+
+const (
+	BatchStatePending  = "Pending"
+	BatchStateCreating = "Creating"
+	BatchStateRunning  = "Running"
+	BatchStateFailed   = "Failed"
+)
+
+// BatchStatus is the progress of a batch, as a count of its clusters by state and the state of each cluster.
+type BatchStatus struct {
+	ID          string `json:"id"`
+	CreatedTime string `json:"createdTime"`
+	Concurrency int    `json:"concurrency"`
+	Total       int    `json:"total"`
+	Pending     int    `json:"pending"`
+	Creating    int    `json:"creating"`
+	Running     int    `json:"running"`
+	Failed      int    `json:"failed"`
+	// Done is true once every cluster of the batch is running or has failed.
+	Done     bool                 `json:"done"`
+	Clusters []BatchClusterStatus `json:"clusters"`
+}
+
+type BatchClusterStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Error     string `json:"error,omitempty"`
+}
+
+type batch struct {
+	clusters []*api.EtcdCluster
+	// namespaces are the namespaces of the clusters, whose etcdclusters a user must be allowed to get for the status.
+	namespaces []string
+
+	mu     sync.Mutex
+	status BatchStatus
+}
+
+// ServeBatch serves the batch creation endpoints.
+// The user of a request must be allowed to create, or to get for the status of a batch,
+// the etcdclusters of every namespace of the batch.
+func (c *Controller) ServeBatch(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, BatchPath), "/")
+	switch {
+	case len(id) == 0 && r.Method == http.MethodPost:
+		c.serveCreateBatch(w, r)
+	case len(id) != 0 && r.Method == http.MethodGet:
+		c.batchesMu.Lock()
+		b, ok := c.batches[id]
+		c.batchesMu.Unlock()
+		if !ok {
+			http.Error(w, "batch not found", http.StatusNotFound)
+			return
+		}
+		if !c.authorizeBatch(w, r, "get", b.namespaces) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b.snapshot())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveCreateBatch starts creating the clusters of the request and answers 202 with the status of the batch.
+// The request is rejected as a whole if any of its clusters is invalid.
+func (c *Controller) serveCreateBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid batch request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !c.authorizeBatch(w, r, "create", c.batchNamespaces(req)) {
+		return
+	}
+	b, err := c.newBatch(req)
+	if err == errTooManyBatches {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	go c.runBatch(b)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(b.snapshot())
+}
+
+// authorizeBatch answers 401 or 403, and returns false, unless the user of the request may verb the etcdclusters
+// of all the given namespaces.
+func (c *Controller) authorizeBatch(w http.ResponseWriter, r *http.Request, verb string, namespaces []string) bool {
+	err := c.reviewBatchAccess(r, verb, namespaces)
+	if err == nil {
+		return true
+	}
+	c.logger.Warningf("refused batch request from %s: %v", r.RemoteAddr, err)
+	if err == errUnauthorized {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	} else {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	}
+	return false
+}
+
+// reviewBatchAccess authenticates the bearer token of the request with a TokenReview and checks with a
+// SubjectAccessReview per namespace that its user may verb the etcdclusters of the namespace.
+func (c *Controller) reviewBatchAccess(r *http.Request, verb string, namespaces []string) error {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if len(token) == 0 || token == r.Header.Get("Authorization") {
+		return errUnauthorized
+	}
+	tr, err := c.Config.KubeCli.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to review token: %v", err)
+	}
+	if !tr.Status.Authenticated {
+		return errUnauthorized
+	}
+
+	u := tr.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range u.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	for _, ns := range namespaces {
+		sar, err := c.Config.KubeCli.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   u.Username,
+				Groups: u.Groups,
+				Extra:  extra,
+				UID:    u.UID,
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: ns,
+					Verb:      verb,
+					Group:     api.SchemeGroupVersion.Group,
+					Resource:  api.EtcdClusterResourcePlural,
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to review access: %v", err)
+		}
+		if !sar.Status.Allowed {
+			return fmt.Errorf("user (%s) may not %s etcdclusters in namespace %s", u.Username, verb, ns)
+		}
+	}
+	return nil
+}
+
+// batchNamespaces returns the sorted namespaces the clusters of the request are created in.
+func (c *Controller) batchNamespaces(req BatchRequest) []string {
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, cl := range req.Clusters {
+		ns := cl.Namespace
+		if len(ns) == 0 {
+			ns = c.Config.Namespace
+		}
+		if !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// newBatch validates the clusters of the request and records the batch.
+func (c *Controller) newBatch(req BatchRequest) (*batch, error) {
+	if len(req.Clusters) == 0 {
+		return nil, fmt.Errorf("invalid batch request: no clusters")
+	}
+	concurrency := req.Concurrency
+	switch {
+	case concurrency < 0:
+		return nil, fmt.Errorf("invalid batch request: negative concurrency %d", concurrency)
+	case concurrency == 0:
+		concurrency = defaultBatchConcurrency
+	case concurrency > maxBatchConcurrency:
+		concurrency = maxBatchConcurrency
+	}
+
+	b := &batch{namespaces: c.batchNamespaces(req), status: BatchStatus{
+		CreatedTime: time.Now().Format(time.RFC3339),
+		Concurrency: concurrency,
+		Total:       len(req.Clusters),
+		Pending:     len(req.Clusters),
+	}}
+	seen := map[string]bool{}
+	for i := range req.Clusters {
+		cl := req.Clusters[i].DeepCopy()
+		if len(cl.Name) == 0 {
+			return nil, fmt.Errorf("invalid cluster #%d: no name", i)
+		}
+		if len(cl.Namespace) == 0 {
+			cl.Namespace = c.Config.Namespace
+		}
+		if !c.Config.ClusterWide && cl.Namespace != c.Config.Namespace {
+			return nil, fmt.Errorf("invalid cluster (%s): the operator only manages the clusters of namespace %s", cl.Name, c.Config.Namespace)
+		}
+		if c.Config.ClusterWide {
+			if cl.Annotations == nil {
+				cl.Annotations = map[string]string{}
+			}
+			cl.Annotations[k8sutil.AnnotationScope] = k8sutil.AnnotationClusterWide
+		}
+		if err := cl.Spec.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid cluster (%s): %v", cl.Name, err)
+		}
+		key := cl.Namespace + "/" + cl.Name
+		if seen[key] {
+			return nil, fmt.Errorf("invalid batch request: cluster %s is listed twice", key)
+		}
+		seen[key] = true
+		cl.ResourceVersion = ""
+		cl.Status = api.ClusterStatus{}
+		b.clusters = append(b.clusters, cl)
+		b.status.Clusters = append(b.status.Clusters, BatchClusterStatus{Namespace: cl.Namespace, Name: cl.Name, State: BatchStatePending})
+	}
+
+	c.batchesMu.Lock()
+	defer c.batchesMu.Unlock()
+	if c.unfinishedBatches() >= maxUnfinishedBatches {
+		return nil, errTooManyBatches
+	}
+	c.batchSeq++
+	b.status.ID = strconv.Itoa(c.batchSeq)
+	c.batches[b.status.ID] = b
+	c.dropFinishedBatches()
+	return b, nil
+}
+
+// unfinishedBatches returns the number of batches whose clusters are still being created. batchesMu must be held.
+// As only finished batches are dropped, all of them are kept.
+func (c *Controller) unfinishedBatches() int {
+	n := 0
+	for _, b := range c.batches {
+		if !b.snapshot().Done {
+			n++
+		}
+	}
+	return n
+}
+
+// dropFinishedBatches drops the oldest finished batches beyond maxKeptBatches. batchesMu must be held.
+func (c *Controller) dropFinishedBatches() {
+	for seq := c.batchSeq - maxKeptBatches; seq > 0 && len(c.batches) > maxKeptBatches; seq-- {
+		id := strconv.Itoa(seq)
+		if b, ok := c.batches[id]; ok && b.snapshot().Done {
+			delete(c.batches, id)
+		}
+	}
+}
+
+// runBatch creates the clusters of the batch, at most its concurrency at once, and returns once all are done.
+func (c *Controller) runBatch(b *batch) {
+	id := b.snapshot().ID
+	c.logger.Infof("batch %s: creating %d clusters", id, len(b.clusters))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < b.snapshot().Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				c.createBatchCluster(b, i)
+			}
+		}()
+	}
+	for i := range b.clusters {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	s := b.snapshot()
+	c.logger.Infof("batch %s: done, %d of %d clusters running, %d failed", id, s.Running, s.Total, s.Failed)
+}
+
+// createBatchCluster creates the resource of the i-th cluster of the batch and waits for the cluster to be running.
+func (c *Controller) createBatchCluster(b *batch, i int) {
+	cl := b.clusters[i]
+	b.setState(i, BatchStateCreating, "")
+	cli := c.Config.EtcdCRCli.EtcdV1beta2().EtcdClusters(cl.Namespace)
+	if _, err := cli.Create(cl); err != nil {
+		b.setState(i, BatchStateFailed, fmt.Sprintf("failed to create cluster resource: %v", err))
+		return
+	}
+
+	deadline := time.Now().Add(batchClusterTimeout)
+	for {
+		got, err := cli.Get(cl.Name, metav1.GetOptions{})
+		switch {
+		case err != nil:
+			c.logger.Warningf("batch %s: failed to get cluster (%s): %v", b.snapshot().ID, cl.Name, err)
+		case got.Status.Phase == api.ClusterPhaseRunning:
+			b.setState(i, BatchStateRunning, "")
+			return
+		case got.Status.IsFailed():
+			b.setState(i, BatchStateFailed, got.Status.Reason)
+			return
+		}
+		if time.Now().After(deadline) {
+			b.setState(i, BatchStateFailed, fmt.Sprintf("not running after %v", batchClusterTimeout))
+			return
+		}
+		time.Sleep(batchPollInterval)
+	}
+}
+
+// setState moves the i-th cluster of the batch to the given state and updates the counts.
+func (b *batch) setState(i int, state, errMsg string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := &b.status
+	*s.count(s.Clusters[i].State)--
+	*s.count(state)++
+	s.Clusters[i].State = state
+	s.Clusters[i].Error = errMsg
+	s.Done = s.Running+s.Failed == s.Total
+}
+
+func (s *BatchStatus) count(state string) *int {
+	switch state {
+	case BatchStateCreating:
+		return &s.Creating
+	case BatchStateRunning:
+		return &s.Running
+	case BatchStateFailed:
+		return &s.Failed
+	default:
+		return &s.Pending
+	}
+}
+
+func (b *batch) snapshot() BatchStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.status
+	s.Clusters = append([]BatchClusterStatus(nil), b.status.Clusters...)
+	return s
+}
@@ -16,12 +16,14 @@ package controller
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/cluster"
 	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 
 	"github.com/sirupsen/logrus"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
@@ -40,7 +42,19 @@ type Controller struct {
 	logger *logrus.Entry
 	Config
 
-	clusters map[string]*cluster.Cluster
+	// clustersMu guards clusters against readers outside of the informer, e.g. the plan handler.
+	clustersMu sync.RWMutex
+	clusters   map[string]*cluster.Cluster
+	// usage is the namespace and size of the managed clusters, counted against the quota.
+	usage map[string]clusterUsage
+	// pods is the cache of the etcd pods the clusters read their pods from.
+	// It is nil until the controller runs.
+	pods *podCache
+
+	// batches are the batches of clusters created through the batch endpoints, by ID.
+	batchesMu sync.Mutex
+	batches   map[string]*batch
+	batchSeq  int
 }
 
 type Config struct {
@@ -51,6 +65,21 @@ type Config struct {
 	KubeExtCli     apiextensionsclient.Interface
 	EtcdCRCli      versioned.Interface
 	CreateCRD      bool
+	Notifier       *notifyutil.Notifier
+	// Hooks are told about the lifecycle events of the clusters.
+	Hooks notifyutil.Hooks
+	// MaxClustersPerNamespace and MaxMembersPerNamespace limit the clusters the operator manages
+	// in a namespace and the sum of their sizes. 0 is unlimited.
+	MaxClustersPerNamespace int
+	MaxMembersPerNamespace  int
+	// OrphanSweepInterval is how often objects of clusters whose resource no longer exists are deleted.
+	// 0 disables the sweep. In OrphanSweepDryRun, the orphans are only reported.
+	OrphanSweepInterval time.Duration
+	OrphanSweepDryRun   bool
+	// FleetStatusInterval is how often the fleet status ConfigMap is updated. 0 disables it.
+	FleetStatusInterval time.Duration
+	// Timeouts are the timeouts of the operations on the members of the clusters that do not override them.
+	Timeouts cluster.Timeouts
 }
 
 func New(cfg Config) *Controller {
@@ -59,6 +88,8 @@ func New(cfg Config) *Controller {
 
 		Config:   cfg,
 		clusters: make(map[string]*cluster.Cluster),
+		usage:    make(map[string]clusterUsage),
+		batches:  make(map[string]*batch),
 	}
 }
 
@@ -66,14 +97,35 @@ func New(cfg Config) *Controller {
 func (c *Controller) handleClusterEvent(event *Event) (bool, error) {
 	clus := event.Object
 
+	c.clustersMu.Lock()
+	defer c.clustersMu.Unlock()
+
 	if !c.managed(clus) {
 		return true, nil
 	}
+	if err := c.checkSchemaVersion(clus); err != nil {
+		return false, err
+	}
 
 	if clus.Status.IsFailed() {
 		clustersFailed.Inc()
 		if event.Type == kwatch.Deleted {
 			delete(c.clusters, clus.Name)
+			delete(c.usage, clus.Name)
+			return false, nil
+		}
+		if clus.DeletionTimestamp != nil {
+			// A failed cluster is not run: its deletion policy is applied here, without a final snapshot.
+			st, err := cluster.TearDown(c.Config.KubeCli, c.Config.EtcdCRCli, clus)
+			if st != nil && st.Completed < st.Total {
+				clus.Status.TearDown = st
+				if _, err := c.Config.EtcdCRCli.EtcdV1beta2().EtcdClusters(clus.Namespace).Update(clus); err != nil {
+					c.logger.Warningf("failed to update the tear down progress of failed cluster (%s): %v", clus.Name, err)
+				}
+			}
+			if err != nil {
+				return false, fmt.Errorf("failed to tear down failed cluster (%s): %v", clus.Name, err)
+			}
 			return false, nil
 		}
 		return false, fmt.Errorf("ignore failed cluster (%s). Please delete its CR", clus.Name)
@@ -81,9 +133,14 @@ func (c *Controller) handleClusterEvent(event *Event) (bool, error) {
 
 	clus.SetDefaults()
 
-	if err := clus.Spec.Validate(); err != nil {
+	if err := k8sutil.ValidateClusterSpec(clus.Name, clus.Spec); err != nil {
 		return false, fmt.Errorf("invalid cluster spec. please fix the following problem with the cluster spec: %v", err)
 	}
+	if event.Type != kwatch.Deleted {
+		if err := c.checkQuota(clus); err != nil {
+			return false, err
+		}
+	}
 
 	switch event.Type {
 	case kwatch.Added:
@@ -94,6 +151,7 @@ func (c *Controller) handleClusterEvent(event *Event) (bool, error) {
 		nc := cluster.New(c.makeClusterConfig(), clus)
 
 		c.clusters[clus.Name] = nc
+		c.usage[clus.Name] = newClusterUsage(clus)
 
 		clustersCreated.Inc()
 		clustersTotal.Inc()
@@ -103,6 +161,7 @@ func (c *Controller) handleClusterEvent(event *Event) (bool, error) {
 			return false, fmt.Errorf("unsafe state. cluster (%s) was never created but we received event (%s)", clus.Name, event.Type)
 		}
 		c.clusters[clus.Name].Update(clus)
+		c.usage[clus.Name] = newClusterUsage(clus)
 		clustersModified.Inc()
 
 	case kwatch.Deleted:
@@ -111,6 +170,7 @@ func (c *Controller) handleClusterEvent(event *Event) (bool, error) {
 		}
 		c.clusters[clus.Name].Delete()
 		delete(c.clusters, clus.Name)
+		delete(c.usage, clus.Name)
 		clustersDeleted.Inc()
 		clustersTotal.Dec()
 	}
@@ -118,11 +178,29 @@ func (c *Controller) handleClusterEvent(event *Event) (bool, error) {
 }
 
 func (c *Controller) makeClusterConfig() cluster.Config {
-	return cluster.Config{
+	cfg := cluster.Config{
 		ServiceAccount: c.Config.ServiceAccount,
 		KubeCli:        c.Config.KubeCli,
 		EtcdCRCli:      c.Config.EtcdCRCli,
+		Notifier:       c.Config.Notifier,
+		Hooks:          c.Config.Hooks,
+		Timeouts:       c.Config.Timeouts,
+	}
+	if c.pods != nil {
+		cfg.Pods = c.pods
 	}
+	return cfg
+}
+
+var clusterPrinterColumns = []k8sutil.PrinterColumn{
+	{Name: "Size", Type: "integer", JSONPath: ".spec.size", Description: "The desired number of members"},
+	{Name: "Ready", Type: "integer", JSONPath: ".status.readyMembers", Description: "The number of members ready to serve requests"},
+	{Name: "Version", Type: "string", JSONPath: ".status.currentVersion", Description: "The etcd version the cluster runs"},
+	{Name: "Phase", Type: "string", JSONPath: ".status.phase"},
+	{Name: "Last Backup", Type: "date", JSONPath: ".status.lastBackupTime", Description: "The time of the last successful backup"},
+	{Name: "Members", Type: "integer", JSONPath: ".status.size", Description: "The number of members", Priority: 1},
+	{Name: "Reconcile Error", Type: "string", JSONPath: ".status.lastReconcileError", Description: "The error of the last reconciliation, if it failed", Priority: 1},
+	{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
 }
 
 func (c *Controller) initCRD() error {
@@ -130,5 +208,8 @@ func (c *Controller) initCRD() error {
 	if err != nil {
 		return fmt.Errorf("failed to create CRD: %v", err)
 	}
+	if err := k8sutil.SetCRDPrinterColumns(c.KubeExtCli, api.EtcdClusterCRDName, clusterPrinterColumns); err != nil {
+		return fmt.Errorf("failed to set CRD printer columns: %v", err)
+	}
 	return k8sutil.WaitCRDReady(c.KubeExtCli, api.EtcdClusterCRDName)
 }
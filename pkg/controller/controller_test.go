@@ -15,13 +15,26 @@
 package controller
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/cluster"
+	fakeetcd "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned/fake"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestHandleClusterEventUpdateFailedCluster(t *testing.T) {
@@ -129,3 +142,364 @@ func TestHandleClusterEventNamespacedIgnored(t *testing.T) {
 		t.Errorf("cluster should be ignored")
 	}
 }
+
+func TestCheckQuota(t *testing.T) {
+	c := New(Config{KubeCli: fake.NewSimpleClientset(), MaxClustersPerNamespace: 2, MaxMembersPerNamespace: 6})
+	c.usage["a"] = clusterUsage{namespace: "team-a", members: 3}
+	c.usage["b"] = clusterUsage{namespace: "team-b", members: 5}
+
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{name: "c", size: 3},
+		{name: "c", size: 5, wantErr: true},
+		// an update of a cluster is not counted twice.
+		{name: "a", size: 6},
+	}
+	for i, tt := range tests {
+		clus := &api.EtcdCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: tt.name, Namespace: "team-a"},
+			Spec:       api.ClusterSpec{Size: tt.size},
+		}
+		if err := c.checkQuota(clus); (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error=%v, get %v", i, tt.wantErr, err)
+		}
+	}
+
+	c.usage["c"] = clusterUsage{namespace: "team-a", members: 1}
+	clus := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "d", Namespace: "team-a"},
+		Spec:       api.ClusterSpec{Size: 1},
+	}
+	if err := c.checkQuota(clus); err == nil {
+		t.Error("expect a third cluster in the namespace to be rejected")
+	}
+}
+
+func TestHandleClusterEventNewerSchema(t *testing.T) {
+	c := New(Config{KubeCli: fake.NewSimpleClientset()})
+
+	clus := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Status:     api.ClusterStatus{SchemaVersion: api.SchemaVersion + 1},
+	}
+	for _, typ := range []watch.EventType{watch.Added, watch.Modified, watch.Deleted} {
+		if _, err := c.handleClusterEvent(&Event{Type: typ, Object: clus}); err == nil {
+			t.Errorf("%s: expect the cluster of a newer schema version to be ignored", typ)
+		}
+	}
+	if _, ok := c.clusters["test"]; ok {
+		t.Error("expect the cluster of a newer schema version not to be managed")
+	}
+
+	events, err := c.Config.KubeCli.CoreV1().Events("").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) == 0 || events.Items[0].Reason != "Newer Schema" {
+		t.Errorf("expect a newer schema event, get %v", events.Items)
+	}
+}
+
+func TestSweepOrphans(t *testing.T) {
+	newPod := func(name, clusterName string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceDefault,
+			Labels:    k8sutil.LabelsForCluster(clusterName),
+		}}
+	}
+	kubecli := fake.NewSimpleClientset(newPod("live-0000", "live"), newPod("gone-0000", "gone"))
+	etcdCRCli := fakeetcd.NewSimpleClientset(&api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: metav1.NamespaceDefault},
+	})
+	c := New(Config{Namespace: metav1.NamespaceDefault, KubeCli: kubecli, EtcdCRCli: etcdCRCli, OrphanSweepDryRun: true})
+
+	if err := c.sweepOrphans(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubecli.CoreV1().Pods(metav1.NamespaceDefault).Get("gone-0000", metav1.GetOptions{}); err != nil {
+		t.Errorf("expect dry run to keep the orphaned pod, get %v", err)
+	}
+
+	c.Config.OrphanSweepDryRun = false
+	if err := c.sweepOrphans(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubecli.CoreV1().Pods(metav1.NamespaceDefault).Get("gone-0000", metav1.GetOptions{}); !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		t.Errorf("expect the orphaned pod to be deleted, get %v", err)
+	}
+	if _, err := kubecli.CoreV1().Pods(metav1.NamespaceDefault).Get("live-0000", metav1.GetOptions{}); err != nil {
+		t.Errorf("expect the pod of a live cluster to be kept, get %v", err)
+	}
+}
+
+func TestPodCacheClusterPods(t *testing.T) {
+	pc := newPodCache(fake.NewSimpleClientset(), metav1.NamespaceAll)
+	for _, p := range []struct{ name, ns, clusterName string }{
+		{"a-0000", "default", "a"},
+		{"a-0001", "default", "a"},
+		{"b-0000", "default", "b"},
+		{"a-0000", "other", "a"},
+	} {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: p.name, Namespace: p.ns, Labels: k8sutil.LabelsForCluster(p.clusterName)}}
+		if err := pc.informer.GetIndexer().Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pods, err := pc.ClusterPods("default", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := k8sutil.GetPodNames(pods); len(names) != 2 {
+		t.Errorf("expect the 2 pods of default/a, get %v", names)
+	}
+	for _, pod := range pods {
+		if pod.Namespace != "default" || pod.Labels["etcd_cluster"] != "a" {
+			t.Errorf("unexpected pod %s/%s", pod.Namespace, pod.Name)
+		}
+	}
+}
+
+func TestClusterSummaries(t *testing.T) {
+	etcdCRCli := fakeetcd.NewSimpleClientset(&api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: metav1.NamespaceDefault},
+		Spec:       api.ClusterSpec{Size: 3, Version: "3.3.13"},
+		Status: api.ClusterStatus{
+			Phase:          api.ClusterPhaseRunning,
+			Size:           3,
+			CurrentVersion: "3.2.13",
+			Conditions: []api.ClusterCondition{
+				{Type: api.ClusterConditionUpgrading, Status: v1.ConditionTrue, Message: "upgrading to 3.3.13"},
+				{Type: api.ClusterConditionMemberFailed, Status: v1.ConditionTrue, Message: "member b-0000 failed: disk full"},
+			},
+		},
+	}, &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: metav1.NamespaceDefault},
+	}, &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "clusterwide",
+			Namespace:   metav1.NamespaceDefault,
+			Annotations: map[string]string{k8sutil.AnnotationScope: k8sutil.AnnotationClusterWide},
+		},
+	})
+	c := New(Config{Namespace: metav1.NamespaceDefault, EtcdCRCli: etcdCRCli})
+
+	summaries, err := c.clusterSummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 || summaries[0].Name != "a" || summaries[1].Name != "b" {
+		t.Fatalf("expect the summaries of clusters a and b, get %v", summaries)
+	}
+	s := summaries[1]
+	if len(s.Operations) != 1 || !strings.HasPrefix(s.Operations[0], "Upgrading") {
+		t.Errorf("expect the upgrade as operation, get %v", s.Operations)
+	}
+	if len(s.Problems) != 1 || !strings.HasPrefix(s.Problems[0], "MemberFailed") {
+		t.Errorf("expect the failed member as problem, get %v", s.Problems)
+	}
+}
+
+func TestUpdateFleetStatus(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	etcdCRCli := fakeetcd.NewSimpleClientset(&api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: metav1.NamespaceDefault},
+		Status:     api.ClusterStatus{Phase: api.ClusterPhaseRunning, Ready: true},
+	}, &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: metav1.NamespaceDefault},
+		Status: api.ClusterStatus{
+			Phase: api.ClusterPhaseRunning,
+			Conditions: []api.ClusterCondition{
+				{Type: api.ClusterConditionInterventionRequired, Status: v1.ConditionTrue, Reason: "QuorumLost"},
+			},
+		},
+	}, &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: metav1.NamespaceDefault},
+		Status:     api.ClusterStatus{Phase: api.ClusterPhaseFailed},
+	}, &api.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-backup", Namespace: metav1.NamespaceDefault},
+		Status:     api.BackupStatus{Succeeded: true, Reason: "failed to save snapshot"},
+	}, &api.EtcdBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "b-backup", Namespace: metav1.NamespaceDefault},
+		Status:     api.BackupStatus{Succeeded: true},
+	})
+	c := New(Config{Namespace: metav1.NamespaceDefault, KubeCli: kubecli, EtcdCRCli: etcdCRCli})
+
+	if err := c.updateFleetStatus(); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := kubecli.CoreV1().ConfigMaps(metav1.NamespaceDefault).Get(FleetStatusName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		FleetStatusKeyClusters:             "3",
+		FleetStatusKeyReady:                "1",
+		FleetStatusKeyFailed:               "1",
+		FleetStatusKeyInterventionRequired: "1",
+		FleetStatusKeyFailingBackups:       "1",
+	} {
+		if cm.Data[k] != v {
+			t.Errorf("expect %s to be %s, get %q", k, v, cm.Data[k])
+		}
+	}
+	var fs FleetStatus
+	if err := json.Unmarshal([]byte(cm.Data[FleetStatusKeyJSON]), &fs); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Phases[api.ClusterPhaseRunning] != 2 || fs.Phases[api.ClusterPhaseFailed] != 1 {
+		t.Errorf("expect 2 running and 1 failed clusters, get %v", fs.Phases)
+	}
+	if len(fs.InterventionRequired) != 1 || fs.InterventionRequired[0] != "default/b" {
+		t.Errorf("expect default/b to require intervention, get %v", fs.InterventionRequired)
+	}
+	if len(fs.FailingBackups) != 1 || fs.FailingBackups[0] != "default/a-backup" {
+		t.Errorf("expect default/a-backup to fail, get %v", fs.FailingBackups)
+	}
+}
+
+func TestNewBatch(t *testing.T) {
+	c := New(Config{Namespace: metav1.NamespaceDefault})
+	newCluster := func(ns, name string) api.EtcdCluster {
+		return api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}, Spec: api.ClusterSpec{Size: 3}}
+	}
+
+	tests := []struct {
+		req     BatchRequest
+		wantErr bool
+	}{
+		{req: BatchRequest{}, wantErr: true},
+		{req: BatchRequest{Clusters: []api.EtcdCluster{newCluster("", "a"), newCluster(metav1.NamespaceDefault, "b")}}},
+		{req: BatchRequest{Clusters: []api.EtcdCluster{newCluster("", "")}}, wantErr: true},
+		{req: BatchRequest{Clusters: []api.EtcdCluster{newCluster("other", "a")}}, wantErr: true},
+		{req: BatchRequest{Clusters: []api.EtcdCluster{newCluster("", "a"), newCluster(metav1.NamespaceDefault, "a")}}, wantErr: true},
+		{req: BatchRequest{Clusters: []api.EtcdCluster{newCluster("", "a")}, Concurrency: -1}, wantErr: true},
+	}
+	for i, tt := range tests {
+		if _, err := c.newBatch(tt.req); (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error=%v, get %v", i, tt.wantErr, err)
+		}
+	}
+
+	b, err := c.newBatch(BatchRequest{Clusters: []api.EtcdCluster{newCluster("", "a")}, Concurrency: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := b.snapshot(); s.Concurrency != maxBatchConcurrency || s.Pending != 1 || s.Clusters[0].Namespace != metav1.NamespaceDefault {
+		t.Errorf("unexpected batch status %+v", s)
+	}
+}
+
+func TestNewBatchLimitsUnfinishedBatches(t *testing.T) {
+	c := New(Config{Namespace: metav1.NamespaceDefault})
+	req := BatchRequest{Clusters: []api.EtcdCluster{{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Spec: api.ClusterSpec{Size: 3}}}}
+	var first *batch
+	for i := 0; i < maxUnfinishedBatches; i++ {
+		b, err := c.newBatch(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = b
+		}
+	}
+	if _, err := c.newBatch(req); err != errTooManyBatches {
+		t.Fatalf("expect err=%v, get %v", errTooManyBatches, err)
+	}
+
+	first.setState(0, BatchStateRunning, "")
+	if _, err := c.newBatch(req); err != nil {
+		t.Errorf("expect a batch to be accepted once another is done, get %v", err)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	defer func(d time.Duration) { batchPollInterval = d }(batchPollInterval)
+	batchPollInterval = time.Millisecond
+
+	etcdCRCli := fakeetcd.NewSimpleClientset(&api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "exists", Namespace: metav1.NamespaceDefault},
+	})
+	// The clusters run as soon as they are created.
+	etcdCRCli.PrependReactor("create", "etcdclusters", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*api.EtcdCluster).Status.Phase = api.ClusterPhaseRunning
+		return false, nil, nil
+	})
+	c := New(Config{Namespace: metav1.NamespaceDefault, EtcdCRCli: etcdCRCli})
+
+	var clusters []api.EtcdCluster
+	for _, name := range []string{"a", "b", "exists", "c"} {
+		clusters = append(clusters, api.EtcdCluster{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: api.ClusterSpec{Size: 1}})
+	}
+	b, err := c.newBatch(BatchRequest{Clusters: clusters, Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.runBatch(b)
+
+	s := b.snapshot()
+	if !s.Done || s.Running != 3 || s.Failed != 1 || s.Pending != 0 || s.Creating != 0 {
+		t.Fatalf("expect 3 clusters running and 1 failed, get %+v", s)
+	}
+	if s.Clusters[2].State != BatchStateFailed || len(s.Clusters[2].Error) == 0 {
+		t.Errorf("expect the existing cluster to fail, get %+v", s.Clusters[2])
+	}
+}
+
+func TestServeBatchAuthorization(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	kubecli.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tr := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		tr.Status = authenticationv1.TokenReviewStatus{Authenticated: tr.Spec.Token == "valid", User: authenticationv1.UserInfo{Username: "tenant"}}
+		return true, tr, nil
+	})
+	// The user may only create the etcdclusters of the default namespace.
+	kubecli.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		ra := sar.Spec.ResourceAttributes
+		sar.Status.Allowed = ra.Namespace == metav1.NamespaceDefault && ra.Verb == "create" && ra.Resource == api.EtcdClusterResourcePlural
+		return true, sar, nil
+	})
+	c := New(Config{Namespace: metav1.NamespaceDefault, KubeCli: kubecli, ClusterWide: true})
+
+	tests := []struct {
+		token     string
+		namespace string
+		want      int
+	}{
+		{token: "", want: http.StatusUnauthorized},
+		{token: "invalid", want: http.StatusUnauthorized},
+		{token: "valid", namespace: "other", want: http.StatusForbidden},
+	}
+	for i, tt := range tests {
+		body := `{"clusters": [{"metadata": {"name": "a"}, "spec": {"size": 3}}, {"metadata": {"name": "b", "namespace": "` + tt.namespace + `"}, "spec": {"size": 3}}]}`
+		req := httptest.NewRequest(http.MethodPost, BatchPath, strings.NewReader(body))
+		if len(tt.token) != 0 {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		c.ServeBatch(w, req)
+		if w.Code != tt.want {
+			t.Errorf("#%d: expect status %d, get %d", i, tt.want, w.Code)
+		}
+	}
+	if len(c.batches) != 0 {
+		t.Errorf("expect no batch to be created, get %d", len(c.batches))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, BatchPath+"/1", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	b, err := c.newBatch(BatchRequest{Clusters: []api.EtcdCluster{{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Spec: api.ClusterSpec{Size: 3}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	c.ServeBatch(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expect the status of batch %s to be forbidden without get access, get %d", b.snapshot().ID, w.Code)
+	}
+}
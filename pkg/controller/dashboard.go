@@ -0,0 +1,192 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DashboardPath is the path of the dashboard of the clusters the operator manages, GET /dashboard.
+// It is served as HTML, or as JSON with ?format=json or an Accept header of application/json.
+const DashboardPath = "/dashboard"
+
+// ClusterSummary is the state of a cluster on the dashboard, as recorded in its status.
+type ClusterSummary struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Phase     string `json:"phase"`
+	Ready     bool   `json:"ready"`
+	// Version is the version the members run, and TargetVersion the version of the spec.
+	Version       string `json:"version"`
+	TargetVersion string `json:"targetVersion"`
+	Size          int    `json:"size"`
+	DesiredSize   int    `json:"desiredSize"`
+	Leader        string `json:"leader,omitempty"`
+	// LastBackupTime is the time, in RFC3339, of the last successful backup, if any.
+	LastBackupTime string `json:"lastBackupTime,omitempty"`
+	// Operations are the operations in progress, e.g. an upgrade or a CA rotation.
+	Operations []string `json:"operations,omitempty"`
+	// Problems are the problems reported by the conditions and the last reconciliation.
+	Problems []string `json:"problems,omitempty"`
+	// OperatorVersion is the version of the etcd operator that manages the cluster.
+	OperatorVersion string `json:"operatorVersion,omitempty"`
+}
+
+// ServeDashboard serves a summary of every cluster the operator manages, for a quick look at the fleet.
+func (c *Controller) ServeDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	summaries, err := c.clusterSummaries()
+	if err != nil {
+		c.logger.Errorf("failed to list clusters for the dashboard: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summaries)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, summaries); err != nil {
+		c.logger.Errorf("failed to render the dashboard: %v", err)
+	}
+}
+
+// clusterSummaries returns the summaries of the managed clusters, sorted by namespace and name.
+func (c *Controller) clusterSummaries() ([]ClusterSummary, error) {
+	ns := c.Config.Namespace
+	if c.Config.ClusterWide {
+		ns = metav1.NamespaceAll
+	}
+	list, err := c.Config.EtcdCRCli.EtcdV1beta2().EtcdClusters(ns).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summaries := []ClusterSummary{}
+	for i := range list.Items {
+		if clus := &list.Items[i]; c.managed(clus) {
+			summaries = append(summaries, summarizeCluster(clus))
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Namespace != summaries[j].Namespace {
+			return summaries[i].Namespace < summaries[j].Namespace
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries, nil
+}
+
+func summarizeCluster(clus *api.EtcdCluster) ClusterSummary {
+	st := clus.Status
+	s := ClusterSummary{
+		Namespace:      clus.Namespace,
+		Name:           clus.Name,
+		Phase:          string(st.Phase),
+		Ready:          st.Ready,
+		Version:        st.CurrentVersion,
+		TargetVersion:  clus.Spec.Version,
+		Size:           st.Size,
+		DesiredSize:    clus.Spec.Size,
+		Leader:         st.Leader,
+		LastBackupTime: st.LastBackupTime,
+
+		OperatorVersion: st.OperatorVersion,
+	}
+	if clus.Spec.Paused {
+		s.Operations = append(s.Operations, "paused")
+	}
+	for _, cond := range st.Conditions {
+		if cond.Status != v1.ConditionTrue {
+			if cond.Type == api.ClusterConditionUpgrading && len(cond.Message) != 0 {
+				// An upgrade refused by its preflight.
+				s.Problems = append(s.Problems, fmt.Sprintf("%s: %s", cond.Type, cond.Message))
+			}
+			continue
+		}
+		switch cond.Type {
+		case api.ClusterConditionRecovering, api.ClusterConditionScaling, api.ClusterConditionUpgrading:
+			s.Operations = append(s.Operations, conditionText(cond))
+		case api.ClusterConditionDegraded, api.ClusterConditionRepairPaused, api.ClusterConditionThresholdExceeded, api.ClusterConditionMemberFailed,
+			api.ClusterConditionPodCreationFailed, api.ClusterConditionInterventionRequired:
+			s.Problems = append(s.Problems, conditionText(cond))
+		}
+	}
+	if r := st.CARotation; r != nil && r.Phase != api.CARotationCompleted {
+		s.Operations = append(s.Operations, fmt.Sprintf("CA rotation: %s", r.Phase))
+	}
+	if len(st.LastReconcileError) != 0 {
+		s.Problems = append(s.Problems, fmt.Sprintf("reconcile failed: %s", st.LastReconcileError))
+	}
+	if st.IsFailed() && len(st.Reason) != 0 {
+		s.Problems = append(s.Problems, fmt.Sprintf("failed: %s", st.Reason))
+	}
+	return s
+}
+
+func conditionText(cond api.ClusterCondition) string {
+	if len(cond.Message) == 0 {
+		return string(cond.Type)
+	}
+	return fmt.Sprintf("%s: %s", cond.Type, cond.Message)
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>etcd clusters</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.ready { color: green; }
+.unready { color: red; }
+</style>
+</head>
+<body>
+<h1>etcd clusters</h1>
+<table>
+<tr><th>Namespace</th><th>Name</th><th>Phase</th><th>Ready</th><th>Version</th><th>Size</th><th>Leader</th><th>Last backup</th><th>Operations</th><th>Problems</th><th>Operator</th></tr>
+{{range .}}<tr>
+<td>{{.Namespace}}</td>
+<td>{{.Name}}</td>
+<td>{{.Phase}}</td>
+<td>{{if .Ready}}<span class="ready">yes</span>{{else}}<span class="unready">no</span>{{end}}</td>
+<td>{{.Version}}{{if ne .Version .TargetVersion}} &rarr; {{.TargetVersion}}{{end}}</td>
+<td>{{.Size}}/{{.DesiredSize}}</td>
+<td>{{.Leader}}</td>
+<td>{{if .LastBackupTime}}{{.LastBackupTime}}{{else}}never{{end}}</td>
+<td>{{range .Operations}}{{.}}<br>{{end}}</td>
+<td>{{range .Problems}}{{.}}<br>{{end}}</td>
+<td>{{.OperatorVersion}}</td>
+</tr>
+{{else}}<tr><td colspan="11">No clusters</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,152 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FleetStatusName is the name of the ConfigMap, in the namespace of the operator, with the status of the fleet.
+const FleetStatusName = "etcd-operator-status"
+
+// Keys of the fleet status ConfigMap. The counts are decimal, for scripts that read a single key.
+const (
+	FleetStatusKeyJSON                 = "status.json"
+	FleetStatusKeyClusters             = "clusters"
+	FleetStatusKeyReady                = "ready"
+	FleetStatusKeyFailed               = "failed"
+	FleetStatusKeyInterventionRequired = "interventionRequired"
+	FleetStatusKeyFailingBackups       = "failingBackups"
+)
+
+// FleetStatus is the status of all the clusters the operator manages, and of their backups.
+// Clusters and backups are named <namespace>/<name>, in order.
+type FleetStatus struct {
+	Clusters int `json:"clusters"`
+	Ready    int `json:"ready"`
+	// Phases counts the clusters by phase. A cluster the operator has not picked up yet is Pending.
+	Phases map[api.ClusterPhase]int `json:"phases"`
+	Failed []string                 `json:"failed"`
+	// InterventionRequired are the clusters with the InterventionRequired condition.
+	InterventionRequired []string `json:"interventionRequired"`
+	// FailingBackups are the EtcdBackups whose last snapshot failed or could not be verified.
+	FailingBackups []string `json:"failingBackups"`
+}
+
+// updateFleetStatusPeriodically updates the fleet status every interval until the operator exits.
+func (c *Controller) updateFleetStatusPeriodically(interval time.Duration) {
+	for {
+		if err := c.updateFleetStatus(); err != nil {
+			c.logger.Warningf("failed to update the fleet status: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// updateFleetStatus writes the fleet status to its ConfigMap.
+func (c *Controller) updateFleetStatus() error {
+	fs, err := c.fleetStatus()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(fs)
+	if err != nil {
+		return err
+	}
+	return k8sutil.ApplyConfigMap(c.Config.KubeCli, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      FleetStatusName,
+			Namespace: c.Config.Namespace,
+		},
+		Data: map[string]string{
+			FleetStatusKeyJSON:                 string(b),
+			FleetStatusKeyClusters:             strconv.Itoa(fs.Clusters),
+			FleetStatusKeyReady:                strconv.Itoa(fs.Ready),
+			FleetStatusKeyFailed:               strconv.Itoa(len(fs.Failed)),
+			FleetStatusKeyInterventionRequired: strconv.Itoa(len(fs.InterventionRequired)),
+			FleetStatusKeyFailingBackups:       strconv.Itoa(len(fs.FailingBackups)),
+		},
+	})
+}
+
+// fleetStatus aggregates the status of the managed clusters, and of the backups in the namespaces the operator watches.
+func (c *Controller) fleetStatus() (*FleetStatus, error) {
+	ns := c.Config.Namespace
+	if c.Config.ClusterWide {
+		ns = metav1.NamespaceAll
+	}
+	fs := &FleetStatus{
+		Phases:               map[api.ClusterPhase]int{},
+		Failed:               []string{},
+		InterventionRequired: []string{},
+		FailingBackups:       []string{},
+	}
+
+	clusters, err := c.Config.EtcdCRCli.EtcdV1beta2().EtcdClusters(ns).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range clusters.Items {
+		clus := &clusters.Items[i]
+		if !c.managed(clus) {
+			continue
+		}
+		name := clus.Namespace + "/" + clus.Name
+		fs.Clusters++
+		if clus.Status.Ready {
+			fs.Ready++
+		}
+		phase := clus.Status.Phase
+		if phase == api.ClusterPhaseNone {
+			phase = api.ClusterPhasePending
+		}
+		fs.Phases[phase]++
+		if clus.Status.IsFailed() {
+			fs.Failed = append(fs.Failed, name)
+		}
+		for _, cond := range clus.Status.Conditions {
+			if cond.Type == api.ClusterConditionInterventionRequired && cond.Status == v1.ConditionTrue {
+				fs.InterventionRequired = append(fs.InterventionRequired, name)
+			}
+		}
+	}
+
+	backups, err := c.Config.EtcdCRCli.EtcdV1beta2().EtcdBackups(ns).List(metav1.ListOptions{})
+	// The EtcdBackup CRD does not exist when the backup operator is not installed.
+	if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+		return nil, err
+	}
+	if err == nil {
+		for _, eb := range backups.Items {
+			if len(eb.Status.Reason) != 0 || len(eb.Status.VerificationReason) != 0 {
+				fs.FailingBackups = append(fs.FailingBackups, eb.Namespace+"/"+eb.Name)
+			}
+		}
+	}
+
+	sort.Strings(fs.Failed)
+	sort.Strings(fs.InterventionRequired)
+	sort.Strings(fs.FailingBackups)
+	return fs, nil
+}
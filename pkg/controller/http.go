@@ -0,0 +1,117 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/cluster"
+)
+
+// ClusterPathPrefix is the prefix of the per cluster endpoints, GET /clusters/{name}/plan,
+// GET /clusters/{name}/state, GET /clusters/{name}/pod?member={member} and GET /clusters/{name}/readyz.
+const ClusterPathPrefix = "/clusters/"
+
+// ServeCluster serves the per cluster endpoints.
+func (c *Controller) ServeCluster(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, ClusterPathPrefix)
+	i := strings.LastIndex(p, "/")
+	if i == -1 {
+		http.NotFound(w, r)
+		return
+	}
+	name, endpoint := p[:i], p[i+1:]
+	if endpoint != "plan" && endpoint != "state" && endpoint != "pod" && endpoint != "readyz" {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.clustersMu.RLock()
+	cl, ok := c.clusters[name]
+	c.clustersMu.RUnlock()
+	if len(name) == 0 || strings.Contains(name, "/") || !ok {
+		http.Error(w, "cluster not found", http.StatusNotFound)
+		return
+	}
+
+	switch endpoint {
+	case "readyz":
+		serveReadyz(w, cl)
+	case "state":
+		c.serveState(w, name, cl)
+	case "pod":
+		c.servePod(w, name, r.URL.Query().Get("member"), cl)
+	default:
+		c.servePlan(w, name, cl)
+	}
+}
+
+// servePlan returns as JSON the actions the operator would take right now to reconcile
+// the cluster to its spec. The cluster is not changed; this also works while it is paused.
+func (c *Controller) servePlan(w http.ResponseWriter, name string, cl *cluster.Cluster) {
+	p, err := cl.Plan()
+	if err != nil {
+		c.logger.Errorf("failed to compute plan of cluster (%s): %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// serveState returns as JSON the members the operator knows, the pods and the membership listed by etcd,
+// and how they differ. The cluster is not changed; this also works while it is paused.
+func (c *Controller) serveState(w http.ResponseWriter, name string, cl *cluster.Cluster) {
+	s, err := cl.State()
+	if err != nil {
+		c.logger.Errorf("failed to take state of cluster (%s): %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// servePod returns as JSON the pod the operator would create for the member with the current spec of the cluster,
+// or for the next member added to the cluster if member is empty. Nothing is created.
+func (c *Controller) servePod(w http.ResponseWriter, name, member string, cl *cluster.Cluster) {
+	pod, err := cl.RenderPod(member)
+	if err == cluster.ErrMemberNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("failed to render pod of cluster (%s): %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pod)
+}
+
+// serveReadyz answers 200 if the cluster is ready and 503 otherwise, for load balancer health checks.
+func serveReadyz(w http.ResponseWriter, cl *cluster.Cluster) {
+	if !cl.Ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
@@ -49,6 +49,12 @@ func (c *Controller) Start() error {
 	}
 
 	probe.SetReady()
+	if c.Config.OrphanSweepInterval > 0 {
+		go c.sweepOrphansPeriodically(c.Config.OrphanSweepInterval)
+	}
+	if c.Config.FleetStatusInterval > 0 {
+		go c.updateFleetStatusPeriodically(c.Config.FleetStatusInterval)
+	}
 	c.run()
 	panic("unreachable")
 }
@@ -61,6 +67,13 @@ func (c *Controller) run() {
 		ns = c.Config.Namespace
 	}
 
+	stopCh := make(chan struct{})
+	c.pods = newPodCache(c.Config.KubeCli, ns)
+	go c.pods.run(stopCh)
+	// The clusters read their pods from the cache as soon as they are created.
+	// stopCh is never closed, like the stop channel of the cluster informer: this waits until the cache is synced.
+	cache.WaitForCacheSync(stopCh, c.pods.hasSynced)
+
 	source := cache.NewListWatchFromClient(
 		c.Config.EtcdCRCli.EtcdV1beta2().RESTClient(),
 		api.EtcdClusterResourcePlural,
@@ -93,7 +106,13 @@ func (c *Controller) onAddEtcdClus(obj interface{}) {
 }
 
 func (c *Controller) onUpdateEtcdClus(oldObj, newObj interface{}) {
-	c.syncEtcdClus(newObj.(*api.EtcdCluster))
+	oldClus, newClus := oldObj.(*api.EtcdCluster), newObj.(*api.EtcdCluster)
+	// A re-list of the watch gives an update event for each cluster, changed or not.
+	// A cluster that was not added, e.g. over quota, is tried again.
+	if _, ok := c.clusters[newClus.Name]; ok && oldClus.ResourceVersion == newClus.ResourceVersion {
+		return
+	}
+	c.syncEtcdClus(newClus)
 }
 
 func (c *Controller) onDeleteEtcdClus(obj interface{}) {
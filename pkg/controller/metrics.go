@@ -14,7 +14,11 @@
 
 package controller
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 var (
 	clustersTotal = prometheus.NewGauge(prometheus.GaugeOpts{
@@ -51,6 +55,39 @@ var (
 		Name:      "clusters_failed",
 		Help:      "Total number of clusters failed",
 	})
+
+	orphansFound = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd_operator",
+		Subsystem: "controller",
+		Name:      "orphans",
+		Help:      "Number of objects found by the last orphan sweep that belong to no cluster, deleted unless in dry run",
+	}, []string{"Kind"})
+
+	kubeAPIDegraded = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "etcd_operator",
+		Subsystem: "controller",
+		Name:      "kube_api_degraded",
+		Help:      "1 if the Kubernetes API server is degraded and the operator reconciles the clusters less often, 0 otherwise",
+	}, func() float64 {
+		if k8sutil.APIHealth.Degraded() {
+			return 1
+		}
+		return 0
+	})
+
+	quotaRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd_operator",
+		Subsystem: "controller",
+		Name:      "quota_rejections",
+		Help:      "Total number of cluster creations and updates rejected by the namespace quota",
+	})
+
+	clustersNewerSchema = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd_operator",
+		Subsystem: "controller",
+		Name:      "clusters_newer_schema",
+		Help:      "Total number of cluster events ignored as the cluster was managed by an operator of a newer schema version",
+	})
 )
 
 func init() {
@@ -59,4 +96,8 @@ func init() {
 	prometheus.MustRegister(clustersDeleted)
 	prometheus.MustRegister(clustersModified)
 	prometheus.MustRegister(clustersFailed)
+	prometheus.MustRegister(quotaRejections)
+	prometheus.MustRegister(clustersNewerSchema)
+	prometheus.MustRegister(orphansFound)
+	prometheus.MustRegister(kubeAPIDegraded)
 }
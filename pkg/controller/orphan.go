@@ -0,0 +1,155 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// clusterObjectSelector matches the objects the operator creates for a cluster.
+const clusterObjectSelector = "app=etcd,etcd_cluster"
+
+const (
+	orphanKindPod       = "Pod"
+	orphanKindService   = "Service"
+	orphanKindSecret    = "Secret"
+	orphanKindConfigMap = "ConfigMap"
+)
+
+// clusterObject is an object the operator created for a cluster.
+type clusterObject struct {
+	kind      string
+	namespace string
+	name      string
+	cluster   string
+	// retained tells whether the deletion policy of the cluster kept the object.
+	retained bool
+}
+
+// sweepOrphansPeriodically sweeps orphans every interval until the operator exits.
+func (c *Controller) sweepOrphansPeriodically(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if k8sutil.APIHealth.Degraded() {
+			c.logger.Warningf("Kubernetes API server is degraded, skipping the orphan sweep")
+			continue
+		}
+		if err := c.sweepOrphans(); err != nil {
+			c.logger.Warningf("failed to sweep orphans: %v", err)
+		}
+	}
+}
+
+// sweepOrphans deletes the pods, services, secrets and config maps labeled for a cluster
+// whose EtcdCluster resource does not exist, e.g. left over by an operator that crashed while deleting a cluster.
+// Persistent volume claims are never deleted, as they hold the etcd data, nor the objects the deletion policy of their cluster retained.
+// In dry run, the orphans are only counted in the orphans metric.
+func (c *Controller) sweepOrphans() error {
+	ns := c.Config.Namespace
+	if c.Config.ClusterWide {
+		ns = metav1.NamespaceAll
+	}
+	// The clusters are listed after their objects, so that the objects of a cluster created in between are not taken for orphans.
+	candidates, err := c.listClusterObjects(ns)
+	if err != nil {
+		return err
+	}
+	clusters, err := c.Config.EtcdCRCli.EtcdV1beta2().EtcdClusters(ns).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	live := make(map[string]bool)
+	for _, cl := range clusters.Items {
+		live[cl.Namespace+"/"+cl.Name] = true
+	}
+
+	counts := map[string]int{orphanKindPod: 0, orphanKindService: 0, orphanKindSecret: 0, orphanKindConfigMap: 0}
+	for _, o := range candidates {
+		if live[o.namespace+"/"+o.cluster] || o.retained {
+			continue
+		}
+		counts[o.kind]++
+		if c.Config.OrphanSweepDryRun {
+			c.logger.Infof("dry run: would delete orphaned %s %s/%s of cluster (%s)", o.kind, o.namespace, o.name, o.cluster)
+			continue
+		}
+		c.logger.Infof("deleting orphaned %s %s/%s of cluster (%s)", o.kind, o.namespace, o.name, o.cluster)
+		if err := c.deleteOrphan(o); err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			c.logger.Errorf("failed to delete orphaned %s %s/%s: %v", o.kind, o.namespace, o.name, err)
+		}
+	}
+	for kind, n := range counts {
+		orphansFound.WithLabelValues(kind).Set(float64(n))
+	}
+	return nil
+}
+
+func (c *Controller) listClusterObjects(ns string) ([]clusterObject, error) {
+	opts := metav1.ListOptions{LabelSelector: clusterObjectSelector}
+	core := c.Config.KubeCli.CoreV1()
+	var objs []clusterObject
+	add := func(kind string, om metav1.ObjectMeta) {
+		objs = append(objs, clusterObject{kind: kind, namespace: om.Namespace, name: om.Name, cluster: om.Labels["etcd_cluster"],
+			retained: om.Annotations[k8sutil.AnnotationRetained] == "true"})
+	}
+
+	pods, err := core.Pods(ns).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range pods.Items {
+		add(orphanKindPod, o.ObjectMeta)
+	}
+	svcs, err := core.Services(ns).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range svcs.Items {
+		add(orphanKindService, o.ObjectMeta)
+	}
+	secrets, err := core.Secrets(ns).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range secrets.Items {
+		add(orphanKindSecret, o.ObjectMeta)
+	}
+	cms, err := core.ConfigMaps(ns).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range cms.Items {
+		add(orphanKindConfigMap, o.ObjectMeta)
+	}
+	return objs, nil
+}
+
+func (c *Controller) deleteOrphan(o clusterObject) error {
+	core := c.Config.KubeCli.CoreV1()
+	switch o.kind {
+	case orphanKindPod:
+		return core.Pods(o.namespace).Delete(o.name, metav1.NewDeleteOptions(0))
+	case orphanKindService:
+		return core.Services(o.namespace).Delete(o.name, nil)
+	case orphanKindSecret:
+		return core.Secrets(o.namespace).Delete(o.name, nil)
+	default:
+		return core.ConfigMaps(o.namespace).Delete(o.name, nil)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// clusterPodIndex indexes the pods by namespace and cluster name.
+const clusterPodIndex = "cluster"
+
+// podCache holds the etcd pods of every cluster the operator watches, so that the clusters
+// read their pods from a single watch instead of each listing them from the API server.
+// It implements cluster.PodLister.
+type podCache struct {
+	informer cache.SharedIndexInformer
+}
+
+func newPodCache(kubecli kubernetes.Interface, ns string) *podCache {
+	lw := cache.NewFilteredListWatchFromClient(kubecli.CoreV1().RESTClient(), "pods", ns, func(o *metav1.ListOptions) {
+		o.LabelSelector = clusterObjectSelector
+	})
+	informer := cache.NewSharedIndexInformer(lw, &v1.Pod{}, 0, cache.Indexers{clusterPodIndex: podClusterKey})
+	return &podCache{informer: informer}
+}
+
+// run fills the cache and keeps it up to date until stopCh is closed.
+func (pc *podCache) run(stopCh <-chan struct{}) {
+	pc.informer.Run(stopCh)
+}
+
+func (pc *podCache) hasSynced() bool {
+	return pc.informer.HasSynced()
+}
+
+// ClusterPods returns copies of the cached pods of the cluster.
+func (pc *podCache) ClusterPods(ns, clusterName string) ([]*v1.Pod, error) {
+	objs, err := pc.informer.GetIndexer().ByIndex(clusterPodIndex, ns+"/"+clusterName)
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		pods = append(pods, obj.(*v1.Pod).DeepCopy())
+	}
+	return pods, nil
+}
+
+func podClusterKey(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object in pod cache: %T", obj)
+	}
+	return []string{pod.Namespace + "/" + pod.Labels["etcd_cluster"]}, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+type clusterUsage struct {
+	namespace string
+	members   int
+}
+
+func newClusterUsage(clus *api.EtcdCluster) clusterUsage {
+	return clusterUsage{namespace: clus.Namespace, members: clus.Spec.Size}
+}
+
+// checkQuota fails if managing the cluster with its current spec would exceed the quota of its namespace.
+// A new cluster over quota is not created, an update over quota is not applied to the running cluster.
+// Either is retried on the next change to the cluster resource.
+func (c *Controller) checkQuota(clus *api.EtcdCluster) error {
+	clusters, members := 1, clus.Spec.Size
+	for name, u := range c.usage {
+		if name == clus.Name || u.namespace != clus.Namespace {
+			continue
+		}
+		clusters++
+		members += u.members
+	}
+
+	var reason string
+	switch {
+	case c.Config.MaxClustersPerNamespace > 0 && clusters > c.Config.MaxClustersPerNamespace:
+		reason = fmt.Sprintf("namespace %s is limited to %d clusters", clus.Namespace, c.Config.MaxClustersPerNamespace)
+	case c.Config.MaxMembersPerNamespace > 0 && members > c.Config.MaxMembersPerNamespace:
+		reason = fmt.Sprintf("namespace %s is limited to %d members, the clusters would have %d", clus.Namespace, c.Config.MaxMembersPerNamespace, members)
+	default:
+		return nil
+	}
+
+	quotaRejections.Inc()
+	if _, err := c.Config.KubeCli.CoreV1().Events(clus.Namespace).Create(k8sutil.QuotaExceededEvent(reason, clus)); err != nil {
+		c.logger.Errorf("failed to create quota exceeded event: %v", err)
+	}
+	return fmt.Errorf("ignore cluster (%s): %s", clus.Name, reason)
+}
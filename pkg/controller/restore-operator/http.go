@@ -23,6 +23,7 @@ import (
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
 	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	"github.com/coreos/etcd-operator/pkg/backup/storage"
 	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
 	"github.com/coreos/etcd-operator/pkg/util/azureutil/absfactory"
 
@@ -118,7 +119,18 @@ func (r *Restore) serveBackup(w http.ResponseWriter, req *http.Request) error {
 		backupReader = reader.NewABSReader(absCli.ABS)
 		path = absRestoreSource.Path
 	default:
-		return fmt.Errorf("unknown backup storage type (%s) for restore CR (%v)", cr.Spec.BackupStorageType, restoreName)
+		restoreSource := cr.Spec.RestoreSource
+		if restoreSource.Custom == nil || len(restoreSource.Custom.Path) == 0 {
+			return fmt.Errorf("unknown backup storage type (%s) or empty custom restore source for restore CR (%v)", cr.Spec.BackupStorageType, restoreName)
+		}
+		be, err := storage.Open(r.kubecli, r.namespace, cr.Spec.BackupStorageType, restoreSource.Custom)
+		if err != nil {
+			return err
+		}
+		defer be.Close()
+
+		backupReader = be
+		path = restoreSource.Custom.Path
 	}
 
 	rc, err := backupReader.Open(path)
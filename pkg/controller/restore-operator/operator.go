@@ -22,6 +22,7 @@ import (
 	"github.com/coreos/etcd-operator/pkg/client"
 	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 
 	"github.com/sirupsen/logrus"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
@@ -45,10 +46,16 @@ type Restore struct {
 	kubeExtCli apiextensionsclient.Interface
 
 	createCRD bool
+	// backupHelperImage is the image fetching the backup into the seed member, unless the cluster overrides it.
+	backupHelperImage string
+	// notifier is told about completed and failed restores.
+	notifier *notifyutil.Notifier
+	// hooks are told about finished restores.
+	hooks notifyutil.Hooks
 }
 
 // New creates a restore operator.
-func New(createCRD bool, namespace, mySvcAddr string) *Restore {
+func New(createCRD bool, namespace, mySvcAddr, backupHelperImage string, notifier *notifyutil.Notifier, hooks notifyutil.Hooks) *Restore {
 	return &Restore{
 		logger:     logrus.WithField("pkg", "controller"),
 		namespace:  namespace,
@@ -57,6 +64,10 @@ func New(createCRD bool, namespace, mySvcAddr string) *Restore {
 		etcdCRCli:  client.MustNewInCluster(),
 		kubeExtCli: k8sutil.MustNewKubeExtClient(),
 		createCRD:  createCRD,
+		notifier:   notifier,
+		hooks:      hooks,
+
+		backupHelperImage: backupHelperImage,
 	}
 }
 
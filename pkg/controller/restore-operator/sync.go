@@ -21,6 +21,7 @@ import (
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/notifyutil"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -86,17 +87,75 @@ func (r *Restore) handleCR(er *api.EtcdRestore, key string) (err error) {
 		err = fmt.Errorf("failed to handle restore CR: EtcdRestore CR name(%v) must be the same as EtcdCluster name(%v)", er.Name, er.Spec.EtcdCluster.Name)
 		return err
 	}
+	if len(er.Spec.BackupTag) != 0 && er.Spec.S3 == nil && er.Spec.ABS == nil && er.Spec.Custom == nil {
+		if err = r.resolveBackupTag(er); err != nil {
+			return err
+		}
+	}
 	err = r.prepareSeed(er)
 	return err
 }
 
+// resolveBackupTag fills in the restore source from the most recent successful EtcdBackup with the tag
+// and saves it in the restore CR, which the backup server reads the source from.
+func (r *Restore) resolveBackupTag(er *api.EtcdRestore) error {
+	backups, err := r.etcdCRCli.EtcdV1beta2().EtcdBackups(r.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %v", err)
+	}
+	eb := latestBackupWithTag(backups.Items, er.Spec.BackupTag)
+	if eb == nil {
+		return fmt.Errorf("no successful backup with tag (%s) found", er.Spec.BackupTag)
+	}
+
+	src, err := k8sutil.RestoreSourceOf(eb)
+	if err != nil {
+		return err
+	}
+	er.Spec.BackupStorageType = eb.Spec.StorageType
+	er.Spec.RestoreSource = src
+	r.logger.Infof("restoring %s from backup %s with tag (%s)", er.Name, eb.Name, er.Spec.BackupTag)
+
+	updated, err := r.etcdCRCli.EtcdV1beta2().EtcdRestores(r.namespace).Update(er)
+	if err != nil {
+		return fmt.Errorf("failed to save restore source of tag (%s): %v", er.Spec.BackupTag, err)
+	}
+	er.ResourceVersion = updated.ResourceVersion
+	return nil
+}
+
+// latestBackupWithTag returns the most recently saved successful backup with the tag, or nil.
+func latestBackupWithTag(backups []api.EtcdBackup, tag string) *api.EtcdBackup {
+	var latest *api.EtcdBackup
+	for i := range backups {
+		eb := &backups[i]
+		if eb.Spec.Tag != tag || !eb.Status.Succeeded {
+			continue
+		}
+		if _, err := k8sutil.RestoreSourceOf(eb); err != nil {
+			continue
+		}
+		if latest == nil || k8sutil.BackupTime(latest).Before(k8sutil.BackupTime(eb)) {
+			latest = eb
+		}
+	}
+	return latest
+}
+
 func (r *Restore) reportStatus(rerr error, er *api.EtcdRestore) {
+	ev := notifyutil.NewEvent(notifyutil.EventRestoreFinished, er.Namespace, er.Name)
+	ev.Cluster = er.Spec.EtcdCluster.Name
 	if rerr != nil {
 		er.Status.Succeeded = false
 		er.Status.Reason = rerr.Error()
+		r.notifier.Notify("etcd restore %s/%s of cluster %s failed: %v", er.Namespace, er.Name, er.Spec.EtcdCluster.Name, rerr)
+		ev.Error = rerr.Error()
 	} else {
 		er.Status.Succeeded = true
+		r.notifier.Notify("etcd restore %s/%s completed: cluster %s is being restored from the backup", er.Namespace, er.Name, er.Spec.EtcdCluster.Name)
+		ev.Message = "the cluster is being restored from the backup"
 	}
+	r.hooks.Fire(ev)
 	_, err := r.etcdCRCli.EtcdV1beta2().EtcdRestores(r.namespace).Update(er)
 	if err != nil {
 		r.logger.Warningf("failed to update status of restore CR %v : (%v)", er.Name, err)
@@ -155,6 +214,12 @@ func (r *Restore) prepareSeed(er *api.EtcdRestore) (err error) {
 	if err := ec.Spec.Validate(); err != nil {
 		return fmt.Errorf("invalid cluster spec: %v", err)
 	}
+	if err := k8sutil.ValidateEtcdPolicy(ec.Spec.Etcd, ec.Spec.Version); err != nil {
+		return fmt.Errorf("invalid cluster spec: %v", err)
+	}
+	if err := k8sutil.ValidatePodOverridePatch(ec.Name, ec.Spec); err != nil {
+		return fmt.Errorf("invalid cluster spec: %v", err)
+	}
 
 	// Delete reference EtcdCluster
 	err = r.etcdCRCli.EtcdV1beta2().EtcdClusters(r.namespace).Delete(ecRef.Name, &metav1.DeleteOptions{})
@@ -178,12 +243,15 @@ func (r *Restore) prepareSeed(er *api.EtcdRestore) (err error) {
 
 	ec.Spec.Paused = true
 	ec.Status.Phase = api.ClusterPhaseRunning
+	// The seed member is the first member of the restored cluster.
+	ec.Status.MemberGeneration = 1
+	ec.Status.MemberCreations = map[api.MemberCreationReason]int64{api.MemberCreationRestore: 1}
 	ec, err = r.etcdCRCli.EtcdV1beta2().EtcdClusters(r.namespace).Create(ec)
 	if err != nil {
 		return fmt.Errorf("failed to create restored EtcdCluster (%s/%s): %v", r.namespace, clusterName, err)
 	}
 
-	err = r.createSeedMember(ec, r.mySvcAddr, clusterName, ec.AsOwner())
+	err = r.createSeedMember(ec, r.mySvcAddr, clusterName, ec.AsOwner(), er.Spec.SkipHashCheck)
 	if err != nil {
 		return fmt.Errorf("failed to create seed member for cluster (%s): %v", clusterName, err)
 	}
@@ -210,18 +278,26 @@ func (r *Restore) prepareSeed(er *api.EtcdRestore) (err error) {
 	return nil
 }
 
-func (r *Restore) createSeedMember(ec *api.EtcdCluster, svcAddr, clusterName string, owner metav1.OwnerReference) error {
+func (r *Restore) createSeedMember(ec *api.EtcdCluster, svcAddr, clusterName string, owner metav1.OwnerReference, skipHashCheck bool) error {
+	ec.SetDefaults()
 	m := &etcdutil.Member{
-		Name:         k8sutil.UniqueMemberName(clusterName),
+		Name:         k8sutil.UniqueMemberName(k8sutil.MemberSubdomain(clusterName, ec.Spec.Pod)),
 		Namespace:    r.namespace,
 		SecurePeer:   ec.Spec.TLS.IsSecurePeer(),
 		SecureClient: ec.Spec.TLS.IsSecureClient(),
+		ClientPort:   ec.Spec.ClientPort,
+		PeerPort:     ec.Spec.PeerPort,
 	}
 	ms := etcdutil.NewMemberSet(m)
 	backupURL := backupapi.BackupURLForRestore("http", svcAddr, clusterName)
-	ec.SetDefaults()
-	pod := k8sutil.NewSeedMemberPod(clusterName, ms, m, ec.Spec, owner, backupURL)
-	_, err := r.kubecli.Core().Pods(r.namespace).Create(pod)
+	pod := k8sutil.NewSeedMemberPod(clusterName, ms, m, ec.Spec, owner, backupURL, r.backupHelperImage, skipHashCheck)
+	k8sutil.AddLabels(pod.GetObjectMeta(), k8sutil.PropagatedLabels(ec))
+	k8sutil.SetMemberCreation(pod, 1, api.MemberCreationRestore)
+	pod, err := k8sutil.ApplyPodOverridePatch(pod, ec.Spec.Pod)
+	if err != nil {
+		return err
+	}
+	_, err = k8sutil.CreatePod(r.kubecli, r.namespace, pod)
 	return err
 }
 
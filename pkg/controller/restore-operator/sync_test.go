@@ -0,0 +1,52 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLatestBackupWithTag(t *testing.T) {
+	now := time.Now()
+	newBackup := func(name, tag string, age time.Duration, succeeded bool) api.EtcdBackup {
+		return api.EtcdBackup{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+			Spec: api.BackupSpec{
+				Tag:          tag,
+				StorageType:  api.BackupStorageTypeS3,
+				BackupSource: api.BackupSource{S3: &api.S3BackupSource{Path: "bucket/" + name}},
+			},
+			Status: api.BackupStatus{Succeeded: succeeded},
+		}
+	}
+	backups := []api.EtcdBackup{
+		newBackup("old", "pre-upgrade", 2*time.Hour, true),
+		newBackup("new", "pre-upgrade", time.Hour, true),
+		newBackup("failed", "pre-upgrade", time.Minute, false),
+		newBackup("other", "nightly", time.Second, true),
+	}
+
+	if eb := latestBackupWithTag(backups, "pre-upgrade"); eb == nil || eb.Name != "new" {
+		t.Errorf("expect backup new, get %v", eb)
+	}
+	if eb := latestBackupWithTag(backups, "missing"); eb != nil {
+		t.Errorf("expect no backup, get %s", eb.Name)
+	}
+}
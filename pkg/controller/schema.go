@@ -0,0 +1,38 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+)
+
+// checkSchemaVersion fails if the cluster was managed by an operator of a newer schema version, e.g. before
+// the operator was rolled back. Managing it would drop the fields of the resource this operator does not know.
+// The clusters are checked as the operator starts, with the initial list of the informer, and on each change
+// to their resource, until an operator of the newer schema version manages them again.
+func (c *Controller) checkSchemaVersion(clus *api.EtcdCluster) error {
+	if clus.Status.SchemaVersion <= api.SchemaVersion {
+		return nil
+	}
+	clustersNewerSchema.Inc()
+	if _, err := c.Config.KubeCli.CoreV1().Events(clus.Namespace).Create(k8sutil.NewerSchemaEvent(api.SchemaVersion, clus)); err != nil {
+		c.logger.Errorf("failed to create newer schema event: %v", err)
+	}
+	return fmt.Errorf("ignore cluster (%s): it was managed by an etcd operator of schema version %d, newer than %d. Upgrade the etcd operator",
+		clus.Name, clus.Status.SchemaVersion, api.SchemaVersion)
+}
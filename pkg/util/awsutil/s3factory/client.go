@@ -21,6 +21,7 @@ import (
 	"path"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/tmputil"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -28,10 +29,6 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-const (
-	tmpdir = "/tmp"
-)
-
 // S3Client is a wrapper for S3 client that provides cleanup functionality.
 type S3Client struct {
 	S3        *s3.S3
@@ -46,16 +43,18 @@ func NewClientFromSecret(kubecli kubernetes.Interface, namespace, endpoint, awsS
 		}
 	}()
 	w = &S3Client{}
-	w.configDir, err = ioutil.TempDir(tmpdir, "")
+	w.configDir, err = tmputil.TempDir("aws-")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create aws config dir: (%v)", err)
 	}
 	so, err := setupAWSConfig(kubecli, namespace, awsSecret, endpoint, w.configDir)
 	if err != nil {
+		w.Close()
 		return nil, fmt.Errorf("failed to setup aws config: (%v)", err)
 	}
 	sess, err := session.NewSessionWithOptions(*so)
 	if err != nil {
+		w.Close()
 		return nil, fmt.Errorf("new AWS session failed: %v", err)
 	}
 	w.S3 = s3.New(sess)
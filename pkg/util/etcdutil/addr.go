@@ -0,0 +1,43 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// All etcd URLs the operator hands out, to members, clients and probes, are built here.
+
+const (
+	// ClientPort is the default port etcd serves clients on.
+	ClientPort = 2379
+	// PeerPort is the default port etcd serves its peers on.
+	PeerPort = 2380
+)
+
+// Scheme returns the URL scheme of an etcd listener with TLS enabled or not.
+func Scheme(secure bool) string {
+	if secure {
+		return "https"
+	}
+	return "http"
+}
+
+// URL returns the URL of an etcd listener at host and port.
+func URL(secure bool, host string, port int) string {
+	return fmt.Sprintf("%s://%s", Scheme(secure), net.JoinHostPort(host, strconv.Itoa(port)))
+}
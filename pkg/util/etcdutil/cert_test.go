@@ -0,0 +1,73 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestNewSignedCert(t *testing.T) {
+	oldCA, _, err := NewCA("old", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, caKey, err := NewCA("new", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := NewSignedCert(ca, caKey, "server", []string{"*.example.default.svc", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(AppendCA(oldCA, ca)) {
+		t.Fatal("failed to parse CA bundle")
+	}
+	for _, host := range []string{"example-0000.example.default.svc", "127.0.0.1"} {
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName:   host,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			t.Errorf("host %s: %v", host, err)
+		}
+	}
+
+	roots = x509.NewCertPool()
+	roots.AppendCertsFromPEM(oldCA)
+	if _, err = cert.Verify(x509.VerifyOptions{Roots: roots}); err == nil {
+		t.Error("expected the certificate not to be trusted by the old CA only")
+	}
+}
+
+func TestAppendCA(t *testing.T) {
+	bundle := AppendCA([]byte("a"), []byte("b\n"))
+	if string(bundle) != "a\nb\n" {
+		t.Errorf("bundle = %q, want %q", bundle, "a\nb\n")
+	}
+	if again := AppendCA(bundle, []byte("b\n")); string(again) != string(bundle) {
+		t.Errorf("appending the same CA again changed the bundle to %q", again)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd/clientv3"
+)
+
+// ClientOptions tunes the connections the operator opens to etcd members.
+// The zero value keeps the clientv3 defaults.
+type ClientOptions struct {
+	// MaxCallSendMsgSize is the client-side request size limit in bytes.
+	MaxCallSendMsgSize int
+	// DialKeepAliveTime is the time after which the client pings the server to check the connection.
+	DialKeepAliveTime time.Duration
+	// DialKeepAliveTimeout is the time the client waits for a ping response before closing the connection.
+	DialKeepAliveTimeout time.Duration
+	// Credentials is the user the client authenticates as. It is only set if etcd auth is enabled.
+	Credentials Credentials
+}
+
+// Credentials is an etcd user and its password.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+func (o ClientOptions) apply(cfg *clientv3.Config) {
+	cfg.MaxCallSendMsgSize = o.MaxCallSendMsgSize
+	cfg.DialKeepAliveTime = o.DialKeepAliveTime
+	cfg.DialKeepAliveTimeout = o.DialKeepAliveTimeout
+	cfg.Username = o.Credentials.Username
+	cfg.Password = o.Credentials.Password
+}
+
+// NewClientConfig returns the config of a client connecting to the given client URLs.
+func NewClientConfig(clientURLs []string, tc *tls.Config, opts ClientOptions) clientv3.Config {
+	cfg := clientv3.Config{
+		Endpoints:   clientURLs,
+		DialTimeout: constants.DefaultDialTimeout,
+		TLS:         tc,
+	}
+	opts.apply(&cfg)
+	return cfg
+}
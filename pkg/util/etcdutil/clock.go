@@ -0,0 +1,57 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+)
+
+// ClockSkew estimates how far the clock of the member serving at clientURL is ahead of the local clock,
+// negative if it is behind, from the Date header of the reply to GET /version.
+// The header has a resolution of a second, so the estimate is good to about half a second plus half the round trip.
+func ClockSkew(ctx context.Context, clientURL string, tc *tls.Config) (time.Duration, error) {
+	cli := &http.Client{
+		Timeout:   constants.DefaultRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tc},
+	}
+	req, err := http.NewRequest(http.MethodGet, clientURL+"/version", nil)
+	if err != nil {
+		return 0, err
+	}
+	sent := time.Now()
+	resp, err := cli.Do(req.WithContext(ctx))
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("member (%s) sent no valid date: %v", clientURL, err)
+	}
+	return estimateClockSkew(date, sent, received), nil
+}
+
+// estimateClockSkew compares the date a member sent, truncated to the second, with the middle of the round trip.
+func estimateClockSkew(date, sent, received time.Time) time.Duration {
+	mid := sent.Add(received.Sub(sent) / 2)
+	return date.Add(500 * time.Millisecond).Sub(mid)
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/etcd/clientv3"
+)
+
+// Actions of the Maintenance.Downgrade RPC.
+const (
+	downgradeActionValidate int32 = 0
+	downgradeActionEnable   int32 = 1
+)
+
+// downgradeRequest and downgradeResponse mirror the etcdserverpb messages of the
+// Maintenance.Downgrade RPC added in etcd 3.5.
+type downgradeRequest struct {
+	Action  int32  `protobuf:"varint,1,opt,name=action,proto3"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3"`
+}
+
+func (m *downgradeRequest) Reset()         { *m = downgradeRequest{} }
+func (m *downgradeRequest) String() string { return fmt.Sprintf("%d:%s", m.Action, m.Version) }
+func (*downgradeRequest) ProtoMessage()    {}
+
+type downgradeResponse struct {
+	Version string `protobuf:"bytes,2,opt,name=version,proto3"`
+}
+
+func (m *downgradeResponse) Reset()         { *m = downgradeResponse{} }
+func (m *downgradeResponse) String() string { return "version:" + m.Version }
+func (*downgradeResponse) ProtoMessage()    {}
+
+// EnableDowngrade validates and enables the downgrade of the cluster to the given minor version.
+// Once enabled, the cluster version is lowered and members can be restarted with the older etcd one by one.
+// Enabling a downgrade to the same version again succeeds.
+func EnableDowngrade(ctx context.Context, etcdcli *clientv3.Client, target MinorVersion) error {
+	version := fmt.Sprintf("%d.%d.0", target.Major, target.Minor)
+	for _, action := range []int32{downgradeActionValidate, downgradeActionEnable} {
+		err := invoke(ctx, etcdcli, "/etcdserverpb.Maintenance/Downgrade",
+			&downgradeRequest{Action: action, Version: version}, &downgradeResponse{})
+		if err != nil && strings.Contains(err.Error(), "downgrade job in progress") {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("enable downgrade to %s failed: %v", target, err)
+		}
+	}
+	return nil
+}
@@ -16,45 +16,134 @@ package etcdutil
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
 )
 
-func ListMembers(clientURLs []string, tc *tls.Config) (*clientv3.MemberListResponse, error) {
-	cfg := clientv3.Config{
-		Endpoints:   clientURLs,
-		DialTimeout: constants.DefaultDialTimeout,
-		TLS:         tc,
-	}
-	etcdcli, err := clientv3.New(cfg)
+// ListAlarms returns the alarms raised in the cluster, e.g. NOSPACE once a member database exceeds the quota.
+func ListAlarms(ctx context.Context, etcdcli *clientv3.Client) ([]*etcdserverpb.AlarmMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := etcdcli.AlarmList(ctx)
+	cancel()
 	if err != nil {
-		return nil, fmt.Errorf("list members failed: creating etcd client failed: %v", err)
+		return nil, err
 	}
+	return resp.Alarms, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+func ListMembers(ctx context.Context, etcdcli *clientv3.Client) (*clientv3.MemberListResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
 	resp, err := etcdcli.MemberList(ctx)
 	cancel()
-	etcdcli.Close()
 	return resp, err
 }
 
-func RemoveMember(clientURLs []string, tc *tls.Config, id uint64) error {
-	cfg := clientv3.Config{
-		Endpoints:   clientURLs,
-		DialTimeout: constants.DefaultDialTimeout,
-		TLS:         tc,
+// AddMember adds a voting member with the given peer URL within timeout and returns its ID.
+func AddMember(ctx context.Context, etcdcli *clientv3.Client, peerURL string, timeout time.Duration) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	resp, err := etcdcli.MemberAdd(ctx, []string{peerURL})
+	cancel()
+	if err != nil {
+		return 0, err
 	}
-	etcdcli, err := clientv3.New(cfg)
+	return resp.Member.ID, nil
+}
+
+// MemberClientURLs returns the client URLs of the current members of the cluster.
+// Members that have been added but not started yet have none.
+func MemberClientURLs(ctx context.Context, etcdcli *clientv3.Client) ([]string, error) {
+	resp, err := ListMembers(ctx, etcdcli)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer etcdcli.Close()
+	var urls []string
+	for _, m := range resp.Members {
+		urls = append(urls, m.ClientURLs...)
+	}
+	return urls, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
-	_, err = etcdcli.Cluster.MemberRemove(ctx, id)
+// RemoveMember removes the member with the given ID within timeout.
+func RemoveMember(ctx context.Context, etcdcli *clientv3.Client, id uint64, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	_, err := etcdcli.Cluster.MemberRemove(ctx, id)
 	cancel()
 	return err
 }
+
+// MemberVersions returns the etcd server version reported by each of the given client URLs.
+func MemberVersions(ctx context.Context, etcdcli *clientv3.Client, clientURLs []string) (map[string]string, error) {
+	versions := make(map[string]string, len(clientURLs))
+	for _, ep := range clientURLs {
+		ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+		resp, err := etcdcli.Status(ctx, ep)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get status of endpoint (%s): %v", ep, err)
+		}
+		versions[ep] = resp.Version
+	}
+	return versions, nil
+}
+
+// CompactHistory compacts the keyspace history so that only the given number of most recent
+// revisions are kept. It returns the revision compacted to, or 0 if there was nothing to compact.
+func CompactHistory(ctx context.Context, etcdcli *clientv3.Client, retention int64) (int64, error) {
+	getCtx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	// Any read returns the current revision of the keyspace in its header.
+	resp, err := etcdcli.Get(getCtx, "/", clientv3.WithCountOnly())
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current revision: %v", err)
+	}
+	rev := resp.Header.Revision - retention
+	if rev <= 0 {
+		return 0, nil
+	}
+
+	if err := Compact(ctx, etcdcli, rev); err != nil {
+		return 0, err
+	}
+	return rev, nil
+}
+
+// Compact compacts the history of the keyspace up to revision rev.
+// A history already compacted past rev is not an error.
+func Compact(ctx context.Context, etcdcli *clientv3.Client, rev int64) error {
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	_, err := etcdcli.Compact(ctx, rev)
+	cancel()
+	if err == rpctypes.ErrCompacted {
+		// Someone else, e.g. etcd auto compaction, has already compacted past rev.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compact to revision %d: %v", rev, err)
+	}
+	return nil
+}
+
+// CheckLinearizableRead makes a linearizable read through the client.
+// It only succeeds if the member serving it is connected to a leader with quorum.
+func CheckLinearizableRead(ctx context.Context, etcdcli *clientv3.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	_, err := etcdcli.Get(ctx, "health", clientv3.WithCountOnly())
+	cancel()
+	return err
+}
+
+// CountKeys returns the number of keys of the cluster. Only the keys are counted, not their history.
+func CountKeys(ctx context.Context, etcdcli *clientv3.Client) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := etcdcli.Get(ctx, "\x00", clientv3.WithFromKey(), clientv3.WithCountOnly())
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
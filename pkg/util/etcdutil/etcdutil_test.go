@@ -14,7 +14,11 @@
 
 package etcdutil
 
-import "testing"
+import (
+	"math"
+	"testing"
+	"time"
+)
 
 func TestMemberNameFromPeerURL(t *testing.T) {
 	tests := []struct {
@@ -63,3 +67,60 @@ func TestMemberNameFromPeerURL(t *testing.T) {
 		}
 	}
 }
+
+func TestMemberURLs(t *testing.T) {
+	m := &Member{Name: "example-0000", Namespace: "default", SecurePeer: true}
+	if get, want := m.ClientURL(), "http://example-0000.example.default.svc:2379"; get != want {
+		t.Errorf("expect client url=%s, get=%s", want, get)
+	}
+	if get, want := m.PeerURL(), "https://example-0000.example.default.svc:2380"; get != want {
+		t.Errorf("expect peer url=%s, get=%s", want, get)
+	}
+	if get, want := m.ListenPeerURL(), "https://0.0.0.0:2380"; get != want {
+		t.Errorf("expect listen peer url=%s, get=%s", want, get)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	inf := math.Inf(1)
+	prev := &Histogram{UpperBounds: []float64{0.001, 0.01, 0.1, inf}, Counts: []uint64{10, 10, 10, 10}}
+	tests := []struct {
+		h    *Histogram
+		want float64
+		ok   bool
+	}{
+		// 100 new observations, 99 of them at most 10ms: the 99th lies at the top of the second bucket.
+		{h: &Histogram{UpperBounds: prev.UpperBounds, Counts: []uint64{60, 109, 110, 110}}, want: 0.01, ok: true},
+		// Half of the new observations in the first bucket.
+		{h: &Histogram{UpperBounds: prev.UpperBounds, Counts: []uint64{12, 14, 14, 14}}, want: 0.001 + 0.009*(3.96-2)/2, ok: true},
+		// Beyond the last finite bucket.
+		{h: &Histogram{UpperBounds: prev.UpperBounds, Counts: []uint64{10, 10, 10, 20}}, want: 0.1, ok: true},
+		// No new observation.
+		{h: prev, ok: false},
+	}
+	for i, tt := range tests {
+		get, ok := tt.h.Sub(prev).Quantile(0.99)
+		if ok != tt.ok || math.Abs(get-tt.want) > 1e-9 {
+			t.Errorf("#%d: expect (%v, %v), get (%v, %v)", i, tt.want, tt.ok, get, ok)
+		}
+	}
+}
+
+func TestEstimateClockSkew(t *testing.T) {
+	sent := time.Date(2018, 5, 1, 12, 0, 0, 200*int(time.Millisecond), time.UTC)
+	received := sent.Add(200 * time.Millisecond)
+	tests := []struct {
+		date     time.Time
+		expected time.Duration
+	}{
+		// A member in sync answers at 12:00:00.3, sent as 12:00:00, within the error of the estimate.
+		{time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC), 200 * time.Millisecond},
+		{time.Date(2018, 5, 1, 12, 0, 10, 0, time.UTC), 10200 * time.Millisecond},
+		{time.Date(2018, 5, 1, 11, 59, 50, 0, time.UTC), -9800 * time.Millisecond},
+	}
+	for i, tt := range tests {
+		if got := estimateClockSkew(tt.date, sent, received); got != tt.expected {
+			t.Errorf("#%d: expect skew %v, got %v", i, tt.expected, got)
+		}
+	}
+}
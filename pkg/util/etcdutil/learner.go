@@ -0,0 +1,134 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/coreos/etcd/clientv3"
+	"google.golang.org/grpc"
+)
+
+// The learner RPCs and fields were added in etcd 3.4, after the vendored clientv3.
+// The messages below mirror the parts of etcdserverpb needed to use them.
+
+type learnerMember struct {
+	ID        uint64   `protobuf:"varint,1,opt,name=ID,proto3"`
+	Name      string   `protobuf:"bytes,2,opt,name=name,proto3"`
+	PeerURLs  []string `protobuf:"bytes,3,rep,name=peerURLs"`
+	IsLearner bool     `protobuf:"varint,5,opt,name=isLearner,proto3"`
+}
+
+func (m *learnerMember) Reset()         { *m = learnerMember{} }
+func (m *learnerMember) String() string { return fmt.Sprintf("ID:%x isLearner:%v", m.ID, m.IsLearner) }
+func (*learnerMember) ProtoMessage()    {}
+
+type memberAddLearnerRequest struct {
+	PeerURLs  []string `protobuf:"bytes,1,rep,name=peerURLs"`
+	IsLearner bool     `protobuf:"varint,2,opt,name=isLearner,proto3"`
+}
+
+func (m *memberAddLearnerRequest) Reset()         { *m = memberAddLearnerRequest{} }
+func (m *memberAddLearnerRequest) String() string { return fmt.Sprintf("peerURLs:%v", m.PeerURLs) }
+func (*memberAddLearnerRequest) ProtoMessage()    {}
+
+type memberAddLearnerResponse struct {
+	Member *learnerMember `protobuf:"bytes,2,opt,name=member"`
+}
+
+func (m *memberAddLearnerResponse) Reset()         { *m = memberAddLearnerResponse{} }
+func (m *memberAddLearnerResponse) String() string { return fmt.Sprintf("member:%v", m.Member) }
+func (*memberAddLearnerResponse) ProtoMessage()    {}
+
+type memberListLearnersRequest struct{}
+
+func (m *memberListLearnersRequest) Reset()         { *m = memberListLearnersRequest{} }
+func (m *memberListLearnersRequest) String() string { return "" }
+func (*memberListLearnersRequest) ProtoMessage()    {}
+
+type memberListLearnersResponse struct {
+	Members []*learnerMember `protobuf:"bytes,2,rep,name=members"`
+}
+
+func (m *memberListLearnersResponse) Reset()         { *m = memberListLearnersResponse{} }
+func (m *memberListLearnersResponse) String() string { return fmt.Sprintf("members:%v", m.Members) }
+func (*memberListLearnersResponse) ProtoMessage()    {}
+
+type memberPromoteRequest struct {
+	ID uint64 `protobuf:"varint,1,opt,name=ID,proto3"`
+}
+
+func (m *memberPromoteRequest) Reset()         { *m = memberPromoteRequest{} }
+func (m *memberPromoteRequest) String() string { return fmt.Sprintf("ID:%x", m.ID) }
+func (*memberPromoteRequest) ProtoMessage()    {}
+
+type memberPromoteResponse struct{}
+
+func (m *memberPromoteResponse) Reset()         { *m = memberPromoteResponse{} }
+func (m *memberPromoteResponse) String() string { return "" }
+func (*memberPromoteResponse) ProtoMessage()    {}
+
+func invokeCluster(ctx context.Context, etcdcli *clientv3.Client, method string, req, resp interface{}) error {
+	return invoke(ctx, etcdcli, "/etcdserverpb.Cluster/"+method, req, resp)
+}
+
+// invoke calls the gRPC method, e.g. "/etcdserverpb.Cluster/MemberList", on the cluster.
+func invoke(ctx context.Context, etcdcli *clientv3.Client, fullMethod string, req, resp interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	err := grpc.Invoke(ctx, fullMethod, req, resp, etcdcli.ActiveConnection())
+	cancel()
+	return err
+}
+
+// AddLearner adds a non-voting learner member with the given peer URL within timeout and returns its ID.
+// It requires etcd 3.4 or later on every member.
+func AddLearner(ctx context.Context, etcdcli *clientv3.Client, peerURL string, timeout time.Duration) (uint64, error) {
+	resp := &memberAddLearnerResponse{}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	err := grpc.Invoke(ctx, "/etcdserverpb.Cluster/MemberAdd", &memberAddLearnerRequest{PeerURLs: []string{peerURL}, IsLearner: true}, resp, etcdcli.ActiveConnection())
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	if resp.Member == nil {
+		return 0, fmt.Errorf("add learner (%s) failed: no member in response", peerURL)
+	}
+	return resp.Member.ID, nil
+}
+
+// ListLearners returns the IDs of the learner members.
+func ListLearners(ctx context.Context, etcdcli *clientv3.Client) (map[uint64]bool, error) {
+	resp := &memberListLearnersResponse{}
+	if err := invokeCluster(ctx, etcdcli, "MemberList", &memberListLearnersRequest{}, resp); err != nil {
+		return nil, err
+	}
+	learners := map[uint64]bool{}
+	for _, m := range resp.Members {
+		if m.IsLearner {
+			learners[m.ID] = true
+		}
+	}
+	return learners, nil
+}
+
+// PromoteLearner promotes the learner with the given ID to a voting member.
+// etcd refuses the promotion until the learner has caught up with the leader.
+func PromoteLearner(ctx context.Context, etcdcli *clientv3.Client, id uint64) error {
+	return invokeCluster(ctx, etcdcli, "MemberPromote", &memberPromoteRequest{ID: id}, &memberPromoteResponse{})
+}
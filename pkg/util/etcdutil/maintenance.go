@@ -0,0 +1,118 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/coreos/etcd/clientv3"
+	"google.golang.org/grpc"
+)
+
+// MemberStatus returns the status of the member serving at clientURL.
+func MemberStatus(ctx context.Context, clientURL string, tc *tls.Config, opts ClientOptions) (*clientv3.StatusResponse, error) {
+	etcdcli, err := clientv3.New(NewClientConfig([]string{clientURL}, tc, opts))
+	if err != nil {
+		return nil, fmt.Errorf("get member status failed: creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := etcdcli.Status(ctx, clientURL)
+	cancel()
+	return resp, err
+}
+
+// Defragment defragments the backend database of the member serving at clientURL within timeout.
+// The member does not serve any request until the defragmentation is done. Defragmenting rewrites the whole
+// backend database, so it takes a lot longer than a regular request.
+func Defragment(ctx context.Context, clientURL string, tc *tls.Config, opts ClientOptions, timeout time.Duration) error {
+	etcdcli, err := clientv3.New(NewClientConfig([]string{clientURL}, tc, opts))
+	if err != nil {
+		return fmt.Errorf("defragment failed: creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	_, err = etcdcli.Defragment(ctx, clientURL)
+	cancel()
+	return err
+}
+
+// moveLeaderRequest and moveLeaderResponse mirror the etcdserverpb messages of the
+// Maintenance.MoveLeader RPC added in etcd 3.3, which the vendored clientv3 predates.
+type moveLeaderRequest struct {
+	TargetID uint64 `protobuf:"varint,1,opt,name=targetID,proto3"`
+}
+
+func (m *moveLeaderRequest) Reset()         { *m = moveLeaderRequest{} }
+func (m *moveLeaderRequest) String() string { return fmt.Sprintf("targetID:%x", m.TargetID) }
+func (*moveLeaderRequest) ProtoMessage()    {}
+
+type moveLeaderResponse struct{}
+
+func (m *moveLeaderResponse) Reset()         { *m = moveLeaderResponse{} }
+func (m *moveLeaderResponse) String() string { return "" }
+func (*moveLeaderResponse) ProtoMessage()    {}
+
+// MoveLeader transfers the leadership from the leader serving at leaderURL to the member with the given ID.
+// It requires etcd 3.3 or later on every member.
+func MoveLeader(ctx context.Context, leaderURL string, tc *tls.Config, opts ClientOptions, transfereeID uint64) error {
+	etcdcli, err := clientv3.New(NewClientConfig([]string{leaderURL}, tc, opts))
+	if err != nil {
+		return fmt.Errorf("move leader failed: creating etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	err = grpc.Invoke(ctx, "/etcdserverpb.Maintenance/MoveLeader",
+		&moveLeaderRequest{TargetID: transfereeID}, &moveLeaderResponse{}, etcdcli.ActiveConnection())
+	cancel()
+	return err
+}
+
+// SetLogLevel changes the capnslog level, e.g. "DEBUG", of the running member serving at clientURL.
+// The level is reset when the member restarts.
+func SetLogLevel(ctx context.Context, clientURL string, tc *tls.Config, level string) error {
+	body, err := json.Marshal(struct{ Level string }{level})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, clientURL+"/config/local/log", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	cli := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tc},
+		Timeout:   constants.DefaultRequestTimeout,
+	}
+	resp, err := cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("set log level of member (%s) failed: http status code %d", clientURL, resp.StatusCode)
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -30,9 +31,16 @@ type Member struct {
 	// We know the ID of a member when we get the member information from etcd,
 	// but not from Kubernetes pod list.
 	ID uint64
+	// IsLearner tells whether the member is a non-voting learner that has yet to be promoted.
+	IsLearner bool
 
 	SecurePeer   bool
 	SecureClient bool
+
+	// ClientPort and PeerPort are the ports the member listens on.
+	// Zero means the default ports.
+	ClientPort int
+	PeerPort   int
 }
 
 func (m *Member) Addr() string {
@@ -41,32 +49,32 @@ func (m *Member) Addr() string {
 
 // ClientURL is the client URL for this member
 func (m *Member) ClientURL() string {
-	return fmt.Sprintf("%s://%s:2379", m.clientScheme(), m.Addr())
-}
-
-func (m *Member) clientScheme() string {
-	if m.SecureClient {
-		return "https"
-	}
-	return "http"
-}
-
-func (m *Member) peerScheme() string {
-	if m.SecurePeer {
-		return "https"
-	}
-	return "http"
+	return URL(m.SecureClient, m.Addr(), m.clientPort())
 }
 
 func (m *Member) ListenClientURL() string {
-	return fmt.Sprintf("%s://0.0.0.0:2379", m.clientScheme())
+	return URL(m.SecureClient, "0.0.0.0", m.clientPort())
 }
 func (m *Member) ListenPeerURL() string {
-	return fmt.Sprintf("%s://0.0.0.0:2380", m.peerScheme())
+	return URL(m.SecurePeer, "0.0.0.0", m.peerPort())
 }
 
 func (m *Member) PeerURL() string {
-	return fmt.Sprintf("%s://%s:2380", m.peerScheme(), m.Addr())
+	return URL(m.SecurePeer, m.Addr(), m.peerPort())
+}
+
+func (m *Member) clientPort() int {
+	if m.ClientPort == 0 {
+		return ClientPort
+	}
+	return m.ClientPort
+}
+
+func (m *Member) peerPort() int {
+	if m.PeerPort == 0 {
+		return PeerPort
+	}
+	return m.PeerPort
 }
 
 type MemberSet map[string]*Member
@@ -109,12 +117,67 @@ func (ms MemberSet) Size() int {
 }
 
 func (ms MemberSet) String() string {
-	var mstring []string
+	return strings.Join(ms.Names(), ",")
+}
+
+// Names returns the names of the members, in order.
+func (ms MemberSet) Names() []string {
+	names := make([]string, 0, len(ms))
+	for name := range ms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MemberSetDiff is how a member set differs from another one, by member name, with the names in order.
+type MemberSetDiff struct {
+	// Added are the members only in the other set.
+	Added []string `json:"added,omitempty"`
+	// Removed are the members only in the set.
+	Removed []string `json:"removed,omitempty"`
+	// Unchanged are the members of both sets.
+	Unchanged []string `json:"unchanged,omitempty"`
+}
+
+// Compare returns how the other set differs from ms, e.g. the running members from the membership.
+func (ms MemberSet) Compare(other MemberSet) MemberSetDiff {
+	var d MemberSetDiff
+	for _, name := range ms.Names() {
+		if _, ok := other[name]; ok {
+			d.Unchanged = append(d.Unchanged, name)
+		} else {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	for _, name := range other.Names() {
+		if _, ok := ms[name]; !ok {
+			d.Added = append(d.Added, name)
+		}
+	}
+	return d
+}
+
+// IsEmpty tells whether no member was added or removed.
+func (d MemberSetDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
 
-	for m := range ms {
-		mstring = append(mstring, m)
+// Explain describes the difference, e.g. "added c; removed a; unchanged b", or "no change".
+func (d MemberSetDiff) Explain() string {
+	if d.IsEmpty() {
+		return "no change"
 	}
-	return strings.Join(mstring, ",")
+	var parts []string
+	for _, p := range []struct {
+		verb  string
+		names []string
+	}{{"added", d.Added}, {"removed", d.Removed}, {"unchanged", d.Unchanged}} {
+		if len(p.names) != 0 {
+			parts = append(parts, p.verb+" "+strings.Join(p.names, ", "))
+		}
+	}
+	return strings.Join(parts, "; ")
 }
 
 func (ms MemberSet) PickOne() *Member {
@@ -140,6 +203,16 @@ func (ms MemberSet) Remove(name string) {
 	delete(ms, name)
 }
 
+// Learner returns a learner member of the set, or nil if there is none.
+func (ms MemberSet) Learner() *Member {
+	for _, m := range ms {
+		if m.IsLearner {
+			return m
+		}
+	}
+	return nil
+}
+
 func (ms MemberSet) ClientURLs() []string {
 	endpoints := make([]string, 0, len(ms))
 	for _, m := range ms {
@@ -54,3 +54,36 @@ func TestMemberSetIsEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestMemberSetCompare(t *testing.T) {
+	ma, mb, mc := &Member{Name: "a"}, &Member{Name: "b"}, &Member{Name: "c"}
+	tests := []struct {
+		ms1, ms2 MemberSet
+		explain  string
+	}{{
+		ms1:     NewMemberSet(ma, mb),
+		ms2:     NewMemberSet(mb, ma),
+		explain: "no change",
+	}, {
+		ms1:     NewMemberSet(ma, mb),
+		ms2:     NewMemberSet(mc, mb),
+		explain: "added c; removed a; unchanged b",
+	}, {
+		ms1:     NewMemberSet(),
+		ms2:     NewMemberSet(mb, ma),
+		explain: "added a, b",
+	}, {
+		ms1:     NewMemberSet(mc, ma),
+		ms2:     nil,
+		explain: "removed a, c",
+	}}
+	for i, tt := range tests {
+		d := tt.ms1.Compare(tt.ms2)
+		if d.IsEmpty() != (tt.explain == "no change") {
+			t.Errorf("#%d: empty get=%v, diff: %+v", i, d.IsEmpty(), d)
+		}
+		if e := d.Explain(); e != tt.explain {
+			t.Errorf("#%d: explain get=%q, want=%q", i, e, tt.explain)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+const walFsyncMetric = "etcd_disk_wal_fsync_duration_seconds"
+
+// Histogram is a cumulative Prometheus histogram.
+// Counts[i] is the number of observations less than or equal to UpperBounds[i].
+// The last bucket is +Inf and holds all observations.
+type Histogram struct {
+	UpperBounds []float64
+	Counts      []uint64
+}
+
+// WALFsyncHistogram returns the histogram of the WAL fsync durations, in seconds,
+// from the metrics the member serving at clientURL exposes.
+func WALFsyncHistogram(ctx context.Context, clientURL string, tc *tls.Config) (*Histogram, error) {
+	cli := &http.Client{
+		Timeout:   constants.DefaultRequestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tc},
+	}
+	req, err := http.NewRequest(http.MethodGet, clientURL+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get metrics of (%s) failed: %s", clientURL, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	mf, ok := families[walFsyncMetric]
+	if !ok || len(mf.Metric) == 0 || mf.Metric[0].Histogram == nil {
+		return nil, fmt.Errorf("member (%s) exposes no %s histogram", clientURL, walFsyncMetric)
+	}
+	ph := mf.Metric[0].Histogram
+	h := &Histogram{}
+	for _, b := range ph.Bucket {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		h.UpperBounds = append(h.UpperBounds, b.GetUpperBound())
+		h.Counts = append(h.Counts, b.GetCumulativeCount())
+	}
+	h.UpperBounds = append(h.UpperBounds, math.Inf(1))
+	h.Counts = append(h.Counts, ph.GetSampleCount())
+	return h, nil
+}
+
+// Sub returns the observations of h that are not in the earlier histogram prev.
+// It returns h if the buckets differ or the counts went down, e.g. because the member restarted.
+func (h *Histogram) Sub(prev *Histogram) *Histogram {
+	if prev == nil || len(prev.Counts) != len(h.Counts) {
+		return h
+	}
+	d := &Histogram{UpperBounds: h.UpperBounds, Counts: make([]uint64, len(h.Counts))}
+	for i := range h.Counts {
+		if h.UpperBounds[i] != prev.UpperBounds[i] || h.Counts[i] < prev.Counts[i] {
+			return h
+		}
+		d.Counts[i] = h.Counts[i] - prev.Counts[i]
+	}
+	return d
+}
+
+// Quantile estimates the q-quantile of the observations by linear interpolation within the buckets,
+// the way Prometheus' histogram_quantile does. It returns false if there are no observations.
+// A quantile in the +Inf bucket is reported as the largest finite upper bound.
+func (h *Histogram) Quantile(q float64) (float64, bool) {
+	n := len(h.Counts)
+	if n == 0 || h.Counts[n-1] == 0 {
+		return 0, false
+	}
+	rank := q * float64(h.Counts[n-1])
+	lower, below := 0.0, uint64(0)
+	for i, c := range h.Counts {
+		if float64(c) < rank {
+			lower, below = h.UpperBounds[i], c
+			continue
+		}
+		if math.IsInf(h.UpperBounds[i], 1) {
+			return lower, true
+		}
+		if c == below {
+			return h.UpperBounds[i], true
+		}
+		return lower + (h.UpperBounds[i]-lower)*(rank-float64(below))/float64(c-below), true
+	}
+	return lower, true
+}
@@ -17,8 +17,11 @@ package etcdutil
 import (
 	"crypto/tls"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 
+	"github.com/coreos/etcd-operator/pkg/util/tmputil"
+
 	"github.com/coreos/etcd/pkg/transport"
 )
 
@@ -28,12 +31,18 @@ const (
 	CliCAFile   = "etcd-client-ca.crt"
 )
 
-func NewTLSConfig(certData, keyData, caData []byte) (*tls.Config, error) {
-	// TODO: Need cleanup these temp dirs
-	dir, err := ioutil.TempDir("", "etcd-operator-cluster-tls")
+// NewTLSConfig returns the client TLS config of the certificate, key and CA, written to a temp dir the config
+// loads them from. The dir is kept for as long as the config may reload them; see tmputil.Cleanup.
+func NewTLSConfig(certData, keyData, caData []byte) (tc *tls.Config, err error) {
+	dir, err := tmputil.TempDir("cluster-tls-")
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
 
 	certFile, err := writeFile(dir, CliCertFile, certData)
 	if err != nil {
@@ -0,0 +1,108 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Feature is an etcd capability that only exists from a certain server minor version onwards.
+type Feature string
+
+const (
+	// FeatureMoveLeader is the Maintenance.MoveLeader RPC.
+	FeatureMoveLeader Feature = "MoveLeader"
+	// FeatureLearner is raft learner (non-voting) membership.
+	FeatureLearner Feature = "Learner"
+	// FeatureDowngrade is the cluster downgrade API.
+	FeatureDowngrade Feature = "Downgrade"
+)
+
+var featureMinVersions = map[Feature]MinorVersion{
+	FeatureMoveLeader: {Major: 3, Minor: 3},
+	FeatureLearner:    {Major: 3, Minor: 4},
+	FeatureDowngrade:  {Major: 3, Minor: 5},
+}
+
+// MinorVersion is the major.minor part of an etcd server version.
+// The zero value means the version is unknown and supports no gated feature.
+type MinorVersion struct {
+	Major int
+	Minor int
+}
+
+// ParseMinorVersion parses the major.minor part of an etcd version such as "3.2.13" or "v3.3.0-rc.1".
+func ParseMinorVersion(v string) (MinorVersion, error) {
+	toks := strings.SplitN(strings.TrimLeft(v, "v"), ".", 3)
+	if len(toks) < 2 {
+		return MinorVersion{}, fmt.Errorf("invalid etcd version (%s)", v)
+	}
+	major, err := strconv.Atoi(toks[0])
+	if err != nil {
+		return MinorVersion{}, fmt.Errorf("invalid etcd major version (%s): %v", v, err)
+	}
+	minor, err := strconv.Atoi(toks[1])
+	if err != nil {
+		return MinorVersion{}, fmt.Errorf("invalid etcd minor version (%s): %v", v, err)
+	}
+	return MinorVersion{Major: major, Minor: minor}, nil
+}
+
+// IsUnknown tells whether the version has not been detected.
+func (v MinorVersion) IsUnknown() bool {
+	return v == MinorVersion{}
+}
+
+// LessThan tells whether v is an older minor version than o.
+func (v MinorVersion) LessThan(o MinorVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	return v.Minor < o.Minor
+}
+
+// Supports tells whether an etcd server of version v provides the given feature.
+func (v MinorVersion) Supports(f Feature) bool {
+	min, ok := featureMinVersions[f]
+	if !ok || v.IsUnknown() {
+		return false
+	}
+	return !v.LessThan(min)
+}
+
+func (v MinorVersion) String() string {
+	if v.IsUnknown() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// LowestMinorVersion returns the oldest minor version among the given etcd versions.
+// A cluster can only rely on the features its oldest member supports.
+func LowestMinorVersion(versions []string) (MinorVersion, error) {
+	var lowest MinorVersion
+	for _, s := range versions {
+		v, err := ParseMinorVersion(s)
+		if err != nil {
+			return MinorVersion{}, err
+		}
+		if lowest.IsUnknown() || v.LessThan(lowest) {
+			lowest = v
+		}
+	}
+	return lowest, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import "testing"
+
+func TestParseMinorVersion(t *testing.T) {
+	tests := []struct {
+		v    string
+		want MinorVersion
+		wErr bool
+	}{{
+		v:    "3.2.13",
+		want: MinorVersion{Major: 3, Minor: 2},
+	}, {
+		v:    "v3.3.0-rc.1",
+		want: MinorVersion{Major: 3, Minor: 3},
+	}, {
+		v:    "3.4",
+		want: MinorVersion{Major: 3, Minor: 4},
+	}, {
+		v:    "3",
+		wErr: true,
+	}, {
+		v:    "",
+		wErr: true,
+	}, {
+		v:    "3.x.1",
+		wErr: true,
+	}}
+
+	for i, tt := range tests {
+		get, err := ParseMinorVersion(tt.v)
+		if tt.wErr {
+			if err == nil {
+				t.Errorf("#%d: should be error case", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: want err = nil, got %v", i, err)
+		}
+		if get != tt.want {
+			t.Errorf("#%d: version get=%v, want=%v", i, get, tt.want)
+		}
+	}
+}
+
+func TestMinorVersionSupports(t *testing.T) {
+	tests := []struct {
+		versions []string
+		f        Feature
+		wSupport bool
+	}{{
+		versions: []string{"3.2.13", "3.2.13", "3.2.13"},
+		f:        FeatureMoveLeader,
+		wSupport: false,
+	}, {
+		versions: []string{"3.3.1", "3.3.1", "3.3.1"},
+		f:        FeatureMoveLeader,
+		wSupport: true,
+	}, { // one member still runs 3.2 in the middle of an upgrade
+		versions: []string{"3.3.1", "3.2.13", "3.3.1"},
+		f:        FeatureMoveLeader,
+		wSupport: false,
+	}, {
+		versions: []string{"3.4.0"},
+		f:        FeatureLearner,
+		wSupport: true,
+	}, {
+		versions: []string{"3.4.0"},
+		f:        FeatureDowngrade,
+		wSupport: false,
+	}, {
+		versions: nil,
+		f:        FeatureMoveLeader,
+		wSupport: false,
+	}}
+
+	for i, tt := range tests {
+		v, err := LowestMinorVersion(tt.versions)
+		if err != nil {
+			t.Fatalf("#%d: want err = nil, got %v", i, err)
+		}
+		if s := v.Supports(tt.f); s != tt.wSupport {
+			t.Errorf("#%d: %s supports %s get=%v, want=%v", i, v, tt.f, s, tt.wSupport)
+		}
+	}
+}
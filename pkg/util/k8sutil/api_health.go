@@ -0,0 +1,82 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// apiDegradedAfterFailures is the number of requests in a row that must fail for the API server to be considered degraded.
+	apiDegradedAfterFailures = 5
+	// apiRecoveredAfterSuccesses is the number of requests in a row that must succeed for a degraded API server to be considered recovered.
+	apiRecoveredAfterSuccesses = 3
+)
+
+// APIHealth tracks the health of the Kubernetes API server, as seen by the requests of the clients created with InClusterConfig.
+// A request fails if it gets no response, e.g. on a timeout, or a server error or throttling response.
+var APIHealth = &apiHealth{}
+
+type apiHealth struct {
+	mu        sync.Mutex
+	failures  int
+	successes int
+	degraded  bool
+}
+
+// Degraded tells whether the API server is degraded: the last requests failed, and not enough of them succeeded since.
+func (h *apiHealth) Degraded() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.degraded
+}
+
+func (h *apiHealth) observe(failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if failed {
+		h.failures++
+		h.successes = 0
+		if !h.degraded && h.failures >= apiDegradedAfterFailures {
+			h.degraded = true
+			logrus.Warningf("Kubernetes API server is degraded: %d requests in a row failed, slowing down", h.failures)
+		}
+		return
+	}
+	h.successes++
+	h.failures = 0
+	if h.degraded && h.successes >= apiRecoveredAfterSuccesses {
+		h.degraded = false
+		logrus.Infof("Kubernetes API server recovered: %d requests in a row succeeded", h.successes)
+	}
+}
+
+// wrapTransport observes the result of every request sent through rt.
+func (h *apiHealth) wrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := rt.RoundTrip(req)
+		h.observe(err != nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests)
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import "testing"
+
+func TestAPIHealth(t *testing.T) {
+	h := &apiHealth{}
+	for i := 0; i < apiDegradedAfterFailures-1; i++ {
+		h.observe(true)
+	}
+	h.observe(false)
+	for i := 0; i < apiDegradedAfterFailures-1; i++ {
+		h.observe(true)
+	}
+	if h.Degraded() {
+		t.Fatal("expect failures interrupted by a success not to degrade the API")
+	}
+	h.observe(true)
+	if !h.Degraded() {
+		t.Fatalf("expect %d failures in a row to degrade the API", apiDegradedAfterFailures)
+	}
+	for i := 0; i < apiRecoveredAfterSuccesses-1; i++ {
+		h.observe(false)
+	}
+	if !h.Degraded() {
+		t.Fatal("expect the API to stay degraded until enough requests succeed")
+	}
+	h.observe(false)
+	if h.Degraded() {
+		t.Fatalf("expect %d successes in a row to recover the API", apiRecoveredAfterSuccesses)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GetCredentialsFromSecret reads the etcd user of a secret of spec.auth, from its "username" and "password" keys.
+// It also returns the resourceVersion of the secret, which changes once the user is rotated.
+func GetCredentialsFromSecret(kubecli kubernetes.Interface, ns, se string) (etcdutil.Credentials, string, error) {
+	secret, err := kubecli.CoreV1().Secrets(ns).Get(se, metav1.GetOptions{})
+	if err != nil {
+		return etcdutil.Credentials{}, "", err
+	}
+	username := string(secret.Data[v1.BasicAuthUsernameKey])
+	if len(username) == 0 {
+		return etcdutil.Credentials{}, "", fmt.Errorf("secret (%s) has no %s", se, v1.BasicAuthUsernameKey)
+	}
+	return etcdutil.Credentials{
+		Username: username,
+		Password: string(secret.Data[v1.BasicAuthPasswordKey]),
+	}, secret.ResourceVersion, nil
+}
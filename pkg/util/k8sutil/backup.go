@@ -0,0 +1,116 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+)
+
+// LastBackupTime returns the creation time of the most recent successful backup
+// whose endpoints address the client service of the cluster, by its short or qualified name.
+func LastBackupTime(clusterName, ns string, backups []api.EtcdBackup) (time.Time, bool) {
+	b := LatestBackup(clusterName, ns, backups)
+	if b == nil {
+		return time.Time{}, false
+	}
+	return b.CreationTimestamp.Time, true
+}
+
+// LatestBackup returns the most recently created successful backup of the cluster, or nil if there is none.
+func LatestBackup(clusterName, ns string, backups []api.EtcdBackup) *api.EtcdBackup {
+	var latest *api.EtcdBackup
+	for i := range backups {
+		b := &backups[i]
+		if !b.Status.Succeeded || !IsBackupOfCluster(clusterName, ns, b) {
+			continue
+		}
+		if latest == nil || BackupTime(b).After(BackupTime(latest)) {
+			latest = b
+		}
+	}
+	return latest
+}
+
+// BackupTime returns the time the last snapshot of the backup was saved,
+// i.e. the creation time of the backup unless it is periodic.
+func BackupTime(b *api.EtcdBackup) time.Time {
+	if !b.Status.LastSuccessDate.IsZero() {
+		return b.Status.LastSuccessDate.Time
+	}
+	return b.CreationTimestamp.Time
+}
+
+// BackupFilePath returns the storage path of the last snapshot of the backup:
+// the path of its last snapshot if it is periodic, or the path in its spec.
+func BackupFilePath(b *api.EtcdBackup) string {
+	if len(b.Status.LastBackupPath) != 0 {
+		return b.Status.LastBackupPath
+	}
+	switch b.Spec.StorageType {
+	case api.BackupStorageTypeS3:
+		if b.Spec.S3 != nil {
+			return b.Spec.S3.Path
+		}
+	case api.BackupStorageTypeABS:
+		if b.Spec.ABS != nil {
+			return b.Spec.ABS.Path
+		}
+	default:
+		if b.Spec.Custom != nil {
+			return b.Spec.Custom.Path
+		}
+	}
+	return ""
+}
+
+// RestoreSourceOf returns the restore source of the last snapshot of the backup.
+func RestoreSourceOf(b *api.EtcdBackup) (api.RestoreSource, error) {
+	switch {
+	case b.Spec.StorageType == api.BackupStorageTypeS3 && b.Spec.S3 != nil:
+		return api.RestoreSource{S3: &api.S3RestoreSource{Path: BackupFilePath(b), AWSSecret: b.Spec.S3.AWSSecret, Endpoint: b.Spec.S3.Endpoint}}, nil
+	case b.Spec.StorageType == api.BackupStorageTypeABS && b.Spec.ABS != nil:
+		return api.RestoreSource{ABS: &api.ABSRestoreSource{Path: BackupFilePath(b), ABSSecret: b.Spec.ABS.ABSSecret}}, nil
+	case len(b.Spec.StorageType) != 0 && b.Spec.StorageType != api.BackupStorageTypeS3 && b.Spec.StorageType != api.BackupStorageTypeABS && b.Spec.Custom != nil:
+		src := b.Spec.Custom.DeepCopy()
+		src.Path = BackupFilePath(b)
+		return api.RestoreSource{Custom: src}, nil
+	}
+	return api.RestoreSource{}, fmt.Errorf("unknown backup storage type (%s) of backup (%s)", b.Spec.StorageType, b.Name)
+}
+
+// IsBackupOfCluster tells whether the backup is in the namespace of the cluster and its endpoints address the client service of the cluster.
+func IsBackupOfCluster(clusterName, ns string, b *api.EtcdBackup) bool {
+	return b.Namespace == ns && addressesService(b.Spec.EtcdEndpoints, ClientServiceName(clusterName), ns)
+}
+
+func addressesService(endpoints []string, service, ns string) bool {
+	for _, ep := range endpoints {
+		host := ep
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		if i := strings.Index(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		if host == service || host == service+"."+ns || strings.HasPrefix(host, service+"."+ns+".") {
+			return true
+		}
+	}
+	return false
+}
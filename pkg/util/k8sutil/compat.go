@@ -0,0 +1,116 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ServerVersion is the version of the Kubernetes API server the operator runs against, detected by DetectServerVersion.
+// The pods and services the operator creates are adjusted to it with AdjustPod and AdjustService, so that one
+// operator binary supports a range of Kubernetes releases. Until it is detected, the latest representations are used.
+var ServerVersion = &serverVersion{}
+
+type serverVersion struct {
+	mu sync.RWMutex
+	// major and minor are 0 while the version is not detected.
+	major int
+	minor int
+}
+
+// DetectServerVersion reads the version of the API server with the discovery API.
+func DetectServerVersion(kubecli kubernetes.Interface) error {
+	info, err := kubecli.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get the version of the Kubernetes API server: %v", err)
+	}
+	major, minor, err := parseServerVersion(info.Major, info.Minor)
+	if err != nil {
+		return err
+	}
+	ServerVersion.set(major, minor)
+	logrus.Infof("Kubernetes API server version: %s", info.GitVersion)
+	return nil
+}
+
+// parseServerVersion parses the major and minor version of the API server,
+// e.g. "1" and "10+" of a distribution that patched its 1.10 release.
+func parseServerVersion(major, minor string) (int, int, error) {
+	ma, err := strconv.Atoi(strings.TrimSuffix(major, "+"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid major version (%s) of the Kubernetes API server", major)
+	}
+	mi, err := strconv.Atoi(strings.TrimSuffix(minor, "+"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid minor version (%s) of the Kubernetes API server", minor)
+	}
+	return ma, mi, nil
+}
+
+func (v *serverVersion) set(major, minor int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.major, v.minor = major, minor
+}
+
+// AtLeast tells whether the API server is at least of the given version. An undetected version is the latest one.
+func (v *serverVersion) AtLeast(major, minor int) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.major == 0 {
+		return true
+	}
+	return v.major > major || v.major == major && v.minor >= minor
+}
+
+// AdjustPod drops the fields of the pod the API server does not know, and what relies on them:
+// before 1.10, the containers of a pod cannot share its process namespace, which the TLS reloader sidecar needs
+// to signal the exporter. The exporter then keeps the certificates it started with.
+func (v *serverVersion) AdjustPod(pod *v1.Pod) {
+	if v.AtLeast(1, 10) || pod.Spec.ShareProcessNamespace == nil {
+		return
+	}
+	pod.Spec.ShareProcessNamespace = nil
+	containers := pod.Spec.Containers[:0]
+	for _, c := range pod.Spec.Containers {
+		if c.Name != tlsReloaderName {
+			containers = append(containers, c)
+		}
+	}
+	pod.Spec.Containers = containers
+	logrus.Warningf("pod (%s) created without the %s sidecar: the Kubernetes API server does not support sharing the process namespace", pod.Name, tlsReloaderName)
+}
+
+// AdjustService sets the fields of the service that replace the annotations of older API servers:
+// from 1.9, the endpoints of unready pods are published with spec.publishNotReadyAddresses.
+// The annotations are kept for the API servers that still read them.
+func (v *serverVersion) AdjustService(svc *v1.Service) {
+	if v.AtLeast(1, 9) && svc.Annotations[TolerateUnreadyEndpointsAnnotation] == "true" {
+		svc.Spec.PublishNotReadyAddresses = true
+	}
+}
+
+// CreatePod creates the pod, adjusted to the version of the API server.
+func CreatePod(kubecli kubernetes.Interface, ns string, pod *v1.Pod) (*v1.Pod, error) {
+	ServerVersion.AdjustPod(pod)
+	return kubecli.CoreV1().Pods(ns).Create(pod)
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	major, minor, err := parseServerVersion("1", "10+")
+	if err != nil || major != 1 || minor != 10 {
+		t.Errorf("expect 1.10, got %d.%d (%v)", major, minor, err)
+	}
+	if _, _, err := parseServerVersion("1", ""); err == nil {
+		t.Error("expect an error for an empty minor version")
+	}
+}
+
+func TestAdjustPod(t *testing.T) {
+	newPod := func() *v1.Pod {
+		share := true
+		return &v1.Pod{Spec: v1.PodSpec{
+			ShareProcessNamespace: &share,
+			Containers:            []v1.Container{{Name: "etcd"}, {Name: "exporter"}, {Name: tlsReloaderName}},
+		}}
+	}
+
+	pod := newPod()
+	(&serverVersion{major: 1, minor: 10}).AdjustPod(pod)
+	if pod.Spec.ShareProcessNamespace == nil || len(pod.Spec.Containers) != 3 {
+		t.Errorf("expect the pod unchanged on 1.10, got %+v", pod.Spec)
+	}
+
+	pod = newPod()
+	(&serverVersion{major: 1, minor: 9}).AdjustPod(pod)
+	if pod.Spec.ShareProcessNamespace != nil || len(pod.Spec.Containers) != 2 || pod.Spec.Containers[1].Name != "exporter" {
+		t.Errorf("expect the pod without process namespace sharing nor TLS reloader on 1.9, got %+v", pod.Spec)
+	}
+}
+
+func TestAdjustService(t *testing.T) {
+	newService := func() *v1.Service {
+		return newEtcdServiceManifest("test", "test", v1.ClusterIPNone, nil)
+	}
+	svc := newService()
+	(&serverVersion{major: 1, minor: 9}).AdjustService(svc)
+	if !svc.Spec.PublishNotReadyAddresses {
+		t.Error("expect publishNotReadyAddresses set on 1.9")
+	}
+	svc = newService()
+	(&serverVersion{major: 1, minor: 8}).AdjustService(svc)
+	if svc.Spec.PublishNotReadyAddresses {
+		t.Error("expect publishNotReadyAddresses not set on 1.8")
+	}
+}
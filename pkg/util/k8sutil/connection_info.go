@@ -0,0 +1,221 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Keys of the connection info ConfigMap and Secret of a cluster.
+const (
+	// ConnectionInfoEndpointsKey is the client service URL of the cluster.
+	ConnectionInfoEndpointsKey = "endpoints"
+	// ConnectionInfoMembersKey is the comma separated client URLs of the members.
+	ConnectionInfoMembersKey = "members"
+	// ConnectionInfoCAKey is the CA certificate of the server certificates, only set for TLS clusters.
+	ConnectionInfoCAKey = "ca.crt"
+	// ConnectionInfoBalancedEndpointsKey is the comma separated client URLs of the members, in the order
+	// clients balancing over them should prefer them, followed by the client service URL.
+	ConnectionInfoBalancedEndpointsKey = "balanced-endpoints"
+	// ConnectionInfoMemberHintsKey is the JSON list of the MemberEndpoint of the members, in the same order.
+	ConnectionInfoMemberHintsKey = "members.json"
+)
+
+// MemberEndpoint is the client URL of a member, with the hints of clients balancing over the members.
+type MemberEndpoint struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Ready tells whether the pod of the member was ready at the last reconcile.
+	Ready bool `json:"ready"`
+	// Leader tells whether the member was the leader at the last health check.
+	Leader bool `json:"leader,omitempty"`
+}
+
+// sortMemberEndpoints sorts the members in the order clients should prefer them: the ready followers first,
+// which spreads the reads off the leader, then the leader, then the members that are not ready, each by name.
+func sortMemberEndpoints(members []MemberEndpoint) {
+	rank := func(m MemberEndpoint) int {
+		switch {
+		case m.Ready && !m.Leader:
+			return 0
+		case m.Ready:
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if ri, rj := rank(members[i]), rank(members[j]); ri != rj {
+			return ri < rj
+		}
+		return members[i].Name < members[j].Name
+	})
+}
+
+const (
+	// EtcdctlEnvFile is the key of the etcdctl Secret with the shell file to source.
+	EtcdctlEnvFile = "etcdctl.env"
+	// EtcdctlSecretMountDir is the directory the etcdctl Secret is expected to be mounted at,
+	// which the certificate paths in EtcdctlEnvFile point to.
+	EtcdctlSecretMountDir = "/etc/etcdctl"
+)
+
+// ConnectionInfoName returns the name of the ConfigMap, and for TLS clusters the Secret,
+// that application pods mount to connect to the cluster.
+func ConnectionInfoName(clusterName string) string {
+	return clusterName + "-connection"
+}
+
+// ClientServiceURL returns the URL of the client service of the cluster.
+func ClientServiceURL(clusterName, ns string, port int, secure bool) string {
+	return etcdutil.URL(secure, fmt.Sprintf("%s.%s.svc", ClientServiceName(clusterName), ns), port)
+}
+
+// NewConnectionInfoConfigMap returns the ConfigMap with the endpoints of the cluster, and its CA if ca is set.
+// Simple clients use the client service, and clients balancing over the members the hints of the members.
+func NewConnectionInfoConfigMap(clusterName, ns string, port int, secure bool, members []MemberEndpoint, ca []byte, owner metav1.OwnerReference) *v1.ConfigMap {
+	svc := ClientServiceURL(clusterName, ns, port, secure)
+	members = append([]MemberEndpoint{}, members...)
+	var urls []string
+	for _, m := range members {
+		urls = append(urls, m.URL)
+	}
+	sort.Strings(urls)
+	sortMemberEndpoints(members)
+	balanced := []string{}
+	for _, m := range members {
+		balanced = append(balanced, m.URL)
+	}
+	hints, _ := json.Marshal(members)
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ConnectionInfoName(clusterName),
+			Namespace: ns,
+			Labels:    LabelsForCluster(clusterName),
+		},
+		Data: map[string]string{
+			ConnectionInfoEndpointsKey:         svc,
+			ConnectionInfoMembersKey:           strings.Join(urls, ","),
+			ConnectionInfoBalancedEndpointsKey: strings.Join(append(balanced, svc), ","),
+			ConnectionInfoMemberHintsKey:       string(hints),
+		},
+	}
+	if len(ca) != 0 {
+		cm.Data[ConnectionInfoCAKey] = string(ca)
+	}
+	addOwnerRefToObject(cm.GetObjectMeta(), owner)
+	return cm
+}
+
+// NewConnectionInfoSecret returns the TLS Secret with the client certificate, key and CA of a TLS cluster.
+func NewConnectionInfoSecret(clusterName, ns string, d *TLSData, owner metav1.OwnerReference) *v1.Secret {
+	s := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ConnectionInfoName(clusterName),
+			Namespace: ns,
+			Labels:    LabelsForCluster(clusterName),
+		},
+		Type: v1.SecretTypeTLS,
+		Data: map[string][]byte{
+			v1.TLSCertKey:       d.CertData,
+			v1.TLSPrivateKeyKey: d.KeyData,
+			ConnectionInfoCAKey: d.CAData,
+		},
+	}
+	addOwnerRefToObject(s.GetObjectMeta(), owner)
+	return s
+}
+
+// EtcdctlSecretName returns the name of the Secret with the etcdctl environment of the cluster.
+func EtcdctlSecretName(clusterName string) string {
+	return clusterName + "-etcdctl"
+}
+
+// NewEtcdctlSecret returns the Secret with a shell file that configures etcdctl for the cluster.
+// Mounted at EtcdctlSecretMountDir, `source /etc/etcdctl/etcdctl.env` sets ETCDCTL_API and ETCDCTL_ENDPOINTS,
+// and for TLS clusters ETCDCTL_CACERT, ETCDCTL_CERT and ETCDCTL_KEY pointing to the certificates in the Secret.
+// d is nil for clusters without TLS.
+func NewEtcdctlSecret(clusterName, ns string, port int, d *TLSData, owner metav1.OwnerReference) *v1.Secret {
+	env := "export ETCDCTL_API=3\n" +
+		fmt.Sprintf("export ETCDCTL_ENDPOINTS=%s\n", ClientServiceURL(clusterName, ns, port, d != nil))
+	data := map[string][]byte{}
+	if d != nil {
+		env += fmt.Sprintf("export ETCDCTL_CACERT=%[1]s/%[2]s\nexport ETCDCTL_CERT=%[1]s/%[3]s\nexport ETCDCTL_KEY=%[1]s/%[4]s\n",
+			EtcdctlSecretMountDir, etcdutil.CliCAFile, etcdutil.CliCertFile, etcdutil.CliKeyFile)
+		data[etcdutil.CliCAFile] = d.CAData
+		data[etcdutil.CliCertFile] = d.CertData
+		data[etcdutil.CliKeyFile] = d.KeyData
+	}
+	data[EtcdctlEnvFile] = []byte(env)
+
+	s := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      EtcdctlSecretName(clusterName),
+			Namespace: ns,
+			Labels:    LabelsForCluster(clusterName),
+		},
+		Data: data,
+	}
+	addOwnerRefToObject(s.GetObjectMeta(), owner)
+	return s
+}
+
+// ApplyConfigMap creates the ConfigMap, or updates its data if it exists with other data.
+func ApplyConfigMap(kubecli kubernetes.Interface, cm *v1.ConfigMap) error {
+	cmi := kubecli.CoreV1().ConfigMaps(cm.Namespace)
+	cur, err := cmi.Get(cm.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = cmi.Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(cur.Data, cm.Data) {
+		return nil
+	}
+	cur.Data = cm.Data
+	_, err = cmi.Update(cur)
+	return err
+}
+
+// ApplySecret creates the Secret, or updates its data if it exists with other data.
+func ApplySecret(kubecli kubernetes.Interface, s *v1.Secret) error {
+	si := kubecli.CoreV1().Secrets(s.Namespace)
+	cur, err := si.Get(s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = si.Create(s)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(cur.Data, s.Data) {
+		return nil
+	}
+	cur.Data = s.Data
+	_, err = si.Update(cur)
+	return err
+}
@@ -25,6 +25,7 @@ import (
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 )
 
@@ -76,6 +77,30 @@ func CreateCRD(clientset apiextensionsclient.Interface, crdName, rkind, rplural,
 	return nil
 }
 
+// PrinterColumn is an additional printer column of a CRD, shown by `kubectl get`.
+type PrinterColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	JSONPath    string `json:"JSONPath"`
+	Description string `json:"description,omitempty"`
+	// Priority 0 columns are always shown, the others only with `kubectl get -o wide`.
+	Priority int `json:"priority,omitempty"`
+}
+
+// SetCRDPrinterColumns sets the additional printer columns of the CRD.
+// The vendored apiextensions types predate additionalPrinterColumns, so the CRD is patched instead.
+// API servers before Kubernetes 1.11 ignore the columns.
+func SetCRDPrinterColumns(clientset apiextensionsclient.Interface, crdName string, columns []PrinterColumn) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{"additionalPrinterColumns": columns},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Patch(crdName, types.MergePatchType, patch)
+	return err
+}
+
 func WaitCRDReady(clientset apiextensionsclient.Interface, crdName string) error {
 	err := retryutil.Retry(5*time.Second, 20, func() (bool, error) {
 		crd, err := clientset.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crdName, metav1.GetOptions{})
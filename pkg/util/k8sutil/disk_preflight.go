@@ -0,0 +1,122 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DiskPreflightContainerName is the name of the container of the disk preflight pod running fio.
+	DiskPreflightContainerName = "preflight"
+	// diskPreflightLabel marks the disk preflight pod and PVC. They do not have the labels of the cluster,
+	// so that they are not taken for members.
+	diskPreflightLabel = "etcd_disk_preflight"
+	hostnameLabel      = "kubernetes.io/hostname"
+)
+
+// DiskPreflightName returns the name of the disk preflight pod, and PVC, of the cluster.
+func DiskPreflightName(clusterName string) string {
+	return childName(clusterName, "-disk-preflight")
+}
+
+// NewDiskPreflightPVC returns the throwaway PVC the disk preflight pod benchmarks.
+// It is claimed like the WAL volume of a member if the spec has one, and like its data volume otherwise.
+func NewDiskPreflightPVC(clusterName, namespace string, cs api.ClusterSpec, owner metav1.OwnerReference) *v1.PersistentVolumeClaim {
+	spec := *cs.Pod.PersistentVolumeClaimSpec
+	if cs.Pod.WALVolumeClaimSpec != nil {
+		spec = *cs.Pod.WALVolumeClaimSpec
+	}
+	pvc := newPVC(DiskPreflightName(clusterName), spec, clusterName, namespace, owner)
+	pvc.Labels = map[string]string{diskPreflightLabel: clusterName}
+	return pvc
+}
+
+// NewDiskPreflightPod returns a pod that is scheduled like a new member of the cluster
+// and benchmarks the fdatasync latency of the volume a member would write its WAL to,
+// the way the etcd docs recommend with fio. The JSON output of fio is the log of the pod.
+// pvc is the volume to benchmark, nil for the empty dir a member without persistent volume uses.
+func NewDiskPreflightPod(clusterName, namespace string, cs api.ClusterSpec, pvc *v1.PersistentVolumeClaim, owner metav1.OwnerReference) *v1.Pod {
+	mountDir := etcdVolumeMountPath(cs.Pod)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DiskPreflightName(clusterName),
+			Namespace: namespace,
+			Labels:    map[string]string{diskPreflightLabel: clusterName},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  DiskPreflightContainerName,
+				Image: cs.DiskPreflight.Image,
+				Command: []string{"fio", "--name=etcd-disk-preflight", "--directory=" + mountDir,
+					"--rw=write", "--ioengine=sync", "--fdatasync=1", "--size=22m", "--bs=2300", "--output-format=json"},
+				VolumeMounts: etcdVolumeMounts(mountDir),
+			}},
+			RestartPolicy: v1.RestartPolicyNever,
+		},
+	}
+	AddEtcdVolumeToPod(pod, pvc)
+	if p := cs.Pod; p != nil {
+		// Only the scheduling constraints of the members apply, so that the pod lands where a new member could.
+		pod.Spec.Affinity = p.Affinity
+		pod.Spec.NodeSelector = p.NodeSelector
+		pod.Spec.Tolerations = p.Tolerations
+		pod.Spec.SchedulerName = p.SchedulerName
+	}
+	addOwnerRefToObject(pod.GetObjectMeta(), owner)
+	return pod
+}
+
+// PinPodToNode requires the pod to be scheduled on the node of the given hostname.
+func PinPodToNode(pod *v1.Pod, node string) {
+	requireNodeHostname(pod, v1.NodeSelectorOpIn, []string{node})
+}
+
+// KeepPodOffNodes requires the pod not to be scheduled on any of the nodes of the given hostnames.
+func KeepPodOffNodes(pod *v1.Pod, nodes []string) {
+	if len(nodes) == 0 {
+		return
+	}
+	requireNodeHostname(pod, v1.NodeSelectorOpNotIn, nodes)
+}
+
+// requireNodeHostname adds a hostname requirement to every required node selector term of the pod,
+// on a copy of its affinity, which may be shared with the pod policy of the cluster.
+func requireNodeHostname(pod *v1.Pod, op v1.NodeSelectorOperator, nodes []string) {
+	req := v1.NodeSelectorRequirement{Key: hostnameLabel, Operator: op, Values: nodes}
+	aff := pod.Spec.Affinity.DeepCopy()
+	if aff == nil {
+		aff = &v1.Affinity{}
+	}
+	if aff.NodeAffinity == nil {
+		aff.NodeAffinity = &v1.NodeAffinity{}
+	}
+	na := aff.NodeAffinity
+	if na.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		na.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{}
+	}
+	ns := na.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(ns.NodeSelectorTerms) == 0 {
+		ns.NodeSelectorTerms = []v1.NodeSelectorTerm{{}}
+	}
+	for i := range ns.NodeSelectorTerms {
+		t := &ns.NodeSelectorTerms[i]
+		t.MatchExpressions = append(t.MatchExpressions, req)
+	}
+	pod.Spec.Affinity = aff
+}
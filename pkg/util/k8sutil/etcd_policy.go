@@ -0,0 +1,228 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/pborman/uuid"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type experimentalFlag struct {
+	// minVersion is the first etcd minor version that has the flag.
+	minVersion etcdutil.MinorVersion
+	validate   func(value string) error
+}
+
+// experimentalFlags are the vetted etcd --experimental-* flags that can be set via spec.etcd.experimental.
+// The validators only accept values without spaces, since the etcd command line is split on spaces.
+var experimentalFlags = map[string]experimentalFlag{
+	"corrupt-check-time":                {etcdutil.MinorVersion{Major: 3, Minor: 3}, validateDuration},
+	"initial-corrupt-check":             {etcdutil.MinorVersion{Major: 3, Minor: 3}, validateBool},
+	"enable-lease-checkpoint":           {etcdutil.MinorVersion{Major: 3, Minor: 4}, validateBool},
+	"compaction-batch-limit":            {etcdutil.MinorVersion{Major: 3, Minor: 4}, validateInt},
+	"peer-skip-client-san-verification": {etcdutil.MinorVersion{Major: 3, Minor: 4}, validateBool},
+	"watch-progress-notify-interval":    {etcdutil.MinorVersion{Major: 3, Minor: 4}, validateDuration},
+}
+
+func validateDuration(value string) error {
+	_, err := time.ParseDuration(value)
+	return err
+}
+
+func validateBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	return err
+}
+
+func validateInt(value string) error {
+	_, err := strconv.Atoi(value)
+	return err
+}
+
+// logLevels maps the log levels of spec.etcd.logLevel to the capnslog levels of etcd before 3.4.
+var logLevels = map[string]string{
+	"debug": "DEBUG",
+	"info":  "INFO",
+	"warn":  "WARNING",
+	"error": "ERROR",
+}
+
+// ValidateEtcdPolicy checks the settings of spec.etcd that depend on the given etcd version:
+// - every flag of spec.etcd.experimental is vetted, exists in the version and has a valid value.
+// - spec.etcd.metrics is only set to "extensive" from etcd 3.3 on.
+// - the spec.etcd.backend* settings are only set from etcd 3.4 on.
+// - spec.etcd.logLevel is known and spec.etcd.logOutputs is only set from etcd 3.4 on.
+// - spec.etcd.initialClusterToken only has letters, digits, '-', '_' and '.'.
+func ValidateEtcdPolicy(p *api.EtcdPolicy, version string) error {
+	if p == nil {
+		return nil
+	}
+	v, err := etcdutil.ParseMinorVersion(version)
+	if err != nil {
+		return err
+	}
+
+	if p.Metrics == api.EtcdMetricsExtensive && v.LessThan(extensiveMetricsVersion) {
+		return fmt.Errorf("spec: etcd metrics (%s) requires etcd %s or later", p.Metrics, extensiveMetricsVersion)
+	}
+	if (len(p.BackendFreelistType) != 0 || p.BackendBatchIntervalInMillisecond != 0 || p.BackendBatchLimit != 0) &&
+		v.LessThan(backendTuningVersion) {
+		return fmt.Errorf("spec: etcd backend settings require etcd %s or later", backendTuningVersion)
+	}
+	if _, ok := logLevels[p.LogLevel]; len(p.LogLevel) != 0 && !ok {
+		return fmt.Errorf("spec: unknown etcd log level (%s)", p.LogLevel)
+	}
+	if len(p.LogOutputs) != 0 {
+		if v.LessThan(zapLoggerVersion) {
+			return fmt.Errorf("spec: etcd logOutputs requires etcd %s or later", zapLoggerVersion)
+		}
+		for _, o := range p.LogOutputs {
+			if len(o) == 0 || strings.ContainsAny(o, " ,") {
+				return fmt.Errorf("spec: invalid etcd log output (%s)", o)
+			}
+		}
+	}
+
+	if t := p.InitialClusterToken; len(t) != 0 && !isValidClusterToken(t) {
+		return fmt.Errorf("spec: invalid etcd initialClusterToken (%s), must only have letters, digits, '-', '_' and '.'", t)
+	}
+
+	for name, value := range p.Experimental {
+		f, ok := experimentalFlags[name]
+		if !ok {
+			return fmt.Errorf("spec: etcd experimental flag (%s) is not supported", name)
+		}
+		if v.LessThan(f.minVersion) {
+			return fmt.Errorf("spec: etcd experimental flag (%s) requires etcd %s or later", name, f.minVersion)
+		}
+		if err := f.validate(value); err != nil {
+			return fmt.Errorf("spec: invalid value (%s) of etcd experimental flag (%s): %v", value, name, err)
+		}
+	}
+	return nil
+}
+
+// isValidClusterToken tells whether the token is safe on the etcd command line and in the restore script.
+func isValidClusterToken(t string) bool {
+	for _, ch := range t {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '-', ch == '_', ch == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// InitialClusterToken returns the token the members of a new cluster with the given UID bootstrap with:
+// spec.etcd.initialClusterToken, or else the UID. A random token is returned without either.
+func InitialClusterToken(p *api.EtcdPolicy, uid types.UID) string {
+	switch {
+	case p != nil && len(p.InitialClusterToken) != 0:
+		return p.InitialClusterToken
+	case len(uid) != 0:
+		return string(uid)
+	}
+	return uuid.New()
+}
+
+// CapnslogLevel returns the capnslog level of etcd for a log level of spec.etcd.logLevel.
+func CapnslogLevel(level string) (string, bool) {
+	l, ok := logLevels[level]
+	return l, ok
+}
+
+// extensiveMetricsVersion is the first etcd minor version with the --metrics flag.
+var extensiveMetricsVersion = etcdutil.MinorVersion{Major: 3, Minor: 3}
+
+// backendTuningVersion is the first etcd minor version with the backend batch and freelist flags.
+var backendTuningVersion = etcdutil.MinorVersion{Major: 3, Minor: 4}
+
+// freelistTypeFlagVersion is the first etcd minor version where the freelist type flag is no longer experimental.
+var freelistTypeFlagVersion = etcdutil.MinorVersion{Major: 3, Minor: 6}
+
+// backendFlagArgs returns the etcd flags for the spec.etcd.backend* settings
+// in the form the given etcd version understands, each preceded by a space.
+func backendFlagArgs(p *api.EtcdPolicy, version string) string {
+	if p == nil {
+		return ""
+	}
+	args := ""
+	if len(p.BackendFreelistType) != 0 {
+		v, _ := etcdutil.ParseMinorVersion(version)
+		if v.LessThan(freelistTypeFlagVersion) {
+			args += " --experimental-backend-bbolt-freelist-type=" + p.BackendFreelistType
+		} else {
+			args += " --backend-bbolt-freelist-type=" + p.BackendFreelistType
+		}
+	}
+	if p.BackendBatchIntervalInMillisecond > 0 {
+		args += fmt.Sprintf(" --backend-batch-interval=%dms", p.BackendBatchIntervalInMillisecond)
+	}
+	if p.BackendBatchLimit > 0 {
+		args += fmt.Sprintf(" --backend-batch-limit=%d", p.BackendBatchLimit)
+	}
+	return args
+}
+
+// zapLoggerVersion is the first etcd minor version with the --log-level and --log-outputs flags.
+var zapLoggerVersion = etcdutil.MinorVersion{Major: 3, Minor: 4}
+
+// logFlagArgs returns the etcd flags for spec.etcd.logLevel and spec.etcd.logOutputs
+// in the form the given etcd version understands, each preceded by a space.
+func logFlagArgs(p *api.EtcdPolicy, version string) string {
+	if p == nil {
+		return ""
+	}
+	v, _ := etcdutil.ParseMinorVersion(version)
+	args := ""
+	if v.LessThan(zapLoggerVersion) {
+		if len(p.LogLevel) != 0 {
+			args += " --log-package-levels=*=" + logLevels[p.LogLevel]
+		}
+		return args
+	}
+	if len(p.LogLevel) != 0 {
+		args += " --log-level=" + p.LogLevel
+	}
+	if len(p.LogOutputs) != 0 {
+		args += " --log-outputs=" + strings.Join(p.LogOutputs, ",")
+	}
+	return args
+}
+
+// experimentalFlagArgs returns the --experimental-* flags in a stable order, each preceded by a space.
+func experimentalFlagArgs(experimental map[string]string) string {
+	names := make([]string, 0, len(experimental))
+	for name := range experimental {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := ""
+	for _, name := range names {
+		args += fmt.Sprintf(" --experimental-%s=%s", name, experimental[name])
+	}
+	return args
+}
@@ -17,6 +17,8 @@ package k8sutil
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
@@ -24,6 +26,7 @@ import (
 
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 func NewMemberAddEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
@@ -50,6 +53,198 @@ func ReplacingDeadMemberEvent(memberName string, cl *api.EtcdCluster) *v1.Event
 	return event
 }
 
+func MemberFailedEvent(memberName, cause, action, logLine string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Member Failed"
+	event.Message = fmt.Sprintf("Member %s failed: %s. %s. Last etcd log line: %s", memberName, cause, action, logLine)
+	return event
+}
+
+func ReplacingLeavingMemberEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Replacing Leaving Member"
+	event.Message = fmt.Sprintf("The member %s is being replaced as its pod is being deleted", memberName)
+	return event
+}
+
+func ReplacingCorruptedMemberEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Replacing Corrupted Member"
+	event.Message = fmt.Sprintf("The member %s keeps failing on corrupted data and is being replaced by a member that syncs its data from the others", memberName)
+	return event
+}
+
+func ReplacingRequestedMemberEvent(memberName, annotation string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Replacing Member"
+	event.Message = fmt.Sprintf("The member %s is being replaced as requested by the %s annotation", memberName, annotation)
+	return event
+}
+
+func MigratingMemberStorageEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Migrating Member Storage"
+	event.Message = fmt.Sprintf("The member %s is being replaced by a member on persistent volume claims of the storage class of spec.pod", memberName)
+	return event
+}
+
+func RestartingRequestedMemberEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Restarting Member"
+	event.Message = fmt.Sprintf("The member %s is being restarted in place as requested by the %s annotation", memberName, AnnotationRestart)
+	return event
+}
+
+func ShrinkingStepwiseEvent(steps []int, cl *api.EtcdCluster) *v1.Event {
+	sizes := make([]string, len(steps))
+	for i, s := range steps {
+		sizes[i] = strconv.Itoa(s)
+	}
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Shrinking Stepwise"
+	event.Message = fmt.Sprintf("The cluster shrinks through the sizes %s, with all members ready at each step", strings.Join(sizes, " -> "))
+	return event
+}
+
+func ClusterFailedEvent(reason string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Cluster Failed"
+	event.Message = fmt.Sprintf("The operator gave up on the cluster: %s. status.failure has the last actions of the operator and the state of the members", reason)
+	return event
+}
+
+func NewerSchemaEvent(schemaVersion int, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Newer Schema"
+	event.Message = fmt.Sprintf("The cluster was managed by an etcd operator of schema version %d, newer than the %d of this operator, which does not manage it", cl.Status.SchemaVersion, schemaVersion)
+	return event
+}
+
+func ClusterExpiringEvent(expiry time.Time, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Cluster Expiring"
+	event.Message = fmt.Sprintf("The cluster expires at %s, when the operator deletes it as of spec.ttlInSecond", expiry.Format(time.RFC3339))
+	return event
+}
+
+func ClusterExpiredEvent(ttl time.Duration, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Cluster Expired"
+	event.Message = fmt.Sprintf("The cluster is deleted: it expired after its TTL of %v", ttl)
+	return event
+}
+
+func LearnerPromotedEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Learner Promoted"
+	event.Message = fmt.Sprintf("Learner %s caught up and was promoted to a voting member", memberName)
+	return event
+}
+
+func StuckLearnerEvent(memberName string, timeout time.Duration, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Replacing Stuck Learner"
+	event.Message = fmt.Sprintf("Learner %s did not catch up within %v and is being replaced", memberName, timeout)
+	return event
+}
+
+func RepairPausedEvent(memberName string, replacements int, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Repair Paused"
+	event.Message = fmt.Sprintf("Not replacing member %s: %d members were replaced within the last hour", memberName, replacements)
+	return event
+}
+
+func QuotaExceededEvent(reason string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Quota Exceeded"
+	event.Message = fmt.Sprintf("Not managing the cluster: %s", reason)
+	return event
+}
+
+func BootstrapTimedOutEvent(timeout time.Duration, diagnostics string, retry bool, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Bootstrap Timed Out"
+	action := "The cluster is marked Failed"
+	if retry {
+		action = "The cluster is created anew"
+	}
+	event.Message = fmt.Sprintf("The cluster did not come up within %v: %s. Its pods are deleted. %s", timeout, diagnostics, action)
+	return event
+}
+
+func MembershipRefreshedEvent(changes string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Membership Refreshed"
+	event.Message = fmt.Sprintf("The membership read from etcd differs from the one the operator knew: %s", changes)
+	return event
+}
+
+func RecreatingEmptyClusterEvent(cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Recreating Empty Cluster"
+	event.Message = "All members are dead and the cluster has no backup. The cluster is recreated without any of its data, as spec.selfHealing.recreateEmpty is set"
+	return event
+}
+
+func RestoringFromBackupEvent(backupName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Restoring From Backup"
+	event.Message = fmt.Sprintf("The cluster lost quorum and is restored from its latest backup %s, as spec.selfHealing.restoreFromBackup is set. The writes since the backup are lost", backupName)
+	return event
+}
+
+func StandbyRestoringEvent(backupName, primary string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Standby Restoring"
+	event.Message = fmt.Sprintf("The standby cluster is restored from backup %s of cluster %s", backupName, primary)
+	return event
+}
+
+func StandbyPromotedEvent(primary string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Standby Promoted"
+	event.Message = fmt.Sprintf("The standby cluster of cluster %s is promoted: it is no longer restored from its backups and its connection info is published", primary)
+	return event
+}
+
+func PreUpgradeBackupEvent(backupName, version string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Backing Up Before Upgrade"
+	event.Message = fmt.Sprintf("The cluster is backed up by backup %s before it is upgraded from %s. The upgrade starts once the backup is verified", backupName, version)
+	return event
+}
+
+func FinalSnapshotEvent(backupName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Final Snapshot"
+	event.Message = fmt.Sprintf("The cluster is backed up by backup %s before it is torn down", backupName)
+	return event
+}
+
 func MemberUpgradedEvent(memberName, oldVersion, newVersion string, cl *api.EtcdCluster) *v1.Event {
 	event := newClusterEvent(cl)
 	event.Type = v1.EventTypeNormal
@@ -58,6 +253,102 @@ func MemberUpgradedEvent(memberName, oldVersion, newVersion string, cl *api.Etcd
 	return event
 }
 
+func DiskPreflightPassedEvent(node string, p99 time.Duration, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Disk Preflight Passed"
+	event.Message = fmt.Sprintf("Node %s has a fsync p99 of %v, adding a member on it", node, p99)
+	return event
+}
+
+func DiskPreflightFailedEvent(node string, p99, max time.Duration, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Disk Preflight Failed"
+	event.Message = fmt.Sprintf("Node %s has a fsync p99 of %v, above %v: not adding members on it", node, p99, max)
+	return event
+}
+
+func RequestedMaintenanceEvent(message string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Maintenance Done"
+	event.Message = message
+	return event
+}
+
+func RefusedMaintenanceEvent(message string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Maintenance Refused"
+	event.Message = message
+	return event
+}
+
+func StalePodDeletedEvent(podName string, ownerUID types.UID, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Stale Pod Deleted"
+	event.Message = fmt.Sprintf("Pod %s belongs to an earlier cluster of the same name (uid %v) and was deleted to keep it out of the cluster", podName, ownerUID)
+	return event
+}
+
+func PodCreationFailedEvent(message string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Pod Creation Failed"
+	event.Message = message
+	return event
+}
+
+func InterventionRequiredEvent(reason, message string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Intervention Required"
+	event.Message = fmt.Sprintf("%s: %s. The operator takes no destructive action on the cluster until it is repaired", reason, message)
+	return event
+}
+
+func PodForceDeletedEvent(podName, nodeName string, stuck time.Duration, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Pod Force Deleted"
+	event.Message = fmt.Sprintf("Pod %s was still terminating on node %s %v after its grace period and was force deleted. Its member is removed from the cluster", podName, nodeName, stuck)
+	return event
+}
+
+func MemberVolumeLostEvent(memberName, nodeName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Member Volume Lost"
+	event.Message = fmt.Sprintf("Member %s claims a local volume of node %s, which is gone. It is replaced by a new member with a fresh volume", memberName, nodeName)
+	return event
+}
+
+func ClockSkewEvent(memberName string, skew time.Duration, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Clock Skew"
+	event.Message = fmt.Sprintf("The clock of member %s is off from the clock of the operator by %v. Check the time synchronization of the nodes", memberName, skew)
+	return event
+}
+
+func ServiceRepairedEvent(serviceName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Service Repaired"
+	event.Message = fmt.Sprintf("Service %s was deleted or changed and has been repaired", serviceName)
+	return event
+}
+
+func CARotationEvent(message string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "CA Rotation"
+	event.Message = message
+	return event
+}
+
 func newClusterEvent(cl *api.EtcdCluster) *v1.Event {
 	t := time.Now()
 	return &v1.Event{
@@ -17,16 +17,19 @@ package k8sutil
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"net"
 	"net/url"
 	"os"
+	"path"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
-	"github.com/pborman/uuid"
 
 	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	"k8s.io/api/core/v1"
@@ -37,6 +40,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	utilrand "k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // for gcp auth
 	"k8s.io/client-go/rest"
@@ -44,12 +48,15 @@ import (
 
 const (
 	// EtcdClientPort is the client port on client service and etcd nodes.
-	EtcdClientPort = 2379
+	EtcdClientPort = etcdutil.ClientPort
+	// EtcdPeerPort is the peer port on the peer service and etcd nodes.
+	EtcdPeerPort = etcdutil.PeerPort
 
 	etcdVolumeMountDir       = "/var/etcd"
-	dataDir                  = etcdVolumeMountDir + "/data"
-	backupFile               = "/var/etcd/latest.backup"
+	etcdWALVolumeMountDir    = "/var/etcd-wal"
+	walDir                   = etcdWALVolumeMountDir + "/wal"
 	etcdVersionAnnotationKey = "etcd.version"
+	etcdMetricsAnnotationKey = "etcd.metrics"
 	peerTLSDir               = "/etc/etcdtls/member/peer-tls"
 	peerTLSVolume            = "member-peer-tls"
 	serverTLSDir             = "/etc/etcdtls/member/server-tls"
@@ -60,13 +67,57 @@ const (
 	randomSuffixLength = 10
 	// k8s object name has a maximum length
 	maxNameLength = 63 - randomSuffixLength - 1
+	// nameHashLength is the length of the hash of the cluster name that ends a sanitized name.
+	nameHashLength = 8
 
 	defaultBusyboxImage = "busybox:1.28.0-glibc"
 
+	// DefaultBackupHelperImage is the default image of the container that fetches a backup
+	// before it is restored, e.g. into the seed member of a restored cluster.
+	DefaultBackupHelperImage = "tutum/curl"
+
 	// AnnotationScope annotation name for defining instance scope. Used for specifing cluster wide clusters.
 	AnnotationScope = "etcd.database.coreos.com/scope"
 	//AnnotationClusterWide annotation value for cluster wide clusters.
 	AnnotationClusterWide = "clusterwide"
+	// AnnotationLogLevel annotation name on an etcd pod for temporarily running the member at another log level.
+	AnnotationLogLevel = "etcd.database.coreos.com/log-level"
+	// AnnotationReplace requests the replacement of a member: "true" on the member's pod,
+	// or the member name on the EtcdCluster.
+	AnnotationReplace = "etcd.database.coreos.com/replace"
+	// AnnotationRestart requests the restart of a member in place, keeping its name, membership and, on persistent volumes,
+	// its data: "true" on the member's pod, or the member name on the EtcdCluster.
+	AnnotationRestart = "etcd.database.coreos.com/restart"
+	// AnnotationHandsOff set to "true" on the pod of a member excludes the member from automation, e.g. while a human
+	// investigates it: the operator neither deletes, replaces nor upgrades it.
+	AnnotationHandsOff = "etcd.database.coreos.com/hands-off"
+	// AnnotationDebugToolbox set to "true" on an EtcdCluster adds a toolbox container to the etcd pods created from then on.
+	AnnotationDebugToolbox = "etcd.database.coreos.com/debug-toolbox"
+	// AnnotationDefrag set to "now" on an EtcdCluster requests the defragmentation of its members.
+	AnnotationDefrag = "etcd.database.coreos.com/defrag"
+	// AnnotationCompact set to a revision on an EtcdCluster requests the compaction of its history up to that revision.
+	AnnotationCompact = "etcd.database.coreos.com/compact"
+	// AnnotationRotateCA set to a duration on a TLS EtcdCluster requests the rotation of its CA,
+	// with both the old and the new CA trusted for that long before the members move to the new one.
+	AnnotationRotateCA = "etcd.database.coreos.com/rotate-ca"
+	// AnnotationMemberGeneration on an etcd pod is the generation of its member: members are numbered from 1 in the order they are created.
+	AnnotationMemberGeneration = "etcd.database.coreos.com/member-generation"
+	// AnnotationMemberCreationReason on an etcd pod is the reason its member was created for.
+	AnnotationMemberCreationReason = "etcd.database.coreos.com/member-creation-reason"
+	// AnnotationRetained on a persistent volume claim or a secret tells that the deletion policy of its deleted cluster kept it.
+	// The operator never deletes it as an orphan.
+	AnnotationRetained = "etcd.database.coreos.com/retained"
+	// AnnotationDeleteSnapshots set to "true" on an EtcdBackup requests the backup operator to delete
+	// the snapshots the backup saved, then the EtcdBackup.
+	AnnotationDeleteSnapshots = "etcd.database.coreos.com/delete-snapshots"
+	// AnnotationPromote set to "now" on a standby EtcdCluster requests its promotion to a cluster of its own.
+	AnnotationPromote = "etcd.database.coreos.com/promote"
+	// AnnotationStandbyBackup on the EtcdRestore of a standby cluster is the name of the EtcdBackup of the primary it restores.
+	AnnotationStandbyBackup = "etcd.database.coreos.com/standby-backup"
+	// AnnotationStandbyBackupTime on the EtcdRestore of a standby cluster is the time, in RFC3339, the restored snapshot was saved.
+	AnnotationStandbyBackupTime = "etcd.database.coreos.com/standby-backup-time"
+	// FinalizerDeletionPolicy holds a deleted EtcdCluster until the operator applied its spec.deletionPolicy.
+	FinalizerDeletionPolicy = "etcd.database.coreos.com/deletion-policy"
 )
 
 const TolerateUnreadyEndpointsAnnotation = "service.alpha.kubernetes.io/tolerate-unready-endpoints"
@@ -79,6 +130,28 @@ func SetEtcdVersion(pod *v1.Pod, version string) {
 	pod.Annotations[etcdVersionAnnotationKey] = version
 }
 
+// SetMemberCreation annotates the pod with the generation of its member and the reason it is created for.
+func SetMemberCreation(pod *v1.Pod, generation int64, reason api.MemberCreationReason) {
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[AnnotationMemberGeneration] = strconv.FormatInt(generation, 10)
+	pod.Annotations[AnnotationMemberCreationReason] = string(reason)
+}
+
+// GetEtcdMetrics returns the metrics verbosity the etcd member of the pod was started with.
+func GetEtcdMetrics(pod *v1.Pod) string {
+	if m, ok := pod.Annotations[etcdMetricsAnnotationKey]; ok {
+		return m
+	}
+	// pods created before spec.etcd.metrics existed run etcd's default.
+	return api.EtcdMetricsBasic
+}
+
+func setEtcdMetrics(pod *v1.Pod, metrics string) {
+	pod.Annotations[etcdMetricsAnnotationKey] = metrics
+}
+
 func GetPodNames(pods []*v1.Pod) []string {
 	if len(pods) == 0 {
 		return nil
@@ -95,24 +168,34 @@ func PVCNameFromMember(memberName string) string {
 	return memberName
 }
 
-func makeRestoreInitContainers(backupURL *url.URL, token, repo, version string, m *etcdutil.Member) []v1.Container {
+// WALPVCNameFromMember returns the name of the PVC holding the WAL of the member.
+func WALPVCNameFromMember(memberName string) string {
+	return memberName + "-wal"
+}
+
+// etcdVolumeMountPath returns the path the etcd data volume is mounted at, as set in the PodPolicy or the default.
+func etcdVolumeMountPath(policy *api.PodPolicy) string {
+	if policy != nil && len(policy.DataVolumeMountPath) > 0 {
+		return path.Clean(policy.DataVolumeMountPath)
+	}
+	return etcdVolumeMountDir
+}
+
+func dataDir(mountDir string) string {
+	return mountDir + "/data"
+}
+
+func backupFile(mountDir string) string {
+	return mountDir + "/latest.backup"
+}
+
+func makeRestoreInitContainers(backupURL *url.URL, token, helperImage, repo, version string, m *etcdutil.Member, skipHashCheck bool, mountDir string) []v1.Container {
+	restoreFlags := ""
+	if skipHashCheck {
+		restoreFlags = " --skip-hash-check"
+	}
 	return []v1.Container{
-		{
-			Name:  "fetch-backup",
-			Image: "tutum/curl",
-			Command: []string{
-				"/bin/bash", "-ec",
-				fmt.Sprintf(`
-httpcode=$(curl --write-out %%\{http_code\} --silent --output %[1]s %[2]s)
-if [[ "$httpcode" != "200" ]]; then
-	echo "http status code: ${httpcode}" >> /dev/termination-log
-	cat %[1]s >> /dev/termination-log
-	exit 1
-fi
-					`, backupFile, backupURL.String()),
-			},
-			VolumeMounts: etcdVolumeMounts(),
-		},
+		fetchBackupContainer(helperImage, backupURL, mountDir),
 		{
 			Name:  "restore-datadir",
 			Image: ImageName(repo, version),
@@ -123,13 +206,81 @@ fi
 					" --initial-cluster %[2]s=%[3]s"+
 					" --initial-cluster-token %[4]s"+
 					" --initial-advertise-peer-urls %[3]s"+
-					" --data-dir %[5]s 2>/dev/termination-log", backupFile, m.Name, m.PeerURL(), token, dataDir),
+					" --data-dir %[5]s%[6]s 2>/dev/termination-log", backupFile(mountDir), m.Name, m.PeerURL(), token, dataDir(mountDir), restoreFlags),
 			},
-			VolumeMounts: etcdVolumeMounts(),
+			VolumeMounts: etcdVolumeMounts(mountDir),
 		},
 	}
 }
 
+// fetchBackupContainer returns a container of the given image downloading the backup at backupURL
+// into the etcd volume mounted at mountDir. The image must ship bash and curl.
+func fetchBackupContainer(image string, backupURL *url.URL, mountDir string) v1.Container {
+	return v1.Container{
+		Name:  "fetch-backup",
+		Image: image,
+		Command: []string{
+			"/bin/bash", "-ec",
+			fmt.Sprintf(`
+httpcode=$(curl --write-out %%\{http_code\} --silent --output %[1]s '%[2]s')
+if [[ "$httpcode" != "200" ]]; then
+	echo "http status code: ${httpcode}" >> /dev/termination-log
+	cat %[1]s >> /dev/termination-log
+	exit 1
+fi
+				`, backupFile(mountDir), backupURL.String()),
+		},
+		VolumeMounts: etcdVolumeMounts(mountDir),
+	}
+}
+
+// NewBackupVerifyPod returns a throwaway pod checking the backup at backupURL is restorable.
+// It restores the backup into a single member data dir, runs etcd on it and
+// succeeds once the member reports healthy. The termination message of the verify container
+// is then the JSON output of counting the keys of the member, whose header holds its revision.
+// The backup is fetched with helperImage, or DefaultBackupHelperImage if empty.
+func NewBackupVerifyPod(name, namespace string, backupURL *url.URL, helperImage, repo, version string, owner metav1.OwnerReference) *v1.Pod {
+	script := fmt.Sprintf(`
+ETCDCTL_API=3 etcdctl snapshot restore %[1]s --name verify --initial-cluster verify=%[3]s \
+	--initial-advertise-peer-urls %[3]s --data-dir %[2]s 2>/dev/termination-log
+/usr/local/bin/etcd --name verify --data-dir %[2]s --listen-peer-urls %[3]s \
+	--listen-client-urls %[4]s --advertise-client-urls %[4]s &
+i=0
+until ETCDCTL_API=3 etcdctl --endpoints %[4]s endpoint health; do
+	i=$((i+1))
+	if [ $i -ge 30 ]; then
+		echo "restored etcd member did not become healthy" > /dev/termination-log
+		exit 1
+	fi
+	sleep 1
+done
+ETCDCTL_API=3 etcdctl --endpoints %[4]s get "" --prefix --count-only -w json > /dev/termination-log
+`, backupFile(etcdVolumeMountDir), dataDir(etcdVolumeMountDir), etcdutil.URL(false, "localhost", EtcdPeerPort), etcdutil.URL(false, "localhost", EtcdClientPort))
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{fetchBackupContainer(backupHelperImage(nil, helperImage), backupURL, etcdVolumeMountDir)},
+			Containers: []v1.Container{{
+				Name:         "verify",
+				Image:        ImageName(repo, version),
+				Command:      []string{"/bin/sh", "-ec", script},
+				VolumeMounts: etcdVolumeMounts(etcdVolumeMountDir),
+			}},
+			RestartPolicy: v1.RestartPolicyNever,
+			Volumes: []v1.Volume{{
+				Name:         etcdVolumeName,
+				VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+			}},
+		},
+	}
+	addOwnerRefToObject(pod.GetObjectMeta(), owner)
+	return pod
+}
+
 func ImageName(repo, version string) string {
 	return fmt.Sprintf("%s:v%v", repo, version)
 }
@@ -142,54 +293,204 @@ func imageNameBusybox(policy *api.PodPolicy) string {
 	return defaultBusyboxImage
 }
 
+// backupHelperImage returns the image of the container fetching a backup: the image specified in the PodPolicy,
+// or else operatorImage, the one the operator is configured with, or else DefaultBackupHelperImage.
+func backupHelperImage(policy *api.PodPolicy, operatorImage string) string {
+	switch {
+	case policy != nil && len(policy.BackupHelperImage) > 0:
+		return policy.BackupHelperImage
+	case len(operatorImage) > 0:
+		return operatorImage
+	}
+	return DefaultBackupHelperImage
+}
+
 func PodWithNodeSelector(p *v1.Pod, ns map[string]string) *v1.Pod {
 	p.Spec.NodeSelector = ns
 	return p
 }
 
-func CreateClientService(kubecli kubernetes.Interface, clusterName, ns string, owner metav1.OwnerReference) error {
+// ApplyClientService creates the client service of the cluster, or repairs it if it was changed.
+// It returns whether the service was created or repaired.
+func ApplyClientService(kubecli kubernetes.Interface, clusterName, ns string, clientPort int, owner metav1.OwnerReference, labels map[string]string) (bool, error) {
 	ports := []v1.ServicePort{{
 		Name:       "client",
-		Port:       EtcdClientPort,
-		TargetPort: intstr.FromInt(EtcdClientPort),
+		Port:       int32(clientPort),
+		TargetPort: intstr.FromInt(clientPort),
 		Protocol:   v1.ProtocolTCP,
 	}}
-	return createService(kubecli, ClientServiceName(clusterName), clusterName, ns, "", ports, owner)
+	return applyService(kubecli, ClientServiceName(clusterName), clusterName, ns, "", ports, owner, labels)
 }
 
 func ClientServiceName(clusterName string) string {
-	return clusterName + "-client"
+	return childName(clusterName, "-client")
+}
+
+// PeerServiceName returns the name of the headless peer service of the cluster, which is the subdomain of its pods
+// and which the names of its members start with. It is the cluster name if that is a DNS-1035 label short enough
+// for the member names. Otherwise, e.g. for a name with dots, it is the cluster name sanitized into such a label
+// and followed by a hash of the cluster name, so that two clusters never get the same peer service.
+func PeerServiceName(clusterName string) string {
+	if len(clusterName) <= maxNameLength && len(validation.IsDNS1035Label(clusterName)) == 0 {
+		return clusterName
+	}
+	return sanitizeName(clusterName, maxNameLength)
 }
 
-func CreatePeerService(kubecli kubernetes.Interface, clusterName, ns string, owner metav1.OwnerReference) error {
+// MemberSubdomain returns the subdomain of the pods of the cluster, the name of its headless peer service:
+// spec.pod.subdomain if set, PeerServiceName otherwise.
+func MemberSubdomain(clusterName string, p *api.PodPolicy) string {
+	if p != nil && len(p.Subdomain) != 0 {
+		return p.Subdomain
+	}
+	return PeerServiceName(clusterName)
+}
+
+// validateSubdomain checks that spec.pod.subdomain can prefix the member names and does not
+// clash with the client service of the cluster.
+func validateSubdomain(clusterName string, p *api.PodPolicy) error {
+	if p == nil || len(p.Subdomain) == 0 {
+		return nil
+	}
+	if errs := validation.IsDNS1035Label(p.Subdomain); len(errs) != 0 || len(p.Subdomain) > maxNameLength {
+		return fmt.Errorf("spec: pod subdomain (%s) must be a DNS-1035 label of at most %d characters", p.Subdomain, maxNameLength)
+	}
+	if p.Subdomain == ClientServiceName(clusterName) {
+		return fmt.Errorf("spec: pod subdomain (%s) must not be the client service name", p.Subdomain)
+	}
+	return nil
+}
+
+// childName returns the name of a pod or service of the cluster, the peer service name followed by suffix,
+// sanitized and shortened if needed for it to be a DNS label.
+func childName(clusterName, suffix string) string {
+	if name := PeerServiceName(clusterName) + suffix; len(name) <= validation.DNS1123LabelMaxLength {
+		return name
+	}
+	return sanitizeName(clusterName, validation.DNS1123LabelMaxLength-len(suffix)) + suffix
+}
+
+// sanitizeName returns a DNS-1035 label of at most max characters made of name in lower case,
+// with the characters other than letters, digits and '-' replaced by '-', and a hash of name.
+func sanitizeName(name string, max int) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	hash := fmt.Sprintf("%0*x", nameHashLength, h.Sum32())
+
+	b := []byte(strings.ToLower(name))
+	for i, ch := range b {
+		if (ch < 'a' || ch > 'z') && (ch < '0' || ch > '9') {
+			b[i] = '-'
+		}
+	}
+	prefix := strings.Trim(string(b), "-")
+	if len(prefix) == 0 || prefix[0] < 'a' || prefix[0] > 'z' {
+		// A DNS-1035 label starts with a letter.
+		prefix = "etcd-" + prefix
+	}
+	if n := max - nameHashLength - 1; len(prefix) > n {
+		prefix = prefix[:n]
+	}
+	return strings.TrimRight(prefix, "-") + "-" + hash
+}
+
+// ApplyPeerService creates the headless peer service of the cluster, named after the subdomain of its pods,
+// or repairs it if it was changed. It returns whether the service was created or repaired.
+func ApplyPeerService(kubecli kubernetes.Interface, clusterName, subdomain, ns string, clientPort, peerPort int, owner metav1.OwnerReference, labels map[string]string) (bool, error) {
 	ports := []v1.ServicePort{{
 		Name:       "client",
-		Port:       EtcdClientPort,
-		TargetPort: intstr.FromInt(EtcdClientPort),
+		Port:       int32(clientPort),
+		TargetPort: intstr.FromInt(clientPort),
 		Protocol:   v1.ProtocolTCP,
 	}, {
 		Name:       "peer",
-		Port:       2380,
-		TargetPort: intstr.FromInt(2380),
+		Port:       int32(peerPort),
+		TargetPort: intstr.FromInt(peerPort),
 		Protocol:   v1.ProtocolTCP,
 	}}
 
-	return createService(kubecli, clusterName, clusterName, ns, v1.ClusterIPNone, ports, owner)
+	return applyService(kubecli, subdomain, clusterName, ns, v1.ClusterIPNone, ports, owner, labels)
 }
 
-func createService(kubecli kubernetes.Interface, svcName, clusterName, ns, clusterIP string, ports []v1.ServicePort, owner metav1.OwnerReference) error {
-	svc := newEtcdServiceManifest(svcName, clusterName, clusterIP, ports)
-	addOwnerRefToObject(svc.GetObjectMeta(), owner)
-	_, err := kubecli.CoreV1().Services(ns).Create(svc)
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return err
+// applyService creates the service if it does not exist. If it does, it restores the selector, ports
+// and unready endpoints annotation the operator relies on, keeping the node ports of the ports it restores
+// and whatever else was changed. A service that lost its headless cluster IP, which cannot be updated, is recreated.
+func applyService(kubecli kubernetes.Interface, svcName, clusterName, ns, clusterIP string, ports []v1.ServicePort, owner metav1.OwnerReference, labels map[string]string) (bool, error) {
+	want := newEtcdServiceManifest(svcName, clusterName, clusterIP, ports)
+	addOwnerRefToObject(want.GetObjectMeta(), owner)
+	AddLabels(want.GetObjectMeta(), labels)
+	ServerVersion.AdjustService(want)
+
+	svc, err := kubecli.CoreV1().Services(ns).Get(svcName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = kubecli.CoreV1().Services(ns).Create(want)
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
 	}
-	return nil
+	if err != nil {
+		return false, err
+	}
+
+	if clusterIP == v1.ClusterIPNone && svc.Spec.ClusterIP != v1.ClusterIPNone {
+		if err := kubecli.CoreV1().Services(ns).Delete(svcName, nil); err != nil && !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		_, err = kubecli.CoreV1().Services(ns).Create(want)
+		return err == nil, err
+	}
+	if serviceMatches(svc, want) {
+		return false, nil
+	}
+	svc.Spec.Selector = want.Spec.Selector
+	svc.Spec.Ports = withNodePorts(want.Spec.Ports, svc.Spec.Ports)
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	svc.Annotations[TolerateUnreadyEndpointsAnnotation] = "true"
+	svc.Spec.PublishNotReadyAddresses = want.Spec.PublishNotReadyAddresses
+	_, err = kubecli.CoreV1().Services(ns).Update(svc)
+	return err == nil, err
+}
+
+// serviceMatches tells whether svc has the selector, ports and unready endpoints annotation and field of want.
+func serviceMatches(svc, want *v1.Service) bool {
+	if !reflect.DeepEqual(svc.Spec.Selector, want.Spec.Selector) || svc.Annotations[TolerateUnreadyEndpointsAnnotation] != "true" {
+		return false
+	}
+	if want.Spec.PublishNotReadyAddresses && !svc.Spec.PublishNotReadyAddresses {
+		return false
+	}
+	if len(svc.Spec.Ports) != len(want.Spec.Ports) {
+		return false
+	}
+	for i, p := range want.Spec.Ports {
+		got := svc.Spec.Ports[i]
+		if got.Name != p.Name || got.Port != p.Port || got.TargetPort != p.TargetPort || got.Protocol != p.Protocol {
+			return false
+		}
+	}
+	return true
+}
+
+// withNodePorts returns the ports with the node ports of the current ports of the same name.
+func withNodePorts(ports, current []v1.ServicePort) []v1.ServicePort {
+	nodePorts := map[string]int32{}
+	for _, p := range current {
+		nodePorts[p.Name] = p.NodePort
+	}
+	res := make([]v1.ServicePort, len(ports))
+	for i, p := range ports {
+		p.NodePort = nodePorts[p.Name]
+		res[i] = p
+	}
+	return res
 }
 
 // CreateAndWaitPod creates a pod and waits until it is running
 func CreateAndWaitPod(kubecli kubernetes.Interface, ns string, pod *v1.Pod, timeout time.Duration) (*v1.Pod, error) {
-	_, err := kubecli.CoreV1().Pods(ns).Create(pod)
+	_, err := CreatePod(kubecli, ns, pod)
 	if err != nil {
 		return nil, err
 	}
@@ -253,9 +554,27 @@ func AddEtcdVolumeToPod(pod *v1.Pod, pvc *v1.PersistentVolumeClaim) {
 	pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
 }
 
-func addRecoveryToPod(pod *v1.Pod, token string, m *etcdutil.Member, cs api.ClusterSpec, backupURL *url.URL) {
+// AddEtcdWALVolumeToPod mounts the PVC in the etcd container of the pod and has etcd keep its WAL on it.
+func AddEtcdWALVolumeToPod(pod *v1.Pod, pvc *v1.PersistentVolumeClaim) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name: etcdWALVolumeName,
+		VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.Name},
+		},
+	})
+	for i := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[i]
+		if c.Name != "etcd" {
+			continue
+		}
+		c.Command = append(c.Command, "--wal-dir="+walDir)
+		c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{Name: etcdWALVolumeName, MountPath: etcdWALVolumeMountDir})
+	}
+}
+
+func addRecoveryToPod(pod *v1.Pod, token string, m *etcdutil.Member, cs api.ClusterSpec, backupURL *url.URL, helperImage string, skipHashCheck bool) {
 	pod.Spec.InitContainers = append(pod.Spec.InitContainers,
-		makeRestoreInitContainers(backupURL, token, cs.Repository, cs.Version, m)...)
+		makeRestoreInitContainers(backupURL, token, backupHelperImage(cs.Pod, helperImage), cs.Repository, cs.Version, m, skipHashCheck, etcdVolumeMountPath(cs.Pod))...)
 }
 
 func addOwnerRefToObject(o metav1.Object, r metav1.OwnerReference) {
@@ -263,25 +582,38 @@ func addOwnerRefToObject(o metav1.Object, r metav1.OwnerReference) {
 }
 
 // NewSeedMemberPod returns a Pod manifest for a seed member.
-// It's special that it has new token, and might need recovery init containers
-func NewSeedMemberPod(clusterName string, ms etcdutil.MemberSet, m *etcdutil.Member, cs api.ClusterSpec, owner metav1.OwnerReference, backupURL *url.URL) *v1.Pod {
-	token := uuid.New()
+// It's special that it bootstraps a new cluster with the initial cluster token of the cluster owning it,
+// and might need recovery init containers
+// that restore the data dir from the backup at backupURL. The backup is fetched with the image of
+// spec.pod.backupHelperImage, or else helperImage, or else DefaultBackupHelperImage.
+func NewSeedMemberPod(clusterName string, ms etcdutil.MemberSet, m *etcdutil.Member, cs api.ClusterSpec, owner metav1.OwnerReference, backupURL *url.URL, helperImage string, skipHashCheck bool) *v1.Pod {
+	token := InitialClusterToken(cs.Etcd, owner.UID)
 	pod := newEtcdPod(m, ms.PeerURLPairs(), clusterName, "new", token, cs)
 	// TODO: PVC datadir support for restore process
 	AddEtcdVolumeToPod(pod, nil)
 	if backupURL != nil {
-		addRecoveryToPod(pod, token, m, cs, backupURL)
+		addRecoveryToPod(pod, token, m, cs, backupURL, helperImage, skipHashCheck)
 	}
 	applyPodPolicy(clusterName, pod, cs.Pod)
+	addSidecars(pod, cs)
 	addOwnerRefToObject(pod.GetObjectMeta(), owner)
 	return pod
 }
 
 // NewEtcdPodPVC create PVC object from etcd pod's PVC spec
 func NewEtcdPodPVC(m *etcdutil.Member, pvcSpec v1.PersistentVolumeClaimSpec, clusterName, namespace string, owner metav1.OwnerReference) *v1.PersistentVolumeClaim {
+	return newPVC(PVCNameFromMember(m.Name), pvcSpec, clusterName, namespace, owner)
+}
+
+// NewEtcdPodWALPVC returns the PVC holding the WAL of the member, from the WAL volume claim spec.
+func NewEtcdPodWALPVC(m *etcdutil.Member, pvcSpec v1.PersistentVolumeClaimSpec, clusterName, namespace string, owner metav1.OwnerReference) *v1.PersistentVolumeClaim {
+	return newPVC(WALPVCNameFromMember(m.Name), pvcSpec, clusterName, namespace, owner)
+}
+
+func newPVC(name string, pvcSpec v1.PersistentVolumeClaimSpec, clusterName, namespace string, owner metav1.OwnerReference) *v1.PersistentVolumeClaim {
 	pvc := &v1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      PVCNameFromMember(m.Name),
+			Name:      name,
 			Namespace: namespace,
 			Labels:    LabelsForCluster(clusterName),
 		},
@@ -291,11 +623,53 @@ func NewEtcdPodPVC(m *etcdutil.Member, pvcSpec v1.PersistentVolumeClaimSpec, clu
 	return pvc
 }
 
+// etcdPolicyFlags returns the etcd flags for the settings of the given policy, each preceded by a space.
+func etcdPolicyFlags(p *api.EtcdPolicy) string {
+	if p == nil {
+		return ""
+	}
+	flags := ""
+	if p.MaxRequestBytes > 0 {
+		flags += fmt.Sprintf(" --max-request-bytes=%d", p.MaxRequestBytes)
+	}
+	if p.GRPCKeepAliveMinTimeInSecond > 0 {
+		flags += fmt.Sprintf(" --grpc-keepalive-min-time=%ds", p.GRPCKeepAliveMinTimeInSecond)
+	}
+	if p.GRPCKeepAliveIntervalInSecond > 0 {
+		flags += fmt.Sprintf(" --grpc-keepalive-interval=%ds", p.GRPCKeepAliveIntervalInSecond)
+	}
+	if p.GRPCKeepAliveTimeoutInSecond > 0 {
+		flags += fmt.Sprintf(" --grpc-keepalive-timeout=%ds", p.GRPCKeepAliveTimeoutInSecond)
+	}
+	if p.HeartbeatIntervalInMillisecond > 0 {
+		flags += fmt.Sprintf(" --heartbeat-interval=%d", p.HeartbeatIntervalInMillisecond)
+	}
+	if p.ElectionTimeoutInMillisecond > 0 {
+		flags += fmt.Sprintf(" --election-timeout=%d", p.ElectionTimeoutInMillisecond)
+	}
+	if p.SnapshotCount > 0 {
+		flags += fmt.Sprintf(" --snapshot-count=%d", p.SnapshotCount)
+	}
+	if p.QuotaBackendBytes > 0 {
+		flags += fmt.Sprintf(" --quota-backend-bytes=%d", p.QuotaBackendBytes)
+	}
+	if p.MaxWALs > 0 {
+		flags += fmt.Sprintf(" --max-wals=%d", p.MaxWALs)
+	}
+	if p.MaxSnapshots > 0 {
+		flags += fmt.Sprintf(" --max-snapshots=%d", p.MaxSnapshots)
+	}
+	if p.Metrics == api.EtcdMetricsExtensive {
+		flags += " --metrics=" + p.Metrics
+	}
+	return flags + experimentalFlagArgs(p.Experimental)
+}
+
 func newEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state, token string, cs api.ClusterSpec) *v1.Pod {
 	commands := fmt.Sprintf("/usr/local/bin/etcd --data-dir=%s --name=%s --initial-advertise-peer-urls=%s "+
 		"--listen-peer-urls=%s --listen-client-urls=%s --advertise-client-urls=%s "+
 		"--initial-cluster=%s --initial-cluster-state=%s",
-		dataDir, m.Name, m.PeerURL(), m.ListenPeerURL(), m.ListenClientURL(), m.ClientURL(), strings.Join(initialCluster, ","), state)
+		dataDir(etcdVolumeMountPath(cs.Pod)), m.Name, m.PeerURL(), m.ListenPeerURL(), m.ListenClientURL(), m.ClientURL(), strings.Join(initialCluster, ","), state)
 	if m.SecurePeer {
 		commands += fmt.Sprintf(" --peer-client-cert-auth=true --peer-trusted-ca-file=%[1]s/peer-ca.crt --peer-cert-file=%[1]s/peer.crt --peer-key-file=%[1]s/peer.key", peerTLSDir)
 	}
@@ -305,6 +679,9 @@ func newEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 	if state == "new" {
 		commands = fmt.Sprintf("%s --initial-cluster-token=%s", commands, token)
 	}
+	commands += etcdPolicyFlags(cs.Etcd)
+	commands += backendFlagArgs(cs.Etcd, cs.Version)
+	commands += logFlagArgs(cs.Etcd, cs.Version)
 
 	labels := map[string]string{
 		"app":          "etcd",
@@ -312,17 +689,18 @@ func newEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 		"etcd_cluster": clusterName,
 	}
 
-	livenessProbe := newEtcdProbe(cs.TLS.IsSecureClient())
-	readinessProbe := newEtcdProbe(cs.TLS.IsSecureClient())
+	livenessProbe := newEtcdProbe(cs.TLS.IsSecureClient(), cs.ClientPort)
+	readinessProbe := newEtcdProbe(cs.TLS.IsSecureClient(), cs.ClientPort)
 	readinessProbe.InitialDelaySeconds = 1
 	readinessProbe.TimeoutSeconds = 5
 	readinessProbe.PeriodSeconds = 5
 	readinessProbe.FailureThreshold = 3
 
 	container := containerWithProbes(
-		etcdContainer(strings.Split(commands, " "), cs.Repository, cs.Version),
+		etcdContainer(strings.Split(commands, " "), cs),
 		livenessProbe,
 		readinessProbe)
+	container.Lifecycle = newEtcdPreStopHook(cs.TLS.IsSecureClient(), cs.ClientPort)
 
 	volumes := []v1.Volume{}
 
@@ -372,21 +750,42 @@ func newEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 					done`, m.Addr())},
 			}},
 			Containers:    []v1.Container{container},
-			RestartPolicy: v1.RestartPolicyNever,
+			RestartPolicy: etcdRestartPolicy(cs),
 			Volumes:       volumes,
-			// DNS A record: `[m.Name].[clusterName].Namespace.svc`
+			// DNS A record: `[m.Name].[subdomain].Namespace.svc`
 			// For example, etcd-795649v9kq in default namesapce will have DNS name
 			// `etcd-795649v9kq.etcd.default.svc`.
 			Hostname:                     m.Name,
-			Subdomain:                    clusterName,
+			Subdomain:                    MemberSubdomain(clusterName, cs.Pod),
 			AutomountServiceAccountToken: func(b bool) *bool { return &b }(false),
 			SecurityContext:              podSecurityContext(cs.Pod),
 		},
 	}
 	SetEtcdVersion(pod, cs.Version)
+	setEtcdMetrics(pod, cs.Etcd.MetricsOrDefault())
 	return pod
 }
 
+// etcdRestartPolicy restarts the etcd container of a dev cluster in place, on its data:
+// the single member cannot be replaced without losing the data of the cluster.
+// The members of other clusters are replaced by the operator instead.
+func etcdRestartPolicy(cs api.ClusterSpec) v1.RestartPolicy {
+	if cs.IsDevTier() {
+		return v1.RestartPolicyAlways
+	}
+	return v1.RestartPolicyNever
+}
+
+// IsHandsOffPod tells whether the etcd pod is annotated to exclude its member from automation.
+func IsHandsOffPod(pod *v1.Pod) bool {
+	return pod.Annotations[AnnotationHandsOff] == "true"
+}
+
+// IsDevTierPod tells whether the etcd pod was created for a dev cluster.
+func IsDevTierPod(pod *v1.Pod) bool {
+	return pod.Spec.RestartPolicy == v1.RestartPolicyAlways
+}
+
 func podSecurityContext(podPolicy *api.PodPolicy) *v1.PodSecurityContext {
 	if podPolicy == nil {
 		return nil
@@ -397,6 +796,7 @@ func podSecurityContext(podPolicy *api.PodPolicy) *v1.PodSecurityContext {
 func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state, token string, cs api.ClusterSpec, owner metav1.OwnerReference) *v1.Pod {
 	pod := newEtcdPod(m, initialCluster, clusterName, state, token, cs)
 	applyPodPolicy(clusterName, pod, cs.Pod)
+	addSidecars(pod, cs)
 	addOwnerRefToObject(pod.GetObjectMeta(), owner)
 	return pod
 }
@@ -426,6 +826,7 @@ func InClusterConfig() (*rest.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.WrapTransport = APIHealth.wrapTransport
 	return cfg, nil
 }
 
@@ -451,6 +852,30 @@ func LabelsForCluster(clusterName string) map[string]string {
 	}
 }
 
+// PropagatedLabels returns the labels of the cluster resource listed in spec.propagatedLabels.
+func PropagatedLabels(cl *api.EtcdCluster) map[string]string {
+	labels := make(map[string]string)
+	for _, k := range cl.Spec.PropagatedLabels {
+		if v, ok := cl.Labels[k]; ok {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// AddLabels adds the labels the object does not have yet, so that the labels the operator relies on are kept.
+func AddLabels(o metav1.Object, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	l := o.GetLabels()
+	if l == nil {
+		l = make(map[string]string)
+	}
+	mergeLabels(l, labels)
+	o.SetLabels(l)
+}
+
 func CreatePatch(o, n, datastruct interface{}) ([]byte, error) {
 	oldData, err := json.Marshal(o)
 	if err != nil {
@@ -498,10 +923,39 @@ func mergeLabels(l1, l2 map[string]string) {
 	}
 }
 
-func UniqueMemberName(clusterName string) string {
-	suffix := utilrand.String(randomSuffixLength)
-	if len(clusterName) > maxNameLength {
-		clusterName = clusterName[:maxNameLength]
+// UniqueMemberName returns a new member name, the subdomain of the pods of the cluster, see MemberSubdomain,
+// followed by a random suffix. The member is addressed as "<member>.<subdomain>.<namespace>.svc".
+func UniqueMemberName(subdomain string) string {
+	return subdomain + "-" + utilrand.String(randomSuffixLength)
+}
+
+// ValidateClusterName checks that the cluster name can be the value of the etcd_cluster label
+// of the resources of the cluster. Their names are derived from PeerServiceName.
+func ValidateClusterName(clusterName string) error {
+	if errs := validation.IsValidLabelValue(clusterName); len(errs) != 0 {
+		return fmt.Errorf("invalid cluster name (%s): %s", clusterName, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ValidateClusterSpec runs all the checks the operator does on a cluster spec with defaults applied.
+func ValidateClusterSpec(clusterName string, cs api.ClusterSpec) error {
+	if err := ValidateClusterName(clusterName); err != nil {
+		return err
+	}
+	if err := cs.Validate(); err != nil {
+		return err
+	}
+	for _, name := range cs.DependsOn {
+		if name == clusterName {
+			return fmt.Errorf("spec: cluster (%s) cannot depend on itself", clusterName)
+		}
+	}
+	if err := ValidateEtcdPolicy(cs.Etcd, cs.Version); err != nil {
+		return err
+	}
+	if err := validateSubdomain(clusterName, cs.Pod); err != nil {
+		return err
 	}
-	return clusterName + "-" + suffix
+	return ValidatePodOverridePatch(clusterName, cs)
 }
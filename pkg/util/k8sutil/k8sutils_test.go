@@ -15,9 +15,21 @@
 package k8sutil
 
 import (
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestDefaultBusyboxImageName(t *testing.T) {
@@ -47,3 +59,581 @@ func TestSetBusyboxImageName(t *testing.T) {
 		t.Errorf("expect image=%s, get=%s", expected, image)
 	}
 }
+
+func TestApplyPodPolicySchedulerNameAndHostAliases(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}, Annotations: map[string]string{}}}
+	aliases := []v1.HostAlias{{IP: "10.0.0.10", Hostnames: []string{"etcd-0.example.com"}}}
+	applyPodPolicy("example", pod, &api.PodPolicy{SchedulerName: "local-disk-scheduler", HostAliases: aliases})
+	if pod.Spec.SchedulerName != "local-disk-scheduler" {
+		t.Errorf("expect schedulerName=local-disk-scheduler, get=%s", pod.Spec.SchedulerName)
+	}
+	if !reflect.DeepEqual(pod.Spec.HostAliases, aliases) {
+		t.Errorf("expect hostAliases=%v, get=%v", aliases, pod.Spec.HostAliases)
+	}
+}
+
+func TestAddToolboxContainer(t *testing.T) {
+	cs := api.ClusterSpec{Repository: "quay.io/coreos/etcd", Version: "3.2.13", ClientPort: 2379, PeerPort: 2380}
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{
+		etcdContainer([]string{"/usr/local/bin/etcd"}, cs),
+	}}}
+	AddToolboxContainer(pod, cs)
+	if len(pod.Spec.Containers) != 2 {
+		t.Fatalf("expect 2 containers, get %d", len(pod.Spec.Containers))
+	}
+	tb := pod.Spec.Containers[1]
+	if tb.Name != "toolbox" || tb.Image != pod.Spec.Containers[0].Image {
+		t.Errorf("expect toolbox container with the etcd image, get %s with %s", tb.Name, tb.Image)
+	}
+	for _, vm := range tb.VolumeMounts {
+		if !vm.ReadOnly {
+			t.Errorf("expect volume %s to be mounted read-only", vm.Name)
+		}
+	}
+	if pod.Spec.Containers[0].VolumeMounts[0].ReadOnly {
+		t.Error("expect the volumes of the etcd container to stay writable")
+	}
+}
+
+func TestAddSidecars(t *testing.T) {
+	tls := &api.TLSPolicy{Static: &api.StaticTLS{
+		Member:         &api.MemberSecret{ServerSecret: "server"},
+		OperatorSecret: "operator",
+	}}
+	tests := []struct {
+		sidecars   *api.SidecarsPolicy
+		tls        *api.TLSPolicy
+		containers []string
+		images     []string
+	}{{
+		containers: []string{"etcd"},
+	}, {
+		sidecars:   &api.SidecarsPolicy{Exporter: &api.SidecarSpec{}},
+		containers: []string{"etcd", "exporter"},
+		images:     []string{DefaultExporterImage},
+	}, {
+		sidecars:   &api.SidecarsPolicy{Exporter: &api.SidecarSpec{Image: "nginx:1.15.1"}, TLSReloader: &api.SidecarSpec{}},
+		tls:        tls,
+		containers: []string{"etcd", "exporter", "tls-reloader"},
+		images:     []string{"nginx:1.15.1", defaultBusyboxImage},
+	}}
+	for i, tt := range tests {
+		cs := api.ClusterSpec{Repository: "quay.io/coreos/etcd", Version: "3.2.13", ClientPort: 2379, PeerPort: 2380, Sidecars: tt.sidecars, TLS: tt.tls}
+		m := &etcdutil.Member{Name: "example-0000", Namespace: "default", SecureClient: tt.tls.IsSecureClient()}
+		pod := NewEtcdPod(m, []string{"example-0000=http://example-0000.example.default.svc:2380"}, "example", "new", "token", cs, metav1.OwnerReference{})
+		var names, images []string
+		for _, c := range pod.Spec.Containers {
+			names = append(names, c.Name)
+			if c.Name != "etcd" {
+				images = append(images, c.Image)
+			}
+		}
+		if !reflect.DeepEqual(names, tt.containers) || !reflect.DeepEqual(images, tt.images) {
+			t.Errorf("#%d: expect containers %v with images %v, get %v with %v", i, tt.containers, tt.images, names, images)
+		}
+		if shared := pod.Spec.ShareProcessNamespace != nil && *pod.Spec.ShareProcessNamespace; shared != (len(tt.containers) == 3) {
+			t.Errorf("#%d: expect the process namespace to be shared only with the TLS reloader, get %v", i, shared)
+		}
+	}
+}
+
+func TestEtcdDataAndWALVolumes(t *testing.T) {
+	cs := api.ClusterSpec{
+		Repository: "quay.io/coreos/etcd", Version: "3.2.13", ClientPort: 2379, PeerPort: 2380,
+		Pod: &api.PodPolicy{DataVolumeMountPath: "/data/etcd/"},
+	}
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	pod := NewEtcdPod(m, []string{"example-0000=http://example-0000.example.default.svc:2380"}, "example", "new", "token", cs, metav1.OwnerReference{})
+	AddEtcdWALVolumeToPod(pod, NewEtcdPodWALPVC(m, v1.PersistentVolumeClaimSpec{}, "example", "default", metav1.OwnerReference{}))
+
+	etcd := pod.Spec.Containers[0]
+	cmd := strings.Join(etcd.Command, " ")
+	for _, want := range []string{"--data-dir=/data/etcd/data", "--wal-dir=" + walDir} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("expect etcd command to contain %q, get %s", want, cmd)
+		}
+	}
+	mounts := map[string]string{}
+	for _, vm := range etcd.VolumeMounts {
+		mounts[vm.Name] = vm.MountPath
+	}
+	if mounts[etcdVolumeName] != "/data/etcd" || mounts[etcdWALVolumeName] != etcdWALVolumeMountDir {
+		t.Errorf("expect data volume at /data/etcd and WAL volume at %s, get %v", etcdWALVolumeMountDir, mounts)
+	}
+	if v := pod.Spec.Volumes[len(pod.Spec.Volumes)-1]; v.PersistentVolumeClaim == nil || v.PersistentVolumeClaim.ClaimName != "example-0000-wal" {
+		t.Errorf("expect the WAL volume to be the PVC example-0000-wal, get %+v", v)
+	}
+}
+
+func TestEtcdPreStopHook(t *testing.T) {
+	script := newEtcdPreStopHook(true, 12379).PreStop.Exec.Command[2]
+	for _, want := range []string{"--endpoints=https://localhost:12379", "--cacert=" + operatorEtcdTLSDir, "move-leader", "exit 0"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expect preStop script to contain %q, get %s", want, script)
+		}
+	}
+}
+
+func TestClientServiceURL(t *testing.T) {
+	if get, want := ClientServiceURL("example", "default", 2379, false), "http://example-client.default.svc:2379"; get != want {
+		t.Errorf("expect url=%s, get=%s", want, get)
+	}
+	if get, want := ClientServiceURL("example", "default", 12379, true), "https://example-client.default.svc:12379"; get != want {
+		t.Errorf("expect url=%s, get=%s", want, get)
+	}
+}
+
+func TestNewConnectionInfoConfigMap(t *testing.T) {
+	members := []MemberEndpoint{
+		{Name: "example-0000", URL: "http://example-0000.example.default.svc:2379", Ready: true, Leader: true},
+		{Name: "example-0001", URL: "http://example-0001.example.default.svc:2379"},
+		{Name: "example-0002", URL: "http://example-0002.example.default.svc:2379", Ready: true},
+	}
+	cm := NewConnectionInfoConfigMap("example", "default", 2379, false, members, nil, metav1.OwnerReference{})
+	expect := "http://example-0002.example.default.svc:2379,http://example-0000.example.default.svc:2379," +
+		"http://example-0001.example.default.svc:2379,http://example-client.default.svc:2379"
+	if got := cm.Data[ConnectionInfoBalancedEndpointsKey]; got != expect {
+		t.Errorf("expect balanced endpoints %s, got %s", expect, got)
+	}
+	expect = "http://example-0000.example.default.svc:2379,http://example-0001.example.default.svc:2379,http://example-0002.example.default.svc:2379"
+	if got := cm.Data[ConnectionInfoMembersKey]; got != expect {
+		t.Errorf("expect members %s, got %s", expect, got)
+	}
+	if hints := cm.Data[ConnectionInfoMemberHintsKey]; !strings.HasPrefix(hints, `[{"name":"example-0002","url":"http://example-0002.example.default.svc:2379","ready":true}`) {
+		t.Errorf("unexpected member hints %s", hints)
+	}
+	if members[0].Name != "example-0000" {
+		t.Errorf("expect the members passed in to keep their order")
+	}
+}
+
+func TestPeerServiceName(t *testing.T) {
+	long := strings.Repeat("a", 60)
+	tests := []struct {
+		cluster string
+		keep    bool
+	}{
+		{"example", true},
+		{strings.Repeat("a", 52), true},
+		{strings.Repeat("a", 53), false},
+		{"etcd.orders", false},
+		{"1etcd", false},
+		{long, false},
+	}
+	for _, tt := range tests {
+		name := PeerServiceName(tt.cluster)
+		if tt.keep != (name == tt.cluster) {
+			t.Errorf("%s: expect the cluster name kept %v, got %s", tt.cluster, tt.keep, name)
+		}
+		if errs := validation.IsDNS1035Label(name); len(errs) != 0 || len(name) > maxNameLength {
+			t.Errorf("%s: peer service name %s is not a DNS-1035 label of at most %d characters: %v", tt.cluster, name, maxNameLength, errs)
+		}
+		for _, child := range []string{ClientServiceName(tt.cluster), DiskPreflightName(tt.cluster), UniqueMemberName(name)} {
+			if errs := validation.IsDNS1035Label(child); len(errs) != 0 {
+				t.Errorf("%s: %s is not a DNS-1035 label: %v", tt.cluster, child, errs)
+			}
+		}
+	}
+	if a, b := PeerServiceName(long+"x"), PeerServiceName(long+"y"); a == b {
+		t.Errorf("expect different clusters to get different peer service names, got %s for both", a)
+	}
+	if err := ValidateClusterName(strings.Repeat("a", 64)); err == nil {
+		t.Error("expect a cluster name longer than 63 characters to be invalid")
+	}
+}
+
+func TestMemberSubdomain(t *testing.T) {
+	if s := MemberSubdomain("etcd.orders", nil); s != PeerServiceName("etcd.orders") {
+		t.Errorf("expect the peer service name without a subdomain, got %s", s)
+	}
+	cs := api.ClusterSpec{Pod: &api.PodPolicy{Subdomain: "etcd-pki"}}
+	if s := MemberSubdomain("etcd.orders", cs.Pod); s != "etcd-pki" {
+		t.Errorf("expect the subdomain of the spec, got %s", s)
+	}
+	m := &etcdutil.Member{Name: UniqueMemberName(MemberSubdomain("etcd.orders", cs.Pod)), Namespace: "default"}
+	pod := newEtcdPod(m, nil, "etcd.orders", "new", "", cs)
+	if pod.Spec.Subdomain != "etcd-pki" || m.Addr() != m.Name+".etcd-pki.default.svc" {
+		t.Errorf("expect the member addressed under the subdomain, got %s with pod subdomain %s", m.Addr(), pod.Spec.Subdomain)
+	}
+
+	for _, sub := range []string{"etcd.pki", strings.Repeat("a", 53), "example-client"} {
+		if err := validateSubdomain("example", &api.PodPolicy{Subdomain: sub}); err == nil {
+			t.Errorf("expect subdomain %s to be invalid", sub)
+		}
+	}
+	if err := validateSubdomain("example", &api.PodPolicy{Subdomain: strings.Repeat("a", 52)}); err != nil {
+		t.Errorf("expect a subdomain of 52 characters to be valid: %v", err)
+	}
+}
+
+func TestEtcdPolicyFlags(t *testing.T) {
+	policy := &api.EtcdPolicy{
+		MaxRequestBytes:                10485760,
+		GRPCKeepAliveIntervalInSecond:  30,
+		HeartbeatIntervalInMillisecond: 50,
+		ElectionTimeoutInMillisecond:   500,
+		SnapshotCount:                  20000,
+		QuotaBackendBytes:              4294967296,
+		Metrics:                        api.EtcdMetricsExtensive,
+	}
+	flags := etcdPolicyFlags(policy)
+	expected := " --max-request-bytes=10485760 --grpc-keepalive-interval=30s --heartbeat-interval=50 --election-timeout=500" +
+		" --snapshot-count=20000 --quota-backend-bytes=4294967296 --metrics=extensive"
+	if flags != expected {
+		t.Errorf("expect flags=%q, get=%q", expected, flags)
+	}
+	if flags := etcdPolicyFlags(nil); flags != "" {
+		t.Errorf("expect no flags for nil policy, get=%q", flags)
+	}
+}
+
+func TestValidateEtcdPolicyExperimental(t *testing.T) {
+	tests := []struct {
+		experimental map[string]string
+		version      string
+		wErr         bool
+	}{{
+		experimental: map[string]string{"corrupt-check-time": "5m", "initial-corrupt-check": "true"},
+		version:      "3.3.1",
+	}, { // not available before 3.3
+		experimental: map[string]string{"corrupt-check-time": "5m"},
+		version:      "3.2.13",
+		wErr:         true,
+	}, { // not vetted
+		experimental: map[string]string{"unknown-flag": "1"},
+		version:      "3.3.1",
+		wErr:         true,
+	}, { // a value with a space would break the command line
+		experimental: map[string]string{"corrupt-check-time": "5m --foo"},
+		version:      "3.3.1",
+		wErr:         true,
+	}}
+
+	for i, tt := range tests {
+		err := ValidateEtcdPolicy(&api.EtcdPolicy{Experimental: tt.experimental}, tt.version)
+		if (err != nil) != tt.wErr {
+			t.Errorf("#%d: want error=%v, get err=%v", i, tt.wErr, err)
+		}
+	}
+}
+
+func TestInitialClusterToken(t *testing.T) {
+	if get := InitialClusterToken(nil, "uid-1"); get != "uid-1" {
+		t.Errorf("expect the UID as default token, get %s", get)
+	}
+	if get := InitialClusterToken(&api.EtcdPolicy{InitialClusterToken: "orders"}, "uid-1"); get != "orders" {
+		t.Errorf("expect token=orders, get %s", get)
+	}
+	if err := ValidateEtcdPolicy(&api.EtcdPolicy{InitialClusterToken: "orders-2018.07_a"}, "3.2.13"); err != nil {
+		t.Errorf("expect a valid token, get err=%v", err)
+	}
+	if err := ValidateEtcdPolicy(&api.EtcdPolicy{InitialClusterToken: "orders; rm -rf /"}, "3.2.13"); err == nil {
+		t.Error("expect a token with spaces and shell characters to be invalid")
+	}
+}
+
+func TestBackendFlagArgs(t *testing.T) {
+	policy := &api.EtcdPolicy{BackendFreelistType: "map", BackendBatchIntervalInMillisecond: 10, BackendBatchLimit: 1000}
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"3.4.3", " --experimental-backend-bbolt-freelist-type=map --backend-batch-interval=10ms --backend-batch-limit=1000"},
+		{"3.6.0", " --backend-bbolt-freelist-type=map --backend-batch-interval=10ms --backend-batch-limit=1000"},
+	}
+	for i, tt := range tests {
+		if get := backendFlagArgs(policy, tt.version); get != tt.want {
+			t.Errorf("#%d: expect flags=%q, get=%q", i, tt.want, get)
+		}
+	}
+	if err := ValidateEtcdPolicy(policy, "3.3.11"); err == nil {
+		t.Error("expect backend settings to be rejected before etcd 3.4")
+	}
+}
+
+func TestLogFlagArgs(t *testing.T) {
+	tests := []struct {
+		policy  *api.EtcdPolicy
+		version string
+		want    string
+	}{{
+		policy:  &api.EtcdPolicy{LogLevel: "debug"},
+		version: "3.2.13",
+		want:    " --log-package-levels=*=DEBUG",
+	}, {
+		policy:  &api.EtcdPolicy{LogLevel: "warn", LogOutputs: []string{"stderr", "/var/etcd/etcd.log"}},
+		version: "3.4.0",
+		want:    " --log-level=warn --log-outputs=stderr,/var/etcd/etcd.log",
+	}, {
+		policy:  nil,
+		version: "3.4.0",
+		want:    "",
+	}}
+
+	for i, tt := range tests {
+		if get := logFlagArgs(tt.policy, tt.version); get != tt.want {
+			t.Errorf("#%d: expect flags=%q, get=%q", i, tt.want, get)
+		}
+	}
+}
+
+func TestLastBackupTime(t *testing.T) {
+	newBackup := func(endpoint string, succeeded bool, created time.Time) api.EtcdBackup {
+		b := api.EtcdBackup{
+			Spec:   api.BackupSpec{EtcdEndpoints: []string{endpoint}},
+			Status: api.BackupStatus{Succeeded: succeeded},
+		}
+		b.Namespace = "default"
+		b.CreationTimestamp = metav1.NewTime(created)
+		return b
+	}
+	t0 := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	backups := []api.EtcdBackup{
+		newBackup("http://example-client:2379", true, t0),
+		newBackup("https://example-client.default.svc:2379", true, t0.Add(time.Hour)),
+		newBackup("http://example-client:2379", false, t0.Add(2*time.Hour)),
+		newBackup("http://other-client:2379", true, t0.Add(3*time.Hour)),
+	}
+	get, ok := LastBackupTime("example", "default", backups)
+	if !ok || !get.Equal(t0.Add(time.Hour)) {
+		t.Errorf("expect last backup at %v, get %v (found: %v)", t0.Add(time.Hour), get, ok)
+	}
+	if _, ok := LastBackupTime("missing", "default", backups); ok {
+		t.Error("expect no backup of cluster missing")
+	}
+}
+
+func TestApplyPodOverridePatch(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "etcd", "etcd_cluster": "example"}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "etcd", Image: "quay.io/coreos/etcd:v3.2.13"}}},
+	}
+	policy := &api.PodPolicy{OverridePatch: &runtime.RawExtension{
+		Raw: []byte(`{"spec":{"priorityClassName":"etcd","containers":[{"name":"etcd","stdin":true}]}}`),
+	}}
+	np, err := ApplyPodOverridePatch(pod, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if np.Spec.PriorityClassName != "etcd" || !np.Spec.Containers[0].Stdin || np.Spec.Containers[0].Image != pod.Spec.Containers[0].Image {
+		t.Errorf("unexpected patched pod spec: %+v", np.Spec)
+	}
+
+	policy.OverridePatch.Raw = []byte(`{"metadata":{"labels":{"etcd_cluster":"other"}}}`)
+	if _, err := ApplyPodOverridePatch(pod, policy); err == nil {
+		t.Error("expect changing a reserved label to fail")
+	}
+}
+
+func TestPodResourceRequests(t *testing.T) {
+	newPod := func(cpu, memory string) *v1.Pod {
+		rl := v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)}
+		if len(memory) != 0 {
+			rl[v1.ResourceMemory] = resource.MustParse(memory)
+		}
+		return &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: rl}}}}}
+	}
+	rl := PodResourceRequests([]*v1.Pod{newPod("100m", "512Mi"), newPod("250m", ""), {}})
+
+	cpu, memory := rl[v1.ResourceCPU], rl[v1.ResourceMemory]
+	if cpu.MilliValue() != 350 {
+		t.Errorf("expect cpu=350m, get %s", cpu.String())
+	}
+	if memory.Value() != 512*1024*1024 {
+		t.Errorf("expect memory=512Mi, get %s", memory.String())
+	}
+	if _, ok := rl[v1.ResourceStorage]; ok {
+		t.Error("expect no storage request from pods")
+	}
+
+	pvcs := []v1.PersistentVolumeClaim{{}, {}}
+	for i := range pvcs {
+		pvcs[i].Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")}
+	}
+	if s := PVCStorageRequests(pvcs); s.Value() != 2*1024*1024*1024 {
+		t.Errorf("expect storage=2Gi, get %s", s.String())
+	}
+}
+
+func TestPropagatedLabels(t *testing.T) {
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "test",
+			Labels: map[string]string{"team": "orders", "cost-center": "42", "env": "prod"},
+		},
+		Spec: api.ClusterSpec{PropagatedLabels: []string{"team", "cost-center", "missing"}},
+	}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: LabelsForCluster("test")}}
+	pod.Labels["team"] = "etcd"
+	AddLabels(pod.GetObjectMeta(), PropagatedLabels(cl))
+
+	want := map[string]string{"app": "etcd", "etcd_cluster": "test", "team": "etcd", "cost-center": "42"}
+	if !reflect.DeepEqual(pod.Labels, want) {
+		t.Errorf("expect labels %v, get %v", want, pod.Labels)
+	}
+}
+
+func TestKeepPodOffNodes(t *testing.T) {
+	zone := v1.NodeSelectorRequirement{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}
+	policy := &api.PodPolicy{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{zone}}},
+		},
+	}}}
+	pod := &v1.Pod{Spec: v1.PodSpec{Affinity: policy.Affinity}}
+	KeepPodOffNodes(pod, []string{"slow-0", "slow-1"})
+
+	got := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	expected := []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{
+		zone,
+		{Key: hostnameLabel, Operator: v1.NodeSelectorOpNotIn, Values: []string{"slow-0", "slow-1"}},
+	}}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expect node selector terms %v, got %v", expected, got)
+	}
+	if n := len(policy.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions); n != 1 {
+		t.Errorf("expect the affinity of the pod policy to be left alone, got %d match expressions", n)
+	}
+
+	pod = &v1.Pod{}
+	KeepPodOffNodes(pod, nil)
+	if pod.Spec.Affinity != nil {
+		t.Errorf("expect no affinity without nodes to keep off, got %v", pod.Spec.Affinity)
+	}
+}
+
+func TestVolumeNodes(t *testing.T) {
+	host := func(nodes ...string) v1.NodeSelectorTerm {
+		return v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{Key: hostnameLabel, Operator: v1.NodeSelectorOpIn, Values: nodes}}}
+	}
+	zone := v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}}}
+	pv := func(terms ...v1.NodeSelectorTerm) *v1.PersistentVolume {
+		return &v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{NodeAffinity: &v1.VolumeNodeAffinity{
+			Required: &v1.NodeSelector{NodeSelectorTerms: terms},
+		}}}
+	}
+	tests := []struct {
+		pv       *v1.PersistentVolume
+		expected []string
+	}{
+		{&v1.PersistentVolume{}, nil},
+		{pv(host("node-0")), []string{"node-0"}},
+		{pv(host("node-0"), host("node-1", "node-2")), []string{"node-0", "node-1", "node-2"}},
+		{pv(host("node-0"), zone), nil},
+	}
+	for i, tt := range tests {
+		if got := VolumeNodes(tt.pv); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("#%d: expect nodes %v, got %v", i, tt.expected, got)
+		}
+	}
+}
+
+func TestApplyPeerServiceRepairs(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	svcs := kubecli.CoreV1().Services("default")
+	apply := func() bool {
+		changed, err := ApplyPeerService(kubecli, "test", "test", "default", 2379, 2380, metav1.OwnerReference{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changed
+	}
+
+	if !apply() {
+		t.Error("expect a missing service to be created")
+	}
+	if apply() {
+		t.Error("expect an intact service to be left alone")
+	}
+
+	svc, err := svcs.Get("test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Spec.Selector = map[string]string{"app": "other"}
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	if _, err := svcs.Update(svc); err != nil {
+		t.Fatal(err)
+	}
+	if !apply() {
+		t.Error("expect a changed service to be repaired")
+	}
+	svc, err = svcs.Get("test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(svc.Spec.Selector, LabelsForCluster("test")) || len(svc.Spec.Ports) != 2 {
+		t.Errorf("expect selector and ports to be restored, get %v and %v", svc.Spec.Selector, svc.Spec.Ports)
+	}
+
+	if err := svcs.Delete("test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !apply() {
+		t.Error("expect a deleted service to be recreated")
+	}
+}
+
+func TestBackupHelperImage(t *testing.T) {
+	tests := []struct {
+		policy        *api.PodPolicy
+		operatorImage string
+		expected      string
+	}{
+		{nil, "", DefaultBackupHelperImage},
+		{&api.PodPolicy{}, "myRepo/curl:7.61.0", "myRepo/curl:7.61.0"},
+		{&api.PodPolicy{BackupHelperImage: "myRepo/curl:7.62.0"}, "myRepo/curl:7.61.0", "myRepo/curl:7.62.0"},
+	}
+	for i, tt := range tests {
+		if image := backupHelperImage(tt.policy, tt.operatorImage); image != tt.expected {
+			t.Errorf("#%d: expect image=%s, get=%s", i, tt.expected, image)
+		}
+	}
+}
+
+func TestNewBackupVerifyPod(t *testing.T) {
+	backupURL, err := url.Parse("https://backups.example.com/etcd/backup?sig=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := metav1.OwnerReference{APIVersion: "etcd.database.coreos.com/v1beta2", Kind: "EtcdBackup", Name: "b", UID: "uid-1"}
+	pod := NewBackupVerifyPod("b-verify", "ns", backupURL, "", "quay.io/coreos/etcd", "3.2.13", owner)
+
+	if pod.Spec.RestartPolicy != v1.RestartPolicyNever {
+		t.Errorf("expect restart policy %s, got %s", v1.RestartPolicyNever, pod.Spec.RestartPolicy)
+	}
+	if len(pod.OwnerReferences) != 1 || pod.OwnerReferences[0].UID != owner.UID {
+		t.Errorf("expect owner reference to %s, got %v", owner.UID, pod.OwnerReferences)
+	}
+	if len(pod.Spec.InitContainers) != 1 {
+		t.Fatalf("expect one init container, got %d", len(pod.Spec.InitContainers))
+	}
+	fetch := pod.Spec.InitContainers[0]
+	if fetch.Name != "fetch-backup" || fetch.Image != DefaultBackupHelperImage {
+		t.Errorf("expect the fetch-backup init container of image %s, got %s of image %s", DefaultBackupHelperImage, fetch.Name, fetch.Image)
+	}
+	if cmd := strings.Join(fetch.Command, " "); !strings.Contains(cmd, backupURL.String()) {
+		t.Errorf("expect the init container to fetch %s, got %q", backupURL, cmd)
+	}
+	if len(pod.Spec.Containers) != 1 || pod.Spec.Containers[0].Image != "quay.io/coreos/etcd:v3.2.13" {
+		t.Errorf("expect the verify container to run etcd 3.2.13, got %v", pod.Spec.Containers)
+	}
+}
+
+func TestRestoreInitContainersSkipHashCheck(t *testing.T) {
+	backupURL, err := url.Parse("http://backup-operator:19999/v1/backup/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "ns"}
+	for _, skip := range []bool{false, true} {
+		containers := makeRestoreInitContainers(backupURL, "token", DefaultBackupHelperImage, "quay.io/coreos/etcd", "3.2.13", m, skip, "/var/etcd")
+		if len(containers) != 2 || containers[1].Name != "restore-datadir" {
+			t.Fatalf("expect the fetch-backup and restore-datadir init containers, got %v", containers)
+		}
+		cmd := strings.Join(containers[1].Command, " ")
+		if got := strings.Contains(cmd, "--skip-hash-check"); got != skip {
+			t.Errorf("skipHashCheck=%v: expect --skip-hash-check in the restore command %v, got %q", skip, skip, cmd)
+		}
+	}
+}
@@ -28,3 +28,27 @@ func IsNodeReady(n v1.Node) bool {
 
 	return false
 }
+
+// VolumeNodes returns the nodes the persistent volume is pinned to by its required node affinity, as a local volume is,
+// by their kubernetes.io/hostname label, which is assumed to be the node name.
+// It is empty if a term of the affinity selects nodes otherwise, i.e. the volume may be used on other nodes too.
+func VolumeNodes(pv *v1.PersistentVolume) []string {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return nil
+	}
+	var nodes []string
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		pinned := false
+		for _, req := range term.MatchExpressions {
+			if req.Key == hostnameLabel && req.Operator == v1.NodeSelectorOpIn {
+				nodes = append(nodes, req.Values...)
+				pinned = true
+				break
+			}
+		}
+		if !pinned {
+			return nil
+		}
+	}
+	return nodes
+}
@@ -17,46 +17,89 @@ package k8sutil
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 )
 
 const (
-	etcdVolumeName = "etcd-data"
+	etcdVolumeName    = "etcd-data"
+	etcdWALVolumeName = "etcd-wal"
 )
 
-func etcdVolumeMounts() []v1.VolumeMount {
+func etcdVolumeMounts(mountDir string) []v1.VolumeMount {
 	return []v1.VolumeMount{
-		{Name: etcdVolumeName, MountPath: etcdVolumeMountDir},
+		{Name: etcdVolumeName, MountPath: mountDir},
 	}
 }
 
-func etcdContainer(cmd []string, repo, version string) v1.Container {
+func etcdContainer(cmd []string, cs api.ClusterSpec) v1.Container {
 	c := v1.Container{
 		Command: cmd,
 		Name:    "etcd",
-		Image:   ImageName(repo, version),
+		Image:   ImageName(cs.Repository, cs.Version),
 		Ports: []v1.ContainerPort{
 			{
 				Name:          "server",
-				ContainerPort: int32(2380),
+				ContainerPort: int32(cs.PeerPort),
 				Protocol:      v1.ProtocolTCP,
 			},
 			{
 				Name:          "client",
-				ContainerPort: int32(EtcdClientPort),
+				ContainerPort: int32(cs.ClientPort),
 				Protocol:      v1.ProtocolTCP,
 			},
 		},
-		VolumeMounts: etcdVolumeMounts(),
+		VolumeMounts: etcdVolumeMounts(etcdVolumeMountPath(cs.Pod)),
 	}
 
 	return c
 }
 
+// AddToolboxContainer adds to the etcd pod a container that idles with the etcd image,
+// which ships etcdctl and a shell, and etcdctl set up to talk to the local member.
+// It mounts the volumes of the etcd container read-only.
+func AddToolboxContainer(pod *v1.Pod, cs api.ClusterSpec) {
+	var etcd *v1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == "etcd" {
+			etcd = &pod.Spec.Containers[i]
+		}
+	}
+	if etcd == nil {
+		return
+	}
+
+	env := []v1.EnvVar{
+		{Name: "ETCDCTL_API", Value: "3"},
+		{Name: "ETCDCTL_ENDPOINTS", Value: etcdutil.URL(cs.TLS.IsSecureClient(), "localhost", cs.ClientPort)},
+	}
+	if cs.TLS.IsSecureClient() {
+		env = append(env,
+			v1.EnvVar{Name: "ETCDCTL_CERT", Value: operatorEtcdTLSDir + "/" + etcdutil.CliCertFile},
+			v1.EnvVar{Name: "ETCDCTL_KEY", Value: operatorEtcdTLSDir + "/" + etcdutil.CliKeyFile},
+			v1.EnvVar{Name: "ETCDCTL_CACERT", Value: operatorEtcdTLSDir + "/" + etcdutil.CliCAFile},
+		)
+	}
+	mounts := make([]v1.VolumeMount, 0, len(etcd.VolumeMounts))
+	for _, vm := range etcd.VolumeMounts {
+		vm.ReadOnly = true
+		mounts = append(mounts, vm)
+	}
+	pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{
+		Name:  "toolbox",
+		Image: etcd.Image,
+		// Exit right away on termination instead of holding up the deletion of the pod.
+		Command:      []string{"/bin/sh", "-c", "trap 'exit 0' TERM; while true; do sleep 5 & wait; done"},
+		Env:          env,
+		VolumeMounts: mounts,
+	})
+}
+
 func containerWithProbes(c v1.Container, lp *v1.Probe, rp *v1.Probe) v1.Container {
 	c.LivenessProbe = lp
 	c.ReadinessProbe = rp
@@ -68,12 +111,37 @@ func containerWithRequirements(c v1.Container, r v1.ResourceRequirements) v1.Con
 	return c
 }
 
-func newEtcdProbe(isSecure bool) *v1.Probe {
+// newEtcdPreStopHook hands leadership over to another member before the etcd container is stopped,
+// if the member is the leader. etcdctl only supports move-leader from etcd 3.3 on; the hook never fails,
+// so termination goes on in any case and etcd stops gracefully on SIGTERM.
+func newEtcdPreStopHook(isSecure bool, clientPort int) *v1.Lifecycle {
+	etcdctl := fmt.Sprintf("etcdctl --endpoints=%s", etcdutil.URL(isSecure, "localhost", clientPort))
+	if isSecure {
+		etcdctl += fmt.Sprintf(" --cert=%[1]s/%[2]s --key=%[1]s/%[3]s --cacert=%[1]s/%[4]s", operatorEtcdTLSDir, etcdutil.CliCertFile, etcdutil.CliKeyFile, etcdutil.CliCAFile)
+	}
+	script := fmt.Sprintf(`
+export ETCDCTL_API=3
+status=$(%[1]s endpoint status) || exit 0
+[ "$(echo "$status" | cut -d, -f5 | tr -d ' ')" = "true" ] || exit 0
+self=$(echo "$status" | cut -d, -f2 | tr -d ' ')
+for id in $(%[1]s member list | cut -d, -f1); do
+	[ "$id" = "$self" ] && continue
+	%[1]s move-leader "$id" && exit 0
+done
+exit 0`, etcdctl)
+	return &v1.Lifecycle{
+		PreStop: &v1.Handler{
+			Exec: &v1.ExecAction{Command: []string{"/bin/sh", "-c", script}},
+		},
+	}
+}
+
+func newEtcdProbe(isSecure bool, clientPort int) *v1.Probe {
 	// etcd pod is alive only if a linearizable get succeeds.
-	cmd := "ETCDCTL_API=3 etcdctl get foo"
+	cmd := fmt.Sprintf("ETCDCTL_API=3 etcdctl --endpoints=%s get foo", etcdutil.URL(false, "localhost", clientPort))
 	if isSecure {
 		tlsFlags := fmt.Sprintf("--cert=%[1]s/%[2]s --key=%[1]s/%[3]s --cacert=%[1]s/%[4]s", operatorEtcdTLSDir, etcdutil.CliCertFile, etcdutil.CliKeyFile, etcdutil.CliCAFile)
-		cmd = fmt.Sprintf("ETCDCTL_API=3 etcdctl --endpoints=https://localhost:%d %s get foo", EtcdClientPort, tlsFlags)
+		cmd = fmt.Sprintf("ETCDCTL_API=3 etcdctl --endpoints=%s %s get foo", etcdutil.URL(true, "localhost", clientPort), tlsFlags)
 	}
 	return &v1.Probe{
 		Handler: v1.Handler{
@@ -103,6 +171,15 @@ func applyPodPolicy(clusterName string, pod *v1.Pod, policy *api.PodPolicy) {
 	if len(policy.Tolerations) != 0 {
 		pod.Spec.Tolerations = policy.Tolerations
 	}
+	if len(policy.SchedulerName) != 0 {
+		pod.Spec.SchedulerName = policy.SchedulerName
+	}
+	if len(policy.HostAliases) != 0 {
+		pod.Spec.HostAliases = policy.HostAliases
+	}
+	if policy.TerminationGracePeriodSeconds != nil {
+		pod.Spec.TerminationGracePeriodSeconds = policy.TerminationGracePeriodSeconds
+	}
 
 	mergeLabels(pod.Labels, policy.Labels)
 
@@ -144,3 +221,43 @@ func PodSpecToPrettyJSON(pod *v1.Pod) (string, error) {
 	}
 	return string(bytes), nil
 }
+
+// ApplyPodOverridePatch returns the pod with spec.pod.overridePatch applied.
+// It fails if the patch is invalid or changes the labels the operator selects its pods by.
+func ApplyPodOverridePatch(pod *v1.Pod, policy *api.PodPolicy) (*v1.Pod, error) {
+	if policy == nil || policy.OverridePatch == nil || len(policy.OverridePatch.Raw) == 0 {
+		return pod, nil
+	}
+	orig, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(orig, policy.OverridePatch.Raw, v1.Pod{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply pod overridePatch: %v", err)
+	}
+	np := &v1.Pod{}
+	if err := json.Unmarshal(patched, np); err != nil {
+		return nil, fmt.Errorf("failed to apply pod overridePatch: %v", err)
+	}
+	for k, v := range pod.Labels {
+		if (k == "app" || strings.HasPrefix(k, "etcd_")) && np.Labels[k] != v {
+			return nil, fmt.Errorf("pod overridePatch must not change the reserved label (%s)", k)
+		}
+	}
+	return np, nil
+}
+
+// ValidatePodOverridePatch checks that spec.pod.overridePatch applies to the pods of the cluster.
+func ValidatePodOverridePatch(clusterName string, cs api.ClusterSpec) error {
+	if cs.Pod == nil || cs.Pod.OverridePatch == nil {
+		return nil
+	}
+	m := &etcdutil.Member{Name: MemberSubdomain(clusterName, cs.Pod) + "-validate", Namespace: "default"}
+	pod := newEtcdPod(m, nil, clusterName, "new", "", cs)
+	applyPodPolicy(clusterName, pod, cs.Pod)
+	if _, err := ApplyPodOverridePatch(pod, cs.Pod); err != nil {
+		return fmt.Errorf("spec: %v", err)
+	}
+	return nil
+}
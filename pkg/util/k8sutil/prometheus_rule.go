@@ -0,0 +1,108 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"encoding/json"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const prometheusRulesPath = "/apis/monitoring.coreos.com/v1/namespaces"
+
+// prometheusRule mirrors the PrometheusRule resource of the Prometheus operator,
+// which has no client in the client-go version we use.
+type prometheusRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Groups []prometheusRuleGroup `json:"groups"`
+	} `json:"spec"`
+}
+
+type prometheusRuleGroup struct {
+	Name  string      `json:"name"`
+	Rules []AlertRule `json:"rules"`
+}
+
+// AlertRule is an alerting rule of a PrometheusRule.
+type AlertRule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// PrometheusRuleName returns the name of the PrometheusRule holding the alerts of the cluster.
+func PrometheusRuleName(clusterName string) string {
+	return clusterName + "-alerts"
+}
+
+// ApplyPrometheusRule creates or replaces the PrometheusRule of the cluster with a single group of the given rules.
+// It fails if the Prometheus operator's PrometheusRule resource is not installed.
+func ApplyPrometheusRule(kubecli kubernetes.Interface, clusterName, ns string, rules []AlertRule, owner metav1.OwnerReference, labels map[string]string) error {
+	name := PrometheusRuleName(clusterName)
+	pr := &prometheusRule{
+		TypeMeta: metav1.TypeMeta{APIVersion: "monitoring.coreos.com/v1", Kind: "PrometheusRule"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels:    LabelsForCluster(clusterName),
+		},
+	}
+	pr.Spec.Groups = []prometheusRuleGroup{{Name: "etcd-" + ns + "-" + clusterName, Rules: rules}}
+	addOwnerRefToObject(pr.GetObjectMeta(), owner)
+	AddLabels(pr.GetObjectMeta(), labels)
+
+	rc := kubecli.CoreV1().RESTClient()
+	b, err := rc.Get().AbsPath(prometheusRulesPath, ns, "prometheusrules", name).DoRaw()
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err != nil {
+		body, err := json.Marshal(pr)
+		if err != nil {
+			return err
+		}
+		_, err = rc.Post().AbsPath(prometheusRulesPath, ns, "prometheusrules").Body(body).DoRaw()
+		return err
+	}
+
+	cur := &prometheusRule{}
+	if err := json.Unmarshal(b, cur); err != nil {
+		return err
+	}
+	pr.ResourceVersion = cur.ResourceVersion
+	body, err := json.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	_, err = rc.Put().AbsPath(prometheusRulesPath, ns, "prometheusrules", name).Body(body).DoRaw()
+	return err
+}
+
+// DeletePrometheusRule deletes the PrometheusRule of the cluster, if any.
+func DeletePrometheusRule(kubecli kubernetes.Interface, clusterName, ns string) error {
+	_, err := kubecli.CoreV1().RESTClient().Delete().
+		AbsPath(prometheusRulesPath, ns, "prometheusrules", PrometheusRuleName(clusterName)).
+		DoRaw()
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
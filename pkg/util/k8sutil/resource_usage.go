@@ -0,0 +1,90 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"encoding/json"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podMetricsList mirrors the PodMetricsList of the metrics.k8s.io/v1beta1 resource metrics API,
+// which has no client in the client-go version we use.
+type podMetricsList struct {
+	Items []struct {
+		Containers []struct {
+			Usage v1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// PodResourceRequests returns the sum of the cpu and memory requests of the containers of the pods.
+func PodResourceRequests(pods []*v1.Pod) v1.ResourceList {
+	rl := v1.ResourceList{}
+	for _, pod := range pods {
+		for _, c := range pod.Spec.Containers {
+			addResources(rl, c.Resources.Requests, v1.ResourceCPU, v1.ResourceMemory)
+		}
+	}
+	return rl
+}
+
+// PVCStorageRequests returns the sum of the storage requested by the persistent volume claims.
+func PVCStorageRequests(pvcs []v1.PersistentVolumeClaim) resource.Quantity {
+	var q resource.Quantity
+	for _, pvc := range pvcs {
+		if s, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+			q.Add(s)
+		}
+	}
+	return q
+}
+
+// PodResourceUsage returns the sum of the cpu and memory used by the pods of the cluster,
+// as reported by the resource metrics API. It fails if the API is not served, e.g. without metrics-server.
+func PodResourceUsage(kubecli kubernetes.Interface, clusterName, ns string) (v1.ResourceList, error) {
+	b, err := kubecli.CoreV1().RESTClient().Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", ns, "pods").
+		Param("labelSelector", ClusterListOpt(clusterName).LabelSelector).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	ml := &podMetricsList{}
+	if err := json.Unmarshal(b, ml); err != nil {
+		return nil, err
+	}
+	rl := v1.ResourceList{}
+	for _, pm := range ml.Items {
+		for _, c := range pm.Containers {
+			addResources(rl, c.Usage, v1.ResourceCPU, v1.ResourceMemory)
+		}
+	}
+	return rl, nil
+}
+
+func addResources(sum, rl v1.ResourceList, names ...v1.ResourceName) {
+	for _, name := range names {
+		q, ok := rl[name]
+		if !ok {
+			continue
+		}
+		s := sum[name]
+		s.Add(q)
+		sum[name] = s
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// DefaultExporterImage is the image of the exporter sidecar, unless spec.sidecars.exporter.image is set.
+	// The exporter is an nginx proxying /metrics to the local member.
+	DefaultExporterImage = "nginx:1.15.0-alpine"
+	// ExporterPort is the port the exporter sidecar serves the metrics of the member on.
+	ExporterPort = 9379
+
+	// sidecarRunDir holds the pid file of the exporter, for the TLS reloader to signal it.
+	sidecarRunDir    = "/var/run/etcd-sidecars"
+	sidecarRunVolume = "etcd-sidecars-run"
+	tlsReloaderName  = "tls-reloader"
+	// tlsReloadInterval is how often, in seconds, the TLS reloader checks the operator secret for changes.
+	tlsReloadInterval = 10
+)
+
+// addSidecars adds the containers of spec.sidecars to the etcd pod.
+func addSidecars(pod *v1.Pod, cs api.ClusterSpec) {
+	sp := cs.Sidecars
+	if sp == nil || sp.Exporter == nil {
+		return
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{Name: sidecarRunVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}})
+	pod.Spec.Containers = append(pod.Spec.Containers, exporterContainer(sp.Exporter, cs, pod.Spec.RestartPolicy))
+	if sp.TLSReloader != nil && cs.TLS.IsSecureClient() {
+		pod.Spec.Containers = append(pod.Spec.Containers, tlsReloaderContainer(sp.TLSReloader, cs))
+		// The TLS reloader signals the exporter.
+		pod.Spec.ShareProcessNamespace = func(b bool) *bool { return &b }(true)
+	}
+}
+
+// exporterContainer returns the exporter sidecar. It only has a liveness probe if its pod restarts its containers:
+// otherwise a failed probe would stop the container for good, and make the member unready with it.
+func exporterContainer(s *api.SidecarSpec, cs api.ClusterSpec, restartPolicy v1.RestartPolicy) v1.Container {
+	secure := cs.TLS.IsSecureClient()
+	proxy := fmt.Sprintf("proxy_pass %s/metrics;", etcdutil.URL(secure, "localhost", cs.ClientPort))
+	if secure {
+		proxy += fmt.Sprintf(`
+			proxy_ssl_certificate %[1]s/%[2]s;
+			proxy_ssl_certificate_key %[1]s/%[3]s;
+			proxy_ssl_trusted_certificate %[1]s/%[4]s;
+			proxy_ssl_verify on;
+			proxy_ssl_name localhost;`, operatorEtcdTLSDir, etcdutil.CliCertFile, etcdutil.CliKeyFile, etcdutil.CliCAFile)
+	}
+	// Everything nginx writes goes to the run dir or /tmp, so that it also runs as a non-root user.
+	conf := fmt.Sprintf(`
+pid %[1]s/exporter.pid;
+error_log stderr;
+events {}
+http {
+	access_log off;
+	client_body_temp_path /tmp/client_body;
+	proxy_temp_path /tmp/proxy;
+	fastcgi_temp_path /tmp/fastcgi;
+	uwsgi_temp_path /tmp/uwsgi;
+	scgi_temp_path /tmp/scgi;
+	server {
+		listen %[2]d;
+		location = /metrics {
+			%[3]s
+		}
+		location = /healthz {
+			return 200;
+		}
+	}
+}`, sidecarRunDir, ExporterPort, proxy)
+
+	c := v1.Container{
+		Name:  "exporter",
+		Image: sidecarImage(s, DefaultExporterImage),
+		Command: []string{"/bin/sh", "-ec",
+			fmt.Sprintf("cat > /tmp/exporter.conf <<'EOF'%s\nEOF\nexec nginx -c /tmp/exporter.conf -g 'daemon off;'", conf)},
+		Ports: []v1.ContainerPort{{
+			Name:          "metrics",
+			ContainerPort: ExporterPort,
+			Protocol:      v1.ProtocolTCP,
+		}},
+		VolumeMounts: []v1.VolumeMount{{Name: sidecarRunVolume, MountPath: sidecarRunDir}},
+		Resources:    s.Resources,
+	}
+	if secure {
+		c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{Name: operatorEtcdTLSVolume, MountPath: operatorEtcdTLSDir, ReadOnly: true})
+	}
+	if restartPolicy == v1.RestartPolicyAlways {
+		c.LivenessProbe = &v1.Probe{
+			Handler: v1.Handler{
+				HTTPGet: &v1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(ExporterPort)},
+			},
+			InitialDelaySeconds: 10,
+			TimeoutSeconds:      5,
+			PeriodSeconds:       30,
+			FailureThreshold:    3,
+		}
+	}
+	return c
+}
+
+// tlsReloaderContainer returns the TLS reloader sidecar, which runs with the busybox image unless its image is set.
+// nginx only reads its client certificate at start, so the reloader has it reload its configuration
+// once the files of the operator secret change.
+func tlsReloaderContainer(s *api.SidecarSpec, cs api.ClusterSpec) v1.Container {
+	script := fmt.Sprintf(`
+trap 'exit 0' TERM
+checksum() { cat %[1]s/* | md5sum; }
+last=$(checksum)
+while true; do
+	sleep %[3]d & wait
+	current=$(checksum)
+	[ "$current" = "$last" ] && continue
+	echo "operator secret changed, reloading the exporter"
+	kill -HUP "$(cat %[2]s/exporter.pid)" && last=$current
+done`, operatorEtcdTLSDir, sidecarRunDir, tlsReloadInterval)
+	return v1.Container{
+		Name:    tlsReloaderName,
+		Image:   sidecarImage(s, imageNameBusybox(cs.Pod)),
+		Command: []string{"/bin/sh", "-c", script},
+		VolumeMounts: []v1.VolumeMount{
+			{Name: sidecarRunVolume, MountPath: sidecarRunDir},
+			{Name: operatorEtcdTLSVolume, MountPath: operatorEtcdTLSDir, ReadOnly: true},
+		},
+		Resources: s.Resources,
+	}
+}
+
+func sidecarImage(s *api.SidecarSpec, defaultImage string) string {
+	if len(s.Image) != 0 {
+		return s.Image
+	}
+	return defaultImage
+}
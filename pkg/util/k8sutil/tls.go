@@ -15,12 +15,32 @@
 package k8sutil
 
 import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// Keys of the member TLS secrets, as the etcd members are started with them.
+const (
+	PeerCertFile   = "peer.crt"
+	PeerKeyFile    = "peer.key"
+	PeerCAFile     = "peer-ca.crt"
+	ServerCertFile = "server.crt"
+	ServerKeyFile  = "server.key"
+	ServerCAFile   = "server-ca.crt"
+)
+
+// Keys of the CA secret the operator creates when it rotates the CA of a cluster.
+const (
+	CACertFile = "ca.crt"
+	CAKeyFile  = "ca.key"
+)
+
 type TLSData struct {
 	CertData []byte
 	KeyData  []byte
@@ -39,3 +59,94 @@ func GetTLSDataFromSecret(kubecli kubernetes.Interface, ns, se string) (*TLSData
 		CAData:   secret.Data[etcdutil.CliCAFile],
 	}, nil
 }
+
+// CheckTLSSecrets checks that the static TLS secrets of the cluster exist and hold the keys the members and the operator read,
+// so that a missing secret fails the cluster instead of leaving its pods unable to start.
+func CheckTLSSecrets(kubecli kubernetes.Interface, ns string, tp *api.TLSPolicy) error {
+	type tlsSecret struct {
+		name string
+		keys []string
+	}
+	var secrets []tlsSecret
+	if tp.IsSecurePeer() {
+		secrets = append(secrets, tlsSecret{tp.Static.Member.PeerSecret, []string{PeerCertFile, PeerKeyFile, PeerCAFile}})
+	}
+	if tp.IsSecureClient() {
+		secrets = append(secrets,
+			tlsSecret{tp.Static.Member.ServerSecret, []string{ServerCertFile, ServerKeyFile, ServerCAFile}},
+			tlsSecret{tp.Static.OperatorSecret, []string{etcdutil.CliCertFile, etcdutil.CliKeyFile, etcdutil.CliCAFile}})
+	}
+	for _, ts := range secrets {
+		secret, err := kubecli.CoreV1().Secrets(ns).Get(ts.name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get TLS secret (%s): %v", ts.name, err)
+		}
+		for _, k := range ts.keys {
+			if len(secret.Data[k]) == 0 {
+				return fmt.Errorf("TLS secret (%s) has no %s", ts.name, k)
+			}
+		}
+	}
+	return nil
+}
+
+// CASecretName returns the name of the secret with the CA the operator generated for the cluster.
+func CASecretName(clusterName string) string {
+	return clusterName + "-ca"
+}
+
+// NewCASecret returns the secret with the certificate and key of the CA of the cluster.
+func NewCASecret(clusterName, ns string, cert, key []byte, owner metav1.OwnerReference) *v1.Secret {
+	s := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CASecretName(clusterName),
+			Namespace: ns,
+			Labels:    LabelsForCluster(clusterName),
+		},
+		Data: map[string][]byte{
+			CACertFile: cert,
+			CAKeyFile:  key,
+		},
+	}
+	addOwnerRefToObject(s.GetObjectMeta(), owner)
+	return s
+}
+
+// UpdateSecretData sets the keys of data in the secret, leaving its other keys as they are.
+func UpdateSecretData(kubecli kubernetes.Interface, ns, name string, data map[string][]byte) error {
+	si := kubecli.CoreV1().Secrets(ns)
+	s, err := si.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if s.Data == nil {
+		s.Data = map[string][]byte{}
+	}
+	for k, v := range data {
+		s.Data[k] = v
+	}
+	_, err = si.Update(s)
+	return err
+}
+
+// PeerCertHosts returns the names the peer certificates of the members must be valid for,
+// given the subdomain of their pods, see MemberSubdomain.
+func PeerCertHosts(subdomain, ns string) []string {
+	return []string{
+		fmt.Sprintf("*.%s.%s.svc", subdomain, ns),
+		fmt.Sprintf("*.%s.%s.svc.cluster.local", subdomain, ns),
+	}
+}
+
+// ServerCertHosts returns the names the server certificates of the members of the cluster must be valid for,
+// given the subdomain of their pods, see MemberSubdomain.
+func ServerCertHosts(clusterName, subdomain, ns string) []string {
+	return []string{
+		fmt.Sprintf("*.%s.%s.svc", subdomain, ns),
+		fmt.Sprintf("*.%s.%s.svc.cluster.local", subdomain, ns),
+		fmt.Sprintf("%s.%s.svc", ClientServiceName(clusterName), ns),
+		fmt.Sprintf("%s.%s.svc.cluster.local", ClientServiceName(clusterName), ns),
+		"localhost",
+		"127.0.0.1",
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metricsutil pushes the operator metrics for setups without a Prometheus that scrapes the operator.
+package metricsutil
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/sirupsen/logrus"
+)
+
+// PushPeriodically pushes the metrics of the default registry to the Pushgateway at url every interval, forever.
+// Each operator replica pushes to its own group, keyed by the instance label set to its hostname.
+func PushPeriodically(url, job string, interval time.Duration) {
+	for {
+		if err := Push(url, job, prometheus.DefaultGatherer); err != nil {
+			logrus.Warningf("failed to push metrics: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Push replaces the metrics of the group of this instance at the Pushgateway with the metrics gathered from g.
+func Push(url, job string, g prometheus.Gatherer) error {
+	return push.FromGatherer(job, push.HostnameGroupingKey(), url, g)
+}
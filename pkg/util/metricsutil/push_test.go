@@ -0,0 +1,53 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metricsutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test counter"})
+	reg.MustRegister(c)
+	c.Inc()
+
+	if err := Push(ts.URL, "etcd-operator", reg); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut {
+		t.Errorf("expect PUT, get %s", method)
+	}
+	if !strings.HasPrefix(path, "/metrics/job/etcd-operator/instance/") {
+		t.Errorf("expect push to the group of the instance, get path %s", path)
+	}
+	if !strings.Contains(body, "test_total") {
+		t.Errorf("expect pushed metrics to contain test_total, get %q", body)
+	}
+}
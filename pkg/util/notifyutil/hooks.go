@@ -0,0 +1,111 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifyutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventType is the type of a lifecycle event.
+type EventType string
+
+const (
+	// EventClusterCreated is sent once a new cluster first has a ready quorum of spec.size members.
+	EventClusterCreated EventType = "ClusterCreated"
+	// EventMemberReplaced is sent once the pod of a member replacing a dead, leaving or otherwise replaced member is created.
+	EventMemberReplaced EventType = "MemberReplaced"
+	// EventBackupCompleted is sent once a backup is saved.
+	EventBackupCompleted EventType = "BackupCompleted"
+	// EventRestoreFinished is sent once a restore succeeded or failed.
+	EventRestoreFinished EventType = "RestoreFinished"
+)
+
+// Event is a lifecycle event of a cluster or of its backups, for the platforms integrating with the operators,
+// e.g. to update a CMDB or to open a ticket.
+type Event struct {
+	Type EventType `json:"type"`
+	// Time is the time, in RFC3339, of the event.
+	Time      string `json:"time"`
+	Namespace string `json:"namespace"`
+	// Name is the name of the resource of the event: the EtcdCluster, EtcdBackup or EtcdRestore.
+	Name string `json:"name"`
+	// Cluster is the name of the etcd cluster of a restore.
+	Cluster string `json:"cluster,omitempty"`
+	// Member is the name of the new member of a MemberReplaced event.
+	Member string `json:"member,omitempty"`
+	// Error is why a restore failed, if it did.
+	Error string `json:"error,omitempty"`
+	// Message tells more about the event, e.g. the path of a backup.
+	Message string `json:"message,omitempty"`
+}
+
+// NewEvent returns the event of the given type about the resource ns/name, at the current time.
+func NewEvent(t EventType, ns, name string) Event {
+	return Event{Type: t, Time: time.Now().Format(time.RFC3339), Namespace: ns, Name: name}
+}
+
+// Hook is told about the lifecycle events. A downstream platform implements it to integrate with the operators
+// without forking them, or uses the webhooks of NewWebhookHooks.
+type Hook interface {
+	// OnEvent handles the event. It may block: it is never called from the goroutines that manage the clusters.
+	OnEvent(ev Event) error
+}
+
+// Hooks are the hooks of an operator. A nil Hooks discards all events.
+type Hooks []Hook
+
+var hookLogger = logrus.WithField("pkg", "notifyutil")
+
+// Fire passes the event to every hook in the background.
+// Failures are only logged, so that an unavailable hook never holds up the operator.
+func (hs Hooks) Fire(ev Event) {
+	for _, h := range hs {
+		go func(h Hook) {
+			if err := h.OnEvent(ev); err != nil {
+				hookLogger.Warningf("lifecycle hook failed on %s event of %s/%s: %v", ev.Type, ev.Namespace, ev.Name, err)
+			}
+		}(h)
+	}
+}
+
+// webhookHook posts the events as JSON to a URL.
+type webhookHook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookHooks returns the hooks posting the events as JSON to the given comma separated webhook URLs,
+// or nil if there are none.
+func NewWebhookHooks(webhooks string) Hooks {
+	var hs Hooks
+	client := &http.Client{Timeout: webhookTimeout}
+	for _, u := range splitURLs(webhooks) {
+		hs = append(hs, &webhookHook{url: u, client: client})
+	}
+	return hs
+}
+
+func (h *webhookHook) OnEvent(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	return post(h.client, h.url, body)
+}
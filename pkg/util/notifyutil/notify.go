@@ -0,0 +1,99 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifyutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Notifier posts messages about significant events, e.g. a cluster losing quorum,
+// to webhooks. The payload is Slack compatible: {"text": "<message>"}.
+// A nil Notifier discards all messages.
+type Notifier struct {
+	logger   *logrus.Entry
+	webhooks []string
+	client   *http.Client
+}
+
+// New returns a Notifier posting to the given comma separated webhook URLs,
+// or nil if there are none.
+func New(webhooks string) *Notifier {
+	urls := splitURLs(webhooks)
+	if len(urls) == 0 {
+		return nil
+	}
+	return &Notifier{
+		logger:   logrus.WithField("pkg", "notifyutil"),
+		webhooks: urls,
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Notify posts the message to every webhook in the background.
+// Failures are only logged, so that an unavailable webhook never holds up the operator.
+func (n *Notifier) Notify(format string, args ...interface{}) {
+	if n == nil {
+		return
+	}
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{fmt.Sprintf(format, args...)})
+	if err != nil {
+		n.logger.Errorf("failed to encode notification: %v", err)
+		return
+	}
+	for _, url := range n.webhooks {
+		go n.post(url, body)
+	}
+}
+
+func (n *Notifier) post(url string, body []byte) {
+	if err := post(n.client, url, body); err != nil {
+		n.logger.Warningf("failed to post notification: %v", err)
+	}
+}
+
+// post posts the JSON body to the webhook.
+func post(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned http status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// splitURLs returns the non-empty URLs of the comma separated list.
+func splitURLs(webhooks string) []string {
+	var urls []string
+	for _, u := range strings.Split(webhooks, ",") {
+		if u = strings.TrimSpace(u); len(u) != 0 {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifyutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewWithoutWebhooks(t *testing.T) {
+	for _, webhooks := range []string{"", " , "} {
+		if n := New(webhooks); n != nil {
+			t.Errorf("expect no notifier for webhooks %q, get %v", webhooks, n)
+		}
+	}
+	// a nil notifier discards messages.
+	New("").Notify("cluster %s lost quorum", "example")
+}
+
+func TestNotify(t *testing.T) {
+	texts := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Text string }
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		texts <- payload.Text
+	}))
+	defer srv.Close()
+
+	New(srv.URL).Notify("etcd cluster %s lost quorum", "default/example")
+	select {
+	case text := <-texts:
+		if want := "etcd cluster default/example lost quorum"; text != want {
+			t.Errorf("expect text=%q, get=%q", want, text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestWebhookHooks(t *testing.T) {
+	if hs := NewWebhookHooks(" , "); hs != nil {
+		t.Errorf("expect no hooks, get %v", hs)
+	}
+	// nil hooks discard events.
+	Hooks(nil).Fire(NewEvent(EventClusterCreated, "default", "example"))
+
+	events := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		events <- ev
+	}))
+	defer srv.Close()
+
+	ev := NewEvent(EventMemberReplaced, "default", "example")
+	ev.Member = "example-0003"
+	NewWebhookHooks(srv.URL).Fire(ev)
+	select {
+	case got := <-events:
+		if got != ev {
+			t.Errorf("expect event=%+v, get=%+v", ev, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
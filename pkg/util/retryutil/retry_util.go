@@ -15,6 +15,7 @@
 package retryutil
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -39,6 +40,11 @@ type ConditionFunc func() (bool, error)
 // For example, if interval is 3s, f takes 1s, another f will be called 2s later.
 // However, if f takes longer than interval, it will be delayed.
 func Retry(interval time.Duration, maxRetries int, f ConditionFunc) error {
+	return RetryContext(context.Background(), interval, maxRetries, f)
+}
+
+// RetryContext is Retry that stops retrying once ctx is done, and then returns ctx.Err().
+func RetryContext(ctx context.Context, interval time.Duration, maxRetries int, f ConditionFunc) error {
 	if maxRetries <= 0 {
 		return fmt.Errorf("maxRetries (%d) should be > 0", maxRetries)
 	}
@@ -56,7 +62,11 @@ func Retry(interval time.Duration, maxRetries int, f ConditionFunc) error {
 		if i == maxRetries {
 			break
 		}
-		<-tick.C
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 	return &RetryError{maxRetries}
 }
@@ -0,0 +1,81 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tmputil manages the temporary files the operators write, e.g. the client certificates
+// and the AWS credentials a backup reads its cluster and its storage with.
+package tmputil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Prefix is the prefix of the temp dirs of the operators, by which Cleanup finds them.
+const Prefix = "etcd-operator-"
+
+// MinFreeBytes is the space the temp dir must have free for a temp dir to be created in it.
+var MinFreeBytes uint64 = 1 << 20
+
+// TempDir creates a new temp dir, named after Prefix and name, once it checked the temp dir has MinFreeBytes free.
+// The caller removes the dir.
+func TempDir(name string) (string, error) {
+	if err := checkFreeSpace(os.TempDir()); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir("", Prefix+name)
+}
+
+func checkFreeSpace(dir string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		// Not knowing the free space does not prevent writing.
+		return nil
+	}
+	if free := uint64(st.Bavail) * uint64(st.Bsize); free < MinFreeBytes {
+		return fmt.Errorf("temp dir %s has %d bytes free, less than %d: %v", dir, free, MinFreeBytes, syscall.ENOSPC)
+	}
+	return nil
+}
+
+// IsNoSpace tells whether err is, or reports, a write that failed as the disk is full (ENOSPC).
+// The errors are matched by their message, as they are wrapped as text on their way up.
+func IsNoSpace(err error) bool {
+	return err != nil && strings.Contains(err.Error(), syscall.ENOSPC.Error())
+}
+
+// Cleanup removes the temp dirs of the operators older than maxAge, e.g. left over by an operator that crashed
+// while it used them, and returns how many it removed. A maxAge of 0 removes them all.
+func Cleanup(maxAge time.Duration) (int, error) {
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), Prefix+"*"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, dir := range dirs {
+		fi, err := os.Stat(dir)
+		if err != nil || !fi.IsDir() || time.Since(fi.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("failed to remove temp dir (%s): %v", dir, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
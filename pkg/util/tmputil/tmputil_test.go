@@ -0,0 +1,78 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmputil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCleanup(t *testing.T) {
+	old, err := TempDir("test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(old)
+	recent, err := TempDir("test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(recent)
+	past := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Cleanup(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expect the old temp dir to be removed, get %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("expect the recent temp dir to be kept, get %v", err)
+	}
+}
+
+func TestTempDirNoSpace(t *testing.T) {
+	defer func(n uint64) { MinFreeBytes = n }(MinFreeBytes)
+	MinFreeBytes = 1<<64 - 1
+
+	_, err := TempDir("test-")
+	if !IsNoSpace(err) {
+		t.Errorf("expect a no space error, get %v", err)
+	}
+}
+
+func TestIsNoSpace(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil},
+		{err: errors.New("connection refused")},
+		{err: &os.PathError{Op: "write", Path: "/tmp/x", Err: syscall.ENOSPC}, want: true},
+		{err: fmt.Errorf("failed to write credentials: %v", &os.PathError{Op: "write", Path: "/tmp/x", Err: syscall.ENOSPC}), want: true},
+	}
+	for i, tt := range tests {
+		if got := IsNoSpace(tt.err); got != tt.want {
+			t.Errorf("#%d: expect %v, get %v", i, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// HTTPPath is the path the build of the operator is served at as JSON, GET /version.
+const HTTPPath = "/version"
+
+// Info is the build of the running operator.
+type Info struct {
+	Version   string `json:"version"`
+	GitSHA    string `json:"gitSHA"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build of the running operator.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitSHA:    GitSHA,
+		GoVersion: runtime.Version(),
+		Platform:  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+// LogInfo logs the build of the operator, e.g. "etcd-operator", at startup.
+func LogInfo(name string) {
+	info := Get()
+	logrus.Infof("%s Version: %v", name, info.Version)
+	logrus.Infof("Git SHA: %s", info.GitSHA)
+	logrus.Infof("Go Version: %s", info.GoVersion)
+	logrus.Infof("Go OS/Arch: %s", info.Platform)
+}
+
+// Handler serves the build of the operator as JSON.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Get())
+}
+
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "etcd_operator",
+	Name:      "build_info",
+	Help:      "Always 1, labeled with the version, the git SHA and the Go version the operator was built with",
+},
+	[]string{"version", "git_sha", "go_version"},
+)
+
+func init() {
+	prometheus.MustRegister(buildInfo)
+	buildInfo.WithLabelValues(Version, GitSHA, runtime.Version()).Set(1)
+}